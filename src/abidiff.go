@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	abiFromRegistry = "registry"
+	abiFromExplorer = "explorer"
+)
+
+// abiDiff is how a contract's ABI changes from the deployed one to the
+// local build.
+type abiDiff struct {
+	Name      string         `json:"name,omitempty"`
+	Address   common.Address `json:"address"`
+	From      string         `json:"from"`
+	Contract  string         `json:"contract"`
+	Functions abiChanges     `json:"functions"`
+	Events    abiChanges     `json:"events"`
+}
+
+type abiChanges struct {
+	Added   []string    `json:"added"`
+	Removed []string    `json:"removed"`
+	Changed []abiChange `json:"changed"`
+}
+
+// abiChange is an entry whose signature stayed the same while what the
+// selector does not cover changed.
+type abiChange struct {
+	Signature string   `json:"signature"`
+	Changes   []string `json:"changes"`
+}
+
+func (c abiChanges) empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0
+}
+
+func runABIDiff(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("abi-diff", &rpcURL)
+	network := addRegistryFlag(fs)
+	contractRef := fs.String("contract", "", "compare with this artifact (File.sol or File.sol:Name) instead of the recorded one")
+	from := fs.String("from", "", "take the deployed ABI from the registry, or the explorer's verified source (default: registry for deployment names, explorer for addresses)")
+	explorerAPI := fs.String("explorer-api", "", "Etherscan-compatible API endpoint (default: Etherscan)")
+	apiKey := fs.String("api-key", "${ETHERSCAN_API_KEY}", "explorer API key; environment variables are expanded")
+	output := fs.String("output", outputText, "text, or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: abi-diff [-network name] [-contract File.sol:Name] [-from registry|explorer] <deployment name or address>")
+	}
+	if *output != outputText && *output != outputJSON {
+		return fmt.Errorf("unknown -output %q (want text or json)", *output)
+	}
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+
+	d := &abiDiff{From: *from, Contract: *contractRef}
+	var entry *registryEntry
+	if strings.HasPrefix(fs.Arg(0), "0x") {
+		if d.Address, err = parseAddress(fs.Arg(0)); err != nil {
+			return err
+		}
+	} else {
+		reg, err := loadRegistry(root, *network)
+		if err != nil {
+			return err
+		}
+		if entry, err = reg.lookup(fs.Arg(0)); err != nil {
+			return err
+		}
+		d.Name, d.Address = fs.Arg(0), entry.Address
+		if entry.Proxy != nil {
+			// The proxy's own ABI is not the contract's; compare the
+			// implementation behind it.
+			d.Address = entry.Proxy.Implementation
+		}
+	}
+	switch {
+	case d.From == "" && entry != nil:
+		d.From = abiFromRegistry
+	case d.From == "":
+		d.From = abiFromExplorer
+	case d.From == abiFromRegistry && entry == nil:
+		return errors.New("-from registry needs a deployment name, not an address")
+	case d.From != abiFromRegistry && d.From != abiFromExplorer:
+		return fmt.Errorf("unknown -from %q (want registry or explorer)", d.From)
+	}
+	if d.Contract == "" {
+		if entry == nil || entry.Source == "" {
+			return fmt.Errorf("%s has no recorded source; pass -contract", fs.Arg(0))
+		}
+		d.Contract = entry.Source + ":" + entry.Contract
+	}
+	art, err := loadArtifact(root, d.Contract)
+	if err != nil {
+		return err
+	}
+
+	var deployed abi.ABI
+	if d.From == abiFromRegistry {
+		if len(entry.ABI) == 0 {
+			return fmt.Errorf("%s has no ABI in the registry; pass -from explorer", d.Name)
+		}
+		if deployed, err = abi.JSON(strings.NewReader(string(entry.ABI))); err != nil {
+			return fmt.Errorf("%s: registry ABI: %w", d.Name, err)
+		}
+	} else {
+		client, err := dial(ctx, rpcURL)
+		if err != nil {
+			return err
+		}
+		chainID, err := client.ChainID(ctx)
+		client.Close()
+		if err != nil {
+			return err
+		}
+		explorer := newExplorerClient(explorerConfig{API: *explorerAPI, APIKey: *apiKey}, chainID.Uint64())
+		if deployed, err = explorer.verifiedABI(ctx, d.Address); err != nil {
+			return err
+		}
+	}
+
+	d.Functions = diffFunctions(deployed.Methods, art.ABI.Methods)
+	d.Events = diffEvents(deployed.Events, art.ABI.Events)
+	if *output == outputJSON {
+		return printJSON(d)
+	}
+	d.print()
+	return nil
+}
+
+// verifiedABI fetches the ABI of the contract verified at addr.
+func (c *explorerClient) verifiedABI(ctx context.Context, addr common.Address) (abi.ABI, error) {
+	resp, err := c.get(ctx, url.Values{"module": {"contract"}, "action": {"getabi"}, "address": {addr.Hex()}})
+	if err != nil {
+		return abi.ABI{}, err
+	}
+	if resp.Status != "1" {
+		return abi.ABI{}, fmt.Errorf("explorer has no ABI for %s: %s", addr.Hex(), resp.Result)
+	}
+	parsed, err := abi.JSON(strings.NewReader(resp.Result))
+	if err != nil {
+		return abi.ABI{}, fmt.Errorf("explorer ABI for %s: %w", addr.Hex(), err)
+	}
+	return parsed, nil
+}
+
+// diffFunctions matches functions by signature, so overloads are told
+// apart and a function whose parameters changed shows as removed and added.
+func diffFunctions(old, new map[string]abi.Method) abiChanges {
+	bySig := func(methods map[string]abi.Method) map[string]abi.Method {
+		out := make(map[string]abi.Method, len(methods))
+		for _, m := range methods {
+			out[m.Sig] = m
+		}
+		return out
+	}
+	return diffEntries(bySig(old), bySig(new), functionLabel, func(o, n abi.Method) []string {
+		var changes []string
+		if o.StateMutability != n.StateMutability {
+			changes = append(changes, fmt.Sprintf("%s -> %s", o.StateMutability, n.StateMutability))
+		}
+		if ot, nt := argTypes(o.Outputs), argTypes(n.Outputs); ot != nt {
+			changes = append(changes, fmt.Sprintf("returns (%s) -> (%s)", ot, nt))
+		}
+		if on, nn := argNames(o.Inputs), argNames(n.Inputs); on != nn {
+			changes = append(changes, fmt.Sprintf("parameter names (%s) -> (%s)", on, nn))
+		}
+		return changes
+	})
+}
+
+// diffEvents matches events by signature. Which parameters are indexed is
+// not part of it but changes the topics, so it shows as a change.
+func diffEvents(old, new map[string]abi.Event) abiChanges {
+	bySig := func(events map[string]abi.Event) map[string]abi.Event {
+		out := make(map[string]abi.Event, len(events))
+		for _, e := range events {
+			out[e.Sig] = e
+		}
+		return out
+	}
+	return diffEntries(bySig(old), bySig(new), eventLabel, func(o, n abi.Event) []string {
+		var changes []string
+		if oi, ni := indexedArgs(o.Inputs), indexedArgs(n.Inputs); oi != ni {
+			changes = append(changes, fmt.Sprintf("indexed (%s) -> (%s)", oi, ni))
+		}
+		if o.Anonymous != n.Anonymous {
+			changes = append(changes, fmt.Sprintf("anonymous %t -> %t", o.Anonymous, n.Anonymous))
+		}
+		if on, nn := argNames(o.Inputs), argNames(n.Inputs); on != nn {
+			changes = append(changes, fmt.Sprintf("parameter names (%s) -> (%s)", on, nn))
+		}
+		return changes
+	})
+}
+
+func diffEntries[T any](old, new map[string]T, label func(T) string, compare func(o, n T) []string) abiChanges {
+	c := abiChanges{Added: []string{}, Removed: []string{}, Changed: []abiChange{}}
+	for _, sig := range sortedKeys(new) {
+		o, ok := old[sig]
+		if !ok {
+			c.Added = append(c.Added, label(new[sig]))
+			continue
+		}
+		if changes := compare(o, new[sig]); len(changes) > 0 {
+			c.Changed = append(c.Changed, abiChange{Signature: sig, Changes: changes})
+		}
+	}
+	for _, sig := range sortedKeys(old) {
+		if _, ok := new[sig]; !ok {
+			c.Removed = append(c.Removed, label(old[sig]))
+		}
+	}
+	return c
+}
+
+func functionLabel(m abi.Method) string {
+	s := m.Sig
+	if len(m.Outputs) > 0 {
+		s += " returns (" + argTypes(m.Outputs) + ")"
+	}
+	if m.StateMutability != "" && m.StateMutability != "nonpayable" {
+		s += " " + m.StateMutability
+	}
+	return s
+}
+
+func eventLabel(e abi.Event) string {
+	return e.Name + "(" + indexedArgs(e.Inputs) + ")"
+}
+
+func argTypes(args abi.Arguments) string {
+	types := make([]string, len(args))
+	for i, a := range args {
+		types[i] = a.Type.String()
+	}
+	return strings.Join(types, ",")
+}
+
+func argNames(args abi.Arguments) string {
+	names := make([]string, len(args))
+	for i, a := range args {
+		names[i] = a.Name
+	}
+	return strings.Join(names, ",")
+}
+
+// indexedArgs lists the parameter types, marking the indexed ones.
+func indexedArgs(args abi.Arguments) string {
+	types := make([]string, len(args))
+	for i, a := range args {
+		types[i] = a.Type.String()
+		if a.Indexed {
+			types[i] += " indexed"
+		}
+	}
+	return strings.Join(types, ",")
+}
+
+func (d *abiDiff) print() {
+	at := d.Address.Hex()
+	if d.Name != "" {
+		at = d.Name + " at " + at
+	}
+	fmt.Printf("%s: %s ABI -> %s\n", at, d.From, d.Contract)
+	if d.Functions.empty() && d.Events.empty() {
+		fmt.Println("no changes")
+		return
+	}
+	for _, section := range []struct {
+		kind    string
+		changes abiChanges
+	}{{"function", d.Functions}, {"event", d.Events}} {
+		for _, s := range section.changes.Removed {
+			fmt.Printf("  - %s %s\n", section.kind, s)
+		}
+		for _, s := range section.changes.Added {
+			fmt.Printf("  + %s %s\n", section.kind, s)
+		}
+		for _, c := range section.changes.Changed {
+			fmt.Printf("  ~ %s %s: %s\n", section.kind, c.Signature, strings.Join(c.Changes, "; "))
+		}
+	}
+	if n := len(d.Functions.Removed); n > 0 {
+		fmt.Printf("%d function(s) removed: callers still using them will fail after an upgrade\n", n)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient/gethclient"
+)
+
+// wantsAccessList reports whether a transaction sent with g should carry
+// an EIP-2930 access list. Lists are only generated for direct calls to a
+// contract: Safe and user operation transactions are built elsewhere, and
+// zkSync has its own transaction type.
+func (r *networkRun) wantsAccessList(g gasConfig, fields txFields) bool {
+	if g.AccessList == nil || !*g.AccessList || fields.To == nil || r.safe != nil || r.userOp != nil {
+		return false
+	}
+	_, ok := r.chain.(evmChain)
+	return ok
+}
+
+// createAccessList asks the node for the storage slots msg touches, with
+// eth_createAccessList, and returns them if declaring them up front lowers
+// the gas the transaction needs. Warming a slot in the list costs less
+// than its first cold access, but each entry costs gas of its own, so
+// calls that touch little storage are sent without one. Failures only
+// leave the list out.
+func (r *networkRun) createAccessList(ctx context.Context, msg ethereum.CallMsg) types.AccessList {
+	list, _, vmErr, err := gethclient.New(r.client.Client()).CreateAccessList(ctx, msg)
+	if err != nil {
+		logger.Warn("Could not create an access list; sending without one", "network", r.name, "err", err)
+		return nil
+	}
+	if vmErr != "" || list == nil || len(*list) == 0 {
+		// A reverting call is reported by the gas estimate.
+		return nil
+	}
+	without, err := r.client.EstimateGas(ctx, msg)
+	if err != nil {
+		return nil
+	}
+	msg.AccessList = *list
+	with, err := r.client.EstimateGas(ctx, msg)
+	if err != nil {
+		return nil
+	}
+	if with >= without {
+		logger.Info("An access list would not save gas; sending without one", "network", r.name, "to", msg.To, "without", without, "with", with)
+		return nil
+	}
+	logger.Info("Using an access list", "network", r.name, "to", msg.To, "addresses", len(*list), "slots", list.StorageKeys(), "saved", without-with)
+	return *list
+}
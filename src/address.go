@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func runAddress(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("address", flag.ContinueOnError)
+	network := fs.String("network", defaultNetwork, "registry network to read")
+	list := fs.Bool("list", false, "list every deployment on the network")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	reg, err := loadRegistry(root, *network)
+	if err != nil {
+		return err
+	}
+
+	if *list {
+		for _, name := range reg.names() {
+			e := reg.Contracts[name]
+			fmt.Printf("%-24s %s  block %d\n", name, e.Address.Hex(), e.BlockNumber)
+		}
+		return nil
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: address [-network name] <deployment name>")
+	}
+	e, err := reg.lookup(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Println(e.Address.Hex())
+	return nil
+}
+
+// zeroAddressLiteral is how an argument asks for the zero address on
+// purpose. Written in hex, the zero address is rejected as a likely mistake.
+const zeroAddressLiteral = "address(0)"
+
+// explicitAddress unwraps address(0x...), which is how an argument or flag
+// insists on an address that would otherwise be taken for a placeholder,
+// such as the ERC-7528 native asset 0xEeeee...EEeE.
+func explicitAddress(s string) (string, bool) {
+	inner, ok := strings.CutPrefix(s, "address(")
+	if !ok || !strings.HasPrefix(inner, "0x") || !strings.HasSuffix(inner, ")") {
+		return s, false
+	}
+	return strings.TrimSuffix(inner, ")"), true
+}
+
+// placeholderAddresses are the hex digits of addresses that appear in
+// examples and templates rather than on chain.
+var placeholderAddresses = map[string]bool{
+	strings.Repeat("1234567890", 4): true,
+	strings.Repeat("deadbeef", 5):   true,
+}
+
+var hexDigits = regexp.MustCompile(`^[0-9a-fA-F]*$`)
+
+// parseAddress validates s as a 0x-prefixed 20-byte hex address. Mixed-case
+// input must have a valid EIP-55 checksum. The zero address and placeholders
+// such as 0x1111...1111 are rejected unless wrapped in address(...).
+func parseAddress(s string) (common.Address, error) {
+	s, explicit := explicitAddress(s)
+	digits, ok := strings.CutPrefix(s, "0x")
+	if !ok {
+		return common.Address{}, fmt.Errorf("%q is not a 0x-prefixed hex address", s)
+	}
+	if !hexDigits.MatchString(digits) {
+		return common.Address{}, fmt.Errorf("%q is not a hex address; is it a placeholder?", s)
+	}
+	if len(digits) != 2*common.AddressLength {
+		return common.Address{}, fmt.Errorf("%s has %d hex digits, want %d", s, len(digits), 2*common.AddressLength)
+	}
+	addr := common.HexToAddress(s)
+	if digits != strings.ToLower(digits) && digits != strings.ToUpper(digits) && addr.Hex()[2:] != digits {
+		// Mixed case means EIP-55; a mismatch is most likely a typo.
+		return common.Address{}, fmt.Errorf("%s has an invalid checksum (expected %s)", s, addr.Hex())
+	}
+	if explicit {
+		return addr, nil
+	}
+	if addr == (common.Address{}) {
+		return common.Address{}, fmt.Errorf("%s is the zero address; write %q if that is intended", s, zeroAddressLiteral)
+	}
+	lower := strings.ToLower(digits)
+	if placeholderAddresses[lower] || strings.Count(lower, lower[:1]) == len(lower) {
+		return common.Address{}, fmt.Errorf("%s looks like a placeholder address; write address(%s) if it is real", s, s)
+	}
+	return addr, nil
+}
+
+// resolveAddress accepts either a hex address or the name of a deployment
+// recorded in network's registry.
+func resolveAddress(s, network string) (common.Address, error) {
+	if _, explicit := explicitAddress(s); explicit || strings.HasPrefix(s, "0x") {
+		return parseAddress(s)
+	}
+	root, err := projectRoot()
+	if err != nil {
+		return common.Address{}, err
+	}
+	reg, err := loadRegistry(root, network)
+	if err != nil {
+		return common.Address{}, err
+	}
+	book, err := loadAddressBook(root, network)
+	if err != nil {
+		return common.Address{}, err
+	}
+	addr, _, err := lookupName(reg, book, s)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("%q is neither an address, a known deployment nor an address book label: %w", s, err)
+	}
+	return addr, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/ethereum/go-ethereum/common"
+	"gopkg.in/yaml.v3"
+)
+
+// addressBookFile is the address book, at the project root.
+const addressBookFile = "addressbook.yaml"
+
+// addressBookShared is the address book section whose labels apply on
+// every network.
+const addressBookShared = "*"
+
+// labelPattern matches address book labels such as treasury or
+// approver-alice. They have no dots, so they never look like ENS names, and
+// start with a letter, so they never look like hex.
+var labelPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+func isAddressLabel(s string) bool {
+	return labelPattern.MatchString(s)
+}
+
+// An addressBook names the accounts a project deals with that it did not
+// deploy, per network:
+//
+//	sepolia:
+//	  treasury: 0x...
+//	  approver-alice: 0x...
+//	"*":                      # on every network
+//	  cold-wallet: 0x...
+//
+// Labels stand for their addresses wherever the manifest or a command takes
+// an address, and logs, traces and events show them next to the addresses
+// they name. A nil book has no labels.
+type addressBook struct {
+	network string
+	labels  map[string]common.Address
+	names   map[common.Address]string
+}
+
+// loadAddressBook reads the labels for network from root's address book,
+// if there is one. A network's own labels take precedence over shared
+// ones.
+func loadAddressBook(root, network string) (*addressBook, error) {
+	b := &addressBook{network: network, labels: map[string]common.Address{}, names: map[common.Address]string{}}
+	path := filepath.Join(root, addressBookFile)
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sections map[string]map[string]string
+	if err := yaml.Unmarshal(raw, &sections); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", addressBookFile, err)
+	}
+	for _, section := range []string{addressBookShared, network} {
+		for label, s := range sections[section] {
+			if !isAddressLabel(label) {
+				return nil, fmt.Errorf("%s: %s: invalid label %q (want letters, digits, _ and -, starting with a letter)", addressBookFile, section, label)
+			}
+			addr, err := parseAddress(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %s: %w", addressBookFile, section, label, err)
+			}
+			b.labels[label] = addr
+		}
+	}
+	for label, addr := range b.labels {
+		if other, ok := b.names[addr]; ok && other < label {
+			continue
+		}
+		b.names[addr] = label
+	}
+	return b, nil
+}
+
+// lookup returns the address labelled label.
+func (b *addressBook) lookup(label string) (common.Address, bool) {
+	if b == nil {
+		return common.Address{}, false
+	}
+	addr, ok := b.labels[label]
+	return addr, ok
+}
+
+// resolve returns the address labelled label, or an error naming the
+// network whose book lacks it.
+func (b *addressBook) resolve(label string) (common.Address, error) {
+	if addr, ok := b.lookup(label); ok {
+		return addr, nil
+	}
+	network := ""
+	if b != nil {
+		network = " for " + b.network
+	}
+	return common.Address{}, fmt.Errorf("%q is not a label in %s%s", label, addressBookFile, network)
+}
+
+// annotate renders addr with its label, as label@0x..., or as plain hex if
+// the book does not name it.
+func (b *addressBook) annotate(addr common.Address) string {
+	if b != nil {
+		if label, ok := b.names[addr]; ok {
+			return label + "@" + addr.Hex()
+		}
+	}
+	return addr.Hex()
+}
+
+// format is formatValue with the addresses in v annotated.
+func (b *addressBook) format(v interface{}) string {
+	return formatValueWith(v, b.annotate)
+}
+
+// formatValues is the book's formatValues.
+func (b *addressBook) formatValues(values []interface{}) string {
+	return formatValuesWith(values, b.annotate)
+}
+
+// lookupName resolves a bare name given for an account: a deployment in
+// reg, or a label in book. A name that is both is refused rather than
+// guessed at; the entry is nil for labels.
+func lookupName(reg *registry, book *addressBook, name string) (common.Address, *registryEntry, error) {
+	addr, labelled := book.lookup(name)
+	if _, deployed := reg.Contracts[name]; deployed {
+		if labelled {
+			return common.Address{}, nil, fmt.Errorf("%s is both a deployment on %s and a label in %s; use the address", name, reg.Network, addressBookFile)
+		}
+	} else if labelled {
+		return addr, nil, nil
+	}
+	e, err := reg.lookup(name)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	return e.Address, e, nil
+}
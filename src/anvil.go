@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// anvilConfig runs a network against a throwaway anvil node started for
+// the run, optionally forking another chain:
+//
+//	networks:
+//	  fork:
+//	    anvil:
+//	      fork: ${MAINNET_RPC_URL}
+//	      forkBlock: 19000000   # pin the fork for reproducible runs
+//
+// The node listens on a free local port and is stopped when the run ends.
+type anvilConfig struct {
+	Fork      string `yaml:"fork"`
+	ForkBlock uint64 `yaml:"forkBlock"`
+	// Args are passed to anvil as is, e.g. ["--block-time", "2"].
+	Args []string `yaml:"args"`
+}
+
+const anvilStartTimeout = 30 * time.Second
+
+// anvilNode is a running anvil process.
+type anvilNode struct {
+	cmd    *exec.Cmd
+	url    string
+	exited chan struct{}
+	output bytes.Buffer
+}
+
+// startAnvil starts anvil on a free port and waits until it answers RPC
+// requests.
+func startAnvil(ctx context.Context, c anvilConfig) (*anvilNode, error) {
+	if _, err := exec.LookPath("anvil"); err != nil {
+		return nil, errors.New("anvil is not installed; see https://book.getfoundry.sh/getting-started/installation")
+	}
+	// Another process can grab the port between picking and binding it, so
+	// try a few.
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		var node *anvilNode
+		if node, err = launchAnvil(ctx, c); err == nil {
+			return node, nil
+		}
+	}
+	return nil, err
+}
+
+func launchAnvil(ctx context.Context, c anvilConfig) (*anvilNode, error) {
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"--host", "127.0.0.1", "--port", strconv.Itoa(port)}
+	if c.Fork != "" {
+		args = append(args, "--fork-url", os.ExpandEnv(c.Fork))
+		if c.ForkBlock != 0 {
+			args = append(args, "--fork-block-number", strconv.FormatUint(c.ForkBlock, 10))
+		}
+	}
+	args = append(args, c.Args...)
+
+	node := &anvilNode{url: fmt.Sprintf("http://127.0.0.1:%d", port), exited: make(chan struct{})}
+	node.cmd = exec.Command("anvil", args...)
+	node.cmd.Stdout = &node.output
+	node.cmd.Stderr = &node.output
+	if err := node.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start anvil: %w", err)
+	}
+	go func() {
+		node.cmd.Wait()
+		close(node.exited)
+	}()
+
+	if err := node.waitReady(ctx); err != nil {
+		node.stop()
+		return nil, err
+	}
+	attrs := []any{"url", node.url}
+	if c.Fork != "" {
+		attrs = append(attrs, "fork", redactURL(os.ExpandEnv(c.Fork)))
+		if c.ForkBlock != 0 {
+			attrs = append(attrs, "forkBlock", c.ForkBlock)
+		}
+	}
+	logger.Info("Started anvil", attrs...)
+	return node, nil
+}
+
+// waitReady polls eth_chainId until the node responds. Forks can take a
+// while, as anvil fetches the fork block first.
+func (n *anvilNode) waitReady(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, anvilStartTimeout)
+	defer cancel()
+	for {
+		client, err := rpc.DialContext(ctx, n.url)
+		if err == nil {
+			var id string
+			err = client.CallContext(ctx, &id, "eth_chainId")
+			client.Close()
+			if err == nil {
+				return nil
+			}
+		}
+		select {
+		case <-n.exited:
+			return fmt.Errorf("anvil exited: %s", bytes.TrimSpace(n.output.Bytes()))
+		case <-ctx.Done():
+			return fmt.Errorf("anvil did not start within %s", anvilStartTimeout)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// stop interrupts anvil and waits for it to exit, killing it if it does
+// not do so promptly.
+func (n *anvilNode) stop() {
+	n.cmd.Process.Signal(os.Interrupt)
+	select {
+	case <-n.exited:
+	case <-time.After(5 * time.Second):
+		n.cmd.Process.Kill()
+		<-n.exited
+	}
+}
+
+// freePort asks the kernel for an unused local TCP port.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
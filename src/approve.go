@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+var (
+	erc20ABI = mustParseABI(`[
+		{"type":"function","name":"name","inputs":[],"outputs":[{"type":"string"}],"stateMutability":"view"},
+		{"type":"function","name":"symbol","inputs":[],"outputs":[{"type":"string"}],"stateMutability":"view"},
+		{"type":"function","name":"decimals","inputs":[],"outputs":[{"type":"uint8"}],"stateMutability":"view"},
+		{"type":"function","name":"allowance","inputs":[{"name":"owner","type":"address"},{"name":"spender","type":"address"}],"outputs":[{"type":"uint256"}],"stateMutability":"view"},
+		{"type":"function","name":"approve","inputs":[{"name":"spender","type":"address"},{"name":"value","type":"uint256"}],"outputs":[{"type":"bool"}],"stateMutability":"nonpayable"},
+		{"type":"function","name":"nonces","inputs":[{"name":"owner","type":"address"}],"outputs":[{"type":"uint256"}],"stateMutability":"view"},
+		{"type":"function","name":"DOMAIN_SEPARATOR","inputs":[],"outputs":[{"type":"bytes32"}],"stateMutability":"view"},
+		{"type":"function","name":"eip712Domain","inputs":[],"outputs":[{"name":"fields","type":"bytes1"},{"name":"name","type":"string"},{"name":"version","type":"string"},{"name":"chainId","type":"uint256"},{"name":"verifyingContract","type":"address"},{"name":"salt","type":"bytes32"},{"name":"extensions","type":"uint256[]"}],"stateMutability":"view"},
+		{"type":"function","name":"permit","inputs":[{"name":"owner","type":"address"},{"name":"spender","type":"address"},{"name":"value","type":"uint256"},{"name":"deadline","type":"uint256"},{"name":"v","type":"uint8"},{"name":"r","type":"bytes32"},{"name":"s","type":"bytes32"}],"outputs":[],"stateMutability":"nonpayable"}
+	]`)
+
+	// permit2Address is Uniswap's Permit2, at the same address on every
+	// chain it is deployed to.
+	permit2Address = common.HexToAddress("0x000000000022D473030F116dDEE9F6B43aC78BA3")
+	permit2ABI     = mustParseABI(`[
+		{"type":"function","name":"allowance","inputs":[{"name":"owner","type":"address"},{"name":"token","type":"address"},{"name":"spender","type":"address"}],"outputs":[{"name":"amount","type":"uint160"},{"name":"expiration","type":"uint48"},{"name":"nonce","type":"uint48"}],"stateMutability":"view"},
+		{"type":"function","name":"approve","inputs":[{"name":"token","type":"address"},{"name":"spender","type":"address"},{"name":"amount","type":"uint160"},{"name":"expiration","type":"uint48"}],"outputs":[],"stateMutability":"nonpayable"}
+	]`)
+)
+
+// maxUint160 is Permit2's unlimited allowance.
+var maxUint160 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 160), big.NewInt(1))
+
+// erc20Token is an ERC-20 bound with the standard ABI, so tokens deployed
+// elsewhere need no artifact.
+type erc20Token struct {
+	*boundContract
+	symbol   string
+	decimals uint8
+}
+
+// bindToken resolves s, an address, ENS name or registry name, to an
+// ERC-20 and reads its symbol and decimals.
+func (r *networkRun) bindToken(ctx context.Context, s string) (*erc20Token, error) {
+	addr, err := r.resolveAccount(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	t := &erc20Token{boundContract: &boundContract{Address: addr, ABI: erc20ABI, client: r.client}}
+	out, err := t.Call(ctx, "decimals")
+	if err != nil {
+		return nil, fmt.Errorf("%s does not look like an ERC-20 token: %w", s, err)
+	}
+	t.decimals = out[0].(uint8)
+	if out, err := t.Call(ctx, "symbol"); err == nil {
+		t.symbol = out[0].(string)
+	}
+	return t, nil
+}
+
+// resolveAccount resolves an address, ENS name, registry name or address
+// book label.
+func (r *networkRun) resolveAccount(ctx context.Context, s string) (common.Address, error) {
+	if strings.HasPrefix(s, "0x") || isENSName(s) {
+		return r.ens.resolveAddressArg(ctx, s)
+	}
+	addr, _, err := lookupName(r.registry, r.book, s)
+	return addr, err
+}
+
+// amount reads an amount of the token: "max" for an unlimited allowance,
+// else whole tokens scaled by its decimals, or base units with raw.
+func (t *erc20Token) amount(s string, raw bool) (*big.Int, error) {
+	if s == "max" {
+		return math.MaxBig256, nil
+	}
+	decimals := t.decimals
+	if raw {
+		decimals = 0
+	}
+	n, err := parseUnits(s, decimals)
+	if err != nil {
+		return nil, fmt.Errorf("-amount: %w", err)
+	}
+	return n, nil
+}
+
+// format renders an amount of the token in whole tokens.
+func (t *erc20Token) format(n *big.Int) string {
+	if n.Cmp(math.MaxBig256) == 0 || n.Cmp(maxUint160) == 0 {
+		return "unlimited " + t.symbol
+	}
+	return strings.TrimSpace(formatUnits(n, t.decimals) + " " + t.symbol)
+}
+
+func runApprove(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("approve", &rpcURL)
+	rf := addRunFlags(fs)
+	tokenRef := fs.String("token", "", "ERC-20 token address, ENS name or registry name")
+	spenderRef := fs.String("spender", "", "account to approve: address, ENS name or registry name")
+	amountFlag := fs.String("amount", "", `allowance in whole tokens (e.g. 1000, 2.5), or "max"`)
+	raw := fs.Bool("raw", false, "-amount is in the token's base units rather than whole tokens")
+	viaPermit2 := fs.Bool("permit2", false, "approve Permit2 on the token, then grant the spender an allowance through Permit2")
+	expiration := fs.Duration("expiration", 30*24*time.Hour, "with -permit2, how long the spender's allowance lasts")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *tokenRef == "" || *spenderRef == "" || *amountFlag == "" {
+		return errors.New("-token, -spender and -amount are required")
+	}
+	m, selected, err := rf.load(ctx, fs, rpcURL, nil)
+	if err != nil {
+		return err
+	}
+	if len(selected) != 1 {
+		return errors.New("approve runs against a single network; pick one with -network")
+	}
+	run, err := openNetworkRun(ctx, m, selected[0], rf.options())
+	if err != nil {
+		return err
+	}
+	defer run.close()
+
+	t, err := run.bindToken(ctx, *tokenRef)
+	if err != nil {
+		return err
+	}
+	spender, err := run.resolveAccount(ctx, *spenderRef)
+	if err != nil {
+		return err
+	}
+	amount, err := t.amount(*amountFlag, *raw)
+	if err != nil {
+		return err
+	}
+	owner := run.from()
+
+	if !*viaPermit2 {
+		sent, err := t.approve(ctx, run, owner, spender, amount)
+		if err != nil || sent == nil {
+			return err
+		}
+		return reportApproval(rf, run, t.Address, "approve", sent)
+	}
+
+	// Checked before the token approval, which would otherwise be paid for
+	// and left pointing at an empty address.
+	if code, err := run.client.CodeAt(ctx, permit2Address, nil); err != nil {
+		return err
+	} else if len(code) == 0 {
+		return fmt.Errorf("Permit2 is not deployed at %s on %s", permit2Address.Hex(), run.name)
+	}
+	if amount.Cmp(maxUint160) > 0 {
+		amount = maxUint160
+	}
+	// Permit2 moves the tokens, so it needs the token allowance; the
+	// spender's own allowance and its expiry are kept by Permit2.
+	if _, err := t.approve(ctx, run, owner, permit2Address, amount); err != nil {
+		return err
+	}
+	p2 := &boundContract{Address: permit2Address, ABI: permit2ABI, client: run.client}
+	until := big.NewInt(time.Now().Add(*expiration).Unix())
+	sent, err := p2.sendMethod(ctx, run, nil, "approve", t.Address, spender, amount, until)
+	if err != nil {
+		if sent != nil && sent.Reverted {
+			return fmt.Errorf("Permit2.approve reverted: %w", err)
+		}
+		return err
+	}
+	if !run.opts.DryRun {
+		logger.Info("Granted Permit2 allowance", "network", run.name, "token", t.Address, "spender", run.book.annotate(spender), "amount", t.format(amount), "expires", time.Unix(until.Int64(), 0).UTC().Format(time.RFC3339))
+	}
+	return reportApproval(rf, run, permit2Address, "approve", sent)
+}
+
+// approve sets owner's allowance for spender to amount, unless it already
+// is; it then returns no transaction.
+func (t *erc20Token) approve(ctx context.Context, r *networkRun, owner, spender common.Address, amount *big.Int) (*sentTx, error) {
+	out, err := t.callMethod(ctx, "allowance", owner, spender)
+	if err != nil {
+		return nil, err
+	}
+	if current := out[0].(*big.Int); current.Cmp(amount) == 0 {
+		logger.Info("Allowance already set", "network", r.name, "token", t.Address, "spender", r.book.annotate(spender), "amount", t.format(amount))
+		return nil, nil
+	} else if current.Sign() > 0 && amount.Sign() > 0 {
+		// Some tokens, USDT among them, refuse to change a non-zero
+		// allowance other than to zero.
+		logger.Warn("Changing a non-zero allowance; some tokens require resetting it to 0 first", "token", t.Address, "current", t.format(current))
+	}
+	sent, err := t.sendMethod(ctx, r, nil, "approve", spender, amount)
+	if err != nil {
+		if sent != nil && sent.Reverted {
+			return sent, fmt.Errorf("approve reverted: %w", err)
+		}
+		return sent, err
+	}
+	if !r.opts.DryRun {
+		logger.Info("Approved", "network", r.name, "token", t.Address, "spender", r.book.annotate(spender), "amount", t.format(amount))
+	}
+	return sent, nil
+}
+
+func reportApproval(rf *runFlags, run *networkRun, to common.Address, method string, sent *sentTx) error {
+	if rf.output == outputJSON {
+		return printJSON(newTxReport(run, to, method, sent, rf.dryRun))
+	}
+	if rf.dryRun {
+		fmt.Printf("DRY RUN: %s on %s would succeed (gas %d)\n", method, to.Hex(), sent.Gas)
+		return nil
+	}
+	run.printSent(sent)
+	return nil
+}
+
+// permitReport is a signed EIP-2612 permit, for a spender or relayer to
+// submit.
+type permitReport struct {
+	Token     common.Address `json:"token"`
+	Owner     common.Address `json:"owner"`
+	Spender   common.Address `json:"spender"`
+	Value     *hexutil.Big   `json:"value"`
+	Nonce     *hexutil.Big   `json:"nonce"`
+	Deadline  uint64         `json:"deadline"`
+	Signature hexutil.Bytes  `json:"signature"`
+	V         uint8          `json:"v"`
+	R         common.Hash    `json:"r"`
+	S         common.Hash    `json:"s"`
+	TxHash    *common.Hash   `json:"txHash,omitempty"`
+}
+
+// runPermit signs an EIP-2612 permit from the signer, which lets the
+// spender's allowance be set without the owner sending a transaction, and
+// prints it or, with -send, submits it.
+func runPermit(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("permit", &rpcURL)
+	rf := addRunFlags(fs)
+	tokenRef := fs.String("token", "", "ERC-2612 token address, ENS name or registry name")
+	spenderRef := fs.String("spender", "", "account to approve: address, ENS name or registry name")
+	amountFlag := fs.String("amount", "", `allowance in whole tokens (e.g. 1000, 2.5), or "max"`)
+	raw := fs.Bool("raw", false, "-amount is in the token's base units rather than whole tokens")
+	deadline := fs.Duration("deadline", time.Hour, "how long the permit can be submitted for")
+	version := fs.String("version", "", `EIP-712 domain version (default: the token's eip712Domain, else "1")`)
+	submit := fs.Bool("send", false, "submit the permit in a transaction instead of only printing it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *tokenRef == "" || *spenderRef == "" || *amountFlag == "" {
+		return errors.New("-token, -spender and -amount are required")
+	}
+	m, selected, err := rf.load(ctx, fs, rpcURL, nil)
+	if err != nil {
+		return err
+	}
+	if len(selected) != 1 {
+		return errors.New("permit runs against a single network; pick one with -network")
+	}
+	run, err := openNetworkRun(ctx, m, selected[0], rf.options())
+	if err != nil {
+		return err
+	}
+	defer run.close()
+	ms, ok := run.sender.(messageSigner)
+	if !ok {
+		return errors.New("the signer cannot sign EIP-712 data, which permits are")
+	}
+	// The permit's owner signs it; a Safe or smart account would need
+	// ERC-1271, which EIP-2612 tokens do not check.
+	owner := run.sender.Address()
+	if run.from() != owner {
+		return errors.New("a permit is signed by the signer's own account; approve from a Safe or smart account instead")
+	}
+
+	t, err := run.bindToken(ctx, *tokenRef)
+	if err != nil {
+		return err
+	}
+	spender, err := run.resolveAccount(ctx, *spenderRef)
+	if err != nil {
+		return err
+	}
+	amount, err := t.amount(*amountFlag, *raw)
+	if err != nil {
+		return err
+	}
+	out, err := t.callMethod(ctx, "nonces", owner)
+	if err != nil {
+		return fmt.Errorf("%s does not support EIP-2612 permits (no nonces): %w", t.Address.Hex(), err)
+	}
+	nonce := out[0].(*big.Int)
+	domain, err := run.permitDomain(ctx, t, *version)
+	if err != nil {
+		return err
+	}
+	report := permitReport{
+		Token:    t.Address,
+		Owner:    owner,
+		Spender:  spender,
+		Value:    (*hexutil.Big)(amount),
+		Nonce:    (*hexutil.Big)(nonce),
+		Deadline: uint64(time.Now().Add(*deadline).Unix()),
+	}
+	data := apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+				{Name: "verifyingContract", Type: "address"},
+			},
+			"Permit": {
+				{Name: "owner", Type: "address"},
+				{Name: "spender", Type: "address"},
+				{Name: "value", Type: "uint256"},
+				{Name: "nonce", Type: "uint256"},
+				{Name: "deadline", Type: "uint256"},
+			},
+		},
+		PrimaryType: "Permit",
+		Domain:      domain,
+		Message: apitypes.TypedDataMessage{
+			"owner":    owner.Hex(),
+			"spender":  spender.Hex(),
+			"value":    hexutil.EncodeBig(amount),
+			"nonce":    hexutil.EncodeBig(nonce),
+			"deadline": hexutil.EncodeUint64(report.Deadline),
+		},
+	}
+	hash, _, err := typedDataHash(data)
+	if err != nil {
+		return err
+	}
+	sig, err := ms.SignTypedData(ctx, data)
+	if err != nil {
+		return fmt.Errorf("sign: %w", err)
+	}
+	if got, err := recoverSigner(hash, sig); err != nil || got != owner {
+		return fmt.Errorf("the signature does not recover to %s", owner.Hex())
+	}
+	report.Signature, report.V = sig, sig[64]
+	report.R, report.S = common.BytesToHash(sig[:32]), common.BytesToHash(sig[32:64])
+
+	if *submit {
+		sent, err := t.sendMethod(ctx, run, nil, "permit", owner, spender, amount, new(big.Int).SetUint64(report.Deadline), report.V, [32]byte(report.R), [32]byte(report.S))
+		if err != nil {
+			if sent != nil && sent.Reverted {
+				return fmt.Errorf("permit reverted: %w", err)
+			}
+			return err
+		}
+		if !rf.dryRun {
+			report.TxHash = &sent.Hash
+		}
+	}
+	if rf.output == outputJSON {
+		return printJSON(report)
+	}
+	fmt.Println("Owner:    ", report.Owner.Hex())
+	fmt.Println("Spender:  ", report.Spender.Hex())
+	fmt.Println("Value:    ", t.format(amount))
+	fmt.Println("Nonce:    ", nonce)
+	fmt.Println("Deadline: ", time.Unix(int64(report.Deadline), 0).UTC().Format(time.RFC3339), "("+fmt.Sprint(report.Deadline)+")")
+	fmt.Println("Signature:", report.Signature)
+	fmt.Println("v:        ", report.V)
+	fmt.Println("r:        ", report.R.Hex())
+	fmt.Println("s:        ", report.S.Hex())
+	if report.TxHash != nil {
+		fmt.Println("tx:       ", report.TxHash.Hex())
+		if url := run.site.tx(*report.TxHash); url != "" {
+			fmt.Println("explorer: ", url)
+		}
+	}
+	return nil
+}
+
+// permitDomain returns the token's EIP-712 domain: from eip712Domain
+// (EIP-5267) when it has one, else its name and version. The domain is
+// checked against the token's DOMAIN_SEPARATOR, since a permit signed for
+// another domain only fails once submitted.
+func (r *networkRun) permitDomain(ctx context.Context, t *erc20Token, version string) (apitypes.TypedDataDomain, error) {
+	domain := apitypes.TypedDataDomain{
+		ChainId:           (*math.HexOrDecimal256)(r.chainID),
+		VerifyingContract: t.Address.Hex(),
+	}
+	if out, err := t.Call(ctx, "eip712Domain"); err == nil {
+		domain.Name, domain.Version = out[1].(string), out[2].(string)
+	} else {
+		out, err := t.Call(ctx, "name")
+		if err != nil {
+			return domain, err
+		}
+		domain.Name, domain.Version = out[0].(string), "1"
+	}
+	if version != "" {
+		domain.Version = version
+	}
+	out, err := t.Call(ctx, "DOMAIN_SEPARATOR")
+	if err != nil {
+		return domain, fmt.Errorf("%s does not support EIP-2612 permits (no DOMAIN_SEPARATOR): %w", t.Address.Hex(), err)
+	}
+	want := out[0].([32]byte)
+	got, err := (&apitypes.TypedData{
+		Types: apitypes.Types{"EIP712Domain": {
+			{Name: "name", Type: "string"},
+			{Name: "version", Type: "string"},
+			{Name: "chainId", Type: "uint256"},
+			{Name: "verifyingContract", Type: "address"},
+		}},
+		Domain: domain,
+	}).HashStruct("EIP712Domain", domain.Map())
+	if err != nil {
+		return domain, err
+	}
+	if !bytes.Equal(got, want[:]) {
+		return domain, fmt.Errorf("the token's DOMAIN_SEPARATOR is not that of name %q, version %q; set -version", domain.Name, domain.Version)
+	}
+	return domain, nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Governance functions that change the approver set. The original
+// Governance fixes its approvers in the constructor, so only versions that
+// add these can be managed with approvers add and remove.
+const (
+	addApproverMethod    = "addApprover"
+	removeApproverMethod = "removeApprover"
+)
+
+// maxApprovers bounds the multiSigApprovers scan, in case a node answers
+// every index.
+const maxApprovers = 1000
+
+func runApprovers(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: approvers list|add|remove [flags]")
+	}
+	switch args[0] {
+	case "list":
+		return runApproversList(ctx, args[1:])
+	case "add":
+		return runApproversChange(ctx, addApproverMethod, args[1:])
+	case "remove":
+		return runApproversChange(ctx, removeApproverMethod, args[1:])
+	}
+	return fmt.Errorf("unknown approvers subcommand %q (want list, add or remove)", args[0])
+}
+
+func runApproversList(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("approvers list", &rpcURL)
+	to := fs.String("to", "Governance", "Governance address, ENS name or registry name")
+	contractRef := fs.String("contract", "", "artifact (File.sol or File.sol:Name) providing the ABI; defaults to the registry entry's")
+	network := addRegistryFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	reg, err := loadRegistry(root, *network)
+	if err != nil {
+		return err
+	}
+	c, err := bindContract(ctx, client, reg, root, *to, *contractRef)
+	if err != nil {
+		return err
+	}
+	gov := newGovernance(c)
+	approvers, err := readApprovers(ctx, gov)
+	if err != nil {
+		return err
+	}
+	required, err := gov.RequiredApprovals(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d approvers, %s approvals required to execute a proposal\n", len(approvers), required)
+	for _, a := range approvers {
+		fmt.Println(a.Hex())
+	}
+	return nil
+}
+
+// runApproversChange sends addApprover or removeApprover to Governance
+// from the run's signer, after checking the change makes sense against the
+// current approver set.
+func runApproversChange(ctx context.Context, method string, args []string) error {
+	var rpcURL string
+	verb := "add"
+	if method == removeApproverMethod {
+		verb = "remove"
+	}
+	fs := newFlagSet("approvers "+verb, &rpcURL)
+	rf := addRunFlags(fs)
+	to := fs.String("to", "Governance", "Governance address, ENS name or registry name")
+	contractRef := fs.String("contract", "", "artifact (File.sol or File.sol:Name) providing the ABI; defaults to the registry entry's")
+	address := fs.String("address", "", "approver to "+verb+", as an address or ENS name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *address == "" {
+		return errors.New("-address is required")
+	}
+	m, selected, err := rf.load(ctx, fs, rpcURL, nil)
+	if err != nil {
+		return err
+	}
+	if len(selected) != 1 {
+		return fmt.Errorf("approvers %s runs against a single network; pick one with -network", verb)
+	}
+	run, err := openNetworkRun(ctx, m, selected[0], rf.options())
+	if err != nil {
+		return err
+	}
+	defer run.close()
+
+	approver, err := run.ens.resolveAddressArg(ctx, *address)
+	if err != nil {
+		return err
+	}
+	c, err := bindContract(ctx, run.client, run.registry, run.root, *to, *contractRef)
+	if err != nil {
+		return err
+	}
+	if _, ok := c.ABI.Methods[method]; !ok {
+		return fmt.Errorf("%s has no %s(address) function; its approvers are fixed at deployment (upgrade or redeploy it to change them)", *to, method)
+	}
+	gov := newGovernance(c)
+	current, err := readApprovers(ctx, gov)
+	if err != nil {
+		return err
+	}
+	switch is := slices.Contains(current, approver); {
+	case method == addApproverMethod && is:
+		return fmt.Errorf("%s is already an approver", approver.Hex())
+	case method == removeApproverMethod && !is:
+		return fmt.Errorf("%s is not an approver", approver.Hex())
+	case method == removeApproverMethod:
+		required, err := gov.RequiredApprovals(ctx)
+		if err != nil {
+			return err
+		}
+		if left := big.NewInt(int64(len(current) - 1)); left.Cmp(required) < 0 {
+			logger.Warn("Proposals will no longer reach the required approvals", "approvers", left, "required", required)
+		}
+	}
+
+	sent, err := c.Send(ctx, run, method, approver.Hex())
+	if err != nil {
+		if sent != nil && sent.Reverted {
+			return fmt.Errorf("%s reverted: %w", method, err)
+		}
+		return err
+	}
+	if rf.output == outputJSON {
+		return printJSON(newTxReport(run, c.Address, method, sent, rf.dryRun))
+	}
+	if rf.dryRun {
+		fmt.Printf("DRY RUN: %s %s on %s would succeed (gas %d)\n", method, approver.Hex(), c.Address.Hex(), sent.Gas)
+		return nil
+	}
+	run.printSent(sent)
+	return nil
+}
+
+// readApprovers reads the public multiSigApprovers array one index at a
+// time, until the getter reverts past its end.
+func readApprovers(ctx context.Context, gov *governance) ([]common.Address, error) {
+	var approvers []common.Address
+	for i := int64(0); i < maxApprovers; i++ {
+		a, err := gov.MultiSigApprovers(ctx, big.NewInt(i))
+		if err != nil {
+			if isRevert(err) {
+				return approvers, nil
+			}
+			return nil, err
+		}
+		approvers = append(approvers, a)
+	}
+	return nil, fmt.Errorf("%s has more than %d approvers, or is not a Governance contract", gov.Address.Hex(), maxApprovers)
+}
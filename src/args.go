@@ -0,0 +1,323 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// convertArgs turns loosely typed values (from JSON flags or the manifest)
+// into the Go types abi.Pack expects for the inputs of the named function
+// (or "constructor"). Errors quote the expected signature.
+func convertArgs(name string, inputs abi.Arguments, raw []interface{}) ([]interface{}, error) {
+	if len(raw) != len(inputs) {
+		return nil, &encodingError{fmt.Errorf("%s takes %d arguments, got %d", signature(name, inputs), len(inputs), len(raw))}
+	}
+	out := make([]interface{}, len(raw))
+	for i, in := range inputs {
+		v, err := convertValue(in.Type, raw[i])
+		if err != nil {
+			label := in.Type.String()
+			if in.Name != "" {
+				label += " " + in.Name
+			}
+			return nil, &encodingError{fmt.Errorf("%s: argument %d (%s): %w", signature(name, inputs), i, label, err)}
+		}
+		out[i] = v.Interface()
+	}
+	return out, nil
+}
+
+// signature formats name and inputs like a Solidity declaration, e.g.
+// "constructor(address _token, address[] _approvers)".
+func signature(name string, inputs abi.Arguments) string {
+	params := make([]string, len(inputs))
+	for i, in := range inputs {
+		params[i] = in.Type.String()
+		if in.Name != "" {
+			params[i] += " " + in.Name
+		}
+	}
+	return name + "(" + strings.Join(params, ", ") + ")"
+}
+
+func convertValue(t abi.Type, v interface{}) (reflect.Value, error) {
+	switch t.T {
+	case abi.AddressTy:
+		// Addresses the tool computed itself are passed typed and trusted.
+		if addr, ok := v.(common.Address); ok {
+			return reflect.ValueOf(addr), nil
+		}
+		s, ok := v.(string)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("%#v is not a 20-byte hex address", v)
+		}
+		if s == zeroAddressLiteral {
+			return reflect.ValueOf(common.Address{}), nil
+		}
+		addr, err := parseAddress(s)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(addr), nil
+
+	case abi.IntTy, abi.UintTy:
+		n, err := toBigInt(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return intValue(t, n)
+
+	case abi.BoolTy:
+		b, ok := v.(bool)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("%v is not a bool", v)
+		}
+		return reflect.ValueOf(b), nil
+
+	case abi.StringTy:
+		s, ok := v.(string)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("%v is not a string", v)
+		}
+		return reflect.ValueOf(s), nil
+
+	case abi.BytesTy:
+		b, err := toBytes(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(b), nil
+
+	case abi.FixedBytesTy, abi.FunctionTy:
+		// bytes32 and the like must be given in full: padding a short
+		// value could go either way.
+		b, err := toBytes(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		out := reflect.New(t.GetType()).Elem()
+		if len(b) != out.Len() {
+			return reflect.Value{}, fmt.Errorf("%s is %d bytes, want %d for %s", hexutil.Encode(b), len(b), out.Len(), t)
+		}
+		reflect.Copy(out, reflect.ValueOf(b))
+		return out, nil
+
+	case abi.TupleTy:
+		return convertTuple(t, v)
+
+	case abi.SliceTy, abi.ArrayTy:
+		list, ok := toList(v)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("%v is not a list of %s", v, t.Elem)
+		}
+		if t.T == abi.ArrayTy && len(list) != t.Size {
+			return reflect.Value{}, fmt.Errorf("expected %d elements, got %d", t.Size, len(list))
+		}
+		var out reflect.Value
+		if t.T == abi.SliceTy {
+			out = reflect.MakeSlice(t.GetType(), len(list), len(list))
+		} else {
+			out = reflect.New(t.GetType()).Elem()
+		}
+		for i, elem := range list {
+			ev, err := convertValue(*t.Elem, elem)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("element %d: %w", i, err)
+			}
+			out.Index(i).Set(ev)
+		}
+		return out, nil
+	}
+	return reflect.Value{}, fmt.Errorf("unsupported argument type %s", t)
+}
+
+// convertTuple converts a struct argument, given as an object keyed by the
+// component names, a list in component order, or a Go struct whose fields
+// are named like the components (or tagged abi:"name").
+func convertTuple(t abi.Type, v interface{}) (reflect.Value, error) {
+	values := make([]interface{}, len(t.TupleElems))
+	switch fields := toFields(t, v).(type) {
+	case map[string]interface{}:
+		for name := range fields {
+			if !slices.Contains(t.TupleRawNames, name) {
+				return reflect.Value{}, fmt.Errorf("no component %q (want %s)", name, strings.Join(t.TupleRawNames, ", "))
+			}
+		}
+		for i, name := range t.TupleRawNames {
+			field, ok := fields[name]
+			if !ok {
+				return reflect.Value{}, fmt.Errorf("missing component %q", name)
+			}
+			values[i] = field
+		}
+	case []interface{}:
+		if len(fields) != len(t.TupleElems) {
+			return reflect.Value{}, fmt.Errorf("expected %d components, got %d", len(t.TupleElems), len(fields))
+		}
+		copy(values, fields)
+	default:
+		return reflect.Value{}, fmt.Errorf("%v is not an object or a list of components", v)
+	}
+	out := reflect.New(t.GetType()).Elem()
+	for i, elem := range t.TupleElems {
+		ev, err := convertValue(*elem, values[i])
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("%s: %w", t.TupleRawNames[i], err)
+		}
+		out.Field(i).Set(ev)
+	}
+	return out, nil
+}
+
+// toFields returns a value for tuple t as a map or list of its components:
+// Go structs, including those abi.Unpack returns, become maps keyed by
+// component name, and typed lists become plain ones.
+func toFields(t abi.Type, v interface{}) interface{} {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return v
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		if list, ok := toList(v); ok {
+			return list
+		}
+		return v
+	}
+	fields := map[string]interface{}{}
+	for i := 0; i < rv.NumField(); i++ {
+		f := rv.Type().Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Tag.Get("abi")
+		if name == "" {
+			// Go fields are named as abi names them, in camel case.
+			name = f.Name
+			for _, raw := range t.TupleRawNames {
+				if abi.ToCamelCase(raw) == f.Name {
+					name = raw
+					break
+				}
+			}
+		}
+		fields[name] = rv.Field(i).Interface()
+	}
+	return fields
+}
+
+// toList returns v as a list if it is one: a []interface{}, or any other
+// Go slice or array except byte strings.
+func toList(v interface{}) ([]interface{}, bool) {
+	if list, ok := v.([]interface{}); ok {
+		return list, true
+	}
+	rv := reflect.ValueOf(v)
+	if k := rv.Kind(); (k != reflect.Slice && k != reflect.Array) || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+	list := make([]interface{}, rv.Len())
+	for i := range list {
+		list[i] = rv.Index(i).Interface()
+	}
+	return list, true
+}
+
+// toBytes accepts 0x-prefixed hex, byte slices and byte arrays such as
+// common.Hash.
+func toBytes(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case string:
+		if !strings.HasPrefix(v, "0x") {
+			return nil, fmt.Errorf("%q is not 0x-prefixed hex", v)
+		}
+		b, err := hexutil.Decode(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", v, err)
+		}
+		return b, nil
+	case []byte:
+		return v, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Array && rv.Type().Elem().Kind() == reflect.Uint8 {
+		b := make([]byte, rv.Len())
+		reflect.Copy(reflect.ValueOf(b), rv)
+		return b, nil
+	}
+	return nil, fmt.Errorf("%#v is not 0x-prefixed hex", v)
+}
+
+// toBigInt accepts Go integers, floats without a fractional part and
+// decimal or 0x-prefixed hex strings.
+func toBigInt(v interface{}) (*big.Int, error) {
+	switch v := v.(type) {
+	case int:
+		return big.NewInt(int64(v)), nil
+	case int64:
+		return big.NewInt(v), nil
+	case uint64:
+		return new(big.Int).SetUint64(v), nil
+	case float64:
+		if v != float64(int64(v)) {
+			return nil, fmt.Errorf("%v is not an integer", v)
+		}
+		return big.NewInt(int64(v)), nil
+	case fmt.Stringer:
+		return toBigInt(v.String())
+	case string:
+		n, ok := new(big.Int).SetString(v, 0)
+		if !ok {
+			return nil, fmt.Errorf("%q is not an integer", v)
+		}
+		return n, nil
+	}
+	// Other Go integers, such as uint8 enums from Go structs.
+	rv := reflect.ValueOf(v)
+	switch {
+	case rv.CanInt():
+		return big.NewInt(rv.Int()), nil
+	case rv.CanUint():
+		return new(big.Int).SetUint64(rv.Uint()), nil
+	}
+	return nil, fmt.Errorf("%v is not an integer", v)
+}
+
+// intValue converts n to the Go type abi uses for t: native ints up to 64
+// bits, *big.Int above.
+func intValue(t abi.Type, n *big.Int) (reflect.Value, error) {
+	if t.T == abi.UintTy && n.Sign() < 0 {
+		return reflect.Value{}, fmt.Errorf("%s cannot be negative", t)
+	}
+	if t.T == abi.UintTy && n.BitLen() > t.Size {
+		return reflect.Value{}, fmt.Errorf("%s overflows %s", n, t)
+	}
+	// Signed values range from -2^(size-1) to 2^(size-1)-1.
+	if t.T == abi.IntTy {
+		limit := new(big.Int).Lsh(big.NewInt(1), uint(t.Size-1))
+		if n.Cmp(limit) >= 0 || n.Cmp(new(big.Int).Neg(limit)) < 0 {
+			return reflect.Value{}, fmt.Errorf("%s overflows %s", n, t)
+		}
+	}
+	rt := t.GetType()
+	if rt == reflect.TypeOf(&big.Int{}) {
+		return reflect.ValueOf(n), nil
+	}
+	out := reflect.New(rt).Elem()
+	if t.T == abi.UintTy {
+		out.SetUint(n.Uint64())
+	} else {
+		out.SetInt(n.Int64())
+	}
+	return out, nil
+}
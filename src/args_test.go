@@ -0,0 +1,341 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	testAddrA = "0x70997970C51812dc3A010C7d01b50e0d17dc79C8"
+	testAddrB = "0x3C44CdDdB6a900fa2b585dd299e03d12FA4293BC"
+	testAddrC = "0x90F79bf6EB2c4f870365E785982E1f101E93b906"
+	testAddrD = "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"
+)
+
+const transferTuple = `[{"name":"t","type":"tuple","components":[
+	{"name":"to","type":"address"},
+	{"name":"amount","type":"uint256"},
+	{"name":"data","type":"bytes"}]}]`
+
+// testInputs parses a JSON ABI input list.
+func testInputs(t *testing.T, inputs string) abi.Arguments {
+	t.Helper()
+	parsed, err := abi.JSON(strings.NewReader(`[{"type":"function","name":"f","inputs":` + inputs + `}]`))
+	if err != nil {
+		t.Fatalf("parse inputs: %v", err)
+	}
+	return parsed.Methods["f"].Inputs
+}
+
+// jsonArgs decodes arguments as the -args flag does, with numbers as
+// json.Number.
+func jsonArgs(t *testing.T, raw string) []interface{} {
+	t.Helper()
+	args, err := parseJSONArgs(raw)
+	if err != nil {
+		t.Fatalf("parse args: %v", err)
+	}
+	return args
+}
+
+// yamlArgs decodes arguments as a manifest's args: list is, with numbers as
+// int, or uint64 above the int64 range.
+func yamlArgs(t *testing.T, raw string) []interface{} {
+	t.Helper()
+	var args []interface{}
+	if err := yaml.Unmarshal([]byte(raw), &args); err != nil {
+		t.Fatalf("parse args: %v", err)
+	}
+	return args
+}
+
+func TestConvertArgsRoundTrip(t *testing.T) {
+	type transfer struct {
+		To     common.Address
+		Amount *big.Int
+		Data   []byte
+	}
+	type taggedTransfer struct {
+		Recipient common.Address `abi:"to"`
+		Value     *big.Int       `abi:"amount"`
+		Payload   []byte         `abi:"data"`
+	}
+	type status uint8
+
+	tests := []struct {
+		name   string
+		inputs string
+		args   []interface{}
+		// json or yaml is used instead of args when set.
+		json string
+		yaml string
+		// want, when set, is checked against the converted values.
+		want []interface{}
+	}{
+		{
+			name:   "tuple from a JSON object",
+			inputs: transferTuple,
+			json:   `[{"to":"` + testAddrA + `","amount":"1000000000000000000","data":"0xdeadbeef"}]`,
+		},
+		{
+			name:   "tuple from a JSON list",
+			inputs: transferTuple,
+			json:   `[["` + testAddrA + `", 5, "0x"]]`,
+		},
+		{
+			name:   "tuple from a Go struct",
+			inputs: transferTuple,
+			args:   []interface{}{transfer{To: common.HexToAddress(testAddrB), Amount: big.NewInt(7), Data: []byte{1, 2}}},
+		},
+		{
+			name:   "tuple from a pointer to a tagged Go struct",
+			inputs: transferTuple,
+			args:   []interface{}{&taggedTransfer{Recipient: common.HexToAddress(testAddrC), Value: big.NewInt(8), Payload: []byte{}}},
+		},
+		{
+			name: "tuple array with nested dynamic arrays",
+			inputs: `[{"name":"groups","type":"tuple[]","components":[
+				{"name":"label","type":"string"},
+				{"name":"ids","type":"uint32[]"}]}]`,
+			json: `[[{"label":"a","ids":[1,2,3]},{"label":"","ids":[]}]]`,
+		},
+		{
+			name:   "nested dynamic arrays",
+			inputs: `[{"name":"m","type":"uint256[][]"}]`,
+			json:   `[[["1","2"],[],["0x10"]]]`,
+			want:   []interface{}{[][]*big.Int{{big.NewInt(1), big.NewInt(2)}, {}, {big.NewInt(16)}}},
+		},
+		{
+			name:   "dynamic array of fixed arrays",
+			inputs: `[{"name":"pairs","type":"address[2][]"}]`,
+			json:   `[[["` + testAddrA + `","` + testAddrB + `"],["` + testAddrC + `","` + testAddrD + `"]]]`,
+		},
+		{
+			name:   "fixed array of fixed arrays",
+			inputs: `[{"name":"grid","type":"uint16[2][3]"}]`,
+			json:   `[[[1,2],[3,4],[5,65535]]]`,
+			want:   []interface{}{[3][2]uint16{{1, 2}, {3, 4}, {5, 65535}}},
+		},
+		{
+			name:   "fixed bytes and bytes",
+			inputs: `[{"name":"id","type":"bytes32"},{"name":"sel","type":"bytes4"},{"name":"data","type":"bytes"}]`,
+			json:   `["0x` + strings.Repeat("ab", 32) + `","0xa9059cbb","0x"]`,
+			want:   []interface{}{[32]byte(common.FromHex(strings.Repeat("ab", 32))), [4]byte{0xa9, 0x05, 0x9c, 0xbb}, []byte{}},
+		},
+		{
+			name:   "bytes32 from a common.Hash",
+			inputs: `[{"name":"id","type":"bytes32"}]`,
+			args:   []interface{}{common.HexToHash("0x01")},
+		},
+		{
+			name:   "enum from JSON",
+			inputs: `[{"name":"s","type":"uint8","internalType":"enum Governance.Status"}]`,
+			json:   `[2]`,
+			want:   []interface{}{uint8(2)},
+		},
+		{
+			name:   "enum from a Go type",
+			inputs: `[{"name":"s","type":"uint8","internalType":"enum Governance.Status"}]`,
+			args:   []interface{}{status(3)},
+			want:   []interface{}{uint8(3)},
+		},
+		{
+			name:   "json.Number beyond 2^53",
+			inputs: `[{"name":"a","type":"uint64"},{"name":"b","type":"int64"}]`,
+			json:   `[9007199254740993, -9007199254740993]`,
+			want:   []interface{}{uint64(9007199254740993), int64(-9007199254740993)},
+		},
+		{
+			name:   "uint256 over 2^64 from -args",
+			inputs: `[{"name":"a","type":"uint256"}]`,
+			json:   `[18446744073709551617]`,
+			want:   []interface{}{new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), 64), big.NewInt(1))},
+		},
+		{
+			name:   "YAML uint64 above the int64 range",
+			inputs: `[{"name":"a","type":"uint64"},{"name":"b","type":"uint256"}]`,
+			yaml:   `[18446744073709551615, 18446744073709551615]`,
+			want:   []interface{}{uint64(1<<64 - 1), new(big.Int).SetUint64(1<<64 - 1)},
+		},
+		{
+			name:   "YAML ints in a tuple",
+			inputs: transferTuple,
+			yaml:   `[{to: "` + testAddrA + `", amount: 9007199254740993, data: "0x01"}]`,
+		},
+		{
+			name:   "signed integers at their limits",
+			inputs: `[{"name":"a","type":"int8"},{"name":"b","type":"int8"},{"name":"c","type":"int256"}]`,
+			json:   `[-128, 127, "-57896044618658097711785492504343953926634992332820282019728792003956564819968"]`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			inputs := testInputs(t, tc.inputs)
+			args := tc.args
+			switch {
+			case tc.json != "":
+				args = jsonArgs(t, tc.json)
+			case tc.yaml != "":
+				args = yamlArgs(t, tc.yaml)
+			}
+			converted, err := convertArgs("f", inputs, args)
+			if err != nil {
+				t.Fatalf("convertArgs: %v", err)
+			}
+			if tc.want != nil && !reflect.DeepEqual(converted, tc.want) {
+				t.Fatalf("convertArgs = %#v, want %#v", converted, tc.want)
+			}
+			packed, err := inputs.Pack(converted...)
+			if err != nil {
+				t.Fatalf("Pack: %v", err)
+			}
+			unpacked, err := inputs.Unpack(packed)
+			if err != nil {
+				t.Fatalf("Unpack: %v", err)
+			}
+			if !reflect.DeepEqual(unpacked, converted) {
+				t.Fatalf("Unpack = %#v, want %#v", unpacked, converted)
+			}
+			// What abi.Unpack returns, such as a registry's decoded
+			// arguments, converts back to the same encoding.
+			again, err := convertArgs("f", inputs, unpacked)
+			if err != nil {
+				t.Fatalf("convertArgs of the unpacked values: %v", err)
+			}
+			repacked, err := inputs.Pack(again...)
+			if err != nil {
+				t.Fatalf("Pack of the unpacked values: %v", err)
+			}
+			if !reflect.DeepEqual(repacked, packed) {
+				t.Fatalf("re-encoding differs:\n%x\n%x", repacked, packed)
+			}
+		})
+	}
+}
+
+func TestConvertArgsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		inputs string
+		json   string
+		want   string
+	}{
+		{
+			name:   "argument count",
+			inputs: `[{"name":"a","type":"uint256"}]`,
+			json:   `[1, 2]`,
+			want:   "f(uint256 a) takes 1 arguments, got 2",
+		},
+		{
+			name:   "tuple with too few components",
+			inputs: transferTuple,
+			json:   `[["` + testAddrA + `", 5]]`,
+			want:   "expected 3 components, got 2",
+		},
+		{
+			name:   "tuple with too many components",
+			inputs: transferTuple,
+			json:   `[["` + testAddrA + `", 5, "0x", 6]]`,
+			want:   "expected 3 components, got 4",
+		},
+		{
+			name:   "tuple missing a component",
+			inputs: transferTuple,
+			json:   `[{"to":"` + testAddrA + `","amount":1}]`,
+			want:   `missing component "data"`,
+		},
+		{
+			name:   "tuple with an unknown component",
+			inputs: transferTuple,
+			json:   `[{"to":"` + testAddrA + `","amount":1,"data":"0x","memo":"x"}]`,
+			want:   `no component "memo"`,
+		},
+		{
+			name:   "oversized fixed bytes",
+			inputs: `[{"name":"sel","type":"bytes4"}]`,
+			json:   `["0x0102030405"]`,
+			want:   "0x0102030405 is 5 bytes, want 4 for bytes4",
+		},
+		{
+			name:   "short fixed bytes",
+			inputs: `[{"name":"id","type":"bytes32"}]`,
+			json:   `["0x01"]`,
+			want:   "is 1 bytes, want 32 for bytes32",
+		},
+		{
+			name:   "int8 above its range",
+			inputs: `[{"name":"a","type":"int8"}]`,
+			json:   `[128]`,
+			want:   "128 overflows int8",
+		},
+		{
+			name:   "int8 below its range",
+			inputs: `[{"name":"a","type":"int8"}]`,
+			json:   `[-129]`,
+			want:   "-129 overflows int8",
+		},
+		{
+			name:   "enum above uint8",
+			inputs: `[{"name":"s","type":"uint8"}]`,
+			json:   `[256]`,
+			want:   "256 overflows uint8",
+		},
+		{
+			name:   "negative uint",
+			inputs: `[{"name":"a","type":"uint256"}]`,
+			json:   `["-1"]`,
+			want:   "uint256 cannot be negative",
+		},
+		{
+			name:   "fixed array length",
+			inputs: `[{"name":"grid","type":"uint16[2][3]"}]`,
+			json:   `[[[1,2],[3,4]]]`,
+			want:   "expected 3 elements, got 2",
+		},
+		{
+			name:   "nested element",
+			inputs: `[{"name":"m","type":"uint256[][]"}]`,
+			json:   `[[["1"],["x"]]]`,
+			want:   `element 1: element 0: "x" is not an integer`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := convertArgs("f", testInputs(t, tc.inputs), jsonArgs(t, tc.json))
+			if err == nil {
+				t.Fatalf("convertArgs succeeded, want an error containing %q", tc.want)
+			}
+			var encErr *encodingError
+			if !errors.As(err, &encErr) {
+				t.Errorf("error %v is not an encodingError", err)
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("error %q does not contain %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestConvertValueInt(t *testing.T) {
+	uint64Type, _ := abi.NewType("uint64", "", nil)
+	v, err := convertValue(uint64Type, "0xffffffffffffffff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := v.Interface(); got != uint64(1<<64-1) {
+		t.Fatalf("convertValue = %#v, want max uint64", got)
+	}
+	if _, err := convertValue(uint64Type, "0x10000000000000000"); err == nil {
+		t.Fatal("convertValue accepted 2^64 for uint64")
+	}
+	if _, err := convertValue(uint64Type, 1.5); err == nil {
+		t.Fatal("convertValue accepted 1.5 for uint64")
+	}
+}
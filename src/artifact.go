@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// artifact is a compiled contract as written by `forge build` to
+// out/<File>.sol/<Name>.json.
+type artifact struct {
+	Name             string
+	Source           string
+	ABI              abi.ABI
+	RawABI           json.RawMessage
+	Bytecode         []byte
+	DeployedBytecode []byte
+	// DeployedSourceMap is solc's source map for DeployedBytecode.
+	DeployedSourceMap string
+	// LinkReferences locate unlinked library addresses in Bytecode and
+	// DeployedBytecode; Libraries holds the addresses once linked.
+	LinkReferences         linkReferences
+	DeployedLinkReferences linkReferences
+	// ImmutableReferences locate immutables in DeployedBytecode, which the
+	// constructor fills in and the compiled code leaves zero.
+	ImmutableReferences immutableReferences
+	Libraries           map[string]common.Address
+	Metadata            *compilerMetadata
+	StorageLayout       json.RawMessage
+	// FactoryDependencies are the contracts a zksolc-built contract
+	// deploys itself, path:Name by code hash.
+	FactoryDependencies map[string]string
+	Path                string
+}
+
+// compilerMetadata is the subset of solc's metadata JSON needed to
+// reproduce a compilation.
+type compilerMetadata struct {
+	Compiler struct {
+		Version string `json:"version"`
+	} `json:"compiler"`
+	Language string                     `json:"language"`
+	Settings map[string]json.RawMessage `json:"settings"`
+	Sources  map[string]struct {
+		Keccak256 string `json:"keccak256"`
+		License   string `json:"license"`
+	} `json:"sources"`
+}
+
+// compilationTarget returns the fully qualified "path:Name" of the
+// compiled contract.
+func (m *compilerMetadata) compilationTarget() (string, error) {
+	var target map[string]string
+	if err := json.Unmarshal(m.Settings["compilationTarget"], &target); err != nil {
+		return "", fmt.Errorf("metadata has no compilation target: %w", err)
+	}
+	for path, name := range target {
+		return path + ":" + name, nil
+	}
+	return "", errors.New("metadata has no compilation target")
+}
+
+type forgeArtifact struct {
+	ABI      json.RawMessage `json:"abi"`
+	Bytecode struct {
+		Object         string         `json:"object"`
+		LinkReferences linkReferences `json:"linkReferences"`
+	} `json:"bytecode"`
+	DeployedBytecode struct {
+		Object              string              `json:"object"`
+		SourceMap           string              `json:"sourceMap"`
+		LinkReferences      linkReferences      `json:"linkReferences"`
+		ImmutableReferences immutableReferences `json:"immutableReferences"`
+	} `json:"deployedBytecode"`
+	RawMetadata         string            `json:"rawMetadata"`
+	StorageLayout       json.RawMessage   `json:"storageLayout"`
+	FactoryDependencies map[string]string `json:"factoryDependencies"`
+}
+
+// projectRoot walks up from the working directory to the directory holding
+// foundry.toml, so the tool works from both the repo root and src/.
+func projectRoot() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "foundry.toml")); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.New("foundry.toml not found in any parent directory")
+		}
+		dir = parent
+	}
+}
+
+// loadArtifact resolves a contract reference such as "Governance.sol",
+// "src/Governance.sol" or "Governance.sol:Governance" to its compiled
+// artifact under root/out. Without an explicit name the contract is
+// assumed to be named after its file. References to .json or .bin files
+// are prebuilt artifacts, read by loadPrebuilt.
+func loadArtifact(root, ref string) (*artifact, error) {
+	return loadArtifactIn(root, "out", ref)
+}
+
+// loadArtifactIn is loadArtifact for a build output directory other than
+// out/, such as foundry-zksync's zkout/.
+func loadArtifactIn(root, dir, ref string) (*artifact, error) {
+	if isPrebuiltRef(ref) {
+		return loadPrebuilt(root, ref)
+	}
+	file, name := splitContractRef(ref)
+	path := filepath.Join(root, dir, file, name+".json")
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		build := "forge build"
+		if dir == zksyncArtifactDir {
+			build += " --zksync"
+		}
+		return nil, fmt.Errorf("load artifact for %s (run `%s`?): %w", ref, build, err)
+	}
+	var fa forgeArtifact
+	if err := json.Unmarshal(raw, &fa); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	parsed, err := abi.JSON(strings.NewReader(string(fa.ABI)))
+	if err != nil {
+		return nil, fmt.Errorf("parse abi in %s: %w", path, err)
+	}
+	var meta *compilerMetadata
+	if fa.RawMetadata != "" {
+		meta = new(compilerMetadata)
+		if err := json.Unmarshal([]byte(fa.RawMetadata), meta); err != nil {
+			return nil, fmt.Errorf("parse metadata in %s: %w", path, err)
+		}
+	}
+	return &artifact{
+		Name:                   name,
+		Source:                 file,
+		ABI:                    parsed,
+		RawABI:                 fa.ABI,
+		Bytecode:               decodeCode(fa.Bytecode.Object),
+		DeployedBytecode:       decodeCode(fa.DeployedBytecode.Object),
+		DeployedSourceMap:      fa.DeployedBytecode.SourceMap,
+		LinkReferences:         fa.Bytecode.LinkReferences,
+		DeployedLinkReferences: fa.DeployedBytecode.LinkReferences,
+		ImmutableReferences:    fa.DeployedBytecode.ImmutableReferences,
+		Metadata:               meta,
+		StorageLayout:          fa.StorageLayout,
+		FactoryDependencies:    fa.FactoryDependencies,
+		Path:                   path,
+	}, nil
+}
+
+// constructorArgs ABI-encodes args for the constructor.
+func (a *artifact) constructorArgs(args []interface{}) ([]byte, error) {
+	packed, err := a.ABI.Pack("", args...)
+	if err != nil {
+		return nil, &encodingError{fmt.Errorf("encode %s constructor arguments: %w", a.Name, err)}
+	}
+	return packed, nil
+}
+
+// splitContractRef splits a contract reference into the source file name
+// and the contract name, which defaults to the file's base name.
+func splitContractRef(ref string) (file, name string) {
+	file, name, _ = strings.Cut(ref, ":")
+	file = filepath.Base(file)
+	if name == "" {
+		name = strings.TrimSuffix(file, filepath.Ext(file))
+	}
+	return file, name
+}
+
+// creationCode returns the init code followed by the ABI-encoded
+// constructor arguments.
+func (a *artifact) creationCode(args []interface{}) ([]byte, error) {
+	if len(a.Bytecode) == 0 {
+		return nil, fmt.Errorf("%s has no creation bytecode (abstract contract or interface?)", a.Name)
+	}
+	packed, err := a.constructorArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, a.Bytecode...), packed...), nil
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// assertion is a check of on-chain state made once a run has deployed and
+// configured everything:
+//
+//	assertions:
+//	  - Governance.requiredApprovals == 2
+//	  - Governance.multiSigApprovers.length >= 2
+//	  - Governance.proposals[0].approvals == 0
+//	  - Token.balanceOf("${Governance.address}") > 0
+//
+// The left side names a registry contract and either a view method, called
+// with JSON arguments in parentheses, or a storage variable read through
+// the contract's recorded storage layout. The right side is a number
+// (with an optional ether or gwei suffix), a bool, an address or a string.
+type assertion struct {
+	target   string
+	accessor string
+	op       string
+	want     string
+}
+
+var assertionOps = []string{"==", "!=", ">=", "<=", ">", "<"}
+
+// parseAssertion splits an assertion at its comparison operator.
+func parseAssertion(s string) (assertion, error) {
+	var a assertion
+	depth, quoted := 0, false
+	for i := 0; i < len(s) && a.op == ""; i++ {
+		switch c := s[i]; {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case depth == 0:
+			for _, op := range assertionOps {
+				if strings.HasPrefix(s[i:], op) {
+					a.op, a.want = op, strings.TrimSpace(s[i+len(op):])
+					a.target, a.accessor, _ = strings.Cut(strings.TrimSpace(s[:i]), ".")
+					break
+				}
+			}
+		}
+	}
+	switch {
+	case a.op == "":
+		return a, fmt.Errorf("%q has no comparison (want one of %s)", s, strings.Join(assertionOps, " "))
+	case a.target == "" || a.accessor == "":
+		return a, fmt.Errorf("%q: the left side must be Contract.method or Contract.variable", s)
+	case a.want == "":
+		return a, fmt.Errorf("%q: nothing to compare with", s)
+	}
+	return a, nil
+}
+
+// readAssertion evaluates the assertion's left side.
+func (r *networkRun) readAssertion(ctx context.Context, a assertion) (interface{}, error) {
+	c, err := bindContract(ctx, r.client, r.registry, r.root, a.target, "")
+	if err != nil {
+		return nil, err
+	}
+	if method, args, ok := strings.Cut(a.accessor, "("); ok && strings.HasSuffix(args, ")") {
+		resolved, err := substitute("["+strings.TrimSuffix(args, ")")+"]", r.resolveRef)
+		if err != nil {
+			return nil, err
+		}
+		params, err := parseJSONArgs(resolved.(string))
+		if err != nil {
+			return nil, err
+		}
+		return callForAssertion(ctx, c, method, params)
+	}
+	if m, ok := c.ABI.Methods[a.accessor]; ok && len(m.Inputs) == 0 {
+		return callForAssertion(ctx, c, a.accessor, nil)
+	}
+	e, err := r.registry.lookup(a.target)
+	if err != nil {
+		return nil, err
+	}
+	layout, err := parseStorageLayout(e.StorageLayout)
+	if err != nil {
+		return nil, fmt.Errorf("%s is neither a method nor, without a layout, a storage variable: %w", a.accessor, err)
+	}
+	value, _, _, err := readStorage(ctx, r.client, c.Address, layout, a.accessor, nil)
+	return value, err
+}
+
+func callForAssertion(ctx context.Context, c *boundContract, method string, params []interface{}) (interface{}, error) {
+	values, err := c.Call(ctx, method, params...)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != 1 {
+		return nil, fmt.Errorf("%s returns %d values; assertions compare one", method, len(values))
+	}
+	return values[0], nil
+}
+
+// holds compares got, a decoded ABI or storage value, with the assertion's
+// right side. Numbers take every operator; other values only == and !=.
+func (a assertion) holds(got interface{}, want string) (bool, error) {
+	if n, ok := numericValue(got); ok {
+		w, err := parseSignedAmount(want)
+		if err != nil {
+			return false, err
+		}
+		cmp := n.Cmp(w)
+		switch a.op {
+		case "==":
+			return cmp == 0, nil
+		case "!=":
+			return cmp != 0, nil
+		case ">=":
+			return cmp >= 0, nil
+		case "<=":
+			return cmp <= 0, nil
+		case ">":
+			return cmp > 0, nil
+		}
+		return cmp < 0, nil
+	}
+	if a.op != "==" && a.op != "!=" {
+		return false, fmt.Errorf("%s only compares numbers; use == or !=", a.op)
+	}
+	var equal bool
+	switch got := got.(type) {
+	case string:
+		equal = got == strings.Trim(want, `"`)
+	case common.Address:
+		if want == zeroAddressLiteral {
+			want = common.Address{}.Hex()
+		}
+		want, _ = explicitAddress(want)
+		equal = strings.EqualFold(got.Hex(), want)
+	default:
+		equal = strings.EqualFold(formatValue(got), strings.Trim(want, `"`))
+	}
+	return equal == (a.op == "=="), nil
+}
+
+// numericValue returns got as a big integer if it is one.
+func numericValue(got interface{}) (*big.Int, bool) {
+	if n, ok := got.(*big.Int); ok {
+		return n, true
+	}
+	rv := reflect.ValueOf(got)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return big.NewInt(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return new(big.Int).SetUint64(rv.Uint()), true
+	}
+	return nil, false
+}
+
+// parseSignedAmount is parseWei for a right side that may be negative.
+func parseSignedAmount(s string) (*big.Int, error) {
+	neg := strings.HasPrefix(s, "-")
+	n, err := parseWei(strings.TrimPrefix(s, "-"))
+	if err != nil {
+		return nil, err
+	}
+	if neg {
+		n.Neg(n)
+	}
+	return n, nil
+}
+
+// checkAssertions evaluates the manifest's assertions against the chain and
+// fails the run if any does not hold. A dry run deploys nothing to check.
+func (r *networkRun) checkAssertions(ctx context.Context, exprs []string) error {
+	if len(exprs) == 0 {
+		return nil
+	}
+	if r.opts.DryRun {
+		logger.Info("DRY RUN: skipping assertions, which need the deployed contracts", "network", r.name, "assertions", len(exprs))
+		return nil
+	}
+	var failed []string
+	for _, expr := range exprs {
+		if err := r.checkAssertion(ctx, expr); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", expr, err))
+			continue
+		}
+		logger.Info("Assertion holds", "network", r.name, "assertion", expr)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d assertions failed:\n  %s", len(failed), len(exprs), strings.Join(failed, "\n  "))
+	}
+	return nil
+}
+
+// checkAssertion evaluates one assertion, failing with the value read when
+// it does not hold.
+func (r *networkRun) checkAssertion(ctx context.Context, expr string) error {
+	a, err := parseAssertion(expr)
+	if err != nil {
+		return err
+	}
+	got, err := r.readAssertion(ctx, a)
+	if err != nil {
+		return err
+	}
+	want, err := substitute(a.want, r.resolveRef)
+	if err != nil {
+		return err
+	}
+	ok, err := a.holds(got, want.(string))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("got %s", formatValue(got))
+	}
+	return nil
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Ways of signing attestations, as -attest and the manifest's attest take.
+const (
+	attestSigner   = "signer"
+	attestSigstore = "sigstore"
+)
+
+// attestationType identifies the statement format.
+const attestationType = "deploy-attestation/v1"
+
+// attestationStatement is what an attestation vouches for: a deployment,
+// who made it and what it was built from.
+type attestationStatement struct {
+	Type     string         `json:"type"`
+	Network  string         `json:"network"`
+	ChainID  uint64         `json:"chainId"`
+	Name     string         `json:"name"`
+	Contract string         `json:"contract"`
+	Source   string         `json:"source,omitempty"`
+	Address  common.Address `json:"address"`
+	// Implementation is set when Address is a proxy.
+	Implementation *common.Address `json:"implementation,omitempty"`
+	TxHash         common.Hash     `json:"txHash"`
+	BlockNumber    uint64          `json:"blockNumber"`
+	Deployer       common.Address  `json:"deployer"`
+	// CodeHash is the keccak256 of the runtime code at Address when the
+	// attestation was made, and CreationCodeHash that of the linked
+	// creation code, without constructor arguments.
+	CodeHash         common.Hash  `json:"codeHash"`
+	CreationCodeHash *common.Hash `json:"creationCodeHash,omitempty"`
+	Compiler         string       `json:"compiler,omitempty"`
+	// Sources are the keccak256 hashes of the compiled sources, by path,
+	// from the compiler metadata.
+	Sources map[string]string `json:"sources,omitempty"`
+	// Commit, Manifest, User and Host are the run's provenance, as in the
+	// audit log.
+	Commit   string    `json:"commit,omitempty"`
+	Manifest string    `json:"manifest,omitempty"`
+	User     string    `json:"user,omitempty"`
+	Host     string    `json:"host,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// attestation is a signed statement, stored as
+// deployments/attestations/<network>/<name>.json. The signature covers the
+// statement's compact JSON encoding.
+type attestation struct {
+	Statement json.RawMessage      `json:"statement"`
+	Signature attestationSignature `json:"signature"`
+}
+
+type attestationSignature struct {
+	// Type is signer, an EIP-191 personal_sign signature by the deploying
+	// key, or sigstore, a Sigstore bundle made with cosign.
+	Type      string          `json:"type"`
+	Signer    *common.Address `json:"signer,omitempty"`
+	Signature hexutil.Bytes   `json:"signature,omitempty"`
+	Bundle    json.RawMessage `json:"bundle,omitempty"`
+}
+
+func attestationPath(records, network, name string) string {
+	return filepath.Join(records, "deployments", "attestations", network, name+".json")
+}
+
+func checkAttestMode(mode string) error {
+	switch mode {
+	case "", attestSigner, attestSigstore:
+		return nil
+	}
+	return fmt.Errorf("unknown attest %q (want %s or %s)", mode, attestSigner, attestSigstore)
+}
+
+// attest signs a statement about the deployment e, recorded as name, and
+// returns the attestation's path relative to records. The deployment is
+// already made, so failing to attest it is only a warning.
+func (r *networkRun) attest(ctx context.Context, name string, e *registryEntry) string {
+	path, err := r.writeAttestation(ctx, name, e)
+	if err != nil {
+		logger.Warn("Could not attest the deployment", "name", name, "err", err)
+		return ""
+	}
+	logger.Info("Attested deployment", "name", name, "path", path, "signature", r.opts.Attest)
+	rel, _ := filepath.Rel(r.records, path)
+	return filepath.ToSlash(rel)
+}
+
+func (r *networkRun) writeAttestation(ctx context.Context, name string, e *registryEntry) (string, error) {
+	code, err := r.client.CodeAt(ctx, e.Address, nil)
+	if err != nil {
+		return "", fmt.Errorf("read code: %w", err)
+	}
+	st := attestationStatement{
+		Type:             attestationType,
+		Network:          r.name,
+		ChainID:          r.chainID.Uint64(),
+		Name:             name,
+		Contract:         e.Contract,
+		Source:           e.Source,
+		Address:          e.Address,
+		TxHash:           e.TxHash,
+		BlockNumber:      e.BlockNumber,
+		Deployer:         e.Deployer,
+		CodeHash:         crypto.Keccak256Hash(code),
+		CreationCodeHash: e.CreationCodeHash,
+		Commit:           r.provenance.commit,
+		Manifest:         r.provenance.manifest,
+		User:             r.provenance.user,
+		Host:             r.provenance.host,
+		Time:             time.Now().UTC(),
+	}
+	if e.Proxy != nil {
+		st.Implementation = &e.Proxy.Implementation
+	}
+	if e.Metadata != nil {
+		st.Compiler = e.Metadata.Compiler.Version
+		st.Sources = map[string]string{}
+		for path, src := range e.Metadata.Sources {
+			st.Sources[path] = src.Keccak256
+		}
+	}
+	payload, err := json.Marshal(st)
+	if err != nil {
+		return "", err
+	}
+
+	att := attestation{Statement: payload, Signature: attestationSignature{Type: r.opts.Attest}}
+	switch r.opts.Attest {
+	case attestSigner:
+		// The deploying key signs, which with a signer pool is the
+		// account that deployed this contract.
+		s := r.signerOf(e.Deployer)
+		ms, ok := s.(messageSigner)
+		if !ok {
+			return "", fmt.Errorf("the %T signer cannot sign messages; use attest: %s", s, attestSigstore)
+		}
+		sig, err := ms.SignText(ctx, payload)
+		if err != nil {
+			return "", fmt.Errorf("sign: %w", err)
+		}
+		addr := s.Address()
+		att.Signature.Signer, att.Signature.Signature = &addr, sig
+	case attestSigstore:
+		if att.Signature.Bundle, err = sigstoreSign(ctx, payload); err != nil {
+			return "", err
+		}
+	}
+	raw, err := json.MarshalIndent(att, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := attestationPath(r.records, r.name, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, append(raw, '\n'), 0o644)
+}
+
+// sigstoreSign signs payload with cosign, keyless unless COSIGN_KEY and
+// the like configure it, and returns the Sigstore bundle.
+func sigstoreSign(ctx context.Context, payload []byte) (json.RawMessage, error) {
+	dir, err := os.MkdirTemp("", "attest-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	blob, bundle := filepath.Join(dir, "statement.json"), filepath.Join(dir, "bundle.json")
+	if err := os.WriteFile(blob, payload, 0o644); err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, "cosign", "sign-blob", "--yes", "--bundle", bundle, blob)
+	// cosign prints the OIDC login URL for keyless signing there.
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("cosign sign-blob: %w", err)
+	}
+	raw, err := os.ReadFile(bundle)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(bytes.TrimSpace(raw)), nil
+}
+
+// sigstoreVerify checks bundle over payload with cosign, requiring the
+// signing certificate to name identity, issued by the OIDC issuer.
+func sigstoreVerify(ctx context.Context, payload, bundle []byte, identity, issuer string) error {
+	dir, err := os.MkdirTemp("", "attest-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	blob, bundlePath := filepath.Join(dir, "statement.json"), filepath.Join(dir, "bundle.json")
+	if err := os.WriteFile(blob, payload, 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(bundlePath, bundle, 0o644); err != nil {
+		return err
+	}
+	out, err := exec.CommandContext(ctx, "cosign", "verify-blob", "--bundle", bundlePath, "--certificate-identity", identity, "--certificate-oidc-issuer", issuer, blob).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("cosign verify-blob: %w: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// runVerifyAttestation checks a deployment's attestation: the signature,
+// that the registry agrees with the statement and, with -onchain, that
+// the chain does.
+func runVerifyAttestation(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("verify-attestation", &rpcURL)
+	file := fs.String("file", "", "attestation file (default: the registry entry's)")
+	expect := fs.String("signer", "", "address the attestation must be signed by (default: the deployer in the statement)")
+	identity := fs.String("identity", "", "for Sigstore attestations, the identity the certificate must name, e.g. an email")
+	issuer := fs.String("issuer", "", "for Sigstore attestations, the OIDC issuer, e.g. https://accounts.google.com")
+	onchain := fs.Bool("onchain", false, "also check the transaction and the code at the address on -rpc")
+	network := addRegistryFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (*file == "") == (fs.NArg() == 0) {
+		return errors.New("give a deployment name or -file")
+	}
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	reg, err := loadRegistry(root, *network)
+	if err != nil {
+		return err
+	}
+	path := *file
+	if path == "" {
+		name := fs.Arg(0)
+		path = attestationPath(root, *network, name)
+		if e, err := reg.lookup(name); err == nil && e.Attestation != "" {
+			path = filepath.Join(root, filepath.FromSlash(e.Attestation))
+		}
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var att attestation
+	if err := json.Unmarshal(raw, &att); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	var payload bytes.Buffer
+	if err := json.Compact(&payload, att.Statement); err != nil {
+		return fmt.Errorf("%s: statement: %w", path, err)
+	}
+	var st attestationStatement
+	if err := json.Unmarshal(payload.Bytes(), &st); err != nil {
+		return fmt.Errorf("%s: statement: %w", path, err)
+	}
+	if st.Type != attestationType {
+		return fmt.Errorf("%s: unknown statement type %q", path, st.Type)
+	}
+	printStatement(&st)
+
+	switch att.Signature.Type {
+	case attestSigner:
+		signer, err := recoverSigner(common.BytesToHash(accounts.TextHash(payload.Bytes())), att.Signature.Signature)
+		if err != nil {
+			return fmt.Errorf("recover signer: %w", err)
+		}
+		if claimed := att.Signature.Signer; claimed != nil && *claimed != signer {
+			return fmt.Errorf("the signature is not %s's over this statement; the attestation was altered after signing", claimed.Hex())
+		}
+		want := st.Deployer
+		if *expect != "" {
+			if want, err = resolveAddress(*expect, *network); err != nil {
+				return err
+			}
+		}
+		if signer != want {
+			return fmt.Errorf("attestation is signed by %s, not %s; pass -signer if that key is trusted", signer.Hex(), want.Hex())
+		}
+		fmt.Printf("Signed by:   %s\n", signer.Hex())
+	case attestSigstore:
+		if *identity == "" || *issuer == "" {
+			return errors.New("a Sigstore attestation needs -identity and -issuer to say whose signature to trust")
+		}
+		if err := sigstoreVerify(ctx, payload.Bytes(), att.Signature.Bundle, *identity, *issuer); err != nil {
+			return err
+		}
+		fmt.Printf("Signed by:   %s (%s, Sigstore)\n", *identity, *issuer)
+	default:
+		return fmt.Errorf("%s: unknown signature type %q", path, att.Signature.Type)
+	}
+
+	// The registry of the statement's network, if the project has it,
+	// must describe the same deployment.
+	if st.Network != reg.Network {
+		if reg, err = loadRegistry(root, st.Network); err != nil {
+			return err
+		}
+	}
+	if e, ok := reg.Contracts[st.Name]; ok {
+		var diffs []string
+		if e.Address != st.Address {
+			diffs = append(diffs, fmt.Sprintf("address %s", e.Address.Hex()))
+		}
+		if e.TxHash != st.TxHash {
+			diffs = append(diffs, fmt.Sprintf("tx %s", e.TxHash.Hex()))
+		}
+		if e.CreationCodeHash != nil && st.CreationCodeHash != nil && *e.CreationCodeHash != *st.CreationCodeHash {
+			diffs = append(diffs, fmt.Sprintf("creation code hash %s", e.CreationCodeHash.Hex()))
+		}
+		if len(diffs) > 0 {
+			return fmt.Errorf("the %s registry records %s with %s, which the attestation does not vouch for", st.Network, st.Name, strings.Join(diffs, ", "))
+		}
+	}
+
+	if *onchain {
+		client, err := dial(ctx, rpcURL)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		chainID, err := client.ChainID(ctx)
+		if err != nil {
+			return err
+		}
+		if chainID.Uint64() != st.ChainID {
+			return fmt.Errorf("the node is on chain %d, the attestation is for chain %d", chainID, st.ChainID)
+		}
+		receipt, err := client.TransactionReceipt(ctx, st.TxHash)
+		if err != nil {
+			return fmt.Errorf("transaction %s: %w", st.TxHash.Hex(), err)
+		}
+		if st.BlockNumber != 0 && receipt.BlockNumber.Uint64() != st.BlockNumber {
+			return fmt.Errorf("transaction %s is in block %d, the attestation says %d", st.TxHash.Hex(), receipt.BlockNumber, st.BlockNumber)
+		}
+		code, err := client.CodeAt(ctx, st.Address, nil)
+		if err != nil {
+			return err
+		}
+		if hash := crypto.Keccak256Hash(code); hash != st.CodeHash {
+			return fmt.Errorf("the code at %s hashes to %s, not the attested %s", st.Address.Hex(), hash.Hex(), st.CodeHash.Hex())
+		}
+		fmt.Println("On chain:    transaction and code match")
+	}
+	fmt.Println("Attestation verified")
+	return nil
+}
+
+func printStatement(st *attestationStatement) {
+	fmt.Printf("Deployment:  %s (%s) on %s, chain %d\n", st.Name, st.Contract, st.Network, st.ChainID)
+	fmt.Printf("Address:     %s\n", st.Address.Hex())
+	if st.Implementation != nil {
+		fmt.Printf("Implementation: %s\n", st.Implementation.Hex())
+	}
+	fmt.Printf("Transaction: %s (block %d)\n", st.TxHash.Hex(), st.BlockNumber)
+	fmt.Printf("Deployer:    %s\n", st.Deployer.Hex())
+	if st.Commit != "" {
+		fmt.Printf("Commit:      %s\n", st.Commit)
+	}
+	if st.Compiler != "" {
+		fmt.Printf("Compiler:    solc %s, %d source(s)\n", st.Compiler, len(st.Sources))
+	}
+	if st.User != "" {
+		fmt.Printf("Deployed by: %s@%s at %s\n", st.User, st.Host, st.Time.Format(time.RFC3339))
+	}
+}
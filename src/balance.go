@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// faucetConfig funds the signer on a test network when -fund is given
+// and its balance does not cover the run:
+//
+//	networks:
+//	  sepolia:
+//	    faucet:
+//	      url: https://faucet.example.org/api/claim   # POSTed {"address": "0x..."}
+//
+// Local anvil and hardhat nodes need no faucet; their balances are set
+// directly.
+type faucetConfig struct {
+	URL string `yaml:"url"`
+}
+
+const (
+	// Creation transactions cost 32000 gas plus calldata, and 200 gas per
+	// byte of code deposited. Used when estimateGas cannot run because a
+	// constructor needs addresses that are not deployed yet.
+	createGas      = 53000
+	codeDepositGas = 200
+	calldataGas    = 16
+
+	faucetTimeout = 2 * time.Minute
+)
+
+// mainnetChainIDs are never funded automatically.
+var mainnetChainIDs = map[uint64]bool{1: true, 10: true, 137: true, 8453: true, 42161: true}
+
+// checkBalance estimates what the run will cost and fails with the
+// shortfall if the sender cannot pay for it, funding it first with -fund.
+// Steps already done by an interrupted run, and contracts deploy -changed
+// keeps, are not counted.
+func (r *networkRun) checkBalance(ctx context.Context, plan []plannedDeploy, state *runState) error {
+	// Safe transactions are paid for by the owner that executes them, and
+	// sponsored user operations by the paymaster.
+	if r.safe != nil || (r.userOp != nil && r.userOp.sponsored()) {
+		return nil
+	}
+	need := new(big.Int)
+	var costs []*big.Int
+	for _, p := range plan {
+		if r.opts.Resume && state.Steps[p.spec.Name] != nil {
+			continue
+		}
+		if c, ok := r.changes[p.spec.Name]; ok && !c.redeploys() {
+			continue
+		}
+		cost, err := r.estimateCost(ctx, p)
+		if err != nil {
+			return fmt.Errorf("%s: estimate cost: %w", p.spec.Name, err)
+		}
+		need.Add(need, cost)
+		costs = append(costs, cost)
+	}
+	if r.pool != nil && len(costs) > 0 {
+		// Each account pays for its own deployments.
+		share := poolShare(costs, len(r.pool.accounts)+1)
+		var errs []error
+		for _, addr := range r.poolAddresses(r.pool) {
+			errs = append(errs, r.checkFunds(ctx, addr, share))
+		}
+		return errors.Join(errs...)
+	}
+	return r.checkFunds(ctx, r.from(), need)
+}
+
+// checkFunds fails with the shortfall if from holds less than need,
+// funding it first with -fund.
+func (r *networkRun) checkFunds(ctx context.Context, from common.Address, need *big.Int) error {
+	have, err := r.client.BalanceAt(ctx, from, nil)
+	if err != nil {
+		return err
+	}
+	if have.Cmp(need) >= 0 {
+		return nil
+	}
+	if r.opts.Fund && !r.opts.DryRun {
+		if err := r.fund(ctx, from, need, have); err != nil {
+			return fmt.Errorf("fund %s: %w", from.Hex(), err)
+		}
+		return nil
+	}
+	return fmt.Errorf("insufficient funds on %s: need %s, have %s for %s; top it up (or pass -fund on a test network)",
+		r.name, formatEther(need), formatEther(have), from.Hex())
+}
+
+// estimateCost is the most p's deployment can cost at current fees: its
+// gas limit at the maximum price, plus the value sent. Proxied contracts
+// add their proxy.
+func (r *networkRun) estimateCost(ctx context.Context, p plannedDeploy) (*big.Int, error) {
+	g := p.spec.Gas.merge(r.gas)
+	f, err := r.quoteFees(ctx, g)
+	if err != nil {
+		return nil, err
+	}
+	value, _ := parseWei(p.spec.Value)
+	gas, byNode := g.Limit, false
+	if gas == 0 {
+		msg := ethereum.CallMsg{From: r.from(), Value: value, Data: p.initCode}
+		if estimated, err := r.client.EstimateGas(ctx, msg); err == nil {
+			gas, byNode = withBuffer(estimated, g.buffer()), true
+		} else {
+			gas = withBuffer(creationGas(p.initCode, p.artifact.DeployedBytecode), g.buffer())
+		}
+	}
+	if p.spec.Proxy != nil {
+		proxy, err := r.loadArtifact(p.spec.Proxy.contract())
+		if err != nil {
+			return nil, err
+		}
+		gas += withBuffer(creationGas(proxy.Bytecode, proxy.DeployedBytecode), g.buffer())
+	}
+	f.L1Fee = r.quoteL1Fee(ctx, txFields{Value: value, Data: p.initCode}, gas, f, byNode)
+	cost := f.maxCost(gas)
+	if value != nil {
+		cost.Add(cost, value)
+	}
+	return cost, nil
+}
+
+// creationGas approximates the gas of deploying initCode that leaves
+// runtime behind, ignoring what the constructor itself executes.
+func creationGas(initCode, runtime []byte) uint64 {
+	return createGas + calldataGas*uint64(len(initCode)) + codeDepositGas*uint64(len(runtime))
+}
+
+// fund tops up addr to need: through the dev node's setBalance method on
+// local chains, else through the network's faucet.
+func (r *networkRun) fund(ctx context.Context, addr common.Address, need, have *big.Int) error {
+	id := r.chainID.Uint64()
+	if mainnetChainIDs[id] {
+		return fmt.Errorf("refusing to auto-fund on chain %d; need %s, have %s", id, formatEther(need), formatEther(have))
+	}
+	for _, method := range []string{"anvil_setBalance", "hardhat_setBalance"} {
+		if err := r.client.Client().CallContext(ctx, nil, method, addr, hexutil.EncodeBig(need)); err == nil {
+			logger.Info("Funded signer", "address", addr, "balance", formatEther(need), "via", method)
+			return nil
+		}
+	}
+	if r.faucet == nil {
+		return fmt.Errorf("need %s, have %s, and the network has no faucet configured", formatEther(need), formatEther(have))
+	}
+
+	body, _ := json.Marshal(map[string]string{"address": addr.Hex()})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, os.ExpandEnv(r.faucet.URL), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return fmt.Errorf("faucet: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("faucet: %s", resp.Status)
+	}
+	logger.Info("Requested funds from faucet, waiting for them to arrive", "address", addr, "need", formatEther(need))
+
+	ctx, cancel := context.WithTimeout(ctx, faucetTimeout)
+	defer cancel()
+	balance := have
+	for {
+		if b, err := r.client.BalanceAt(ctx, addr, nil); err == nil {
+			if balance = b; balance.Cmp(need) >= 0 {
+				return nil
+			}
+		}
+		if err := sleepCtx(ctx, receiptPollInterval); err != nil {
+			return fmt.Errorf("faucet funds did not arrive within %s: need %s, have %s", faucetTimeout, formatEther(need), formatEther(balance))
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+//go:generate go run . bindgen -contract Governance.sol
+
+func runBindgen(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("bindgen", flag.ContinueOnError)
+	contractRef := fs.String("contract", "", "artifact to generate a binding for, as File.sol or File.sol:Name (required)")
+	typeName := fs.String("type", "", "name of the generated binding type (default: the contract name, unexported)")
+	out := fs.String("out", "", "file to write, or - for stdout (default: <contract>_binding.go)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *contractRef == "" {
+		return errors.New("-contract is required")
+	}
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	art, err := loadArtifact(root, *contractRef)
+	if err != nil {
+		return err
+	}
+	if *typeName == "" {
+		*typeName = unexport(art.Name)
+	}
+	if *out == "" {
+		*out = strings.ToLower(art.Name) + "_binding.go"
+	}
+	rel, err := filepath.Rel(root, art.Path)
+	if err != nil {
+		rel = art.Path
+	}
+	src, err := generateBinding(art.ABI, art.Name, *typeName, *contractRef, filepath.ToSlash(rel))
+	if err != nil {
+		return err
+	}
+	if *out == "-" {
+		_, err := os.Stdout.Write(src)
+		return err
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		return err
+	}
+	logger.Info("Generated binding", "contract", art.Name, "type", *typeName, "file", *out)
+	return nil
+}
+
+// generateBinding returns Go source for a typed wrapper around a
+// boundContract: a method per contract function, with Go parameter and
+// result types, and a Parse method per event. Calls go through the same
+// client and networkRun as the rest of the tool.
+func generateBinding(contract abi.ABI, name, typeName, ref, artifactPath string) ([]byte, error) {
+	g := &binder{typeName: typeName, contract: name, structs: map[string]string{}}
+	var body bytes.Buffer
+	b := &body
+	fmt.Fprintf(b, "// %s is a typed binding of the %s contract.\n", typeName, name)
+	fmt.Fprintf(b, "type %s struct {\n\t*boundContract\n}\n\n", typeName)
+	fmt.Fprintf(b, "// new%s wraps c, e.g. from bindContract, in the typed binding.\n", exportName(typeName))
+	fmt.Fprintf(b, "func new%s(c *boundContract) *%s {\n\treturn &%s{c}\n}\n", exportName(typeName), typeName, typeName)
+
+	taken := map[string]bool{}
+	for _, m := range []string{"Call", "CallAt", "Send", "SendValue", "WatchEvent", "WatchEventFrom"} {
+		taken[m] = true
+	}
+	for _, key := range sortedKeys(contract.Methods) {
+		m := contract.Methods[key]
+		goName := uniqueName(abi.ToCamelCase(key), taken)
+		if m.IsConstant() {
+			g.writeCallMethod(b, goName, m)
+		} else {
+			g.writeSendMethod(b, goName, m)
+		}
+	}
+	for _, key := range sortedKeys(contract.Events) {
+		g.writeEventParser(b, uniqueName("Parse"+abi.ToCamelCase(key), taken), contract.Events[key])
+	}
+	for _, key := range sortedKeys(g.structs) {
+		b.WriteString(g.structs[key])
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by `go run . bindgen -contract %s`; DO NOT EDIT.\n", ref)
+	fmt.Fprintf(&src, "// Source: %s\n\npackage main\n\nimport (\n", artifactPath)
+	generated := body.String()
+	for _, imp := range []struct{ path, use string }{
+		{"context", "context."},
+		{"math/big", "big."},
+		{"", ""},
+		{"github.com/ethereum/go-ethereum/accounts/abi", "abi."},
+		{"github.com/ethereum/go-ethereum/common", "common."},
+		{"github.com/ethereum/go-ethereum/core/types", "types."},
+	} {
+		switch {
+		case imp.path == "":
+			src.WriteString("\n")
+		case strings.Contains(generated, imp.use):
+			fmt.Fprintf(&src, "\t%q\n", imp.path)
+		}
+	}
+	src.WriteString(")\n\n")
+	src.WriteString(generated)
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated code does not parse: %w", err)
+	}
+	return formatted, nil
+}
+
+// binder holds the state of one generated binding: its type name and the
+// struct types declared for the ABI's tuples.
+type binder struct {
+	typeName string
+	contract string
+	// structs maps struct type names to their declarations.
+	structs map[string]string
+}
+
+func (g *binder) writeCallMethod(b *bytes.Buffer, goName string, m abi.Method) {
+	params, names := g.goParams(m.Inputs)
+	doc := fmt.Sprintf("\n// %s calls %s.\n", goName, signature(m.RawName, m.Inputs))
+	call := fmt.Sprintf("c.callMethod(ctx, %q%s)", m.Name, joinArgs(names))
+	switch len(m.Outputs) {
+	case 0:
+		b.WriteString(doc)
+		fmt.Fprintf(b, "func (c *%s) %s(ctx context.Context%s) error {\n", g.typeName, goName, params)
+		fmt.Fprintf(b, "\t_, err := %s\n\treturn err\n}\n", call)
+	case 1:
+		t := g.goType(m.Outputs[0].Type)
+		b.WriteString(doc)
+		fmt.Fprintf(b, "func (c *%s) %s(ctx context.Context%s) (result %s, err error) {\n", g.typeName, goName, params, t)
+		fmt.Fprintf(b, "\tout, err := %s\n\tif err != nil {\n\t\treturn result, err\n\t}\n", call)
+		fmt.Fprintf(b, "\treturn *abi.ConvertType(out[0], new(%s)).(*%s), nil\n}\n", t, t)
+	default:
+		result := g.typeName + goName + "Result"
+		fields := fieldNames(m.Outputs, "Out")
+		fmt.Fprintf(b, "\n// %s holds the results of %s.\ntype %s struct {\n", result, m.RawName, result)
+		for i, out := range m.Outputs {
+			fmt.Fprintf(b, "\t%s %s\n", fields[i], g.goType(out.Type))
+		}
+		fmt.Fprintf(b, "}\n")
+		b.WriteString(doc)
+		fmt.Fprintf(b, "func (c *%s) %s(ctx context.Context%s) (*%s, error) {\n", g.typeName, goName, params, result)
+		fmt.Fprintf(b, "\tout, err := %s\n\tif err != nil {\n\t\treturn nil, err\n\t}\n", call)
+		fmt.Fprintf(b, "\tresult := new(%s)\n", result)
+		for i, out := range m.Outputs {
+			t := g.goType(out.Type)
+			fmt.Fprintf(b, "\tresult.%s = *abi.ConvertType(out[%d], new(%s)).(*%s)\n", fields[i], i, t, t)
+		}
+		fmt.Fprintf(b, "\treturn result, nil\n}\n")
+	}
+}
+
+func (g *binder) writeSendMethod(b *bytes.Buffer, goName string, m abi.Method) {
+	params, names := g.goParams(m.Inputs)
+	value := "nil"
+	fmt.Fprintf(b, "\n// %s sends %s in a transaction from r's signer.\n", goName, signature(m.RawName, m.Inputs))
+	if m.IsPayable() {
+		params = ", value *big.Int" + params
+		value = "value"
+	}
+	fmt.Fprintf(b, "func (c *%s) %s(ctx context.Context, r *networkRun%s) (*sentTx, error) {\n", g.typeName, goName, params)
+	fmt.Fprintf(b, "\treturn c.sendMethod(ctx, r, %s, %q%s)\n}\n", value, m.Name, joinArgs(names))
+}
+
+func (g *binder) writeEventParser(b *bytes.Buffer, goName string, ev abi.Event) {
+	event := g.typeName + abi.ToCamelCase(ev.Name)
+	fields := fieldNames(ev.Inputs, "Arg")
+	fmt.Fprintf(b, "\n// %s is a decoded %s event. Indexed strings, bytes, arrays\n// and tuples are only available as their keccak256 hash.\ntype %s struct {\n", event, ev.Name, event)
+	goTypes := make([]string, len(ev.Inputs))
+	for i, in := range ev.Inputs {
+		goTypes[i] = g.goType(in.Type)
+		if in.Indexed && isHashedTopic(in.Type) {
+			goTypes[i] = "common.Hash"
+		}
+		fmt.Fprintf(b, "\t%s %s\n", fields[i], goTypes[i])
+	}
+	fmt.Fprintf(b, "\tRaw types.Log\n}\n\n")
+	fmt.Fprintf(b, "// %s decodes log as a %s event.\n", goName, ev.Name)
+	fmt.Fprintf(b, "func (c *%s) %s(log types.Log) (*%s, error) {\n", g.typeName, goName, event)
+	fmt.Fprintf(b, "\te, err := c.parseEvent(%q, log)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n", ev.Name)
+	fmt.Fprintf(b, "\tout := &%s{Raw: log}\n", event)
+	for i, in := range ev.Inputs {
+		fmt.Fprintf(b, "\tout.%s = *abi.ConvertType(e.Args[%q], new(%s)).(*%s)\n", fields[i], in.Name, goTypes[i], goTypes[i])
+	}
+	fmt.Fprintf(b, "\treturn out, nil\n}\n")
+}
+
+// goType is the Go type for values of t, matching what go-ethereum
+// decodes them into. Tuples get a named struct type in the binding.
+func (g *binder) goType(t abi.Type) string {
+	switch t.T {
+	case abi.AddressTy:
+		return "common.Address"
+	case abi.BytesTy:
+		return "[]byte"
+	case abi.FixedBytesTy:
+		return fmt.Sprintf("[%d]byte", t.Size)
+	case abi.FunctionTy:
+		return "[24]byte"
+	case abi.SliceTy:
+		return "[]" + g.goType(*t.Elem)
+	case abi.ArrayTy:
+		return fmt.Sprintf("[%d]%s", t.Size, g.goType(*t.Elem))
+	case abi.TupleTy:
+		return g.tupleType(t)
+	}
+	// Integers (native types up to 64 bits, *big.Int above), bool and
+	// string.
+	return t.GetType().String()
+}
+
+// tupleType declares a struct for the tuple t, named after its Solidity
+// struct where the ABI gives one.
+func (g *binder) tupleType(t abi.Type) string {
+	// solc names struct Governance.Proposal GovernanceProposal.
+	raw := t.TupleRawName
+	if trimmed := strings.TrimPrefix(raw, g.contract); trimmed != "" {
+		raw = trimmed
+	}
+	name := g.typeName + abi.ToCamelCase(raw)
+	if raw == "" {
+		name = fmt.Sprintf("%sTuple%d", g.typeName, len(g.structs))
+	}
+	if _, ok := g.structs[name]; ok {
+		return name
+	}
+	g.structs[name] = "" // reserve the name while the fields are typed
+	var decl strings.Builder
+	fmt.Fprintf(&decl, "\n// %s is the %s tuple.\ntype %s struct {\n", name, t.String(), name)
+	for i, elem := range t.TupleElems {
+		fmt.Fprintf(&decl, "\t%s %s\n", abi.ToCamelCase(t.TupleRawNames[i]), g.goType(*elem))
+	}
+	decl.WriteString("}\n")
+	g.structs[name] = decl.String()
+	return name
+}
+
+// isHashedTopic reports whether an indexed input of type t is stored as the
+// hash of its value.
+func isHashedTopic(t abi.Type) bool {
+	switch t.T {
+	case abi.StringTy, abi.BytesTy, abi.SliceTy, abi.ArrayTy, abi.TupleTy:
+		return true
+	}
+	return false
+}
+
+// goParams returns the Go parameter list for inputs, each preceded by a
+// comma, and the parameter names.
+func (g *binder) goParams(inputs abi.Arguments) (string, []string) {
+	taken := map[string]bool{"c": true, "ctx": true, "r": true, "value": true, "out": true, "err": true, "result": true}
+	var params strings.Builder
+	names := make([]string, len(inputs))
+	for i, in := range inputs {
+		name := unexport(abi.ToCamelCase(strings.Trim(in.Name, "_")))
+		if name == "" || token.IsKeyword(name) || taken[name] {
+			name = fmt.Sprintf("arg%d", i)
+		}
+		taken[name] = true
+		names[i] = name
+		fmt.Fprintf(&params, ", %s %s", name, g.goType(in.Type))
+	}
+	return params.String(), names
+}
+
+// fieldNames returns exported struct field names for args, falling back to
+// prefix and the position for unnamed or clashing ones.
+func fieldNames(args abi.Arguments, prefix string) []string {
+	taken := map[string]bool{"Raw": true}
+	names := make([]string, len(args))
+	for i, a := range args {
+		name := abi.ToCamelCase(strings.Trim(a.Name, "_"))
+		if name == "" || taken[name] {
+			name = fmt.Sprintf("%s%d", prefix, i)
+		}
+		taken[name] = true
+		names[i] = name
+	}
+	return names
+}
+
+func joinArgs(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	return ", " + strings.Join(names, ", ")
+}
+
+// uniqueName returns name, suffixed if a method of that name already
+// exists on the binding.
+func uniqueName(name string, taken map[string]bool) string {
+	for taken[name] {
+		name += "_"
+	}
+	taken[name] = true
+	return name
+}
+
+// unexport lower-cases the leading capitals of name, keeping acronyms
+// together: Governance becomes governance, DAOToken daoToken and
+// ERC20Votes erc20Votes.
+func unexport(name string) string {
+	r := []rune(name)
+	n := 0
+	for n < len(r) && unicode.IsUpper(r[n]) {
+		n++
+	}
+	if n > 1 && n < len(r) && unicode.IsLower(r[n]) {
+		n--
+	}
+	for i := 0; i < n; i++ {
+		r[i] = unicode.ToLower(r[i])
+	}
+	return string(r)
+}
+
+func exportName(name string) string {
+	r := []rune(name)
+	if len(r) > 0 {
+		r[0] = unicode.ToUpper(r[0])
+	}
+	return string(r)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto/kzg4844"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Blob sidecar proofs, from a network's blobProofs: field. Since the
+// Fusaka upgrade (EIP-7594) nodes want a proof per cell of each blob;
+// chains that have not upgraded still take one proof per blob.
+const (
+	blobProofsCell = "cell"
+	blobProofsBlob = "blob"
+)
+
+// blobDataSize is how much data a blob carries. Each of its 4096 field
+// elements holds 31 bytes behind a zero byte, which keeps it below the
+// BLS12-381 modulus.
+const blobDataSize = 4096 * 31
+
+// encodeBlobs packs data into as few blobs as hold it.
+func encodeBlobs(data []byte) []kzg4844.Blob {
+	blobs := make([]kzg4844.Blob, max(1, (len(data)+blobDataSize-1)/blobDataSize))
+	for i := range blobs {
+		chunk := data[min(i*blobDataSize, len(data)):min((i+1)*blobDataSize, len(data))]
+		for j := 0; len(chunk) > 0; j++ {
+			n := copy(blobs[i][j*32+1:(j+1)*32], chunk)
+			chunk = chunk[n:]
+		}
+	}
+	return blobs
+}
+
+// newBlobSidecar commits to blobs and proves the commitments, with cell or
+// blob proofs.
+func newBlobSidecar(blobs []kzg4844.Blob, proofs string) (*types.BlobTxSidecar, error) {
+	if len(blobs) > params.BlobTxMaxBlobs {
+		return nil, fmt.Errorf("%d blobs, but a transaction carries at most %d (%d KiB of data)", len(blobs), params.BlobTxMaxBlobs, params.BlobTxMaxBlobs*blobDataSize/1024)
+	}
+	commitments := make([]kzg4844.Commitment, len(blobs))
+	for i := range blobs {
+		c, err := kzg4844.BlobToCommitment(&blobs[i])
+		if err != nil {
+			return nil, fmt.Errorf("blob %d: commitment: %w", i, err)
+		}
+		commitments[i] = c
+	}
+	if proofs == blobProofsBlob {
+		list := make([]kzg4844.Proof, len(blobs))
+		for i := range blobs {
+			p, err := kzg4844.ComputeBlobProof(&blobs[i], commitments[i])
+			if err != nil {
+				return nil, fmt.Errorf("blob %d: proof: %w", i, err)
+			}
+			list[i] = p
+		}
+		return types.NewBlobTxSidecar(types.BlobSidecarVersion0, blobs, commitments, list), nil
+	}
+	list := make([]kzg4844.Proof, 0, len(blobs)*kzg4844.CellProofsPerBlob)
+	for i := range blobs {
+		p, err := kzg4844.ComputeCellProofs(&blobs[i])
+		if err != nil {
+			return nil, fmt.Errorf("blob %d: cell proofs: %w", i, err)
+		}
+		list = append(list, p...)
+	}
+	return types.NewBlobTxSidecar(types.BlobSidecarVersion1, blobs, commitments, list), nil
+}
+
+// loadBlobs reads files, relative to the project root unless absolute, into
+// the sidecar of a blob transaction. Each file starts a new blob.
+func (r *networkRun) loadBlobs(files []string) (*types.BlobTxSidecar, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+	var blobs []kzg4844.Blob
+	for _, file := range files {
+		path := file
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(r.root, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("blob: %w", err)
+		}
+		blobs = append(blobs, encodeBlobs(data)...)
+	}
+	return newBlobSidecar(blobs, r.blobProofs)
+}
+
+// blobGas is the blob gas a transaction carrying sidecar uses.
+func blobGas(sidecar *types.BlobTxSidecar) uint64 {
+	if sidecar == nil {
+		return 0
+	}
+	return params.BlobTxBlobGasPerBlob * uint64(len(sidecar.Blobs))
+}
+
+// quoteBlobFee resolves the fee cap per blob gas: g's, or twice the node's
+// current blob base fee, which like the gas fee cap survives several full
+// blocks.
+func (r *networkRun) quoteBlobFee(ctx context.Context, g gasConfig) (*big.Int, error) {
+	if g.MaxFeePerBlobGas != "" {
+		fee, _ := parseWei(g.MaxFeePerBlobGas)
+		return fee, nil
+	}
+	fee, err := r.client.BlobBaseFee(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("eth_blobBaseFee: %w (set maxFeePerBlobGas if the node cannot quote it)", err)
+	}
+	return fee.Mul(fee, big.NewInt(2)), nil
+}
+
+// checkBlobTx rejects blobs on transactions that cannot carry them.
+func (r *networkRun) checkBlobTx(fields txFields, f fees) error {
+	switch {
+	case fields.To == nil:
+		return errors.New("a blob transaction cannot create a contract")
+	case !f.dynamic():
+		return errors.New("a blob transaction needs EIP-1559 fees, not a gas price")
+	case r.safe != nil:
+		return errors.New("a Safe cannot send blob transactions")
+	case r.userOp != nil:
+		return errors.New("a smart account cannot send blob transactions")
+	}
+	if _, ok := r.chain.(evmChain); !ok {
+		return errors.New("the network's chain does not take blob transactions")
+	}
+	return nil
+}
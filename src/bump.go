@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func runBump(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("bump", &rpcURL)
+	rf := addRunFlags(fs)
+	txHash := fs.String("tx", "", "hash of the pending transaction to replace")
+	percent := fs.Uint64("percent", 25, fmt.Sprintf("fee increase over the pending transaction, in percent (at least %d)", replacementBump))
+	cancel := fs.Bool("cancel", false, "replace the transaction with an empty transfer to yourself instead of resending it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *txHash == "" {
+		return errors.New("-tx is required")
+	}
+	if *percent < replacementBump {
+		return fmt.Errorf("-percent must be at least %d; nodes reject smaller replacements", replacementBump)
+	}
+	hash := common.HexToHash(*txHash)
+
+	m, selected, err := rf.load(ctx, fs, rpcURL, nil)
+	if err != nil {
+		return err
+	}
+	if len(selected) != 1 {
+		return errors.New("bump runs against a single network; pick one with -network")
+	}
+	run, err := openNetworkRun(ctx, m, selected[0], rf.options())
+	if err != nil {
+		return err
+	}
+	defer run.close()
+
+	tx, pending, err := run.client.TransactionByHash(ctx, hash)
+	if errors.Is(err, ethereum.NotFound) {
+		return fmt.Errorf("transaction %s is unknown to the node; it may have been dropped", hash.Hex())
+	}
+	if err != nil {
+		return err
+	}
+	if !pending {
+		return fmt.Errorf("transaction %s is already mined", hash.Hex())
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(run.chainID), tx)
+	if err != nil {
+		return err
+	}
+	if from != run.sender.Address() {
+		return fmt.Errorf("transaction %s was sent by %s, not the signer %s", hash.Hex(), from.Hex(), run.sender.Address().Hex())
+	}
+
+	return run.replace(ctx, stuckTxOf(hash, tx), *rf.gas, *percent, *cancel)
+}
+
+// stuckTx is a transaction to replace: the node's copy of it, or, for one
+// the node has dropped, what the audit log recorded of it.
+type stuckTx struct {
+	hash   common.Hash
+	nonce  uint64
+	fields txFields
+	gas    uint64
+	// old is what the transaction paid; zero when the node dropped it, so
+	// the replacement pays the current quote.
+	old fees
+}
+
+func stuckTxOf(hash common.Hash, tx *types.Transaction) stuckTx {
+	old := fees{GasPrice: tx.GasPrice()}
+	if tx.Type() == types.DynamicFeeTxType {
+		old = fees{TipCap: tx.GasTipCap(), FeeCap: tx.GasFeeCap()}
+	}
+	return stuckTx{hash: hash, nonce: tx.Nonce(), fields: txFields{To: tx.To(), Value: tx.Value(), Data: tx.Data()}, gas: tx.Gas(), old: old}
+}
+
+// replace sends st again at its nonce with fees at least percent higher,
+// or with cancel a 0 ETH transfer to the signer in its place, and waits
+// for the replacement to be mined.
+func (r *networkRun) replace(ctx context.Context, st stuckTx, g gasConfig, percent uint64, cancel bool) error {
+	quote, err := r.quoteFees(ctx, g)
+	if err != nil {
+		return err
+	}
+	f := bumpFees(st.old, quote, percent)
+
+	fields, gas := st.fields, st.gas
+	if cancel {
+		self := r.sender.Address()
+		fields, gas = txFields{To: &self}, 21000
+	}
+	if err := checkBudget(gas, f, g.MaxCost); err != nil {
+		return err
+	}
+	if r.opts.DryRun {
+		fmt.Printf("DRY RUN: would replace %s (nonce %d) paying up to %s wei/gas\n", st.hash.Hex(), st.nonce, f.maxPrice())
+		return nil
+	}
+
+	fields.Label = fmt.Sprintf("replace %s (nonce %d)", st.hash.Hex(), st.nonce)
+	if cancel {
+		fields.Label = fmt.Sprintf("cancel %s (nonce %d) with a 0 ETH transfer to self", st.hash.Hex(), st.nonce)
+	}
+	if err := r.confirmTx(ctx, fields, gas, f); err != nil {
+		return err
+	}
+	signed, err := r.sender.SignTx(ctx, newTx(r.chainID, st.nonce, f, gas, fields), r.chainID)
+	if err != nil {
+		return fmt.Errorf("sign: %w", err)
+	}
+	if err := r.client.SendTransaction(ctx, signed); err != nil {
+		metrics.add(metricErrors, 1, "network", r.name, "kind", "send")
+		return err
+	}
+	metrics.add(metricTxSent, 1, "network", r.name)
+	nonce := st.nonce
+	r.audit(fields, signed.Hash(), &nonce, gas)
+	fmt.Printf("replaced %s with %s (nonce %d)\n", st.hash.Hex(), signed.Hash().Hex(), st.nonce)
+
+	// A resent deployment lands at the same address, so only its
+	// transaction hash changes in the registry.
+	if !cancel {
+		for name, e := range r.registry.Contracts {
+			if e.TxHash == st.hash {
+				e.TxHash = signed.Hash()
+				if err := r.registry.save(); err != nil {
+					return fmt.Errorf("update %s in registry: %w", name, err)
+				}
+			}
+		}
+	}
+	if r.opts.Confirmations == 0 {
+		return nil
+	}
+	receipt, err := r.waitMined(ctx, signed.Hash())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("mined in block %d, gas used %d\n", receipt.BlockNumber.Uint64(), receipt.GasUsed)
+	return nil
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// bundleType identifies the registry archive format.
+const bundleType = "registry-bundle/v1"
+
+// The archive holds bundle.json, signature.json over it, and the exported
+// files at their paths relative to the project root.
+const (
+	bundleIndex     = "bundle.json"
+	bundleSignature = "signature.json"
+)
+
+// maxBundleFile bounds each file read from an archive.
+const maxBundleFile = 64 << 20
+
+// registryBundle describes an exported archive: where it came from, its
+// networks, and the SHA-256 of every file in it. The signature covers its
+// compact JSON encoding, which is bundle.json.
+type registryBundle struct {
+	Type     string          `json:"type"`
+	Created  time.Time       `json:"created"`
+	Commit   string          `json:"commit,omitempty"`
+	User     string          `json:"user,omitempty"`
+	Host     string          `json:"host,omitempty"`
+	Networks []bundleNetwork `json:"networks"`
+	// Files maps each file's slash-separated path to its hex SHA-256.
+	Files map[string]string `json:"files"`
+}
+
+// bundleNetwork is one exported registry and the files it refers to: its
+// contracts' artifacts, attestations and flattened sources.
+type bundleNetwork struct {
+	Name      string   `json:"name"`
+	ChainID   uint64   `json:"chainId"`
+	Contracts int      `json:"contracts"`
+	Files     []string `json:"files"`
+}
+
+func runRegistry(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: registry export|import [flags]")
+	}
+	switch args[0] {
+	case "export":
+		return runRegistryExport(ctx, args[1:])
+	case "import":
+		return runRegistryImport(ctx, args[1:])
+	}
+	return fmt.Errorf("unknown registry subcommand %q (want export or import)", args[0])
+}
+
+func runRegistryExport(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("registry export", &rpcURL)
+	out := fs.String("out", "registry-bundle.tar.gz", "archive to write")
+	networks := fs.String("network", "", "comma-separated networks to export (default: every network with deployments)")
+	sign := fs.String("sign", attestSigner, "how to sign the archive: signer (EIP-191 by the -signer key) or sigstore (cosign)")
+	sc := addSignerFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *sign != attestSigner && *sign != attestSigstore {
+		return fmt.Errorf("unknown -sign %q (want %s or %s)", *sign, attestSigner, attestSigstore)
+	}
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	regs, err := loadRegistries(root)
+	if err != nil {
+		return err
+	}
+	if *networks != "" {
+		want := splitList(*networks)
+		regs = slices.DeleteFunc(regs, func(reg *registry) bool { return !slices.Contains(want, reg.Network) })
+		for _, name := range want {
+			if !slices.ContainsFunc(regs, func(reg *registry) bool { return reg.Network == name }) {
+				return fmt.Errorf("network %s has no deployments to export", name)
+			}
+		}
+	}
+	if len(regs) == 0 {
+		return errors.New("no deployments to export")
+	}
+
+	p := runProvenance(ctx, root, "")
+	bundle := registryBundle{Type: bundleType, Created: time.Now().UTC(), Commit: p.commit, User: p.user, Host: p.host, Files: map[string]string{}}
+	contents := map[string][]byte{}
+	for _, reg := range regs {
+		files, err := exportFiles(root, reg, contents)
+		if err != nil {
+			return err
+		}
+		bundle.Networks = append(bundle.Networks, bundleNetwork{Name: reg.Network, ChainID: reg.ChainID, Contracts: len(reg.Contracts), Files: files})
+	}
+	for name, raw := range contents {
+		bundle.Files[name] = sha256Hex(raw)
+	}
+	payload, err := json.Marshal(bundle)
+	if err != nil {
+		return err
+	}
+	sig := attestationSignature{Type: *sign}
+	switch *sign {
+	case attestSigner:
+		s, ms, closeSigner, err := openMessageSigner(ctx, *sc, rpcURL)
+		if err != nil {
+			return err
+		}
+		defer closeSigner()
+		if sig.Signature, err = ms.SignText(ctx, payload); err != nil {
+			return fmt.Errorf("sign: %w", err)
+		}
+		addr := s.Address()
+		sig.Signer = &addr
+	case attestSigstore:
+		if sig.Bundle, err = sigstoreSign(ctx, payload); err != nil {
+			return err
+		}
+	}
+	rawSig, err := json.MarshalIndent(sig, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeBundle(*out, payload, append(rawSig, '\n'), contents); err != nil {
+		return err
+	}
+	for _, n := range bundle.Networks {
+		fmt.Printf("%s (chain %d): %d contracts, %d files\n", n.Name, n.ChainID, n.Contracts, len(n.Files))
+	}
+	signedBy := "Sigstore"
+	if sig.Signer != nil {
+		signedBy = sig.Signer.Hex()
+	}
+	fmt.Printf("Wrote %s, signed by %s\n", *out, signedBy)
+	return nil
+}
+
+// exportFiles reads reg's registry file and the files its entries refer to
+// into contents, returning their paths. Artifacts are looked up in both
+// the EVM and zkSync build directories; those no longer built are left out.
+func exportFiles(root string, reg *registry, contents map[string][]byte) ([]string, error) {
+	var files []string
+	add := func(rel string, required bool) error {
+		rel = filepath.ToSlash(rel)
+		if _, ok := contents[rel]; ok {
+			files = append(files, rel)
+			return nil
+		}
+		raw, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(rel)))
+		if errors.Is(err, fs.ErrNotExist) && !required {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		contents[rel] = raw
+		files = append(files, rel)
+		return nil
+	}
+	addArtifact := func(source, contract string) error {
+		for _, dir := range []string{"out", "zkout"} {
+			if err := add(path.Join(dir, filepath.Base(source), contract+".json"), false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	rel, _ := filepath.Rel(root, reg.path)
+	if err := add(rel, true); err != nil {
+		return nil, err
+	}
+	for _, name := range reg.names() {
+		e := reg.Contracts[name]
+		if e.Source != "" {
+			if err := addArtifact(e.Source, e.Contract); err != nil {
+				return nil, err
+			}
+		}
+		if e.Proxy != nil {
+			// The proxy's own artifact, from the usual Name.sol.
+			if err := addArtifact(e.Proxy.Contract+".sol", e.Proxy.Contract); err != nil {
+				return nil, err
+			}
+		}
+		for lib := range e.Libraries {
+			file, contract := splitContractRef(lib)
+			if err := addArtifact(file, contract); err != nil {
+				return nil, err
+			}
+		}
+		for _, ref := range []string{e.Attestation, e.Flattened} {
+			if ref == "" {
+				continue
+			}
+			if err := add(ref, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+	sort.Strings(files)
+	return slices.Compact(files), nil
+}
+
+func sha256Hex(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeBundle writes the archive as a gzipped tar: bundle.json and its
+// signature first, then the files in path order.
+func writeBundle(out string, payload, sig []byte, contents map[string][]byte) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	names := make([]string, 0, len(contents))
+	for name := range contents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	write := func(name string, raw []byte) error {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(raw)), ModTime: time.Unix(0, 0), Typeflag: tar.TypeReg}); err != nil {
+			return err
+		}
+		_, err := tw.Write(raw)
+		return err
+	}
+	if err := write(bundleIndex, payload); err != nil {
+		return err
+	}
+	if err := write(bundleSignature, sig); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := write(name, contents[name]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(out, buf.Bytes(), 0o644)
+}
+
+// readBundle reads an archive, checking that it holds exactly the files
+// bundle.json lists, with the hashes it lists. The signature is not
+// checked here.
+func readBundle(in string) (*registryBundle, []byte, *attestationSignature, map[string][]byte, error) {
+	f, err := os.Open(in)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("%s: %w", in, err)
+	}
+	tr := tar.NewReader(gz)
+	contents := map[string][]byte{}
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("%s: %w", in, err)
+		}
+		// Only plain files at clean relative paths, so an archive cannot
+		// write outside the project it is imported into.
+		name := h.Name
+		if h.Typeflag == tar.TypeDir {
+			continue
+		}
+		if h.Typeflag != tar.TypeReg || path.IsAbs(name) || path.Clean(name) != name || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, nil, nil, nil, fmt.Errorf("%s: unexpected entry %q", in, name)
+		}
+		if _, ok := contents[name]; ok {
+			return nil, nil, nil, nil, fmt.Errorf("%s: %s appears twice", in, name)
+		}
+		raw, err := io.ReadAll(io.LimitReader(tr, maxBundleFile+1))
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("%s: %s: %w", in, name, err)
+		}
+		if len(raw) > maxBundleFile {
+			return nil, nil, nil, nil, fmt.Errorf("%s: %s is over %d MiB", in, name, maxBundleFile>>20)
+		}
+		contents[name] = raw
+	}
+
+	payload, ok := contents[bundleIndex]
+	if !ok {
+		return nil, nil, nil, nil, fmt.Errorf("%s has no %s; is it a registry archive?", in, bundleIndex)
+	}
+	rawSig, ok := contents[bundleSignature]
+	if !ok {
+		return nil, nil, nil, nil, fmt.Errorf("%s is not signed (no %s)", in, bundleSignature)
+	}
+	delete(contents, bundleIndex)
+	delete(contents, bundleSignature)
+	bundle := &registryBundle{}
+	if err := json.Unmarshal(payload, bundle); err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("%s: %s: %w", in, bundleIndex, err)
+	}
+	if bundle.Type != bundleType {
+		return nil, nil, nil, nil, fmt.Errorf("%s: unknown archive type %q", in, bundle.Type)
+	}
+	sig := &attestationSignature{}
+	if err := json.Unmarshal(rawSig, sig); err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("%s: %s: %w", in, bundleSignature, err)
+	}
+	for name, raw := range contents {
+		want, ok := bundle.Files[name]
+		if !ok {
+			return nil, nil, nil, nil, fmt.Errorf("%s: %s is not listed in %s", in, name, bundleIndex)
+		}
+		if got := sha256Hex(raw); got != want {
+			return nil, nil, nil, nil, fmt.Errorf("%s: %s has SHA-256 %s, not the listed %s; the archive was altered", in, name, got, want)
+		}
+	}
+	for name := range bundle.Files {
+		if _, ok := contents[name]; !ok {
+			return nil, nil, nil, nil, fmt.Errorf("%s: %s is listed but missing", in, name)
+		}
+	}
+	return bundle, payload, sig, contents, nil
+}
+
+// verifyBundleSignature checks sig over payload: an EIP-191 signature
+// must recover to trusted, a Sigstore bundle must name identity and issuer.
+// It returns who signed.
+func verifyBundleSignature(ctx context.Context, payload []byte, sig *attestationSignature, trusted, identity, issuer string) (string, error) {
+	switch sig.Type {
+	case attestSigner:
+		signer, err := recoverSigner(common.BytesToHash(accounts.TextHash(payload)), sig.Signature)
+		if err != nil {
+			return "", fmt.Errorf("recover signer: %w", err)
+		}
+		if claimed := sig.Signer; claimed != nil && *claimed != signer {
+			return "", fmt.Errorf("the signature is not %s's over this archive; it was altered after signing", claimed.Hex())
+		}
+		if trusted == "" {
+			return "", fmt.Errorf("the archive is signed by %s; pass -signer %s if that key is trusted", signer.Hex(), signer.Hex())
+		}
+		want, err := parseAddress(trusted)
+		if err != nil {
+			return "", fmt.Errorf("-signer: %w", err)
+		}
+		if signer != want {
+			return "", fmt.Errorf("the archive is signed by %s, not %s", signer.Hex(), want.Hex())
+		}
+		return signer.Hex(), nil
+	case attestSigstore:
+		if identity == "" || issuer == "" {
+			return "", errors.New("a Sigstore-signed archive needs -identity and -issuer to say whose signature to trust")
+		}
+		if err := sigstoreVerify(ctx, payload, sig.Bundle, identity, issuer); err != nil {
+			return "", err
+		}
+		return identity, nil
+	}
+	return "", fmt.Errorf("unknown signature type %q", sig.Type)
+}
+
+func runRegistryImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("registry import", flag.ContinueOnError)
+	in := fs.String("in", "", "archive to import (required)")
+	trusted := fs.String("signer", "", "address an EIP-191 signed archive must be signed by")
+	identity := fs.String("identity", "", "for Sigstore-signed archives, the identity the certificate must name, e.g. an email")
+	issuer := fs.String("issuer", "", "for Sigstore-signed archives, the OIDC issuer, e.g. https://accounts.google.com")
+	networks := fs.String("network", "", "comma-separated networks to import (default: all in the archive)")
+	dir := fs.String("dir", "", "project directory to import into (default: the current project)")
+	verifyOnly := fs.Bool("verify-only", false, "check the archive and list its contents without writing anything")
+	force := fs.Bool("force", false, "overwrite registries and artifacts that differ from the archive's")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" {
+		return errors.New("-in is required")
+	}
+	bundle, payload, sig, contents, err := readBundle(*in)
+	if err != nil {
+		return err
+	}
+	signedBy, err := verifyBundleSignature(ctx, payload, sig, *trusted, *identity, *issuer)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Archive created %s by %s@%s", bundle.Created.Local().Format(time.DateTime), bundle.User, bundle.Host)
+	if bundle.Commit != "" {
+		fmt.Printf(" at commit %s", bundle.Commit)
+	}
+	fmt.Printf(", signed by %s\n", signedBy)
+
+	selected := bundle.Networks
+	if *networks != "" {
+		want := splitList(*networks)
+		selected = slices.DeleteFunc(slices.Clone(selected), func(n bundleNetwork) bool { return !slices.Contains(want, n.Name) })
+		for _, name := range want {
+			if !slices.ContainsFunc(selected, func(n bundleNetwork) bool { return n.Name == name }) {
+				return fmt.Errorf("the archive has no network %s", name)
+			}
+		}
+	}
+	if *verifyOnly {
+		for _, n := range selected {
+			if err := printBundleNetwork(n, contents); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	root := *dir
+	if root == "" {
+		if root, err = projectRoot(); err != nil {
+			return err
+		}
+	}
+	// Keep runs off the networks while their registries are replaced.
+	for _, n := range selected {
+		lock, err := acquireRunLock(root, n.Name)
+		if err != nil {
+			return err
+		}
+		defer lock.release()
+	}
+	var write, conflicts []string
+	unchanged := 0
+	seen := map[string]bool{}
+	for _, n := range selected {
+		for _, name := range n.Files {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			existing, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+			switch {
+			case errors.Is(err, os.ErrNotExist):
+				write = append(write, name)
+			case err != nil:
+				return err
+			case bytes.Equal(existing, contents[name]):
+				unchanged++
+			case *force:
+				write = append(write, name)
+			default:
+				conflicts = append(conflicts, name)
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("these files differ from the archive's: %s; pass -force to overwrite them", strings.Join(conflicts, ", "))
+	}
+	for _, name := range write {
+		if err := writeFileAtomic(filepath.Join(root, filepath.FromSlash(name)), contents[name]); err != nil {
+			return err
+		}
+		logger.Info("Imported", "file", name)
+	}
+	for _, n := range selected {
+		fmt.Printf("%s (chain %d): %d contracts\n", n.Name, n.ChainID, n.Contracts)
+	}
+	fmt.Printf("Wrote %d files, %d already up to date\n", len(write), unchanged)
+	return nil
+}
+
+// printBundleNetwork lists the deployments in an archived registry.
+func printBundleNetwork(n bundleNetwork, contents map[string][]byte) error {
+	reg := &registry{}
+	if err := json.Unmarshal(contents[path.Join("deployments", n.Name+".json")], reg); err != nil {
+		return fmt.Errorf("%s registry: %w", n.Name, err)
+	}
+	fmt.Printf("\n%s (chain %d), %d files:\n", n.Name, n.ChainID, len(n.Files))
+	for _, name := range reg.names() {
+		e := reg.Contracts[name]
+		fmt.Printf("  %-24s %s  %s\n", name, e.Address.Hex(), e.Contract)
+	}
+	return nil
+}
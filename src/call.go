@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+func runCall(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("call", &rpcURL)
+	to := fs.String("to", "", "contract address, ENS name or registry name")
+	data := fs.String("data", "", "hex-encoded calldata")
+	method := fs.String("method", "", "call this method by name or signature instead of sending -data")
+	methodArgs := fs.String("args", "[]", "arguments for -method as a JSON array")
+	contractRef := fs.String("contract", "", "artifact (File.sol or File.sol:Name) providing the ABI for -method; defaults to the registry entry's")
+	block := fs.Uint64("block", 0, "block number to call against (default: latest)")
+	network := addRegistryFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *to == "" {
+		return errors.New("-to is required")
+	}
+
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var at *big.Int
+	if *block > 0 {
+		at = new(big.Int).SetUint64(*block)
+	}
+
+	if *method != "" {
+		params, err := parseJSONArgs(*methodArgs)
+		if err != nil {
+			return err
+		}
+		root, err := projectRoot()
+		if err != nil {
+			return err
+		}
+		reg, err := loadRegistry(root, *network)
+		if err != nil {
+			return err
+		}
+		c, err := bindContract(ctx, client, reg, root, *to, *contractRef)
+		if err != nil {
+			return err
+		}
+		ens := newENSResolver(client, ensRegistryAddress)
+		if ens.book, err = loadAddressBook(root, *network); err != nil {
+			return err
+		}
+		if params, err = ens.resolveMethodArgs(ctx, c.ABI, *method, params, nil); err != nil {
+			return err
+		}
+		values, err := c.CallAt(ctx, at, *method, params...)
+		if err != nil {
+			return err
+		}
+		m, _ := findMethod(c.ABI, *method)
+		printOutputs(m.Outputs, values)
+		return nil
+	}
+
+	var addr common.Address
+	if isENSName(*to) {
+		addr, err = newENSResolver(client, ensRegistryAddress).resolve(ctx, *to)
+	} else {
+		addr, err = resolveAddress(*to, *network)
+	}
+	if err != nil {
+		return err
+	}
+	result, err := client.CallContract(ctx, ethereum.CallMsg{To: &addr, Data: common.FromHex(*data)}, at)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hexutil.Encode(result))
+	return nil
+}
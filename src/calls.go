@@ -0,0 +1,464 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// callSpec is a configuration call made once every contract in the
+// manifest is deployed:
+//
+//	calls:
+//	  - to: FractionalizedNFT
+//	    method: transferOwnership
+//	    args: ["${Governance.address}"]
+//	batch: multicall3
+type callSpec struct {
+	// To is a manifest or registry name, or an address.
+	To string `yaml:"to"`
+	// Contract is the artifact providing the ABI; it defaults to To's
+	// manifest contract, or its registry entry.
+	Contract string        `yaml:"contract"`
+	Method   string        `yaml:"method"`
+	Args     []interface{} `yaml:"args"`
+	Value    string        `yaml:"value"`
+	// Blobs are files sent with the call in an EIP-4844 blob transaction,
+	// relative to the project root.
+	Blobs []string `yaml:"blobs"`
+	// AccessList overrides the manifest's gas.accessList for this call.
+	AccessList *bool `yaml:"accessList"`
+}
+
+// Ways of sending a manifest's calls. Multicall3 runs them in one
+// transaction, where the targets see Multicall3 as msg.sender, so it only
+// suits calls that do not check the caller. In Safe mode both batch modes
+// use Safe's MultiSendCallOnly, which keeps the Safe as the sender. EIP-5792
+// hands the batch to the node's wallet (wallet_sendCalls), which executes it
+// atomically from the signer's own account.
+const (
+	batchNone      = "none"
+	batchMulticall = "multicall3"
+	batchEIP5792   = "eip5792"
+)
+
+var (
+	// multicall3Address is where Multicall3 is deployed on most chains.
+	multicall3Address = common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+	// multiSendCallOnlyAddress is Safe's MultiSendCallOnly library (v1.4.1).
+	multiSendCallOnlyAddress = common.HexToAddress("0x9641d764fc13c8B624c04430C7356C1C7C8102e2")
+
+	multicall3ABI = mustParseABI(`[{"type":"function","name":"aggregate3Value","inputs":[{"name":"calls","type":"tuple[]","components":[{"name":"target","type":"address"},{"name":"allowFailure","type":"bool"},{"name":"value","type":"uint256"},{"name":"callData","type":"bytes"}]}],"outputs":[{"name":"returnData","type":"tuple[]","components":[{"name":"success","type":"bool"},{"name":"returnData","type":"bytes"}]}],"stateMutability":"payable"}]`)
+	multiSendABI  = mustParseABI(`[{"type":"function","name":"multiSend","inputs":[{"name":"transactions","type":"bytes"}],"outputs":[],"stateMutability":"payable"}]`)
+)
+
+// multicall3Call is one entry of an aggregate3Value batch.
+type multicall3Call struct {
+	Target       common.Address
+	AllowFailure bool
+	Value        *big.Int
+	CallData     []byte
+}
+
+// encodedCall is a callSpec ready to send.
+type encodedCall struct {
+	label string
+	abi   abi.ABI
+	to    common.Address
+	value *big.Int
+	data  []byte
+	blobs []string
+	// accessList is the call's gas.accessList override.
+	accessList *bool
+}
+
+func (c *callSpec) validate() error {
+	if c.To == "" || c.Method == "" {
+		return errors.New("to and method are required")
+	}
+	if _, err := parseWei(c.Value); err != nil {
+		return fmt.Errorf("value: %w", err)
+	}
+	return nil
+}
+
+// encodeCalls resolves the targets and ${Name.address} references of the
+// manifest's calls and ABI-encodes them.
+func (r *networkRun) encodeCalls(ctx context.Context, m *manifest, resolve func(string) (common.Address, error)) ([]encodedCall, error) {
+	contracts := make(map[string]string, len(m.Contracts))
+	for _, spec := range m.Contracts {
+		contracts[spec.Name] = spec.Contract
+	}
+	var out []encodedCall
+	for i, c := range m.Calls {
+		label := fmt.Sprintf("calls[%d] %s.%s", i, c.To, c.Method)
+		call, err := r.encodeCall(ctx, c, contracts, resolve)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", label, err)
+		}
+		call.label = label
+		out = append(out, call)
+	}
+	return out, nil
+}
+
+func (r *networkRun) encodeCall(ctx context.Context, c callSpec, contracts map[string]string, resolve func(string) (common.Address, error)) (encodedCall, error) {
+	var call encodedCall
+	target, err := substitute(c.To, resolve)
+	if err != nil {
+		return call, err
+	}
+	if call.to, err = r.resolveTarget(ctx, target.(string), resolve); err != nil {
+		return call, err
+	}
+	contractABI, err := r.callABI(ctx, c.To, c.Contract, contracts)
+	if err != nil {
+		return call, err
+	}
+	args, err := substitute(c.Args, resolve)
+	if err != nil {
+		return call, err
+	}
+	params, _ := args.([]interface{})
+	if params, err = r.ens.resolveMethodArgs(ctx, contractABI, c.Method, params, nil); err != nil {
+		return call, err
+	}
+	call.abi = contractABI
+	if call.data, err = encodeCall(contractABI, c.Method, params); err != nil {
+		return call, err
+	}
+	call.value, _ = parseWei(c.Value)
+	call.blobs, call.accessList = c.Blobs, c.AccessList
+	return call, nil
+}
+
+// resolveTarget resolves the account a call is made to: an address, ENS
+// name, deployment name or address book label.
+func (r *networkRun) resolveTarget(ctx context.Context, to string, resolve func(string) (common.Address, error)) (common.Address, error) {
+	switch {
+	case strings.HasPrefix(to, "0x"):
+		return parseAddress(to)
+	case isENSName(to):
+		return r.ens.resolve(ctx, to)
+	}
+	addr, err := resolve(to)
+	if err != nil {
+		if labelled, ok := r.book.lookup(to); ok {
+			return labelled, nil
+		}
+	}
+	return addr, err
+}
+
+// callABI returns the ABI for calls to name: ref's artifact, else that of
+// name's manifest contract, else its registry entry's.
+func (r *networkRun) callABI(ctx context.Context, name, ref string, contracts map[string]string) (abi.ABI, error) {
+	if ref == "" {
+		ref = contracts[name]
+	}
+	if ref != "" {
+		art, err := r.loadArtifact(ref)
+		if err != nil {
+			return abi.ABI{}, err
+		}
+		return art.ABI, nil
+	}
+	bound, err := bindContract(ctx, r.client, r.registry, r.root, name, "")
+	if err != nil {
+		return abi.ABI{}, err
+	}
+	return bound.ABI, nil
+}
+
+// checkCalls encodes the manifest's calls before anything is deployed, and
+// checks the signer can send them the way the manifest asks.
+func (r *networkRun) checkCalls(ctx context.Context, m *manifest) error {
+	if _, err := r.encodeCalls(ctx, m, r.pendingResolver(m.Contracts)); err != nil {
+		return err
+	}
+	if _, ok := r.sender.(*nodeSigner); m.Batch == batchEIP5792 && r.safe == nil && !ok {
+		return errors.New("batch: eip5792 needs the node signer, whose wallet executes the batch")
+	}
+	return nil
+}
+
+// runCalls sends the manifest's calls, skipping those an interrupted run
+// already made and, with deploy -changed, those that refer to no
+// redeployed contract. Batched calls go out in a single transaction, so a failure
+// leaves none of them applied.
+func (r *networkRun) runCalls(ctx context.Context, m *manifest, state *runState) error {
+	if len(m.Calls) == 0 {
+		return nil
+	}
+	calls, err := r.encodeCalls(ctx, m, r.resolveRef)
+	if err != nil {
+		return err
+	}
+	if r.changes != nil {
+		moved := r.movedCalls(m, state)
+		if len(moved) < len(calls) {
+			logger.Info("Skipping calls that refer to no redeployed contract", "calls", len(calls)-len(moved))
+		}
+		kept := make([]encodedCall, 0, len(moved))
+		for _, i := range moved {
+			kept = append(kept, calls[i])
+		}
+		if calls = kept; len(calls) == 0 {
+			return nil
+		}
+	}
+	if r.opts.Resume && state.Calls > 0 {
+		if state.Calls >= len(calls) {
+			logger.Info("Calls already made by the interrupted run, skipping", "calls", len(calls))
+			return nil
+		}
+		logger.Info("Skipping calls made by the interrupted run", "calls", state.Calls)
+		calls = calls[state.Calls:]
+	}
+	done := state.Calls
+	batch := m.Batch
+	if batch == batchEIP5792 && r.opts.DryRun {
+		// The wallet has no way to simulate a batch, so check each call.
+		batch = batchNone
+	}
+	if batch == "" || batch == batchNone || len(calls) == 1 {
+		for _, c := range calls {
+			blobs, err := r.loadBlobs(c.blobs)
+			if err != nil {
+				return fmt.Errorf("%s: %w", c.label, err)
+			}
+			sent, err := r.transact(ctx, txFields{To: &c.to, Value: c.value, Data: c.data, Label: c.label + "(" + describeArgs(c.abi, c.data, r.book) + ")", Blobs: blobs}, gasConfig{AccessList: c.accessList})
+			if err != nil && sent != nil && sent.Reverted {
+				err = r.explainRevert(err, c.abi, c.data)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", c.label, err)
+			}
+			r.reportCall(c.label, sent)
+			done++
+			if !r.opts.DryRun {
+				if err := state.checkpointCalls(done); err != nil {
+					return fmt.Errorf("checkpoint: %w", err)
+				}
+			}
+		}
+		return nil
+	}
+
+	var sent *sentTx
+	switch {
+	case r.safe != nil:
+		sent, err = r.multiSend(ctx, calls)
+	case batch == batchMulticall:
+		sent, err = r.multicall(ctx, m.Networks[r.name], calls)
+	default:
+		sent, err = r.sendCalls(ctx, calls)
+	}
+	if err != nil {
+		return fmt.Errorf("batch of %d calls: %w", len(calls), err)
+	}
+	r.reportCall(fmt.Sprintf("batch of %d calls", len(calls)), sent)
+	if r.opts.DryRun {
+		return nil
+	}
+	return state.checkpointCalls(done + len(calls))
+}
+
+func (r *networkRun) reportCall(label string, sent *sentTx) {
+	if r.opts.DryRun {
+		logger.Info("DRY RUN: call would succeed", "network", r.name, "call", label, "gas", sent.Gas)
+		return
+	}
+	logger.Info("Called", "network", r.name, "call", label, "tx", sent.Hash)
+}
+
+// multicall sends the calls through Multicall3's aggregate3Value, with
+// failures disallowed so that one revert reverts them all.
+func (r *networkRun) multicall(ctx context.Context, cfg networkConfig, calls []encodedCall) (*sentTx, error) {
+	addr := multicall3Address
+	if cfg.Multicall3 != "" {
+		var err error
+		if addr, err = parseAddress(cfg.Multicall3); err != nil {
+			return nil, fmt.Errorf("multicall3: %w", err)
+		}
+	}
+	code, err := r.client.CodeAt(ctx, addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(code) == 0 {
+		return nil, fmt.Errorf("Multicall3 is not deployed at %s on %s; set the network's multicall3 address, or use batch: none", addr.Hex(), r.name)
+	}
+	entries := make([]multicall3Call, len(calls))
+	total := new(big.Int)
+	for i, c := range calls {
+		entries[i] = multicall3Call{Target: c.to, Value: c.value, CallData: c.data}
+		total.Add(total, c.value)
+	}
+	data, err := multicall3ABI.Pack("aggregate3Value", entries)
+	if err != nil {
+		return nil, err
+	}
+	sent, err := r.transact(ctx, txFields{To: &addr, Value: total, Data: data, Label: fmt.Sprintf("Multicall3 batch of %d calls", len(calls))}, gasConfig{})
+	if err != nil && sent != nil && sent.Reverted {
+		err = fmt.Errorf("%w (the targets see Multicall3 as msg.sender, so calls restricted to the deployer fail; use batch: none for those)", err)
+	}
+	return sent, err
+}
+
+// multiSend proposes the calls to the Safe as one delegatecall to
+// MultiSendCallOnly, so the owners sign once and each call still comes
+// from the Safe, paying any value from the Safe's balance.
+func (r *networkRun) multiSend(ctx context.Context, calls []encodedCall) (*sentTx, error) {
+	var packed []byte
+	var gas uint64
+	for _, c := range calls {
+		// Each call is estimated on its own, so the total is approximate.
+		estimated, err := r.client.EstimateGas(ctx, ethereum.CallMsg{From: r.from(), To: &c.to, Value: c.value, Data: c.data})
+		if err != nil {
+			return &sentTx{Reverted: true}, fmt.Errorf("%s: estimate gas: %s", c.label, revertReason(err))
+		}
+		gas += estimated
+
+		packed = append(packed, safeOpCall)
+		packed = append(packed, c.to.Bytes()...)
+		packed = append(packed, common.LeftPadBytes(c.value.Bytes(), 32)...)
+		packed = append(packed, common.LeftPadBytes(binary.BigEndian.AppendUint64(nil, uint64(len(c.data))), 32)...)
+		packed = append(packed, c.data...)
+	}
+	if r.opts.DryRun {
+		return &sentTx{Gas: gas}, nil
+	}
+	data, err := multiSendABI.Pack("multiSend", packed)
+	if err != nil {
+		return nil, err
+	}
+	label := fmt.Sprintf("MultiSend batch of %d calls", len(calls))
+	if err := r.confirmTx(ctx, txFields{To: &multiSendCallOnlyAddress, Data: data, Label: label}, gas, fees{}); err != nil {
+		return nil, err
+	}
+	sent, err := r.safe.propose(ctx, r, multiSendCallOnlyAddress, new(big.Int), data, safeOpDelegateCall, false)
+	if sent != nil {
+		r.audit(txFields{To: &multiSendCallOnlyAddress, Data: data, Label: label}, sent.Hash, nil, gas)
+		sent.Gas = gas
+	}
+	return sent, err
+}
+
+// sendCalls hands the calls to the node's wallet with EIP-5792
+// wallet_sendCalls, requiring atomic execution, and waits for the batch to
+// be included.
+func (r *networkRun) sendCalls(ctx context.Context, calls []encodedCall) (*sentTx, error) {
+	type walletCall struct {
+		To    common.Address `json:"to"`
+		Data  hexutil.Bytes  `json:"data"`
+		Value *hexutil.Big   `json:"value"`
+	}
+	req := struct {
+		Version        string         `json:"version"`
+		ChainID        *hexutil.Big   `json:"chainId"`
+		From           common.Address `json:"from"`
+		AtomicRequired bool           `json:"atomicRequired"`
+		Calls          []walletCall   `json:"calls"`
+	}{Version: "2.0.0", ChainID: (*hexutil.Big)(r.chainID), From: r.from(), AtomicRequired: true}
+	for _, c := range calls {
+		req.Calls = append(req.Calls, walletCall{To: c.to, Data: c.data, Value: (*hexutil.Big)(c.value)})
+	}
+	if err := r.confirmTx(ctx, txFields{Label: fmt.Sprintf("EIP-5792 batch of %d calls", len(calls))}, 0, fees{}); err != nil {
+		return nil, err
+	}
+	var result json.RawMessage
+	if err := r.client.Client().CallContext(ctx, &result, "wallet_sendCalls", req); err != nil {
+		return nil, fmt.Errorf("wallet_sendCalls: %w", err)
+	}
+	// Version 1 of the API returned the batch id as a bare string.
+	var id string
+	if err := json.Unmarshal(result, &id); err != nil {
+		var v2 struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(result, &v2); err != nil || v2.ID == "" {
+			return nil, fmt.Errorf("wallet_sendCalls: unexpected result %s", result)
+		}
+		id = v2.ID
+	}
+	logger.Info("Sent call batch", "network", r.name, "id", id, "calls", len(calls))
+
+	hash, err := r.waitCalls(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// The wallet used up the account's nonce.
+	if r.nonce, err = r.client.PendingNonceAt(ctx, r.from()); err != nil {
+		return nil, err
+	}
+	r.audit(txFields{Label: fmt.Sprintf("EIP-5792 batch of %d calls", len(calls))}, hash, nil, 0)
+	sent := &sentTx{Hash: hash}
+	if r.opts.Confirmations > 0 {
+		sent.Receipt, err = r.waitMined(ctx, hash)
+	}
+	return sent, err
+}
+
+// waitCalls polls wallet_getCallsStatus until the batch id is included,
+// and returns the hash of the transaction that carried it.
+func (r *networkRun) waitCalls(ctx context.Context, id string) (common.Hash, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+	defer cancel()
+	for {
+		var status struct {
+			Status   json.RawMessage `json:"status"`
+			Receipts []struct {
+				TransactionHash common.Hash    `json:"transactionHash"`
+				Status          hexutil.Uint64 `json:"status"`
+			} `json:"receipts"`
+		}
+		if err := r.client.Client().CallContext(ctx, &status, "wallet_getCallsStatus", id); err != nil {
+			return common.Hash{}, fmt.Errorf("wallet_getCallsStatus: %w", err)
+		}
+		// Version 2 reports HTTP-like codes, version 1 PENDING or CONFIRMED.
+		code, err := strconv.Atoi(string(status.Status))
+		if err != nil {
+			var name string
+			if json.Unmarshal(status.Status, &name) == nil && name == "CONFIRMED" {
+				code = 200
+			} else {
+				code = 100
+			}
+		}
+		switch {
+		case code >= 400:
+			return common.Hash{}, fmt.Errorf("call batch %s failed with status %d", id, code)
+		case code >= 200 && len(status.Receipts) > 0:
+			for _, receipt := range status.Receipts {
+				if receipt.Status != 1 {
+					return receipt.TransactionHash, fmt.Errorf("call batch %s reverted in %s", id, receipt.TransactionHash.Hex())
+				}
+			}
+			return status.Receipts[0].TransactionHash, nil
+		}
+		if err := sleepCtx(ctx, receiptPollInterval); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return common.Hash{}, fmt.Errorf("call batch %s not included after %s", id, r.opts.Timeout)
+			}
+			return common.Hash{}, err
+		}
+	}
+}
+
+// checkpointCalls records that the first n of the manifest's calls were
+// made.
+func (s *runState) checkpointCalls(n int) error {
+	s.Calls = n
+	return s.write()
+}
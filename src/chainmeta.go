@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// chainInfo is what the CLI knows about a public chain.
+type chainInfo struct {
+	Name string
+	// Explorer is the chain's canonical block explorer, whose pages for
+	// transactions and addresses are under /tx/ and /address/.
+	Explorer string
+}
+
+// chainMetadata describes the chains with a canonical explorer, by chain
+// id. Networks on other chains, or with their own explorer, set
+// explorerURL.
+var chainMetadata = map[uint64]chainInfo{
+	1:        {"Ethereum", "https://etherscan.io"},
+	11155111: {"Sepolia", "https://sepolia.etherscan.io"},
+	17000:    {"Holesky", "https://holesky.etherscan.io"},
+	560048:   {"Hoodi", "https://hoodi.etherscan.io"},
+	10:       {"OP Mainnet", "https://optimistic.etherscan.io"},
+	11155420: {"OP Sepolia", "https://sepolia-optimism.etherscan.io"},
+	8453:     {"Base", "https://basescan.org"},
+	84532:    {"Base Sepolia", "https://sepolia.basescan.org"},
+	42161:    {"Arbitrum One", "https://arbiscan.io"},
+	42170:    {"Arbitrum Nova", "https://nova.arbiscan.io"},
+	421614:   {"Arbitrum Sepolia", "https://sepolia.arbiscan.io"},
+	137:      {"Polygon", "https://polygonscan.com"},
+	80002:    {"Polygon Amoy", "https://amoy.polygonscan.com"},
+	1101:     {"Polygon zkEVM", "https://zkevm.polygonscan.com"},
+	324:      {"zkSync Era", "https://era.zksync.network"},
+	300:      {"zkSync Era Sepolia", "https://sepolia-era.zksync.network"},
+	56:       {"BNB Smart Chain", "https://bscscan.com"},
+	97:       {"BNB Smart Chain Testnet", "https://testnet.bscscan.com"},
+	43114:    {"Avalanche C-Chain", "https://snowtrace.io"},
+	43113:    {"Avalanche Fuji", "https://testnet.snowtrace.io"},
+	100:      {"Gnosis", "https://gnosisscan.io"},
+	59144:    {"Linea", "https://lineascan.build"},
+	59141:    {"Linea Sepolia", "https://sepolia.lineascan.build"},
+	534352:   {"Scroll", "https://scrollscan.com"},
+	534351:   {"Scroll Sepolia", "https://sepolia.scrollscan.com"},
+	81457:    {"Blast", "https://blastscan.io"},
+	5000:     {"Mantle", "https://mantlescan.xyz"},
+	42220:    {"Celo", "https://celoscan.io"},
+	252:      {"Fraxtal", "https://fraxscan.com"},
+	7777777:  {"Zora", "https://explorer.zora.energy"},
+}
+
+// explorerSite is a block explorer's web UI. Etherscan, Blockscout and
+// their forks all link transactions as /tx/<hash> and accounts as
+// /address/<address>. The zero site links to nothing.
+type explorerSite string
+
+// explorerSite returns the network's explorer: its explorerURL, else the
+// canonical one for chainID.
+func (n networkConfig) explorerSite(chainID uint64) explorerSite {
+	if n.ExplorerURL != "" {
+		return explorerSite(strings.TrimSuffix(os.ExpandEnv(n.ExplorerURL), "/"))
+	}
+	return explorerSite(chainMetadata[chainID].Explorer)
+}
+
+// tx returns the link to the transaction hash, or "".
+func (s explorerSite) tx(hash common.Hash) string {
+	if s == "" || hash == (common.Hash{}) {
+		return ""
+	}
+	return string(s) + "/tx/" + hash.Hex()
+}
+
+// address returns the link to the account addr, or "".
+func (s explorerSite) address(addr common.Address) string {
+	if s == "" {
+		return ""
+	}
+	return string(s) + "/address/" + addr.Hex()
+}
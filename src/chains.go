@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Chain kinds a network can be, from its chain: field or name.
+const (
+	chainEVM    = "evm"
+	chainZKsync = "zksync"
+)
+
+// chainAdapter covers what differs between chains in deploying contracts
+// and sending transactions, so that one manifest can target both EVM
+// chains and ones like zkSync Era with their own deployment mechanism.
+type chainAdapter interface {
+	// artifactDir is the build output under the project root that the
+	// chain's contracts are loaded from.
+	artifactDir() string
+	// deployTx turns the plain creation transaction for art, its init code
+	// followed by the constructor arguments, into the one that deploys it
+	// on this chain. With a salt the deployment is deterministic and the
+	// address it deploys to is returned.
+	deployTx(ctx context.Context, r *networkRun, art *artifact, create txFields, salt *common.Hash) (txFields, *common.Address, error)
+	// createdAddress returns the address of a nonce-based deployment sent
+	// from from.
+	createdAddress(ctx context.Context, r *networkRun, from common.Address, sent *sentTx) (common.Address, error)
+	estimateGas(ctx context.Context, r *networkRun, msg ethereum.CallMsg, fields txFields) (uint64, error)
+	// call runs the transaction with eth_call, for dry runs.
+	call(ctx context.Context, r *networkRun, msg ethereum.CallMsg, fields txFields) error
+	// send signs and broadcasts the transaction with nonce and returns its
+	// hash.
+	send(ctx context.Context, r *networkRun, nonce uint64, f fees, gas uint64, fields txFields) (common.Hash, error)
+}
+
+// newChainAdapter returns the adapter for a network of the given kind
+// ("" is a plain EVM chain) served by a node on chainID.
+func newChainAdapter(kind string, chainID uint64) (chainAdapter, error) {
+	if kind == "" && zksyncChainIDs[chainID] {
+		return nil, fmt.Errorf("chain %d is zkSync Era, which deploys contracts differently; set chain: %s on the network", chainID, chainZKsync)
+	}
+	switch kind {
+	case "", chainEVM:
+		return evmChain{}, nil
+	case chainZKsync:
+		return &zksyncChain{}, nil
+	}
+	return nil, fmt.Errorf("unknown chain %q (want %s or %s)", kind, chainEVM, chainZKsync)
+}
+
+// loadArtifact loads ref from the run's chain's build output.
+func (r *networkRun) loadArtifact(ref string) (*artifact, error) {
+	return loadArtifactIn(r.root, r.chain.artifactDir(), ref)
+}
+
+// evmChain deploys with creation transactions, or salted through the
+// CREATE2 factory.
+type evmChain struct{}
+
+func (evmChain) artifactDir() string { return "out" }
+
+func (evmChain) deployTx(ctx context.Context, r *networkRun, art *artifact, create txFields, salt *common.Hash) (txFields, *common.Address, error) {
+	if salt == nil {
+		return create, nil, nil
+	}
+	factory, err := r.create2Factory(ctx)
+	if err != nil {
+		return txFields{}, nil, err
+	}
+	addr := create2Address(factory, *salt, create.Data)
+	return txFields{To: &factory, Value: create.Value, Data: append(salt.Bytes(), create.Data...), Label: create.Label + " through the CREATE2 factory"}, &addr, nil
+}
+
+func (evmChain) createdAddress(_ context.Context, _ *networkRun, from common.Address, sent *sentTx) (common.Address, error) {
+	return crypto.CreateAddress(from, sent.Nonce), nil
+}
+
+func (evmChain) estimateGas(ctx context.Context, r *networkRun, msg ethereum.CallMsg, _ txFields) (uint64, error) {
+	return r.client.EstimateGas(ctx, msg)
+}
+
+func (evmChain) call(ctx context.Context, r *networkRun, msg ethereum.CallMsg, _ txFields) error {
+	_, err := r.client.CallContract(ctx, msg, nil)
+	return err
+}
+
+func (evmChain) send(ctx context.Context, r *networkRun, nonce uint64, f fees, gas uint64, fields txFields) (common.Hash, error) {
+	signed, err := r.signerFor(fields).SignTx(ctx, newTx(r.chainID, nonce, f, gas, fields), r.chainID)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("sign: %w", err)
+	}
+	if err := r.client.SendTransaction(ctx, signed); err != nil {
+		return common.Hash{}, err
+	}
+	return signed.Hash(), nil
+}
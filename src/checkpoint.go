@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// runState checkpoints a manifest run on one network after every step, so a
+// run that fails halfway can be continued with -resume. It is removed once
+// the run completes.
+type runState struct {
+	Network string `json:"network"`
+	ChainID uint64 `json:"chainId"`
+	// Steps maps manifest contract names to what their step sent.
+	Steps map[string]*runStep `json:"steps"`
+	// Calls is how many of the manifest's calls were made.
+	Calls int `json:"calls,omitempty"`
+	// Distributed is how many recipients of each of the manifest's
+	// distributions were sent to.
+	Distributed []int `json:"distributed,omitempty"`
+
+	path string
+	// mu lets parallel deployments checkpoint their steps.
+	mu sync.Mutex
+}
+
+// runStep is one manifest entry's deployments: one contract, or an
+// implementation and its proxy.
+type runStep struct {
+	Contract string `json:"contract"`
+	// Args are the resolved constructor arguments; a step whose arguments
+	// changed since the checkpoint is deployed again.
+	Args        json.RawMessage  `json:"args"`
+	Deployments []stepDeployment `json:"deployments"`
+}
+
+type stepDeployment struct {
+	Name string `json:"name"`
+	// Artifact is the contract reference of the deployed code.
+	Artifact string         `json:"artifact"`
+	Address  common.Address `json:"address"`
+	TxHash   common.Hash    `json:"txHash"`
+	Deployer common.Address `json:"deployer"`
+}
+
+func runStatePath(root, network string) string {
+	return filepath.Join(root, "deployments", "."+network+".run.json")
+}
+
+// openRunState loads the checkpoint of an interrupted run on the network
+// when resuming, and otherwise starts a fresh one.
+func (r *networkRun) openRunState() (*runState, error) {
+	path := runStatePath(r.records, r.name)
+	state := &runState{Network: r.name, ChainID: r.chainID.Uint64(), Steps: map[string]*runStep{}, path: path}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !r.opts.Resume {
+		logger.Warn("A previous run did not finish; starting over. Use -resume to continue it", "network", r.name, "state", path)
+		return state, nil
+	}
+	if err := json.Unmarshal(raw, state); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if state.ChainID != r.chainID.Uint64() {
+		return nil, fmt.Errorf("%s was written for chain %d, but %s is chain %s", path, state.ChainID, r.name, r.chainID)
+	}
+	if state.Steps == nil {
+		state.Steps = map[string]*runStep{}
+	}
+	state.path = path
+	return state, nil
+}
+
+// checkpoint records spec's deployments and writes the state file.
+func (s *runState) checkpoint(spec contractSpec, deployed []*deployment) error {
+	args, err := json.Marshal(spec.Args)
+	if err != nil {
+		return err
+	}
+	step := &runStep{Contract: spec.Contract, Args: args}
+	for _, d := range deployed {
+		step.Deployments = append(step.Deployments, stepDeployment{
+			Name:     d.Name,
+			Artifact: d.artifact.Source + ":" + d.artifact.Name,
+			Address:  d.Address,
+			TxHash:   d.TxHash,
+			Deployer: d.Deployer,
+		})
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Steps[spec.Name] = step
+	return s.write()
+}
+
+func (s *runState) step(name string) *runStep {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Steps[name]
+}
+
+func (s *runState) write() error {
+	raw, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, append(raw, '\n'), 0o644)
+}
+
+// remove deletes the state file once the run has completed.
+func (s *runState) remove() error {
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// resumeStep returns spec's deployments from the checkpoint if all of them
+// are mined successfully and have code. Pending transactions are waited on.
+// A nil result means the step has to run again.
+func (r *networkRun) resumeStep(ctx context.Context, state *runState, spec contractSpec) ([]*deployment, error) {
+	step := state.step(spec.Name)
+	if step == nil {
+		return nil, nil
+	}
+	args, err := json.Marshal(spec.Args)
+	if err != nil {
+		return nil, err
+	}
+	// The state file is indented, so compare the compact forms.
+	var recorded bytes.Buffer
+	if err := json.Compact(&recorded, step.Args); err != nil {
+		return nil, err
+	}
+	if step.Contract != spec.Contract || !bytes.Equal(recorded.Bytes(), args) {
+		logger.Info("Changed since the interrupted run, deploying it again", "name", spec.Name)
+		return nil, nil
+	}
+	// A proxied step interrupted before its proxy was sent starts over.
+	want := 1
+	if spec.Proxy != nil {
+		want = 2
+	}
+	if len(step.Deployments) < want {
+		logger.Warn("Only partly deployed by the interrupted run, deploying it again", "name", spec.Name)
+		return nil, nil
+	}
+
+	var resumed []*deployment
+	for _, sd := range step.Deployments {
+		d := &deployment{Name: sd.Name, Address: sd.Address, TxHash: sd.TxHash, Deployer: sd.Deployer, Skipped: true}
+		if sd.TxHash != (common.Hash{}) {
+			receipt, err := r.waitMined(ctx, sd.TxHash)
+			if err != nil {
+				if receipt != nil {
+					logger.Warn("Interrupted deployment failed, deploying it again", "name", sd.Name, "err", err)
+					return nil, nil
+				}
+				return nil, fmt.Errorf("%s: %w", sd.Name, err)
+			}
+			d.BlockNumber, d.BlockHash, d.GasUsed = receipt.BlockNumber.Uint64(), receipt.BlockHash, receipt.GasUsed
+		}
+		code, err := r.client.CodeAt(ctx, sd.Address, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(code) == 0 {
+			logger.Warn("No code at the interrupted deployment's address, deploying it again", "name", sd.Name, "address", sd.Address)
+			return nil, nil
+		}
+		if d.artifact, err = r.loadArtifact(sd.Artifact); err != nil {
+			return nil, err
+		}
+		d.Contract = d.artifact.Name
+		resumed = append(resumed, d)
+	}
+	logger.Info("Already deployed by the interrupted run, skipping", "name", spec.Name)
+	return resumed, nil
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	compilerForge = "forge"
+	compilerSolc  = "solc"
+	compilerNone  = "none"
+)
+
+// compilerConfig selects how contracts are compiled before deploying:
+//
+//	compiler:
+//	  tool: forge          # or solc, or none to use out/ as is
+//	  version: 0.8.24
+//	  optimizerRuns: 200
+//	  evmVersion: paris
+//
+// Unset settings fall back to foundry.toml (forge) or solc's defaults.
+type compilerConfig struct {
+	Tool          string  `yaml:"tool"`
+	Version       string  `yaml:"version"`
+	OptimizerRuns *uint64 `yaml:"optimizerRuns"`
+	EVMVersion    string  `yaml:"evmVersion"`
+}
+
+func addCompilerFlags(fs *flag.FlagSet) *compilerConfig {
+	c := &compilerConfig{}
+	fs.StringVar(&c.Tool, "compiler", "", "build with forge (default), solc, or none to use existing artifacts")
+	fs.StringVar(&c.Version, "solc-version", "", "solc version to compile with, e.g. 0.8.24")
+	fs.Func("optimizer-runs", "enable the optimizer with this many runs", func(v string) error {
+		n, err := strconv.ParseUint(v, 10, 64)
+		c.OptimizerRuns = &n
+		return err
+	})
+	fs.StringVar(&c.EVMVersion, "evm-version", "", "EVM version to target, e.g. paris or cancun")
+	return c
+}
+
+func (c compilerConfig) validate() error {
+	switch c.Tool {
+	case "", compilerForge, compilerSolc, compilerNone:
+		return nil
+	}
+	return fmt.Errorf("tool must be %s, %s or %s, not %q", compilerForge, compilerSolc, compilerNone, c.Tool)
+}
+
+// merge fills fields unset in c from defaults.
+func (c compilerConfig) merge(defaults compilerConfig) compilerConfig {
+	if c.Tool == "" {
+		c.Tool = defaults.Tool
+	}
+	if c.Version == "" {
+		c.Version = defaults.Version
+	}
+	if c.OptimizerRuns == nil {
+		c.OptimizerRuns = defaults.OptimizerRuns
+	}
+	if c.EVMVersion == "" {
+		c.EVMVersion = defaults.EVMVersion
+	}
+	return c
+}
+
+// compile builds the project under root so artifacts in out/ match the
+// sources. Without an explicit tool, a missing forge binary only warns and
+// the existing artifacts are used.
+func compile(ctx context.Context, root string, c compilerConfig) error {
+	switch c.Tool {
+	case compilerNone:
+		return nil
+	case compilerSolc:
+		return compileSolc(ctx, root, c)
+	}
+	if _, err := exec.LookPath("forge"); err != nil {
+		if c.Tool == "" {
+			logger.Warn("forge not found; using the existing artifacts in out/")
+			return nil
+		}
+		return errors.New("forge not found in PATH; install Foundry or use -compiler solc")
+	}
+	args := []string{"build", "--root", root}
+	if c.Version != "" {
+		args = append(args, "--use", c.Version)
+	}
+	if c.OptimizerRuns != nil {
+		args = append(args, "--optimize", "--optimizer-runs", strconv.FormatUint(*c.OptimizerRuns, 10))
+	}
+	if c.EVMVersion != "" {
+		args = append(args, "--evm-version", c.EVMVersion)
+	}
+	logger.Info("Compiling", "tool", compilerForge)
+	out, err := exec.CommandContext(ctx, "forge", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("forge build failed:\n%s", bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// build compiles the project for the selected networks: with the
+// configured compiler for EVM chains, and with foundry-zksync for zkSync
+// ones.
+func (m *manifest) build(ctx context.Context, root string, networks []string) error {
+	evm, zksync := len(networks) == 0, false
+	for _, name := range networks {
+		if m.Networks[name].chainKind(name) == chainZKsync {
+			zksync = true
+		} else {
+			evm = true
+		}
+	}
+	if evm {
+		if err := compile(ctx, root, m.Compiler); err != nil {
+			return &compileError{err}
+		}
+	}
+	if zksync {
+		if err := compileZKsync(ctx, root, m.Compiler); err != nil {
+			return &compileError{err}
+		}
+	}
+	return nil
+}
+
+// solcOutput is the part of solc's standard JSON output used to write
+// artifacts.
+type solcOutput struct {
+	Errors []struct {
+		Severity         string `json:"severity"`
+		FormattedMessage string `json:"formattedMessage"`
+	} `json:"errors"`
+	Contracts map[string]map[string]struct {
+		ABI      json.RawMessage `json:"abi"`
+		Metadata string          `json:"metadata"`
+		EVM      struct {
+			Bytecode struct {
+				Object         string
+				LinkReferences linkReferences `json:"linkReferences"`
+			} `json:"bytecode"`
+			DeployedBytecode struct {
+				Object              string
+				ImmutableReferences immutableReferences `json:"immutableReferences"`
+			} `json:"deployedBytecode"`
+		} `json:"evm"`
+		StorageLayout json.RawMessage `json:"storageLayout"`
+	} `json:"contracts"`
+	Sources map[string]struct {
+		AST json.RawMessage `json:"ast"`
+	} `json:"sources"`
+}
+
+// compileSolc compiles the sources under root/src with solc's standard JSON
+// interface and writes forge-style artifacts to root/out.
+func compileSolc(ctx context.Context, root string, c compilerConfig) error {
+	if _, err := exec.LookPath("solc"); err != nil {
+		return errors.New("solc not found in PATH")
+	}
+	if c.Version != "" {
+		version, err := exec.CommandContext(ctx, "solc", "--version").Output()
+		if err != nil {
+			return fmt.Errorf("solc --version: %w", err)
+		}
+		if !strings.Contains(string(version), "Version: "+c.Version+"+") {
+			return fmt.Errorf("solc in PATH is not version %s:\n%s", c.Version, bytes.TrimSpace(version))
+		}
+	}
+
+	sources := map[string]interface{}{}
+	files, err := filepath.Glob(filepath.Join(root, "src", "*.sol"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no Solidity sources in %s", filepath.Join(root, "src"))
+	}
+	for _, f := range files {
+		rel, _ := filepath.Rel(root, f)
+		sources[filepath.ToSlash(rel)] = map[string]interface{}{"urls": []string{filepath.ToSlash(rel)}}
+	}
+	settings := map[string]interface{}{
+		"remappings": foundryRemappings(root),
+		"outputSelection": map[string]interface{}{
+			"*": map[string]interface{}{
+				"*": []string{"abi", "metadata", "evm.bytecode.object", "evm.deployedBytecode.object", "evm.deployedBytecode.immutableReferences", "storageLayout"},
+				// The AST names the immutables, as forge's artifacts do.
+				"": []string{"ast"},
+			},
+		},
+	}
+	if c.OptimizerRuns != nil {
+		settings["optimizer"] = map[string]interface{}{"enabled": true, "runs": *c.OptimizerRuns}
+	}
+	if c.EVMVersion != "" {
+		settings["evmVersion"] = c.EVMVersion
+	}
+	input, err := json.Marshal(map[string]interface{}{"language": "Solidity", "sources": sources, "settings": settings})
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Compiling", "tool", compilerSolc)
+	cmd := exec.CommandContext(ctx, "solc", "--standard-json", "--base-path", root, "--include-path", filepath.Join(root, "lib"), "--allow-paths", root)
+	cmd.Stdin = bytes.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	raw, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("solc: %w\n%s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	var out solcOutput
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return fmt.Errorf("parse solc output: %w", err)
+	}
+	var errs []string
+	for _, e := range out.Errors {
+		if e.Severity == "error" {
+			errs = append(errs, strings.TrimSpace(e.FormattedMessage))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("compilation failed:\n%s", strings.Join(errs, "\n"))
+	}
+
+	for source, contracts := range out.Contracts {
+		dir := filepath.Join(root, "out", filepath.Base(source))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		for name, compiled := range contracts {
+			art := map[string]interface{}{
+				"abi":              compiled.ABI,
+				"bytecode":         map[string]string{"object": "0x" + compiled.EVM.Bytecode.Object},
+				"deployedBytecode": map[string]interface{}{"object": "0x" + compiled.EVM.DeployedBytecode.Object, "immutableReferences": compiled.EVM.DeployedBytecode.ImmutableReferences},
+				"rawMetadata":      compiled.Metadata,
+				"storageLayout":    compiled.StorageLayout,
+			}
+			if ast := out.Sources[source].AST; len(ast) > 0 {
+				art["ast"] = ast
+			}
+			encoded, err := json.Marshal(art)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(filepath.Join(dir, name+".json"), encoded, 0o644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// foundryRemappings reads the remappings array from root/foundry.toml, so
+// solc resolves imports the same way forge does.
+func foundryRemappings(root string) []string {
+	f, err := os.Open(filepath.Join(root, "foundry.toml"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var remappings []string
+	inList := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "remappings") {
+			inList = true
+			_, line, _ = strings.Cut(line, "[")
+		}
+		if !inList {
+			continue
+		}
+		end := strings.Contains(line, "]")
+		line, _, _ = strings.Cut(line, "]")
+		for _, item := range strings.Split(line, ",") {
+			if item = strings.Trim(strings.TrimSpace(item), `'"`); item != "" {
+				remappings = append(remappings, item)
+			}
+		}
+		if end {
+			break
+		}
+	}
+	return remappings
+}
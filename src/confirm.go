@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"golang.org/x/term"
+)
+
+// errNotConfirmed is returned when the answer to a confirmation prompt was
+// not the network name.
+var errNotConfirmed = errors.New("transaction not confirmed")
+
+var (
+	// promptMu keeps the prompts of parallel deployments from interleaving.
+	promptMu sync.Mutex
+	// stdinLines is shared by all prompts so that input typed ahead is not
+	// lost to a discarded buffer.
+	stdinLines = bufio.NewReader(os.Stdin)
+)
+
+// confirmTx shows what is about to be broadcast and waits for the network
+// name to be typed back, when the run asks for confirmations. Anything
+// else aborts the transaction.
+func (r *networkRun) confirmTx(ctx context.Context, fields txFields, gas uint64, f fees) error {
+	if !r.confirm {
+		return nil
+	}
+	promptMu.Lock()
+	defer promptMu.Unlock()
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("%s asks to confirm each transaction, but stdin is not a terminal; pass -yes to send without asking", r.name)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\nAbout to send on %s (chain %s):\n", r.name, r.chainID)
+	fmt.Fprintf(&b, "  signer:    %s\n", r.book.annotate(r.signerFor(fields).Address()))
+	if r.safe != nil {
+		fmt.Fprintf(&b, "  safe:      %s (proposed for its owners to confirm)\n", r.safe.contract.Address.Hex())
+	}
+	if r.userOp != nil {
+		paid := "paid by the account"
+		if r.userOp.sponsored() {
+			paid = "sponsored by the paymaster"
+		}
+		fmt.Fprintf(&b, "  account:   %s (user operation through the bundler, %s)\n", r.userOp.account.Hex(), paid)
+	}
+	fmt.Fprintf(&b, "  action:    %s\n", r.describeTx(fields))
+	if fields.To != nil {
+		fmt.Fprintf(&b, "  to:        %s\n", r.book.annotate(*fields.To))
+	}
+	if fields.Value != nil && fields.Value.Sign() > 0 {
+		fmt.Fprintf(&b, "  value:     %s\n", formatEther(fields.Value))
+	}
+	if price := f.maxPrice(); price != nil {
+		fmt.Fprintf(&b, "  gas:       %d at up to %s wei/gas\n", gas, price)
+		if f.L1Fee != nil {
+			fmt.Fprintf(&b, "  L1 data:   %s\n", formatEther(f.L1Fee))
+		}
+		if f.BlobFeeCap != nil {
+			fmt.Fprintf(&b, "  blobs:     %d, blob gas %d at up to %s wei\n", len(fields.Blobs.Blobs), f.BlobGas, f.BlobFeeCap)
+		}
+		fmt.Fprintf(&b, "  max cost:  %s\n", formatEther(f.maxCost(gas)))
+	} else if gas > 0 {
+		fmt.Fprintf(&b, "  gas:       about %d, paid by whoever executes it\n", gas)
+	}
+	fmt.Fprintf(&b, "Type %q to send it, anything else to abort: ", r.name)
+	fmt.Fprint(os.Stderr, b.String())
+
+	got, err := readAnswer(ctx)
+	if err != nil {
+		return err
+	}
+	if got != r.name {
+		return errNotConfirmed
+	}
+	return nil
+}
+
+// readAnswer reads a line typed at a prompt, giving up when ctx is done.
+// The caller holds promptMu.
+func readAnswer(ctx context.Context) (string, error) {
+	answer := make(chan string, 1)
+	go func() {
+		line, _ := stdinLines.ReadString('\n')
+		answer <- strings.TrimSpace(line)
+	}()
+	select {
+	case <-ctx.Done():
+		fmt.Fprintln(os.Stderr)
+		return "", ctx.Err()
+	case got := <-answer:
+		return got, nil
+	}
+}
+
+// describeTx says what a transaction does, for the confirmation prompt:
+// its label, or the method it calls when the target is in the registry.
+func (r *networkRun) describeTx(fields txFields) string {
+	if fields.Label != "" {
+		return fields.Label
+	}
+	if fields.To == nil {
+		return "deploy a contract"
+	}
+	r.mu.Lock()
+	name, e := r.registry.byAddress(*fields.To)
+	r.mu.Unlock()
+	if e != nil {
+		if parsed, err := abi.JSON(strings.NewReader(string(e.ABI))); err == nil {
+			if call := describeCall(parsed, fields.Data, r.book); call != "" {
+				return name + "." + call
+			}
+		}
+		return "call " + name
+	}
+	if len(fields.Data) >= 4 {
+		return "call " + hexutil.Encode(fields.Data[:4]) + " on " + r.book.annotate(*fields.To)
+	}
+	return "transfer to " + r.book.annotate(*fields.To)
+}
+
+// describeCall renders calldata as method(arg, ...), with the addresses
+// the book names labelled, or returns "" if the selector is not in a.
+func describeCall(a abi.ABI, data []byte, book *addressBook) string {
+	if len(data) < 4 {
+		return ""
+	}
+	m, err := a.MethodById(data[:4])
+	if err != nil {
+		return ""
+	}
+	return m.Name + "(" + describeArgs(a, data, book) + ")"
+}
+
+// describeArgs renders the arguments in calldata for a method of a.
+func describeArgs(a abi.ABI, data []byte, book *addressBook) string {
+	if len(data) < 4 {
+		return ""
+	}
+	m, err := a.MethodById(data[:4])
+	if err != nil {
+		return "?"
+	}
+	values, err := m.Inputs.Unpack(data[4:])
+	if err != nil {
+		return "?"
+	}
+	return book.formatValues(values)
+}
+
+func formatValues(values []interface{}) string {
+	return formatValuesWith(values, common.Address.Hex)
+}
+
+func formatValuesWith(values []interface{}, address func(common.Address) string) string {
+	items := make([]string, len(values))
+	for i, v := range values {
+		items[i] = formatValueWith(v, address)
+	}
+	return strings.Join(items, ", ")
+}
@@ -0,0 +1,592 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"golang.org/x/term"
+)
+
+// consoleExpr matches the console's expressions: Name, Name.method and
+// Name.method(args).
+var consoleExpr = regexp.MustCompile(`^([A-Za-z_]\w*)(?:\.([A-Za-z_]\w*))?\s*(?:\((.*)\))?$`)
+
+// errConsoleExit ends the console loop.
+var errConsoleExit = errors.New("exit")
+
+// ethFunctions are the chain queries the console answers under eth.
+var ethFunctions = []struct {
+	name, usage string
+	args        int
+}{
+	{"getBalance", "eth.getBalance(addr)", 1},
+	{"getCode", "eth.getCode(addr)", 1},
+	{"getTransactionCount", "eth.getTransactionCount(addr)", 1},
+	{"getStorageAt", "eth.getStorageAt(addr, slot)", 2},
+	{"blockNumber", "eth.blockNumber()", 0},
+	{"chainId", "eth.chainId()", 0},
+	{"gasPrice", "eth.gasPrice()", 0},
+}
+
+// console evaluates read-only expressions against a network's deployed
+// contracts, decoding results with the registry's ABIs.
+type console struct {
+	client *ethclient.Client
+	reg    *registry
+	ens    *ensResolver
+	root   string
+	block  *big.Int
+	out    io.Writer
+
+	bound map[string]*boundContract
+}
+
+// runConsole reads expressions such as Governance.approvers(0) or
+// eth.getBalance(Governance) and prints their decoded results. Only view
+// and pure functions can be called.
+func runConsole(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("console", &rpcURL)
+	block := fs.Uint64("block", 0, "block number to read at (default: latest)")
+	network := addRegistryFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	reg, err := loadRegistry(root, *network)
+	if err != nil {
+		return err
+	}
+	c := &console{client: client, reg: reg, ens: newENSResolver(client, ensRegistryAddress), root: root, out: os.Stdout, bound: map[string]*boundContract{}}
+	if c.ens.book, err = loadAddressBook(root, *network); err != nil {
+		return err
+	}
+	if *block > 0 {
+		c.block = new(big.Int).SetUint64(*block)
+	}
+
+	readLine := bufio.NewScanner(os.Stdin)
+	next := func() (string, error) {
+		if !readLine.Scan() {
+			if err := readLine.Err(); err != nil {
+				return "", err
+			}
+			return "", io.EOF
+		}
+		return readLine.Text(), nil
+	}
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer term.Restore(fd, state)
+		t := term.NewTerminal(struct {
+			io.Reader
+			io.Writer
+		}{os.Stdin, os.Stdout}, "> ")
+		t.AutoCompleteCallback = c.complete
+		c.out, next = t, t.ReadLine
+		c.banner(ctx)
+	}
+
+	for {
+		line, err := next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := c.eval(ctx, strings.TrimSpace(line)); errors.Is(err, errConsoleExit) {
+			return nil
+		} else if err != nil {
+			fmt.Fprintf(c.out, "error: %v\n", err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *console) banner(ctx context.Context) {
+	at := "latest"
+	if c.block != nil {
+		at = c.block.String()
+	} else if n, err := c.client.BlockNumber(ctx); err == nil {
+		at = strconv.FormatUint(n, 10)
+	}
+	chain := "?"
+	if id, err := c.client.ChainID(ctx); err == nil {
+		chain = id.String()
+	}
+	fmt.Fprintf(c.out, "Chain %s, block %s, %d deployment(s) in the %s registry. Type help for commands, Ctrl-D to quit.\n", chain, at, len(c.reg.Contracts), c.reg.Network)
+}
+
+// eval runs one console line.
+func (c *console) eval(ctx context.Context, line string) error {
+	switch fields := strings.Fields(line); {
+	case len(fields) == 0:
+		return nil
+	case fields[0] == "exit" || fields[0] == "quit":
+		return errConsoleExit
+	case fields[0] == "help" && len(fields) == 1:
+		c.help()
+		return nil
+	case fields[0] == "help" && len(fields) == 2:
+		return c.methods(ctx, fields[1])
+	case fields[0] == "contracts" && len(fields) == 1:
+		c.contracts()
+		return nil
+	}
+	m := consoleExpr.FindStringSubmatch(line)
+	if m == nil {
+		return fmt.Errorf("cannot parse %q; type help for the syntax", line)
+	}
+	target, method, hasArgs := m[1], m[2], strings.HasSuffix(line, ")")
+	var args []interface{}
+	if hasArgs {
+		var err error
+		if args, err = parseConsoleArgs(m[3]); err != nil {
+			return err
+		}
+	}
+	if target == "eth" {
+		if method == "" {
+			return errors.New("eth takes a function, e.g. eth.blockNumber()")
+		}
+		return c.eth(ctx, method, args)
+	}
+	if method == "" || (method == "address" && !hasArgs) {
+		if hasArgs {
+			return fmt.Errorf("%s is a deployment; call one of its methods, e.g. %s.owner()", target, target)
+		}
+		e, err := c.reg.lookup(target)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.out, e.Address.Hex())
+		return nil
+	}
+	return c.call(ctx, target, method, args)
+}
+
+// call runs a view function of the deployment name.
+func (c *console) call(ctx context.Context, name, method string, args []interface{}) error {
+	bc, err := c.contract(ctx, name)
+	if err != nil {
+		return err
+	}
+	m, err := consoleMethod(bc.ABI, name, method, len(args))
+	if err != nil {
+		return err
+	}
+	if !m.IsConstant() {
+		return fmt.Errorf("%s is %s; the console only calls view and pure functions", m.Sig, m.StateMutability)
+	}
+	if args, err = c.resolveArgs(ctx, m.Inputs, args); err != nil {
+		return err
+	}
+	params, err := convertArgs(m.RawName, m.Inputs, args)
+	if err != nil {
+		return err
+	}
+	packed, err := m.Inputs.Pack(params...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", m.Sig, err)
+	}
+	values, err := bc.call(ctx, c.block, m, append(m.ID, packed...))
+	if err != nil {
+		return err
+	}
+	fprintOutputs(c.out, m.Outputs, values)
+	return nil
+}
+
+// contract binds the deployment name with its recorded ABI, once.
+func (c *console) contract(ctx context.Context, name string) (*boundContract, error) {
+	if bc, ok := c.bound[name]; ok {
+		return bc, nil
+	}
+	if _, err := c.reg.lookup(name); err != nil {
+		return nil, err
+	}
+	bc, err := bindContract(ctx, c.client, c.reg, c.root, name, "")
+	if err != nil {
+		return nil, err
+	}
+	c.bound[name] = bc
+	return bc, nil
+}
+
+// consoleMethod picks the method called as name with n arguments, telling
+// overloads apart by their argument count. An ABI key such as transfer0
+// picks an overload directly.
+func consoleMethod(contract abi.ABI, deployment, name string, n int) (abi.Method, error) {
+	if m, ok := contract.Methods[name]; ok && (len(m.Inputs) == n || m.RawName != name) {
+		return m, nil
+	}
+	var same, other []abi.Method
+	for _, key := range sortedKeys(contract.Methods) {
+		m := contract.Methods[key]
+		if m.RawName != name {
+			continue
+		}
+		if len(m.Inputs) == n {
+			same = append(same, m)
+		} else {
+			other = append(other, m)
+		}
+	}
+	switch {
+	case len(same) == 1:
+		return same[0], nil
+	case len(same) > 1:
+		sigs := make([]string, len(same))
+		for i, m := range same {
+			sigs[i] = m.Sig
+		}
+		return abi.Method{}, fmt.Errorf("%s.%s is overloaded (%s); call it by its ABI key, e.g. %s.%s", deployment, name, strings.Join(sigs, ", "), deployment, consoleKey(contract, same[1]))
+	case len(other) > 0:
+		return abi.Method{}, fmt.Errorf("%s takes %d arguments, got %d", signature(name, other[0].Inputs), len(other[0].Inputs), n)
+	}
+	return abi.Method{}, fmt.Errorf("%s has no method %s; type help %s to list them", deployment, name, deployment)
+}
+
+// consoleKey returns the ABI key of m, which names overloads apart.
+func consoleKey(contract abi.ABI, m abi.Method) string {
+	for key, other := range contract.Methods {
+		if other.Sig == m.Sig {
+			return key
+		}
+	}
+	return m.Name
+}
+
+// resolveArgs replaces deployment names given for address inputs, alone or
+// in lists, with their addresses, then ENS names.
+func (c *console) resolveArgs(ctx context.Context, inputs abi.Arguments, args []interface{}) ([]interface{}, error) {
+	if len(args) != len(inputs) {
+		// convertArgs reports the mismatch.
+		return args, nil
+	}
+	out := make([]interface{}, len(args))
+	for i, in := range inputs {
+		out[i] = c.registryValue(in.Type, args[i])
+	}
+	return c.ens.resolveArgs(ctx, inputs, out, nil)
+}
+
+func (c *console) registryValue(t abi.Type, v interface{}) interface{} {
+	switch t.T {
+	case abi.AddressTy:
+		if s, ok := v.(string); ok {
+			if e, ok := c.reg.Contracts[s]; ok {
+				return e.Address.Hex()
+			}
+		}
+	case abi.SliceTy, abi.ArrayTy:
+		if list, ok := v.([]interface{}); ok {
+			out := make([]interface{}, len(list))
+			for i, elem := range list {
+				out[i] = c.registryValue(*t.Elem, elem)
+			}
+			return out
+		}
+	}
+	return v
+}
+
+// address resolves a console argument to an address: hex, a deployment
+// name or an ENS name.
+func (c *console) address(ctx context.Context, v interface{}) (common.Address, error) {
+	s, ok := v.(string)
+	if !ok {
+		return common.Address{}, fmt.Errorf("%v is not an address", v)
+	}
+	if e, ok := c.reg.Contracts[s]; ok {
+		return e.Address, nil
+	}
+	return c.ens.resolveAddressArg(ctx, s)
+}
+
+// eth answers the chain queries in ethFunctions.
+func (c *console) eth(ctx context.Context, name string, args []interface{}) error {
+	known := false
+	for _, f := range ethFunctions {
+		if f.name != name {
+			continue
+		}
+		if len(args) != f.args {
+			return fmt.Errorf("%s takes %d arguments, got %d", f.usage, f.args, len(args))
+		}
+		known = true
+	}
+	if !known {
+		return fmt.Errorf("unknown function eth.%s; type help to list them", name)
+	}
+	switch name {
+	case "blockNumber":
+		n, err := c.client.BlockNumber(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.out, n)
+		return nil
+	case "chainId":
+		id, err := c.client.ChainID(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.out, id)
+		return nil
+	case "gasPrice":
+		price, err := c.client.SuggestGasPrice(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "%s wei (%s gwei)\n", price, formatUnits(price, 9))
+		return nil
+	}
+
+	addr, err := c.address(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	switch name {
+	case "getBalance":
+		wei, err := c.client.BalanceAt(ctx, addr, c.block)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "%s wei (%s)\n", wei, formatEther(wei))
+	case "getCode":
+		code, err := c.client.CodeAt(ctx, addr, c.block)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.out, hexutil.Encode(code))
+	case "getTransactionCount":
+		nonce, err := c.client.NonceAt(ctx, addr, c.block)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.out, nonce)
+	case "getStorageAt":
+		slot, err := toBigInt(args[1])
+		if err != nil {
+			return fmt.Errorf("slot: %w", err)
+		}
+		word, err := c.client.StorageAt(ctx, addr, common.BigToHash(slot), c.block)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.out, hexutil.Encode(word))
+	}
+	return nil
+}
+
+func (c *console) help() {
+	fmt.Fprint(c.out, `Expressions:
+  Name                      address of a deployment in the registry
+  Name.method(args...)      call a view or pure function and decode the result
+  eth.function(args...)     query the chain
+Arguments are numbers (decimal or 0x hex), addresses, deployment names,
+ENS names, "strings", true/false and [lists]. Commands:
+  contracts                 list the deployments
+  help Name                 list a deployment's view functions
+  exit                      leave (or Ctrl-D)
+Chain functions:
+`)
+	for _, f := range ethFunctions {
+		fmt.Fprintf(c.out, "  %s\n", f.usage)
+	}
+}
+
+func (c *console) contracts() {
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tADDRESS\tCONTRACT")
+	for _, name := range c.reg.names() {
+		e := c.reg.Contracts[name]
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", name, e.Address.Hex(), e.Contract)
+	}
+	tw.Flush()
+}
+
+// methods lists the view and pure functions the deployment name has.
+func (c *console) methods(ctx context.Context, name string) error {
+	bc, err := c.contract(ctx, name)
+	if err != nil {
+		return err
+	}
+	var lines []string
+	for key, m := range bc.ABI.Methods {
+		if !m.IsConstant() {
+			continue
+		}
+		line := signature(key, m.Inputs)
+		if len(m.Outputs) > 0 {
+			line += " returns " + signature("", m.Outputs)
+		}
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+	for _, line := range lines {
+		fmt.Fprintf(c.out, "  %s.%s\n", name, line)
+	}
+	if len(lines) == 0 {
+		fmt.Fprintf(c.out, "%s has no view functions\n", name)
+	}
+	return nil
+}
+
+// complete completes deployment and method names on tab.
+func (c *console) complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' || pos != len(line) {
+		return "", 0, false
+	}
+	start := strings.LastIndexAny(line, " ([,") + 1
+	word := line[start:]
+	var candidates []string
+	if target, prefix, ok := strings.Cut(word, "."); ok {
+		if target == "eth" {
+			for _, f := range ethFunctions {
+				candidates = append(candidates, "eth."+f.name+"(")
+			}
+		} else if bc, err := c.contract(context.Background(), target); err == nil {
+			for key, m := range bc.ABI.Methods {
+				if m.IsConstant() {
+					candidates = append(candidates, target+"."+key+"(")
+				}
+			}
+		}
+		word = target + "." + prefix
+	} else {
+		candidates = append(c.reg.names(), "eth.")
+	}
+	var matches []string
+	for _, cand := range candidates {
+		if strings.HasPrefix(cand, word) {
+			matches = append(matches, cand)
+		}
+	}
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+	completion := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, completion) {
+			completion = completion[:len(completion)-1]
+		}
+	}
+	line = line[:start] + completion
+	return line, len(line), true
+}
+
+// parseConsoleArgs splits a console argument list at its top-level commas.
+func parseConsoleArgs(s string) ([]interface{}, error) {
+	parts, err := splitConsoleList(s)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]interface{}, len(parts))
+	for i, part := range parts {
+		if args[i], err = parseConsoleValue(part); err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+// parseConsoleValue parses one argument: a [list], a quoted string, a bool,
+// or a bare word such as a number, address or name, kept as a string for
+// convertArgs to interpret by the parameter's type.
+func parseConsoleValue(s string) (interface{}, error) {
+	switch {
+	case s == "":
+		return nil, errors.New("empty argument")
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("unterminated list %s", s)
+		}
+		list, err := parseConsoleArgs(s[1 : len(s)-1])
+		if list == nil && err == nil {
+			list = []interface{}{}
+		}
+		return list, err
+	case strings.HasPrefix(s, `"`):
+		var str string
+		if err := json.Unmarshal([]byte(s), &str); err != nil {
+			return nil, fmt.Errorf("bad string %s: %w", s, err)
+		}
+		return str, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return nil, fmt.Errorf("unterminated string %s", s)
+		}
+		return s[1 : len(s)-1], nil
+	case s == "true" || s == "false":
+		return s == "true", nil
+	}
+	return s, nil
+}
+
+// splitConsoleList splits s at commas outside brackets and quotes, trimming
+// the parts. An empty s has no parts.
+func splitConsoleList(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '[' || ch == '(':
+			depth++
+		case ch == ']' || ch == ')':
+			if depth--; depth < 0 {
+				return nil, fmt.Errorf("unbalanced %q in %s", ch, s)
+			}
+		case ch == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if quote != 0 || depth != 0 {
+		return nil, fmt.Errorf("unterminated argument list %s", s)
+	}
+	return append(parts, strings.TrimSpace(s[start:])), nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// boundContract is a deployed contract together with its ABI, so methods
+// can be called by name with loosely typed arguments.
+type boundContract struct {
+	Address common.Address
+	ABI     abi.ABI
+	client  *ethclient.Client
+}
+
+// bindContract resolves to, a hex address, ENS name, registry name or
+// address book label, to a contract.
+// The ABI comes from the artifact contractRef if given, else from the
+// registry entry.
+func bindContract(ctx context.Context, client *ethclient.Client, reg *registry, root, to, contractRef string) (*boundContract, error) {
+	c := &boundContract{client: client}
+	var entry *registryEntry
+	switch {
+	case strings.HasPrefix(to, "0x"):
+		addr, err := parseAddress(to)
+		if err != nil {
+			return nil, err
+		}
+		c.Address = addr
+	case isENSName(to):
+		addr, err := newENSResolver(client, ensRegistryAddress).resolve(ctx, to)
+		if err != nil {
+			return nil, err
+		}
+		c.Address = addr
+	default:
+		book, err := loadAddressBook(root, reg.Network)
+		if err != nil {
+			return nil, err
+		}
+		if c.Address, entry, err = lookupName(reg, book, to); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case contractRef != "":
+		art, err := loadArtifact(root, contractRef)
+		if err != nil {
+			return nil, err
+		}
+		c.ABI = art.ABI
+	case entry != nil && len(entry.ABI) > 0:
+		parsed, err := abi.JSON(bytes.NewReader(entry.ABI))
+		if err != nil {
+			return nil, fmt.Errorf("%s: parse recorded ABI: %w", to, err)
+		}
+		c.ABI = parsed
+	default:
+		return nil, errors.New("-contract is required to call an address that is not in the registry")
+	}
+	return c, nil
+}
+
+// Call runs a read-only call of method and decodes its return values.
+func (c *boundContract) Call(ctx context.Context, method string, args ...interface{}) ([]interface{}, error) {
+	return c.CallAt(ctx, nil, method, args...)
+}
+
+// CallAt is Call against a past block; a nil block means latest.
+func (c *boundContract) CallAt(ctx context.Context, block *big.Int, method string, args ...interface{}) ([]interface{}, error) {
+	m, err := findMethod(c.ABI, method)
+	if err != nil {
+		return nil, err
+	}
+	data, err := encodeCall(c.ABI, method, args)
+	if err != nil {
+		return nil, err
+	}
+	return c.call(ctx, block, m, data)
+}
+
+func (c *boundContract) call(ctx context.Context, block *big.Int, m abi.Method, data []byte) ([]interface{}, error) {
+	out, err := c.client.CallContract(ctx, ethereum.CallMsg{To: &c.Address, Data: data}, block)
+	if err != nil {
+		return nil, &callError{sig: m.Sig, reason: revertReason(err, c.ABI), err: reverted(err)}
+	}
+	if len(out) == 0 && len(m.Outputs) > 0 {
+		return nil, fmt.Errorf("%s returned no data; is %s a contract with this method?", m.Sig, c.Address.Hex())
+	}
+	values, err := m.Outputs.Unpack(out)
+	if err != nil {
+		return nil, fmt.Errorf("%s: decode result: %w", m.Sig, err)
+	}
+	return values, nil
+}
+
+// Send calls method in a transaction from the run's signer.
+func (c *boundContract) Send(ctx context.Context, r *networkRun, method string, args ...interface{}) (*sentTx, error) {
+	return c.SendValue(ctx, r, nil, method, args...)
+}
+
+// SendValue is Send with value attached, for payable methods.
+func (c *boundContract) SendValue(ctx context.Context, r *networkRun, value *big.Int, method string, args ...interface{}) (*sentTx, error) {
+	data, err := encodeCall(c.ABI, method, args)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(ctx, r, value, data)
+}
+
+// callMethod is Call for generated bindings: method is the method's key in
+// the ABI, and args already have the Go types abi.Pack expects.
+func (c *boundContract) callMethod(ctx context.Context, method string, args ...interface{}) ([]interface{}, error) {
+	m, ok := c.ABI.Methods[method]
+	if !ok {
+		return nil, fmt.Errorf("no method %q in ABI", method)
+	}
+	data, err := c.ABI.Pack(method, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", m.Sig, err)
+	}
+	return c.call(ctx, nil, m, data)
+}
+
+// sendMethod is SendValue for generated bindings.
+func (c *boundContract) sendMethod(ctx context.Context, r *networkRun, value *big.Int, method string, args ...interface{}) (*sentTx, error) {
+	data, err := c.ABI.Pack(method, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", method, err)
+	}
+	return c.send(ctx, r, value, data)
+}
+
+func (c *boundContract) send(ctx context.Context, r *networkRun, value *big.Int, data []byte) (*sentTx, error) {
+	return c.transact(ctx, r, txFields{Value: value, Data: data})
+}
+
+// transact sends fields to the contract, explaining reverts with its ABI.
+func (c *boundContract) transact(ctx context.Context, r *networkRun, fields txFields) (*sentTx, error) {
+	fields.To, fields.Label = &c.Address, describeCall(c.ABI, fields.Data, r.book)
+	sent, err := r.transact(ctx, fields, gasConfig{})
+	if err != nil && sent != nil && sent.Reverted {
+		err = r.explainRevert(err, c.ABI, fields.Data)
+	}
+	return sent, err
+}
+
+// formatValue renders a decoded ABI value for the terminal: hex for
+// addresses and bytes, decimal for integers, brackets for lists and
+// parentheses for tuples.
+func formatValue(v interface{}) string {
+	return formatValueWith(v, common.Address.Hex)
+}
+
+// formatValueWith is formatValue with addresses rendered by address.
+func formatValueWith(v interface{}, address func(common.Address) string) string {
+	switch v := v.(type) {
+	case common.Address:
+		return address(v)
+	case common.Hash:
+		return v.Hex()
+	case []byte:
+		return hexutil.Encode(v)
+	case *big.Int:
+		return v.String()
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+			return hexutil.Encode(b)
+		}
+		fallthrough
+	case reflect.Slice:
+		items := make([]string, rv.Len())
+		for i := range items {
+			items[i] = formatValueWith(rv.Index(i).Interface(), address)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case reflect.Struct:
+		fields := make([]string, rv.NumField())
+		for i := range fields {
+			fields[i] = formatValueWith(rv.Field(i).Interface(), address)
+		}
+		return "(" + strings.Join(fields, ", ") + ")"
+	}
+	return fmt.Sprint(v)
+}
+
+// printOutputs prints values decoded from outputs, one per line, labelled
+// with the output names where the ABI has them.
+func printOutputs(outputs abi.Arguments, values []interface{}) {
+	fprintOutputs(os.Stdout, outputs, values)
+}
+
+func fprintOutputs(w io.Writer, outputs abi.Arguments, values []interface{}) {
+	for i, v := range values {
+		if len(values) > 1 || outputs[i].Name != "" {
+			label := outputs[i].Name
+			if label == "" {
+				label = fmt.Sprint(i)
+			}
+			fmt.Fprintf(w, "%s: %s\n", label, formatValue(v))
+			continue
+		}
+		fmt.Fprintln(w, formatValue(v))
+	}
+}
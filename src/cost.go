@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// priceConfig prices a run's gas in fiat for its cost report:
+//
+//	prices:
+//	  currencies: [usd, eur]
+//	  source: coingecko                  # or chainlink
+//	  apiKey: ${secret:env:COINGECKO_API_KEY}
+//
+// Chainlink feeds are read from Ethereum mainnet through rpc; feeds maps a
+// currency to an aggregator quoting the native token in it.
+type priceConfig struct {
+	Currencies []string `yaml:"currencies"`
+	Source     string   `yaml:"source"`
+	// Coin is the CoinGecko id of the native token; it defaults by chain.
+	Coin   string            `yaml:"coin"`
+	APIKey string            `yaml:"apiKey"`
+	RPC    string            `yaml:"rpc"`
+	Feeds  map[string]string `yaml:"feeds"`
+}
+
+const (
+	priceCoinGecko = "coingecko"
+	priceChainlink = "chainlink"
+
+	priceTimeout = 15 * time.Second
+	// chainlinkStaleAfter flags feeds that have not updated in a day.
+	chainlinkStaleAfter = 24 * time.Hour
+)
+
+const coinGeckoURL = "https://api.coingecko.com/api/v3/simple/price"
+
+// nativeCoins are the CoinGecko ids of native tokens other than ether, by
+// chain id.
+var nativeCoins = map[uint64]string{
+	56:    "binancecoin",
+	137:   "polygon-ecosystem-token",
+	43114: "avalanche-2",
+	100:   "xdai",
+}
+
+// chainlinkFeeds are Ethereum mainnet aggregators for ETH prices. EUR has
+// no direct ETH feed, so it is ETH/USD divided by EUR/USD.
+var chainlinkFeeds = map[string][]common.Address{
+	"usd": {common.HexToAddress("0x5f4eC3Df9cbd43714FE2740f5E3616155c5b8419")},
+	"eur": {common.HexToAddress("0x5f4eC3Df9cbd43714FE2740f5E3616155c5b8419"), common.HexToAddress("0xb49f677943BC038e9857d61E7d053CaA2C1734C1")},
+}
+
+var aggregatorABI = mustParseABI(`[
+	{"type":"function","name":"decimals","inputs":[],"outputs":[{"type":"uint8"}],"stateMutability":"view"},
+	{"type":"function","name":"latestRoundData","inputs":[],"outputs":[{"name":"roundId","type":"uint80"},{"name":"answer","type":"int256"},{"name":"startedAt","type":"uint256"},{"name":"updatedAt","type":"uint256"},{"name":"answeredInRound","type":"uint80"}],"stateMutability":"view"}
+]`)
+
+func (c *priceConfig) validate() error {
+	switch c.Source {
+	case "", priceCoinGecko:
+	case priceChainlink:
+		if c.RPC == "" {
+			return fmt.Errorf("chainlink prices need rpc, an Ethereum mainnet endpoint")
+		}
+		for cur := range c.Feeds {
+			if _, err := parseAddress(c.Feeds[cur]); err != nil {
+				return fmt.Errorf("feeds: %s: %w", cur, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown price source %q (want coingecko or chainlink)", c.Source)
+	}
+	if len(c.Currencies) == 0 {
+		return fmt.Errorf("currencies is required")
+	}
+	return nil
+}
+
+// coin returns the CoinGecko id of chainID's native token.
+func (c *priceConfig) coin(chainID uint64) string {
+	if c.Coin != "" {
+		return c.Coin
+	}
+	if coin, ok := nativeCoins[chainID]; ok {
+		return coin
+	}
+	return "ethereum"
+}
+
+// tokenPrices are native token prices as coin -> currency -> price.
+type tokenPrices map[string]map[string]*big.Rat
+
+// fetchPrices looks up the price of each coin in the configured
+// currencies.
+func (c *priceConfig) fetchPrices(ctx context.Context, coins []string) (tokenPrices, error) {
+	ctx, cancel := context.WithTimeout(ctx, priceTimeout)
+	defer cancel()
+	if c.Source == priceChainlink {
+		return c.chainlinkPrices(ctx, coins)
+	}
+	q := url.Values{"ids": {strings.Join(coins, ",")}, "vs_currencies": {strings.Join(c.Currencies, ",")}, "precision": {"full"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, coinGeckoURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.APIKey != "" {
+		req.Header.Set("x-cg-demo-api-key", c.APIKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("coingecko: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var raw map[string]map[string]json.Number
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("coingecko: %w", err)
+	}
+	prices := tokenPrices{}
+	for coin, quotes := range raw {
+		prices[coin] = map[string]*big.Rat{}
+		for cur, n := range quotes {
+			if p, ok := new(big.Rat).SetString(n.String()); ok {
+				prices[coin][cur] = p
+			}
+		}
+	}
+	return prices, nil
+}
+
+// chainlinkPrices reads ETH prices from Chainlink aggregators. Only ether
+// can be priced this way.
+func (c *priceConfig) chainlinkPrices(ctx context.Context, coins []string) (tokenPrices, error) {
+	for _, coin := range coins {
+		if coin != "ethereum" {
+			return nil, fmt.Errorf("chainlink prices cover ETH only, not %s; use coingecko", coin)
+		}
+	}
+	client, err := ethclient.DialContext(ctx, os.ExpandEnv(c.RPC))
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	quotes := map[string]*big.Rat{}
+	for _, cur := range c.Currencies {
+		feeds := chainlinkFeeds[cur]
+		if f, ok := c.Feeds[cur]; ok {
+			feeds = []common.Address{common.HexToAddress(f)}
+		}
+		if len(feeds) == 0 {
+			return nil, fmt.Errorf("no Chainlink feed for ETH/%s; set prices.feeds.%s", strings.ToUpper(cur), cur)
+		}
+		price, err := readFeed(ctx, client, feeds[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, divisor := range feeds[1:] {
+			d, err := readFeed(ctx, client, divisor)
+			if err != nil {
+				return nil, err
+			}
+			price.Quo(price, d)
+		}
+		quotes[cur] = price
+	}
+	return tokenPrices{"ethereum": quotes}, nil
+}
+
+// readFeed returns an aggregator's latest answer, scaled by its decimals.
+func readFeed(ctx context.Context, client *ethclient.Client, feed common.Address) (*big.Rat, error) {
+	c := &boundContract{Address: feed, ABI: aggregatorABI, client: client}
+	out, err := c.Call(ctx, "decimals")
+	if err != nil {
+		return nil, fmt.Errorf("chainlink feed %s: %w", feed.Hex(), err)
+	}
+	decimals := out[0].(uint8)
+	round, err := c.Call(ctx, "latestRoundData")
+	if err != nil {
+		return nil, fmt.Errorf("chainlink feed %s: %w", feed.Hex(), err)
+	}
+	answer, updated := round[1].(*big.Int), round[3].(*big.Int)
+	if answer.Sign() <= 0 {
+		return nil, fmt.Errorf("chainlink feed %s has no valid answer", feed.Hex())
+	}
+	if age := time.Since(time.Unix(updated.Int64(), 0)); age > chainlinkStaleAfter {
+		logger.Warn("Chainlink price is stale", "feed", feed, "age", age.Round(time.Minute))
+	}
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	return new(big.Rat).SetFrac(answer, scale), nil
+}
+
+// deploymentCost is what d paid for gas: gas used times the effective gas
+// price once mined, or at most its gas limit times the maximum fee in a dry
+// run. A rollup's L1 data fee is added.
+func deploymentCost(d deployment, dryRun bool) *big.Int {
+	switch {
+	case d.Skipped:
+		return new(big.Int)
+	case dryRun:
+		return d.Fees.maxCost(d.Gas)
+	case d.GasPrice != nil:
+		cost := new(big.Int).Mul(new(big.Int).SetUint64(d.GasUsed), d.GasPrice)
+		if d.L1Fee != nil {
+			cost.Add(cost, d.L1Fee)
+		}
+		return cost
+	}
+	return new(big.Int)
+}
+
+// l1Fee is the part of deploymentCost that paid for L1 data.
+func (d deployment) l1Fee(dryRun bool) *big.Int {
+	if dryRun {
+		return d.Fees.L1Fee
+	}
+	return d.L1Fee
+}
+
+// costReport is a run's gas spend, per contract and in total.
+type costReport struct {
+	Source     string        `json:"source"`
+	Currencies []string      `json:"currencies"`
+	Networks   []networkCost `json:"networks"`
+	// Total is the fiat total across networks, by currency.
+	Total map[string]string `json:"total"`
+}
+
+type networkCost struct {
+	Network   string            `json:"network"`
+	Coin      string            `json:"coin"`
+	Contracts []contractCost    `json:"contracts"`
+	TotalWei  string            `json:"totalWei"`
+	Total     map[string]string `json:"total"`
+}
+
+type contractCost struct {
+	Name     string `json:"name"`
+	GasUsed  uint64 `json:"gasUsed"`
+	GasPrice string `json:"gasPriceWei,omitempty"`
+	CostWei  string `json:"costWei"`
+	// L1FeeWei is the rollup L1 data fee included in CostWei.
+	L1FeeWei string            `json:"l1FeeWei,omitempty"`
+	Fiat     map[string]string `json:"fiat"`
+}
+
+// newCostReport prices the deployments in results. A failed price lookup
+// is only a warning, since the transactions were already paid for.
+func newCostReport(ctx context.Context, m *manifest, c *priceConfig, results []networkResult, dryRun bool) *costReport {
+	coins := map[string]bool{}
+	for _, r := range results {
+		coins[c.coin(m.Networks[r.Network].chainID(r.Network))] = true
+	}
+	source := c.Source
+	if source == "" {
+		source = priceCoinGecko
+	}
+	prices, err := c.fetchPrices(ctx, sortedKeys(coins))
+	if err != nil {
+		logger.Warn("Could not fetch prices; the cost report has no fiat amounts", "source", source, "err", err)
+		prices = tokenPrices{}
+	}
+
+	report := &costReport{Source: source, Currencies: c.Currencies, Total: map[string]string{}}
+	grand := map[string]*big.Rat{}
+	for _, r := range results {
+		coin := c.coin(m.Networks[r.Network].chainID(r.Network))
+		nc := networkCost{Network: r.Network, Coin: coin, Contracts: []contractCost{}, Total: map[string]string{}}
+		total := new(big.Int)
+		for _, d := range r.Deployments {
+			cost := deploymentCost(d, dryRun)
+			total.Add(total, cost)
+			cc := contractCost{Name: d.Name, GasUsed: d.GasUsed, CostWei: cost.String(), Fiat: fiatAmounts(cost, prices[coin], c.Currencies)}
+			if dryRun {
+				cc.GasUsed = d.Gas
+			}
+			if d.GasPrice != nil {
+				cc.GasPrice = d.GasPrice.String()
+			}
+			if fee := d.l1Fee(dryRun); fee != nil && !d.Skipped {
+				cc.L1FeeWei = fee.String()
+			}
+			nc.Contracts = append(nc.Contracts, cc)
+		}
+		nc.TotalWei = total.String()
+		nc.Total = fiatAmounts(total, prices[coin], c.Currencies)
+		for _, cur := range c.Currencies {
+			if p, ok := prices[coin][cur]; ok {
+				if grand[cur] == nil {
+					grand[cur] = new(big.Rat)
+				}
+				grand[cur].Add(grand[cur], weiValue(total, p))
+			}
+		}
+		report.Networks = append(report.Networks, nc)
+	}
+	for cur, v := range grand {
+		report.Total[cur] = v.FloatString(2)
+	}
+	return report
+}
+
+// weiValue converts wei to fiat at price per whole token.
+func weiValue(wei *big.Int, price *big.Rat) *big.Rat {
+	v := new(big.Rat).SetFrac(wei, big.NewInt(1e18))
+	return v.Mul(v, price)
+}
+
+func fiatAmounts(wei *big.Int, prices map[string]*big.Rat, currencies []string) map[string]string {
+	out := map[string]string{}
+	for _, cur := range currencies {
+		if p, ok := prices[cur]; ok {
+			out[cur] = weiValue(wei, p).FloatString(2)
+		}
+	}
+	return out
+}
+
+// print writes the report as a table, with a total per network and, for
+// several networks, overall.
+func (c *costReport) print(w io.Writer, dryRun bool) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	title := "COST"
+	if dryRun {
+		title = "MAX COST"
+	}
+	header := "NETWORK\tNAME\tGAS\t" + title
+	for _, cur := range c.Currencies {
+		header += "\t" + strings.ToUpper(cur)
+	}
+	fmt.Fprintln(tw, header)
+	row := func(network, name, gas string, wei string, fiat map[string]string) {
+		cost, _ := new(big.Int).SetString(wei, 10)
+		line := fmt.Sprintf("%s\t%s\t%s\t%s", network, name, gas, formatEther(cost))
+		for _, cur := range c.Currencies {
+			amount, ok := fiat[cur]
+			if !ok {
+				amount = "?"
+			}
+			line += "\t" + amount
+		}
+		fmt.Fprintln(tw, line)
+	}
+	for _, n := range c.Networks {
+		for _, cc := range n.Contracts {
+			row(n.Network, cc.Name, fmt.Sprint(cc.GasUsed), cc.CostWei, cc.Fiat)
+		}
+		row(n.Network, "TOTAL", "", n.TotalWei, n.Total)
+	}
+	if len(c.Networks) > 1 {
+		line := "ALL\tTOTAL\t\t-"
+		for _, cur := range c.Currencies {
+			amount, ok := c.Total[cur]
+			if !ok {
+				amount = "?"
+			}
+			line += "\t" + amount
+		}
+		fmt.Fprintln(tw, line)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "Prices from %s.\n", c.Source)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// defaultCreate2Factory is the deterministic deployment proxy that forge
+// and most tooling use; it exists at this address on nearly every chain.
+// Its calldata is the 32-byte salt followed by the init code.
+var defaultCreate2Factory = common.HexToAddress("0x4e59b44847b379578588920cA78FbF26c0B4956C")
+
+// parseSalt accepts a 0x-prefixed hex salt of up to 32 bytes (left-padded)
+// or any other string, which is hashed with keccak256.
+func parseSalt(s string) (common.Hash, error) {
+	if strings.HasPrefix(s, "0x") {
+		b, err := hexutil.Decode(s)
+		if err != nil {
+			return common.Hash{}, fmt.Errorf("invalid salt %q: %w", s, err)
+		}
+		if len(b) > common.HashLength {
+			return common.Hash{}, fmt.Errorf("salt %q is longer than 32 bytes", s)
+		}
+		return common.BytesToHash(b), nil
+	}
+	return crypto.Keccak256Hash([]byte(s)), nil
+}
+
+// create2Address predicts where factory deploys initCode with salt.
+func create2Address(factory common.Address, salt common.Hash, initCode []byte) common.Address {
+	return crypto.CreateAddress2(factory, salt, crypto.Keccak256(initCode))
+}
+
+// create2Factory returns the network's factory, checking once per run that
+// it is actually deployed.
+func (r *networkRun) create2Factory(ctx context.Context) (common.Address, error) {
+	r.mu.Lock()
+	checked := r.factoryChecked
+	r.mu.Unlock()
+	if checked {
+		return r.factory, nil
+	}
+	code, err := r.client.CodeAt(ctx, r.factory, nil)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if len(code) == 0 {
+		return common.Address{}, fmt.Errorf("no CREATE2 factory deployed at %s on %s", r.factory.Hex(), r.name)
+	}
+	r.mu.Lock()
+	r.factoryChecked = true
+	r.mu.Unlock()
+	return r.factory, nil
+}
+
+// existingCreate2 reports whether addr already holds art's runtime code,
+// ignoring the immutables the constructor filled in. Code that differs
+// means the address is occupied by something else.
+func (r *networkRun) existingCreate2(ctx context.Context, addr common.Address, art *artifact) (bool, error) {
+	code, err := r.client.CodeAt(ctx, addr, nil)
+	if err != nil {
+		return false, err
+	}
+	if len(code) == 0 {
+		return false, nil
+	}
+	if len(code) != len(art.DeployedBytecode) || !bytes.Equal(art.ImmutableReferences.zeroed(code), art.DeployedBytecode) {
+		return false, fmt.Errorf("%s already has code that does not match %s's runtime bytecode", addr.Hex(), art.Name)
+	}
+	logger.Info("Already deployed, skipping", "contract", art.Name, "address", addr)
+	return true, nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"slices"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	defaultDaemonPoll  = time.Minute
+	defaultDaemonRetry = 15 * time.Minute
+)
+
+// daemonConfig tunes execute -daemon.
+type daemonConfig struct {
+	poll  time.Duration
+	retry time.Duration
+	// maxBaseFee holds ready operations back while the base fee is above
+	// it; empty sends at any fee.
+	maxBaseFee string
+	notify     notifyConfig
+}
+
+func addDaemonFlags(fs *flag.FlagSet) *daemonConfig {
+	dc := &daemonConfig{}
+	fs.DurationVar(&dc.poll, "poll", defaultDaemonPoll, "with -daemon, how often to check the queue")
+	fs.DurationVar(&dc.retry, "retry", defaultDaemonRetry, "with -daemon, how long to wait before retrying an operation that failed")
+	fs.StringVar(&dc.maxBaseFee, "max-base-fee", "", "with -daemon, hold ready operations back while the base fee is above this (e.g. 30gwei)")
+	fs.StringVar(&dc.notify.URL, "notify", "", "with -daemon, also post executions and failures to this webhook, besides the manifest's notify")
+	fs.StringVar(&dc.notify.Format, "notify-format", "", "format of -notify: slack, discord or json (default)")
+	return dc
+}
+
+// opDaemon is the state of execute -daemon between rounds.
+type opDaemon struct {
+	run        *networkRun
+	cfg        *daemonConfig
+	hooks      []notifyConfig
+	maxBaseFee *big.Int
+	// retryAt holds failed operations back until the time; failed marks
+	// those whose failure was notified, so a retry failing again is not.
+	retryAt map[common.Hash]time.Time
+	failed  map[common.Hash]bool
+	// skipped are the operations already reported as cancelled or executed
+	// elsewhere; held is the base fee last reported holding them back.
+	skipped map[common.Hash]bool
+	held    *big.Int
+}
+
+// executeDaemon executes the network's queued operations as they become
+// ready, until ctx is cancelled. The queue is reread every round, so
+// operations scheduled meanwhile are picked up. The network's run lock is
+// only held while executing, leaving the network to schedule and other runs
+// in between.
+func (r *networkRun) executeDaemon(ctx context.Context, dc *daemonConfig) error {
+	if r.opts.DryRun {
+		return errors.New("-daemon cannot be combined with -dry-run")
+	}
+	if r.opts.Nonce != nil {
+		return errors.New("-daemon cannot be combined with -nonce; the daemon takes the signer's next nonce each round")
+	}
+	if dc.poll <= 0 || dc.retry <= 0 {
+		return errors.New("-poll and -retry must be positive")
+	}
+	d := &opDaemon{run: r, cfg: dc, hooks: slices.Clone(r.notify), retryAt: map[common.Hash]time.Time{}, failed: map[common.Hash]bool{}, skipped: map[common.Hash]bool{}}
+	if dc.notify.URL != "" {
+		if err := dc.notify.validate(); err != nil {
+			return fmt.Errorf("-notify: %w", err)
+		}
+		d.hooks = append(d.hooks, dc.notify)
+	}
+	if dc.maxBaseFee != "" {
+		var err error
+		if d.maxBaseFee, err = parseWei(dc.maxBaseFee); err != nil {
+			return fmt.Errorf("-max-base-fee: %w", err)
+		}
+		head, err := r.client.HeaderByNumber(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if head.BaseFee == nil {
+			return errors.New("-max-base-fee: the chain has no EIP-1559 base fee")
+		}
+	}
+	// The lock is taken again for each round that executes something.
+	if r.lock != nil {
+		r.lock.release()
+		r.lock = nil
+	}
+	logger.Info("Executing timelock operations as they become ready", "network", r.name, "signer", r.sender.Address(), "poll", dc.poll)
+
+	for {
+		wait, err := d.round(ctx)
+		if ctx.Err() != nil {
+			logger.Info("Stopping", "network", r.name)
+			return nil
+		}
+		if err != nil {
+			logger.Warn("Could not check the queue, trying again", "network", r.name, "err", err, "in", dc.poll)
+			wait = dc.poll
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			logger.Info("Stopping", "network", r.name)
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// round executes the operations that are ready and returns how long to
+// wait before the next round: the poll interval, or less if an operation
+// becomes ready sooner.
+func (d *opDaemon) round(ctx context.Context) (time.Duration, error) {
+	r := d.run
+	q, err := r.loadOpQueue()
+	if err != nil {
+		return 0, err
+	}
+	now, err := latestTimestamp(ctx, r)
+	if err != nil {
+		return 0, err
+	}
+	wait := d.cfg.poll
+	var ready []common.Hash
+	for _, id := range q.ids() {
+		op := q.Ops[id]
+		if op.ExecutedTx != nil || d.skipped[id] {
+			continue
+		}
+		if at, ok := d.retryAt[id]; ok && time.Now().Before(at) {
+			continue
+		}
+		ts, err := operationTimestamp(ctx, r.client, op.Timelock, id)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case ts == 0:
+			logger.Warn("Operation is not scheduled on its timelock, skipping it; it may have been cancelled", "network", r.name, "id", id, "call", op.Method)
+			d.skipped[id] = true
+		case ts == doneTimestamp:
+			logger.Info("Operation was executed by someone else, skipping it", "network", r.name, "id", id, "call", op.Method)
+			d.skipped[id] = true
+		case ts > now:
+			// Blocks can lag the clock, so check again a little after.
+			wait = min(wait, time.Duration(ts-now)*time.Second+5*time.Second)
+		default:
+			ready = append(ready, id)
+		}
+	}
+	if len(ready) == 0 {
+		return wait, nil
+	}
+	if d.maxBaseFee != nil {
+		head, err := r.client.HeaderByNumber(ctx, nil)
+		if err != nil {
+			return 0, err
+		}
+		if head.BaseFee.Cmp(d.maxBaseFee) > 0 {
+			if d.held == nil {
+				logger.Info("Base fee is above -max-base-fee, holding ready operations back", "network", r.name, "ready", len(ready), "baseFee", formatGwei(head.BaseFee), "max", formatGwei(d.maxBaseFee))
+			}
+			d.held = head.BaseFee
+			return d.cfg.poll, nil
+		}
+		d.held = nil
+	}
+
+	lock, err := acquireRunLock(r.records, r.name)
+	if err != nil {
+		logger.Warn("Network is in use, executing later", "network", r.name, "err", err, "in", d.cfg.poll)
+		return d.cfg.poll, nil
+	}
+	defer lock.release()
+	// Runs in between may have sent from the signer, or rewritten the queue.
+	if err := r.initNonce(ctx); err != nil {
+		return 0, err
+	}
+	if q, err = r.loadOpQueue(); err != nil {
+		return 0, err
+	}
+	for _, id := range ready {
+		op := q.Ops[id]
+		if op == nil || op.ExecutedTx != nil {
+			continue
+		}
+		sent, err := r.executeOp(ctx, id, op)
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		if err != nil {
+			logger.Error("Could not execute operation, retrying later", "network", r.name, "id", id, "call", op.Method, "err", err, "in", d.cfg.retry)
+			d.retryAt[id] = time.Now().Add(d.cfg.retry)
+			if !d.failed[id] {
+				d.failed[id] = true
+				notify(context.WithoutCancel(ctx), d.hooks, operationEvent(r, id, op, nil, err))
+			}
+			continue
+		}
+		op.ExecutedTx = &sent.Hash
+		if err := q.save(); err != nil {
+			return 0, fmt.Errorf("record execution: %w", err)
+		}
+		delete(d.retryAt, id)
+		delete(d.failed, id)
+		logger.Info("Executed operation", "network", r.name, "id", id, "call", op.Method, "tx", sent.Hash)
+		notify(context.WithoutCancel(ctx), d.hooks, operationEvent(r, id, op, sent, nil))
+	}
+	return wait, nil
+}
+
+// operationEvent is the notification about executing a timelock operation.
+func operationEvent(r *networkRun, id common.Hash, op *timelockOp, sent *sentTx, err error) deployEvent {
+	e := deployEvent{Event: eventExecuted, Network: r.name, ChainID: r.chainID.Uint64(), Operation: &operationNotice{
+		ID:       id.Hex(),
+		Timelock: r.book.annotate(op.Timelock),
+		Target:   r.book.annotate(op.Target),
+		Call:     op.Method,
+	}}
+	if err != nil {
+		e.Event, e.Error = eventFailed, err.Error()
+		return e
+	}
+	e.Operation.Tx = sent.Hash.Hex()
+	e.Operation.URL = r.site.tx(sent.Hash)
+	return e
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// default4byteURL is the public selector database decode falls back to for
+// selectors no known ABI has.
+const default4byteURL = "https://www.4byte.directory"
+
+// maxDecodeDepth bounds how deep decode follows calls carried inside calls.
+const maxDecodeDepth = 5
+
+// Standard calls the CLI does not send itself, but decode recognizes.
+var (
+	safeExecABI        = mustParseABI(`[{"type":"function","name":"execTransaction","inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"},{"name":"data","type":"bytes"},{"name":"operation","type":"uint8"},{"name":"safeTxGas","type":"uint256"},{"name":"baseGas","type":"uint256"},{"name":"gasPrice","type":"uint256"},{"name":"gasToken","type":"address"},{"name":"refundReceiver","type":"address"},{"name":"signatures","type":"bytes"}],"outputs":[{"name":"success","type":"bool"}],"stateMutability":"payable"}]`)
+	multicall3ExtraABI = mustParseABI(`[
+		{"type":"function","name":"aggregate","inputs":[{"name":"calls","type":"tuple[]","components":[{"name":"target","type":"address"},{"name":"callData","type":"bytes"}]}],"outputs":[],"stateMutability":"payable"},
+		{"type":"function","name":"aggregate3","inputs":[{"name":"calls","type":"tuple[]","components":[{"name":"target","type":"address"},{"name":"allowFailure","type":"bool"},{"name":"callData","type":"bytes"}]}],"outputs":[],"stateMutability":"payable"}
+	]`)
+	tokenTransferABI = mustParseABI(`[
+		{"type":"function","name":"transfer","inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"}],"outputs":[{"type":"bool"}],"stateMutability":"nonpayable"},
+		{"type":"function","name":"transferFrom","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"value","type":"uint256"}],"outputs":[{"type":"bool"}],"stateMutability":"nonpayable"}
+	]`)
+)
+
+type namedABI struct {
+	source string
+	abi    abi.ABI
+}
+
+// decodeABIs are the standard ABIs decode knows besides the project's,
+// including those of the calls that carry other calls, which it unpacks:
+// Safe's execTransaction, MultiSend, Multicall3, the timelock and proxy
+// upgrades.
+var decodeABIs = []namedABI{
+	{"Safe", safeExecABI},
+	{"MultiSend", multiSendABI},
+	{"Multicall3", multicall3ABI},
+	{"Multicall3", multicall3ExtraABI},
+	{"TimelockController", timelockABI},
+	{"ERC-20", erc20ABI},
+	{"ERC-20", tokenTransferABI},
+	{"UUPS proxy", uupsABI},
+	{"ProxyAdmin", proxyAdminABI},
+}
+
+// decodedCall is calldata decoded into its method and arguments, with the
+// calls it carries.
+type decodedCall struct {
+	To *common.Address `json:"to,omitempty"`
+	// Name is the registry name or address book label of To.
+	Name  string   `json:"name,omitempty"`
+	Value *big.Int `json:"value,omitempty"`
+	// Operation is set for calls made by delegatecall.
+	Operation string        `json:"operation,omitempty"`
+	Selector  string        `json:"selector,omitempty"`
+	Signature string        `json:"signature,omitempty"`
+	Source    string        `json:"source,omitempty"`
+	Args      []decodedArg  `json:"args,omitempty"`
+	Calls     []decodedCall `json:"calls,omitempty"`
+	// Data is the calldata when it could not be decoded.
+	Data  hexutil.Bytes `json:"data,omitempty"`
+	Error string        `json:"error,omitempty"`
+}
+
+type decodedArg struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// calldataDecoder decodes calldata against, in order, the ABI recorded for
+// the target, the rest of the registry's, the project's artifacts and the
+// standard ones, then asks the selector database.
+type calldataDecoder struct {
+	reg      *registry
+	book     *addressBook
+	abis     []namedABI
+	fourByte string
+	http     *http.Client
+	// signatures caches selector database answers.
+	signatures map[string][]string
+}
+
+func newCalldataDecoder(reg *registry, book *addressBook, root, fourByte string) *calldataDecoder {
+	d := &calldataDecoder{reg: reg, book: book, fourByte: strings.TrimSuffix(fourByte, "/"), http: &http.Client{Timeout: 30 * time.Second}, signatures: map[string][]string{}}
+	for _, name := range reg.names() {
+		if parsed, err := abi.JSON(bytes.NewReader(reg.Contracts[name].ABI)); err == nil {
+			d.abis = append(d.abis, namedABI{"registry " + name, parsed})
+		}
+	}
+	for _, parsed := range projectABIs(root) {
+		d.abis = append(d.abis, namedABI{"project artifact", parsed})
+	}
+	d.abis = append(d.abis, decodeABIs...)
+	return d
+}
+
+func (d *calldataDecoder) decode(ctx context.Context, to *common.Address, value *big.Int, data []byte, depth int) decodedCall {
+	call := decodedCall{To: to, Value: value}
+	if to != nil {
+		if name, _ := d.reg.byAddress(*to); name != "" {
+			call.Name = name
+		} else if label := d.book.annotate(*to); label != to.Hex() {
+			call.Name = strings.TrimSuffix(label, "@"+to.Hex())
+		}
+	}
+	if len(data) == 0 {
+		call.Signature = "(no calldata)"
+		return call
+	}
+	if len(data) < 4 {
+		call.Data, call.Error = data, "calldata shorter than a selector"
+		return call
+	}
+	call.Selector = hexutil.Encode(data[:4])
+	method, values, source, err := d.method(ctx, to, data)
+	if err != nil {
+		call.Data, call.Error = data, err.Error()
+		return call
+	}
+	call.Signature, call.Source = method.Sig, source
+	for i, in := range method.Inputs {
+		name := in.Name
+		if name == "" {
+			name = fmt.Sprintf("arg%d", i)
+		}
+		call.Args = append(call.Args, decodedArg{Name: name, Type: in.Type.String(), Value: d.book.format(values[i])})
+	}
+	if depth < maxDecodeDepth {
+		call.Calls = d.inner(ctx, to, method, values, depth+1)
+	}
+	return call
+}
+
+// method finds the method data calls and decodes its arguments.
+func (d *calldataDecoder) method(ctx context.Context, to *common.Address, data []byte) (*abi.Method, []interface{}, string, error) {
+	candidates := d.abis
+	if to != nil {
+		if name, e := d.reg.byAddress(*to); e != nil {
+			if parsed, err := abi.JSON(bytes.NewReader(e.ABI)); err == nil {
+				candidates = append([]namedABI{{"registry " + name, parsed}}, candidates...)
+			}
+		}
+	}
+	for _, c := range candidates {
+		m, err := c.abi.MethodById(data[:4])
+		if err != nil {
+			continue
+		}
+		if values, err := m.Inputs.Unpack(data[4:]); err == nil {
+			return m, values, c.source, nil
+		}
+	}
+	if d.fourByte == "" {
+		return nil, nil, "", fmt.Errorf("unknown selector %s", hexutil.Encode(data[:4]))
+	}
+	signatures, err := d.lookup(ctx, hexutil.Encode(data[:4]))
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("unknown selector %s, and the selector database failed: %w", hexutil.Encode(data[:4]), err)
+	}
+	// Signatures share selectors, so only one whose encoding reproduces the
+	// calldata exactly is taken.
+	for _, sig := range signatures {
+		m, err := methodFromSignature(sig)
+		if err != nil {
+			continue
+		}
+		values, err := m.Inputs.Unpack(data[4:])
+		if err != nil {
+			continue
+		}
+		if packed, err := m.Inputs.Pack(values...); err == nil && bytes.Equal(packed, data[4:]) {
+			return &m, values, "4byte", nil
+		}
+	}
+	return nil, nil, "", fmt.Errorf("unknown selector %s", hexutil.Encode(data[:4]))
+}
+
+// lookup asks the selector database for the signatures with selector, the
+// earliest registered first, as later ones are more often collisions.
+func (d *calldataDecoder) lookup(ctx context.Context, selector string) ([]string, error) {
+	if sigs, ok := d.signatures[selector]; ok {
+		return sigs, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.fourByte+"/api/v1/signatures/?hex_signature="+url.QueryEscape(selector), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	var page struct {
+		Results []struct {
+			ID        int    `json:"id"`
+			Signature string `json:"text_signature"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, err
+	}
+	sort.Slice(page.Results, func(i, j int) bool { return page.Results[i].ID < page.Results[j].ID })
+	sigs := make([]string, len(page.Results))
+	for i, r := range page.Results {
+		sigs[i] = r.Signature
+	}
+	d.signatures[selector] = sigs
+	return sigs, nil
+}
+
+// inner decodes the calls that a call to a Safe, MultiSend, Multicall3,
+// timelock or proxy carries in its arguments.
+func (d *calldataDecoder) inner(ctx context.Context, to *common.Address, m *abi.Method, values []interface{}, depth int) []decodedCall {
+	switch m.Sig {
+	case "execTransaction(address,uint256,bytes,uint8,uint256,uint256,uint256,address,address,bytes)":
+		target := values[0].(common.Address)
+		call := d.decode(ctx, &target, values[1].(*big.Int), values[2].([]byte), depth)
+		if values[3].(uint8) == safeOpDelegateCall {
+			call.Operation = "delegatecall"
+		}
+		return []decodedCall{call}
+	case "multiSend(bytes)":
+		calls, err := d.multiSend(ctx, values[0].([]byte), depth)
+		if err != nil {
+			return []decodedCall{{Error: err.Error()}}
+		}
+		return calls
+	case "aggregate((address,bytes)[])", "aggregate3((address,bool,bytes)[])", "aggregate3Value((address,bool,uint256,bytes)[])":
+		rv := reflect.ValueOf(values[0])
+		calls := make([]decodedCall, rv.Len())
+		for i := range calls {
+			entry := rv.Index(i)
+			target := entry.FieldByName("Target").Interface().(common.Address)
+			value := new(big.Int)
+			if f := entry.FieldByName("Value"); f.IsValid() {
+				value = f.Interface().(*big.Int)
+			}
+			calls[i] = d.decode(ctx, &target, value, entry.FieldByName("CallData").Interface().([]byte), depth)
+		}
+		return calls
+	case "schedule(address,uint256,bytes,bytes32,bytes32,uint256)", "execute(address,uint256,bytes,bytes32,bytes32)":
+		target := values[0].(common.Address)
+		return []decodedCall{d.decode(ctx, &target, values[1].(*big.Int), values[2].([]byte), depth)}
+	case "upgradeToAndCall(address,bytes)":
+		if data := values[1].([]byte); len(data) > 0 {
+			return []decodedCall{d.decode(ctx, to, nil, data, depth)}
+		}
+	case "upgradeAndCall(address,address,bytes)":
+		if data := values[2].([]byte); len(data) > 0 {
+			proxy := values[0].(common.Address)
+			return []decodedCall{d.decode(ctx, &proxy, nil, data, depth)}
+		}
+	}
+	return nil
+}
+
+// multiSend unpacks MultiSend's transactions: each an operation byte, a
+// 20-byte target, a 32-byte value, a 32-byte data length and the data.
+func (d *calldataDecoder) multiSend(ctx context.Context, packed []byte, depth int) ([]decodedCall, error) {
+	var calls []decodedCall
+	for len(packed) > 0 {
+		if len(packed) < 85 {
+			return calls, errors.New("truncated MultiSend transaction")
+		}
+		op := packed[0]
+		target := common.BytesToAddress(packed[1:21])
+		value := new(big.Int).SetBytes(packed[21:53])
+		size := new(big.Int).SetBytes(packed[53:85])
+		if !size.IsUint64() || size.Uint64() > uint64(len(packed)-85) {
+			return calls, errors.New("MultiSend transaction data runs past the end")
+		}
+		n := size.Uint64()
+		call := d.decode(ctx, &target, value, packed[85:85+n], depth)
+		if op == safeOpDelegateCall {
+			call.Operation = "delegatecall"
+		}
+		calls = append(calls, call)
+		packed = packed[85+n:]
+	}
+	return calls, nil
+}
+
+// methodFromSignature builds a method from a text signature such as
+// transfer(address,uint256), with its arguments unnamed.
+func methodFromSignature(sig string) (abi.Method, error) {
+	open := strings.IndexByte(sig, '(')
+	if open <= 0 || !strings.HasSuffix(sig, ")") {
+		return abi.Method{}, fmt.Errorf("malformed signature %q", sig)
+	}
+	var inputs abi.Arguments
+	for _, t := range splitSignatureTypes(sig[open+1 : len(sig)-1]) {
+		m, err := signatureArgument(t)
+		if err != nil {
+			return abi.Method{}, err
+		}
+		typ, err := abi.NewType(m.Type, "", m.Components)
+		if err != nil {
+			return abi.Method{}, err
+		}
+		inputs = append(inputs, abi.Argument{Type: typ})
+	}
+	return abi.NewMethod(sig[:open], sig[:open], abi.Function, "nonpayable", false, false, inputs, nil), nil
+}
+
+// signatureArgument turns one type of a text signature, which may be a
+// tuple such as (address,bytes)[], into its JSON ABI form.
+func signatureArgument(t string) (abi.ArgumentMarshaling, error) {
+	if !strings.HasPrefix(t, "(") {
+		return abi.ArgumentMarshaling{Type: t}, nil
+	}
+	depth := 0
+	for i, c := range t {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				m := abi.ArgumentMarshaling{Type: "tuple" + t[i+1:]}
+				for j, part := range splitSignatureTypes(t[1:i]) {
+					component, err := signatureArgument(part)
+					if err != nil {
+						return m, err
+					}
+					component.Name = fmt.Sprintf("field%d", j)
+					m.Components = append(m.Components, component)
+				}
+				return m, nil
+			}
+		}
+	}
+	return abi.ArgumentMarshaling{}, fmt.Errorf("unbalanced parentheses in %q", t)
+}
+
+// splitSignatureTypes splits a signature's argument list at the commas
+// outside tuples.
+func splitSignatureTypes(s string) []string {
+	if s == "" {
+		return nil
+	}
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func runDecode(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("decode", &rpcURL)
+	txHash := fs.String("tx", "", "hash of a transaction whose calldata to decode, fetched from -rpc")
+	to := fs.String("to", "", "contract the calldata is for, as an address or registry name, to decode with its ABI first")
+	offline := fs.Bool("offline", false, "do not look unknown selectors up in the selector database")
+	fourByte := fs.String("4byte-url", default4byteURL, "selector database with the 4byte.directory API")
+	output := fs.String("output", outputText, "text, or json")
+	network := addRegistryFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (*txHash == "") == (fs.NArg() == 0) {
+		return errors.New("usage: decode [flags] <calldata>, or decode -tx <hash>")
+	}
+	if *output != outputText && *output != outputJSON {
+		return fmt.Errorf("unknown -output %q (want text or json)", *output)
+	}
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	reg, err := loadRegistry(root, *network)
+	if err != nil {
+		return err
+	}
+	book, err := loadAddressBook(root, *network)
+	if err != nil {
+		return err
+	}
+	if *offline {
+		*fourByte = ""
+	}
+	d := newCalldataDecoder(reg, book, root, *fourByte)
+
+	var target *common.Address
+	switch {
+	case strings.HasPrefix(*to, "0x"):
+		addr, err := parseAddress(*to)
+		if err != nil {
+			return err
+		}
+		target = &addr
+	case *to != "":
+		addr, _, err := lookupName(reg, book, *to)
+		if err != nil {
+			return err
+		}
+		target = &addr
+	}
+	var data []byte
+	var value *big.Int
+	if *txHash != "" {
+		hash, err := parseOperationID(*txHash)
+		if err != nil {
+			return fmt.Errorf("-tx: %w", err)
+		}
+		client, err := dial(ctx, rpcURL)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		tx, _, err := client.TransactionByHash(ctx, hash)
+		if err != nil {
+			return fmt.Errorf("fetch %s: %w", hash.Hex(), err)
+		}
+		if tx.To() == nil {
+			return fmt.Errorf("%s creates a contract; its data is init code, not a call", hash.Hex())
+		}
+		if target == nil {
+			target = tx.To()
+		}
+		data, value = tx.Data(), tx.Value()
+	} else if data, err = hexutil.Decode(strings.TrimSpace(fs.Arg(0))); err != nil {
+		return fmt.Errorf("calldata: %w", err)
+	}
+
+	call := d.decode(ctx, target, value, data, 0)
+	if call.Error != "" {
+		return errors.New(call.Error)
+	}
+	if *output == outputJSON {
+		return printJSON(call)
+	}
+	call.print("")
+	return nil
+}
+
+func (c *decodedCall) print(indent string) {
+	var head strings.Builder
+	head.WriteString(indent)
+	if c.To != nil {
+		head.WriteString(c.To.Hex())
+		if c.Name != "" {
+			head.WriteString(" (" + c.Name + ")")
+		}
+		head.WriteString(": ")
+	}
+	if c.Operation != "" {
+		head.WriteString(c.Operation + " ")
+	}
+	switch {
+	case c.Error != "":
+		head.WriteString(c.Error)
+	default:
+		head.WriteString(c.Signature)
+	}
+	if c.Source != "" {
+		head.WriteString("  [" + c.Source + "]")
+	}
+	fmt.Println(head.String())
+	if c.Value != nil && c.Value.Sign() > 0 {
+		fmt.Printf("%s  value: %s\n", indent, formatEther(c.Value))
+	}
+	for _, a := range c.Args {
+		fmt.Printf("%s  %s %s: %s\n", indent, a.Type, a.Name, a.Value)
+	}
+	if c.Error != "" && len(c.Data) > 0 {
+		fmt.Printf("%s  data: %s\n", indent, c.Data)
+	}
+	for i, inner := range c.Calls {
+		fmt.Printf("%s  call %d:\n", indent, i+1)
+		inner.print(indent + "    ")
+	}
+}
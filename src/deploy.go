@@ -1,30 +1,532 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
 
-	"github.com/foundry-rs/foundry/common"
-	"github.com/foundry-rs/foundry/forge"
+	"github.com/ethereum/go-ethereum/common"
 )
 
-func main() {
-	// Create a provider (local or remote)
-	provider, err := common.NewRPCProvider("http://127.0.0.1:8545") // Local blockchain from `anvil`
-	if err != nil {
-		panic(err)
+func runDeploy(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("deploy", &rpcURL)
+	rf := addRunFlags(fs)
+	rf.addBuildFlags(fs)
+	fs.IntVar(&rf.parallel, "parallel", 1, "deploy up to this many contracts at once when they do not depend on each other")
+	fs.UintVar(&rf.signerPool, "signer-pool", 0, "with a mnemonic signer, spread deployments round-robin over this many of its accounts, from its index on")
+	changed := fs.Bool("changed", false, "deploy only the manifest contracts whose sources or arguments changed since the registry was written, and those that depend on them")
+	contractPath := fs.String("contract", "Governance.sol", "contract to deploy, as File.sol or File.sol:Name")
+	value := fs.String("value", "0", "value to send with the deployment (e.g. 0, 1gwei, 0.1ether)")
+	salt := fs.String("salt", "", "deploy deterministically through the CREATE2 factory with this salt (hex or any string)")
+	ctorArgs := fs.String("args", "[]", `constructor arguments as a JSON array, e.g. '["0xToken", ["0xA", "0xB"]]'`)
+	noLint := fs.Bool("no-lint", false, "skip the static checks of selector clashes and initializer protection")
+	currency := fs.String("currency", "", "report the run's gas cost in these currencies, e.g. usd,eur (prices from CoinGecko unless the manifest has a prices block)")
+	reportFile := fs.String("report", "", "write a report of the run to this Markdown or HTML (.html) file, relative to the project root")
+	reportTemplateFile := fs.String("report-template", "", "render the report with this Go template instead of the built-in one")
+	reportLang := fs.String("report-lang", "", "language of the built-in report: en, de, es or fr (default en)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *changed && rf.manifest == "" {
+		return errors.New("-changed needs a -manifest")
 	}
 
-	// Load the contract
-	contract, err := forge.NewContract("Governance.sol")
+	var contracts []contractSpec
+	if rf.manifest == "" {
+		params, err := parseJSONArgs(*ctorArgs)
+		if err != nil {
+			return err
+		}
+		contracts = []contractSpec{{Contract: *contractPath, Args: params, Value: *value, Salt: *salt}}
+	}
+	m, selected, err := rf.load(ctx, fs, rpcURL, contracts)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if len(m.Contracts) == 0 && len(m.Calls) == 0 && len(m.Assertions) == 0 {
+		return errors.New("no contracts to deploy, calls to make or assertions to check")
+	}
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	reportCfg := m.Report
+	if *reportFile != "" || *reportTemplateFile != "" || *reportLang != "" {
+		c := reportConfig{}
+		if reportCfg != nil {
+			c = *reportCfg
+		}
+		if *reportFile != "" {
+			c.File, c.Format = *reportFile, ""
+		}
+		if *reportTemplateFile != "" {
+			c.Template = *reportTemplateFile
+		}
+		if *reportLang != "" {
+			c.Lang = *reportLang
+		}
+		reportCfg = &c
+	}
+	var report *reportTemplate
+	if reportCfg != nil {
+		if report, err = loadReportTemplate(root, *reportCfg); err != nil {
+			return fmt.Errorf("report: %w", err)
+		}
+	}
+	if err := m.build(ctx, root, selected); err != nil {
+		return err
+	}
+	if !*noLint {
+		// Oversized code is refused, with its breakdown, when deploying.
+		findings, err := lintManifest(root, m, true)
+		if err != nil {
+			return err
+		}
+		if len(findings) > 0 {
+			printLint(os.Stderr, findings)
+			return lintError(findings)
+		}
+	}
+
+	opts := rf.options()
+	opts.Changed = *changed
+	results := deployNetworks(ctx, m, selected, opts)
+	prices := m.Prices
+	if *currency != "" {
+		p := priceConfig{}
+		if prices != nil {
+			p = *prices
+		}
+		p.Currencies = splitList(strings.ToLower(*currency))
+		prices = &p
+	}
+	var cost *costReport
+	if prices != nil {
+		cost = newCostReport(ctx, m, prices, results, opts.DryRun)
+	}
+	if rf.output == outputJSON {
+		report := newDeployReport(m, results, opts)
+		report.Cost = cost
+		if err := printJSON(report); err != nil {
+			return err
+		}
+	} else {
+		printResults(m, results, opts)
+		if cost != nil {
+			fmt.Println()
+			cost.print(os.Stdout, opts.DryRun)
+		}
 	}
 
-	// Deploy contract here with a constructor
-	deployedAddress, err := contract.Deploy(provider, 0, "0xYourTokenAddressHere", []common.Address{"0xApproverAddress1", "0xApproverAddress2"})
+	var errs []error
+	if report != nil {
+		doc := newDeployReport(m, results, opts)
+		doc.Cost = cost
+		if err := report.write(m, doc); err != nil {
+			errs = append(errs, fmt.Errorf("report: %w", err))
+		}
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			metrics.add(metricErrors, 1, "network", r.Network, "kind", "deploy")
+			errs = append(errs, fmt.Errorf("%s: %w", r.Network, r.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runFlags are the flags shared by commands that send transactions.
+type runFlags struct {
+	manifest      string
+	profile       string
+	attest        string
+	networks      string
+	dryRun        bool
+	resume        bool
+	nonce         *uint64
+	confirmations uint64
+	timeout       time.Duration
+	reorgDepth    uint64
+	signer        *signerConfig
+	gas           *gasConfig
+	safe          string
+	safeService   string
+	account       string
+	bundler       string
+	paymaster     string
+	noRelay       bool
+	anvil         bool
+	force         bool
+	fund          bool
+	simulate      bool
+	trace         bool
+	output        string
+	fork          string
+	forkBlock     uint64
+	metricsAddr   string
+	interactive   bool
+	yes           bool
+	// compiler, allowOversize and forceRedeploy are only registered by
+	// commands that deploy code, through addBuildFlags; parallel and
+	// signerPool only by deploy.
+	compiler       *compilerConfig
+	allowOversize  bool
+	forceRedeploy  bool
+	parallel       int
+	signerPool     uint
+	policyOverride string
+}
+
+func (rf *runFlags) addBuildFlags(fs *flag.FlagSet) {
+	rf.compiler = addCompilerFlags(fs)
+	fs.BoolVar(&rf.allowOversize, "allow-oversize", false, "only warn about code over the EIP-170/EIP-3860 size limits")
+	fs.BoolVar(&rf.forceRedeploy, "force-redeploy", false, "deploy contracts even if the registry has one deployed from the same code and constructor arguments")
+}
+
+func addRunFlags(fs *flag.FlagSet) *runFlags {
+	rf := &runFlags{}
+	fs.StringVar(&rf.manifest, "manifest", "", "deployment manifest (e.g. deployments.yaml); overrides the single-contract flags")
+	fs.StringVar(&rf.profile, "profile", "", "manifest profile to apply, e.g. dev or prod (default $"+profileEnv+")")
+	fs.StringVar(&rf.attest, "attest", "", "sign a provenance attestation for each deployment: signer (the deploying key) or sigstore (cosign)")
+	fs.StringVar(&rf.networks, "network", "", "comma-separated manifest networks to run against (default: all); without a manifest, the registry name")
+	fs.BoolVar(&rf.dryRun, "dry-run", false, "simulate transactions with eth_call/eth_estimateGas without broadcasting")
+	fs.Func("nonce", "nonce of the first transaction (default: the signer's pending nonce)", func(s string) error {
+		n, err := strconv.ParseUint(s, 0, 64)
+		rf.nonce = &n
+		return err
+	})
+	fs.BoolVar(&rf.force, "force", false, "send even if the node's chain id does not match the network's")
+	fs.BoolVar(&rf.fund, "fund", false, "on test networks, top up the signer from the node or the network's faucet if it cannot pay for the run")
+	fs.BoolVar(&rf.simulate, "simulate", false, "simulate each transaction through Tenderly before sending it (env TENDERLY_ACCOUNT, TENDERLY_PROJECT, TENDERLY_ACCESS_KEY)")
+	fs.BoolVar(&rf.trace, "trace", false, "print each transaction's call trace, with gas per call, from debug_traceTransaction")
+	fs.BoolVar(&rf.resume, "resume", false, "continue the last interrupted run, skipping contracts it already deployed")
+	fs.Uint64Var(&rf.confirmations, "confirmations", defaultConfirmations, "blocks that must include each transaction before continuing (0: don't wait for receipts)")
+	fs.DurationVar(&rf.timeout, "timeout", defaultReceiptTimeout, "how long to wait for each transaction's confirmations")
+	fs.Uint64Var(&rf.reorgDepth, "reorg-depth", 0, "after the run, watch its deployments until this many blocks are built on them, and fail if a reorg removes one (0: don't watch)")
+	fs.StringVar(&rf.safe, "safe", "", "propose transactions to this Safe multisig instead of sending them from the signer")
+	fs.StringVar(&rf.safeService, "safe-service", "", "Safe Transaction Service URL (default: the public service for the chain)")
+	fs.StringVar(&rf.account, "account", "", "send transactions as ERC-4337 user operations from this smart account (needs -bundler)")
+	fs.StringVar(&rf.bundler, "bundler", "", "ERC-4337 bundler RPC URL for -account")
+	fs.StringVar(&rf.paymaster, "paymaster", "", "paymaster sponsoring -account's user operations: an ERC-7677 service URL or a paymaster address")
+	fs.BoolVar(&rf.noRelay, "no-relay", false, "send calls from the signer, on networks whose manifest has them relayed")
+	fs.StringVar(&rf.output, "output", outputText, "result format on stdout: text, or json for CI pipelines")
+	fs.BoolVar(&rf.anvil, "anvil", false, "run against a fresh anvil node started for the run and stopped afterwards")
+	fs.StringVar(&rf.fork, "fork", "", "with -anvil, fork the chain at this RPC URL")
+	fs.Uint64Var(&rf.forkBlock, "fork-block", 0, "with -fork, pin the fork to this block number")
+	fs.BoolVar(&rf.interactive, "interactive", false, "show each transaction and ask for the network name to be typed before broadcasting it")
+	fs.BoolVar(&rf.yes, "yes", false, "do not ask for confirmations, even on networks with confirm: true (for CI)")
+	fs.StringVar(&rf.policyOverride, "policy-override", "", "send even if "+policyFile+" does not allow it, giving this reason, which the audit log records")
+	fs.StringVar(&rf.metricsAddr, "metrics-addr", "", "serve Prometheus metrics on this address, e.g. :9090, at /metrics while the command runs")
+	rf.signer = addSignerFlags(fs)
+	rf.gas = addGasFlags(fs)
+	return rf
+}
+
+func (rf *runFlags) options() deployOptions {
+	return deployOptions{DryRun: rf.dryRun, Resume: rf.resume, AllowOversize: rf.allowOversize, Nonce: rf.nonce, Confirmations: rf.confirmations, Timeout: rf.timeout, ReorgDepth: rf.reorgDepth, Force: rf.force, ForceRedeploy: rf.forceRedeploy, Fund: rf.fund, Simulate: rf.simulate, Trace: rf.trace, Parallel: rf.parallel, Interactive: rf.interactive, Yes: rf.yes, Attest: rf.attest, PolicyOverride: rf.policyOverride}
+}
+
+// load returns the manifest to run and the selected networks: the -manifest
+// file, or a single network at rpcURL deploying contracts. Signer, gas, Safe
+// and anvil flags override the manifest.
+func (rf *runFlags) load(ctx context.Context, fs *flag.FlagSet, rpcURL string, contracts []contractSpec) (*manifest, []string, error) {
+	if rf.output != outputText && rf.output != outputJSON {
+		return nil, nil, fmt.Errorf("unknown -output %q (want text or json)", rf.output)
+	}
+	var m *manifest
+	if rf.manifest != "" {
+		loaded, err := loadManifest(ctx, rf.manifest, selectedProfile(rf.profile))
+		if err != nil {
+			return nil, nil, err
+		}
+		m = loaded
+		if m.profile != "" {
+			logger.Info("Using profile", "profile", m.profile, "manifest", rf.manifest)
+		}
+		if m.Confirmations != nil && !flagSet(fs, "confirmations") {
+			rf.confirmations = *m.Confirmations
+		}
+		if m.ReorgDepth != nil && !flagSet(fs, "reorg-depth") {
+			rf.reorgDepth = *m.ReorgDepth
+		}
+		if m.Attest != "" && !flagSet(fs, "attest") {
+			rf.attest = m.Attest
+		}
+	} else {
+		// Without a manifest, -network only names the registry to record in.
+		name := defaultNetwork
+		if names := splitList(rf.networks); len(names) == 1 {
+			name = names[0]
+		}
+		m = &manifest{
+			Networks:  map[string]networkConfig{name: {RPC: rpcURL}},
+			Contracts: contracts,
+		}
+		if err := m.validate(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := checkAttestMode(rf.attest); err != nil {
+		return nil, nil, err
+	}
+	if !rf.signer.isZero() {
+		m.Signer = *rf.signer
+	}
+	if rf.signerPool > 0 {
+		m.Signer.Pool = uint32(rf.signerPool)
+	}
+	m.Gas = rf.gas.merge(m.Gas)
+	if err := m.Gas.validate(); err != nil {
+		return nil, nil, fmt.Errorf("gas: %w", err)
+	}
+	if rf.compiler != nil {
+		m.Compiler = rf.compiler.merge(m.Compiler)
+		if err := m.Compiler.validate(); err != nil {
+			return nil, nil, fmt.Errorf("compiler: %w", err)
+		}
+	}
+
+	selected, err := m.selectNetworks(splitList(rf.networks))
 	if err != nil {
-		panic(err)
+		return nil, nil, err
+	}
+	for _, name := range selected {
+		n := m.Networks[name]
+		if rf.safe != "" {
+			n.Safe = &safeConfig{Address: rf.safe}
+		}
+		if rf.safeService != "" {
+			if n.Safe == nil {
+				return nil, nil, fmt.Errorf("-safe-service needs a Safe; network %s has none (use -safe)", name)
+			}
+			safe := *n.Safe
+			safe.Service = rf.safeService
+			n.Safe = &safe
+		}
+		if rf.account != "" || rf.bundler != "" || rf.paymaster != "" {
+			var op userOpConfig
+			if n.UserOp != nil {
+				op = *n.UserOp
+			}
+			if rf.account != "" {
+				op.Account = rf.account
+			}
+			if rf.bundler != "" {
+				op.Bundler = rf.bundler
+			}
+			if strings.Contains(rf.paymaster, "://") {
+				op.Paymaster = &paymasterConfig{URL: rf.paymaster}
+			} else if rf.paymaster != "" {
+				op.Paymaster = &paymasterConfig{Address: rf.paymaster}
+			}
+			if err := op.validate(); err != nil {
+				return nil, nil, fmt.Errorf("network %s: userOp: %w", name, err)
+			}
+			if n.Safe != nil {
+				return nil, nil, fmt.Errorf("network %s: a Safe and a smart account cannot both send the transactions", name)
+			}
+			n.UserOp = &op
+		}
+		if rf.noRelay || rf.safe != "" || rf.account != "" {
+			// A Safe or smart account from the flags sends its own
+			// transactions.
+			n.Relay = nil
+		}
+		if rf.anvil {
+			n.Anvil = &anvilConfig{Fork: rf.fork, ForkBlock: rf.forkBlock}
+		}
+		m.Networks[name] = n
+	}
+	if (rf.fork != "" || rf.forkBlock != 0) && !rf.anvil {
+		return nil, nil, errors.New("-fork and -fork-block need -anvil")
+	}
+	if rf.forkBlock != 0 && rf.fork == "" {
+		return nil, nil, errors.New("-fork-block needs -fork")
+	}
+	if flagSet(fs, "rpc") && rf.anvil {
+		return nil, nil, errors.New("-rpc and -anvil are mutually exclusive")
+	}
+	if flagSet(fs, "rpc") {
+		if len(selected) != 1 {
+			return nil, nil, errors.New("-rpc can only override the endpoint of a single network")
+		}
+		n := m.Networks[selected[0]]
+		n.RPC, n.Fallbacks = rpcURL, nil
+		m.Networks[selected[0]] = n
+	}
+	if err := serveMetrics(ctx, rf.metricsAddr); err != nil {
+		return nil, nil, err
+	}
+	return m, selected, nil
+}
+
+// defaultNetwork names the single network used when deploying from flags.
+const defaultNetwork = "default"
+
+// deployment is the outcome of deploying one manifest entry.
+type deployment struct {
+	Name            string
+	Contract        string
+	Address         common.Address
+	TxHash          common.Hash
+	Deployer        common.Address
+	Args            []interface{}
+	ConstructorArgs []byte
+	// CodeHash is the keccak256 of the creation code with the constructor
+	// arguments.
+	CodeHash    common.Hash
+	BlockNumber uint64
+	// BlockHash is the block the receipt placed the transaction in, for
+	// watchReorgs to check against.
+	BlockHash common.Hash
+	// Salt is set for CREATE2 deployments. Skipped marks one that was
+	// already deployed at its predicted address.
+	Salt    *common.Hash
+	Skipped bool
+	// Verified is set once the explorer accepted the source.
+	Verified bool
+	// Proxy is set for a proxy deployed in front of an implementation.
+	Proxy *proxyDeployment
+	// Gas is the transaction's gas limit; GasUsed and BlockNumber come
+	// from its receipt.
+	Gas     uint64
+	GasUsed uint64
+	Fees    fees
+	// GasPrice is the effective gas price from the receipt.
+	GasPrice *big.Int
+	// L1Fee is the L1 data fee a rollup charged on top of gas, from the
+	// receipt.
+	L1Fee *big.Int
+	// ENS maps the ENS names in the arguments to the addresses they
+	// resolved to.
+	ENS map[string]common.Address
+	// References maps the deployments the arguments refer to, as
+	// ${Name.address}, to their addresses.
+	References map[string]common.Address
+
+	artifact *artifact
+}
+
+// networkResult collects the deployments made on one network. Err is set
+// if the network's run stopped early.
+type networkResult struct {
+	Network     string
+	Deployments []deployment
+	Err         error
+	Elapsed     time.Duration
+}
+
+// deployNetworks runs the manifest against each selected network in turn.
+// A failure on one network does not prevent deploying to the others.
+func deployNetworks(ctx context.Context, m *manifest, networks []string, opts deployOptions) []networkResult {
+	hooks := m.Notify
+	if opts.DryRun {
+		hooks = nil
+	}
+	results := make([]networkResult, 0, len(networks))
+	for _, name := range networks {
+		notify(ctx, hooks, startedEvent(m, name))
+		start := time.Now()
+		deployments, err := executeManifest(ctx, m, name, opts)
+		r := networkResult{Network: name, Deployments: deployments, Err: err, Elapsed: time.Since(start)}
+		results = append(results, r)
+		notify(context.WithoutCancel(ctx), hooks, finishedEvent(m, r))
+	}
+	return results
+}
+
+func printResults(m *manifest, results []networkResult, opts deployOptions) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if opts.DryRun {
+		fmt.Fprintln(w, "DRY RUN: nothing was broadcast")
+		fmt.Fprintln(w, "NETWORK\tCHAIN\tNAME\tPREDICTED ADDRESS\tGAS\tMAX COST")
+	} else {
+		fmt.Fprintln(w, "NETWORK\tCHAIN\tNAME\tADDRESS\tTX\tBLOCK\tGAS USED")
+	}
+	for _, r := range results {
+		chain := "?"
+		if id := m.Networks[r.Network].chainID(r.Network); id != 0 {
+			chain = strconv.FormatUint(id, 10)
+		}
+		for _, d := range r.Deployments {
+			if opts.DryRun {
+				cost := d.Fees.maxCost(d.Gas)
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", r.Network, chain, d.Name, d.Address.Hex(), d.Gas, formatEther(cost))
+				continue
+			}
+			tx, block, used := d.TxHash.Hex(), "pending", "-"
+			if d.Skipped {
+				tx, block = "(already deployed)", "-"
+			} else if d.BlockNumber != 0 {
+				block, used = strconv.FormatUint(d.BlockNumber, 10), strconv.FormatUint(d.GasUsed, 10)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Network, chain, d.Name, d.Address.Hex(), tx, block, used)
+		}
+		if r.Err != nil {
+			fmt.Fprintf(w, "%s\t%s\t-\tFAILED\t%v\n", r.Network, chain, r.Err)
+		}
+	}
+	w.Flush()
+	if !opts.DryRun {
+		printExplorerLinks(m, results)
+	}
+}
+
+// printExplorerLinks lists each deployment's contract and transaction on
+// its network's block explorer, as full URLs that terminals make
+// clickable. Networks without an explorer are left out.
+func printExplorerLinks(m *manifest, results []networkResult) {
+	var w *tabwriter.Writer
+	for _, r := range results {
+		site := m.Networks[r.Network].explorerSite(m.Networks[r.Network].chainID(r.Network))
+		if site == "" {
+			continue
+		}
+		for _, d := range r.Deployments {
+			if w == nil {
+				fmt.Println()
+				w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(w, "NETWORK\tNAME\tEXPLORER")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", r.Network, d.Name, site.address(d.Address))
+			if !d.Skipped {
+				fmt.Fprintf(w, "\t\t%s\n", site.tx(d.TxHash))
+			}
+		}
+	}
+	if w != nil {
+		w.Flush()
+	}
+}
+
+// parseJSONArgs decodes a JSON array of loosely typed arguments.
+func parseJSONArgs(raw string) ([]interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.UseNumber()
+	var values []interface{}
+	if err := dec.Decode(&values); err != nil {
+		return nil, &encodingError{fmt.Errorf("invalid -args: %w", err)}
 	}
+	return values, nil
+}
 
-	fmt.Println("Deployed contract at address:", deployedAddress.Hex())
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
 }
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// refPattern matches a placeholder for another deployment's address, e.g.
+// ${Token.address}.
+var refPattern = regexp.MustCompile(`\$\{([A-Za-z0-9_-]+)\.address\}`)
+
+// references returns the deployment names referred to by placeholders in v,
+// a loosely typed argument value.
+func references(v interface{}) []string {
+	var names []string
+	switch v := v.(type) {
+	case string:
+		for _, m := range refPattern.FindAllStringSubmatch(v, -1) {
+			names = append(names, m[1])
+		}
+	case []interface{}:
+		for _, elem := range v {
+			names = append(names, references(elem)...)
+		}
+	case map[string]interface{}:
+		for _, elem := range v {
+			names = append(names, references(elem)...)
+		}
+	}
+	return names
+}
+
+// dependencies returns the deployments c must wait for: those named in
+// dependsOn and those its arguments, on any network, refer to.
+func (c *contractSpec) dependencies() []string {
+	deps := slices.Clone(c.DependsOn)
+	deps = append(deps, references(c.Args)...)
+	for _, o := range c.Networks {
+		deps = append(deps, references(o.Args)...)
+	}
+	if p := c.Proxy; p != nil {
+		deps = append(deps, references(p.Args)...)
+		deps = append(deps, references(p.Owner)...)
+	}
+	slices.Sort(deps)
+	return slices.Compact(deps)
+}
+
+// orderContracts sorts specs so each comes after the deployments it depends
+// on, otherwise keeping manifest order. References to names outside the
+// manifest are left for the registry to resolve at deploy time, except in
+// dependsOn, which must name manifest entries.
+func orderContracts(specs []contractSpec) ([]contractSpec, error) {
+	index := make(map[string]int, len(specs))
+	for i, c := range specs {
+		if _, dup := index[c.Name]; dup {
+			return nil, fmt.Errorf("duplicate contract name %s", c.Name)
+		}
+		index[c.Name] = i
+	}
+	for _, c := range specs {
+		for _, dep := range c.DependsOn {
+			if _, ok := index[dep]; !ok {
+				return nil, fmt.Errorf("%s: depends on unknown contract %s", c.Name, dep)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(specs))
+	ordered := make([]contractSpec, 0, len(specs))
+	var path []string
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case done:
+			return nil
+		case visiting:
+			start := slices.Index(path, specs[i].Name)
+			cycle := append(slices.Clone(path[start:]), specs[i].Name)
+			return fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+		}
+		state[i] = visiting
+		path = append(path, specs[i].Name)
+		for _, dep := range specs[i].dependencies() {
+			if j, ok := index[dep]; ok {
+				if err := visit(j); err != nil {
+					return err
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = done
+		ordered = append(ordered, specs[i])
+		return nil
+	}
+	for i := range specs {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// substitute replaces address placeholders in v using resolve.
+func substitute(v interface{}, resolve func(name string) (common.Address, error)) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		var err error
+		out := refPattern.ReplaceAllStringFunc(v, func(ref string) string {
+			addr, rerr := resolve(refPattern.FindStringSubmatch(ref)[1])
+			if rerr != nil && err == nil {
+				err = rerr
+			}
+			return addr.Hex()
+		})
+		return out, err
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, elem := range v {
+			s, err := substitute(elem, resolve)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = s
+		}
+		return out, nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, elem := range v {
+			s, err := substitute(elem, resolve)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = s
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+// resolveRefs returns spec with every placeholder replaced by the address
+// of the deployment it names, from this run or the network's registry.
+func (r *networkRun) resolveRefs(spec contractSpec) (contractSpec, error) {
+	return substituteSpec(spec, r.resolveRef)
+}
+
+func (r *networkRun) resolveRef(name string) (common.Address, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if addr, ok := r.addresses[name]; ok {
+		return addr, nil
+	}
+	if e, ok := r.registry.Contracts[name]; ok {
+		if e.Reorged != nil {
+			return common.Address{}, fmt.Errorf("${%s.address}: %w", name, e.reorgedError(name))
+		}
+		return e.Address, nil
+	}
+	return common.Address{}, fmt.Errorf("${%s.address}: %s is neither in the manifest nor deployed on %s", name, name, r.name)
+}
+
+func substituteSpec(spec contractSpec, resolve func(string) (common.Address, error)) (contractSpec, error) {
+	args, err := substitute(spec.Args, resolve)
+	if err != nil {
+		return spec, err
+	}
+	spec.Args, _ = args.([]interface{})
+	if p := spec.Proxy; p != nil {
+		resolved := *p
+		args, err := substitute(p.Args, resolve)
+		if err != nil {
+			return spec, err
+		}
+		resolved.Args, _ = args.([]interface{})
+		owner, err := substitute(p.Owner, resolve)
+		if err != nil {
+			return spec, err
+		}
+		resolved.Owner = owner.(string)
+		spec.Proxy = &resolved
+	}
+	return spec, nil
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// defaultDistributionBatch is how many transfers a distribution puts in one
+// batch transaction by default. A token transfer costs 30-50k gas, so a
+// batch stays well below block gas limits.
+const defaultDistributionBatch = 100
+
+// distributionSpec sends a token to the accounts listed in a CSV file once
+// the manifest's calls have configured the contracts:
+//
+//	distributions:
+//	  - token: Token
+//	    file: airdrop/initial.csv   # account,amount per line
+//	    method: mint                # transfer (default), mint or another (address,uint256) method
+//	    batchSize: 200
+type distributionSpec struct {
+	// Token is a manifest or registry name, or an address.
+	Token string `yaml:"token"`
+	// Contract is the artifact providing the ABI, as for calls.
+	Contract string `yaml:"contract"`
+	// File is the CSV of recipients, relative to the project root.
+	File   string `yaml:"file"`
+	Method string `yaml:"method"`
+	// BatchSize is how many transfers go in one transaction when the manifest
+	// batches its calls.
+	BatchSize int `yaml:"batchSize"`
+	// Decimals scales the amounts, which are whole tokens at the token's
+	// decimals() by default; 0 takes them as base units.
+	Decimals *uint8 `yaml:"decimals"`
+}
+
+// recipient is one row of a distribution's file.
+type recipient struct {
+	line    int
+	account string
+	amount  string
+	to      common.Address
+}
+
+func (d *distributionSpec) validate() error {
+	if d.Token == "" || d.File == "" {
+		return errors.New("token and file are required")
+	}
+	if d.Method == "" {
+		d.Method = "transfer"
+	}
+	if d.BatchSize < 0 {
+		return errors.New("batchSize must be positive")
+	}
+	if d.BatchSize == 0 {
+		d.BatchSize = defaultDistributionBatch
+	}
+	return nil
+}
+
+// readRecipients reads a distribution file: account,amount per line, with
+// an optional header line and # comments. Accounts are addresses, ENS names,
+// deployment names or address book labels.
+func readRecipients(path string) ([]recipient, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cr := csv.NewReader(f)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = 2
+	cr.TrimLeadingSpace = true
+	var rows []recipient
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		line, _ := cr.FieldPos(0)
+		account, amount := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+		// The precision is checked once the token's decimals are known.
+		if _, err := parseUnits(amount, 255); err != nil {
+			if len(rows) == 0 && !strings.HasPrefix(account, "0x") {
+				continue // a header
+			}
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		rows = append(rows, recipient{line: line, account: account, amount: amount})
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s lists no recipients", path)
+	}
+	return rows, nil
+}
+
+// loadRecipients reads d's file and resolves its accounts, refusing the
+// zero address and accounts listed twice, which are most likely mistakes.
+func (r *networkRun) loadRecipients(ctx context.Context, d distributionSpec, resolve func(string) (common.Address, error)) ([]recipient, error) {
+	path := filepath.Join(r.root, d.File)
+	rows, err := readRecipients(path)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[common.Address]int, len(rows))
+	for i := range rows {
+		row := &rows[i]
+		if row.to, err = r.resolveTarget(ctx, row.account, resolve); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", d.File, row.line, err)
+		}
+		if row.to == (common.Address{}) {
+			return nil, fmt.Errorf("%s:%d: the zero address cannot receive tokens", d.File, row.line)
+		}
+		if first, ok := seen[row.to]; ok {
+			return nil, fmt.Errorf("%s:%d: %s is already listed on line %d", d.File, row.line, r.book.annotate(row.to), first)
+		}
+		seen[row.to] = row.line
+	}
+	return rows, nil
+}
+
+// distributionABI returns the token's ABI, checking it has d's method
+// taking an address and an amount.
+func (r *networkRun) distributionABI(ctx context.Context, d distributionSpec, contracts map[string]string) (abi.ABI, error) {
+	contractABI, err := r.callABI(ctx, d.Token, d.Contract, contracts)
+	if err != nil {
+		return contractABI, err
+	}
+	method, ok := contractABI.Methods[d.Method]
+	if !ok {
+		return contractABI, fmt.Errorf("%s has no method %s", d.Token, d.Method)
+	}
+	if in := method.Inputs; len(in) != 2 || in[0].Type.T != abi.AddressTy || in[1].Type.T != abi.UintTy {
+		return contractABI, fmt.Errorf("%s is %s; a distribution needs a method taking (address, uint256)", d.Method, method.Sig)
+	}
+	return contractABI, nil
+}
+
+// checkDistributions reads the manifest's distribution files and checks
+// their accounts and the tokens' methods before anything is deployed.
+func (r *networkRun) checkDistributions(ctx context.Context, m *manifest) error {
+	if len(m.Distributions) == 0 {
+		return nil
+	}
+	if m.Batch == batchMulticall && r.safe == nil {
+		return errors.New("distributions cannot be batched through Multicall3, which would then send every transfer; use batch: none or eip5792, or a Safe")
+	}
+	contracts := make(map[string]string, len(m.Contracts))
+	for _, spec := range m.Contracts {
+		contracts[spec.Name] = spec.Contract
+	}
+	resolve := r.pendingResolver(m.Contracts)
+	for i, d := range m.Distributions {
+		if _, err := r.distributionABI(ctx, d, contracts); err != nil {
+			return fmt.Errorf("distributions[%d]: %w", i, err)
+		}
+		rows, err := r.loadRecipients(ctx, d, resolve)
+		if err != nil {
+			return fmt.Errorf("distributions[%d]: %w", i, err)
+		}
+		// Without decimals:, the precision waits until the token is
+		// deployed and has its decimals() to read.
+		if d.Decimals == nil {
+			continue
+		}
+		for _, row := range rows {
+			if _, err := parseUnits(row.amount, *d.Decimals); err != nil {
+				return fmt.Errorf("distributions[%d]: %s:%d: %w", i, d.File, row.line, err)
+			}
+		}
+	}
+	return nil
+}
+
+// runDistributions sends the manifest's distributions, in batches of
+// transfers when the manifest batches its calls and one transfer per
+// transaction otherwise. Progress is checkpointed after every transaction,
+// so -resume continues a distribution where it stopped. With deploy
+// -changed, only distributions of a redeployed token are sent.
+func (r *networkRun) runDistributions(ctx context.Context, m *manifest, state *runState) error {
+	contracts := make(map[string]string, len(m.Contracts))
+	for _, spec := range m.Contracts {
+		contracts[spec.Name] = spec.Contract
+	}
+	for i, d := range m.Distributions {
+		label := fmt.Sprintf("distributions[%d] %s", i, d.Token)
+		if r.changes != nil && !r.moved(d.Token, state) {
+			logger.Info("Token not redeployed, skipping its distribution", "network", r.name, "distribution", label)
+			continue
+		}
+		if err := r.distribute(ctx, m, d, i, contracts, state); err != nil {
+			return fmt.Errorf("%s: %w", label, err)
+		}
+	}
+	return nil
+}
+
+func (r *networkRun) distribute(ctx context.Context, m *manifest, d distributionSpec, index int, contracts map[string]string, state *runState) error {
+	contractABI, err := r.distributionABI(ctx, d, contracts)
+	if err != nil {
+		return err
+	}
+	token, err := r.resolveTarget(ctx, d.Token, r.resolveRef)
+	if err != nil {
+		return err
+	}
+	bound := &boundContract{Address: token, ABI: contractABI, client: r.client}
+	var decimals uint8
+	if d.Decimals != nil {
+		decimals = *d.Decimals
+	} else {
+		out, err := (&boundContract{Address: token, ABI: erc20ABI, client: r.client}).Call(ctx, "decimals")
+		if err != nil {
+			return fmt.Errorf("read decimals (set decimals: to skip it): %w", err)
+		}
+		decimals = out[0].(uint8)
+	}
+	rows, err := r.loadRecipients(ctx, d, r.resolveRef)
+	if err != nil {
+		return err
+	}
+	done := 0
+	if r.opts.Resume {
+		done = state.distributed(index)
+	}
+	if done >= len(rows) {
+		logger.Info("Distribution already sent by the interrupted run, skipping", "network", r.name, "token", d.Token, "recipients", len(rows))
+		return nil
+	}
+	if done > 0 {
+		logger.Info("Skipping recipients the interrupted run sent to", "network", r.name, "token", d.Token, "recipients", done)
+	}
+
+	calls := make([]encodedCall, 0, len(rows)-done)
+	total := new(big.Int)
+	for _, row := range rows[done:] {
+		value, err := parseUnits(row.amount, decimals)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", d.File, row.line, err)
+		}
+		data, err := contractABI.Pack(d.Method, row.to, value)
+		if err != nil {
+			return err
+		}
+		total.Add(total, value)
+		calls = append(calls, encodedCall{
+			label: fmt.Sprintf("%s.%s(%s, %s)", d.Token, d.Method, r.book.annotate(row.to), formatUnits(value, decimals)),
+			abi:   contractABI,
+			to:    token,
+			value: new(big.Int),
+			data:  data,
+		})
+	}
+	if _, ok := contractABI.Methods["balanceOf"]; ok && d.Method == "transfer" {
+		out, err := bound.Call(ctx, "balanceOf", r.from())
+		if err == nil {
+			if have, ok := out[0].(*big.Int); ok && have.Cmp(total) < 0 {
+				return fmt.Errorf("%s holds %s of %s, but the distribution sends %s", r.from().Hex(), formatUnits(have, decimals), d.Token, formatUnits(total, decimals))
+			}
+		}
+	}
+	logger.Info("Distributing", "network", r.name, "token", d.Token, "method", d.Method, "recipients", len(calls), "total", formatUnits(total, decimals))
+
+	batched := r.safe != nil || m.Batch == batchEIP5792 && !r.opts.DryRun
+	size := 1
+	if batched {
+		size = d.BatchSize
+	}
+	for start := 0; start < len(calls); start += size {
+		chunk := calls[start:min(start+size, len(calls))]
+		var sent *sentTx
+		switch {
+		case !batched:
+			c := chunk[0]
+			sent, err = r.transact(ctx, txFields{To: &c.to, Value: c.value, Data: c.data, Label: c.label}, gasConfig{})
+			if err != nil && sent != nil && sent.Reverted {
+				err = r.explainRevert(err, c.abi, c.data)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", c.label, err)
+			}
+		case r.safe != nil:
+			sent, err = r.multiSend(ctx, chunk)
+		default:
+			sent, err = r.sendCalls(ctx, chunk)
+		}
+		if err != nil {
+			return fmt.Errorf("batch of %d transfers: %w", len(chunk), err)
+		}
+		done += len(chunk)
+		progress := fmt.Sprintf("%d/%d", done, len(rows))
+		if r.opts.DryRun {
+			if batched || done == len(rows) {
+				logger.Info("DRY RUN: distribution would succeed", "network", r.name, "token", d.Token, "recipients", progress)
+			}
+			continue
+		}
+		if err := state.checkpointDistribution(index, done); err != nil {
+			return fmt.Errorf("checkpoint: %w", err)
+		}
+		if batched || done%d.BatchSize == 0 || done == len(rows) {
+			logger.Info("Distributed", "network", r.name, "token", d.Token, "recipients", progress, "tx", sent.Hash)
+		}
+	}
+	return nil
+}
+
+// distributed returns how many recipients of the manifest's index-th
+// distribution were sent to.
+func (s *runState) distributed(index int) int {
+	if index < len(s.Distributed) {
+		return s.Distributed[index]
+	}
+	return 0
+}
+
+// checkpointDistribution records that the first n recipients of the
+// manifest's index-th distribution were sent to.
+func (s *runState) checkpointDistribution(index, n int) error {
+	for len(s.Distributed) <= index {
+		s.Distributed = append(s.Distributed, 0)
+	}
+	s.Distributed[index] = n
+	return s.write()
+}
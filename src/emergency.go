@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Emergency actions and the functions they call.
+const (
+	pauseMethod             = "pause"
+	unpauseMethod           = "unpause"
+	transferOwnershipMethod = "transferOwnership"
+)
+
+// runEmergency pauses, unpauses or hands over ownership of deployed
+// contracts in one command. Transactions to different contracts are sent
+// back to back without waiting for each other's receipts. With a Safe the
+// actions are proposed one by one and need its owners' confirmations.
+func runEmergency(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: emergency pause|unpause|transfer-ownership [flags] <deployment or address>...")
+	}
+	var method string
+	switch args[0] {
+	case "pause":
+		method = pauseMethod
+	case "unpause":
+		method = unpauseMethod
+	case "transfer-ownership":
+		method = transferOwnershipMethod
+	default:
+		return fmt.Errorf("unknown emergency action %q (want pause, unpause or transfer-ownership)", args[0])
+	}
+
+	var rpcURL string
+	fs := newFlagSet("emergency "+args[0], &rpcURL)
+	rf := addRunFlags(fs)
+	all := fs.Bool("all", false, "act on every contract in the registry that has the function")
+	newOwner := fs.String("new-owner", "", "with transfer-ownership, the new owner's address or ENS name")
+	contractRef := fs.String("contract", "", "artifact (File.sol or File.sol:Name) providing the ABI for contracts given by address")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 && !*all {
+		return errors.New("name the contracts to act on, or pass -all")
+	}
+	if fs.NArg() > 0 && *all {
+		return errors.New("-all and a list of contracts are mutually exclusive")
+	}
+	if (method == transferOwnershipMethod) != (*newOwner != "") {
+		return errors.New("-new-owner is required with, and only with, transfer-ownership")
+	}
+
+	m, selected, err := rf.load(ctx, fs, rpcURL, nil)
+	if err != nil {
+		return err
+	}
+	if len(selected) != 1 {
+		return fmt.Errorf("emergency runs against a single network; pick one with -network")
+	}
+	run, err := openNetworkRun(ctx, m, selected[0], rf.options())
+	if err != nil {
+		return err
+	}
+	defer run.close()
+
+	var margs []interface{}
+	if method == transferOwnershipMethod {
+		owner, err := run.ens.resolveAddressArg(ctx, *newOwner)
+		if err != nil {
+			return fmt.Errorf("-new-owner: %w", err)
+		}
+		margs = []interface{}{owner}
+	}
+	targets, err := emergencyTargets(ctx, run, method, fs.Args(), *all, *contractRef)
+	if err != nil {
+		return err
+	}
+
+	results := make([]emergencyResult, len(targets))
+	act := func(i int) {
+		t := targets[i]
+		results[i].target = t
+		results[i].sent, results[i].err = t.contract.Send(ctx, run, method, margs...)
+	}
+	if run.safe != nil || run.userOp != nil {
+		// Safe proposals and user operations take their nonces in order.
+		for i := range targets {
+			act(i)
+		}
+	} else {
+		var wg sync.WaitGroup
+		for i := range targets {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				act(i)
+			}()
+		}
+		wg.Wait()
+	}
+
+	var errs []error
+	for _, r := range results {
+		if r.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.target.name, r.err))
+		}
+	}
+	if rf.output == outputJSON {
+		reports := make([]txReport, len(results))
+		for i, r := range results {
+			reports[i] = newTxReport(run, r.target.contract.Address, method, r.sent, rf.dryRun)
+		}
+		if err := printJSON(reports); err != nil {
+			return err
+		}
+	} else {
+		printEmergency(run.site, results, rf.dryRun)
+	}
+	return errors.Join(errs...)
+}
+
+type emergencyTarget struct {
+	name     string
+	contract *boundContract
+}
+
+type emergencyResult struct {
+	target emergencyTarget
+	sent   *sentTx
+	err    error
+}
+
+// emergencyTargets binds the named contracts, or with all every registry
+// contract, and checks each has method. Named targets without it are an
+// error; with all they are skipped. contractRef overrides the ABI.
+func emergencyTargets(ctx context.Context, run *networkRun, method string, names []string, all bool, contractRef string) ([]emergencyTarget, error) {
+	if all {
+		names = run.registry.names()
+	}
+	var targets []emergencyTarget
+	seen := map[common.Address]bool{}
+	for _, name := range names {
+		c, err := bindContract(ctx, run.client, run.registry, run.root, name, contractRef)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := c.ABI.Methods[method]; !ok {
+			if all {
+				continue
+			}
+			return nil, fmt.Errorf("%s has no %s function", name, method)
+		}
+		if seen[c.Address] {
+			continue
+		}
+		seen[c.Address] = true
+		targets = append(targets, emergencyTarget{name: name, contract: c})
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no contract in the %s registry has a %s function", run.name, method)
+	}
+	return targets, nil
+}
+
+func printEmergency(site explorerSite, results []emergencyResult, dryRun bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tADDRESS\tRESULT")
+	var links []string
+	for _, r := range results {
+		if r.err == nil && !dryRun {
+			if url := site.tx(r.sent.Hash); url != "" {
+				links = append(links, r.target.name+"\t"+url)
+			}
+		}
+		var result string
+		switch {
+		case r.err != nil:
+			result = "FAILED: " + r.err.Error()
+		case dryRun:
+			result = fmt.Sprintf("would succeed (gas %d)", r.sent.Gas)
+		case r.sent.Receipt != nil:
+			result = fmt.Sprintf("%s mined in block %d", r.sent.Hash.Hex(), r.sent.Receipt.BlockNumber.Uint64())
+		default:
+			result = r.sent.Hash.Hex()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.target.name, r.target.contract.Address.Hex(), result)
+	}
+	w.Flush()
+	if len(links) > 0 {
+		fmt.Println()
+		w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tEXPLORER")
+		for _, l := range links {
+			fmt.Fprintln(w, l)
+		}
+		w.Flush()
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// runEncodeArgs prints the ABI encoding of a contract's constructor
+// arguments: the hex an explorer's verification form asks for, and what
+// deploy appends to the creation code. Nothing is sent.
+func runEncodeArgs(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("encode-args", flag.ContinueOnError)
+	contractRef := fs.String("contract", "Governance.sol", "contract whose constructor takes the arguments, as File.sol or File.sol:Name")
+	ctorArgs := fs.String("args", "[]", `constructor arguments as a JSON array; ${Name.address} is looked up in the -network registry`)
+	network := addRegistryFlag(fs)
+	compare := fs.String("compare", "", "hex to compare the encoding with (e.g. from an explorer), or a deployment whose recorded arguments to compare with")
+	words := fs.Bool("words", false, "also print the encoding as 32-byte words")
+	output := fs.String("output", outputText, "text, or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *output != outputText && *output != outputJSON {
+		return fmt.Errorf("unknown -output %q (want text or json)", *output)
+	}
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	art, err := loadArtifact(root, *contractRef)
+	if err != nil {
+		return err
+	}
+	raw, err := parseJSONArgs(*ctorArgs)
+	if err != nil {
+		return err
+	}
+	resolved, err := substitute(raw, func(name string) (common.Address, error) {
+		return lookupAddress(root, *network, name)
+	})
+	if err != nil {
+		return err
+	}
+	list, _ := resolved.([]interface{})
+	params, err := convertArgs("constructor", art.ABI.Constructor.Inputs, list)
+	if err != nil {
+		return err
+	}
+	encoded, err := art.constructorArgs(params)
+	if err != nil {
+		return err
+	}
+
+	var want []byte
+	if *compare != "" {
+		if want, err = comparedArgs(root, *network, *compare); err != nil {
+			return err
+		}
+	}
+	sig := signature("constructor", art.ABI.Constructor.Inputs)
+	if *output == outputJSON {
+		out := map[string]interface{}{
+			"contract":  art.Name,
+			"signature": sig,
+			"encoded":   hexutil.Bytes(encoded),
+		}
+		if *compare != "" {
+			out["compared"] = hexutil.Bytes(want)
+			out["match"] = bytes.Equal(encoded, want)
+		}
+		if err := printJSON(out); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintf(os.Stderr, "%s %s\n", art.Name, sig)
+		fmt.Println(hexutil.Encode(encoded))
+		if *words || (*compare != "" && !bytes.Equal(encoded, want)) {
+			if err := printWords(encoded, want, *compare != ""); err != nil {
+				return err
+			}
+		}
+	}
+	if *compare != "" && !bytes.Equal(encoded, want) {
+		return errors.New("encoding differs from -compare")
+	}
+	return nil
+}
+
+// comparedArgs reads -compare: hex, with or without 0x as explorers show
+// it, or the name of a deployment in the registry. Encoded arguments are
+// whole 32-byte words, which tells bare hex from a name.
+func comparedArgs(root, network, s string) ([]byte, error) {
+	digits, prefixed := strings.CutPrefix(s, "0x")
+	if prefixed || (hexDigits.MatchString(digits) && len(digits)%64 == 0) {
+		b, err := hexutil.Decode("0x" + digits)
+		if err != nil {
+			return nil, fmt.Errorf("-compare: %w", err)
+		}
+		return b, nil
+	}
+	reg, err := loadRegistry(root, network)
+	if err != nil {
+		return nil, err
+	}
+	e, err := reg.lookup(s)
+	if err != nil {
+		return nil, err
+	}
+	return e.EncodedArgs, nil
+}
+
+// printWords prints an encoding as 32-byte words with their offsets; with
+// compare, next to the words of want, marking those that differ.
+func printWords(got, want []byte, compare bool) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if compare {
+		fmt.Fprintln(w, "OFFSET\tENCODED\tCOMPARED\t")
+	} else {
+		fmt.Fprintln(w, "OFFSET\tWORD")
+	}
+	word := func(b []byte, i int) string {
+		if i >= len(b) {
+			return "-"
+		}
+		return fmt.Sprintf("%x", b[i:min(i+32, len(b))])
+	}
+	for i := 0; i < max(len(got), len(want)); i += 32 {
+		if !compare {
+			fmt.Fprintf(w, "0x%03x\t%s\n", i, word(got, i))
+			continue
+		}
+		mark := ""
+		if word(got, i) != word(want, i) {
+			mark = "<- differs"
+		}
+		fmt.Fprintf(w, "0x%03x\t%s\t%s\t%s\n", i, word(got, i), word(want, i), mark)
+	}
+	return w.Flush()
+}
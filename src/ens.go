@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// ensRegistryAddress is the ENS registry on Ethereum mainnet, Sepolia and
+// Holesky.
+var ensRegistryAddress = common.HexToAddress("0x00000000000C2E074eC69A0dFb2997BA6C7d2e1e")
+
+var ensABI = mustParseABI(`[
+	{"type":"function","name":"resolver","inputs":[{"name":"node","type":"bytes32"}],"outputs":[{"type":"address"}],"stateMutability":"view"},
+	{"type":"function","name":"addr","inputs":[{"name":"node","type":"bytes32"}],"outputs":[{"type":"address"}],"stateMutability":"view"}
+]`)
+
+// ensNamePattern matches dotted names such as treasury.mydao.eth. Registry
+// names cannot contain dots, so the two never clash.
+var ensNamePattern = regexp.MustCompile(`^[\p{L}\p{N}_-]+(\.[\p{L}\p{N}_-]+)+$`)
+
+func isENSName(s string) bool {
+	return ensNamePattern.MatchString(s)
+}
+
+// namehash is ENS's recursive hash of a name. Names are only lowercased,
+// not fully ENSIP-15 normalized, so they should be written normalized.
+func namehash(name string) common.Hash {
+	var node common.Hash
+	labels := strings.Split(strings.ToLower(name), ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		node = crypto.Keccak256Hash(node.Bytes(), crypto.Keccak256([]byte(labels[i])))
+	}
+	return node
+}
+
+// ensResolver resolves ENS names through a node. Names are resolved once
+// and cached, so every use in a run gets the same address.
+type ensResolver struct {
+	client   *ethclient.Client
+	registry common.Address
+	// book supplies the address book labels that address arguments may
+	// also be written as.
+	book *addressBook
+
+	mu       sync.Mutex
+	resolved map[string]common.Address
+}
+
+func newENSResolver(client *ethclient.Client, registry common.Address) *ensResolver {
+	return &ensResolver{client: client, registry: registry, resolved: map[string]common.Address{}}
+}
+
+// resolve returns the address name's resolver gives for it.
+func (e *ensResolver) resolve(ctx context.Context, name string) (common.Address, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if addr, ok := e.resolved[name]; ok {
+		return addr, nil
+	}
+	node := namehash(name)
+	resolver, err := e.call(ctx, e.registry, "resolver", node)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("ENS name %s: %w", name, err)
+	}
+	if resolver == (common.Address{}) {
+		return common.Address{}, fmt.Errorf("ENS name %s has no resolver", name)
+	}
+	addr, err := e.call(ctx, resolver, "addr", node)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("ENS name %s: resolver %s: %w", name, resolver.Hex(), err)
+	}
+	if addr == (common.Address{}) {
+		return common.Address{}, fmt.Errorf("ENS name %s does not resolve to an address", name)
+	}
+	logger.Info("Resolved ENS name", "name", name, "address", addr)
+	e.resolved[name] = addr
+	return addr, nil
+}
+
+func (e *ensResolver) call(ctx context.Context, to common.Address, method string, node common.Hash) (common.Address, error) {
+	data, err := ensABI.Pack(method, node)
+	if err != nil {
+		return common.Address{}, err
+	}
+	out, err := e.client.CallContract(ctx, ethereum.CallMsg{To: &to, Data: data}, nil)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if len(out) == 0 && to == e.registry {
+		return common.Address{}, fmt.Errorf("no ENS registry at %s on this network; set the network's ensRegistry", to.Hex())
+	}
+	values, err := ensABI.Unpack(method, out)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return values[0].(common.Address), nil
+}
+
+// resolveArgs replaces ENS names given for address inputs, alone or in
+// lists, with the addresses they resolve to, and adds each to names unless
+// it is nil. Values of other types are left alone, so a string argument
+// that looks like a name stays a string.
+func (e *ensResolver) resolveArgs(ctx context.Context, inputs abi.Arguments, args []interface{}, names map[string]common.Address) ([]interface{}, error) {
+	if len(args) != len(inputs) {
+		// convertArgs reports the mismatch.
+		return args, nil
+	}
+	out := make([]interface{}, len(args))
+	for i, in := range inputs {
+		v, err := e.resolveValue(ctx, in.Type, args[i], names)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func (e *ensResolver) resolveValue(ctx context.Context, t abi.Type, v interface{}, names map[string]common.Address) (interface{}, error) {
+	switch t.T {
+	case abi.AddressTy:
+		s, ok := v.(string)
+		if ok && isAddressLabel(s) {
+			addr, err := e.book.resolve(s)
+			if err != nil {
+				return nil, err
+			}
+			return addr.Hex(), nil
+		}
+		if !ok || !isENSName(s) {
+			return v, nil
+		}
+		addr, err := e.resolve(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		if names != nil {
+			names[s] = addr
+		}
+		return addr.Hex(), nil
+	case abi.SliceTy, abi.ArrayTy:
+		list, ok := v.([]interface{})
+		if !ok {
+			return v, nil
+		}
+		out := make([]interface{}, len(list))
+		for i, elem := range list {
+			ev, err := e.resolveValue(ctx, *t.Elem, elem, names)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = ev
+		}
+		return out, nil
+	case abi.TupleTy:
+		switch fields := v.(type) {
+		case map[string]interface{}:
+			out := make(map[string]interface{}, len(fields))
+			for k, field := range fields {
+				out[k] = field
+				if i := slices.Index(t.TupleRawNames, k); i >= 0 {
+					ev, err := e.resolveValue(ctx, *t.TupleElems[i], field, names)
+					if err != nil {
+						return nil, err
+					}
+					out[k] = ev
+				}
+			}
+			return out, nil
+		case []interface{}:
+			if len(fields) != len(t.TupleElems) {
+				return v, nil
+			}
+			out := make([]interface{}, len(fields))
+			for i, field := range fields {
+				ev, err := e.resolveValue(ctx, *t.TupleElems[i], field, names)
+				if err != nil {
+					return nil, err
+				}
+				out[i] = ev
+			}
+			return out, nil
+		}
+	}
+	return v, nil
+}
+
+// resolveMethodArgs is resolveArgs for the inputs of method, which may be
+// a bare name or a full signature. An unknown method is left for
+// encodeCall to report.
+func (e *ensResolver) resolveMethodArgs(ctx context.Context, contract abi.ABI, method string, args []interface{}, names map[string]common.Address) ([]interface{}, error) {
+	m, err := findMethod(contract, method)
+	if err != nil {
+		return args, nil
+	}
+	return e.resolveArgs(ctx, m.Inputs, args, names)
+}
+
+// resolveAddressArg accepts a hex address, an ENS name or an address book
+// label.
+func (e *ensResolver) resolveAddressArg(ctx context.Context, s string) (common.Address, error) {
+	if isENSName(s) {
+		return e.resolve(ctx, s)
+	}
+	if isAddressLabel(s) {
+		return e.book.resolve(s)
+	}
+	return parseAddress(s)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"flag"
+)
+
+// Exit codes, by the kind of failure, so CI can tell a flaky RPC endpoint,
+// which is worth retrying, from a constructor that reverted, which is not.
+const (
+	exitFailure     = 1
+	exitUsage       = 2
+	exitRPC         = 3
+	exitCompile     = 4
+	exitEncoding    = 5
+	exitRevert      = 6
+	exitInterrupted = 130
+)
+
+// rpcError is a request the node did not answer: it could not be reached,
+// timed out or kept failing after the retries.
+type rpcError struct {
+	err error
+}
+
+func (e *rpcError) Error() string { return e.err.Error() }
+func (e *rpcError) Unwrap() error { return e.err }
+
+// compileError is a build of the project's contracts that failed.
+type compileError struct {
+	err error
+}
+
+func (e *compileError) Error() string { return e.err.Error() }
+func (e *compileError) Unwrap() error { return e.err }
+
+// encodingError is an argument or method that does not match the ABI.
+type encodingError struct {
+	err error
+}
+
+func (e *encodingError) Error() string { return e.err.Error() }
+func (e *encodingError) Unwrap() error { return e.err }
+
+// revertError is a call or transaction the EVM reverted. data is the raw
+// revert data, when the node returned it; callError carries the decoded
+// reason.
+type revertError struct {
+	data []byte
+	err  error
+}
+
+func (e *revertError) Error() string { return e.err.Error() }
+func (e *revertError) Unwrap() error { return e.err }
+
+// revertDataOf returns the raw revert data in err's chain, if any.
+func revertDataOf(err error) []byte {
+	var re *revertError
+	if errors.As(err, &re) {
+		return re.data
+	}
+	return nil
+}
+
+// reverted wraps err in a revertError if it is the node reporting a
+// revert, and returns it unchanged otherwise.
+func reverted(err error) error {
+	if err == nil || !isRevert(err) {
+		return err
+	}
+	data, _ := revertData(err)
+	return &revertError{data: data, err: err}
+}
+
+// Kinds of failure, as errorKind reports them.
+const (
+	kindRPC      = "rpc"
+	kindCompile  = "compile"
+	kindEncoding = "encoding"
+	kindRevert   = "revert"
+)
+
+// errorKind classifies err, or returns "" for other failures. A revert
+// wins over the failures wrapping it, or joined with it.
+func errorKind(err error) string {
+	var (
+		re *revertError
+		ce *compileError
+		ee *encodingError
+		pe *rpcError
+	)
+	switch {
+	case errors.As(err, &re):
+		return kindRevert
+	case errors.As(err, &ce):
+		return kindCompile
+	case errors.As(err, &ee):
+		return kindEncoding
+	case errors.As(err, &pe):
+		return kindRPC
+	}
+	return ""
+}
+
+// exitCode returns the exit code for a command's error. Interrupting a
+// command wins over whatever it then failed with.
+func exitCode(err error, interrupted bool) int {
+	if interrupted {
+		return exitInterrupted
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return exitUsage
+	}
+	switch errorKind(err) {
+	case kindRevert:
+		return exitRevert
+	case kindCompile:
+		return exitCompile
+	case kindEncoding:
+		return exitEncoding
+	case kindRPC:
+		return exitRPC
+	}
+	return exitFailure
+}
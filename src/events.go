@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	logPollInterval = 2 * time.Second
+	// maxLogRange caps the blocks per eth_getLogs request; most hosted
+	// providers reject larger ranges.
+	maxLogRange = 5000
+)
+
+// contractEvent is a log decoded against the contract's ABI.
+type contractEvent struct {
+	Name string
+	// Args holds every event input by name. Indexed dynamic values such as
+	// strings are only available as their keccak256 hash.
+	Args map[string]interface{}
+	Log  types.Log
+
+	event abi.Event
+}
+
+// Decode copies the event's arguments into out, a pointer to a struct whose
+// fields are named after the inputs (e.g. ProposalId for proposalId).
+func (e *contractEvent) Decode(out interface{}) error {
+	nonIndexed := e.event.Inputs.NonIndexed()
+	values, err := nonIndexed.Unpack(e.Log.Data)
+	if err != nil {
+		return err
+	}
+	if len(values) > 0 {
+		if err := nonIndexed.Copy(out, values); err != nil {
+			return err
+		}
+	}
+	return abi.ParseTopics(out, indexedInputs(e.event), e.Log.Topics[1:])
+}
+
+func indexedInputs(ev abi.Event) abi.Arguments {
+	var indexed abi.Arguments
+	for _, in := range ev.Inputs {
+		if in.Indexed {
+			indexed = append(indexed, in)
+		}
+	}
+	return indexed
+}
+
+// WatchEvent sends each new name event emitted by the contract to ch until
+// ctx is done. It subscribes over websocket and IPC endpoints, resubscribing
+// and catching up on missed blocks when the connection drops, and polls
+// eth_getLogs over HTTP.
+func (c *boundContract) WatchEvent(ctx context.Context, name string, ch chan<- contractEvent) error {
+	return c.WatchEventFrom(ctx, nil, name, ch)
+}
+
+// WatchEventFrom is WatchEvent starting with past events from block from;
+// nil means only new events.
+func (c *boundContract) WatchEventFrom(ctx context.Context, from *big.Int, name string, ch chan<- contractEvent) error {
+	ev, ok := c.ABI.Events[name]
+	if !ok {
+		return fmt.Errorf("no event %q in ABI", name)
+	}
+	q := ethereum.FilterQuery{Addresses: []common.Address{c.Address}, Topics: [][]common.Hash{{ev.ID}}}
+
+	// Subscribe before reading history so nothing is missed in between.
+	logs := make(chan types.Log, 64)
+	sub, err := c.client.SubscribeFilterLogs(ctx, q, logs)
+	if errors.Is(err, rpc.ErrNotificationsUnsupported) {
+		return c.pollLogs(ctx, q, from, ev, ch)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() { sub.Unsubscribe() }()
+
+	// seen is the last block whose logs were read by eth_getLogs; the
+	// subscription may deliver them again.
+	head, err := c.client.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	var seen uint64
+	if from != nil {
+		if err := c.emitRange(ctx, q, from.Uint64(), head, ev, ch); err != nil {
+			return err
+		}
+		seen = head
+	}
+	last := head
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-sub.Err():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			logger.Warn("Event subscription dropped, resubscribing", "event", name, "err", err)
+			if sub, err = resubscribe(ctx, func() (ethereum.Subscription, error) {
+				return c.client.SubscribeFilterLogs(ctx, q, logs)
+			}); err != nil {
+				return err
+			}
+			// Catch up on the blocks mined while disconnected.
+			if head, err = c.client.BlockNumber(ctx); err != nil {
+				return err
+			}
+			if head > last {
+				if err := c.emitRange(ctx, q, last+1, head, ev, ch); err != nil {
+					return err
+				}
+				seen, last = head, head
+			}
+		case l := <-logs:
+			last = max(last, l.BlockNumber)
+			if l.BlockNumber <= seen && !l.Removed {
+				continue
+			}
+			if err := c.emit(ctx, ev, l, ch); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// pollLogs watches for events by querying each new block range.
+func (c *boundContract) pollLogs(ctx context.Context, q ethereum.FilterQuery, from *big.Int, ev abi.Event, ch chan<- contractEvent) error {
+	head, err := c.client.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	next := head + 1
+	if from != nil {
+		next = from.Uint64()
+	}
+	for {
+		if head >= next {
+			if err := c.emitRange(ctx, q, next, head, ev, ch); err != nil {
+				return err
+			}
+			next = head + 1
+		}
+		if err := sleepCtx(ctx, logPollInterval); err != nil {
+			return err
+		}
+		if head, err = c.client.BlockNumber(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// emitRange sends the matching logs in blocks [from, to], in chunks of at
+// most maxLogRange blocks.
+func (c *boundContract) emitRange(ctx context.Context, q ethereum.FilterQuery, from, to uint64, ev abi.Event, ch chan<- contractEvent) error {
+	for start := from; start <= to; start += maxLogRange {
+		end := min(start+maxLogRange-1, to)
+		q.FromBlock, q.ToBlock = new(big.Int).SetUint64(start), new(big.Int).SetUint64(end)
+		logs, err := c.client.FilterLogs(ctx, q)
+		if err != nil {
+			return fmt.Errorf("get logs %d-%d: %w", start, end, err)
+		}
+		for _, l := range logs {
+			if err := c.emit(ctx, ev, l, ch); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *boundContract) emit(ctx context.Context, ev abi.Event, l types.Log, ch chan<- contractEvent) error {
+	e, err := decodeLog(ev, l)
+	if err != nil {
+		return err
+	}
+	select {
+	case ch <- *e:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// parseEvent decodes l as the named event, for generated bindings.
+func (c *boundContract) parseEvent(name string, l types.Log) (*contractEvent, error) {
+	ev, ok := c.ABI.Events[name]
+	if !ok {
+		return nil, fmt.Errorf("no event %q in ABI", name)
+	}
+	return decodeLog(ev, l)
+}
+
+// decodeLog decodes l as an instance of ev.
+func decodeLog(ev abi.Event, l types.Log) (*contractEvent, error) {
+	if len(l.Topics) == 0 || l.Topics[0] != ev.ID {
+		return nil, fmt.Errorf("log %s:%d is not a %s event", l.TxHash.Hex(), l.Index, ev.Name)
+	}
+	args := map[string]interface{}{}
+	if err := ev.Inputs.NonIndexed().UnpackIntoMap(args, l.Data); err != nil {
+		return nil, fmt.Errorf("decode %s data: %w", ev.Name, err)
+	}
+	if err := abi.ParseTopicsIntoMap(args, indexedInputs(ev), l.Topics[1:]); err != nil {
+		return nil, fmt.Errorf("decode %s topics: %w", ev.Name, err)
+	}
+	return &contractEvent{Name: ev.Name, Args: args, Log: l, event: ev}, nil
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// etherscanAPI is Etherscan's multichain endpoint; the chain is selected
+// with the chainid parameter.
+const etherscanAPI = "https://api.etherscan.io/v2/api"
+
+// explorerConfig enables source verification on an Etherscan-compatible
+// explorer (Etherscan, Blockscout, ...) after each deployment:
+//
+//	networks:
+//	  sepolia:
+//	    rpc: ${SEPOLIA_RPC_URL}
+//	    explorer:
+//	      apiKey: ${ETHERSCAN_API_KEY}
+type explorerConfig struct {
+	// API defaults to Etherscan's v2 API. Blockscout instances serve the
+	// same API under https://<host>/api.
+	API    string `yaml:"api"`
+	APIKey string `yaml:"apiKey"`
+	// Flatten submits single-file sources straight away, for explorers
+	// that do not take standard JSON input. Otherwise they are only the
+	// fallback when standard JSON verification fails.
+	Flatten bool `yaml:"flatten"`
+}
+
+// explorerClient talks to the contract verification endpoints.
+type explorerClient struct {
+	api     string
+	apiKey  string
+	chainID uint64
+	flatten bool
+	http    *http.Client
+	// retryDelay is how long to wait between submission attempts while the
+	// explorer has not indexed the contract yet, and between status polls.
+	retryDelay time.Duration
+	attempts   int
+}
+
+func newExplorerClient(c explorerConfig, chainID uint64) *explorerClient {
+	api := os.ExpandEnv(c.API)
+	if api == "" {
+		api = etherscanAPI
+	}
+	return &explorerClient{
+		api:        api,
+		apiKey:     os.ExpandEnv(c.APIKey),
+		chainID:    chainID,
+		flatten:    c.Flatten,
+		http:       &http.Client{Timeout: 30 * time.Second},
+		retryDelay: 5 * time.Second,
+		attempts:   12,
+	}
+}
+
+type explorerResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Result  string `json:"result"`
+}
+
+// verify submits art's sources as standard JSON input along with the
+// ABI-encoded constructor arguments and waits until the explorer reports
+// the outcome. If the explorer rejects them, or is configured to, the
+// flattened sources are submitted as a single file instead.
+func (c *explorerClient) verify(ctx context.Context, root string, art *artifact, addr common.Address, ctorArgs []byte) error {
+	if art.Metadata == nil {
+		return fmt.Errorf("%s has no compiler metadata; rebuild with forge", art.Name)
+	}
+	if c.flatten {
+		return c.verifyFlattened(ctx, root, art, addr, ctorArgs)
+	}
+	input, err := standardJSONInput(root, art.Metadata, art.Libraries)
+	if err != nil {
+		return err
+	}
+	target, err := art.Metadata.compilationTarget()
+	if err != nil {
+		return err
+	}
+	form := url.Values{
+		"module":                {"contract"},
+		"action":                {"verifysourcecode"},
+		"contractaddress":       {addr.Hex()},
+		"sourceCode":            {string(input)},
+		"codeformat":            {"solidity-standard-json-input"},
+		"contractname":          {target},
+		"compilerversion":       {"v" + art.Metadata.Compiler.Version},
+		"constructorArguements": {hex.EncodeToString(ctorArgs)}, // sic
+	}
+	err = c.submit(ctx, form)
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+	logger.Warn("Standard JSON verification failed; trying the flattened source", "contract", art.Name, "address", addr, "err", err)
+	if flatErr := c.verifyFlattened(ctx, root, art, addr, ctorArgs); flatErr != nil {
+		return fmt.Errorf("%w; flattened: %v", err, flatErr)
+	}
+	return nil
+}
+
+// verifyFlattened submits art's sources as one flattened file, with the
+// compiler settings the explorer's single-file form takes.
+func (c *explorerClient) verifyFlattened(ctx context.Context, root string, art *artifact, addr common.Address, ctorArgs []byte) error {
+	settings := art.Metadata.Settings
+	var viaIR bool
+	json.Unmarshal(settings["viaIR"], &viaIR)
+	if viaIR {
+		return errors.New("contracts built with viaIR can only be verified from standard JSON input")
+	}
+	source, err := flattenSources(root, art)
+	if err != nil {
+		return err
+	}
+	var optimizer struct {
+		Enabled bool `json:"enabled"`
+		Runs    int  `json:"runs"`
+	}
+	json.Unmarshal(settings["optimizer"], &optimizer)
+	var evmVersion string
+	json.Unmarshal(settings["evmVersion"], &evmVersion)
+	form := url.Values{
+		"module":                {"contract"},
+		"action":                {"verifysourcecode"},
+		"contractaddress":       {addr.Hex()},
+		"sourceCode":            {source},
+		"codeformat":            {"solidity-single-file"},
+		"contractname":          {art.Name},
+		"compilerversion":       {"v" + art.Metadata.Compiler.Version},
+		"optimizationUsed":      {"0"},
+		"runs":                  {strconv.Itoa(optimizer.Runs)},
+		"constructorArguements": {hex.EncodeToString(ctorArgs)}, // sic
+	}
+	if optimizer.Enabled {
+		form.Set("optimizationUsed", "1")
+	}
+	if evmVersion != "" {
+		form.Set("evmversion", evmVersion)
+	}
+	libraries := map[string]string{}
+	if raw, ok := settings["libraries"]; ok {
+		if err := json.Unmarshal(raw, &libraries); err != nil {
+			return fmt.Errorf("metadata libraries: %w", err)
+		}
+	}
+	for key, addr := range art.Libraries {
+		libraries[key] = addr.Hex()
+	}
+	for i, key := range sortedKeys(libraries) {
+		_, name, _ := strings.Cut(key, ":")
+		n := strconv.Itoa(i + 1)
+		form.Set("libraryname"+n, name)
+		form.Set("libraryaddress"+n, libraries[key])
+	}
+	return c.submit(ctx, form)
+}
+
+// submit posts a verification request and waits until the explorer
+// reports the outcome.
+func (c *explorerClient) submit(ctx context.Context, form url.Values) error {
+	var guid string
+	for attempt := 1; ; attempt++ {
+		resp, err := c.post(ctx, form)
+		if err != nil {
+			return err
+		}
+		if resp.Status == "1" {
+			guid = resp.Result
+			break
+		}
+		if alreadyVerified(resp.Result) {
+			return nil
+		}
+		// Freshly deployed contracts take a few blocks to be indexed.
+		if !notIndexedYet(resp.Result) || attempt == c.attempts {
+			return fmt.Errorf("submit verification: %s", resp.Result)
+		}
+		if err := sleepCtx(ctx, c.retryDelay); err != nil {
+			return err
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		if err := sleepCtx(ctx, c.retryDelay); err != nil {
+			return err
+		}
+		resp, err := c.get(ctx, url.Values{"module": {"contract"}, "action": {"checkverifystatus"}, "guid": {guid}})
+		if err != nil {
+			return err
+		}
+		switch {
+		case resp.Status == "1" || alreadyVerified(resp.Result):
+			return nil
+		case strings.Contains(strings.ToLower(resp.Result), "pending"):
+			if attempt == c.attempts {
+				return fmt.Errorf("verification still pending after %d checks (guid %s)", attempt, guid)
+			}
+		default:
+			return fmt.Errorf("verification failed: %s", resp.Result)
+		}
+	}
+}
+
+func alreadyVerified(result string) bool {
+	return strings.Contains(strings.ToLower(result), "already verified")
+}
+
+func notIndexedYet(result string) bool {
+	r := strings.ToLower(result)
+	return strings.Contains(r, "unable to locate contractcode") || strings.Contains(r, "does not have bytecode")
+}
+
+func (c *explorerClient) post(ctx context.Context, form url.Values) (*explorerResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint(nil), strings.NewReader(c.withKey(form).Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.do(req)
+}
+
+func (c *explorerClient) get(ctx context.Context, query url.Values) (*explorerResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint(c.withKey(query)), nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
+
+func (c *explorerClient) withKey(v url.Values) url.Values {
+	if c.apiKey != "" {
+		v.Set("apikey", c.apiKey)
+	}
+	return v
+}
+
+func (c *explorerClient) endpoint(query url.Values) string {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("chainid", strconv.FormatUint(c.chainID, 10))
+	sep := "?"
+	if strings.Contains(c.api, "?") {
+		sep = "&"
+	}
+	return c.api + sep + query.Encode()
+}
+
+func (c *explorerClient) do(req *http.Request) (*explorerResponse, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("explorer: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("explorer: http status %s", resp.Status)
+	}
+	var out explorerResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("explorer: decode response: %w", err)
+	}
+	return &out, nil
+}
+
+// standardJSONInput rebuilds the solc standard JSON input that produced
+// meta, reading the sources from the project tree. linked adds libraries
+// that were linked at deploy time rather than compile time.
+func standardJSONInput(root string, meta *compilerMetadata, linked map[string]common.Address) ([]byte, error) {
+	sources := make(map[string]map[string]string, len(meta.Sources))
+	for path := range meta.Sources {
+		content, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(path)))
+		if err != nil {
+			return nil, fmt.Errorf("read source %s: %w", path, err)
+		}
+		sources[path] = map[string]string{"content": string(content)}
+	}
+
+	settings := make(map[string]json.RawMessage, len(meta.Settings))
+	for k, v := range meta.Settings {
+		if k != "compilationTarget" {
+			settings[k] = v
+		}
+	}
+	// Metadata lists libraries as "path:Name": address, standard JSON input
+	// nests them as path: {Name: address}. Libraries linked after
+	// compilation are added so the explorer compiles the same code.
+	if raw, ok := settings["libraries"]; ok || len(linked) > 0 {
+		flat := map[string]string{}
+		if ok {
+			if err := json.Unmarshal(raw, &flat); err != nil {
+				return nil, fmt.Errorf("metadata libraries: %w", err)
+			}
+		}
+		for key, addr := range linked {
+			flat[key] = addr.Hex()
+		}
+		nested := map[string]map[string]string{}
+		for key, addr := range flat {
+			path, name, ok := strings.Cut(key, ":")
+			if !ok {
+				return nil, fmt.Errorf("metadata library %q has no source path", key)
+			}
+			if nested[path] == nil {
+				nested[path] = map[string]string{}
+			}
+			nested[path][name] = addr
+		}
+		encoded, err := json.Marshal(nested)
+		if err != nil {
+			return nil, err
+		}
+		settings["libraries"] = encoded
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"language": meta.Language,
+		"sources":  sources,
+		"settings": settings,
+	})
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
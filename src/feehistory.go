@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	// feeSampleBlocks is how many blocks of each hour eth_feeHistory is
+	// asked about. Nodes cap the range of one request at 1024 blocks, and
+	// a sample is enough for percentiles even on chains with fast blocks.
+	feeSampleBlocks = 128
+	// defaultMaxWait bounds -wait-base-fee without a -wait-timeout.
+	defaultMaxWait = 24 * time.Hour
+)
+
+// feePercentiles are the base fee percentiles the fees command reports.
+var feePercentiles = []int{10, 25, 50, 75, 90}
+
+// feeHour is the fees sampled from one hour of blocks.
+type feeHour struct {
+	// Ago is how many hours before the head the hour ends.
+	Ago     int       `json:"hoursAgo"`
+	Start   time.Time `json:"start"`
+	Blocks  int       `json:"blocks"`
+	Min     *big.Int  `json:"minBaseFee"`
+	Median  *big.Int  `json:"medianBaseFee"`
+	Max     *big.Int  `json:"maxBaseFee"`
+	Tip     *big.Int  `json:"medianTip,omitempty"`
+	baseFee []*big.Int
+}
+
+// feeReport is the fees command's analysis of recent base fees.
+type feeReport struct {
+	ChainID   uint64  `json:"chainId"`
+	Block     uint64  `json:"block"`
+	BlockTime float64 `json:"blockTimeSeconds"`
+	Hours     int     `json:"hours"`
+	// BaseFee is the base fee of the next block; Rank is the percentage
+	// of sampled blocks that were cheaper.
+	BaseFee     *big.Int         `json:"baseFee"`
+	Rank        int              `json:"rank"`
+	Percentiles map[int]*big.Int `json:"percentiles"`
+	Tip         *big.Int         `json:"medianTip,omitempty"`
+	History     []feeHour        `json:"history"`
+	// Cheapest are the hours of the day, UTC, with the lowest median base
+	// fee, cheapest first.
+	Cheapest []int `json:"cheapestHoursUTC"`
+}
+
+func runFees(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("fees", &rpcURL)
+	hours := fs.Int("hours", 24, "how many hours of blocks to analyze; a week (168) shows the daily pattern best")
+	output := fs.String("output", outputText, "text, or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *hours < 1 {
+		return errors.New("-hours must be at least 1")
+	}
+	if *output != outputText && *output != outputJSON {
+		return fmt.Errorf("unknown -output %q (want text or json)", *output)
+	}
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	report, err := analyzeFees(ctx, client, *hours)
+	if err != nil {
+		return err
+	}
+	if *output == outputJSON {
+		return printJSON(report)
+	}
+	report.print()
+	return nil
+}
+
+// analyzeFees samples eth_feeHistory for each of the last hours, placing
+// blocks in time by the average block time, which it measures from the
+// timestamps of the head and an older block.
+func analyzeFees(ctx context.Context, client *ethclient.Client, hours int) (*feeReport, error) {
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	head, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if head.BaseFee == nil {
+		return nil, errors.New("the chain has no EIP-1559 base fee")
+	}
+	blockTime, err := averageBlockTime(ctx, client, head.Number.Uint64(), head.Time)
+	if err != nil {
+		return nil, err
+	}
+	r := &feeReport{ChainID: chainID.Uint64(), Block: head.Number.Uint64(), BlockTime: blockTime, Hours: hours, Percentiles: map[int]*big.Int{}}
+	perHour := max(uint64(3600/blockTime), 1)
+	headTime := time.Unix(int64(head.Time), 0).UTC()
+
+	var all, tips []*big.Int
+	for ago := 0; ago < hours; ago++ {
+		last := head.Number.Uint64() - min(head.Number.Uint64(), uint64(ago)*perHour)
+		if last == 0 {
+			break
+		}
+		count := min(perHour, feeSampleBlocks, last)
+		history, err := client.FeeHistory(ctx, count, new(big.Int).SetUint64(last), []float64{50})
+		if err != nil {
+			return nil, fmt.Errorf("eth_feeHistory: %w", err)
+		}
+		// BaseFee ends with the fee of the block after the range.
+		h := feeHour{Ago: ago, Start: headTime.Add(-time.Duration(ago+1) * time.Hour), baseFee: history.BaseFee[:len(history.BaseFee)-1]}
+		if ago == 0 {
+			r.BaseFee = history.BaseFee[len(history.BaseFee)-1]
+		}
+		if len(h.baseFee) == 0 {
+			continue
+		}
+		var hourTips []*big.Int
+		for _, reward := range history.Reward {
+			if len(reward) > 0 {
+				hourTips = append(hourTips, reward[0])
+			}
+		}
+		sorted := sortedFees(h.baseFee)
+		h.Blocks, h.Min, h.Median, h.Max = len(sorted), sorted[0], percentile(sorted, 50), sorted[len(sorted)-1]
+		if len(hourTips) > 0 {
+			h.Tip = percentile(sortedFees(hourTips), 50)
+		}
+		r.History = append(r.History, h)
+		all = append(all, h.baseFee...)
+		tips = append(tips, hourTips...)
+	}
+	if len(all) == 0 {
+		return nil, errors.New("no blocks to analyze")
+	}
+	all = sortedFees(all)
+	for _, p := range feePercentiles {
+		r.Percentiles[p] = percentile(all, p)
+	}
+	if len(tips) > 0 {
+		r.Tip = percentile(sortedFees(tips), 50)
+	}
+	cheaper := sort.Search(len(all), func(i int) bool { return all[i].Cmp(r.BaseFee) >= 0 })
+	r.Rank = cheaper * 100 / len(all)
+	r.Cheapest = cheapestHours(r.History)
+	return r, nil
+}
+
+// averageBlockTime measures the chain's block time in seconds over up to
+// the last 10000 blocks.
+func averageBlockTime(ctx context.Context, client *ethclient.Client, number, timestamp uint64) (float64, error) {
+	span := min(number, 10000)
+	if span == 0 {
+		return 12, nil
+	}
+	old, err := client.HeaderByNumber(ctx, new(big.Int).SetUint64(number-span))
+	if err != nil {
+		return 0, err
+	}
+	seconds := float64(timestamp-old.Time) / float64(span)
+	if seconds <= 0 {
+		// Blocks sharing a timestamp, as on a devnet mining on demand.
+		seconds = 1
+	}
+	return seconds, nil
+}
+
+// cheapestHours ranks the hours of the day (UTC) by the median of their
+// sampled base fees over the days analyzed.
+func cheapestHours(history []feeHour) []int {
+	byHour := map[int][]*big.Int{}
+	for _, h := range history {
+		hour := h.Start.Add(30 * time.Minute).Hour()
+		byHour[hour] = append(byHour[hour], h.baseFee...)
+	}
+	medians := map[int]*big.Int{}
+	hours := make([]int, 0, len(byHour))
+	for hour, fees := range byHour {
+		medians[hour] = percentile(sortedFees(fees), 50)
+		hours = append(hours, hour)
+	}
+	sort.Slice(hours, func(i, j int) bool {
+		if c := medians[hours[i]].Cmp(medians[hours[j]]); c != 0 {
+			return c < 0
+		}
+		return hours[i] < hours[j]
+	})
+	return hours
+}
+
+func sortedFees(fees []*big.Int) []*big.Int {
+	sorted := slices.Clone(fees)
+	slices.SortFunc(sorted, func(a, b *big.Int) int { return a.Cmp(b) })
+	return sorted
+}
+
+// percentile returns the p-th percentile of sorted, by nearest rank.
+func percentile(sorted []*big.Int, p int) *big.Int {
+	i := (len(sorted)*p + 99) / 100
+	return sorted[max(i-1, 0)]
+}
+
+func (r *feeReport) print() {
+	name := ""
+	if info, ok := chainMetadata[r.ChainID]; ok {
+		name = " (" + info.Name + ")"
+	}
+	fmt.Printf("Chain %d%s at block %d, one block every %.1fs\n", r.ChainID, name, r.Block, r.BlockTime)
+	fmt.Printf("Base fee now: %s, above %d%% of the blocks in the last %d hours\n", formatGwei(r.BaseFee), r.Rank, r.Hours)
+	fmt.Print("Base fee percentiles:")
+	for _, p := range feePercentiles {
+		fmt.Printf("  p%d %s", p, formatGwei(r.Percentiles[p]))
+	}
+	fmt.Println()
+	if r.Tip != nil {
+		fmt.Println("Median priority fee:", formatGwei(r.Tip))
+	}
+
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HOURS AGO\tFROM (UTC)\tMIN\tMEDIAN\tMAX\tTIP")
+	for _, h := range r.History {
+		tip := "-"
+		if h.Tip != nil {
+			tip = formatGwei(h.Tip)
+		}
+		fmt.Fprintf(w, "%d-%d\t%s\t%s\t%s\t%s\t%s\n", h.Ago, h.Ago+1, h.Start.Format("Jan 02 15:04"), formatGwei(h.Min), formatGwei(h.Median), formatGwei(h.Max), tip)
+	}
+	w.Flush()
+
+	fmt.Println()
+	if len(r.Cheapest) > 0 && r.Hours >= 24 {
+		fmt.Print("Cheapest hours (UTC):")
+		for _, hour := range r.Cheapest[:min(3, len(r.Cheapest))] {
+			fmt.Printf(" %02d:00", hour)
+		}
+		fmt.Println()
+	}
+	median := r.Percentiles[50]
+	if r.BaseFee.Cmp(median) <= 0 {
+		fmt.Println("The base fee is at or below its median: a good time to send.")
+	} else {
+		fmt.Printf("The base fee is above its median. For a large deployment that can wait, pass -wait-base-fee %s\n", gweiAmount(median))
+		fmt.Println("to hold each transaction back until the base fee drops to it.")
+	}
+}
+
+// waitForBaseFee holds a transaction back until the latest block's base
+// fee is at most g's waitBaseFee, checking at every block, and fails once
+// the wait exceeds its timeout. The next block's fee moves by at most an
+// eighth from it.
+func (r *networkRun) waitForBaseFee(ctx context.Context, g gasConfig) error {
+	threshold, _ := parseWei(g.WaitBaseFee)
+	timeout := g.WaitTimeout
+	if timeout == 0 {
+		timeout = defaultMaxWait
+	}
+	heads, unsubscribe := subscribeHeads(ctx, r.client)
+	defer unsubscribe()
+	ticker := time.NewTicker(receiptPollInterval)
+	defer ticker.Stop()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	start := time.Now()
+	var baseFee *big.Int
+	for {
+		head, err := r.client.HeaderByNumber(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if head.BaseFee == nil {
+			return errors.New("waitBaseFee: the chain has no EIP-1559 base fee")
+		}
+		if head.BaseFee.Cmp(threshold) <= 0 {
+			if baseFee != nil {
+				logger.Info("Base fee dropped, sending", "network", r.name, "baseFee", formatGwei(head.BaseFee), "waited", time.Since(start).Round(time.Second))
+			}
+			return nil
+		}
+		if baseFee == nil {
+			logger.Info("Base fee is above waitBaseFee, waiting for it to drop", "network", r.name, "baseFee", formatGwei(head.BaseFee), "threshold", formatGwei(threshold), "timeout", timeout)
+		}
+		baseFee = head.BaseFee
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			return fmt.Errorf("base fee stayed above %s for %s (now %s); raise the threshold or send later", formatGwei(threshold), timeout, formatGwei(baseFee))
+		case <-heads:
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+)
+
+// defaultGasBuffer is added on top of eth_estimateGas so small state
+// changes between estimation and inclusion don't run the deployment out
+// of gas.
+const defaultGasBuffer = 20
+
+// gasConfig controls gas and fees for one deployment. Amounts accept the
+// same units as value ("30gwei", "0.05ether"). Setting price selects a
+// legacy transaction; otherwise EIP-1559 fees are used where the chain
+// supports them.
+type gasConfig struct {
+	Limit uint64 `yaml:"limit"`
+	Price string `yaml:"price"`
+
+	MaxFeePerGas         string `yaml:"maxFeePerGas"`
+	MaxPriorityFeePerGas string `yaml:"maxPriorityFeePerGas"`
+	// MaxFeePerBlobGas caps the blob fee of blob transactions (default:
+	// 2x the current blob base fee).
+	MaxFeePerBlobGas string `yaml:"maxFeePerBlobGas"`
+
+	// BufferPercent is added to the estimated gas limit; nil means the
+	// default of 20%.
+	BufferPercent *uint64 `yaml:"bufferPercent"`
+	// MaxCost aborts the deployment if gas limit times the maximum fee per
+	// gas would exceed it.
+	MaxCost string `yaml:"maxCost"`
+	// AccessList attaches an EIP-2930 access list, from
+	// eth_createAccessList, to transactions to a contract when it lowers
+	// their gas.
+	AccessList *bool `yaml:"accessList"`
+	// WaitBaseFee holds each transaction back until the base fee is at or
+	// below it, for large deployments that are not urgent; the fees
+	// command suggests a value. WaitTimeout bounds the wait (default
+	// 24h), after which the run fails.
+	WaitBaseFee string        `yaml:"waitBaseFee"`
+	WaitTimeout time.Duration `yaml:"waitTimeout"`
+}
+
+// addGasFlags registers gas and fee flags on fs. Set flags take precedence
+// over the manifest's default gas settings.
+func addGasFlags(fs *flag.FlagSet) *gasConfig {
+	g := &gasConfig{}
+	fs.Uint64Var(&g.Limit, "gas-limit", 0, "gas limit (default: estimated plus -gas-buffer)")
+	fs.StringVar(&g.Price, "gas-price", "", "legacy gas price; disables EIP-1559 fees")
+	fs.StringVar(&g.MaxFeePerGas, "max-fee", "", "EIP-1559 max fee per gas (default: 2x base fee + tip)")
+	fs.StringVar(&g.MaxPriorityFeePerGas, "priority-fee", "", "EIP-1559 max priority fee per gas (default: node suggestion)")
+	fs.StringVar(&g.MaxFeePerBlobGas, "max-blob-fee", "", "max fee per blob gas for blob transactions (default: 2x blob base fee)")
+	fs.Func("gas-buffer", "percent added to estimated gas (default 20)", func(v string) error {
+		n, err := strconv.ParseUint(v, 10, 64)
+		g.BufferPercent = &n
+		return err
+	})
+	fs.StringVar(&g.MaxCost, "max-cost", "", "abort a deployment whose worst-case cost exceeds this (e.g. 0.05ether)")
+	fs.BoolFunc("access-list", "attach an EIP-2930 access list to calls when it saves gas", func(v string) error {
+		on, err := strconv.ParseBool(v)
+		g.AccessList = &on
+		return err
+	})
+	fs.StringVar(&g.WaitBaseFee, "wait-base-fee", "", "hold each transaction back until the base fee is at most this (e.g. 8gwei); see the fees command")
+	fs.DurationVar(&g.WaitTimeout, "wait-timeout", 0, "with -wait-base-fee, how long to wait before failing (default 24h)")
+	return g
+}
+
+func (g gasConfig) validate() error {
+	for name, v := range map[string]string{
+		"price":                g.Price,
+		"maxFeePerGas":         g.MaxFeePerGas,
+		"maxPriorityFeePerGas": g.MaxPriorityFeePerGas,
+		"maxFeePerBlobGas":     g.MaxFeePerBlobGas,
+		"maxCost":              g.MaxCost,
+		"waitBaseFee":          g.WaitBaseFee,
+	} {
+		if _, err := parseWei(v); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if g.Price != "" && (g.MaxFeePerGas != "" || g.MaxPriorityFeePerGas != "") {
+		return fmt.Errorf("price cannot be combined with EIP-1559 fees")
+	}
+	return nil
+}
+
+// merge fills fields unset in g from defaults.
+func (g gasConfig) merge(defaults gasConfig) gasConfig {
+	if g.Limit == 0 {
+		g.Limit = defaults.Limit
+	}
+	if g.Price == "" && g.MaxFeePerGas == "" && g.MaxPriorityFeePerGas == "" {
+		g.Price = defaults.Price
+		g.MaxFeePerGas = defaults.MaxFeePerGas
+		g.MaxPriorityFeePerGas = defaults.MaxPriorityFeePerGas
+	}
+	if g.MaxFeePerBlobGas == "" {
+		g.MaxFeePerBlobGas = defaults.MaxFeePerBlobGas
+	}
+	if g.BufferPercent == nil {
+		g.BufferPercent = defaults.BufferPercent
+	}
+	if g.MaxCost == "" {
+		g.MaxCost = defaults.MaxCost
+	}
+	if g.AccessList == nil {
+		g.AccessList = defaults.AccessList
+	}
+	if g.WaitBaseFee == "" {
+		g.WaitBaseFee = defaults.WaitBaseFee
+	}
+	if g.WaitTimeout == 0 {
+		g.WaitTimeout = defaults.WaitTimeout
+	}
+	return g
+}
+
+func (g gasConfig) buffer() uint64 {
+	if g.BufferPercent == nil {
+		return defaultGasBuffer
+	}
+	return *g.BufferPercent
+}
+
+// fees are the per-gas prices for a transaction. GasPrice is set for legacy
+// transactions, TipCap and FeeCap for EIP-1559 ones.
+type fees struct {
+	GasPrice *big.Int
+	TipCap   *big.Int
+	FeeCap   *big.Int
+	// L1Fee is a rollup's estimated fee for the transaction's L1 data,
+	// paid on top of gas.
+	L1Fee *big.Int
+	// BlobFeeCap is the most a blob transaction pays per unit of its
+	// BlobGas, which is priced apart from gas.
+	BlobFeeCap *big.Int
+	BlobGas    uint64
+}
+
+func (f fees) dynamic() bool {
+	return f.FeeCap != nil
+}
+
+// maxPrice is the most the transaction can pay per unit of gas.
+func (f fees) maxPrice() *big.Int {
+	if f.dynamic() {
+		return f.FeeCap
+	}
+	return f.GasPrice
+}
+
+// maxCost is the most a transaction with gas can cost at f, L1 data and
+// blob fees included.
+func (f fees) maxCost(gas uint64) *big.Int {
+	cost := new(big.Int)
+	if p := f.maxPrice(); p != nil {
+		cost.Mul(new(big.Int).SetUint64(gas), p)
+	}
+	if f.L1Fee != nil {
+		cost.Add(cost, f.L1Fee)
+	}
+	if f.BlobFeeCap != nil {
+		cost.Add(cost, f.blobCost())
+	}
+	return cost
+}
+
+// blobCost is the most the transaction's blobs can cost.
+func (f fees) blobCost() *big.Int {
+	return new(big.Int).Mul(new(big.Int).SetUint64(f.BlobGas), f.BlobFeeCap)
+}
+
+// quoteFees resolves g's fee settings against the chain. Unset EIP-1559
+// fees default to the node's suggested tip and a fee cap of twice the
+// current base fee plus the tip, which survives several full blocks.
+func (r *networkRun) quoteFees(ctx context.Context, g gasConfig) (fees, error) {
+	if g.Price != "" {
+		price, _ := parseWei(g.Price)
+		return fees{GasPrice: price}, nil
+	}
+	head, err := r.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return fees{}, err
+	}
+	if head.BaseFee == nil {
+		if g.MaxFeePerGas != "" || g.MaxPriorityFeePerGas != "" {
+			return fees{}, fmt.Errorf("network does not support EIP-1559 fees; set gas price instead")
+		}
+		price, err := r.client.SuggestGasPrice(ctx)
+		return fees{GasPrice: price}, err
+	}
+
+	var f fees
+	if g.MaxPriorityFeePerGas != "" {
+		f.TipCap, _ = parseWei(g.MaxPriorityFeePerGas)
+	} else if f.TipCap, err = r.client.SuggestGasTipCap(ctx); err != nil {
+		return fees{}, err
+	}
+	if g.MaxFeePerGas != "" {
+		f.FeeCap, _ = parseWei(g.MaxFeePerGas)
+	} else {
+		f.FeeCap = new(big.Int).Add(new(big.Int).Mul(head.BaseFee, big.NewInt(2)), f.TipCap)
+	}
+	if f.FeeCap.Cmp(f.TipCap) < 0 {
+		return fees{}, fmt.Errorf("maxFeePerGas %s is below maxPriorityFeePerGas %s", f.FeeCap, f.TipCap)
+	}
+	return f, nil
+}
+
+// withBuffer adds percent to an estimated gas amount.
+func withBuffer(gas, percent uint64) uint64 {
+	return gas + gas*percent/100
+}
+
+// checkBudget fails if the worst-case cost of gas at f exceeds maxCost.
+func checkBudget(gas uint64, f fees, maxCost string) error {
+	if maxCost == "" {
+		return nil
+	}
+	budget, _ := parseWei(maxCost)
+	cost := f.maxCost(gas)
+	if cost.Cmp(budget) > 0 {
+		l1 := ""
+		if f.L1Fee != nil {
+			l1 = ", plus " + formatEther(f.L1Fee) + " L1 data fee"
+		}
+		if f.BlobFeeCap != nil {
+			l1 += ", plus " + formatEther(f.blobCost()) + " for blobs"
+		}
+		return fmt.Errorf("estimated cost %s exceeds max cost %s (gas %d at %s wei/gas%s)",
+			formatEther(cost), formatEther(budget), gas, f.maxPrice(), l1)
+	}
+	return nil
+}
+
+// txFields are the parts of a transaction independent of nonce and fees.
+type txFields struct {
+	To    *common.Address
+	Value *big.Int
+	Data  []byte
+	// Label says what the transaction does, for confirmation prompts.
+	Label string
+	// FactoryDeps is the code a zkSync deployment publishes, the deployed
+	// contract's first.
+	FactoryDeps [][]byte
+	// Blobs, when set, make this an EIP-4844 blob transaction carrying
+	// them.
+	Blobs *types.BlobTxSidecar
+	// AccessList declares the addresses and slots the transaction touches
+	// (EIP-2930).
+	AccessList types.AccessList
+	// Sender is the signer pool account that sends the transaction; nil
+	// is the run's sender.
+	Sender *pooledSigner
+}
+
+// newTx builds an unsigned transaction using legacy or EIP-1559 fees, or a
+// blob transaction when msg carries blobs. Legacy fees with an access list
+// make an EIP-2930 transaction.
+func newTx(chainID *big.Int, nonce uint64, f fees, gas uint64, msg txFields) *types.Transaction {
+	if msg.Blobs != nil {
+		value := new(uint256.Int)
+		if msg.Value != nil {
+			value = uint256.MustFromBig(msg.Value)
+		}
+		return types.NewTx(&types.BlobTx{
+			ChainID:    uint256.MustFromBig(chainID),
+			Nonce:      nonce,
+			GasTipCap:  uint256.MustFromBig(f.TipCap),
+			GasFeeCap:  uint256.MustFromBig(f.FeeCap),
+			Gas:        gas,
+			To:         *msg.To,
+			Value:      value,
+			Data:       msg.Data,
+			BlobFeeCap: uint256.MustFromBig(f.BlobFeeCap),
+			BlobHashes: msg.Blobs.BlobHashes(),
+			Sidecar:    msg.Blobs,
+			AccessList: msg.AccessList,
+		})
+	}
+	if f.dynamic() {
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:    chainID,
+			Nonce:      nonce,
+			GasTipCap:  f.TipCap,
+			GasFeeCap:  f.FeeCap,
+			Gas:        gas,
+			To:         msg.To,
+			Value:      msg.Value,
+			Data:       msg.Data,
+			AccessList: msg.AccessList,
+		})
+	}
+	if msg.AccessList != nil {
+		return types.NewTx(&types.AccessListTx{
+			ChainID:    chainID,
+			Nonce:      nonce,
+			GasPrice:   f.GasPrice,
+			Gas:        gas,
+			To:         msg.To,
+			Value:      msg.Value,
+			Data:       msg.Data,
+			AccessList: msg.AccessList,
+		})
+	}
+	return types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: f.GasPrice,
+		Gas:      gas,
+		To:       msg.To,
+		Value:    msg.Value,
+		Data:     msg.Data,
+	})
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	importPattern  = regexp.MustCompile(`\bimport\s+(?:["']([^"']+)["']|[^;"']*?\bfrom\s+["']([^"']+)["'])[^;]*;`)
+	aliasPattern   = regexp.MustCompile(`\bas\s+\w+`)
+	licensePattern = regexp.MustCompile(`(?m)^[ \t]*//[ \t]*SPDX-License-Identifier:[ \t]*(.*?)[ \t]*\r?$\n?`)
+	pragmaPattern  = regexp.MustCompile(`(?m)^[ \t]*pragma\s+([^;]+);[ \t]*\r?$\n?`)
+)
+
+// remapping is a solc import remapping, context:prefix=target.
+type remapping struct {
+	context, prefix, target string
+}
+
+func parseRemappings(raw json.RawMessage) ([]remapping, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("metadata remappings: %w", err)
+	}
+	out := make([]remapping, 0, len(list))
+	for _, s := range list {
+		from, target, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("metadata remapping %q has no =", s)
+		}
+		var r remapping
+		if context, prefix, ok := strings.Cut(from, ":"); ok {
+			r.context, r.prefix = context, prefix
+		} else {
+			r.prefix = from
+		}
+		r.target = target
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// resolveImport returns the source unit name that an import of imp in the
+// source unit from refers to, as solc resolves it: relative to from for
+// ./ and ../ paths, otherwise through the longest matching remapping.
+func resolveImport(from, imp string, remappings []remapping) string {
+	if strings.HasPrefix(imp, "./") || strings.HasPrefix(imp, "../") {
+		return path.Clean(path.Join(path.Dir(from), imp))
+	}
+	best := -1
+	for i, r := range remappings {
+		if !strings.HasPrefix(imp, r.prefix) || !strings.HasPrefix(from, r.context) {
+			continue
+		}
+		if best < 0 || len(r.prefix) > len(remappings[best].prefix) || (len(r.prefix) == len(remappings[best].prefix) && len(r.context) > len(remappings[best].context)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return imp
+	}
+	return remappings[best].target + strings.TrimPrefix(imp, remappings[best].prefix)
+}
+
+// literalSpans returns the byte ranges of src's comments and string
+// literals, so that imports mentioned in them are left alone.
+func literalSpans(src string) [][2]int {
+	var spans [][2]int
+	for i := 0; i+1 < len(src); i++ {
+		switch {
+		case src[i] == '"' || src[i] == '\'':
+			quote, start := src[i], i
+			for i++; i < len(src) && src[i] != quote && src[i] != '\n'; i++ {
+				if src[i] == '\\' {
+					i++
+				}
+			}
+			spans = append(spans, [2]int{start, i + 1})
+		case src[i:i+2] == "//":
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			spans = append(spans, [2]int{i, i + end})
+			i += end
+		case src[i:i+2] == "/*":
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				end = len(src) - i - 2
+			}
+			spans = append(spans, [2]int{i, i + end + 4})
+			i += end + 3
+		}
+	}
+	return spans
+}
+
+func inSpans(spans [][2]int, at int) bool {
+	for _, s := range spans {
+		if at >= s[0] && at < s[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// flattener concatenates a contract's sources into one file, each after
+// the files it imports.
+type flattener struct {
+	root       string
+	sources    map[string]bool
+	remappings []remapping
+
+	done     map[string]bool
+	visiting map[string]bool
+	licenses []string
+	pragmas  []string
+	body     strings.Builder
+}
+
+// flattenSources returns art's sources as a single file that compiles to
+// the same contract: imports are inlined once each, in dependency order,
+// under one SPDX license line and one copy of each pragma. Sources that
+// import with aliases cannot be flattened, since the names would clash.
+func flattenSources(root string, art *artifact) (string, error) {
+	if art.Metadata == nil {
+		return "", fmt.Errorf("%s has no compiler metadata; rebuild with forge", art.Name)
+	}
+	target, err := art.Metadata.compilationTarget()
+	if err != nil {
+		return "", err
+	}
+	entry, _, _ := strings.Cut(target, ":")
+	remappings, err := parseRemappings(art.Metadata.Settings["remappings"])
+	if err != nil {
+		return "", err
+	}
+	f := &flattener{root: root, sources: map[string]bool{}, remappings: remappings, done: map[string]bool{}, visiting: map[string]bool{}}
+	for p := range art.Metadata.Sources {
+		f.sources[p] = true
+	}
+	if err := f.add(entry); err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	if len(f.licenses) > 0 {
+		fmt.Fprintf(&out, "// SPDX-License-Identifier: %s\n", strings.Join(f.licenses, " AND "))
+	}
+	for _, p := range f.pragmas {
+		fmt.Fprintf(&out, "pragma %s;\n", p)
+	}
+	out.WriteString(f.body.String())
+	return out.String(), nil
+}
+
+// add appends the source unit name and, before it, everything it imports.
+func (f *flattener) add(name string) error {
+	if f.done[name] {
+		return nil
+	}
+	if f.visiting[name] {
+		// Import cycles are legal in Solidity; the file being visited is
+		// emitted once its other imports are.
+		return nil
+	}
+	f.visiting[name] = true
+	raw, err := os.ReadFile(filepath.Join(f.root, filepath.FromSlash(name)))
+	if err != nil {
+		return fmt.Errorf("read source %s: %w", name, err)
+	}
+	src := string(raw)
+	literals := literalSpans(src)
+
+	var kept strings.Builder
+	last := 0
+	for _, m := range importPattern.FindAllStringSubmatchIndex(src, -1) {
+		if inSpans(literals, m[0]) {
+			continue
+		}
+		stmt := src[m[0]:m[1]]
+		if aliasPattern.MatchString(stmt) {
+			return fmt.Errorf("%s: %s uses an alias, which a flattened file cannot keep", name, strings.Join(strings.Fields(stmt), " "))
+		}
+		imp := ""
+		for g := 2; g < len(m); g += 2 {
+			if m[g] >= 0 {
+				imp = src[m[g]:m[g+1]]
+			}
+		}
+		dep := resolveImport(name, imp, f.remappings)
+		if !f.sources[dep] {
+			return fmt.Errorf("%s: import %q resolves to %s, which is not among the compiled sources", name, imp, dep)
+		}
+		if err := f.add(dep); err != nil {
+			return err
+		}
+		kept.WriteString(src[last:m[0]])
+		last = m[1]
+	}
+	kept.WriteString(src[last:])
+
+	body := licensePattern.ReplaceAllStringFunc(kept.String(), func(line string) string {
+		id := strings.TrimSpace(licensePattern.FindStringSubmatch(line)[1])
+		if id != "" && !slices.Contains(f.licenses, id) {
+			f.licenses = append(f.licenses, id)
+		}
+		return ""
+	})
+	body = pragmaPattern.ReplaceAllStringFunc(body, func(line string) string {
+		p := strings.Join(strings.Fields(pragmaPattern.FindStringSubmatch(line)[1]), " ")
+		if !slices.Contains(f.pragmas, p) {
+			f.pragmas = append(f.pragmas, p)
+		}
+		return ""
+	})
+	fmt.Fprintf(&f.body, "\n// File: %s\n\n%s\n", name, strings.TrimSpace(body))
+	f.done[name] = true
+	return nil
+}
+
+// flattenedPath is where a deployment's flattened source is kept, under
+// the directory holding deployments/.
+func flattenedPath(records, network, name string) string {
+	return filepath.Join(records, "deployments", "flattened", network, name+".sol")
+}
+
+// writeFlattened keeps the flattened source of d's code next to the
+// registry, for explorers that only take single files, and returns its
+// path relative to records. Failing to flatten is only a warning.
+func (r *networkRun) writeFlattened(d *deployment) string {
+	flat, err := flattenSources(r.root, d.artifact)
+	if err != nil {
+		logger.Warn("Could not flatten the sources", "name", d.Name, "err", err)
+		return ""
+	}
+	path := flattenedPath(r.records, r.name, d.Name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err == nil {
+		err = os.WriteFile(path, []byte(flat), 0o644)
+	}
+	if err != nil {
+		logger.Warn("Could not write the flattened source", "name", d.Name, "path", path, "err", err)
+		return ""
+	}
+	rel, _ := filepath.Rel(r.records, path)
+	return filepath.ToSlash(rel)
+}
+
+// runFlatten prints a contract's sources as one file.
+func runFlatten(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("flatten", flag.ContinueOnError)
+	contractPath := fs.String("contract", "", "contract to flatten, as File.sol or File.sol:Name")
+	out := fs.String("out", "", "write the flattened source to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *contractPath == "" {
+		return errors.New("-contract is required")
+	}
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	art, err := loadArtifact(root, *contractPath)
+	if err != nil {
+		return err
+	}
+	flat, err := flattenSources(root, art)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err := os.Stdout.WriteString(flat)
+		return err
+	}
+	return os.WriteFile(*out, []byte(flat), 0o644)
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// gasRun is the gas one gas-report run measured: what each deployment in
+// the manifest used, at a git commit.
+type gasRun struct {
+	Time     time.Time `json:"time"`
+	Network  string    `json:"network"`
+	Manifest string    `json:"manifest,omitempty"`
+	// Commit is the project's git commit, marked "-dirty" when the working
+	// tree had uncommitted changes.
+	Commit    string            `json:"commit"`
+	Contracts map[string]uint64 `json:"contracts"`
+	Total     uint64            `json:"total"`
+}
+
+// gasHistory is the gas report file, deployments/gas-report.json by
+// default. It keeps one run per network, manifest and commit, oldest first.
+type gasHistory struct {
+	Runs []gasRun `json:"runs"`
+}
+
+func gasReportPath(root string) string {
+	return filepath.Join(root, "deployments", "gas-report.json")
+}
+
+func loadGasHistory(path string) (*gasHistory, error) {
+	h := &gasHistory{}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, h); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return h, nil
+}
+
+// baseline returns the latest run of run's network and manifest at another
+// commit, or nil.
+func (h *gasHistory) baseline(run gasRun) *gasRun {
+	for i := len(h.Runs) - 1; i >= 0; i-- {
+		if r := h.Runs[i]; r.Network == run.Network && r.Manifest == run.Manifest && r.Commit != run.Commit {
+			return &h.Runs[i]
+		}
+	}
+	return nil
+}
+
+// add appends run, replacing an earlier run at the same commit.
+func (h *gasHistory) add(run gasRun) {
+	runs := h.Runs[:0]
+	for _, r := range h.Runs {
+		if r.Network != run.Network || r.Manifest != run.Manifest || r.Commit != run.Commit {
+			runs = append(runs, r)
+		}
+	}
+	h.Runs = append(runs, run)
+}
+
+func (h *gasHistory) save(path string) error {
+	raw, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(raw, '\n'), 0o644)
+}
+
+// gasDiff compares one deployment's gas with the baseline run. Previous is
+// nil for a deployment the baseline did not have, and GasUsed nil for one
+// it had that the manifest no longer deploys.
+type gasDiff struct {
+	Name     string  `json:"name"`
+	GasUsed  *uint64 `json:"gasUsed"`
+	Previous *uint64 `json:"previous"`
+	Change   int64   `json:"change"`
+	// Percent is Change relative to Previous.
+	Percent float64 `json:"percent"`
+}
+
+func newGasDiff(name string, used, previous *uint64) gasDiff {
+	d := gasDiff{Name: name, GasUsed: used, Previous: previous}
+	if used != nil && previous != nil {
+		d.Change = int64(*used) - int64(*previous)
+		if *previous != 0 {
+			d.Percent = float64(d.Change) * 100 / float64(*previous)
+		}
+	}
+	return d
+}
+
+// gasReport is the result of gas-report: the run and, if there is one,
+// how it compares with the baseline.
+type gasReport struct {
+	gasRun
+	Baseline  string    `json:"baseline,omitempty"`
+	Diff      []gasDiff `json:"diff,omitempty"`
+	TotalDiff *gasDiff  `json:"totalDiff,omitempty"`
+}
+
+func newGasReport(run gasRun, base *gasRun) *gasReport {
+	report := &gasReport{gasRun: run}
+	if base == nil {
+		return report
+	}
+	report.Baseline = base.Commit
+	names := map[string]bool{}
+	for name := range run.Contracts {
+		names[name] = true
+	}
+	for name := range base.Contracts {
+		names[name] = true
+	}
+	for _, name := range sortedKeys(names) {
+		used, ok := run.Contracts[name]
+		previous, had := base.Contracts[name]
+		var u, p *uint64
+		if ok {
+			u = &used
+		}
+		if had {
+			p = &previous
+		}
+		report.Diff = append(report.Diff, newGasDiff(name, u, p))
+	}
+	total := newGasDiff("TOTAL", &run.Total, &base.Total)
+	report.TotalDiff = &total
+	return report
+}
+
+// print writes the report as a table, with the change against the
+// baseline when there is one.
+func (g *gasReport) print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if g.Baseline == "" {
+		fmt.Fprintln(tw, "NAME\tGAS")
+		for _, name := range sortedKeys(g.Contracts) {
+			fmt.Fprintf(tw, "%s\t%d\n", name, g.Contracts[name])
+		}
+		fmt.Fprintf(tw, "TOTAL\t%d\n", g.Total)
+		tw.Flush()
+		fmt.Fprintf(w, "No earlier run of %s on %s to compare with.\n", g.Network, shortCommit(g.Commit))
+		return
+	}
+	fmt.Fprintln(tw, "NAME\tGAS\tPREVIOUS\tCHANGE\t%")
+	for _, d := range append(g.Diff, *g.TotalDiff) {
+		used, previous, change, percent := "-", "-", "", ""
+		if d.GasUsed != nil {
+			used = strconv.FormatUint(*d.GasUsed, 10)
+		}
+		if d.Previous != nil {
+			previous = strconv.FormatUint(*d.Previous, 10)
+		}
+		switch {
+		case d.GasUsed == nil:
+			change = "removed"
+		case d.Previous == nil:
+			change = "new"
+		default:
+			change = fmt.Sprintf("%+d", d.Change)
+			percent = fmt.Sprintf("%+.2f%%", d.Percent)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", d.Name, used, previous, change, percent)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "Compared with %s.\n", shortCommit(g.Baseline))
+}
+
+// regressions lists the deployments, and the total, whose gas grew by more
+// than limit percent over the baseline.
+func (g *gasReport) regressions(limit float64) []string {
+	var out []string
+	if g.TotalDiff == nil {
+		return nil
+	}
+	for _, d := range append(g.Diff, *g.TotalDiff) {
+		if d.GasUsed != nil && d.Previous != nil && d.Change > 0 && d.Percent > limit {
+			out = append(out, fmt.Sprintf("%s: %d gas, up %d (%+.2f%%) from %d", d.Name, *d.GasUsed, d.Change, d.Percent, *d.Previous))
+		}
+	}
+	return out
+}
+
+// treeCommit returns the HEAD commit of the project at root, with "-dirty"
+// appended if anything outside deployments/ has uncommitted changes, so
+// that runs of edited contracts are not recorded as the commit's.
+func treeCommit(ctx context.Context, root string) string {
+	commit := gitCommit(ctx, root, "")
+	if commit == "" {
+		return ""
+	}
+	status, err := exec.CommandContext(ctx, "git", "-C", root, "status", "--porcelain", "--untracked-files=no", "--", ".", ":(exclude)deployments").Output()
+	if err == nil && len(bytes.TrimSpace(status)) > 0 {
+		commit += "-dirty"
+	}
+	return commit
+}
+
+// shortCommit abbreviates a commit hash for display, keeping "-dirty".
+func shortCommit(commit string) string {
+	hash, dirty, _ := strings.Cut(commit, "-")
+	if len(hash) > 12 {
+		hash = hash[:12]
+	}
+	if dirty != "" {
+		hash += "-" + dirty
+	}
+	if hash == "" {
+		return "the working tree"
+	}
+	return hash
+}
+
+// runGasReport deploys a manifest to a throwaway anvil node, records the
+// gas each deployment used at the current git commit, and compares it
+// with the run at the previous commit, so CI can catch deployment cost
+// regressions.
+func runGasReport(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("gas-report", &rpcURL)
+	rf := addRunFlags(fs)
+	rf.addBuildFlags(fs)
+	file := fs.String("file", "", "gas report file (default deployments/gas-report.json)")
+	noSave := fs.Bool("no-save", false, "compare without recording this run")
+	failAbove := fs.Float64("fail-above", -1, "fail if a deployment's or the total gas grew by more than this percent (e.g. 2.5; negative: never fail)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if rf.manifest == "" {
+		return errors.New("-manifest is required")
+	}
+	if rf.dryRun || rf.resume || flagSet(fs, "rpc") {
+		return errors.New("gas-report always deploys to its own anvil node; -dry-run, -resume and -rpc do not apply")
+	}
+	// -fork needs -anvil, which gas-report implies.
+	rf.anvil = rf.anvil || rf.fork != ""
+	m, selected, err := rf.load(ctx, fs, rpcURL, nil)
+	if err != nil {
+		return err
+	}
+	if len(selected) != 1 {
+		return errors.New("gas-report measures one network; pick it with -network")
+	}
+	network := selected[0]
+	n := m.Networks[network]
+	if n.Safe != nil || n.UserOp != nil {
+		return fmt.Errorf("network %s: gas-report measures deployments from the signer; remove safe and userOp", network)
+	}
+	var anvil anvilConfig
+	if n.Anvil != nil {
+		anvil = *n.Anvil
+	}
+	// A fresh chain runs the network's chain id, so chain-dependent
+	// constructor arguments and the chain id check behave as on the network.
+	if chainID := n.chainID(network); chainID != 0 && anvil.Fork == "" {
+		anvil.Args = append([]string{"--chain-id", strconv.FormatUint(chainID, 10)}, anvil.Args...)
+	}
+	n.Anvil = &anvil
+	m.Networks[network] = n
+
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	if err := m.build(ctx, root, selected); err != nil {
+		return err
+	}
+	opts := rf.options()
+	opts.Fund, opts.Scratch = true, true
+	run, err := openNetworkRun(ctx, m, network, opts)
+	if err != nil {
+		return err
+	}
+	defer run.close()
+	results, err := run.execute(ctx, m)
+	if err != nil {
+		return err
+	}
+
+	prov := runProvenance(ctx, root, m.path)
+	measured := gasRun{Time: time.Now().UTC(), Network: network, Manifest: prov.manifest, Commit: treeCommit(ctx, root), Contracts: map[string]uint64{}}
+	for _, d := range results {
+		if !d.Skipped {
+			measured.Contracts[d.Name] = d.GasUsed
+			measured.Total += d.GasUsed
+		}
+	}
+	path := *file
+	if path == "" {
+		path = gasReportPath(root)
+	}
+	history, err := loadGasHistory(path)
+	if err != nil {
+		return err
+	}
+	report := newGasReport(measured, history.baseline(measured))
+	if !*noSave {
+		history.add(measured)
+		if err := history.save(path); err != nil {
+			return err
+		}
+		logger.Info("Recorded gas report", "file", path, "commit", shortCommit(measured.Commit))
+	}
+	if rf.output == outputJSON {
+		if err := printJSON(report); err != nil {
+			return err
+		}
+	} else {
+		report.print(os.Stdout)
+	}
+	if *failAbove >= 0 {
+		if regressed := report.regressions(*failAbove); len(regressed) > 0 {
+			return fmt.Errorf("deployment gas grew by more than %g%% since %s:\n  %s", *failAbove, shortCommit(report.Baseline), strings.Join(regressed, "\n  "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// anvilState is the part of anvil_dumpState's output genesis reads: every
+// account with its nonce, balance, code and storage.
+type anvilState struct {
+	Accounts map[common.Address]anvilAccount `json:"accounts"`
+}
+
+type anvilAccount struct {
+	Nonce   math.HexOrDecimal64              `json:"nonce"`
+	Balance *math.HexOrDecimal256            `json:"balance"`
+	Code    hexutil.Bytes                    `json:"code"`
+	Storage map[string]*math.HexOrDecimal256 `json:"storage"`
+}
+
+// storage returns the account's non-zero slots in genesis form.
+func (a anvilAccount) storage() map[common.Hash]common.Hash {
+	out := make(map[common.Hash]common.Hash, len(a.Storage))
+	for k, v := range a.Storage {
+		slot, ok := math.ParseBig256(k)
+		if ok && v != nil && (*big.Int)(v).Sign() != 0 {
+			out[common.BigToHash(slot)] = common.BigToHash((*big.Int)(v))
+		}
+	}
+	return out
+}
+
+func (a anvilAccount) balance() *big.Int {
+	if a.Balance == nil {
+		return new(big.Int)
+	}
+	return (*big.Int)(a.Balance)
+}
+
+// dumpAnvilState reads the whole state of an anvil node. anvil returns it
+// as gzipped JSON.
+func dumpAnvilState(ctx context.Context, r *networkRun) (*anvilState, error) {
+	var raw hexutil.Bytes
+	if err := r.client.Client().CallContext(ctx, &raw, "anvil_dumpState"); err != nil {
+		return nil, fmt.Errorf("anvil_dumpState: %w", err)
+	}
+	data := []byte(raw)
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("anvil_dumpState: %w", err)
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, fmt.Errorf("anvil_dumpState: %w", err)
+		}
+	}
+	var state anvilState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("anvil_dumpState: decode: %w", err)
+	}
+	return &state, nil
+}
+
+// genesisAlloc returns the accounts the run created or changed, in genesis
+// form: contracts with their code, storage and balance, and senders with
+// their nonce, so that their next deployment does not collide with a
+// predeployed address. Senders get no balance; the devnet funds them.
+func genesisAlloc(before, after *anvilState) types.GenesisAlloc {
+	alloc := types.GenesisAlloc{}
+	for addr, acc := range after.Accounts {
+		old, existed := before.Accounts[addr]
+		storage := acc.storage()
+		switch {
+		case len(acc.Code) > 0:
+			if existed && bytes.Equal(old.Code, acc.Code) && old.balance().Cmp(acc.balance()) == 0 && sameStorage(old.storage(), storage) {
+				continue
+			}
+			alloc[addr] = types.Account{Code: acc.Code, Storage: storage, Balance: acc.balance(), Nonce: uint64(acc.Nonce)}
+		case uint64(acc.Nonce) > uint64(old.Nonce):
+			alloc[addr] = types.Account{Balance: new(big.Int), Nonce: uint64(acc.Nonce)}
+		}
+	}
+	return alloc
+}
+
+func sameStorage(a, b map[common.Hash]common.Hash) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeGenesis writes alloc into the genesis file at path, keeping its
+// other fields and accounts. An account already there keeps its balance
+// unless the run gave it one.
+func mergeGenesis(path string, alloc types.GenesisAlloc, chainID uint64) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var genesis map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &genesis); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	var config struct {
+		ChainID uint64 `json:"chainId"`
+	}
+	if c, ok := genesis["config"]; ok {
+		if err := json.Unmarshal(c, &config); err != nil {
+			return fmt.Errorf("%s: config: %w", path, err)
+		}
+	}
+	if config.ChainID != 0 && config.ChainID != chainID {
+		return fmt.Errorf("%s is for chain %d, but the network's chainId is %d", path, config.ChainID, chainID)
+	}
+	existing := types.GenesisAlloc{}
+	if a, ok := genesis["alloc"]; ok {
+		if err := json.Unmarshal(a, &existing); err != nil {
+			return fmt.Errorf("%s: alloc: %w", path, err)
+		}
+	}
+	for addr, acc := range alloc {
+		if old, ok := existing[addr]; ok && acc.Balance.Sign() == 0 && old.Balance != nil {
+			acc.Balance = old.Balance
+		}
+		existing[addr] = acc
+	}
+	if genesis["alloc"], err = json.Marshal(existing); err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(genesis, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(out, '\n'), 0o644)
+}
+
+// runGenesis deploys a manifest to a throwaway anvil node running the
+// network's chain id, then writes the resulting contracts into a genesis
+// alloc, so that a private devnet starts with them at block 0.
+func runGenesis(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("genesis", &rpcURL)
+	rf := addRunFlags(fs)
+	rf.addBuildFlags(fs)
+	genesisPath := fs.String("genesis", "", "merge the accounts into this geth genesis file instead of printing the alloc")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if rf.manifest == "" {
+		return errors.New("-manifest is required")
+	}
+	if rf.dryRun || rf.anvil || flagSet(fs, "rpc") {
+		return errors.New("genesis always deploys to its own anvil node; -dry-run, -anvil and -rpc do not apply")
+	}
+	m, selected, err := rf.load(ctx, fs, rpcURL, nil)
+	if err != nil {
+		return err
+	}
+	if len(selected) != 1 {
+		return errors.New("genesis builds one network's alloc; pick it with -network")
+	}
+	network := selected[0]
+	n := m.Networks[network]
+	chainID := n.chainID(network)
+	switch {
+	case chainID == 0:
+		return fmt.Errorf("network %s: set chainId, which the contracts see while they are built into the genesis", network)
+	case n.Safe != nil || n.UserOp != nil:
+		return fmt.Errorf("network %s: genesis deploys from the signer; remove safe and userOp", network)
+	case n.chainKind(network) == chainZKsync:
+		return fmt.Errorf("network %s: %s chains are not built from a geth genesis", network, chainZKsync)
+	case n.Anvil != nil && n.Anvil.Fork != "":
+		return fmt.Errorf("network %s: genesis cannot start from a fork", network)
+	}
+	anvil := anvilConfig{Args: []string{"--chain-id", strconv.FormatUint(chainID, 10)}}
+	if n.Anvil != nil {
+		anvil.Args = append(anvil.Args, n.Anvil.Args...)
+	}
+	n.Anvil = &anvil
+	m.Networks[network] = n
+
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	if err := m.build(ctx, root, selected); err != nil {
+		return err
+	}
+	opts := rf.options()
+	opts.Fund = true
+	run, err := openNetworkRun(ctx, m, network, opts)
+	if err != nil {
+		return err
+	}
+	defer run.close()
+	before, err := dumpAnvilState(ctx, run)
+	if err != nil {
+		return err
+	}
+	results, err := run.execute(ctx, m)
+	if err != nil {
+		return err
+	}
+	after, err := dumpAnvilState(ctx, run)
+	if err != nil {
+		return err
+	}
+	alloc := genesisAlloc(before, after)
+	// Salted deployments need the CREATE2 factory, which anvil predeploys
+	// but a fresh chain lacks.
+	for _, d := range results {
+		if d.Salt == nil {
+			continue
+		}
+		if acc, ok := after.Accounts[run.factory]; ok && len(acc.Code) > 0 {
+			alloc[run.factory] = types.Account{Code: acc.Code, Storage: acc.storage(), Balance: new(big.Int), Nonce: uint64(acc.Nonce)}
+		}
+		break
+	}
+	logger.Info("Built genesis alloc", "network", network, "chainId", chainID, "deployments", len(results), "accounts", len(alloc))
+	if *genesisPath == "" {
+		return printJSON(alloc)
+	}
+	if err := mergeGenesis(*genesisPath, alloc, chainID); err != nil {
+		return err
+	}
+	logger.Info("Updated genesis", "file", *genesisPath)
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/usbwallet"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"golang.org/x/term"
+)
+
+// hardwareSigner signs with a Ledger or Trezor over USB. Every transaction
+// has to be confirmed on the device.
+type hardwareSigner struct {
+	wallet  accounts.Wallet
+	account accounts.Account
+}
+
+// openHardwareSigner opens the first connected device of the given kind and
+// derives the account at path.
+func openHardwareSigner(kind, path string) (*hardwareSigner, error) {
+	dpath, err := accounts.ParseDerivationPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid derivation path %q: %w", path, err)
+	}
+
+	var hub *usbwallet.Hub
+	switch kind {
+	case signerLedger:
+		hub, err = usbwallet.NewLedgerHub()
+	case signerTrezor:
+		hub, err = usbwallet.NewTrezorHubWithHID()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", kind, err)
+	}
+	wallets := hub.Wallets()
+	if len(wallets) == 0 {
+		return nil, fmt.Errorf("no %s device found; is it connected and unlocked?", kind)
+	}
+	wallet := wallets[0]
+
+	if err := openWallet(wallet); err != nil {
+		return nil, fmt.Errorf("%s: %w", kind, err)
+	}
+	account, err := wallet.Derive(dpath, true)
+	if err != nil {
+		wallet.Close()
+		return nil, fmt.Errorf("%s: derive %s: %w", kind, path, err)
+	}
+	logger.Info("Using hardware wallet", "wallet", kind, "address", account.Address, "path", path)
+	return &hardwareSigner{wallet: wallet, account: account}, nil
+}
+
+// openWallet opens wallet, prompting for the Trezor PIN (entered using the
+// layout shown on the device) and passphrase when they are needed.
+func openWallet(wallet accounts.Wallet) error {
+	err := wallet.Open("")
+	if errors.Is(err, usbwallet.ErrTrezorPINNeeded) {
+		pin, perr := promptSecret("the Trezor PIN", "PIN (positions as shown on the Trezor): ")
+		if perr != nil {
+			return perr
+		}
+		err = wallet.Open(pin)
+	}
+	if errors.Is(err, usbwallet.ErrTrezorPassphraseNeeded) {
+		phrase, perr := promptSecret("the Trezor passphrase", "Trezor passphrase: ")
+		if perr != nil {
+			return perr
+		}
+		err = wallet.Open(phrase)
+	}
+	return err
+}
+
+// promptSecret reads what, a secret, from the terminal without echoing it.
+func promptSecret(what, prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("cannot prompt for %s: stdin is not a terminal", what)
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return string(b), err
+}
+
+func (s *hardwareSigner) Address() common.Address {
+	return s.account.Address
+}
+
+func (s *hardwareSigner) SignTx(_ context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	logger.Info("Confirm the transaction on your device", "nonce", tx.Nonce())
+	return s.wallet.SignTx(s.account, tx, chainID)
+}
+
+func (s *hardwareSigner) Close() error {
+	return s.wallet.Close()
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	_ "modernc.org/sqlite"
+)
+
+// auditRecord is one broadcast transaction in the audit log: who sent it,
+// what it did, and the manifest revision it came from. Records are only
+// ever appended.
+type auditRecord struct {
+	Time    time.Time `json:"time"`
+	Network string    `json:"network"`
+	ChainID uint64    `json:"chainId"`
+	// Command is the subcommand that sent the transaction; its flags are
+	// left out since RPC URLs may carry keys.
+	Command string `json:"command"`
+	// User and Host identify who ran the command.
+	User string `json:"user,omitempty"`
+	Host string `json:"host,omitempty"`
+	// Signer signed the transaction. With a Safe, Signer proposed it, Safe
+	// sent it and TxHash is the owner's transaction that executed it.
+	Signer common.Address  `json:"signer"`
+	Safe   *common.Address `json:"safe,omitempty"`
+	// Account is the ERC-4337 smart account that executed the transaction
+	// as the user operation UserOpHash, included by TxHash.
+	Account    *common.Address `json:"account,omitempty"`
+	UserOpHash *common.Hash    `json:"userOpHash,omitempty"`
+	// Relay is the service that sent a relayed call, as its task
+	// RelayTask; with a forwarder, Signer signed the forward request.
+	Relay     string          `json:"relay,omitempty"`
+	RelayTask string          `json:"relayTask,omitempty"`
+	Action    string          `json:"action"`
+	To        *common.Address `json:"to,omitempty"`
+	Value     *hexutil.Big    `json:"value,omitempty"`
+	Data      hexutil.Bytes   `json:"data"`
+	Nonce     *uint64         `json:"nonce,omitempty"`
+	Gas       uint64          `json:"gas,omitempty"`
+	// BlobHashes are the versioned hashes of a blob transaction's blobs.
+	BlobHashes []common.Hash `json:"blobHashes,omitempty"`
+	TxHash     common.Hash   `json:"txHash"`
+	// Manifest is the manifest's path relative to the project root, and
+	// Commit the git commit it was run from, marked "-dirty" when the
+	// manifest had uncommitted changes.
+	Manifest string `json:"manifest,omitempty"`
+	Commit   string `json:"commit,omitempty"`
+	// PolicyOverride is set when the run sent despite the project's policy.
+	PolicyOverride *policyOverride `json:"policyOverride,omitempty"`
+}
+
+// auditLog records broadcast transactions in the SQLite database
+// deployments/history.db. Each record is kept whole, as JSON, next to
+// indexed columns for what history filters on.
+type auditLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+func auditLogPath(root string) string {
+	return filepath.Join(root, "deployments", "history.db")
+}
+
+// auditSchema creates the audit log's table; time is in Unix nanoseconds.
+const auditSchema = `
+CREATE TABLE IF NOT EXISTS transactions (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	time     INTEGER NOT NULL,
+	network  TEXT NOT NULL,
+	chain_id INTEGER NOT NULL,
+	signer   TEXT NOT NULL,
+	to_addr  TEXT,
+	tx_hash  TEXT NOT NULL,
+	record   TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS transactions_network ON transactions (network, time);
+CREATE INDEX IF NOT EXISTS transactions_signer ON transactions (signer, time);
+CREATE INDEX IF NOT EXISTS transactions_to ON transactions (to_addr, time);
+CREATE INDEX IF NOT EXISTS transactions_tx ON transactions (tx_hash);
+CREATE INDEX IF NOT EXISTS transactions_time ON transactions (time);
+`
+
+// openAuditDB opens the audit log at path, creating it if needed. Runs
+// writing at the same time wait for each other's locks.
+func openAuditDB(path string) (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(10000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(auditSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return db, nil
+}
+
+func (l *auditLog) append(rec auditRecord) error {
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	var to sql.NullString
+	if rec.To != nil {
+		to = sql.NullString{String: rec.To.Hex(), Valid: true}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	db, err := openAuditDB(l.path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.Exec(`INSERT INTO transactions (time, network, chain_id, signer, to_addr, tx_hash, record) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		rec.Time.UnixNano(), rec.Network, int64(rec.ChainID), rec.Signer.Hex(), to, rec.TxHash.Hex(), string(raw))
+	return err
+}
+
+// auditQuery selects records from the audit log; unset fields match every
+// record.
+type auditQuery struct {
+	Network string
+	Signer  *common.Address
+	To      *common.Address
+	TxHash  *common.Hash
+	Since   time.Time
+	// Contract matches the transactions sent to it, and the one that
+	// created it, CreationTx.
+	Contract   *common.Address
+	CreationTx common.Hash
+	// Limit keeps only the last n matches.
+	Limit int
+}
+
+// queryAuditLog returns the records in the audit log at path that match q,
+// oldest first. A missing log has no records.
+func queryAuditLog(path string, q auditQuery) ([]auditRecord, error) {
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	db, err := openAuditDB(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var where []string
+	var args []interface{}
+	add := func(cond string, values ...interface{}) {
+		where = append(where, cond)
+		args = append(args, values...)
+	}
+	if q.Network != "" {
+		add("network = ?", q.Network)
+	}
+	if q.Signer != nil {
+		add("signer = ?", q.Signer.Hex())
+	}
+	if q.To != nil {
+		add("to_addr = ?", q.To.Hex())
+	}
+	if q.TxHash != nil {
+		add("tx_hash = ?", q.TxHash.Hex())
+	}
+	if !q.Since.IsZero() {
+		add("time >= ?", q.Since.UnixNano())
+	}
+	if q.Contract != nil {
+		add("(to_addr = ? OR tx_hash = ?)", q.Contract.Hex(), q.CreationTx.Hex())
+	}
+	query := "SELECT record FROM transactions"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if q.Limit > 0 {
+		query += " LIMIT " + strconv.Itoa(q.Limit)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	defer rows.Close()
+	var records []auditRecord
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var rec auditRecord
+		if err := json.Unmarshal([]byte(raw), &rec); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		records = append(records, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	slices.Reverse(records)
+	return records, nil
+}
+
+// provenance is what the audit log records about where a run came from.
+type provenance struct {
+	command  string
+	user     string
+	host     string
+	manifest string
+	commit   string
+}
+
+// runProvenance describes the current command, run from manifestPath (empty
+// without a manifest) in the project at root.
+func runProvenance(ctx context.Context, root, manifestPath string) provenance {
+	p := provenance{}
+	if len(os.Args) > 1 {
+		p.command = os.Args[1]
+	}
+	if u, err := user.Current(); err == nil {
+		p.user = u.Username
+	}
+	p.host, _ = os.Hostname()
+	dir := root
+	if manifestPath != "" {
+		abs, err := filepath.Abs(manifestPath)
+		if err == nil {
+			dir = filepath.Dir(abs)
+			if rel, err := filepath.Rel(root, abs); err == nil {
+				p.manifest = filepath.ToSlash(rel)
+			}
+		}
+	}
+	p.commit = gitCommit(ctx, dir, manifestPath)
+	return p
+}
+
+// gitCommit returns the HEAD commit of the repository containing dir, with
+// "-dirty" appended if path has uncommitted changes, or "" outside git.
+func gitCommit(ctx context.Context, dir, path string) string {
+	out, err := exec.CommandContext(ctx, "git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	commit := strings.TrimSpace(string(out))
+	if path != "" {
+		abs, _ := filepath.Abs(path)
+		status, err := exec.CommandContext(ctx, "git", "-C", dir, "status", "--porcelain", "--", abs).Output()
+		if err == nil && len(bytes.TrimSpace(status)) > 0 {
+			commit += "-dirty"
+		}
+	}
+	return commit
+}
+
+// audit appends a broadcast transaction to the audit log.
+func (r *networkRun) audit(fields txFields, hash common.Hash, nonce *uint64, gas uint64) {
+	r.writeAudit(r.auditRecord(fields, hash, nonce, gas))
+}
+
+// auditRecord describes a broadcast transaction and the run that sent it.
+func (r *networkRun) auditRecord(fields txFields, hash common.Hash, nonce *uint64, gas uint64) auditRecord {
+	rec := auditRecord{
+		Time:     time.Now().UTC(),
+		Network:  r.name,
+		ChainID:  r.chainID.Uint64(),
+		Command:  r.provenance.command,
+		User:     r.provenance.user,
+		Host:     r.provenance.host,
+		Signer:   r.signerFor(fields).Address(),
+		Action:   r.describeTx(fields),
+		To:       fields.To,
+		Data:     fields.Data,
+		Nonce:    nonce,
+		Gas:      gas,
+		TxHash:   hash,
+		Manifest: r.provenance.manifest,
+		Commit:   r.provenance.commit,
+	}
+	if r.safe != nil {
+		rec.Safe = &r.safe.contract.Address
+	}
+	if fields.Value != nil && fields.Value.Sign() > 0 {
+		rec.Value = (*hexutil.Big)(fields.Value)
+	}
+	if fields.Blobs != nil {
+		rec.BlobHashes = fields.Blobs.BlobHashes()
+	}
+	if r.userOp != nil {
+		rec.Account = &r.userOp.account
+	}
+	r.mu.Lock()
+	if r.policyOverride != nil {
+		override := *r.policyOverride
+		override.Violations = slices.Clone(override.Violations)
+		rec.PolicyOverride = &override
+	}
+	r.mu.Unlock()
+	return rec
+}
+
+// writeAudit appends rec to the audit log. Failing to write it is logged,
+// not returned: the transaction has already been sent.
+func (r *networkRun) writeAudit(rec auditRecord) {
+	if err := r.auditLog.append(rec); err != nil {
+		logger.Warn("Could not write the audit log", "path", r.auditLog.path, "tx", rec.TxHash, "err", err)
+	}
+}
+
+// runHistory lists the transactions in the audit log, newest last.
+func runHistory(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	network := fs.String("network", "", "only transactions on this network")
+	signer := fs.String("signer", "", "only transactions signed by this address")
+	to := fs.String("to", "", "only transactions to this address or deployment name")
+	tx := fs.String("tx", "", "only the transaction with this hash")
+	since := fs.String("since", "", "only transactions after this time: a date (2006-01-02), an RFC 3339 time or a duration ago (e.g. 72h)")
+	limit := fs.Int("limit", 0, "only the last n transactions (0: all)")
+	output := fs.String("output", outputText, "text, or json for the full records")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *output != outputText && *output != outputJSON {
+		return fmt.Errorf("unknown -output %q (want text or json)", *output)
+	}
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	q := auditQuery{Network: *network, Limit: *limit}
+	if *since != "" {
+		if q.Since, err = parseSince(*since); err != nil {
+			return err
+		}
+	}
+	if *signer != "" {
+		addr, err := parseAddress(*signer)
+		if err != nil {
+			return fmt.Errorf("-signer: %w", err)
+		}
+		q.Signer = &addr
+	}
+	if *tx != "" {
+		raw, err := hexutil.Decode(*tx)
+		if err != nil || len(raw) != common.HashLength {
+			return fmt.Errorf("-tx %q is not a transaction hash", *tx)
+		}
+		hash := common.BytesToHash(raw)
+		q.TxHash = &hash
+	}
+	if *to != "" {
+		if strings.HasPrefix(*to, "0x") {
+			addr, err := parseAddress(*to)
+			if err != nil {
+				return fmt.Errorf("-to: %w", err)
+			}
+			q.To = &addr
+		} else {
+			if *network == "" {
+				return errors.New("-to with a deployment name needs -network")
+			}
+			addr, err := resolveAddress(*to, *network)
+			if err != nil {
+				return err
+			}
+			q.To = &addr
+		}
+	}
+	matched, err := queryAuditLog(auditLogPath(root), q)
+	if err != nil {
+		return err
+	}
+
+	if *output == outputJSON {
+		if matched == nil {
+			matched = []auditRecord{}
+		}
+		return printJSON(matched)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tNETWORK\tSIGNER\tACTION\tTX\tCOMMIT")
+	for _, rec := range matched {
+		commit, dirty := strings.CutSuffix(rec.Commit, "-dirty")
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		if dirty {
+			commit += "-dirty"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", rec.Time.Local().Format("2006-01-02 15:04:05"), rec.Network, rec.Signer.Hex(), rec.Action, rec.TxHash.Hex(), commit)
+	}
+	return w.Flush()
+}
+
+// parseSince reads -since: a date, an RFC 3339 time, or a duration back
+// from now.
+func parseSince(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("-since %q is not a date, time or duration", s)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// hookConfig runs a shell command around each deployment or transaction:
+//
+//	hooks:
+//	  - on: preDeploy
+//	    run: ./scripts/check-params.sh
+//	    networks: [mainnet]
+//	  - on: postDeploy
+//	    run: forge script script/Seed.s.sol --rpc-url "$DEPLOY_RPC_URL" --broadcast
+//	    contracts: [Governance]
+//
+// The command runs with sh -c in the project root. It is told about the
+// step through DEPLOY_* environment variables and, as a hookEvent, on
+// stdin; its output goes to stderr.
+type hookConfig struct {
+	// On is preDeploy, postDeploy, preSend or postSend.
+	On  string `yaml:"on"`
+	Run string `yaml:"run"`
+	// Networks defaults to every network.
+	Networks []string `yaml:"networks"`
+	// Contracts limits deploy hooks to these deployments.
+	Contracts []string `yaml:"contracts"`
+	// Timeout defaults to five minutes.
+	Timeout time.Duration `yaml:"timeout"`
+	// ContinueOnError logs a failing hook instead of stopping the run.
+	ContinueOnError bool `yaml:"continueOnError"`
+	// DryRun also runs the hook in dry runs, which skip hooks by default.
+	DryRun bool `yaml:"dryRun"`
+}
+
+const (
+	hookPreDeploy  = "preDeploy"
+	hookPostDeploy = "postDeploy"
+	hookPreSend    = "preSend"
+	hookPostSend   = "postSend"
+
+	defaultHookTimeout = 5 * time.Minute
+)
+
+func (c *hookConfig) validate() error {
+	switch c.On {
+	case hookPreDeploy, hookPostDeploy, hookPreSend, hookPostSend:
+	case "":
+		return fmt.Errorf("on is required")
+	default:
+		return fmt.Errorf("unknown hook %q (want preDeploy, postDeploy, preSend or postSend)", c.On)
+	}
+	if c.Run == "" {
+		return fmt.Errorf("run is required")
+	}
+	if len(c.Contracts) > 0 && (c.On == hookPreSend || c.On == hookPostSend) {
+		return fmt.Errorf("contracts only filters deploy hooks")
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	return nil
+}
+
+// hookEvent describes the step a hook runs around. Post hooks see the
+// outcome: the addresses and transaction, or the error the step failed
+// with.
+type hookEvent struct {
+	Hook    string `json:"hook"`
+	Network string `json:"network"`
+	ChainID uint64 `json:"chainId"`
+	DryRun  bool   `json:"dryRun,omitempty"`
+	// Name and Contract are set for deploy hooks.
+	Name     string `json:"name,omitempty"`
+	Contract string `json:"contract,omitempty"`
+	// Deployments are what a deploy step produced: proxies come with
+	// their implementation, contracts with the libraries linked for them.
+	Deployments []deployedNotice `json:"deployments,omitempty"`
+	// To, Label and Value are set for send hooks.
+	To    *common.Address `json:"to,omitempty"`
+	Label string          `json:"label,omitempty"`
+	Value string          `json:"value,omitempty"`
+	Tx    string          `json:"tx,omitempty"`
+	Error string          `json:"error,omitempty"`
+
+	rpcURL string
+}
+
+// hook is what runs around a step. Shell hooks come from the manifest;
+// builds of the tool that want hooks in Go add a file calling
+// registerHook from an init function, leaving the rest of the tree alone.
+type hook interface {
+	// wants reports whether the hook runs for e.
+	wants(e hookEvent) bool
+	// run runs the hook. An error from a pre hook stops the step before
+	// anything is sent; one from a post hook fails the run.
+	run(ctx context.Context, e hookEvent) error
+}
+
+// hookFunc adapts a function to a hook that runs for every event of one
+// kind, on every network.
+type hookFunc struct {
+	on string
+	fn func(context.Context, hookEvent) error
+}
+
+func (h hookFunc) wants(e hookEvent) bool                     { return e.Hook == h.on }
+func (h hookFunc) run(ctx context.Context, e hookEvent) error { return h.fn(ctx, e) }
+
+// goHooks are the hooks compiled into the tool, run after the manifest's.
+var goHooks []hook
+
+func registerHook(h hook) {
+	goHooks = append(goHooks, h)
+}
+
+// shellHook is a manifest hook.
+type shellHook struct {
+	hookConfig
+	root string
+}
+
+func (h shellHook) wants(e hookEvent) bool {
+	return h.On == e.Hook && (!e.DryRun || h.DryRun) &&
+		(len(h.Networks) == 0 || slices.Contains(h.Networks, e.Network)) &&
+		(len(h.Contracts) == 0 || slices.Contains(h.Contracts, e.Name))
+}
+
+func (h shellHook) run(ctx context.Context, e hookEvent) error {
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = defaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	input, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, "sh", "-c", h.Run)
+	cmd.Dir = h.root
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	cmd.Env = append(os.Environ(), e.environ()...)
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("%s hook %q timed out after %s", h.On, h.Run, timeout)
+		}
+		return fmt.Errorf("%s hook %q: %w", h.On, h.Run, err)
+	}
+	return nil
+}
+
+// environ returns e as the DEPLOY_* variables shell hooks see. The
+// addresses of a deploy step's deployments are also set by name, as
+// DEPLOY_ADDRESS_<Name>.
+func (e hookEvent) environ() []string {
+	to, address, tx := "", "", e.Tx
+	if e.To != nil {
+		to = e.To.Hex()
+	}
+	var named []string
+	for _, d := range e.Deployments {
+		named = append(named, "DEPLOY_ADDRESS_"+d.Name+"="+d.Address)
+		if d.Name == e.Name {
+			address = d.Address
+			if tx == "" {
+				tx = d.Tx
+			}
+		}
+	}
+	return append([]string{
+		"DEPLOY_HOOK=" + e.Hook,
+		"DEPLOY_NETWORK=" + e.Network,
+		"DEPLOY_CHAIN_ID=" + strconv.FormatUint(e.ChainID, 10),
+		"DEPLOY_RPC_URL=" + e.rpcURL,
+		"DEPLOY_DRY_RUN=" + strconv.FormatBool(e.DryRun),
+		"DEPLOY_NAME=" + e.Name,
+		"DEPLOY_CONTRACT=" + e.Contract,
+		"DEPLOY_ADDRESS=" + address,
+		"DEPLOY_TO=" + to,
+		"DEPLOY_LABEL=" + e.Label,
+		"DEPLOY_VALUE=" + e.Value,
+		"DEPLOY_TX=" + tx,
+		"DEPLOY_ERROR=" + e.Error,
+	}, named...)
+}
+
+// openHooks returns the manifest's hooks followed by those compiled in.
+func openHooks(m *manifest, root string) []hook {
+	var hooks []hook
+	for _, c := range m.Hooks {
+		hooks = append(hooks, shellHook{hookConfig: c, root: root})
+	}
+	return append(hooks, goHooks...)
+}
+
+// runHooks runs the hooks that want e, in order. The first failure stops
+// the rest, unless its hook continues on errors.
+func (r *networkRun) runHooks(ctx context.Context, e hookEvent) error {
+	e.Network, e.ChainID, e.DryRun, e.rpcURL = r.name, r.chainID.Uint64(), r.opts.DryRun, r.rpcURL
+	for _, h := range r.hooks {
+		if !h.wants(e) {
+			continue
+		}
+		if err := h.run(ctx, e); err != nil {
+			if sh, ok := h.(shellHook); ok && sh.ContinueOnError {
+				logger.Warn("Hook failed; continuing", "hook", e.Hook, "network", r.name, "err", err)
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// deployHookEvent describes a deploy step for its hooks.
+func deployHookEvent(kind string, spec contractSpec, deployed []deployment, err error) hookEvent {
+	e := hookEvent{Hook: kind, Name: spec.Name, Contract: spec.Contract}
+	for _, d := range deployed {
+		n := deployedNotice{Name: d.Name, Address: d.Address.Hex(), Existing: d.Skipped}
+		if !d.Skipped && d.TxHash != (common.Hash{}) {
+			n.Tx = d.TxHash.Hex()
+		}
+		e.Deployments = append(e.Deployments, n)
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// sendHookEvent describes a transaction to a contract for its hooks.
+func sendHookEvent(kind string, fields txFields, sent *sentTx, err error) hookEvent {
+	e := hookEvent{Hook: kind, To: fields.To, Label: fields.Label}
+	if fields.Value != nil && fields.Value.Sign() > 0 {
+		e.Value = fields.Value.String()
+	}
+	if sent != nil && sent.Hash != (common.Hash{}) {
+		e.Tx = sent.Hash.Hex()
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
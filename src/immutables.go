@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// immutableVar is an immutable state variable, as declared in the AST.
+type immutableVar struct {
+	Name string
+	// Type is solc's type string, e.g. address, uint256 or contract IToken.
+	Type string
+}
+
+// immutableVars returns the artifact's immutables by AST id, from the AST
+// that forge writes into artifacts (and compileSolc too). Artifacts without
+// one, such as prebuilt ones, yield nil, and their immutables are shown by
+// position only.
+func (a *artifact) immutableVars() map[string]immutableVar {
+	if len(a.ImmutableReferences) == 0 || a.Path == "" {
+		return nil
+	}
+	raw, err := os.ReadFile(a.Path)
+	if err != nil {
+		return nil
+	}
+	var withAST struct {
+		AST interface{} `json:"ast"`
+	}
+	if err := json.Unmarshal(raw, &withAST); err != nil || withAST.AST == nil {
+		return nil
+	}
+	vars := map[string]immutableVar{}
+	var walk func(n interface{})
+	walk = func(n interface{}) {
+		switch n := n.(type) {
+		case map[string]interface{}:
+			if n["nodeType"] == "VariableDeclaration" && n["mutability"] == "immutable" {
+				if id, ok := n["id"].(float64); ok {
+					v := immutableVar{}
+					v.Name, _ = n["name"].(string)
+					if td, ok := n["typeDescriptions"].(map[string]interface{}); ok {
+						v.Type, _ = td["typeString"].(string)
+					}
+					vars[strconv.FormatInt(int64(id), 10)] = v
+				}
+			}
+			for _, child := range n {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range n {
+				walk(child)
+			}
+		}
+	}
+	walk(withAST.AST)
+	return vars
+}
+
+// immutableABIType returns the ABI type an immutable of solc type typ is
+// encoded as, or false for types it cannot decode, such as user-defined
+// value types.
+func immutableABIType(typ string) (abi.Type, bool) {
+	switch {
+	case typ == "address payable", strings.HasPrefix(typ, "contract "):
+		typ = "address"
+	case strings.HasPrefix(typ, "enum "):
+		typ = "uint8"
+	}
+	t, err := abi.NewType(typ, "", nil)
+	if err != nil {
+		return abi.Type{}, false
+	}
+	switch t.T {
+	case abi.AddressTy, abi.UintTy, abi.IntTy, abi.BoolTy, abi.FixedBytesTy:
+		return t, true
+	}
+	return abi.Type{}, false
+}
+
+// decodedImmutable is an immutable's value read back from deployed code.
+type decodedImmutable struct {
+	Name  string
+	Value string
+	word  []byte
+}
+
+// decodeImmutables reads the artifact's immutables from its code on chain,
+// named and decoded where the AST allows it, in byte order. solc writes an
+// immutable everywhere the code reads it; each is listed once.
+func (a *artifact) decodeImmutables(code []byte) ([]decodedImmutable, error) {
+	vars := a.immutableVars()
+	ids := make([]string, 0, len(a.ImmutableReferences))
+	first := map[string]int{}
+	for id, ranges := range a.ImmutableReferences {
+		if len(ranges) == 0 {
+			continue
+		}
+		r := ranges[0]
+		if r.Start < 0 || r.Start+r.Length > len(code) {
+			return nil, fmt.Errorf("immutable reference %d+%d is outside the %d bytes on chain", r.Start, r.Length, len(code))
+		}
+		ids = append(ids, id)
+		first[id] = r.Start
+	}
+	sort.Slice(ids, func(i, j int) bool { return first[ids[i]] < first[ids[j]] })
+
+	var out []decodedImmutable
+	for _, id := range ids {
+		r := a.ImmutableReferences[id][0]
+		word := code[r.Start : r.Start+r.Length]
+		d := decodedImmutable{Name: fmt.Sprintf("immutable at byte %d", r.Start), Value: hexutil.Encode(word), word: word}
+		if v, ok := vars[id]; ok {
+			d.Name = v.Name
+			if t, ok := immutableABIType(v.Type); ok && len(word) == 32 {
+				if values, err := (abi.Arguments{{Type: t}}).Unpack(word); err == nil {
+					d.Value = formatValue(values[0])
+				}
+			}
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// checkImmutables reads back the immutables of a deployment from its code,
+// logs them and returns them by name for the registry. An immutable named
+// like a constructor parameter (token for token, _token or token_) is
+// compared with the argument it was given, and a difference is warned
+// about: the constructor stored something other than what was passed.
+func (r *networkRun) checkImmutables(ctx context.Context, d *deployment) map[string]string {
+	art := d.artifact
+	if art == nil || len(art.ImmutableReferences) == 0 {
+		return nil
+	}
+	code, err := r.client.CodeAt(ctx, d.Address, nil)
+	if err != nil || len(code) == 0 {
+		logger.Warn("Could not read the deployed code to check its immutables", "network", r.name, "name", d.Name, "err", err)
+		return nil
+	}
+	immutables, err := art.decodeImmutables(code)
+	if err != nil {
+		logger.Warn("Could not read the immutables", "network", r.name, "name", d.Name, "err", err)
+		return nil
+	}
+	type passed struct {
+		word  []byte
+		value string
+	}
+	args := map[string]passed{}
+	inputs := art.ABI.Constructor.Inputs
+	if values, err := inputs.Unpack(d.ConstructorArgs); err == nil && len(values) == len(inputs) {
+		for i, in := range inputs {
+			if _, ok := immutableABIType(in.Type.String()); !ok {
+				continue
+			}
+			if word, err := (abi.Arguments{{Type: in.Type}}).Pack(values[i]); err == nil {
+				args[in.Name] = passed{word, formatValue(values[i])}
+			}
+		}
+	}
+	out := make(map[string]string, len(immutables))
+	for _, im := range immutables {
+		out[im.Name] = im.Value
+		logger.Info("Immutable", "network", r.name, "name", d.Name, "variable", im.Name, "value", im.Value)
+		for _, param := range []string{im.Name, "_" + im.Name, im.Name + "_"} {
+			if arg, ok := args[param]; ok && !bytes.Equal(arg.word, im.word) {
+				logger.Warn("Immutable differs from the constructor argument it is named after", "network", r.name, "name", d.Name, "variable", im.Name, "value", im.Value, "argument", param, "passed", arg.value)
+			}
+		}
+	}
+	return out
+}
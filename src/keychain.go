@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// keychainService is the service the keys are stored under in the OS
+// keychain; each key is an account of it, named by the user.
+const keychainService = "deploy-keys"
+
+// errKeychainNotFound is returned when the keychain has no item by the
+// name.
+var errKeychainNotFound = errors.New("not in the keychain")
+
+// keychainNamePattern is what key names may look like, so that they pass
+// through the keychain tools' arguments unquoted.
+var keychainNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// openKeychainSigner signs with the private key stored in the OS keychain
+// under name, as keychain add leaves it.
+func openKeychainSigner(ctx context.Context, name string) (*keySigner, error) {
+	if name == "" {
+		return nil, errors.New("keychain signer needs the name of the key")
+	}
+	secret, err := keychainGet(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(strings.TrimSpace(secret), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid private key: %w", name, err)
+	}
+	return &keySigner{key: key}, nil
+}
+
+func runKeychain(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: keychain add|address|remove [flags] <name> (keys are kept in the %s)", keychainBackend)
+	}
+	switch args[0] {
+	case "add":
+		return runKeychainAdd(ctx, args[1:])
+	case "address":
+		return runKeychainAddress(ctx, args[1:])
+	case "remove":
+		return runKeychainRemove(ctx, args[1:])
+	}
+	return fmt.Errorf("unknown keychain command %q (want add, address or remove)", args[0])
+}
+
+func runKeychainAdd(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("keychain add", &rpcURL)
+	keyEnv := fs.String("key-env", "", "environment variable holding the private key (default: prompt)")
+	keystorePath := fs.String("keystore", "", "import the key of this encrypted JSON keystore file")
+	passwordEnv := fs.String("password-env", "", "environment variable holding the keystore password (default: prompt)")
+	anySecret := fs.Bool("secret", false, "store any secret, such as a mnemonic or an API key, for ${secret:keychain:name}; it is not checked to be a private key")
+	force := fs.Bool("force", false, "replace a key already stored under the name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: keychain add [-key-env VAR | -keystore file] [-secret] [-force] <name>")
+	}
+	name := fs.Arg(0)
+	if !keychainNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid name %q: use letters, digits, dots, dashes and underscores", name)
+	}
+	if *keyEnv != "" && *keystorePath != "" {
+		return errors.New("-key-env and -keystore are exclusive")
+	}
+	if !*force {
+		_, err := keychainGet(ctx, name)
+		if err == nil {
+			return fmt.Errorf("the keychain already has %s; pass -force to replace it", name)
+		}
+		if !errors.Is(err, errKeychainNotFound) {
+			return err
+		}
+	}
+
+	var secret string
+	switch {
+	case *keystorePath != "":
+		if *anySecret {
+			return errors.New("-secret stores the value as is; a keystore holds a private key")
+		}
+		raw, err := os.ReadFile(expandHome(*keystorePath))
+		if err != nil {
+			return err
+		}
+		password, err := keystorePassword(*keystorePath, *passwordEnv)
+		if err != nil {
+			return err
+		}
+		key, err := keystore.DecryptKey(raw, password)
+		if err != nil {
+			return fmt.Errorf("decrypt %s: %w", *keystorePath, err)
+		}
+		secret = fmt.Sprintf("%x", crypto.FromECDSA(key.PrivateKey))
+	case *keyEnv != "":
+		var ok bool
+		if secret, ok = os.LookupEnv(*keyEnv); !ok {
+			return fmt.Errorf("environment variable %s is not set", *keyEnv)
+		}
+	default:
+		what, prompt := "the private key", "Private key: "
+		if *anySecret {
+			what, prompt = "the secret", "Secret: "
+		}
+		var err error
+		if secret, err = promptSecret(what, prompt); err != nil {
+			return err
+		}
+	}
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		return errors.New("nothing to store")
+	}
+	var address string
+	if !*anySecret {
+		key, err := crypto.HexToECDSA(strings.TrimPrefix(secret, "0x"))
+		if err != nil {
+			return fmt.Errorf("invalid private key: %w; pass -secret to store something else", err)
+		}
+		secret = fmt.Sprintf("%x", crypto.FromECDSA(key))
+		address = crypto.PubkeyToAddress(key.PublicKey).Hex()
+	}
+	if err := keychainSet(ctx, name, secret); err != nil {
+		return fmt.Errorf("keychain: %w", err)
+	}
+	logger.Info("Stored in the keychain", "name", name, "keychain", keychainBackend)
+	if address != "" {
+		fmt.Printf("%s: %s\n", name, address)
+	}
+	return nil
+}
+
+func runKeychainAddress(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("keychain address", &rpcURL)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: keychain address <name>")
+	}
+	s, err := openKeychainSigner(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Println(s.Address().Hex())
+	return nil
+}
+
+func runKeychainRemove(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("keychain remove", &rpcURL)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: keychain remove <name>")
+	}
+	if err := keychainDelete(ctx, fs.Arg(0)); err != nil {
+		return fmt.Errorf("%s: %w", fs.Arg(0), err)
+	}
+	logger.Info("Removed from the keychain", "name", fs.Arg(0))
+	return nil
+}
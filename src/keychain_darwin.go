@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const keychainBackend = "macOS Keychain"
+
+// The security tool keeps generic passwords in the login keychain, which
+// macOS unlocks with the session and asks before handing to another app.
+
+func keychainGet(ctx context.Context, name string) (string, error) {
+	out, err := security(ctx, nil, "find-generic-password", "-s", keychainService, "-a", name, "-w")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(out, "\n"), nil
+}
+
+func keychainSet(ctx context.Context, name, secret string) error {
+	if strings.ContainsAny(secret, "\"\\\n") {
+		return errors.New("the secret has quotes, backslashes or newlines, which security cannot read from its input")
+	}
+	// Commands read from stdin keep the secret out of the process list.
+	cmd := fmt.Sprintf("add-generic-password -U -s %s -a %s -l \"%s: %s\" -w \"%s\"\n", keychainService, name, keychainService, name, secret)
+	_, err := security(ctx, strings.NewReader(cmd), "-i")
+	return err
+}
+
+func keychainDelete(ctx context.Context, name string) error {
+	_, err := security(ctx, nil, "delete-generic-password", "-s", keychainService, "-a", name)
+	return err
+}
+
+func security(ctx context.Context, stdin *strings.Reader, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "security", args...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if strings.Contains(msg, "could not be found") {
+			return "", errKeychainNotFound
+		}
+		return "", fmt.Errorf("security: %w: %s", err, msg)
+	}
+	// In interactive mode security reports failures on stderr but exits 0.
+	if stdin != nil && strings.TrimSpace(stderr.String()) != "" {
+		return "", fmt.Errorf("security: %s", strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
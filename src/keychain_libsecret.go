@@ -0,0 +1,62 @@
+//go:build !darwin && !windows
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const keychainBackend = "Secret Service keyring (libsecret)"
+
+// secret-tool talks to the Secret Service the desktop runs, GNOME Keyring
+// or KWallet, which keeps the items encrypted and locked with the session.
+
+func keychainGet(ctx context.Context, name string) (string, error) {
+	out, err := secretTool(ctx, "", "lookup", "service", keychainService, "account", name)
+	if err != nil {
+		return "", err
+	}
+	if out == "" {
+		// lookup fails without a message when there is no such item.
+		return "", errKeychainNotFound
+	}
+	return out, nil
+}
+
+func keychainSet(ctx context.Context, name, secret string) error {
+	// store reads the secret from stdin, out of the process list.
+	_, err := secretTool(ctx, secret, "store", "--label", keychainService+": "+name, "service", keychainService, "account", name)
+	return err
+}
+
+func keychainDelete(ctx context.Context, name string) error {
+	// clear succeeds whether or not the item exists.
+	if _, err := keychainGet(ctx, name); err != nil {
+		return err
+	}
+	_, err := secretTool(ctx, "", "clear", "service", keychainService, "account", name)
+	return err
+}
+
+func secretTool(ctx context.Context, stdin string, args ...string) (string, error) {
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return "", errors.New("secret-tool is not installed (it comes with libsecret, e.g. the libsecret-tools package)")
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "secret-tool", args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" && args[0] == "lookup" {
+			return "", nil
+		}
+		return "", fmt.Errorf("secret-tool: %w: %s", err, msg)
+	}
+	return strings.TrimRight(stdout.String(), "\n"), nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// storageLayout is solc's storageLayout output. forge includes it in
+// artifacts when extra_output contains "storageLayout".
+type storageLayout struct {
+	Storage []storageVar           `json:"storage"`
+	Types   map[string]storageType `json:"types"`
+}
+
+type storageVar struct {
+	Label  string `json:"label"`
+	Offset int    `json:"offset"`
+	Slot   string `json:"slot"`
+	Type   string `json:"type"`
+}
+
+type storageType struct {
+	Label         string `json:"label"`
+	NumberOfBytes string `json:"numberOfBytes"`
+	// Encoding is inplace, mapping, dynamic_array or bytes. Mappings name
+	// their Key and Value types, arrays their Base type, and structs list
+	// their Members with slots relative to the struct's.
+	Encoding string       `json:"encoding"`
+	Key      string       `json:"key"`
+	Value    string       `json:"value"`
+	Base     string       `json:"base"`
+	Members  []storageVar `json:"members"`
+}
+
+// typeLabel describes v's type independently of AST ids, which change
+// between compilations.
+func (l *storageLayout) typeLabel(v storageVar) string {
+	t, ok := l.Types[v.Type]
+	if !ok {
+		return v.Type
+	}
+	return t.Label + " (" + t.NumberOfBytes + " bytes)"
+}
+
+// checkStorageLayout verifies that an upgrade from the old layout to the new
+// one keeps every existing variable at the same slot, offset and type.
+// Appending variables is allowed; renames only produce a warning. Missing
+// layouts cannot be checked and also only warn.
+func checkStorageLayout(oldRaw, newRaw json.RawMessage) (warnings []string, err error) {
+	if len(oldRaw) == 0 || len(newRaw) == 0 || string(oldRaw) == "null" || string(newRaw) == "null" {
+		return []string{`storage layout unavailable; add extra_output = ["storageLayout"] to foundry.toml and rebuild`}, nil
+	}
+	var oldL, newL storageLayout
+	if err := json.Unmarshal(oldRaw, &oldL); err != nil {
+		return nil, fmt.Errorf("parse recorded storage layout: %w", err)
+	}
+	if err := json.Unmarshal(newRaw, &newL); err != nil {
+		return nil, fmt.Errorf("parse new storage layout: %w", err)
+	}
+
+	type position struct {
+		slot   string
+		offset int
+	}
+	byPos := make(map[position]storageVar, len(newL.Storage))
+	for _, v := range newL.Storage {
+		byPos[position{v.Slot, v.Offset}] = v
+	}
+
+	var problems []string
+	for _, old := range oldL.Storage {
+		nv, ok := byPos[position{old.Slot, old.Offset}]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s (slot %s, offset %d) was removed or moved", old.Label, old.Slot, old.Offset))
+			continue
+		}
+		if ot, nt := oldL.typeLabel(old), newL.typeLabel(nv); ot != nt {
+			problems = append(problems, fmt.Sprintf("%s (slot %s) changed type from %s to %s", old.Label, old.Slot, ot, nt))
+		}
+		if nv.Label != old.Label {
+			warnings = append(warnings, fmt.Sprintf("slot %s: %s renamed to %s", old.Slot, old.Label, nv.Label))
+		}
+	}
+	if len(problems) > 0 {
+		return warnings, fmt.Errorf("incompatible storage layout:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return warnings, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// linkReferences is solc's map of library placeholders in bytecode:
+// source path -> library name -> byte ranges holding its address.
+type linkReferences map[string]map[string][]struct {
+	Start  int `json:"start"`
+	Length int `json:"length"`
+}
+
+// placeholderPattern matches solc's "__$<hash>$__" library placeholders.
+var placeholderPattern = regexp.MustCompile(`__\$[0-9a-fA-F]{34}\$__`)
+
+// decodeCode decodes a bytecode object, zeroing unlinked library
+// placeholders so the code can be linked later by offset.
+func decodeCode(object string) []byte {
+	return common.FromHex(placeholderPattern.ReplaceAllString(object, strings.Repeat("0", 40)))
+}
+
+// libraries returns the "path:Name" keys of the libraries art must be
+// linked against, sorted.
+func (a *artifact) libraries() []string {
+	seen := map[string]bool{}
+	for _, refs := range []linkReferences{a.LinkReferences, a.DeployedLinkReferences} {
+		for path, libs := range refs {
+			for name := range libs {
+				seen[path+":"+name] = true
+			}
+		}
+	}
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// link writes library addresses, keyed "path:Name", into the artifact's
+// creation and runtime code.
+func (a *artifact) link(addrs map[string]common.Address) error {
+	a.Bytecode = append([]byte{}, a.Bytecode...)
+	a.DeployedBytecode = append([]byte{}, a.DeployedBytecode...)
+	for _, pass := range []struct {
+		refs linkReferences
+		code []byte
+	}{{a.LinkReferences, a.Bytecode}, {a.DeployedLinkReferences, a.DeployedBytecode}} {
+		for path, libs := range pass.refs {
+			for name, offsets := range libs {
+				addr, ok := addrs[path+":"+name]
+				if !ok {
+					return fmt.Errorf("%s needs library %s:%s, which has no address", a.Name, path, name)
+				}
+				for _, o := range offsets {
+					if o.Length != common.AddressLength || o.Start+o.Length > len(pass.code) {
+						return fmt.Errorf("bad link reference for %s in %s", name, a.Name)
+					}
+					copy(pass.code[o.Start:], addr.Bytes())
+				}
+			}
+		}
+	}
+	a.Libraries = addrs
+	return nil
+}
+
+// linkLibraries links art against its libraries. Each library's address
+// comes from the network's libraries setting, this run, or the registry;
+// libraries found nowhere are deployed first and recorded under their
+// name.
+func (r *networkRun) linkLibraries(ctx context.Context, art *artifact) error {
+	keys := art.libraries()
+	if len(keys) == 0 {
+		return nil
+	}
+	r.libraries.Lock()
+	defer r.libraries.Unlock()
+	addrs := make(map[string]common.Address, len(keys))
+	for _, key := range keys {
+		path, name, _ := strings.Cut(key, ":")
+		if addr, ok := r.libraryAddress(key, name); ok {
+			addrs[key] = addr
+			continue
+		}
+		logger.Info("Deploying library", "library", name, "for", art.Name)
+		lib, err := r.deploy(ctx, contractSpec{Name: name, Contract: filepath.Base(path) + ":" + name})
+		if err != nil {
+			return fmt.Errorf("library %s: %w", name, err)
+		}
+		if err := r.finish(ctx, lib); err != nil {
+			return fmt.Errorf("library %s: %w", name, err)
+		}
+		r.linked = append(r.linked, lib)
+		addrs[key] = lib.Address
+	}
+	return art.link(addrs)
+}
+
+func (r *networkRun) libraryAddress(key, name string) (common.Address, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, k := range []string{key, name} {
+		if a, ok := r.libraryConfig[k]; ok {
+			return common.HexToAddress(a), true
+		}
+	}
+	if a, ok := r.addresses[name]; ok {
+		return a, true
+	}
+	if e, ok := r.registry.Contracts[name]; ok {
+		return e.Address, true
+	}
+	return common.Address{}, false
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Lint checks, as reported in findings.
+const (
+	lintCodeSize          = "code-size"
+	lintSelectorCollision = "selector-collision"
+	lintAdminShadow       = "admin-shadow"
+	lintInitializer       = "initializer"
+	lintUpgradeable       = "uups-upgrade"
+)
+
+// lintFinding is a problem the static checks found in a manifest contract.
+type lintFinding struct {
+	Contract string `json:"contract"`
+	Check    string `json:"check"`
+	Message  string `json:"message"`
+}
+
+// transparentAdminFunctions are the functions a transparent proxy answers
+// itself when its admin calls them: upgradeToAndCall in OpenZeppelin 5,
+// and the rest in earlier versions.
+var transparentAdminFunctions = []string{
+	"upgradeToAndCall(address,bytes)",
+	"upgradeTo(address)",
+	"changeAdmin(address)",
+	"admin()",
+	"implementation()",
+}
+
+// initializedTopics are the Initialized events emitted by OpenZeppelin's
+// Initializable, v5 and v4, including by _disableInitializers.
+var initializedTopics = []common.Hash{
+	crypto.Keccak256Hash([]byte("Initialized(uint64)")),
+	crypto.Keccak256Hash([]byte("Initialized(uint8)")),
+}
+
+// lintManifest statically checks the manifest's compiled contracts: code
+// size unless allowOversize is set, and for proxied ones, selector clashes
+// with the proxy, initializer protection and, for UUPS, that the
+// implementation can be upgraded again.
+func lintManifest(root string, m *manifest, allowOversize bool) ([]lintFinding, error) {
+	findings := []lintFinding{}
+	for _, spec := range m.Contracts {
+		art, err := loadArtifact(root, spec.Contract)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", spec.Name, err)
+		}
+		add := func(check, format string, args ...interface{}) {
+			findings = append(findings, lintFinding{Contract: spec.Name, Check: check, Message: fmt.Sprintf(format, args...)})
+		}
+		if n := len(art.DeployedBytecode); n > maxCodeSize && !allowOversize {
+			add(lintCodeSize, "runtime code is %d bytes, over the %d-byte EIP-170 limit", n, maxCodeSize)
+		}
+		if n := len(art.Bytecode); n > maxInitCodeSize && !allowOversize {
+			add(lintCodeSize, "creation code is %d bytes, over the %d-byte EIP-3860 limit", n, maxInitCodeSize)
+		}
+		if spec.Proxy == nil {
+			continue
+		}
+		p := spec.Proxy
+
+		// Functions the proxy handles itself never reach the
+		// implementation.
+		proxyFuncs := map[[4]byte]string{}
+		if proxyArt, err := loadArtifact(root, p.contract()); err == nil {
+			for _, method := range proxyArt.ABI.Methods {
+				proxyFuncs[[4]byte(method.ID)] = method.Sig
+			}
+		}
+		admin := map[[4]byte]bool{}
+		if p.Kind == proxyTransparent {
+			for _, sig := range transparentAdminFunctions {
+				id := [4]byte(crypto.Keccak256([]byte(sig)))
+				proxyFuncs[id], admin[id] = sig, true
+			}
+		}
+		for _, method := range sortedMethods(art.ABI) {
+			id := [4]byte(method.ID)
+			sig, ok := proxyFuncs[id]
+			switch {
+			case !ok:
+			case admin[id]:
+				add(lintAdminShadow, "%s shadows the transparent proxy's admin function; the proxy admin's calls to it never reach the implementation", method.Sig)
+			case sig == method.Sig:
+				add(lintSelectorCollision, "%s is also a function of the proxy %s, which answers it instead of the implementation", method.Sig, p.contract())
+			default:
+				add(lintSelectorCollision, "%s has selector %#x, the same as the proxy's %s, which answers it instead", method.Sig, id, sig)
+			}
+		}
+
+		// An implementation left initializable can be taken over by
+		// whoever initializes it first.
+		if _, ok := art.ABI.Events["Initialized"]; ok && !disablesInitializers(art) {
+			add(lintInitializer, "the constructor does not call _disableInitializers(), so anyone can initialize the implementation contract itself")
+		}
+		if p.Initializer == "" {
+			for _, method := range sortedMethods(art.ABI) {
+				if strings.HasPrefix(method.Name, "initialize") {
+					add(lintInitializer, "the proxy is deployed without calling %s, so anyone can call it first; set proxy.initializer", method.Sig)
+					break
+				}
+			}
+		}
+		if p.Kind == proxyUUPS {
+			if _, ok := art.ABI.Methods["upgradeToAndCall"]; !ok {
+				if _, ok := art.ABI.Methods["upgradeTo"]; !ok {
+					add(lintUpgradeable, "the implementation has no upgradeToAndCall, so the UUPS proxy could never be upgraded again")
+				}
+			}
+		}
+	}
+	return findings, nil
+}
+
+// disablesInitializers reports whether art's constructor emits an
+// Initialized event, as _disableInitializers does. The constructor is the
+// creation code before the runtime code it returns.
+func disablesInitializers(art *artifact) bool {
+	ctor := art.Bytecode
+	if n := len(art.Bytecode) - len(art.DeployedBytecode); n > 0 {
+		ctor = art.Bytecode[:n]
+	}
+	for _, topic := range initializedTopics {
+		if bytes.Contains(ctor, append([]byte{0x7f}, topic.Bytes()...)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedMethods returns abi's methods in name order, for stable reports.
+func sortedMethods(contract abi.ABI) []abi.Method {
+	methods := make([]abi.Method, 0, len(contract.Methods))
+	for _, name := range sortedKeys(contract.Methods) {
+		methods = append(methods, contract.Methods[name])
+	}
+	return methods
+}
+
+// printLint writes the findings, one per line.
+func printLint(w io.Writer, findings []lintFinding) {
+	fmt.Fprintf(w, "Lint: %d problem(s)\n", len(findings))
+	for _, f := range findings {
+		fmt.Fprintf(w, "  %s [%s] %s\n", f.Contract, f.Check, f.Message)
+	}
+}
+
+// lintError fails a plan or deployment over findings.
+func lintError(findings []lintFinding) error {
+	return fmt.Errorf("lint found %d problem(s); fix them or pass -no-lint", len(findings))
+}
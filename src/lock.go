@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// runLock is held by a run that sends transactions on a network, so that a
+// second run against the same network from the same project, by another
+// engineer or CI job, cannot interleave nonces or overwrite the registry.
+// It is a file next to the registry, created exclusively and removed when
+// the run closes.
+type runLock struct {
+	Network string    `json:"network"`
+	Command string    `json:"command"`
+	User    string    `json:"user,omitempty"`
+	Host    string    `json:"host,omitempty"`
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+
+	path string
+}
+
+func runLockPath(root, network string) string {
+	return filepath.Join(root, "deployments", "."+network+".lock")
+}
+
+// acquireRunLock takes the network's lock in the records directory. A lock
+// left behind by a process on this host that no longer runs is taken
+// over; any other is refused, naming its holder.
+func acquireRunLock(records, network string) (*runLock, error) {
+	l := &runLock{Network: network, PID: os.Getpid(), Started: time.Now().UTC(), path: runLockPath(records, network)}
+	if len(os.Args) > 1 {
+		l.Command = os.Args[1]
+	}
+	if u, err := user.Current(); err == nil {
+		l.User = u.Username
+	}
+	l.Host, _ = os.Hostname()
+	raw, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return nil, err
+	}
+	for attempt := 0; ; attempt++ {
+		f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			_, err = f.Write(append(raw, '\n'))
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(l.path)
+				return nil, err
+			}
+			heldLocks.Store(l.path, true)
+			return l, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+		held, err := readRunLock(l.path)
+		if err != nil {
+			return nil, err
+		}
+		if attempt > 0 || held.running() {
+			return nil, fmt.Errorf("%s is locked by %s; wait for that run to finish, or if it is gone, remove the lock with `unlock -network %s`", network, held, network)
+		}
+		logger.Warn("Taking over the lock of a run that is no longer running", "network", network, "holder", held.String(), "lock", l.path)
+		if err := os.Remove(l.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+}
+
+func readRunLock(path string) (*runLock, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	held := &runLock{path: path}
+	if err := json.Unmarshal(raw, held); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return held, nil
+}
+
+// release removes the lock, unless another run has since taken it over.
+func (l *runLock) release() {
+	heldLocks.Delete(l.path)
+	if held, err := readRunLock(l.path); err == nil && held.Host == l.Host && held.PID == l.PID {
+		os.Remove(l.path)
+	}
+}
+
+// heldLocks are the lock files this process holds. A lock with this
+// process's id that it does not hold was left by an earlier process that
+// had the same id, as the first process in a container does.
+var heldLocks sync.Map
+
+// running reports whether the lock's holder may still be running: it is
+// on another host, where it cannot be checked, or a live process here.
+func (l *runLock) running() bool {
+	if host, _ := os.Hostname(); l.Host != host {
+		return true
+	}
+	if l.PID == os.Getpid() {
+		_, ok := heldLocks.Load(l.path)
+		return ok
+	}
+	return processAlive(l.PID)
+}
+
+func (l *runLock) String() string {
+	who := l.User
+	if l.Host != "" {
+		who += "@" + l.Host
+	}
+	return fmt.Sprintf("`%s` run by %s (pid %d) since %s", l.Command, who, l.PID, l.Started.Local().Format(time.DateTime))
+}
+
+// processAlive reports whether a process with the id runs on this host.
+// Processes of other users count as running.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return !errors.Is(p.Signal(syscall.Signal(0)), os.ErrProcessDone)
+}
+
+func runUnlock(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("unlock", flag.ContinueOnError)
+	network := fs.String("network", "", "network whose lock to remove (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *network == "" {
+		return errors.New("-network is required")
+	}
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	path := runLockPath(root, *network)
+	held, err := readRunLock(path)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("%s is not locked\n", *network)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if host, _ := os.Hostname(); held.Host == host && held.running() {
+		return fmt.Errorf("%s is locked by %s, which is still running", *network, held)
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	fmt.Printf("removed the lock held by %s\n", held)
+	return nil
+}
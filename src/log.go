@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// logger reports progress and warnings on stderr, keeping stdout for
+// results. -log-format switches it from the console format to logfmt or
+// JSON lines for log collectors.
+var logger = slog.New(newConsoleHandler(os.Stderr))
+
+const (
+	logFormatText   = "text"
+	logFormatLogfmt = "logfmt"
+	logFormatJSON   = "json"
+)
+
+func setLogFormat(format string) error {
+	switch format {
+	case logFormatText:
+		logger = slog.New(newConsoleHandler(os.Stderr))
+	case logFormatLogfmt:
+		logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+	case logFormatJSON:
+		logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	default:
+		return fmt.Errorf("unknown log format %q (want text, logfmt or json)", format)
+	}
+	return nil
+}
+
+// consoleHandler writes one line per record for people: the message, then
+// its attributes as key=value. Warnings and errors are prefixed with their
+// level; timestamps are left out.
+type consoleHandler struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	attrs []slog.Attr
+}
+
+func newConsoleHandler(w io.Writer) *consoleHandler {
+	return &consoleHandler{mu: &sync.Mutex{}, w: w}
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= slog.LevelInfo
+}
+
+func (h *consoleHandler) Handle(_ context.Context, rec slog.Record) error {
+	var b strings.Builder
+	if rec.Level >= slog.LevelWarn {
+		b.WriteString(strings.ToLower(rec.Level.String()) + ": ")
+	}
+	b.WriteString(rec.Message)
+	write := func(a slog.Attr) bool {
+		v := a.Value.Resolve().String()
+		if strings.ContainsAny(v, " \t\"") {
+			v = fmt.Sprintf("%q", v)
+		}
+		fmt.Fprintf(&b, " %s=%s", a.Key, v)
+		return true
+	}
+	for _, a := range h.attrs {
+		write(a)
+	}
+	rec.Attrs(write)
+	b.WriteByte('\n')
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &consoleHandler{mu: h.mu, w: h.w, attrs: append(append([]slog.Attr{}, h.attrs...), attrs...)}
+}
+
+// WithGroup is not used by the tool; groups are flattened.
+func (h *consoleHandler) WithGroup(string) slog.Handler { return h }
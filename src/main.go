@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// command is a single CLI subcommand. run receives the arguments that
+// follow the subcommand name, and a context that is cancelled on Ctrl-C or
+// SIGTERM.
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{"deploy", "deploy a contract", runDeploy},
+	{"plan", "show what deploying a manifest would change, without sending anything", runPlan},
+	{"verify", "check that a contract is deployed at an address", runVerify},
+	{"encode-args", "print the ABI-encoded constructor arguments for given inputs", runEncodeArgs},
+	{"verify-onchain", "compare the runtime code on chain with the local build", runVerifyOnchain},
+	{"genesis", "build a devnet genesis alloc with the manifest's contracts predeployed", runGenesis},
+	{"gas-report", "measure the gas of deploying a manifest and compare it with the previous commit", runGasReport},
+	{"flatten", "print a contract's sources as one file, for explorers that take single files", runFlatten},
+	{"reproduce", "rebuild deployed contracts from pinned metadata and compare with the chain", runReproduce},
+	{"call", "send a read-only eth_call to a contract", runCall},
+	{"storage", "read a contract's storage variable or slot, decoded using its storage layout", runStorage},
+	{"console", "evaluate read-only calls against deployed contracts interactively", runConsole},
+	{"send", "call a contract method in a transaction", runSend},
+	{"approve", "set an ERC-20 allowance, directly or through Permit2", runApprove},
+	{"permit", "sign, and optionally submit, an EIP-2612 permit", runPermit},
+	{"trace", "print a transaction's call trace", runTrace},
+	{"decode", "decode calldata or a transaction's input against the registry ABIs", runDecode},
+	{"bump", "replace a stuck transaction with a higher fee", runBump},
+	{"fees", "analyze recent base fees and suggest when to send", runFees},
+	{"pending", "list broadcast transactions that are not mined, and speed up or cancel them", runPending},
+	{"unlock", "remove a network's run lock left behind by a run that is gone", runUnlock},
+	{"emergency", "pause, unpause or transfer ownership of deployed contracts at once", runEmergency},
+	{"keychain", "store deployment keys in the OS keychain, for the keychain signer", runKeychain},
+	{"sign", "sign a message or EIP-712 typed data with the signer", runSign},
+	{"verify-sig", "check who signed a message or EIP-712 typed data", runVerifySig},
+	{"verify-attestation", "check a deployment's signed provenance attestation", runVerifyAttestation},
+	{"watch", "print a contract's events as they are emitted", runWatch},
+	{"monitor", "store governance events from all registry contracts and serve them over HTTP", runMonitor},
+	{"serve-registry", "serve the deployment registry and transaction history over an HTTP API", runServeRegistry},
+	{"status", "show the connected network and an address' state", runStatus},
+	{"address", "look up a deployed contract in the registry", runAddress},
+	{"bindgen", "generate a typed Go binding from a contract's ABI", runBindgen},
+	{"abi-diff", "compare a deployed contract's ABI with the local build before upgrading it", runABIDiff},
+	{"upgrade", "upgrade a proxy to a new implementation", runUpgrade},
+	{"approvers", "list, add or remove the Governance contract's approvers", runApprovers},
+	{"proposal", "create, vote on, finalize, approve and track Governance proposals", runProposal},
+	{"schedule", "queue a call through a TimelockController", runSchedule},
+	{"execute", "execute a queued timelock operation once ready", runExecute},
+	{"pending-ops", "list queued timelock operations and their ETAs", runPendingOps},
+	{"history", "list the transactions in the audit log", runHistory},
+	{"registry", "export the registry, ABIs and artifacts to a signed archive, or import one", runRegistry},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitUsage)
+	}
+	name := os.Args[1]
+	if name == "-h" || name == "-help" || name == "--help" || name == "help" {
+		usage()
+		return
+	}
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		ctx, stop := interruptContext()
+		err := c.run(ctx, os.Args[2:])
+		interrupted := ctx.Err() != nil
+		stop()
+		if err != nil {
+			if err != flag.ErrHelp {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			}
+			os.Exit(exitCode(err, interrupted))
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	usage()
+	os.Exit(exitUsage)
+}
+
+// interruptContext returns a context cancelled by the first Ctrl-C or
+// SIGTERM, so commands can stop polling and save their progress. A second
+// signal kills the process.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sigs:
+			logger.Warn("Interrupted; stopping after saving progress (press Ctrl-C again to force)")
+			signal.Stop(sigs)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(sigs)
+		cancel()
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [flags]\n\ncommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nrun '%s <command> -h' for command flags\n", os.Args[0])
+}
+
+// newFlagSet returns a flag set for a subcommand with the flags every
+// command shares already registered.
+func newFlagSet(name string, rpcURL *string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Func("log-format", "format of progress messages on stderr: text, logfmt or json", setLogFormat)
+	fs.StringVar(rpcURL, "rpc", defaultRPCURL(), "JSON-RPC endpoint (env ETH_RPC_URL); a comma-separated list of HTTP endpoints fails over in order")
+	fs.Float64Var(&rpcRateLimit, "rpc-rps", 0, "send at most this many HTTP requests per second to the RPC endpoint (0: no limit); overrides a network's rpcRateLimit")
+	fs.IntVar(&rpcBatchSize, "rpc-batch-size", defaultBatchSize, "most calls per JSON-RPC batch request")
+	fs.IntVar(&rpcMaxInFlight, "rpc-max-inflight", 0, "most JSON-RPC requests outstanding to each endpoint at once (default 16); overrides a network's rpcMaxInFlight")
+	fs.StringVar(&rpcCacheDir, "rpc-cache", "", "cache eth_call, eth_getCode and eth_getStorageAt results by block in this directory, e.g. ~/.cache/rpc (HTTP endpoints only)")
+	fs.Func("rpc-header", `HTTP header for the RPC endpoints, as "Name: value"; environment variables in the value are expanded (repeatable)`, addRPCHeader)
+	return fs
+}
+
+// addRegistryFlag registers -network, the registry used to resolve
+// deployment names given in place of addresses.
+func addRegistryFlag(fs *flag.FlagSet) *string {
+	return fs.String("network", defaultNetwork, "registry network used to resolve deployment names")
+}
+
+// defaultRPCURL falls back to the local anvil node when ETH_RPC_URL is unset.
+func defaultRPCURL() string {
+	if url := os.Getenv("ETH_RPC_URL"); url != "" {
+		return url
+	}
+	return "http://127.0.0.1:8545"
+}
+
+// flagSet reports whether the named flag was given on the command line.
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// manifest is a declarative deployment plan, usually deployments.yaml:
+//
+//	networks:
+//	  sepolia:
+//	    rpc: ${SEPOLIA_RPC_URL}
+//	  base:
+//	    rpc: https://mainnet.base.org
+//	signer:                # optional, defaults to the node's first account
+//	  type: env
+//	  env: DEPLOYER_PRIVATE_KEY
+//	contracts:
+//	  - name: Token
+//	    contract: Token.sol
+//	  - name: Governance
+//	    contract: Governance.sol
+//	    args: ["${Token.address}", ["0xApprover1", "0xApprover2"]]
+//	    networks:          # optional per-network overrides
+//	      base:
+//	        args: ["0xBaseToken", ["0xApprover1"]]
+//	    gas:
+//	      maxFeePerGas: 30gwei
+//	      bufferPercent: 20
+//	      maxCost: 0.05ether
+type manifest struct {
+	Networks map[string]networkConfig `yaml:"networks"`
+	Signer   signerConfig             `yaml:"signer"`
+	// Compiler controls the build that runs before deploying.
+	Compiler compilerConfig `yaml:"compiler"`
+	// Gas holds defaults for every contract's gas settings.
+	Gas       gasConfig      `yaml:"gas"`
+	Contracts []contractSpec `yaml:"contracts"`
+	// Calls configure the contracts once all of them are deployed.
+	Calls []callSpec `yaml:"calls"`
+	// Batch sends the calls as one transaction: none (default), multicall3
+	// or eip5792.
+	Batch string `yaml:"batch"`
+	// Distributions send tokens to the accounts listed in CSV files once
+	// the calls are made.
+	Distributions []distributionSpec `yaml:"distributions"`
+	// Assertions check on-chain state once everything is deployed and
+	// configured; see assertion.
+	Assertions []string `yaml:"assertions"`
+	// Prices enables a fiat cost report after deploying.
+	Prices *priceConfig `yaml:"prices"`
+	// Report writes a Markdown or HTML report of each deploy run.
+	Report *reportConfig `yaml:"report"`
+	// Notify posts deployment events to webhooks.
+	Notify []notifyConfig `yaml:"notify"`
+	// Hooks run shell commands around each deployment and transaction.
+	Hooks []hookConfig `yaml:"hooks"`
+	// Confirmations overrides the default of -confirmations.
+	Confirmations *uint64 `yaml:"confirmations"`
+	// ReorgDepth overrides the default of -reorg-depth.
+	ReorgDepth *uint64 `yaml:"reorgDepth"`
+	// Attest signs a provenance attestation for each deployment, as
+	// -attest does.
+	Attest string `yaml:"attest"`
+
+	// path is the file the manifest was loaded from, empty for the
+	// single-contract flags, and profile the profile applied to it.
+	path    string
+	profile string
+}
+
+type contractSpec struct {
+	// Name identifies the deployment in output and the registry; defaults
+	// to the contract name.
+	Name     string        `yaml:"name"`
+	Contract string        `yaml:"contract"`
+	Args     []interface{} `yaml:"args"`
+	Value    string        `yaml:"value"`
+	// Salt deploys through the CREATE2 factory, giving the same address on
+	// every chain for the same init code.
+	Salt string `yaml:"salt"`
+	// DependsOn lists deployments that must run first, in addition to
+	// those referenced as ${Name.address} in the arguments.
+	DependsOn []string `yaml:"dependsOn"`
+	// Proxy deploys the contract as the implementation behind a proxy.
+	Proxy *proxyConfig `yaml:"proxy"`
+	Gas   gasConfig    `yaml:"gas"`
+	// TransferOwnership hands the contract to this address, e.g. a Safe,
+	// at the end of the run; see transferOwnerships.
+	TransferOwnership string                      `yaml:"transferOwnership"`
+	Networks          map[string]contractOverride `yaml:"networks"`
+	// Instances deploys the contract once per entry, each under its own
+	// name and tracked separately in the registry. Every other field is
+	// shared by the instances unless an instance sets it.
+	Instances []contractInstance `yaml:"instances"`
+	// Setters update the contract's reference to another deployment with a
+	// call when deploy -changed redeploys that deployment, instead of
+	// redeploying this one too, keyed by the deployment's name.
+	Setters map[string]setterSpec `yaml:"setters"`
+}
+
+// setterSpec is the call that points a contract at a redeployed
+// dependency:
+//
+//	setters:
+//	  Governance:
+//	    method: setGovernance
+//	    args: ["${Governance.address}"]   # the default
+type setterSpec struct {
+	Method string        `yaml:"method"`
+	Args   []interface{} `yaml:"args"`
+}
+
+// contractInstance is one of the deployments of a contractSpec with
+// instances:
+//
+//	contracts:
+//	  - contract: Governance.sol
+//	    instances:
+//	      - name: GovernanceUSDC
+//	        args: ["${USDC}", ["0xApprover1"]]
+//	      - name: GovernanceWETH
+//	        args: ["${WETH}", ["0xApprover1", "0xApprover2"]]
+type contractInstance struct {
+	Name              string                      `yaml:"name"`
+	Args              []interface{}               `yaml:"args"`
+	Value             string                      `yaml:"value"`
+	Salt              string                      `yaml:"salt"`
+	DependsOn         []string                    `yaml:"dependsOn"`
+	TransferOwnership string                      `yaml:"transferOwnership"`
+	Networks          map[string]contractOverride `yaml:"networks"`
+}
+
+// expandInstances replaces each spec with instances by one spec per
+// instance.
+func expandInstances(specs []contractSpec) ([]contractSpec, error) {
+	var out []contractSpec
+	for i, c := range specs {
+		if len(c.Instances) == 0 {
+			out = append(out, c)
+			continue
+		}
+		if c.Name != "" {
+			return nil, fmt.Errorf("contracts[%d]: name and instances cannot both be set; name each instance instead", i)
+		}
+		for j, inst := range c.Instances {
+			if inst.Name == "" {
+				return nil, fmt.Errorf("contracts[%d].instances[%d]: name is required", i, j)
+			}
+			spec := c
+			spec.Name, spec.Instances = inst.Name, nil
+			if inst.Args != nil {
+				spec.Args = inst.Args
+			}
+			if inst.Value != "" {
+				spec.Value = inst.Value
+			}
+			if inst.Salt != "" {
+				spec.Salt = inst.Salt
+			}
+			if inst.TransferOwnership != "" {
+				spec.TransferOwnership = inst.TransferOwnership
+			}
+			spec.DependsOn = append(slices.Clone(c.DependsOn), inst.DependsOn...)
+			if inst.Networks != nil {
+				spec.Networks = inst.Networks
+			}
+			out = append(out, spec)
+		}
+	}
+	return out, nil
+}
+
+// contractOverride replaces parts of a contractSpec on one network.
+type contractOverride struct {
+	Args              []interface{} `yaml:"args"`
+	Value             string        `yaml:"value"`
+	TransferOwnership string        `yaml:"transferOwnership"`
+}
+
+// loadManifest reads and validates the manifest at path with the named
+// profile applied, if any, replacing ${secret:...} placeholders with the
+// secrets they name.
+func loadManifest(ctx context.Context, path, profile string) (*manifest, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	settings, err := applyProfile(&doc, profile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	// Keys and passwords may only come from a secret store, never the
+	// manifest itself.
+	for _, field := range []string{"secret", "password"} {
+		if n := mappingValue(&doc, "signer", field); n != nil && !secretPattern.MatchString(n.Value) {
+			return nil, fmt.Errorf("%s: line %d: signer %s must be a ${secret:...} reference, not the value itself", path, n.Line, field)
+		}
+	}
+	if err := newSecretResolver(filepath.Dir(path)).expandNode(ctx, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var m manifest
+	if err := doc.Decode(&m); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	settings.apply(&m)
+	if err := m.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	m.path, m.profile = path, profile
+	return &m, nil
+}
+
+// mappingValue returns the node at keys in the YAML document n, or nil.
+func mappingValue(n *yaml.Node, keys ...string) *yaml.Node {
+	if n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	for _, key := range keys {
+		if n.Kind != yaml.MappingNode {
+			return nil
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == key {
+				next = n.Content[i+1]
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		n = next
+	}
+	return n
+}
+
+func (m *manifest) validate() error {
+	if len(m.Networks) == 0 {
+		return fmt.Errorf("no networks configured")
+	}
+	for name, n := range m.Networks {
+		if n.RPC == "" && n.Anvil == nil {
+			return fmt.Errorf("network %s: rpc or anvil is required", name)
+		}
+		if n.RPCRateLimit < 0 {
+			return fmt.Errorf("network %s: rpcRateLimit must not be negative", name)
+		}
+		for host, headers := range n.RPCHeaders {
+			for k := range headers {
+				if k == "" || strings.ContainsAny(k, " :\r\n") {
+					return fmt.Errorf("network %s: rpcHeaders: %s: invalid header name %q", name, host, k)
+				}
+			}
+		}
+		for lib, addr := range n.Libraries {
+			if _, err := parseAddress(addr); err != nil {
+				return fmt.Errorf("network %s: library %s: %w", name, lib, err)
+			}
+		}
+		if n.Safe != nil {
+			if _, err := parseAddress(n.Safe.Address); err != nil {
+				return fmt.Errorf("network %s: safe: %w", name, err)
+			}
+		}
+		if n.UserOp != nil {
+			if err := n.UserOp.validate(); err != nil {
+				return fmt.Errorf("network %s: userOp: %w", name, err)
+			}
+			if n.Safe != nil {
+				return fmt.Errorf("network %s: a Safe and a smart account cannot both send the transactions", name)
+			}
+		}
+		if n.Relay != nil {
+			if err := n.Relay.validate(); err != nil {
+				return fmt.Errorf("network %s: relay: %w", name, err)
+			}
+			if n.Safe != nil || n.UserOp != nil {
+				return fmt.Errorf("network %s: a relay cannot send the transactions of a Safe or smart account", name)
+			}
+		}
+		switch n.Rollup {
+		case "", rollupNone, rollupOP, rollupArbitrum:
+		default:
+			return fmt.Errorf("network %s: unknown rollup %q (want %s, %s or %s)", name, n.Rollup, rollupOP, rollupArbitrum, rollupNone)
+		}
+		switch n.BlobProofs {
+		case "", blobProofsCell, blobProofsBlob:
+		default:
+			return fmt.Errorf("network %s: unknown blobProofs %q (want %s or %s)", name, n.BlobProofs, blobProofsCell, blobProofsBlob)
+		}
+		switch n.chainKind(name) {
+		case "", chainEVM:
+		case chainZKsync:
+			if n.Safe != nil {
+				return fmt.Errorf("network %s: safe is not supported on %s networks", name, chainZKsync)
+			}
+			if n.UserOp != nil {
+				return fmt.Errorf("network %s: userOp is not supported on %s networks, whose accounts are native", name, chainZKsync)
+			}
+		default:
+			return fmt.Errorf("network %s: unknown chain %q (want %s or %s)", name, n.Chain, chainEVM, chainZKsync)
+		}
+	}
+	if err := m.Gas.validate(); err != nil {
+		return fmt.Errorf("gas: %w", err)
+	}
+	if err := m.Compiler.validate(); err != nil {
+		return fmt.Errorf("compiler: %w", err)
+	}
+	contracts, err := expandInstances(m.Contracts)
+	if err != nil {
+		return err
+	}
+	m.Contracts = contracts
+	seen := make(map[string]string, len(m.Contracts))
+	for i := range m.Contracts {
+		c := &m.Contracts[i]
+		if c.Contract == "" {
+			return fmt.Errorf("contracts[%d]: contract is required", i)
+		}
+		if c.Name == "" {
+			_, c.Name = splitContractRef(c.Contract)
+		}
+		if other, dup := seen[c.Name]; dup {
+			return fmt.Errorf("contracts[%d]: %s is already the name of a deployment of %s; give each deployment of a contract its own name", i, c.Name, other)
+		}
+		seen[c.Name] = c.Contract
+		if _, err := parseWei(c.Value); err != nil {
+			return fmt.Errorf("%s: value: %w", c.Name, err)
+		}
+		if err := c.Gas.validate(); err != nil {
+			return fmt.Errorf("%s: gas: %w", c.Name, err)
+		}
+		if c.Proxy != nil {
+			if err := c.Proxy.validate(); err != nil {
+				return fmt.Errorf("%s: %w", c.Name, err)
+			}
+		}
+		if c.TransferOwnership != "" {
+			if err := validateOwner(c.TransferOwnership); err != nil {
+				return fmt.Errorf("%s: transferOwnership: %w", c.Name, err)
+			}
+		}
+		if c.Salt != "" {
+			if _, err := parseSalt(c.Salt); err != nil {
+				return fmt.Errorf("%s: %w", c.Name, err)
+			}
+		}
+		for dep, setter := range c.Setters {
+			if setter.Method == "" {
+				return fmt.Errorf("%s: setters: %s: method is required", c.Name, dep)
+			}
+			if dep == c.Name {
+				return fmt.Errorf("%s: setters: a contract cannot be pointed at itself", c.Name)
+			}
+			if setter.Args == nil {
+				setter.Args = []interface{}{"${" + dep + ".address}"}
+				c.Setters[dep] = setter
+			}
+		}
+		for network, o := range c.Networks {
+			if _, ok := m.Networks[network]; !ok {
+				return fmt.Errorf("%s: override for unknown network %s", c.Name, network)
+			}
+			if _, err := parseWei(o.Value); err != nil {
+				return fmt.Errorf("%s on %s: value: %w", c.Name, network, err)
+			}
+			if o.TransferOwnership != "" {
+				if err := validateOwner(o.TransferOwnership); err != nil {
+					return fmt.Errorf("%s on %s: transferOwnership: %w", c.Name, network, err)
+				}
+			}
+		}
+	}
+	for i := range m.Calls {
+		if err := m.Calls[i].validate(); err != nil {
+			return fmt.Errorf("calls[%d]: %w", i, err)
+		}
+	}
+	for i := range m.Distributions {
+		if err := m.Distributions[i].validate(); err != nil {
+			return fmt.Errorf("distributions[%d]: %w", i, err)
+		}
+	}
+	for i, expr := range m.Assertions {
+		if _, err := parseAssertion(expr); err != nil {
+			return fmt.Errorf("assertions[%d]: %w", i, err)
+		}
+	}
+	if m.Prices != nil {
+		if err := m.Prices.validate(); err != nil {
+			return fmt.Errorf("prices: %w", err)
+		}
+	}
+	if m.Report != nil {
+		if err := m.Report.validate(); err != nil {
+			return fmt.Errorf("report: %w", err)
+		}
+	}
+	for i := range m.Notify {
+		if err := m.Notify[i].validate(); err != nil {
+			return fmt.Errorf("notify[%d]: %w", i, err)
+		}
+	}
+	for i := range m.Hooks {
+		if err := m.Hooks[i].validate(); err != nil {
+			return fmt.Errorf("hooks[%d]: %w", i, err)
+		}
+	}
+	switch m.Batch {
+	case "", batchNone, batchMulticall, batchEIP5792:
+	default:
+		return fmt.Errorf("batch: unknown mode %q (want none, multicall3 or eip5792)", m.Batch)
+	}
+	if m.Batch != "" && m.Batch != batchNone && len(m.Calls) > 1 {
+		for i, c := range m.Calls {
+			if len(c.Blobs) > 0 {
+				return fmt.Errorf("calls[%d]: calls with blobs cannot be batched; each is its own blob transaction", i)
+			}
+		}
+	}
+	ordered, err := orderContracts(m.Contracts)
+	if err != nil {
+		return err
+	}
+	m.Contracts = ordered
+	return nil
+}
+
+// networkNames returns the configured networks in a stable order.
+func (m *manifest) networkNames() []string {
+	names := make([]string, 0, len(m.Networks))
+	for name := range m.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// selectNetworks validates a user-supplied subset of networks; an empty
+// selection means all of them.
+func (m *manifest) selectNetworks(selected []string) ([]string, error) {
+	if len(selected) == 0 {
+		return m.networkNames(), nil
+	}
+	for _, name := range selected {
+		if _, ok := m.Networks[name]; !ok {
+			return nil, fmt.Errorf("network %s is not in the manifest (have %v)", name, m.networkNames())
+		}
+	}
+	return slices.Compact(slices.Sorted(slices.Values(selected))), nil
+}
+
+// forNetwork returns spec with the overrides for network applied.
+func (c contractSpec) forNetwork(network string) contractSpec {
+	o, ok := c.Networks[network]
+	if !ok {
+		return c
+	}
+	if o.Args != nil {
+		c.Args = o.Args
+	}
+	if o.Value != "" {
+		c.Value = o.Value
+	}
+	if o.TransferOwnership != "" {
+		c.TransferOwnership = o.TransferOwnership
+	}
+	return c
+}
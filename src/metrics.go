@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metric names, in the Prometheus text format. Everything is labelled by
+// network or RPC endpoint (scheme and host only, as in log output).
+const (
+	metricRPCDuration     = "deploy_rpc_request_duration_seconds"
+	metricRPCThrottled    = "deploy_rpc_throttled_total"
+	metricRPCErrors       = "deploy_rpc_errors_total"
+	metricRPCInFlight     = "deploy_rpc_in_flight"
+	metricRPCQueued       = "deploy_rpc_queued_total"
+	metricRPCCache        = "deploy_rpc_cache_total"
+	metricTxSent          = "deploy_transactions_sent_total"
+	metricTxPending       = "deploy_transactions_pending"
+	metricTxConfirmed     = "deploy_transactions_confirmed_total"
+	metricConfirmDuration = "deploy_transaction_confirmation_seconds"
+	metricErrors          = "deploy_errors_total"
+	metricEvents          = "deploy_watch_events_total"
+	metricLastBlock       = "deploy_watch_last_block"
+)
+
+const (
+	counterMetric   = "counter"
+	gaugeMetric     = "gauge"
+	histogramMetric = "histogram"
+)
+
+// metricFamily is one metric and its series, keyed by rendered labels.
+type metricFamily struct {
+	help    string
+	kind    string
+	buckets []float64
+	series  map[string]*metricSeries
+}
+
+type metricSeries struct {
+	value  float64
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// metricSet collects the tool's metrics. Recording is cheap and always on;
+// the values are only exposed when -metrics-addr starts the endpoint.
+type metricSet struct {
+	mu       sync.Mutex
+	families map[string]*metricFamily
+}
+
+var metrics = newMetricSet()
+
+func newMetricSet() *metricSet {
+	latency := []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	confirm := []float64{1, 5, 15, 30, 60, 120, 300, 600}
+	m := &metricSet{families: map[string]*metricFamily{}}
+	for name, f := range map[string]metricFamily{
+		metricRPCDuration:     {help: "JSON-RPC request latency, retries included.", kind: histogramMetric, buckets: latency},
+		metricRPCErrors:       {help: "Failed JSON-RPC attempts that were retried or switched endpoint.", kind: counterMetric},
+		metricRPCThrottled:    {help: "JSON-RPC requests delayed by the client-side rate limit.", kind: counterMetric},
+		metricRPCInFlight:     {help: "JSON-RPC requests outstanding, by endpoint.", kind: gaugeMetric},
+		metricRPCQueued:       {help: "JSON-RPC requests that waited for a free slot under the in-flight limit.", kind: counterMetric},
+		metricRPCCache:        {help: "Reads answered from the -rpc-cache (hit) or sent on to the endpoint (miss).", kind: counterMetric},
+		metricTxSent:          {help: "Transactions broadcast.", kind: counterMetric},
+		metricTxPending:       {help: "Transactions waiting for their confirmations.", kind: gaugeMetric},
+		metricTxConfirmed:     {help: "Transactions that reached their confirmations, by receipt status.", kind: counterMetric},
+		metricConfirmDuration: {help: "Time from waiting on a transaction until it had its confirmations.", kind: histogramMetric, buckets: confirm},
+		metricErrors:          {help: "Failed transactions and runs, by kind.", kind: counterMetric},
+		metricEvents:          {help: "Contract events printed by watch or stored by monitor.", kind: counterMetric},
+		metricLastBlock:       {help: "Block of the last event printed by watch or stored by monitor.", kind: gaugeMetric},
+	} {
+		f.series = map[string]*metricSeries{}
+		m.families[name] = &f
+	}
+	return m
+}
+
+// labels renders alternating label names and values.
+func labels(kv ...string) string {
+	parts := make([]string, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		parts = append(parts, kv[i]+"="+strconv.Quote(kv[i+1]))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (m *metricSet) series(name, lbls string) *metricSeries {
+	f := m.families[name]
+	s, ok := f.series[lbls]
+	if !ok {
+		s = &metricSeries{counts: make([]uint64, len(f.buckets))}
+		f.series[lbls] = s
+	}
+	return s
+}
+
+// add adds delta to a counter or gauge.
+func (m *metricSet) add(name string, delta float64, kv ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.series(name, labels(kv...)).value += delta
+}
+
+// set sets a gauge.
+func (m *metricSet) set(name string, v float64, kv ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.series(name, labels(kv...)).value = v
+}
+
+// observe records v in a histogram.
+func (m *metricSet) observe(name string, v float64, kv ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.series(name, labels(kv...))
+	for i, le := range m.families[name].buckets {
+		if v <= le {
+			s.counts[i]++
+			break
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+// write renders every metric in the Prometheus text exposition format.
+func (m *metricSet) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.families))
+	for name := range m.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := m.families[name]
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, f.help, name, f.kind)
+		keys := make([]string, 0, len(f.series))
+		for k := range f.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			s := f.series[k]
+			if f.kind != histogramMetric {
+				fmt.Fprintf(w, "%s%s %s\n", name, braces(k), formatFloat(s.value))
+				continue
+			}
+			var cumulative uint64
+			for i, le := range f.buckets {
+				cumulative += s.counts[i]
+				fmt.Fprintf(w, "%s_bucket%s %d\n", name, braces(joinLabels(k, labels("le", formatFloat(le)))), cumulative)
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, braces(joinLabels(k, labels("le", "+Inf"))), s.count)
+			fmt.Fprintf(w, "%s_sum%s %s\n", name, braces(k), formatFloat(s.sum))
+			fmt.Fprintf(w, "%s_count%s %d\n", name, braces(k), s.count)
+		}
+	}
+}
+
+func braces(lbls string) string {
+	if lbls == "" {
+		return ""
+	}
+	return "{" + lbls + "}"
+}
+
+func joinLabels(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + "," + b
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// serveMetrics serves /metrics on addr until ctx is done. An empty addr
+// does nothing. The listener is opened before returning so a port that is
+// taken fails the command up front.
+func serveMetrics(ctx context.Context, addr string) error {
+	if addr == "" {
+		return nil
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("metrics: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		metrics.write(w)
+	})
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Warn("Metrics endpoint stopped", "err", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	logger.Info("Serving metrics", "url", "http://"+ln.Addr().String()+"/metrics")
+	return nil
+}
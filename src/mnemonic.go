@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tyler-smith/go-bip39/wordlists"
+)
+
+const hardenedOffset = 0x80000000
+
+// deriveMnemonicKey derives the private key at path (e.g. m/44'/60'/0'/0/0)
+// from a BIP-39 mnemonic using BIP-32 derivation. The mnemonic's words and
+// checksum are validated first, so a typo fails instead of deriving an
+// unrelated account.
+func deriveMnemonicKey(mnemonic, passphrase, path string) (*ecdsa.PrivateKey, error) {
+	indexes, err := accounts.ParseDerivationPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid derivation path %q: %w", path, err)
+	}
+	words := strings.Fields(mnemonic)
+	if err := validateMnemonic(words); err != nil {
+		return nil, err
+	}
+	phrase := strings.Join(words, " ")
+	seed, err := pbkdf2.Key(sha512.New, phrase, []byte("mnemonic"+passphrase), 2048, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	key, chain := new(big.Int).SetBytes(sum[:32]), sum[32:]
+
+	n := crypto.S256().Params().N
+	for _, index := range indexes {
+		parent, err := toECDSA(key)
+		if err != nil {
+			return nil, err
+		}
+		var data []byte
+		if index >= hardenedOffset {
+			data = append([]byte{0}, crypto.FromECDSA(parent)...)
+		} else {
+			data = crypto.CompressPubkey(&parent.PublicKey)
+		}
+		data = binary.BigEndian.AppendUint32(data, index)
+
+		mac := hmac.New(sha512.New, chain)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+		tweak := new(big.Int).SetBytes(sum[:32])
+		if tweak.Cmp(n) >= 0 {
+			return nil, fmt.Errorf("invalid child key at index %d", index)
+		}
+		key = tweak.Add(tweak, key).Mod(tweak, n)
+		if key.Sign() == 0 {
+			return nil, fmt.Errorf("invalid child key at index %d", index)
+		}
+		chain = sum[32:]
+	}
+	return toECDSA(key)
+}
+
+// bip39Words maps each word of the BIP-39 English wordlist to its index.
+var bip39Words = sync.OnceValue(func() map[string]int {
+	m := make(map[string]int, len(wordlists.English))
+	for i, w := range wordlists.English {
+		m[w] = i
+	}
+	return m
+})
+
+// validateMnemonic checks that words is a BIP-39 English mnemonic: 12 to 24
+// words from the wordlist, whose last bits are the leading bits of the
+// SHA-256 of the entropy the rest encode.
+func validateMnemonic(words []string) error {
+	switch len(words) {
+	case 12, 15, 18, 21, 24:
+	default:
+		return fmt.Errorf("mnemonic has %d words, want 12, 15, 18, 21 or 24", len(words))
+	}
+	bits := new(big.Int)
+	for i, w := range words {
+		index, ok := bip39Words()[w]
+		if !ok {
+			return fmt.Errorf("mnemonic word %d, %q, is not in the BIP-39 English wordlist", i+1, w)
+		}
+		bits.Lsh(bits, 11).Or(bits, big.NewInt(int64(index)))
+	}
+	// Every 3 words carry 32 bits of entropy and 1 of checksum.
+	checksumBits := uint(len(words) / 3)
+	checksum := new(big.Int).And(bits, big.NewInt(1<<checksumBits-1))
+	entropy := new(big.Int).Rsh(bits, checksumBits).FillBytes(make([]byte, len(words)*4/3))
+	hash := sha256.Sum256(entropy)
+	if uint64(hash[0]>>(8-checksumBits)) != checksum.Uint64() {
+		return errors.New("mnemonic checksum does not match; check the words and their order")
+	}
+	return nil
+}
+
+// toECDSA returns k as a secp256k1 key. A master key derived from the seed
+// can, with negligible probability, fall outside [1, n).
+func toECDSA(k *big.Int) (*ecdsa.PrivateKey, error) {
+	key, err := crypto.ToECDSA(k.FillBytes(make([]byte, 32)))
+	if err != nil {
+		return nil, fmt.Errorf("derive key: %w", err)
+	}
+	return key, nil
+}
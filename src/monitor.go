@@ -0,0 +1,476 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// defaultMonitorEvents are the governance events monitor tails unless
+// -events says otherwise; each contract is watched for those its ABI has.
+const defaultMonitorEvents = "ProposalCreated,ProposalQueued,ProposalExecuted,ProposalCanceled,VoteCast,Voted,Executed"
+
+// monitorEvent is one stored event, with its arguments formatted as
+// strings so that dashboards need no ABI.
+type monitorEvent struct {
+	Contract string            `json:"contract"`
+	Address  common.Address    `json:"address"`
+	Event    string            `json:"event"`
+	Args     map[string]string `json:"args"`
+	Block    uint64            `json:"block"`
+	Time     time.Time         `json:"time"`
+	TxHash   common.Hash       `json:"txHash"`
+	LogIndex uint              `json:"logIndex"`
+}
+
+// monitorStore keeps a network's events in deployments/monitor/<network>/:
+// events.jsonl, appended to, and cursor.json, the next block to read.
+type monitorStore struct {
+	dir string
+
+	mu     sync.Mutex
+	events []monitorEvent
+	next   uint64
+}
+
+func monitorDir(root, network string) string {
+	return filepath.Join(root, "deployments", "monitor", network)
+}
+
+func openMonitorStore(dir string) (*monitorStore, error) {
+	s := &monitorStore{dir: dir}
+	f, err := os.Open(filepath.Join(dir, "events.jsonl"))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, 1<<24)
+		for line := 1; scanner.Scan(); line++ {
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+			var e monitorEvent
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				return nil, fmt.Errorf("%s line %d: %w", f.Name(), line, err)
+			}
+			s.events = append(s.events, e)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, "cursor.json"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		var cursor struct {
+			Next uint64 `json:"next"`
+		}
+		if err := json.Unmarshal(raw, &cursor); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", filepath.Join(dir, "cursor.json"), err)
+		}
+		s.next = cursor.Next
+	}
+	return s, nil
+}
+
+// add appends the events of a block range, then moves the cursor past it,
+// so a restart reads a range again rather than skipping it. Events already
+// stored are dropped.
+func (s *monitorStore) add(events []monitorEvent, next uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	var added []monitorEvent
+	for _, e := range events {
+		if s.has(e) {
+			continue
+		}
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(line, '\n'))
+		added = append(added, e)
+	}
+	if buf.Len() > 0 {
+		f, err := os.OpenFile(filepath.Join(s.dir, "events.jsonl"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(buf.Bytes()); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	s.events = append(s.events, added...)
+	cursor, err := json.Marshal(map[string]uint64{"next": next})
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(s.dir, "cursor.json.tmp")
+	if err := os.WriteFile(tmp, cursor, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, "cursor.json")); err != nil {
+		return err
+	}
+	s.next = next
+	return nil
+}
+
+// has reports whether e is stored. Events are stored in block order, so
+// only those from e's block on are compared.
+func (s *monitorStore) has(e monitorEvent) bool {
+	for i := len(s.events) - 1; i >= 0 && s.events[i].Block >= e.Block; i-- {
+		if s.events[i].TxHash == e.TxHash && s.events[i].LogIndex == e.LogIndex {
+			return true
+		}
+	}
+	return false
+}
+
+// query returns the stored events matching the filter, oldest first, at
+// most limit of the latest ones.
+func (s *monitorStore) query(contract, event string, from uint64, limit int) []monitorEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []monitorEvent{}
+	for _, e := range s.events {
+		if (contract == "" || e.Contract == contract) && (event == "" || e.Event == event) && e.Block >= from {
+			out = append(out, e)
+		}
+	}
+	if limit > 0 && len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	return out
+}
+
+// monitored is a registry contract and the events watched on it.
+type monitored struct {
+	name   string
+	events map[common.Hash]abi.Event
+}
+
+// monitor tails events across a network's registry contracts into a store.
+type monitor struct {
+	client        *ethclient.Client
+	network       string
+	store         *monitorStore
+	contracts     map[common.Address]monitored
+	confirmations uint64
+	startedAt     time.Time
+
+	mu   sync.Mutex
+	head uint64
+}
+
+// runMonitor tails governance events from every contract in the registry,
+// stores them and serves them over HTTP, until interrupted.
+func runMonitor(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("monitor", &rpcURL)
+	network := addRegistryFlag(fs)
+	eventList := fs.String("events", defaultMonitorEvents, "comma-separated events to store, or * for every event in the ABIs")
+	only := fs.String("contracts", "", "comma-separated registry names to watch (default: all)")
+	fromBlock := fs.Int64("from-block", -1, "block to start from (default: where the store left off, else the current head)")
+	confirmations := fs.Uint64("confirmations", 0, "only read blocks this many blocks behind the head, so reorged events are not stored")
+	addr := fs.String("addr", "127.0.0.1:8547", "serve the stored events over HTTP on this address; empty disables the API")
+	dir := fs.String("store", "", "directory for the event store (default deployments/monitor/<network>)")
+	metricsAddr := fs.String("metrics-addr", "", "serve Prometheus metrics on this address, e.g. :9090, at /metrics while monitoring")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	reg, err := loadRegistry(root, *network)
+	if err != nil {
+		return err
+	}
+	contracts, err := monitoredContracts(reg, splitList(*only), splitList(*eventList))
+	if err != nil {
+		return err
+	}
+	if *dir == "" {
+		*dir = monitorDir(root, *network)
+	}
+	store, err := openMonitorStore(*dir)
+	if err != nil {
+		return err
+	}
+	if err := serveMetrics(ctx, *metricsAddr); err != nil {
+		return err
+	}
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	mon := &monitor{client: client, network: *network, store: store, contracts: contracts, confirmations: *confirmations, startedAt: time.Now().UTC()}
+	next := store.next
+	switch {
+	case *fromBlock >= 0:
+		next = uint64(*fromBlock)
+	case next == 0:
+		head, err := client.BlockNumber(ctx)
+		if err != nil {
+			return err
+		}
+		next = head + 1
+	}
+	if err := mon.serve(ctx, *addr); err != nil {
+		return err
+	}
+	for a, c := range contracts {
+		names := make([]string, 0, len(c.events))
+		for _, ev := range c.events {
+			names = append(names, ev.Name)
+		}
+		logger.Info("Monitoring", "contract", c.name, "address", a, "events", strings.Join(sorted(names), ","))
+	}
+	logger.Info("Tailing events (Ctrl-C to stop)", "network", *network, "from", next, "store", *dir, "stored", len(store.events))
+	err = mon.run(ctx, next)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// monitoredContracts picks the registry contracts to watch and the events
+// of each: those named in events, or all of them for *. A contract with
+// none of the events is left out.
+func monitoredContracts(reg *registry, only, events []string) (map[common.Address]monitored, error) {
+	all := len(events) == 1 && events[0] == "*"
+	names := reg.names()
+	if len(only) > 0 {
+		for _, name := range only {
+			if _, err := reg.lookup(name); err != nil {
+				return nil, err
+			}
+		}
+		names = only
+	}
+	out := map[common.Address]monitored{}
+	for _, name := range names {
+		e := reg.Contracts[name]
+		if len(e.ABI) == 0 {
+			continue
+		}
+		parsed, err := abi.JSON(bytes.NewReader(e.ABI))
+		if err != nil {
+			return nil, fmt.Errorf("%s: parse recorded ABI: %w", name, err)
+		}
+		m := monitored{name: name, events: map[common.Hash]abi.Event{}}
+		for _, ev := range parsed.Events {
+			if all || slices.Contains(events, ev.Name) {
+				m.events[ev.ID] = ev
+			}
+		}
+		if len(m.events) > 0 {
+			// Two names may record one address; the first keeps it.
+			if _, dup := out[e.Address]; !dup {
+				out[e.Address] = m
+			}
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no contract in the %s registry emits any of %s", reg.Network, strings.Join(events, ", "))
+	}
+	return out, nil
+}
+
+// run reads the watched events in each new block range, storing them and
+// the cursor after each, until ctx is done.
+func (m *monitor) run(ctx context.Context, next uint64) error {
+	q := ethereum.FilterQuery{Topics: [][]common.Hash{nil}}
+	topics := map[common.Hash]bool{}
+	for a, c := range m.contracts {
+		q.Addresses = append(q.Addresses, a)
+		for id := range c.events {
+			if !topics[id] {
+				topics[id] = true
+				q.Topics[0] = append(q.Topics[0], id)
+			}
+		}
+	}
+	for {
+		head, err := m.client.BlockNumber(ctx)
+		if err != nil {
+			logger.Warn("Could not read the head block", "err", err)
+		} else {
+			m.mu.Lock()
+			m.head = head
+			m.mu.Unlock()
+			if head >= m.confirmations {
+				if safe := head - m.confirmations; safe >= next {
+					if next, err = m.readRange(ctx, q, next, safe); err != nil {
+						logger.Warn("Could not read events", "from", next, "to", safe, "err", err)
+					}
+				}
+			}
+		}
+		if err := sleepCtx(ctx, logPollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// readRange stores the events in blocks [from, to], in chunks of at most
+// maxLogRange blocks, and returns the next block to read.
+func (m *monitor) readRange(ctx context.Context, q ethereum.FilterQuery, from, to uint64) (uint64, error) {
+	times := map[uint64]time.Time{}
+	for start := from; start <= to; start += maxLogRange {
+		end := min(start+maxLogRange-1, to)
+		q.FromBlock, q.ToBlock = new(big.Int).SetUint64(start), new(big.Int).SetUint64(end)
+		logs, err := m.client.FilterLogs(ctx, q)
+		if err != nil {
+			return start, fmt.Errorf("get logs %d-%d: %w", start, end, err)
+		}
+		var events []monitorEvent
+		for _, l := range logs {
+			c, ok := m.contracts[l.Address]
+			if !ok || len(l.Topics) == 0 || l.Removed {
+				continue
+			}
+			ev, ok := c.events[l.Topics[0]]
+			if !ok {
+				continue
+			}
+			decoded, err := decodeLog(ev, l)
+			if err != nil {
+				logger.Warn("Could not decode event", "contract", c.name, "tx", l.TxHash, "err", err)
+				continue
+			}
+			if _, ok := times[l.BlockNumber]; !ok {
+				if h, err := m.client.HeaderByNumber(ctx, new(big.Int).SetUint64(l.BlockNumber)); err == nil {
+					times[l.BlockNumber] = time.Unix(int64(h.Time), 0).UTC()
+				}
+			}
+			e := monitorEvent{Contract: c.name, Address: l.Address, Event: ev.Name, Args: map[string]string{}, Block: l.BlockNumber, Time: times[l.BlockNumber], TxHash: l.TxHash, LogIndex: l.Index}
+			fields := make([]string, 0, len(ev.Inputs))
+			for _, in := range ev.Inputs {
+				e.Args[in.Name] = formatValue(decoded.Args[in.Name])
+				fields = append(fields, in.Name+"="+e.Args[in.Name])
+			}
+			logger.Info(c.name+" "+ev.Name, "block", l.BlockNumber, "tx", l.TxHash, "args", strings.Join(fields, " "))
+			metrics.add(metricEvents, 1, "event", ev.Name)
+			metrics.set(metricLastBlock, float64(l.BlockNumber), "event", ev.Name)
+			events = append(events, e)
+		}
+		if err := m.store.add(events, end+1); err != nil {
+			return start, fmt.Errorf("store events: %w", err)
+		}
+	}
+	return to + 1, nil
+}
+
+// serve exposes the store on addr until ctx is done:
+//
+//	GET /events?contract=Gov&event=VoteCast&from=100&limit=50
+//	GET /status
+//
+// An empty addr does nothing. Like serveMetrics, the listener is opened
+// before returning so a taken port fails up front.
+func (m *monitor) serve(ctx context.Context, addr string) error {
+	if addr == "" {
+		return nil
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("monitor API: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var from uint64
+		limit := 1000
+		var err error
+		if s := q.Get("from"); s != "" {
+			if from, err = strconv.ParseUint(s, 10, 64); err != nil {
+				http.Error(w, "from: not a block number", http.StatusBadRequest)
+				return
+			}
+		}
+		if s := q.Get("limit"); s != "" {
+			if limit, err = strconv.Atoi(s); err != nil || limit < 0 {
+				http.Error(w, "limit: not a count", http.StatusBadRequest)
+				return
+			}
+		}
+		writeAPIJSON(w, http.StatusOK, m.store.query(q.Get("contract"), q.Get("event"), from, limit))
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, _ *http.Request) {
+		m.mu.Lock()
+		head := m.head
+		m.mu.Unlock()
+		m.store.mu.Lock()
+		next, stored := m.store.next, len(m.store.events)
+		m.store.mu.Unlock()
+		contracts := map[string][]string{}
+		for _, c := range m.contracts {
+			for _, ev := range c.events {
+				contracts[c.name] = append(contracts[c.name], ev.Name)
+			}
+			contracts[c.name] = sorted(contracts[c.name])
+		}
+		writeAPIJSON(w, http.StatusOK, map[string]interface{}{
+			"network":   m.network,
+			"head":      head,
+			"nextBlock": next,
+			"events":    stored,
+			"contracts": contracts,
+			"startedAt": m.startedAt,
+		})
+	})
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Warn("Monitor API stopped", "err", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	logger.Info("Serving events", "url", "http://"+ln.Addr().String()+"/events")
+	return nil
+}
+
+func sorted(s []string) []string {
+	slices.Sort(s)
+	return s
+}
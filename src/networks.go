@@ -0,0 +1,156 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"time"
+)
+
+// networkConfig describes one chain a manifest deploys to. RPC URLs may
+// reference environment variables, e.g. ${SEPOLIA_RPC_URL}, so keys in
+// provider URLs stay out of the manifest.
+type networkConfig struct {
+	RPC string `yaml:"rpc"`
+	// Fallbacks are further HTTP endpoints for the same chain, tried in
+	// order when RPC is unhealthy or keeps failing.
+	Fallbacks []string `yaml:"fallbacks"`
+	// RPCTimeout bounds each request, retries included (default 30s).
+	RPCTimeout time.Duration `yaml:"rpcTimeout"`
+	// RPCRateLimit caps HTTP requests per second, to stay under a public
+	// endpoint's quota; -rpc-rps overrides it.
+	RPCRateLimit float64 `yaml:"rpcRateLimit"`
+	// RPCMaxInFlight caps the requests outstanding to each endpoint at
+	// once (default 16); -rpc-max-inflight overrides it.
+	RPCMaxInFlight int `yaml:"rpcMaxInFlight"`
+	// RPCHeaders are HTTP headers for authenticated providers, by endpoint
+	// host, or "*" for all of the network's endpoints:
+	//
+	//	rpcHeaders:
+	//	  eth-mainnet.g.alchemy.com:
+	//	    Authorization: Bearer ${secret:env:ALCHEMY_TOKEN}
+	RPCHeaders map[string]map[string]string `yaml:"rpcHeaders"`
+	// ChainID defaults to the well-known id for the network name.
+	ChainID uint64 `yaml:"chainId"`
+	// Chain is how contracts are deployed: evm (default), or zksync for
+	// zkSync Era's ContractDeployer and EraVM artifacts in zkout/.
+	Chain string `yaml:"chain"`
+	// Rollup is how L1 data fees are priced: op (GasPriceOracle),
+	// arbitrum (ArbGasInfo) or none; it defaults from the chain id.
+	Rollup string `yaml:"rollup"`
+	// BlobProofs is what blob transactions prove their blobs with: cell
+	// proofs (default, since Fusaka) or blob for chains before it.
+	BlobProofs string `yaml:"blobProofs"`
+	// Create2Factory overrides the factory used for salted deployments.
+	Create2Factory string `yaml:"create2Factory"`
+	// Multicall3 overrides the Multicall3 address used by batch: multicall3.
+	Multicall3 string `yaml:"multicall3"`
+	// ENSRegistry overrides the ENS registry that names in arguments are
+	// resolved through.
+	ENSRegistry string `yaml:"ensRegistry"`
+	// Explorer, when set, verifies every deployed contract's source.
+	Explorer *explorerConfig `yaml:"explorer"`
+	// ExplorerURL is the block explorer that transactions and addresses
+	// are linked to, for chains without a canonical one in chainMetadata.
+	ExplorerURL string `yaml:"explorerURL"`
+	// Libraries pins already deployed libraries, by name or path:Name,
+	// instead of deploying them.
+	Libraries map[string]string `yaml:"libraries"`
+	// Safe, when set, proposes transactions to a Safe multisig instead of
+	// sending them from the signer.
+	Safe *safeConfig `yaml:"safe"`
+	// UserOp, when set, sends transactions as ERC-4337 user operations
+	// from a smart account, through a bundler.
+	UserOp *userOpConfig `yaml:"userOp"`
+	// Relay, when set, has a relay service send the calls to contracts, so
+	// the signer needs no gas for them.
+	Relay *relayConfig `yaml:"relay"`
+	// ReserveNonces checks the signer's pending nonce on chain before each
+	// transaction and stops the run if something else has used the nonce
+	// it was about to send with, as a second run with the same key from
+	// another machine would.
+	ReserveNonces bool `yaml:"reserveNonces"`
+	// Anvil starts a local node for the run instead of connecting to RPC.
+	Anvil *anvilConfig `yaml:"anvil"`
+	// Faucet funds the signer on test networks with -fund.
+	Faucet *faucetConfig `yaml:"faucet"`
+	// Tenderly, when set, simulates each transaction before sending it.
+	Tenderly *tenderlyConfig `yaml:"tenderly"`
+	// Confirm shows each transaction and asks for the network name to be
+	// typed before broadcasting it, e.g. for mainnet; -yes skips this.
+	Confirm bool `yaml:"confirm"`
+}
+
+// knownChainIDs maps common network names to their chain ids.
+var knownChainIDs = map[string]uint64{
+	"mainnet":          1,
+	"sepolia":          11155111,
+	"holesky":          17000,
+	"optimism":         10,
+	"base":             8453,
+	"base-sepolia":     84532,
+	"arbitrum":         42161,
+	"arbitrum-sepolia": 421614,
+	"polygon":          137,
+	"zksync":           324,
+	"zksync-sepolia":   300,
+	"anvil":            31337,
+}
+
+// rpcOptions returns the connection settings for the network's endpoints,
+// with the -rpc-rps, -rpc-max-inflight and -rpc-header flags applied over
+// its own.
+func (n networkConfig) rpcOptions() rpcOptions {
+	opts := rpcOptions{timeout: n.RPCTimeout, rps: n.RPCRateLimit, headers: map[string]http.Header{}, maxInFlight: n.RPCMaxInFlight}
+	if rpcRateLimit > 0 {
+		opts.rps = rpcRateLimit
+	}
+	if rpcMaxInFlight > 0 {
+		opts.maxInFlight = rpcMaxInFlight
+	}
+	for host, headers := range n.RPCHeaders {
+		h := http.Header{}
+		for k, v := range headers {
+			h.Set(k, os.ExpandEnv(v))
+		}
+		opts.headers[host] = h
+	}
+	if len(rpcHeaders) > 0 {
+		all := opts.headers[allHosts].Clone()
+		if all == nil {
+			all = http.Header{}
+		}
+		for k, v := range rpcHeaders {
+			all[k] = v
+		}
+		opts.headers[allHosts] = all
+	}
+	return opts
+}
+
+// rpcURLs returns the endpoint and its fallbacks with environment
+// variables expanded. RPC itself may also be a comma-separated list.
+func (n networkConfig) rpcURLs() []string {
+	urls := splitList(os.ExpandEnv(n.RPC))
+	for _, f := range n.Fallbacks {
+		urls = append(urls, splitList(os.ExpandEnv(f))...)
+	}
+	return urls
+}
+
+// chainID returns the configured chain id, falling back to the well-known
+// id for name. Zero means unknown.
+func (n networkConfig) chainID(name string) uint64 {
+	if n.ChainID != 0 {
+		return n.ChainID
+	}
+	return knownChainIDs[name]
+}
+
+// chainKind returns the network's chain:, defaulting to zksync for the
+// zkSync Era chain ids and otherwise "" for an EVM chain.
+func (n networkConfig) chainKind(name string) string {
+	if n.Chain == "" && zksyncChainIDs[n.chainID(name)] {
+		return chainZKsync
+	}
+	return n.Chain
+}
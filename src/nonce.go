@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// stuckAfter is how long a transaction may stay unmined before it is
+// checked for being underpriced or dropped.
+const stuckAfter = time.Minute
+
+// initNonce sets the run's starting nonce: the explicit -nonce if given,
+// else the sender's pending nonce. Transactions already waiting in the
+// mempool are reported, since a stuck one blocks everything after it.
+func (r *networkRun) initNonce(ctx context.Context) error {
+	from := r.sender.Address()
+	pending, err := r.client.PendingNonceAt(ctx, from)
+	if err != nil {
+		return err
+	}
+	latest, err := r.client.NonceAt(ctx, from, nil)
+	if err != nil {
+		return err
+	}
+	if pending > latest {
+		logger.Warn("Sender has pending transactions; replace a stuck one with `bump`", "address", from, "pending", pending-latest, "nonces", fmt.Sprintf("%d-%d", latest, pending-1))
+	}
+	r.nonce = pending
+	if n := r.opts.Nonce; n != nil {
+		if *n < latest {
+			return fmt.Errorf("nonce %d is already used; %s's next nonce is %d", *n, from.Hex(), latest)
+		}
+		r.nonce = *n
+	}
+	return nil
+}
+
+// checkNonceReserved fails if the node's pending nonce for the sender is
+// past the one the run is about to use: another process sent with the
+// same key since the run started, and the two would replace each other's
+// transactions. A node that has not seen the run's own last transaction
+// yet reports a lower nonce, which is fine.
+func (r *networkRun) checkNonceReserved(ctx context.Context) error {
+	return r.checkNonceFree(ctx, r.sender.Address(), r.nonce)
+}
+
+// checkNonceFree is checkNonceReserved for any account the run sends from.
+func (r *networkRun) checkNonceFree(ctx context.Context, from common.Address, nonce uint64) error {
+	pending, err := r.client.PendingNonceAt(ctx, from)
+	if err != nil {
+		return fmt.Errorf("check nonce: %w", err)
+	}
+	if pending > nonce {
+		return fmt.Errorf("nonce %d of %s was used by another sender since the run started (the node's next nonce is %d); is another run using this key? Stopping so they do not replace each other's transactions", nonce, from.Hex(), pending)
+	}
+	return nil
+}
+
+// checkStuck explains why hash has not been mined: dropped from the
+// mempool, or priced below the current base fee.
+func (r *networkRun) checkStuck(ctx context.Context, hash common.Hash) error {
+	tx, pending, err := r.client.TransactionByHash(ctx, hash)
+	if errors.Is(err, ethereum.NotFound) {
+		return fmt.Errorf("transaction %s was dropped from the mempool; send it again, or `bump` its nonce", hash.Hex())
+	}
+	if err != nil || !pending {
+		return err
+	}
+	head, err := r.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if head.BaseFee != nil && tx.GasFeeCap().Cmp(head.BaseFee) < 0 {
+		logger.Warn("Transaction looks stuck: its max fee is below the base fee; replace it with `bump -tx`", "tx", hash, "maxFee", tx.GasFeeCap(), "baseFee", head.BaseFee)
+	} else {
+		logger.Warn("Transaction is still pending; replace it with a higher fee using `bump -tx`", "tx", hash, "nonce", tx.Nonce(), "after", stuckAfter)
+	}
+	return nil
+}
+
+// replacementBump is the minimum fee increase, in percent, that nodes
+// accept for a transaction replacing another one with the same nonce.
+const replacementBump = 10
+
+// bumpFees returns fees for replacing a transaction priced at old: the
+// current quote, but at least old plus percent on every component.
+func bumpFees(old, quote fees, percent uint64) fees {
+	raise := func(v, floor *big.Int) *big.Int {
+		if v == nil {
+			return floor
+		}
+		bumped := new(big.Int).Mul(v, new(big.Int).SetUint64(100+percent))
+		bumped.Div(bumped, big.NewInt(100))
+		bumped.Add(bumped, big.NewInt(1))
+		if floor != nil && floor.Cmp(bumped) > 0 {
+			return floor
+		}
+		return bumped
+	}
+	if !quote.dynamic() {
+		price := old.GasPrice
+		if old.dynamic() {
+			price = old.FeeCap
+		}
+		return fees{GasPrice: raise(price, quote.GasPrice)}
+	}
+	if !old.dynamic() {
+		// Nodes compare a legacy price against both caps.
+		old = fees{TipCap: old.GasPrice, FeeCap: old.GasPrice}
+	}
+	return fees{TipCap: raise(old.TipCap, quote.TipCap), FeeCap: raise(old.FeeCap, quote.FeeCap)}
+}
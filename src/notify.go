@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// notifyConfig posts deployment events to a webhook:
+//
+//	notify:
+//	  - url: ${secret:env:SLACK_WEBHOOK_URL}
+//	    format: slack
+//	    events: [succeeded, failed]
+//	    networks: [mainnet]
+//
+// Dry runs send nothing.
+type notifyConfig struct {
+	URL string `yaml:"url"`
+	// Format is slack, discord or json (default): json posts the event
+	// itself for other tooling.
+	Format string `yaml:"format"`
+	// Events defaults to all of started, succeeded, failed and executed.
+	Events []string `yaml:"events"`
+	// Networks defaults to every network.
+	Networks []string `yaml:"networks"`
+}
+
+const (
+	notifySlack   = "slack"
+	notifyDiscord = "discord"
+	notifyJSON    = "json"
+
+	eventStarted   = "started"
+	eventSucceeded = "succeeded"
+	eventFailed    = "failed"
+	// eventExecuted is a timelock operation executed by execute -daemon,
+	// which reports failing ones as failed.
+	eventExecuted = "executed"
+
+	notifyTimeout = 10 * time.Second
+)
+
+func (c *notifyConfig) validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	switch c.Format {
+	case "", notifySlack, notifyDiscord, notifyJSON:
+	default:
+		return fmt.Errorf("unknown format %q (want slack, discord or json)", c.Format)
+	}
+	for _, e := range c.Events {
+		switch e {
+		case eventStarted, eventSucceeded, eventFailed, eventExecuted:
+		default:
+			return fmt.Errorf("unknown event %q (want started, succeeded, failed or executed)", e)
+		}
+	}
+	return nil
+}
+
+func (c *notifyConfig) wants(event, network string) bool {
+	return (len(c.Events) == 0 || slices.Contains(c.Events, event)) &&
+		(len(c.Networks) == 0 || slices.Contains(c.Networks, network))
+}
+
+// deployEvent is what a webhook is told about one network's run.
+type deployEvent struct {
+	Event       string           `json:"event"`
+	Network     string           `json:"network"`
+	ChainID     uint64           `json:"chainId,omitempty"`
+	Contracts   []string         `json:"contracts,omitempty"`
+	Deployments []deployedNotice `json:"deployments,omitempty"`
+	Cost        string           `json:"cost,omitempty"`
+	Elapsed     string           `json:"elapsed,omitempty"`
+	Error       string           `json:"error,omitempty"`
+	// Operation is set for timelock executions.
+	Operation *operationNotice `json:"operation,omitempty"`
+}
+
+type deployedNotice struct {
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	Tx       string `json:"tx,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Existing bool   `json:"existing,omitempty"`
+}
+
+type operationNotice struct {
+	ID       string `json:"id"`
+	Timelock string `json:"timelock"`
+	Target   string `json:"target"`
+	Call     string `json:"call"`
+	Tx       string `json:"tx,omitempty"`
+	URL      string `json:"url,omitempty"`
+}
+
+func startedEvent(m *manifest, network string) deployEvent {
+	e := deployEvent{Event: eventStarted, Network: network, ChainID: m.Networks[network].chainID(network)}
+	for _, c := range m.Contracts {
+		e.Contracts = append(e.Contracts, c.Name)
+	}
+	return e
+}
+
+func finishedEvent(m *manifest, r networkResult) deployEvent {
+	e := deployEvent{Event: eventSucceeded, Network: r.Network, ChainID: m.Networks[r.Network].chainID(r.Network), Elapsed: r.Elapsed.Round(time.Millisecond).String()}
+	if r.Err != nil {
+		e.Event, e.Error = eventFailed, r.Err.Error()
+	}
+	site := m.Networks[r.Network].explorerSite(e.ChainID)
+	total := new(big.Int)
+	for _, d := range r.Deployments {
+		n := deployedNotice{Name: d.Name, Address: d.Address.Hex(), Existing: d.Skipped}
+		if !d.Skipped {
+			n.Tx = d.TxHash.Hex()
+		}
+		n.URL = site.address(d.Address)
+		e.Deployments = append(e.Deployments, n)
+		total.Add(total, deploymentCost(d, false))
+	}
+	if total.Sign() > 0 {
+		e.Cost = formatEther(total)
+	}
+	return e
+}
+
+// text renders e as a chat message. Slack and Discord both turn bare URLs
+// into links.
+func (e deployEvent) text() string {
+	var b strings.Builder
+	where := e.Network
+	if e.ChainID != 0 {
+		where = fmt.Sprintf("%s (chain %d)", e.Network, e.ChainID)
+	}
+	if op := e.Operation; op != nil {
+		if e.Event == eventExecuted {
+			link := op.Tx
+			if op.URL != "" {
+				link = op.URL
+			}
+			fmt.Fprintf(&b, "Timelock operation executed on %s: %s on %s\n• %s", where, op.Call, op.Target, link)
+		} else {
+			fmt.Fprintf(&b, "Timelock operation FAILED on %s: %s on %s: %s", where, op.Call, op.Target, e.Error)
+		}
+		fmt.Fprintf(&b, "\nOperation %s through %s", op.ID, op.Timelock)
+		return b.String()
+	}
+	switch e.Event {
+	case eventStarted:
+		fmt.Fprintf(&b, "Deployment started on %s: %s", where, strings.Join(e.Contracts, ", "))
+		return b.String()
+	case eventSucceeded:
+		fmt.Fprintf(&b, "Deployment succeeded on %s in %s", where, e.Elapsed)
+	default:
+		fmt.Fprintf(&b, "Deployment FAILED on %s after %s: %s", where, e.Elapsed, e.Error)
+	}
+	for _, d := range e.Deployments {
+		link := d.Address
+		if d.URL != "" {
+			link = d.URL
+		}
+		existing := ""
+		if d.Existing {
+			existing = " (already deployed)"
+		}
+		fmt.Fprintf(&b, "\n• %s %s%s", d.Name, link, existing)
+	}
+	if e.Cost != "" {
+		fmt.Fprintf(&b, "\nGas cost: %s", e.Cost)
+	}
+	return b.String()
+}
+
+// notify posts e to every webhook that wants it. Failing to notify is
+// logged and does not fail the run.
+func notify(ctx context.Context, hooks []notifyConfig, e deployEvent) {
+	for _, h := range hooks {
+		if !h.wants(e.Event, e.Network) {
+			continue
+		}
+		if err := h.post(ctx, e); err != nil {
+			logger.Warn("Could not send notification", "event", e.Event, "network", e.Network, "format", h.Format, "err", err)
+		}
+	}
+}
+
+func (c *notifyConfig) post(ctx context.Context, e deployEvent) error {
+	var payload interface{} = e
+	switch c.Format {
+	case notifySlack:
+		payload = map[string]string{"text": e.text()}
+	case notifyDiscord:
+		payload = map[string]string{"content": e.text()}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, os.ExpandEnv(c.URL), bytes.NewReader(body))
+	if err != nil {
+		return errors.New("invalid webhook url")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// The URL is the webhook's secret; keep it out of the log.
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			err = ue.Err
+		}
+		return fmt.Errorf("post to %s: %w", redactURL(req.URL.String()), err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s answered %s", redactURL(req.URL.String()), resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// immutableReferences is solc's map of immutables in runtime code: AST id
+// -> byte ranges the constructor writes the value to.
+type immutableReferences map[string][]struct {
+	Start  int `json:"start"`
+	Length int `json:"length"`
+}
+
+// diffContext is how many bytes around the first difference are shown.
+const diffContext = 16
+
+// runVerifyOnchain compares the runtime code at a registry address with the
+// local build of the contract. Immutables, which only the constructor
+// fills in, are taken from the chain, and the CBOR metadata trailer is
+// compared separately: a build that differs only there has the same code
+// but was compiled from sources that differ in comments, whitespace or paths.
+func runVerifyOnchain(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("verify-onchain", &rpcURL)
+	network := addRegistryFlag(fs)
+	contractRef := fs.String("contract", "", "compare with this artifact (File.sol or File.sol:Name) instead of the recorded one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: verify-onchain [-network name] [-contract File.sol:Name] <deployment name>")
+	}
+	name := fs.Arg(0)
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	reg, err := loadRegistry(root, *network)
+	if err != nil {
+		return err
+	}
+	e, err := reg.lookup(name)
+	if err != nil {
+		return err
+	}
+	ref := *contractRef
+	if ref == "" {
+		if e.Source == "" {
+			return fmt.Errorf("%s has no recorded source; pass -contract", name)
+		}
+		ref = e.Source + ":" + e.Contract
+	}
+	art, err := loadArtifact(root, ref)
+	if err != nil {
+		return err
+	}
+	if len(art.DeployedLinkReferences) > 0 {
+		if err := art.link(e.Libraries); err != nil {
+			return err
+		}
+	}
+
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	addr := e.Address
+	if e.Proxy != nil {
+		// The proxy's own code is not the contract's; compare the
+		// implementation behind it.
+		addr = e.Proxy.Implementation
+	}
+	onChain, err := client.CodeAt(ctx, addr, nil)
+	if err != nil {
+		return err
+	}
+	if len(onChain) == 0 {
+		return fmt.Errorf("no contract code at %s", addr.Hex())
+	}
+
+	fmt.Printf("%s at %s: %d bytes on chain, %d built from %s\n", name, addr.Hex(), len(onChain), len(art.DeployedBytecode), ref)
+	immutables, err := art.decodeImmutables(onChain)
+	if err != nil {
+		return err
+	}
+	for _, v := range immutables {
+		fmt.Printf("  %s: %s\n", v.Name, v.Value)
+	}
+	masked := onChain
+	if len(immutables) > 0 {
+		masked = art.ImmutableReferences.zeroed(onChain)
+	}
+
+	code, meta := splitMetadata(masked)
+	builtCode, builtMeta := splitMetadata(art.DeployedBytecode)
+	switch {
+	case bytes.Equal(masked, art.DeployedBytecode):
+		fmt.Println("match")
+		return nil
+	case bytes.Equal(code, builtCode):
+		fmt.Printf("match except the metadata hash: the code is the same, but the sources or their paths differ from the deployed ones\n  on chain: %x\n  built:    %x\n", meta, builtMeta)
+		return nil
+	}
+	fmt.Print(codeDiff(code, builtCode))
+	return fmt.Errorf("%s: runtime code on chain differs from the local build", name)
+}
+
+// zeroed returns a copy of code with the immutables zeroed, as solc leaves
+// them in the runtime code it outputs.
+func (refs immutableReferences) zeroed(code []byte) []byte {
+	code = append([]byte{}, code...)
+	for _, ranges := range refs {
+		for _, r := range ranges {
+			clear(code[r.Start : r.Start+r.Length])
+		}
+	}
+	return code
+}
+
+// splitMetadata separates solc's CBOR metadata trailer from runtime code.
+// The last two bytes give the trailer's length; code without a plausible
+// trailer is returned whole.
+func splitMetadata(code []byte) (body, trailer []byte) {
+	if len(code) < 2 {
+		return code, nil
+	}
+	n := int(code[len(code)-2])<<8 | int(code[len(code)-1])
+	if n == 0 || n+2 > len(code) {
+		return code, nil
+	}
+	start := len(code) - n - 2
+	// A CBOR map of one to fifteen entries.
+	if code[start]&0xf0 != 0xa0 {
+		return code, nil
+	}
+	return code[:start], code[start:]
+}
+
+// codeDiff describes where two codes first differ, with the bytes around
+// it.
+func codeDiff(onChain, built []byte) string {
+	i := 0
+	for i < len(onChain) && i < len(built) && onChain[i] == built[i] {
+		i++
+	}
+	from := max(i-diffContext, 0)
+	window := func(code []byte) string {
+		if from >= len(code) {
+			return "(end of code)"
+		}
+		return fmt.Sprintf("%x", code[from:min(i+diffContext, len(code))])
+	}
+	msg := fmt.Sprintf("mismatch: first difference at byte %d (excluding metadata: %d bytes on chain, %d built)\n", i, len(onChain), len(built))
+	msg += fmt.Sprintf("  bytes %d-:\n  on chain: %s\n  built:    %s\n", from, window(onChain), window(built))
+	return msg
+}
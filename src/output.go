@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// deployReport is the -output json document for deploy.
+type deployReport struct {
+	DryRun   bool            `json:"dryRun"`
+	Networks []networkReport `json:"networks"`
+	// Cost is set when the run was priced in fiat.
+	Cost *costReport `json:"cost,omitempty"`
+}
+
+type networkReport struct {
+	Network        string             `json:"network"`
+	ChainID        uint64             `json:"chainId,omitempty"`
+	Deployments    []deploymentReport `json:"deployments"`
+	ElapsedSeconds float64            `json:"elapsedSeconds"`
+	Error          string             `json:"error,omitempty"`
+	// ErrorKind is rpc, compile, encoding or revert, when the error is one
+	// of those; RevertData is the raw data of a revert.
+	ErrorKind  string        `json:"errorKind,omitempty"`
+	RevertData hexutil.Bytes `json:"revertData,omitempty"`
+}
+
+type deploymentReport struct {
+	Name     string         `json:"name"`
+	Contract string         `json:"contract"`
+	Address  common.Address `json:"address"`
+	Deployer common.Address `json:"deployer"`
+	TxHash   *common.Hash   `json:"txHash,omitempty"`
+	// AddressURL and TxURL link the contract and its deployment on the
+	// network's block explorer.
+	AddressURL string `json:"addressUrl,omitempty"`
+	TxURL      string `json:"txUrl,omitempty"`
+	// Skipped marks contracts that were already deployed.
+	Skipped     bool         `json:"skipped,omitempty"`
+	BlockNumber uint64       `json:"blockNumber,omitempty"`
+	Gas         uint64       `json:"gas"`
+	GasUsed     uint64       `json:"gasUsed,omitempty"`
+	MaxCostWei  string       `json:"maxCostWei,omitempty"`
+	Salt        *common.Hash `json:"salt,omitempty"`
+	// Implementation is set for proxies.
+	Implementation *common.Address `json:"implementation,omitempty"`
+	// Verified is set once the explorer accepted the source.
+	Verified bool `json:"verified,omitempty"`
+}
+
+func newDeployReport(m *manifest, results []networkResult, opts deployOptions) deployReport {
+	report := deployReport{DryRun: opts.DryRun, Networks: []networkReport{}}
+	for _, r := range results {
+		nr := networkReport{
+			Network:        r.Network,
+			ChainID:        m.Networks[r.Network].chainID(r.Network),
+			Deployments:    []deploymentReport{},
+			ElapsedSeconds: r.Elapsed.Seconds(),
+		}
+		if r.Err != nil {
+			nr.Error, nr.ErrorKind, nr.RevertData = r.Err.Error(), errorKind(r.Err), revertDataOf(r.Err)
+		}
+		site := m.Networks[r.Network].explorerSite(nr.ChainID)
+		for _, d := range r.Deployments {
+			dr := deploymentReport{
+				Name:        d.Name,
+				Contract:    d.Contract,
+				Address:     d.Address,
+				Deployer:    d.Deployer,
+				Skipped:     d.Skipped,
+				BlockNumber: d.BlockNumber,
+				Gas:         d.Gas,
+				GasUsed:     d.GasUsed,
+				Salt:        d.Salt,
+				Verified:    d.Verified,
+			}
+			if d.TxHash != (common.Hash{}) {
+				dr.TxHash = &d.TxHash
+			}
+			if !opts.DryRun {
+				dr.AddressURL, dr.TxURL = site.address(d.Address), site.tx(d.TxHash)
+			}
+			if opts.DryRun {
+				dr.MaxCostWei = d.Fees.maxCost(d.Gas).String()
+			}
+			if d.Proxy != nil {
+				dr.Implementation = &d.Proxy.Implementation
+			}
+			nr.Deployments = append(nr.Deployments, dr)
+		}
+		report.Networks = append(report.Networks, nr)
+	}
+	return report
+}
+
+// txReport is the -output json document for commands that send a single
+// transaction.
+type txReport struct {
+	Network string         `json:"network"`
+	DryRun  bool           `json:"dryRun"`
+	To      common.Address `json:"to"`
+	Method  string         `json:"method,omitempty"`
+	TxHash  *common.Hash   `json:"txHash,omitempty"`
+	// TxURL and ToURL link the transaction and the contract it called on
+	// the network's block explorer.
+	TxURL       string `json:"txUrl,omitempty"`
+	ToURL       string `json:"toUrl,omitempty"`
+	BlockNumber uint64 `json:"blockNumber,omitempty"`
+	Gas         uint64 `json:"gas"`
+	GasUsed     uint64 `json:"gasUsed,omitempty"`
+	// Implementation is the new implementation, for upgrades.
+	Implementation *common.Address `json:"implementation,omitempty"`
+}
+
+func newTxReport(r *networkRun, to common.Address, method string, sent *sentTx, dryRun bool) txReport {
+	report := txReport{Network: r.name, DryRun: dryRun, To: to, Method: method}
+	if !dryRun {
+		report.ToURL = r.site.address(to)
+	}
+	if sent == nil {
+		return report
+	}
+	report.Gas = sent.Gas
+	if sent.Hash != (common.Hash{}) {
+		report.TxHash, report.TxURL = &sent.Hash, r.site.tx(sent.Hash)
+	}
+	if sent.Receipt != nil {
+		report.BlockNumber, report.GasUsed = sent.Receipt.BlockNumber.Uint64(), sent.Receipt.GasUsed
+	}
+	return report
+}
+
+// printSent prints a sent transaction: its hash and explorer link, and
+// the block it was mined in once it has a receipt.
+func (r *networkRun) printSent(sent *sentTx) {
+	fmt.Println("tx:", sent.Hash.Hex())
+	if url := r.site.tx(sent.Hash); url != "" {
+		fmt.Println("explorer:", url)
+	}
+	if sent.Receipt != nil {
+		fmt.Printf("mined in block %d, gas used %d\n", sent.Receipt.BlockNumber.Uint64(), sent.Receipt.GasUsed)
+	}
+}
+
+// printJSON writes v to stdout as indented JSON.
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("write output: %w", err)
+	}
+	return nil
+}
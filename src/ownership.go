@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Ownable functions read and called by the ownership handover.
+// Ownable2Step contracts also have pendingOwner and acceptOwnership.
+const (
+	ownerMethod           = "owner"
+	pendingOwnerMethod    = "pendingOwner"
+	acceptOwnershipMethod = "acceptOwnership"
+)
+
+// validateOwner checks a transferOwnership target: an address, an ENS name,
+// an address book label or a ${Name.address} reference.
+func validateOwner(owner string) error {
+	if len(references(owner)) > 0 || isENSName(owner) || isAddressLabel(owner) {
+		return nil
+	}
+	_, err := parseAddress(owner)
+	return err
+}
+
+// transferOwnerships hands every contract with transferOwnership set over to
+// its new owner once all deployments and calls are done, and then checks
+// owner() on chain. Ownable2Step contracts only finish once the new owner
+// has called acceptOwnership, which is waited for up to the receipt
+// timeout. Contracts the new owner already owns are left alone, so the step
+// can be resumed.
+func (r *networkRun) transferOwnerships(ctx context.Context, specs []contractSpec) error {
+	for _, spec := range specs {
+		spec = spec.forNetwork(r.name)
+		if spec.TransferOwnership == "" {
+			continue
+		}
+		if err := r.transferOwnership(ctx, spec); err != nil {
+			return fmt.Errorf("%s: transfer ownership: %w", spec.Name, err)
+		}
+	}
+	return nil
+}
+
+func (r *networkRun) transferOwnership(ctx context.Context, spec contractSpec) error {
+	target, err := substitute(spec.TransferOwnership, r.resolveRef)
+	if err != nil {
+		return err
+	}
+	newOwner, err := r.ens.resolveAddressArg(ctx, target.(string))
+	if err != nil {
+		return err
+	}
+	c, err := bindContract(ctx, r.client, r.registry, r.root, spec.Name, "")
+	if err != nil {
+		return err
+	}
+	if _, ok := c.ABI.Methods[transferOwnershipMethod]; !ok {
+		return errors.New("the contract has no transferOwnership function; is it Ownable?")
+	}
+	_, hasPending := c.ABI.Methods[pendingOwnerMethod]
+	_, hasAccept := c.ABI.Methods[acceptOwnershipMethod]
+	twoStep := hasPending && hasAccept
+
+	owner, err := readAddress(ctx, c, ownerMethod)
+	if err != nil {
+		return err
+	}
+	if owner == newOwner {
+		logger.Info("Ownership already transferred", "network", r.name, "contract", spec.Name, "owner", newOwner)
+		return nil
+	}
+	pending := common.Address{}
+	if twoStep {
+		if pending, err = readAddress(ctx, c, pendingOwnerMethod); err != nil {
+			return err
+		}
+	}
+	if pending != newOwner {
+		if owner != r.from() {
+			return fmt.Errorf("owned by %s, not %s", owner.Hex(), r.from().Hex())
+		}
+		sent, err := c.Send(ctx, r, transferOwnershipMethod, newOwner)
+		if err != nil {
+			if sent != nil && sent.Reverted {
+				return fmt.Errorf("transferOwnership reverted: %w", err)
+			}
+			return err
+		}
+		if r.opts.DryRun {
+			return nil
+		}
+		logger.Info("Transferred ownership", "network", r.name, "contract", spec.Name, "to", r.book.annotate(newOwner), "tx", sent.Hash)
+	}
+	if r.opts.DryRun {
+		return nil
+	}
+	if twoStep {
+		// Without confirmations the transfer may not be mined yet.
+		if err := r.waitAddress(ctx, c, pendingOwnerMethod, newOwner); err != nil {
+			return err
+		}
+		accept, _ := c.ABI.Pack(acceptOwnershipMethod)
+		logger.Info("Waiting for the new owner to accept ownership", "network", r.name, "contract", spec.Name,
+			"owner", newOwner, "to", c.Address, "data", hexutil.Encode(accept))
+	}
+	if err := r.waitAddress(ctx, c, ownerMethod, newOwner); err != nil {
+		return err
+	}
+	logger.Info("Verified owner", "network", r.name, "contract", spec.Name, "owner", newOwner)
+	return nil
+}
+
+// waitAddress polls method until it returns want, for up to the receipt
+// timeout.
+func (r *networkRun) waitAddress(ctx context.Context, c *boundContract, method string, want common.Address) error {
+	ctx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+	defer cancel()
+	for {
+		got, err := readAddress(ctx, c, method)
+		if err == nil && got == want {
+			return nil
+		}
+		if err := sleepCtx(ctx, receiptPollInterval); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return fmt.Errorf("%s() is %s, not %s, after %s", method, got.Hex(), want.Hex(), r.opts.Timeout.Round(time.Second))
+			}
+			return err
+		}
+	}
+}
+
+// readAddress calls a view method of c that returns an address.
+func readAddress(ctx context.Context, c *boundContract, method string) (common.Address, error) {
+	out, err := c.Call(ctx, method)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if len(out) != 1 {
+		return common.Address{}, fmt.Errorf("%s() does not return an address", method)
+	}
+	addr, ok := out[0].(common.Address)
+	if !ok {
+		return common.Address{}, fmt.Errorf("%s() does not return an address", method)
+	}
+	return addr, nil
+}
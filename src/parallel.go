@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// stepResult is what one parallel deployment step returned.
+type stepResult struct {
+	name     string
+	deployed []deployment
+	err      error
+}
+
+// deployParallel deploys specs with up to workers steps in flight, starting
+// each as soon as the manifest contracts it depends on are deployed. specs
+// must be in dependency order, as the manifest loader leaves them. After a
+// failure no new steps start, but those in flight are waited for so that
+// everything sent is checkpointed.
+func (r *networkRun) deployParallel(ctx context.Context, specs []contractSpec, state *runState, workers int) ([]deployment, error) {
+	byName := make(map[string]contractSpec, len(specs))
+	for _, spec := range specs {
+		byName[spec.Name] = spec
+	}
+	waiting := map[string]int{}
+	dependents := map[string][]string{}
+	for _, spec := range specs {
+		for _, dep := range spec.dependencies() {
+			if _, ok := byName[dep]; ok {
+				waiting[spec.Name]++
+				dependents[dep] = append(dependents[dep], spec.Name)
+			}
+		}
+	}
+	var ready []contractSpec
+	for _, spec := range specs {
+		if waiting[spec.Name] == 0 {
+			ready = append(ready, spec)
+		}
+	}
+
+	done := make(chan stepResult)
+	var results []deployment
+	var errs []error
+	running := 0
+	for {
+		for len(errs) == 0 && running < workers && len(ready) > 0 {
+			spec := ready[0]
+			ready = ready[1:]
+			running++
+			go func() {
+				deployed, err := r.deployStep(ctx, spec, state)
+				done <- stepResult{name: spec.Name, deployed: deployed, err: err}
+			}()
+		}
+		if running == 0 {
+			break
+		}
+		res := <-done
+		running--
+		results = append(results, res.deployed...)
+		if res.err != nil {
+			errs = append(errs, res.err)
+			continue
+		}
+		for _, name := range dependents[res.name] {
+			if waiting[name]--; waiting[name] == 0 {
+				ready = append(ready, byName[name])
+			}
+		}
+	}
+	return results, errors.Join(errs...)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"golang.org/x/term"
+)
+
+// Statuses of a transaction in the pending list.
+const (
+	pendingInPool  = "pending"
+	pendingDropped = "dropped"
+)
+
+// pendingTx is a transaction from the audit log that the chain has not
+// mined.
+type pendingTx struct {
+	Network string         `json:"network"`
+	Signer  common.Address `json:"signer"`
+	Nonce   uint64         `json:"nonce"`
+	// Ahead is how many of the signer's transactions must be mined before
+	// this one; 0 means it is next.
+	Ahead  uint64      `json:"ahead"`
+	Status string      `json:"status"`
+	Action string      `json:"action"`
+	TxHash common.Hash `json:"txHash"`
+	Sent   time.Time   `json:"sent"`
+	// MaxFee is what the transaction pays at most per gas, in wei, when the
+	// node still has it.
+	MaxFee string `json:"maxFee,omitempty"`
+
+	rec auditRecord
+	tx  *types.Transaction
+}
+
+// runPending lists the transactions in the audit log that were broadcast
+// but are not mined, and offers to speed up or cancel the signer's.
+func runPending(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("pending", &rpcURL)
+	rf := addRunFlags(fs)
+	percent := fs.Uint64("percent", 25, fmt.Sprintf("fee increase when speeding a transaction up, in percent (at least %d)", replacementBump))
+	speedUp := fs.Bool("speed-up", false, "resend every pending transaction of the signer with higher fees, without asking")
+	cancel := fs.Bool("cancel", false, "replace every pending transaction of the signer with an empty transfer to itself, without asking")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *speedUp && *cancel {
+		return errors.New("-speed-up and -cancel cannot be combined")
+	}
+	if *percent < replacementBump {
+		return fmt.Errorf("-percent must be at least %d; nodes reject smaller replacements", replacementBump)
+	}
+
+	m, selected, err := rf.load(ctx, fs, rpcURL, nil)
+	if err != nil {
+		return err
+	}
+	if len(selected) != 1 {
+		return errors.New("pending runs against a single network; pick one with -network")
+	}
+	run, err := openNetworkRun(ctx, m, selected[0], rf.options())
+	if err != nil {
+		return err
+	}
+	defer run.close()
+
+	pending, err := run.pendingTxs(ctx)
+	if err != nil {
+		return err
+	}
+	if rf.output == outputJSON {
+		if pending == nil {
+			pending = []pendingTx{}
+		}
+		if err := printJSON(pending); err != nil {
+			return err
+		}
+	} else if err := printPending(run.name, pending); err != nil {
+		return err
+	}
+
+	ask := !*speedUp && !*cancel && !rf.yes && term.IsTerminal(int(os.Stdin.Fd()))
+	if !*speedUp && !*cancel && !ask {
+		return nil
+	}
+	var errs []error
+	for _, p := range pending {
+		if p.Signer != run.sender.Address() {
+			continue
+		}
+		st := p.stuckTx()
+		action := "keep"
+		switch {
+		case *speedUp:
+			action = "speed-up"
+		case *cancel:
+			action = "cancel"
+		default:
+			choice, err := askPending(ctx, p, st != nil)
+			if err != nil {
+				return err
+			}
+			action = choice
+		}
+		switch action {
+		case "speed-up":
+			if st == nil {
+				logger.Warn("The node dropped this blob transaction, whose blobs are not in the audit log; it can only be cancelled", "tx", p.TxHash, "nonce", p.Nonce)
+				continue
+			}
+			err = run.replace(ctx, *st, *rf.gas, *percent, false)
+		case "cancel":
+			err = run.replace(ctx, stuckTx{hash: p.TxHash, nonce: p.Nonce, old: p.fees()}, *rf.gas, *percent, true)
+		default:
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("nonce %d: %w", p.Nonce, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pendingTxs finds the audit log's transactions on the network that are
+// not mined: those at or above their signer's mined nonce. Of several
+// transactions with one nonce, as bump leaves behind, only the last is
+// listed. They are sorted by signer and nonce.
+func (r *networkRun) pendingTxs(ctx context.Context) ([]pendingTx, error) {
+	records, err := queryAuditLog(r.auditLog.path, auditQuery{Network: r.name})
+	if err != nil {
+		return nil, err
+	}
+	type slot struct {
+		signer common.Address
+		nonce  uint64
+	}
+	latest := map[slot]auditRecord{}
+	mined := map[common.Address]uint64{}
+	for _, rec := range records {
+		// Safe transactions and user operations are sent by someone else.
+		if rec.Network != r.name || rec.Nonce == nil || rec.Safe != nil || rec.Account != nil {
+			continue
+		}
+		latest[slot{rec.Signer, *rec.Nonce}] = rec
+		mined[rec.Signer] = 0
+	}
+	for signer := range mined {
+		n, err := r.client.NonceAt(ctx, signer, nil)
+		if err != nil {
+			return nil, err
+		}
+		mined[signer] = n
+	}
+
+	var pending []pendingTx
+	for s, rec := range latest {
+		if s.nonce < mined[s.signer] {
+			continue
+		}
+		p := pendingTx{Network: r.name, Signer: s.signer, Nonce: s.nonce, Ahead: s.nonce - mined[s.signer], Action: rec.Action, TxHash: rec.TxHash, Sent: rec.Time, rec: rec}
+		tx, isPending, err := r.client.TransactionByHash(ctx, rec.TxHash)
+		switch {
+		case errors.Is(err, ethereum.NotFound):
+			p.Status = pendingDropped
+		case err != nil:
+			return nil, err
+		case !isPending:
+			// Mined since the nonce was read.
+			continue
+		default:
+			p.Status, p.tx = pendingInPool, tx
+			if price := p.fees().maxPrice(); price != nil {
+				p.MaxFee = price.String()
+			}
+		}
+		pending = append(pending, p)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if pending[i].Signer != pending[j].Signer {
+			return pending[i].Signer.Cmp(pending[j].Signer) < 0
+		}
+		return pending[i].Nonce < pending[j].Nonce
+	})
+	return pending, nil
+}
+
+// fees returns what p pays, or zero fees when the node dropped it.
+func (p pendingTx) fees() fees {
+	if p.tx == nil {
+		return fees{}
+	}
+	return stuckTxOf(p.TxHash, p.tx).old
+}
+
+// stuckTx returns p to resend, from the node's copy or else the audit
+// log's, or nil for a dropped blob transaction, which cannot be rebuilt.
+func (p pendingTx) stuckTx() *stuckTx {
+	if p.tx != nil {
+		st := stuckTxOf(p.TxHash, p.tx)
+		return &st
+	}
+	if len(p.rec.BlobHashes) > 0 {
+		return nil
+	}
+	fields := txFields{To: p.rec.To, Data: p.rec.Data}
+	if p.rec.Value != nil {
+		fields.Value = p.rec.Value.ToInt()
+	}
+	return &stuckTx{hash: p.TxHash, nonce: p.Nonce, fields: fields, gas: p.rec.Gas}
+}
+
+func printPending(network string, pending []pendingTx) error {
+	if len(pending) == 0 {
+		fmt.Printf("No pending transactions on %s.\n", network)
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SIGNER\tNONCE\tPOSITION\tSTATUS\tSENT\tMAX FEE\tACTION\tTX")
+	for _, p := range pending {
+		position := "next"
+		if p.Ahead > 0 {
+			position = fmt.Sprintf("%d ahead", p.Ahead)
+		}
+		fee := "-"
+		if p.MaxFee != "" {
+			fee = p.MaxFee + " wei"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s ago\t%s\t%s\t%s\n", p.Signer.Hex(), p.Nonce, position, p.Status, time.Since(p.Sent).Round(time.Second), fee, p.Action, p.TxHash.Hex())
+	}
+	return w.Flush()
+}
+
+// askPending asks what to do with p: speed-up, cancel or keep.
+func askPending(ctx context.Context, p pendingTx, resendable bool) (string, error) {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+	options := "[s]peed up, [c]ancel or [k]eep"
+	if !resendable {
+		options = "[c]ancel or [k]eep"
+	}
+	fmt.Fprintf(os.Stderr, "\nNonce %d, %s (%s): %s? ", p.Nonce, p.Action, p.Status, options)
+	got, err := readAnswer(ctx)
+	if err != nil {
+		return "", err
+	}
+	switch strings.ToLower(got) {
+	case "s", "speed up", "speed-up":
+		if resendable {
+			return "speed-up", nil
+		}
+	case "c", "cancel":
+		return "cancel", nil
+	}
+	return "keep", nil
+}
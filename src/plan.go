@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Plan actions, in the order they are summarised.
+const (
+	planCreate      = "create"
+	planReplace     = "replace"
+	planUpgrade     = "upgrade"
+	planReconfigure = "reconfigure"
+	planNoChange    = "no-change"
+)
+
+// planSymbols prefix each action in the text output, terraform style.
+var planSymbols = map[string]string{
+	planCreate:      "+",
+	planReplace:     "-/+",
+	planUpgrade:     "~",
+	planReconfigure: "~",
+	planNoChange:    " ",
+}
+
+// planChange is what applying the manifest would do to one contract.
+type planChange struct {
+	Name     string          `json:"name"`
+	Action   string          `json:"action"`
+	Contract string          `json:"contract"`
+	Address  *common.Address `json:"address,omitempty"`
+	Reasons  []string        `json:"reasons,omitempty"`
+	// Setters names the dependencies whose setters reconfigure the
+	// contract.
+	Setters []string `json:"setters,omitempty"`
+}
+
+// redeploys reports whether the change gives the contract a new address.
+func (c planChange) redeploys() bool {
+	return c.Action == planCreate || c.Action == planReplace
+}
+
+// networkPlan is the plan for one network. Unmanaged lists registry
+// entries the manifest no longer mentions; the plan leaves them alone.
+type networkPlan struct {
+	Network   string       `json:"network"`
+	ChainID   uint64       `json:"chainId,omitempty"`
+	Changes   []planChange `json:"changes"`
+	Unmanaged []string     `json:"unmanaged,omitempty"`
+	Error     string       `json:"error,omitempty"`
+}
+
+func runPlan(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("plan", &rpcURL)
+	manifestPath := fs.String("manifest", "", "deployment manifest to compare against the registry (required)")
+	profile := fs.String("profile", "", "manifest profile to apply, e.g. dev or prod (default $"+profileEnv+")")
+	networks := fs.String("network", "", "comma-separated manifest networks to plan (default: all)")
+	force := fs.Bool("force", false, "plan even if the node's chain id does not match the network's")
+	output := fs.String("output", outputText, "result format on stdout: text, or json for CI pipelines")
+	compiler := addCompilerFlags(fs)
+	noLint := fs.Bool("no-lint", false, "skip the static checks of selector clashes, initializer protection and code size")
+	allowOversize := fs.Bool("allow-oversize", false, "do not report code over the EIP-170/EIP-3860 size limits")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *manifestPath == "" {
+		return errors.New("-manifest is required")
+	}
+	if *output != outputText && *output != outputJSON {
+		return fmt.Errorf("unknown -output %q (want text or json)", *output)
+	}
+	m, err := loadManifest(ctx, *manifestPath, selectedProfile(*profile))
+	if err != nil {
+		return err
+	}
+	m.Compiler = compiler.merge(m.Compiler)
+	if err := m.Compiler.validate(); err != nil {
+		return fmt.Errorf("compiler: %w", err)
+	}
+	selected, err := m.selectNetworks(splitList(*networks))
+	if err != nil {
+		return err
+	}
+	if flagSet(fs, "rpc") {
+		if len(selected) != 1 {
+			return errors.New("-rpc can only override the endpoint of a single network")
+		}
+		n := m.Networks[selected[0]]
+		n.RPC, n.Fallbacks, n.Anvil = rpcURL, nil, nil
+		m.Networks[selected[0]] = n
+	}
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	// Plan against what would be deployed, not stale artifacts.
+	if err := m.build(ctx, root, selected); err != nil {
+		return err
+	}
+	var errs []error
+	findings := []lintFinding{}
+	if !*noLint {
+		if findings, err = lintManifest(root, m, *allowOversize); err != nil {
+			return err
+		}
+		if len(findings) > 0 {
+			errs = append(errs, lintError(findings))
+		}
+	}
+
+	plans := make([]networkPlan, 0, len(selected))
+	for _, name := range selected {
+		p, err := planNetwork(ctx, m, name, deployOptions{Force: *force})
+		if err != nil {
+			p.Error = err.Error()
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+		plans = append(plans, p)
+	}
+	if *output == outputJSON {
+		if err := printJSON(struct {
+			Lint     []lintFinding `json:"lint"`
+			Networks []networkPlan `json:"networks"`
+		}{findings, plans}); err != nil {
+			return err
+		}
+	} else {
+		if len(findings) > 0 {
+			printLint(os.Stdout, findings)
+			fmt.Println()
+		}
+		printPlans(plans)
+	}
+	return errors.Join(errs...)
+}
+
+// planNetwork compares the manifest's contracts on network with its
+// registry and the code on chain. Nothing is sent, so no signer is opened.
+func planNetwork(ctx context.Context, m *manifest, network string, opts deployOptions) (networkPlan, error) {
+	cfg := m.Networks[network]
+	p := networkPlan{Network: network, Changes: []planChange{}}
+	root, err := projectRoot()
+	if err != nil {
+		return p, err
+	}
+	client, node, err := dialNetwork(ctx, cfg)
+	if err != nil {
+		return p, err
+	}
+	r := &networkRun{name: network, root: root, records: root, client: client, node: node, opts: opts, addresses: map[string]common.Address{}, libraryConfig: cfg.Libraries}
+	defer r.close()
+	if r.chainID, err = client.ChainID(ctx); err != nil {
+		return p, err
+	}
+	p.ChainID = r.chainID.Uint64()
+	if r.registry, err = loadRegistry(root, network); err != nil {
+		return p, err
+	}
+	if err := r.checkChainID(cfg.chainID(network)); err != nil {
+		return p, err
+	}
+	if r.chain, err = newChainAdapter(cfg.chainKind(network), p.ChainID); err != nil {
+		return p, fmt.Errorf("network %s: %w", network, err)
+	}
+	// Type-check everything first, as deploy would.
+	if _, err := r.checkArgs(ctx, m.Contracts); err != nil {
+		return p, err
+	}
+
+	if p.Changes, err = r.planContracts(ctx, m.Contracts); err != nil {
+		return p, err
+	}
+	managed := map[string]bool{}
+	for _, spec := range m.Contracts {
+		managed[spec.Name] = true
+		if spec.Proxy != nil {
+			managed[implementationName(spec.Name)] = true
+		}
+	}
+	for _, name := range r.registry.names() {
+		if !managed[name] && !isLinkedLibrary(r.registry, name) {
+			p.Unmanaged = append(p.Unmanaged, name)
+		}
+	}
+	return p, nil
+}
+
+// planContracts works out what deploying specs would change, in order.
+func (r *networkRun) planContracts(ctx context.Context, specs []contractSpec) ([]planChange, error) {
+	// redeployed holds the contracts that get a new address, so whatever
+	// refers to them changes too.
+	redeployed := map[string]bool{}
+	changes := []planChange{}
+	for _, spec := range specs {
+		spec = spec.forNetwork(r.name)
+		c, err := r.planContract(ctx, spec, redeployed)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", spec.Name, err)
+		}
+		if c.redeploys() {
+			redeployed[spec.Name] = true
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// planContract works out what deploying spec would change. redeployed
+// names the contracts earlier in the plan that get a new address.
+func (r *networkRun) planContract(ctx context.Context, spec contractSpec, redeployed map[string]bool) (planChange, error) {
+	c := planChange{Name: spec.Name, Contract: spec.Contract, Action: planNoChange}
+	entry := r.registry.Contracts[spec.Name]
+	if entry == nil {
+		c.Action, c.Reasons = planCreate, []string{"not in the registry"}
+		return c, nil
+	}
+	c.Address = &entry.Address
+	if entry.Reorged != nil {
+		c.Action, c.Reasons = planCreate, []string{fmt.Sprintf("removed by a reorg of block %d", entry.Reorged.Block)}
+		return c, nil
+	}
+	code, err := r.client.CodeAt(ctx, entry.Address, nil)
+	if err != nil {
+		return c, err
+	}
+	if len(code) == 0 {
+		c.Action, c.Reasons = planCreate, []string{fmt.Sprintf("no code at the recorded address %s", entry.Address.Hex())}
+		return c, nil
+	}
+	art, err := r.loadArtifact(spec.Contract)
+	if err != nil {
+		return c, err
+	}
+
+	switch {
+	case spec.Proxy == nil && entry.Proxy != nil:
+		c.Action, c.Reasons = planReplace, []string{"recorded as a proxy, but the manifest no longer proxies it"}
+		return c, nil
+	case spec.Proxy != nil && entry.Proxy == nil:
+		c.Action, c.Reasons = planReplace, []string{"not recorded as a proxy"}
+		return c, nil
+	case spec.Proxy != nil && spec.Proxy.Kind != entry.Proxy.Kind:
+		c.Action, c.Reasons = planReplace, []string{fmt.Sprintf("proxy kind changes from %s to %s", entry.Proxy.Kind, spec.Proxy.Kind)}
+		return c, nil
+	}
+
+	// The code (the implementation's, behind a proxy) and its constructor
+	// arguments.
+	argsEntry := entry
+	if spec.Proxy != nil {
+		argsEntry = r.registry.Contracts[implementationName(spec.Name)]
+		if code, err = r.client.CodeAt(ctx, entry.Proxy.Implementation, nil); err != nil {
+			return c, err
+		}
+	}
+	reasons := codeChanges(entry, art, art.sourceHash(r.root), code)
+	reasons = append(reasons, r.argChanges(spec, argsEntry, art, redeployed)...)
+	if len(reasons) > 0 {
+		c.Action, c.Reasons = planReplace, reasons
+		if spec.Proxy != nil {
+			c.Action = planUpgrade
+		}
+		return c, nil
+	}
+	if spec.Proxy != nil {
+		if reasons := r.proxyChanges(spec, entry, art, redeployed); len(reasons) > 0 {
+			c.Action, c.Reasons = planReconfigure, reasons
+		}
+	}
+	for _, dep := range slices.Sorted(maps.Keys(spec.Setters)) {
+		if reason := r.setterChange(dep, entry, redeployed); reason != "" {
+			c.Action = planReconfigure
+			c.Reasons = append(c.Reasons, reason+"; calls "+spec.Setters[dep].Method)
+			c.Setters = append(c.Setters, dep)
+		}
+	}
+	return c, nil
+}
+
+// codeChanges compares the artifact with what the registry recorded for a
+// deployment: the contract, its compiler settings and the hashes of its
+// sources. Without recorded metadata, the recorded source hash and the
+// runtime code on chain, with its immutables masked, are compared instead.
+func codeChanges(entry *registryEntry, art *artifact, sourceHash *common.Hash, onChain []byte) []string {
+	if entry.Contract != art.Name {
+		return []string{fmt.Sprintf("contract changes from %s to %s", entry.Contract, art.Name)}
+	}
+	if entry.Metadata == nil || art.Metadata == nil {
+		if entry.SourceHash != nil && sourceHash != nil && *entry.SourceHash != *sourceHash {
+			return []string{"sources changed"}
+		}
+		if len(art.DeployedLinkReferences) == 0 && (len(onChain) != len(art.DeployedBytecode) ||
+			!bytes.Equal(art.ImmutableReferences.zeroed(onChain), art.DeployedBytecode)) {
+			return []string{"runtime code differs from the code on chain"}
+		}
+		return nil
+	}
+	old, cur := entry.Metadata, art.Metadata
+	var reasons []string
+	if old.Compiler.Version != cur.Compiler.Version {
+		reasons = append(reasons, fmt.Sprintf("compiler changes from %s to %s", old.Compiler.Version, cur.Compiler.Version))
+	}
+	var settings []string
+	for key := range cur.Settings {
+		if !bytes.Equal(compactJSON(old.Settings[key]), compactJSON(cur.Settings[key])) {
+			settings = append(settings, key)
+		}
+	}
+	for key := range old.Settings {
+		if _, ok := cur.Settings[key]; !ok {
+			settings = append(settings, key)
+		}
+	}
+	if len(settings) > 0 {
+		sort.Strings(settings)
+		reasons = append(reasons, "compiler settings changed: "+strings.Join(settings, ", "))
+	}
+	var sources []string
+	for path, src := range cur.Sources {
+		if prev, ok := old.Sources[path]; !ok || prev.Keccak256 != src.Keccak256 {
+			sources = append(sources, path)
+		}
+	}
+	for path := range old.Sources {
+		if _, ok := cur.Sources[path]; !ok {
+			sources = append(sources, path)
+		}
+	}
+	if len(sources) > 0 {
+		sort.Strings(sources)
+		reasons = append(reasons, "sources changed: "+strings.Join(sources, ", "))
+	}
+	return reasons
+}
+
+// argChanges compares spec's constructor arguments with those entry was
+// deployed with. Arguments referring to a redeployed contract always
+// change, unless spec has a setter for it.
+func (r *networkRun) argChanges(spec contractSpec, entry *registryEntry, art *artifact, redeployed map[string]bool) []string {
+	if moved := movedRefs(spec.Args, redeployed, spec.Setters); len(moved) > 0 {
+		return []string{"constructor arguments refer to redeployed " + strings.Join(moved, ", ")}
+	}
+	if entry == nil {
+		return []string{"no recorded constructor arguments"}
+	}
+	resolved, err := substitute(spec.Args, r.deployedRefs(entry, spec.Setters))
+	if err != nil {
+		return []string{err.Error()}
+	}
+	list, _ := resolved.([]interface{})
+	params, err := convertArgs("constructor", art.ABI.Constructor.Inputs, list)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	encoded, err := art.constructorArgs(params)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	if !bytes.Equal(encoded, entry.EncodedArgs) {
+		return []string{"constructor arguments changed"}
+	}
+	return nil
+}
+
+// proxyChanges compares a proxy's initializer call and, for transparent
+// proxies, its owner with those it was deployed with. Neither is applied
+// by redeploying the implementation: the proxy needs a call.
+func (r *networkRun) proxyChanges(spec contractSpec, entry *registryEntry, art *artifact, redeployed map[string]bool) []string {
+	p := spec.Proxy
+	if moved := movedRefs([]interface{}{p.Args, p.Owner}, redeployed, spec.Setters); len(moved) > 0 {
+		return []string{"proxy settings refer to redeployed " + strings.Join(moved, ", ")}
+	}
+	resolved, err := substituteSpec(spec, r.deployedRefs(entry, spec.Setters))
+	if err != nil {
+		return []string{err.Error()}
+	}
+	p = resolved.Proxy
+	// The proxy was deployed with (implementation, [owner,] init data).
+	recorded := make([]string, len(entry.Args))
+	for i, a := range entry.Args {
+		recorded[i], _ = a.(string)
+	}
+	var reasons []string
+	var initData []byte
+	if p.Initializer != "" {
+		if initData, err = encodeCall(art.ABI, p.Initializer, p.Args); err != nil {
+			return []string{fmt.Sprintf("initializer: %v", err)}
+		}
+	}
+	if len(recorded) == 0 || !strings.EqualFold(recorded[len(recorded)-1], hexutil.Encode(initData)) {
+		reasons = append(reasons, "initializer call changed")
+	}
+	if p.Kind == proxyTransparent {
+		owner := p.Owner
+		if owner == "" {
+			owner = entry.Deployer.Hex()
+		}
+		if len(recorded) != 3 || !strings.EqualFold(recorded[1], owner) {
+			reasons = append(reasons, "proxy owner changed")
+		}
+	}
+	return reasons
+}
+
+// movedRefs returns the redeployed contracts that v's placeholders name,
+// other than those with setters.
+func movedRefs(v interface{}, redeployed map[string]bool, setters map[string]setterSpec) []string {
+	var moved []string
+	for _, name := range references(v) {
+		if _, ok := setters[name]; redeployed[name] && !ok {
+			moved = append(moved, name)
+		}
+	}
+	slices.Sort(moved)
+	return slices.Compact(moved)
+}
+
+// isLinkedLibrary reports whether some registry entry links against the
+// entry recorded under name.
+func isLinkedLibrary(reg *registry, name string) bool {
+	addr := reg.Contracts[name].Address
+	for _, e := range reg.Contracts {
+		for _, lib := range e.Libraries {
+			if lib == addr {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func printPlans(plans []networkPlan) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for i, p := range plans {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "Network %s (chain %d):\n", p.Network, p.ChainID)
+		if p.Error != "" {
+			fmt.Fprintf(w, "  FAILED: %s\n", p.Error)
+			continue
+		}
+		counts := map[string]int{}
+		for _, c := range p.Changes {
+			counts[c.Action]++
+			addr := "-"
+			if c.Address != nil {
+				addr = c.Address.Hex()
+			}
+			fmt.Fprintf(w, "%3s %s\t%s\t%s\t%s\n", planSymbols[c.Action], c.Name, c.Action, addr, strings.Join(c.Reasons, "; "))
+		}
+		for _, name := range p.Unmanaged {
+			fmt.Fprintf(w, "    %s\tunmanaged\t\tin the registry but not the manifest\n", name)
+		}
+		fmt.Fprintf(w, "Plan: %d to create, %d to replace, %d to upgrade, %d to reconfigure.\n",
+			counts[planCreate], counts[planReplace], counts[planUpgrade], counts[planReconfigure])
+	}
+	w.Flush()
+}
+
+// compactJSON strips insignificant whitespace so recorded and compiled
+// settings compare equal regardless of formatting.
+func compactJSON(raw []byte) []byte {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return raw
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"gopkg.in/yaml.v3"
+)
+
+// policyFile is the project's deployment policy, at its root.
+const policyFile = "policy.yaml"
+
+// policy limits which signers may send transactions to which networks, and
+// which contracts they may deploy there:
+//
+//	rules:
+//	  - networks: [mainnet, base]
+//	    signers: [ledger]                 # signer types
+//	    accounts: [hw-deployer]           # addresses or address book labels
+//	    contracts: [Governance, ERC1967Proxy]
+//	  - chains: [11155111]
+//	    signers: [ledger, keystore]
+//
+// A network that rules name, or whose chain id they list, only takes
+// transactions one of those rules allows: signed by one of its signer types
+// and accounts, and for deployments, of one of its contracts. A list left
+// out allows anything. Networks no rule names are unrestricted.
+type policy struct {
+	Rules []policyRule `yaml:"rules"`
+}
+
+type policyRule struct {
+	// Networks are manifest network names; "*" is every network.
+	Networks []string `yaml:"networks"`
+	Chains   []uint64 `yaml:"chains"`
+	Signers  []string `yaml:"signers"`
+	// Accounts are the signer's address or, with a Safe, the Safe's.
+	Accounts []string `yaml:"accounts"`
+	// Contracts are artifact names, as File.sol, File.sol:Name or Name;
+	// libraries and proxies deployed for a contract must be listed too.
+	Contracts []string `yaml:"contracts"`
+}
+
+// policyOverride is what the audit log records about a transaction sent
+// against the policy with -policy-override.
+type policyOverride struct {
+	Violations []string `json:"violations"`
+	Reason     string   `json:"reason"`
+}
+
+// loadPolicy reads the project's policy, or returns nil if it has none.
+func loadPolicy(root string) (*policy, error) {
+	path := filepath.Join(root, policyFile)
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p := &policy{}
+	// Unknown fields are refused: a misspelled list would allow anything.
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	dec.KnownFields(true)
+	if err := dec.Decode(p); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for i, rule := range p.Rules {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("%s: rules[%d]: %w", policyFile, i, err)
+		}
+	}
+	return p, nil
+}
+
+func (pr policyRule) validate() error {
+	if len(pr.Networks) == 0 && len(pr.Chains) == 0 {
+		return errors.New("networks or chains is required")
+	}
+	for _, s := range pr.Signers {
+		switch s {
+		case signerNode, signerEnv, signerKeystore, signerKeychain, signerMnemonic, signerLedger, signerTrezor:
+		default:
+			return fmt.Errorf("unknown signer type %q", s)
+		}
+	}
+	for _, c := range pr.Contracts {
+		if c == "" {
+			return errors.New("contracts lists an empty name")
+		}
+	}
+	return nil
+}
+
+// applies reports whether the rule restricts the network.
+func (pr policyRule) applies(network string, chainID uint64) bool {
+	return slices.Contains(pr.Networks, "*") || slices.Contains(pr.Networks, network) || slices.Contains(pr.Chains, chainID)
+}
+
+// allowsSender reports whether the rule lets a signer of type kind send from
+// one of accounts, which it resolves with book.
+func (pr policyRule) allowsSender(kind string, accounts []common.Address, book *addressBook) (bool, error) {
+	if len(pr.Signers) > 0 && !slices.Contains(pr.Signers, kind) {
+		return false, nil
+	}
+	if len(pr.Accounts) == 0 {
+		return true, nil
+	}
+	for _, a := range pr.Accounts {
+		addr, err := parseAddress(a)
+		if err != nil {
+			if addr, err = book.resolve(a); err != nil {
+				return false, fmt.Errorf("%s: accounts: %w", policyFile, err)
+			}
+		}
+		if slices.Contains(accounts, addr) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// allowsContract reports whether the rule lets the artifact named name be
+// deployed.
+func (pr policyRule) allowsContract(name string) bool {
+	if len(pr.Contracts) == 0 {
+		return true
+	}
+	for _, c := range pr.Contracts {
+		if _, n := splitContractRef(c); n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPolicy evaluates the project's policy for the run's network and
+// signer before anything is sent, keeping the rules that allow the signer
+// for the deployments to be checked against.
+func (r *networkRun) checkPolicy(p *policy, signerKind string) error {
+	if p == nil || r.opts.Scratch {
+		return nil
+	}
+	var applying []string
+	for i, rule := range p.Rules {
+		if !rule.applies(r.name, r.chainID.Uint64()) {
+			continue
+		}
+		applying = append(applying, strconv.Itoa(i))
+		accounts := []common.Address{r.sender.Address(), r.from()}
+		ok, err := rule.allowsSender(signerKind, accounts, r.book)
+		if err != nil {
+			return err
+		}
+		if ok {
+			r.policyRules = append(r.policyRules, rule)
+		}
+	}
+	if len(applying) == 0 {
+		return nil
+	}
+	if len(r.policyRules) == 0 {
+		return r.violatePolicy(fmt.Sprintf("%s signer %s may not send on %s (%s rules %s)", signerKind, r.book.annotate(r.sender.Address()), r.name, policyFile, strings.Join(applying, ", ")))
+	}
+	// Signer pool accounts deploy too, so the rules must allow each.
+	for _, addr := range r.poolAddresses(r.pool)[1:] {
+		allowed := false
+		for _, rule := range r.policyRules {
+			ok, err := rule.allowsSender(signerKind, []common.Address{addr}, r.book)
+			if err != nil {
+				return err
+			}
+			allowed = allowed || ok
+		}
+		if !allowed {
+			if err := r.violatePolicy(fmt.Sprintf("signer pool account %s may not send on %s (%s rules %s)", r.book.annotate(addr), r.name, policyFile, strings.Join(applying, ", "))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkDeployPolicy refuses deploying the artifact named name unless a rule
+// allowing the signer allows the contract.
+func (r *networkRun) checkDeployPolicy(name string) error {
+	if len(r.policyRules) == 0 {
+		// Unrestricted, or the signer's violation was already overridden.
+		return nil
+	}
+	for _, rule := range r.policyRules {
+		if rule.allowsContract(name) {
+			return nil
+		}
+	}
+	return r.violatePolicy(fmt.Sprintf("%s may not be deployed to %s by this signer (%s)", name, r.name, policyFile))
+}
+
+// violatePolicy fails with the violation unless the run has a
+// -policy-override reason, which the audit log then records with every
+// transaction the run sends. Dry runs only warn.
+func (r *networkRun) violatePolicy(violation string) error {
+	reason := r.opts.PolicyOverride
+	if reason == "" {
+		if r.opts.DryRun {
+			logger.Warn("The policy would refuse this", "network", r.name, "violation", violation)
+			return nil
+		}
+		return fmt.Errorf("%s; pass -policy-override <reason> to send anyway, which the audit log records", violation)
+	}
+	logger.Warn("Overriding the policy", "network", r.name, "violation", violation, "reason", reason)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.policyOverride == nil {
+		r.policyOverride = &policyOverride{Reason: reason}
+	}
+	r.policyOverride.Violations = append(r.policyOverride.Violations, violation)
+	return nil
+}
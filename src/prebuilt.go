@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// isPrebuiltRef reports whether ref names an artifact file built outside
+// this project rather than a source file compiled to out/.
+func isPrebuiltRef(ref string) bool {
+	ext := filepath.Ext(ref)
+	return ext == ".json" || ext == ".bin"
+}
+
+// prebuiltArtifact is the union of the Foundry and Hardhat artifact
+// formats: Foundry nests the bytecode in an object and may carry the
+// metadata, Hardhat gives it as a string with the link references
+// alongside.
+type prebuiltArtifact struct {
+	ContractName           string          `json:"contractName"`
+	SourceName             string          `json:"sourceName"`
+	ABI                    json.RawMessage `json:"abi"`
+	Bytecode               json.RawMessage `json:"bytecode"`
+	DeployedBytecode       json.RawMessage `json:"deployedBytecode"`
+	LinkReferences         linkReferences  `json:"linkReferences"`
+	DeployedLinkReferences linkReferences  `json:"deployedLinkReferences"`
+	RawMetadata            string          `json:"rawMetadata"`
+	StorageLayout          json.RawMessage `json:"storageLayout"`
+}
+
+// loadPrebuilt reads a vendored or separately built artifact: a Foundry or
+// Hardhat JSON artifact, or a solc --bin file with its ABI in the .abi file
+// next to it. Relative paths are taken from root.
+func loadPrebuilt(root, ref string) (*artifact, error) {
+	path := ref
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load artifact %s: %w", ref, err)
+	}
+	_, name := splitContractRef(ref)
+
+	if filepath.Ext(path) == ".bin" {
+		abiPath := strings.TrimSuffix(path, ".bin") + ".abi"
+		abiJSON, err := os.ReadFile(abiPath)
+		if err != nil {
+			return nil, fmt.Errorf("load ABI for %s: %w", ref, err)
+		}
+		art, err := newArtifactFromABI(name, abiJSON, string(bytes.TrimSpace(raw)))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ref, err)
+		}
+		art.Source, art.Path = filepath.Base(ref), path
+		return art, nil
+	}
+
+	var pa prebuiltArtifact
+	if err := json.Unmarshal(raw, &pa); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if pa.ContractName != "" {
+		name = pa.ContractName
+	}
+	code, links, err := prebuiltCode(pa.Bytecode)
+	if err != nil {
+		return nil, fmt.Errorf("%s: bytecode: %w", path, err)
+	}
+	art, err := newArtifactFromABI(name, pa.ABI, code)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	deployed, deployedLinks, err := prebuiltCode(pa.DeployedBytecode)
+	if err != nil {
+		return nil, fmt.Errorf("%s: deployedBytecode: %w", path, err)
+	}
+	art.DeployedBytecode = decodeCode(deployed)
+	art.LinkReferences, art.DeployedLinkReferences = pa.LinkReferences, pa.DeployedLinkReferences
+	if links != nil {
+		art.LinkReferences = links
+	}
+	if deployedLinks != nil {
+		art.DeployedLinkReferences = deployedLinks
+	}
+	art.Source, art.Path, art.StorageLayout = filepath.Base(ref), path, pa.StorageLayout
+	if pa.SourceName != "" {
+		art.Source = filepath.Base(pa.SourceName)
+	}
+	if pa.RawMetadata != "" {
+		art.Metadata = new(compilerMetadata)
+		if err := json.Unmarshal([]byte(pa.RawMetadata), art.Metadata); err != nil {
+			return nil, fmt.Errorf("parse metadata in %s: %w", path, err)
+		}
+	}
+	return art, nil
+}
+
+// prebuiltCode reads a bytecode field that is either a hex string or a
+// Foundry {object, linkReferences} object.
+func prebuiltCode(raw json.RawMessage) (string, linkReferences, error) {
+	if len(raw) == 0 {
+		return "", nil, nil
+	}
+	var object string
+	if err := json.Unmarshal(raw, &object); err == nil {
+		return object, nil, nil
+	}
+	var nested struct {
+		Object         string         `json:"object"`
+		LinkReferences linkReferences `json:"linkReferences"`
+	}
+	if err := json.Unmarshal(raw, &nested); err != nil {
+		return "", nil, fmt.Errorf("want a hex string or an object with one: %w", err)
+	}
+	return nested.Object, nested.LinkReferences, nil
+}
+
+// newArtifactFromABI builds an artifact from an ABI and hex creation
+// bytecode, for contracts compiled elsewhere. Without compiler metadata
+// they cannot be verified on an explorer.
+func newArtifactFromABI(name string, abiJSON []byte, bytecode string) (*artifact, error) {
+	parsed, err := abi.JSON(bytes.NewReader(abiJSON))
+	if err != nil {
+		return nil, fmt.Errorf("parse abi: %w", err)
+	}
+	digits := strings.TrimPrefix(placeholderPattern.ReplaceAllString(bytecode, ""), "0x")
+	if !hexDigits.MatchString(digits) {
+		return nil, fmt.Errorf("bytecode of %s is not hex", name)
+	}
+	return &artifact{
+		Name:     name,
+		Source:   name,
+		ABI:      parsed,
+		RawABI:   json.RawMessage(abiJSON),
+		Bytecode: decodeCode(bytecode),
+	}, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// profileEnv selects a profile when -profile is not given, e.g. in CI.
+const profileEnv = "DEPLOY_PROFILE"
+
+// A profile is a named overlay on the manifest, selected with -profile,
+// for running the same deployments in different environments:
+//
+//	profiles:
+//	  dev:
+//	    networks:
+//	      mainnet:
+//	        anvil: {fork: "${MAINNET_RPC_URL}"}
+//	  prod:
+//	    signer: {type: ledger}
+//	    confirmations: 3
+//	    networks:
+//	      mainnet:
+//	        rpc: ${secret:env:MAINNET_RPC_URL}
+//	        explorer: {apiKey: "${secret:env:ETHERSCAN_API_KEY}"}
+//
+// Its keys are manifest keys: mappings merge into the manifest's, and other
+// values replace them. Only the selected profile's secrets are resolved.
+// Besides confirmations, a profile may set confirm to prompt before every
+// transaction on all networks, or on none.
+//
+// prod and production default to strict settings, confirm: true and three
+// confirmations; dev and development to loose ones, confirm: false and
+// one. Either can be used without a profiles entry.
+type profileConfig struct {
+	Confirm       *bool   `yaml:"confirm"`
+	Confirmations *uint64 `yaml:"confirmations"`
+}
+
+// profileDefaults are the settings of the well-known profiles that their
+// own keys override.
+var profileDefaults = map[string]profileConfig{
+	"prod":        {Confirm: ptr(true), Confirmations: ptr[uint64](3)},
+	"production":  {Confirm: ptr(true), Confirmations: ptr[uint64](3)},
+	"dev":         {Confirm: ptr(false), Confirmations: ptr[uint64](1)},
+	"development": {Confirm: ptr(false), Confirmations: ptr[uint64](1)},
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// selectedProfile returns the -profile flag's value, or $DEPLOY_PROFILE.
+func selectedProfile(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv(profileEnv)
+}
+
+// applyProfile merges the named profile into the manifest document and
+// drops the profiles section, returning the profile's own settings.
+func applyProfile(doc *yaml.Node, name string) (profileConfig, error) {
+	root := doc
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	var profiles *yaml.Node
+	if root.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if root.Content[i].Value == "profiles" {
+				profiles = root.Content[i+1]
+				root.Content = slices.Delete(root.Content, i, i+2)
+				break
+			}
+		}
+	}
+	cfg := profileDefaults[name]
+	if name == "" {
+		return cfg, nil
+	}
+	var overlay *yaml.Node
+	if profiles != nil {
+		overlay = mappingValue(profiles, name)
+	}
+	if overlay == nil {
+		if _, ok := profileDefaults[name]; ok {
+			return cfg, nil
+		}
+		var have []string
+		if profiles != nil && profiles.Kind == yaml.MappingNode {
+			for i := 0; i < len(profiles.Content); i += 2 {
+				have = append(have, profiles.Content[i].Value)
+			}
+		}
+		return cfg, fmt.Errorf("profile %s is not in the manifest (have %v)", name, have)
+	}
+	if overlay.Kind != yaml.MappingNode {
+		return cfg, fmt.Errorf("profile %s: line %d: want a mapping of manifest keys", name, overlay.Line)
+	}
+	var own profileConfig
+	if err := overlay.Decode(&own); err != nil {
+		return cfg, fmt.Errorf("profile %s: %w", name, err)
+	}
+	if own.Confirm != nil {
+		cfg.Confirm = own.Confirm
+	}
+	if own.Confirmations != nil {
+		cfg.Confirmations = own.Confirmations
+	}
+	for i := 0; i+1 < len(overlay.Content); i += 2 {
+		if key := overlay.Content[i].Value; key != "confirm" && key != "confirmations" {
+			mergeNode(root, overlay.Content[i], overlay.Content[i+1])
+		}
+	}
+	return cfg, nil
+}
+
+// mergeNode sets key in the mapping dst to value, merging it into an
+// existing mapping value key by key.
+func mergeNode(dst, key, value *yaml.Node) {
+	for i := 0; i+1 < len(dst.Content); i += 2 {
+		if dst.Content[i].Value != key.Value {
+			continue
+		}
+		if old := dst.Content[i+1]; old.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode {
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				mergeNode(old, value.Content[j], value.Content[j+1])
+			}
+			return
+		}
+		dst.Content[i+1] = value
+		return
+	}
+	dst.Content = append(dst.Content, key, value)
+}
+
+// apply sets the profile's confirmation settings on m. An explicit
+// -confirmations still wins; the caller checks that flag.
+func (p profileConfig) apply(m *manifest) {
+	if p.Confirm != nil {
+		for name, n := range m.Networks {
+			n.Confirm = *p.Confirm
+			m.Networks[name] = n
+		}
+	}
+	if p.Confirmations != nil {
+		m.Confirmations = p.Confirmations
+	}
+}
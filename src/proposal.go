@@ -0,0 +1,662 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Governance's ProposalState values.
+const (
+	proposalInProgress uint8 = iota
+	proposalPassed
+	proposalFailed
+	proposalExecuted
+)
+
+// proposalSearch bounds how far back from proposalCounter proposal create
+// looks for the proposal it just made, in case others proposed meanwhile.
+const proposalSearch = 20
+
+// A Governance proposal goes through these phases: pending until voting
+// opens a minute after it is made, voting for a day, then awaiting
+// finalization until proposal queue records whether it passed. A passed
+// proposal executes once enough approvers approve it with proposal execute.
+const (
+	phasePending  = "pending"
+	phaseVoting   = "voting"
+	phaseAwaiting = "awaiting finalization"
+	phasePassed   = "passed"
+	phaseFailed   = "failed"
+	phaseExecuted = "executed"
+	phaseUnknown  = "unknown"
+)
+
+// proposalLog tracks the proposals made and acted on from this project,
+// stored as deployments/<network>.proposals.json next to the registry. The
+// contract stays the source of truth for each proposal's state; the log
+// keeps who moved it along, in which transaction.
+type proposalLog struct {
+	Network   string             `json:"network"`
+	ChainID   uint64             `json:"chainId"`
+	Proposals []*trackedProposal `json:"proposals"`
+
+	path string
+}
+
+type trackedProposal struct {
+	Governance  common.Address `json:"governance"`
+	ID          uint64         `json:"id"`
+	Description string         `json:"description"`
+	// Call describes the calldata Governance executes on itself.
+	Call        string               `json:"call,omitempty"`
+	Transitions []proposalTransition `json:"transitions"`
+}
+
+// proposalTransition is one transaction sent for a proposal, and the
+// phase it left the proposal in.
+type proposalTransition struct {
+	Action string         `json:"action"`
+	From   common.Address `json:"from"`
+	Tx     common.Hash    `json:"tx"`
+	At     time.Time      `json:"at"`
+	Phase  string         `json:"phase"`
+}
+
+func proposalLogPath(root, network string) string {
+	return filepath.Join(root, "deployments", network+".proposals.json")
+}
+
+// loadProposalLog reads the proposal log for the run's network. A missing
+// file yields an empty log.
+func (r *networkRun) loadProposalLog() (*proposalLog, error) {
+	path := proposalLogPath(r.records, r.name)
+	l := &proposalLog{Network: r.name, ChainID: r.chainID.Uint64(), path: path}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, l); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if l.ChainID != r.chainID.Uint64() {
+		return nil, fmt.Errorf("%s was written for chain %d, but %s is chain %s", path, l.ChainID, r.name, r.chainID)
+	}
+	l.path = path
+	return l, nil
+}
+
+func (l *proposalLog) save() error {
+	raw, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(l.path, append(raw, '\n'), 0o644)
+}
+
+func (l *proposalLog) find(gov common.Address, id uint64) *trackedProposal {
+	for _, p := range l.Proposals {
+		if p.Governance == gov && p.ID == id {
+			return p
+		}
+	}
+	return nil
+}
+
+// recordProposal appends a transition to the proposal's history,
+// tracking the proposal from then on if it was made elsewhere.
+func (r *networkRun) recordProposal(gov *governance, id uint64, p *governanceProposalsResult, action string, sent *sentTx, phase string) error {
+	l, err := r.loadProposalLog()
+	if err != nil {
+		return err
+	}
+	tracked := l.find(gov.Address, id)
+	if tracked == nil {
+		tracked = &trackedProposal{Governance: gov.Address, ID: id, Description: p.Description, Call: describeCall(gov.ABI, p.CallData, r.book)}
+		l.Proposals = append(l.Proposals, tracked)
+	}
+	tracked.Transitions = append(tracked.Transitions, proposalTransition{Action: action, From: r.from(), Tx: sent.Hash, At: time.Now().UTC().Truncate(time.Second), Phase: phase})
+	if err := l.save(); err != nil {
+		return fmt.Errorf("record proposal: %w", err)
+	}
+	return nil
+}
+
+// proposalPhase places p in its lifecycle at the chain time now.
+func proposalPhase(p *governanceProposalsResult, now uint64) string {
+	switch p.State {
+	case proposalInProgress:
+		switch {
+		case now < p.StartTime.Uint64():
+			return phasePending
+		case now <= p.EndTime.Uint64():
+			return phaseVoting
+		}
+		return phaseAwaiting
+	case proposalPassed:
+		return phasePassed
+	case proposalFailed:
+		return phaseFailed
+	case proposalExecuted:
+		return phaseExecuted
+	}
+	return phaseUnknown
+}
+
+// until renders how long from now the chain time ts is.
+func until(now, ts uint64) string {
+	if ts <= now {
+		return "now"
+	}
+	return "in " + (time.Duration(ts-now) * time.Second).String()
+}
+
+func chainTime(ts *big.Int) string {
+	return time.Unix(ts.Int64(), 0).Local().Format(time.RFC3339)
+}
+
+func runProposal(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: proposal create|vote|queue|execute|status [flags]")
+	}
+	switch args[0] {
+	case "create":
+		return runProposalCreate(ctx, args[1:])
+	case "vote", "queue", "execute":
+		return runProposalStep(ctx, args[0], args[1:])
+	case "status":
+		return runProposalStatus(ctx, args[1:])
+	}
+	return fmt.Errorf("unknown proposal subcommand %q (want create, vote, queue, execute or status)", args[0])
+}
+
+// governanceFlags adds the flags naming the Governance contract.
+func governanceFlags(fs *flag.FlagSet) (to, contractRef *string) {
+	to = fs.String("to", "Governance", "Governance address, ENS name or registry name")
+	contractRef = fs.String("contract", "", "artifact (File.sol or File.sol:Name) providing the ABI; defaults to the registry entry's")
+	return to, contractRef
+}
+
+func runProposalCreate(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("proposal create", &rpcURL)
+	rf := addRunFlags(fs)
+	to, contractRef := governanceFlags(fs)
+	description := fs.String("description", "", "what the proposal is for (required)")
+	method := fs.String("method", "", "Governance method the proposal calls once approved, by name or signature")
+	methodArgs := fs.String("args", "[]", "method arguments as a JSON array")
+	calldata := fs.String("calldata", "", "calldata to execute instead of -method, as hex")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *description == "" {
+		return errors.New("-description is required")
+	}
+	if *method != "" && *calldata != "" {
+		return errors.New("pass either -method or -calldata")
+	}
+	run, err := openTimelockRun(ctx, fs, rf, rpcURL, "proposal create")
+	if err != nil {
+		return err
+	}
+	defer run.close()
+	c, err := bindContract(ctx, run.client, run.registry, run.root, *to, *contractRef)
+	if err != nil {
+		return err
+	}
+	gov := newGovernance(c)
+
+	// Governance executes a proposal by calling itself with its calldata,
+	// so the calldata is for one of its own methods.
+	var data []byte
+	switch {
+	case *method != "":
+		params, err := parseJSONArgs(*methodArgs)
+		if err != nil {
+			return err
+		}
+		if params, err = run.ens.resolveMethodArgs(ctx, c.ABI, *method, params, nil); err != nil {
+			return err
+		}
+		if data, err = encodeCall(c.ABI, *method, params); err != nil {
+			return err
+		}
+	case *calldata != "":
+		if data, err = hexutil.Decode(*calldata); err != nil {
+			return fmt.Errorf("-calldata: %w", err)
+		}
+	}
+	if len(data) < 4 && !c.ABI.HasFallback() {
+		logger.Warn("The proposal makes no call, and Governance has no fallback, so approving it will revert; it can only be voted on", "governance", c.Address.Hex())
+	} else if call := describeCall(c.ABI, data, run.book); call != "" {
+		logger.Info("Once approved, Governance calls", "call", call)
+	}
+
+	from := run.from()
+	sent, err := gov.Propose(ctx, run, *description, data)
+	if err != nil {
+		if sent != nil && sent.Reverted {
+			return fmt.Errorf("propose reverted: %w", err)
+		}
+		return err
+	}
+	if rf.dryRun {
+		if rf.output == outputJSON {
+			return printJSON(newTxReport(run, c.Address, "propose", sent, true))
+		}
+		fmt.Printf("DRY RUN: proposing %q on %s would succeed (gas %d)\n", *description, c.Address.Hex(), sent.Gas)
+		return nil
+	}
+	if sent.Receipt == nil {
+		// With -confirmations 0 the send returns at once, but the proposal
+		// only has an id once it is mined.
+		logger.Info("Waiting for the proposal to be mined to read its id", "tx", sent.Hash)
+		if sent.Receipt, err = run.waitMined(ctx, sent.Hash); err != nil {
+			return err
+		}
+	}
+	id, p, err := findProposal(ctx, gov, from, *description)
+	if err != nil {
+		return err
+	}
+	if err := run.recordProposal(gov, id, p, "create", sent, phasePending); err != nil {
+		return err
+	}
+	if rf.output == outputJSON {
+		return printJSON(struct {
+			txReport
+			ProposalID uint64 `json:"proposalId"`
+		}{newTxReport(run, c.Address, "propose", sent, false), id})
+	}
+	fmt.Println("proposal:", id)
+	run.printSent(sent)
+	fmt.Printf("voting opens at %s and closes at %s (run: proposal vote -id %d)\n", chainTime(p.StartTime), chainTime(p.EndTime), id)
+	return nil
+}
+
+// findProposal finds the latest proposal from proposer with description,
+// as Governance emits no event naming the id it assigned.
+func findProposal(ctx context.Context, gov *governance, proposer common.Address, description string) (uint64, *governanceProposalsResult, error) {
+	counter, err := gov.ProposalCounter(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	for id := counter.Uint64(); id > 0 && counter.Uint64()-id < proposalSearch; id-- {
+		p, err := gov.Proposals(ctx, new(big.Int).SetUint64(id))
+		if err != nil {
+			return 0, nil, err
+		}
+		if p.Proposer == proposer && p.Description == description {
+			return id, p, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("the proposal was made, but is not among the latest %d on %s; find it with proposal status", proposalSearch, gov.Address.Hex())
+}
+
+// readProposal reads proposal id, which a zero id in the result marks as
+// never made.
+func readProposal(ctx context.Context, gov *governance, id uint64) (*governanceProposalsResult, error) {
+	p, err := gov.Proposals(ctx, new(big.Int).SetUint64(id))
+	if err != nil {
+		return nil, err
+	}
+	if p.Id.Sign() == 0 {
+		return nil, fmt.Errorf("proposal %d does not exist on %s", id, gov.Address.Hex())
+	}
+	return p, nil
+}
+
+// Actions that move a proposal along, and the Governance method each sends.
+var proposalMethods = map[string]string{
+	"vote":    "vote",
+	"queue":   "finalizeProposal",
+	"execute": "approveExecution",
+}
+
+// runProposalStep votes on, finalizes or approves a proposal, after
+// checking it is in the phase that allows it, so that a step taken too
+// early or twice fails with an explanation rather than a bare revert.
+func runProposalStep(ctx context.Context, action string, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("proposal "+action, &rpcURL)
+	rf := addRunFlags(fs)
+	to, contractRef := governanceFlags(fs)
+	id := fs.Uint64("id", 0, "proposal id (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *id == 0 {
+		return errors.New("-id is required")
+	}
+	run, err := openTimelockRun(ctx, fs, rf, rpcURL, "proposal "+action)
+	if err != nil {
+		return err
+	}
+	defer run.close()
+	c, err := bindContract(ctx, run.client, run.registry, run.root, *to, *contractRef)
+	if err != nil {
+		return err
+	}
+	gov := newGovernance(c)
+	p, err := readProposal(ctx, gov, *id)
+	if err != nil {
+		return err
+	}
+	now, err := latestTimestamp(ctx, run)
+	if err != nil {
+		return err
+	}
+	if err := checkProposalStep(ctx, run, gov, *id, p, action, now); err != nil {
+		return err
+	}
+
+	method := proposalMethods[action]
+	sent, err := c.Send(ctx, run, method, new(big.Int).SetUint64(*id))
+	if err != nil {
+		if sent != nil && sent.Reverted {
+			return fmt.Errorf("%s reverted: %w", method, err)
+		}
+		return err
+	}
+	if rf.output == outputJSON && rf.dryRun {
+		return printJSON(newTxReport(run, c.Address, method, sent, true))
+	}
+	if rf.dryRun {
+		fmt.Printf("DRY RUN: %s of proposal %d would succeed (gas %d)\n", method, *id, sent.Gas)
+		return nil
+	}
+	if p, err = readProposal(ctx, gov, *id); err != nil {
+		return err
+	}
+	if now, err = latestTimestamp(ctx, run); err != nil {
+		return err
+	}
+	phase := proposalPhase(p, now)
+	if err := run.recordProposal(gov, *id, p, action, sent, phase); err != nil {
+		return err
+	}
+	if rf.output == outputJSON {
+		return printJSON(newTxReport(run, c.Address, method, sent, false))
+	}
+	run.printSent(sent)
+	switch {
+	case action == "vote":
+		fmt.Printf("voted on proposal %d, which has %s votes; voting closes at %s\n", *id, p.Votes, chainTime(p.EndTime))
+	case phase == phasePassed:
+		required, err := gov.RequiredApprovals(ctx)
+		if err != nil {
+			return err
+		}
+		if action == "queue" {
+			fmt.Printf("proposal %d passed with %s votes; it executes once %s approvers run proposal execute -id %d\n", *id, p.Votes, required, *id)
+		} else {
+			fmt.Printf("approved proposal %d: %s of %s approvals\n", *id, p.Approvals, required)
+		}
+	default:
+		fmt.Printf("proposal %d %s\n", *id, phase)
+	}
+	return nil
+}
+
+// checkProposalStep checks that the proposal is in the phase action needs,
+// and that the sender can take it.
+func checkProposalStep(ctx context.Context, run *networkRun, gov *governance, id uint64, p *governanceProposalsResult, action string, now uint64) error {
+	phase := proposalPhase(p, now)
+	from := run.from()
+	switch action {
+	case "vote":
+		switch phase {
+		case phasePending:
+			return fmt.Errorf("voting on proposal %d opens at %s (%s)", id, chainTime(p.StartTime), until(now, p.StartTime.Uint64()))
+		case phaseVoting:
+		case phaseAwaiting:
+			return fmt.Errorf("voting on proposal %d closed at %s; finalize it with proposal queue -id %d", id, chainTime(p.EndTime), id)
+		default:
+			return fmt.Errorf("proposal %d is %s", id, phase)
+		}
+		voted, err := gov.HasVoted(ctx, new(big.Int).SetUint64(id), from)
+		if err != nil {
+			return err
+		}
+		if voted {
+			return fmt.Errorf("%s has already voted on proposal %d", from.Hex(), id)
+		}
+	case "queue":
+		switch phase {
+		case phasePending, phaseVoting:
+			return fmt.Errorf("voting on proposal %d closes at %s (%s); it can be finalized after that", id, chainTime(p.EndTime), until(now, p.EndTime.Uint64()))
+		case phaseAwaiting:
+		default:
+			return fmt.Errorf("proposal %d is already finalized: %s", id, phase)
+		}
+	case "execute":
+		switch phase {
+		case phasePassed:
+		case phaseAwaiting:
+			return fmt.Errorf("proposal %d is not finalized; run proposal queue -id %d first", id, id)
+		default:
+			return fmt.Errorf("proposal %d is %s; only passed proposals can be approved", id, phase)
+		}
+		approvers, err := readApprovers(ctx, gov)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(approvers, from) {
+			return fmt.Errorf("%s is not an approver of %s", from.Hex(), gov.Address.Hex())
+		}
+		approved, err := gov.ApprovedBy(ctx, new(big.Int).SetUint64(id), from)
+		if err != nil {
+			return err
+		}
+		if approved {
+			return fmt.Errorf("%s has already approved proposal %d", from.Hex(), id)
+		}
+	}
+	return nil
+}
+
+// proposalStatus is a proposal as proposal status reports it.
+type proposalStatus struct {
+	ID          uint64           `json:"id"`
+	Proposer    common.Address   `json:"proposer"`
+	Description string           `json:"description"`
+	CallData    hexutil.Bytes    `json:"callData"`
+	Call        string           `json:"call,omitempty"`
+	Votes       *big.Int         `json:"votes"`
+	Start       time.Time        `json:"votingOpens"`
+	End         time.Time        `json:"votingCloses"`
+	Phase       string           `json:"phase"`
+	Approvals   *big.Int         `json:"approvals"`
+	Required    *big.Int         `json:"requiredApprovals"`
+	ApprovedBy  []common.Address `json:"approvedBy,omitempty"`
+	// Next is the step that moves the proposal along.
+	Next    string               `json:"next,omitempty"`
+	History []proposalTransition `json:"history,omitempty"`
+}
+
+func runProposalStatus(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("proposal status", &rpcURL)
+	to, contractRef := governanceFlags(fs)
+	id := fs.Uint64("id", 0, "proposal to show in detail (default: list them all)")
+	output := fs.String("output", outputText, "text, or json")
+	network := addRegistryFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *output != outputText && *output != outputJSON {
+		return fmt.Errorf("unknown -output %q (want text or json)", *output)
+	}
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return err
+	}
+	reg, err := loadRegistry(root, *network)
+	if err != nil {
+		return err
+	}
+	book, err := loadAddressBook(root, *network)
+	if err != nil {
+		return err
+	}
+	run := &networkRun{name: *network, root: root, records: root, client: client, chainID: chainID, registry: reg, book: book}
+	c, err := bindContract(ctx, client, reg, root, *to, *contractRef)
+	if err != nil {
+		return err
+	}
+	gov := newGovernance(c)
+	l, err := run.loadProposalLog()
+	if err != nil {
+		return err
+	}
+	now, err := latestTimestamp(ctx, run)
+	if err != nil {
+		return err
+	}
+	required, err := gov.RequiredApprovals(ctx)
+	if err != nil {
+		return err
+	}
+
+	ids := []uint64{*id}
+	if *id == 0 {
+		counter, err := gov.ProposalCounter(ctx)
+		if err != nil {
+			return err
+		}
+		ids = ids[:0]
+		for i := uint64(1); i <= counter.Uint64(); i++ {
+			ids = append(ids, i)
+		}
+	}
+	var approvers []common.Address
+	if *id != 0 {
+		if approvers, err = readApprovers(ctx, gov); err != nil {
+			return err
+		}
+	}
+	statuses := make([]proposalStatus, 0, len(ids))
+	for _, id := range ids {
+		p, err := readProposal(ctx, gov, id)
+		if err != nil {
+			return err
+		}
+		s := proposalStatus{
+			ID:          id,
+			Proposer:    p.Proposer,
+			Description: p.Description,
+			CallData:    p.CallData,
+			Call:        describeCall(c.ABI, p.CallData, book),
+			Votes:       p.Votes,
+			Start:       time.Unix(p.StartTime.Int64(), 0).UTC(),
+			End:         time.Unix(p.EndTime.Int64(), 0).UTC(),
+			Phase:       proposalPhase(p, now),
+			Approvals:   p.Approvals,
+			Required:    required,
+		}
+		switch s.Phase {
+		case phasePending:
+			s.Next = "voting opens " + until(now, p.StartTime.Uint64())
+		case phaseVoting:
+			s.Next = fmt.Sprintf("proposal vote -id %d; voting closes %s", id, until(now, p.EndTime.Uint64()))
+		case phaseAwaiting:
+			s.Next = fmt.Sprintf("proposal queue -id %d", id)
+		case phasePassed:
+			s.Next = fmt.Sprintf("proposal execute -id %d, by %s more approvers", id, new(big.Int).Sub(required, p.Approvals))
+		}
+		for _, a := range approvers {
+			if ok, err := gov.ApprovedBy(ctx, new(big.Int).SetUint64(id), a); err != nil {
+				return err
+			} else if ok {
+				s.ApprovedBy = append(s.ApprovedBy, a)
+			}
+		}
+		if tracked := l.find(c.Address, id); tracked != nil {
+			s.History = tracked.Transitions
+		}
+		statuses = append(statuses, s)
+	}
+
+	if *output == outputJSON {
+		if *id != 0 {
+			return printJSON(statuses[0])
+		}
+		return printJSON(statuses)
+	}
+	if *id != 0 {
+		statuses[0].print(book)
+		return nil
+	}
+	if len(statuses) == 0 {
+		fmt.Println("no proposals on", c.Address.Hex())
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tPHASE\tVOTES\tAPPROVALS\tVOTING CLOSES\tDESCRIPTION")
+	for _, s := range statuses {
+		description := s.Description
+		if len(description) > 40 {
+			description = description[:37] + "..."
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s/%s\t%s\t%s\n", s.ID, s.Phase, s.Votes, s.Approvals, s.Required, s.End.Local().Format(time.RFC3339), description)
+	}
+	return w.Flush()
+}
+
+func (s *proposalStatus) print(book *addressBook) {
+	fmt.Printf("Proposal %d: %s\n", s.ID, s.Description)
+	fmt.Println("Proposer:  ", book.annotate(s.Proposer))
+	switch {
+	case s.Call != "":
+		fmt.Println("Call:      ", s.Call)
+	case len(s.CallData) > 0:
+		fmt.Println("Call data: ", s.CallData)
+	default:
+		fmt.Println("Call:       none")
+	}
+	fmt.Println("Phase:     ", s.Phase)
+	fmt.Printf("Voting:     %s to %s, %s votes\n", s.Start.Local().Format(time.RFC3339), s.End.Local().Format(time.RFC3339), s.Votes)
+	fmt.Printf("Approvals:  %s of %s\n", s.Approvals, s.Required)
+	for _, a := range s.ApprovedBy {
+		fmt.Println("  approved by", book.annotate(a))
+	}
+	if s.Next != "" {
+		fmt.Println("Next:      ", s.Next)
+	}
+	if len(s.History) > 0 {
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "WHEN\tACTION\tFROM\tTX\tPHASE")
+		for _, t := range s.History {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", t.At.Local().Format(time.DateTime), t.Action, book.annotate(t.From), t.Tx.Hex(), t.Phase)
+		}
+		w.Flush()
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	proxyUUPS        = "uups"
+	proxyTransparent = "transparent"
+)
+
+// Default proxy artifacts. forge only builds them when something imports
+// them, e.g. a script importing
+// @openzeppelin/contracts/proxy/ERC1967/ERC1967Proxy.sol.
+var defaultProxyContracts = map[string]string{
+	proxyUUPS:        "ERC1967Proxy.sol:ERC1967Proxy",
+	proxyTransparent: "TransparentUpgradeableProxy.sol:TransparentUpgradeableProxy",
+}
+
+// adminSlot is the ERC-1967 storage slot holding a transparent proxy's
+// admin (the ProxyAdmin contract in OpenZeppelin 5).
+var adminSlot = common.HexToHash("0xb53127684a568b3173ae13b9f8a6016e243e63b6e8ee1178d6a717850b5d6103")
+
+// proxyConfig deploys a manifest contract behind an ERC-1967 proxy:
+//
+//	proxy:
+//	  kind: uups           # or transparent
+//	  initializer: initialize
+//	  args: ["0xToken"]
+//	  owner: 0x...         # transparent only; defaults to the deployer
+//
+// The contract's own args are then passed to the implementation's
+// constructor.
+type proxyConfig struct {
+	Kind        string        `yaml:"kind"`
+	Initializer string        `yaml:"initializer"`
+	Args        []interface{} `yaml:"args"`
+	Owner       string        `yaml:"owner"`
+	// Contract overrides the proxy artifact.
+	Contract string `yaml:"contract"`
+}
+
+func (p *proxyConfig) validate() error {
+	if _, ok := defaultProxyContracts[p.Kind]; !ok {
+		return fmt.Errorf("proxy kind must be %s or %s, not %q", proxyUUPS, proxyTransparent, p.Kind)
+	}
+	if p.Owner != "" {
+		if p.Kind != proxyTransparent {
+			return fmt.Errorf("proxy owner only applies to %s proxies", proxyTransparent)
+		}
+		if len(references(p.Owner)) == 0 && !isENSName(p.Owner) && !isAddressLabel(p.Owner) {
+			if _, err := parseAddress(p.Owner); err != nil {
+				return fmt.Errorf("proxy owner: %w", err)
+			}
+		}
+	}
+	if p.Initializer == "" && len(p.Args) > 0 {
+		return fmt.Errorf("proxy args given without an initializer")
+	}
+	return nil
+}
+
+func (p *proxyConfig) contract() string {
+	if p.Contract != "" {
+		return p.Contract
+	}
+	return defaultProxyContracts[p.Kind]
+}
+
+// proxyDeployment links a proxy deployment to its implementation.
+type proxyDeployment struct {
+	Kind           string
+	Implementation common.Address
+
+	implementation *artifact
+}
+
+// implementationName is the registry name of a proxy's implementation.
+func implementationName(name string) string {
+	return name + "Implementation"
+}
+
+// deployProxied deploys spec's contract as an implementation and then a
+// proxy pointing at it that runs the initializer.
+func (r *networkRun) deployProxied(ctx context.Context, spec contractSpec) ([]*deployment, error) {
+	p := spec.Proxy
+	implSpec := spec
+	implSpec.Name = implementationName(spec.Name)
+	implSpec.Proxy = nil
+	implSpec.Value = ""
+
+	// Encode the initializer first so bad arguments fail before anything
+	// is sent.
+	var initData []byte
+	initNames := map[string]common.Address{}
+	if p.Initializer != "" {
+		art, err := r.loadArtifact(spec.Contract)
+		if err != nil {
+			return nil, err
+		}
+		args, err := r.ens.resolveMethodArgs(ctx, art.ABI, p.Initializer, p.Args, initNames)
+		if err != nil {
+			return nil, fmt.Errorf("initializer: %w", err)
+		}
+		if initData, err = encodeCall(art.ABI, p.Initializer, args); err != nil {
+			return nil, fmt.Errorf("initializer: %w", err)
+		}
+	}
+	impl, err := r.deploy(ctx, implSpec)
+	if err != nil {
+		if impl != nil {
+			return []*deployment{impl}, fmt.Errorf("implementation: %w", err)
+		}
+		return nil, fmt.Errorf("implementation: %w", err)
+	}
+	args := []interface{}{impl.Address.Hex(), hexutil.Encode(initData)}
+	if p.Kind == proxyTransparent {
+		owner := p.Owner
+		if owner == "" {
+			owner = r.from().Hex()
+		}
+		args = []interface{}{impl.Address.Hex(), owner, hexutil.Encode(initData)}
+	}
+
+	proxySpec := contractSpec{
+		Name:     spec.Name,
+		Contract: p.contract(),
+		Args:     args,
+		Value:    spec.Value,
+		Salt:     spec.Salt,
+		Gas:      spec.Gas,
+	}
+	proxy, err := r.deploy(ctx, proxySpec)
+	if proxy == nil {
+		return []*deployment{impl}, fmt.Errorf("proxy: %w", err)
+	}
+	proxy.Proxy = &proxyDeployment{Kind: p.Kind, Implementation: impl.Address, implementation: impl.artifact}
+	for name, addr := range initNames {
+		if proxy.ENS == nil {
+			proxy.ENS = map[string]common.Address{}
+		}
+		proxy.ENS[name] = addr
+	}
+	if err != nil {
+		err = fmt.Errorf("proxy: %w", err)
+	}
+	return []*deployment{impl, proxy}, err
+}
+
+// encodeCall ABI-encodes a call to method with loosely typed args. method
+// may be a bare name or a full signature such as
+// "initialize(address,uint256)" to pick one of several overloads.
+func encodeCall(contract abi.ABI, method string, args []interface{}) ([]byte, error) {
+	m, err := findMethod(contract, method)
+	if err != nil {
+		return nil, err
+	}
+	params, err := convertArgs(m.RawName, m.Inputs, args)
+	if err != nil {
+		return nil, err
+	}
+	packed, err := m.Inputs.Pack(params...)
+	if err != nil {
+		return nil, &encodingError{fmt.Errorf("%s: %w", m.Sig, err)}
+	}
+	return append(append([]byte{}, m.ID...), packed...), nil
+}
+
+func findMethod(contract abi.ABI, method string) (abi.Method, error) {
+	if m, ok := contract.Methods[method]; ok {
+		return m, nil
+	}
+	for _, m := range contract.Methods {
+		if m.Sig == method {
+			return m, nil
+		}
+	}
+	return abi.Method{}, &encodingError{fmt.Errorf("no method %q in ABI", method)}
+}
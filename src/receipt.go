@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	defaultConfirmations  = 1
+	defaultReceiptTimeout = 5 * time.Minute
+	receiptPollInterval   = 2 * time.Second
+)
+
+// waitBlock sleeps for d, or until a block arrives on heads.
+func waitBlock(ctx context.Context, heads <-chan *types.Header, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+	case <-heads:
+	}
+	return nil
+}
+
+// waitMined polls for hash's receipt until it is buried under the run's
+// confirmation depth, or the receipt timeout expires. Over WebSocket and
+// IPC it also checks on every new block instead of waiting out the poll
+// interval. A receipt with a failed status is returned together with an
+// error.
+func (r *networkRun) waitMined(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+	defer cancel()
+
+	metrics.add(metricTxPending, 1, "network", r.name)
+	defer metrics.add(metricTxPending, -1, "network", r.name)
+
+	heads, unsubscribe := subscribeHeads(ctx, r.client)
+	defer unsubscribe()
+
+	reported, checked := false, false
+	start := time.Now()
+	for {
+		receipt, err := r.client.TransactionReceipt(ctx, hash)
+		switch {
+		case err == nil:
+			head, err := r.client.BlockNumber(ctx)
+			if err != nil {
+				return nil, err
+			}
+			mined := receipt.BlockNumber.Uint64()
+			if head+1 >= mined+r.opts.Confirmations {
+				metrics.observe(metricConfirmDuration, time.Since(start).Seconds(), "network", r.name)
+				if receipt.Status != types.ReceiptStatusSuccessful {
+					metrics.add(metricTxConfirmed, 1, "network", r.name, "status", "reverted")
+					metrics.add(metricErrors, 1, "network", r.name, "kind", "revert")
+					return receipt, &revertError{err: fmt.Errorf("transaction %s reverted in block %d", hash.Hex(), mined)}
+				}
+				metrics.add(metricTxConfirmed, 1, "network", r.name, "status", "success")
+				return receipt, nil
+			}
+			if !reported {
+				logger.Info("Mined, waiting for confirmations", "tx", hash, "block", mined, "confirmations", r.opts.Confirmations)
+				reported = true
+			}
+		case !errors.Is(err, ethereum.NotFound):
+			return nil, err
+		case !checked && time.Since(start) > stuckAfter:
+			if err := r.checkStuck(ctx, hash); err != nil {
+				return nil, err
+			}
+			checked = true
+		}
+		if err := waitBlock(ctx, heads, receiptPollInterval); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				metrics.add(metricErrors, 1, "network", r.name, "kind", "timeout")
+				return nil, fmt.Errorf("transaction %s not confirmed after %s; it may still be mined", hash.Hex(), r.opts.Timeout)
+			}
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// sourceHash returns a hash of the sources the artifact was compiled
+// from: of the keccak256 of each that the compiler metadata lists, or
+// without metadata, of the contract's own source file. It is nil when
+// neither is available, as for prebuilt artifacts.
+func (a *artifact) sourceHash(root string) *common.Hash {
+	var h common.Hash
+	switch {
+	case a.Metadata != nil && len(a.Metadata.Sources) > 0:
+		paths := slices.Sorted(maps.Keys(a.Metadata.Sources))
+		var b strings.Builder
+		for _, path := range paths {
+			fmt.Fprintf(&b, "%s %s\n", path, a.Metadata.Sources[path].Keccak256)
+		}
+		h = crypto.Keccak256Hash([]byte(b.String()))
+	case a.Source != "":
+		raw, err := os.ReadFile(filepath.Join(root, a.Source))
+		if err != nil {
+			return nil
+		}
+		h = crypto.Keccak256Hash(raw)
+	default:
+		return nil
+	}
+	return &h
+}
+
+// referencedAddresses returns the addresses of the deployments spec's
+// arguments refer to, by name, as they are now.
+func (r *networkRun) referencedAddresses(spec contractSpec) (map[string]common.Address, error) {
+	names := references(spec.Args)
+	if p := spec.Proxy; p != nil {
+		names = append(names, references(p.Args)...)
+		names = append(names, references(p.Owner)...)
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	refs := make(map[string]common.Address, len(names))
+	for _, name := range names {
+		addr, err := r.resolveRef(name)
+		if err != nil {
+			return nil, err
+		}
+		refs[name] = addr
+	}
+	return refs, nil
+}
+
+// deployedRefs resolves placeholders as entry was deployed with them for
+// the dependencies with setters, which may have moved since without the
+// arguments changing, and to the current addresses otherwise.
+func (r *networkRun) deployedRefs(entry *registryEntry, setters map[string]setterSpec) func(string) (common.Address, error) {
+	return func(name string) (common.Address, error) {
+		if _, ok := setters[name]; ok {
+			if addr, ok := entry.References[name]; ok {
+				return addr, nil
+			}
+		}
+		return r.resolveRef(name)
+	}
+}
+
+// setterChange returns why the setter for dep needs calling on the
+// contract entry records, or "": dep is redeployed in this run, or was
+// since the contract was last pointed at it.
+func (r *networkRun) setterChange(dep string, entry *registryEntry, redeployed map[string]bool) string {
+	if redeployed[dep] {
+		return dep + " is redeployed"
+	}
+	points, ok := entry.Rewired[dep]
+	if !ok {
+		if points, ok = entry.References[dep]; !ok {
+			return ""
+		}
+	}
+	if addr, err := r.resolveRef(dep); err == nil && addr != points {
+		return fmt.Sprintf("points at %s, not %s's current %s", points.Hex(), dep, addr.Hex())
+	}
+	return ""
+}
+
+// planChanged works out, for deploy -changed, which of m's contracts to
+// deploy: those not in the registry, those whose sources, compiler
+// settings or arguments changed, and those whose arguments refer to a
+// contract deployed again, unless they have a setter for it. The setters
+// are checked against the ABIs before anything is sent.
+func (r *networkRun) planChanged(ctx context.Context, m *manifest) error {
+	changes, err := r.planContracts(ctx, m.Contracts)
+	if err != nil {
+		return err
+	}
+	r.changes = make(map[string]planChange, len(changes))
+	contracts := map[string]string{}
+	for _, spec := range m.Contracts {
+		contracts[spec.Name] = spec.Contract
+	}
+	resolve := r.pendingResolver(m.Contracts)
+	for i, c := range changes {
+		r.changes[c.Name] = c
+		switch c.Action {
+		case planCreate, planReplace:
+			logger.Info("Changed, deploying it", "network", r.name, "name", c.Name, "reason", strings.Join(c.Reasons, "; "))
+		case planNoChange:
+			logger.Info("Unchanged, keeping it", "network", r.name, "name", c.Name, "address", c.Address)
+		case planUpgrade:
+			logger.Warn("Implementation changed; keeping the proxy, upgrade it with the upgrade command", "network", r.name, "name", c.Name, "reason", strings.Join(c.Reasons, "; "))
+		default:
+			if len(c.Setters) == 0 {
+				logger.Warn("Proxy settings changed; keeping the proxy, which needs a call to apply them", "network", r.name, "name", c.Name, "reason", strings.Join(c.Reasons, "; "))
+			}
+			for _, dep := range c.Setters {
+				logger.Info("Keeping it, and updating its reference with a setter", "network", r.name, "name", c.Name, "dependency", dep, "method", m.Contracts[i].Setters[dep].Method)
+				if _, err := r.encodeCall(ctx, setterCall(m.Contracts[i], dep), contracts, resolve); err != nil {
+					return fmt.Errorf("%s: setters: %s: %w", c.Name, dep, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// setterCall is the call spec's setter for dep makes.
+func setterCall(spec contractSpec, dep string) callSpec {
+	s := spec.Setters[dep]
+	return callSpec{To: spec.Name, Contract: spec.Contract, Method: s.Method, Args: s.Args}
+}
+
+// keepStep takes a contract that deploy -changed leaves as it is from the
+// registry, as if it had been deployed again at the same address.
+func (r *networkRun) keepStep(ctx context.Context, spec contractSpec) ([]deployment, error) {
+	names := []string{spec.Name}
+	if spec.Proxy != nil {
+		names = []string{implementationName(spec.Name), spec.Name}
+	}
+	art, err := r.loadArtifact(spec.Contract)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", spec.Name, err)
+	}
+	var results []deployment
+	for _, name := range names {
+		e := r.registry.Contracts[name]
+		if e == nil {
+			return results, fmt.Errorf("%s: not in the registry", name)
+		}
+		d := &deployment{
+			Name:            name,
+			Contract:        e.Contract,
+			Address:         e.Address,
+			TxHash:          e.TxHash,
+			Deployer:        e.Deployer,
+			Args:            e.Args,
+			ConstructorArgs: e.EncodedArgs,
+			BlockNumber:     e.BlockNumber,
+			Skipped:         true,
+			artifact:        art,
+		}
+		if err := r.finish(ctx, d); err != nil {
+			return results, fmt.Errorf("%s: %w", name, err)
+		}
+		results = append(results, *d)
+	}
+	return results, nil
+}
+
+// runSetters points the contracts deploy -changed kept at the dependencies
+// it redeployed, and records what each now points at.
+func (r *networkRun) runSetters(ctx context.Context, m *manifest) error {
+	if r.changes == nil {
+		return nil
+	}
+	contracts := map[string]string{}
+	for _, spec := range m.Contracts {
+		contracts[spec.Name] = spec.Contract
+	}
+	for _, spec := range m.Contracts {
+		for _, dep := range r.changes[spec.Name].Setters {
+			label := spec.Name + "." + spec.Setters[dep].Method
+			call, err := r.encodeCall(ctx, setterCall(spec, dep), contracts, r.resolveRef)
+			if err != nil {
+				return fmt.Errorf("%s: %w", label, err)
+			}
+			sent, err := r.transact(ctx, txFields{To: &call.to, Value: call.value, Data: call.data, Label: label + "(" + describeArgs(call.abi, call.data, r.book) + ")"}, gasConfig{})
+			if err != nil && sent != nil && sent.Reverted {
+				err = r.explainRevert(err, call.abi, call.data)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", label, err)
+			}
+			r.reportCall(label, sent)
+			if r.opts.DryRun {
+				continue
+			}
+			addr, err := r.resolveRef(dep)
+			if err != nil {
+				return err
+			}
+			r.mu.Lock()
+			e := r.registry.Contracts[spec.Name]
+			if e.Rewired == nil {
+				e.Rewired = map[string]common.Address{}
+			}
+			e.Rewired[dep] = addr
+			err = r.registry.save()
+			r.mu.Unlock()
+			if err != nil {
+				return fmt.Errorf("record %s: %w", label, err)
+			}
+		}
+	}
+	return nil
+}
+
+// movedCalls returns the indexes of m's calls that deploy -changed makes:
+// those whose target or arguments refer to a contract deployed in this
+// run or the interrupted one it resumes.
+func (r *networkRun) movedCalls(m *manifest, state *runState) []int {
+	moved := func(name string) bool { return r.moved(name, state) }
+	var out []int
+	for i, c := range m.Calls {
+		names := append(references(c.Args), references(c.To)...)
+		names = append(names, c.To)
+		if slices.ContainsFunc(names, moved) {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// moved reports whether deploy -changed deploys the manifest contract name
+// in this run or deployed it in the interrupted one it resumes.
+func (r *networkRun) moved(name string, state *runState) bool {
+	c, ok := r.changes[name]
+	return ok && c.redeploys() || state.step(name) != nil
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// registry is the record of what has been deployed to one network, stored
+// as deployments/<network>.json in the project root so later runs and
+// scripts can look addresses up.
+type registry struct {
+	Network   string                    `json:"network"`
+	ChainID   uint64                    `json:"chainId"`
+	Contracts map[string]*registryEntry `json:"contracts"`
+
+	path string
+}
+
+// registryEntry describes one deployed contract, keyed in the registry by
+// its deployment name.
+type registryEntry struct {
+	Contract      string            `json:"contract"`
+	Source        string            `json:"source,omitempty"`
+	Address       common.Address    `json:"address"`
+	TxHash        common.Hash       `json:"txHash"`
+	BlockNumber   uint64            `json:"blockNumber,omitempty"`
+	BlockHash     *common.Hash      `json:"blockHash,omitempty"`
+	GasUsed       uint64            `json:"gasUsed,omitempty"`
+	Deployer      common.Address    `json:"deployer"`
+	Args          []interface{}     `json:"args"`
+	EncodedArgs   hexutil.Bytes     `json:"encodedArgs"`
+	Salt          *common.Hash      `json:"salt,omitempty"`
+	ABI           json.RawMessage   `json:"abi"`
+	Metadata      *compilerMetadata `json:"metadata,omitempty"`
+	StorageLayout json.RawMessage   `json:"storageLayout,omitempty"`
+	// Libraries are the linked library addresses, keyed path:Name.
+	Libraries map[string]common.Address `json:"libraries,omitempty"`
+	// CreationCodeHash is the keccak256 of the linked creation code,
+	// without constructor arguments, for reproduce to check against.
+	CreationCodeHash *common.Hash `json:"creationCodeHash,omitempty"`
+	// InitCodeHash is the keccak256 of the creation code with the
+	// constructor arguments, as sent, which deploy checks so as not to
+	// deploy the same contract twice.
+	InitCodeHash *common.Hash `json:"initCodeHash,omitempty"`
+	// SourceHash is the keccak256 of the contract's sources, for deploy
+	// -changed and plan to tell whether they changed; see sourceHash.
+	SourceHash *common.Hash `json:"sourceHash,omitempty"`
+	// Immutables are the immutable variables read back from the deployed
+	// code, by name.
+	Immutables map[string]string `json:"immutables,omitempty"`
+	// ENS maps ENS names used in the arguments, which Args keeps as
+	// written, to the addresses they resolved to at deployment.
+	ENS map[string]common.Address `json:"ens,omitempty"`
+	// References maps the deployments the arguments refer to as
+	// ${Name.address} to the addresses they had at deployment.
+	References map[string]common.Address `json:"references,omitempty"`
+	// Rewired maps the deployments that setter calls have since pointed
+	// the contract at to the addresses they were given.
+	Rewired map[string]common.Address `json:"rewired,omitempty"`
+	// Flattened is the single-file source of the code at Address, relative
+	// to the project root, for explorers that do not take standard JSON.
+	Flattened string `json:"flattened,omitempty"`
+	// Attestation is the signed provenance statement for the deployment,
+	// relative to the project root.
+	Attestation string `json:"attestation,omitempty"`
+	// Proxy is set when Address is a proxy; ABI and sources then describe
+	// the current implementation.
+	Proxy *proxyRecord `json:"proxy,omitempty"`
+	// Reorged is set when a reorg removed the deployment transaction after
+	// it was confirmed, leaving no contract at Address.
+	Reorged    *reorgRecord `json:"reorged,omitempty"`
+	DeployedAt time.Time    `json:"deployedAt"`
+}
+
+// reorgRecord describes the reorg that removed a deployment.
+type reorgRecord struct {
+	// Block and BlockHash are where the transaction had been mined.
+	Block      uint64      `json:"block"`
+	BlockHash  common.Hash `json:"blockHash"`
+	DetectedAt time.Time   `json:"detectedAt"`
+}
+
+// proxyRecord describes the proxy behind a registry entry.
+type proxyRecord struct {
+	Kind string `json:"kind"`
+	// Contract is the proxy contract itself, e.g. ERC1967Proxy.
+	Contract       string         `json:"contract"`
+	Implementation common.Address `json:"implementation"`
+	// Previous lists earlier implementations, oldest first.
+	Previous []common.Address `json:"previous,omitempty"`
+}
+
+func registryPath(root, network string) string {
+	return filepath.Join(root, "deployments", network+".json")
+}
+
+// loadRegistry reads the registry for network. A missing file yields an
+// empty registry.
+func loadRegistry(root, network string) (*registry, error) {
+	path := registryPath(root, network)
+	reg := &registry{Network: network, Contracts: map[string]*registryEntry{}, path: path}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return reg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, reg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if reg.Contracts == nil {
+		reg.Contracts = map[string]*registryEntry{}
+	}
+	reg.path = path
+	return reg, nil
+}
+
+// lookup returns the entry deployed under name.
+func (r *registry) lookup(name string) (*registryEntry, error) {
+	e, ok := r.Contracts[name]
+	if !ok {
+		// A contract deployed only under other names is looked up by one
+		// of them.
+		var aliases []string
+		for _, n := range r.names() {
+			if r.Contracts[n].Contract == name {
+				aliases = append(aliases, n)
+			}
+		}
+		if len(aliases) > 0 {
+			return nil, fmt.Errorf("%s is not in the %s registry under that name; it is deployed as %s", name, r.Network, strings.Join(aliases, ", "))
+		}
+		return nil, fmt.Errorf("%s is not in the %s registry (%s)", name, r.Network, r.path)
+	}
+	if e.Reorged != nil {
+		return nil, e.reorgedError(name)
+	}
+	return e, nil
+}
+
+// reorgedError reports that the deployment under name was removed by a
+// reorg, so there is no contract at its recorded address.
+func (e *registryEntry) reorgedError(name string) error {
+	return fmt.Errorf("%s at %s was removed by a reorg of block %d, detected %s; deploy it again", name, e.Address.Hex(), e.Reorged.Block, e.Reorged.DetectedAt.Format(time.RFC3339))
+}
+
+// byAddress returns the first deployment, by name, recorded at addr, or a
+// nil entry.
+func (r *registry) byAddress(addr common.Address) (string, *registryEntry) {
+	for _, name := range r.names() {
+		if e := r.Contracts[name]; e.Address == addr {
+			return name, e
+		}
+	}
+	return "", nil
+}
+
+// names returns the deployment names in the registry, sorted.
+func (r *registry) names() []string {
+	names := make([]string, 0, len(r.Contracts))
+	for name := range r.Contracts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// record stores e under name and writes the registry to disk.
+func (r *registry) record(name string, e *registryEntry) error {
+	r.Contracts[name] = e
+	return r.save()
+}
+
+// save writes the registry atomically so an interrupted run never leaves a
+// truncated file behind.
+func (r *registry) save() error {
+	raw, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(r.path, append(raw, '\n'))
+}
+
+// writeFileAtomic writes raw to path through a temporary file in the same
+// directory, renamed over path once complete.
+func writeFileAtomic(path string, raw []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// lookupAddress returns the address deployed under name on network.
+func lookupAddress(root, network, name string) (common.Address, error) {
+	reg, err := loadRegistry(root, network)
+	if err != nil {
+		return common.Address{}, err
+	}
+	e, err := reg.lookup(name)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return e.Address, nil
+}
+
+// loadRegistries reads every network's registry under root, in network
+// name order. Other files in deployments/ are skipped.
+func loadRegistries(root string) ([]*registry, error) {
+	paths, err := filepath.Glob(filepath.Join(root, "deployments", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var out []*registry
+	for _, path := range paths {
+		network := strings.TrimSuffix(filepath.Base(path), ".json")
+		if strings.HasPrefix(network, ".") || strings.Contains(network, ".") {
+			continue
+		}
+		reg, err := loadRegistry(root, network)
+		if err != nil {
+			return nil, err
+		}
+		// The gas report and the like have no contracts.
+		if len(reg.Contracts) > 0 {
+			out = append(out, reg)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// registryAPI serves the project's registries and audit log read-only. The
+// files are read on every request, so deployments show up without a
+// restart.
+type registryAPI struct {
+	root string
+}
+
+// apiNetwork is a registry in the /networks listing.
+type apiNetwork struct {
+	Network   string   `json:"network"`
+	ChainID   uint64   `json:"chainId"`
+	Contracts []string `json:"contracts"`
+}
+
+// apiAddress answers an address lookup.
+type apiAddress struct {
+	Network string         `json:"network"`
+	ChainID uint64         `json:"chainId"`
+	Name    string         `json:"name"`
+	Address common.Address `json:"address"`
+	// Implementation is set for proxies.
+	Implementation *common.Address `json:"implementation,omitempty"`
+}
+
+// apiError is the body of an error response.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+type apiStatusError struct {
+	status int
+	err    error
+}
+
+func (e *apiStatusError) Error() string { return e.err.Error() }
+
+func notFound(format string, args ...interface{}) error {
+	return &apiStatusError{http.StatusNotFound, fmt.Errorf(format, args...)}
+}
+
+// runServeRegistry serves the deployment registry over HTTP, so frontends
+// and services can look addresses and ABIs up by network or chain id.
+func runServeRegistry(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("serve-registry", flag.ContinueOnError)
+	addr := fs.String("addr", "127.0.0.1:8548", "address to serve on")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	regs, err := loadRegistries(root)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return fmt.Errorf("registry API: %w", err)
+	}
+	api := &registryAPI{root: root}
+	srv := &http.Server{Handler: api.handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	logger.Info("Serving the registry (Ctrl-C to stop)", "url", "http://"+ln.Addr().String()+"/networks", "networks", len(regs))
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// handler routes the API. Every /networks/{network} route is also served
+// under /chains/{chainId}:
+//
+//	GET /networks
+//	GET /networks/{network}
+//	GET /networks/{network}/contracts/{name}
+//	GET /networks/{network}/contracts/{name}/address
+//	GET /networks/{network}/contracts/{name}/abi
+//	GET /networks/{network}/contracts/{name}/history
+//	GET /networks/{network}/history
+func (a *registryAPI) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /networks", a.wrap(a.networks))
+	for _, prefix := range []string{"/networks/{network}", "/chains/{chain}"} {
+		mux.HandleFunc("GET "+prefix, a.wrap(a.registry))
+		mux.HandleFunc("GET "+prefix+"/contracts/{name}", a.wrap(a.contract))
+		mux.HandleFunc("GET "+prefix+"/contracts/{name}/address", a.wrap(a.address))
+		mux.HandleFunc("GET "+prefix+"/contracts/{name}/abi", a.wrap(a.abi))
+		mux.HandleFunc("GET "+prefix+"/contracts/{name}/history", a.wrap(a.history))
+		mux.HandleFunc("GET "+prefix+"/history", a.wrap(a.history))
+	}
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeAPIJSON(w, http.StatusMethodNotAllowed, apiError{"the registry API is read-only"})
+			return
+		}
+		writeAPIJSON(w, http.StatusNotFound, apiError{"no such endpoint; see GET /networks"})
+	})
+	return mux
+}
+
+// wrap writes a handler's result as JSON, or its error with the matching
+// status.
+func (a *registryAPI) wrap(h func(*http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v, err := h(r)
+		if err != nil {
+			status := http.StatusInternalServerError
+			var se *apiStatusError
+			if errors.As(err, &se) {
+				status = se.status
+			} else {
+				logger.Warn("Registry API request failed", "path", r.URL.Path, "err", err)
+			}
+			writeAPIJSON(w, status, apiError{err.Error()})
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, v)
+	}
+}
+
+func (a *registryAPI) networks(*http.Request) (interface{}, error) {
+	regs, err := loadRegistries(a.root)
+	if err != nil {
+		return nil, err
+	}
+	out := []apiNetwork{}
+	for _, reg := range regs {
+		out = append(out, apiNetwork{Network: reg.Network, ChainID: reg.ChainID, Contracts: reg.names()})
+	}
+	return out, nil
+}
+
+// lookup returns the registry the request's path names, by network or by
+// chain id.
+func (a *registryAPI) lookup(r *http.Request) (*registry, error) {
+	if network := r.PathValue("network"); network != "" {
+		if strings.ContainsAny(network, `/\.`) {
+			return nil, notFound("no network %s", network)
+		}
+		reg, err := loadRegistry(a.root, network)
+		if err != nil {
+			return nil, err
+		}
+		if len(reg.Contracts) == 0 {
+			return nil, notFound("no deployments on network %s", network)
+		}
+		return reg, nil
+	}
+	chain := r.PathValue("chain")
+	chainID, err := strconv.ParseUint(chain, 10, 64)
+	if err != nil {
+		return nil, &apiStatusError{http.StatusBadRequest, fmt.Errorf("chain id %q is not a number", chain)}
+	}
+	regs, err := loadRegistries(a.root)
+	if err != nil {
+		return nil, err
+	}
+	var matched []*registry
+	for _, reg := range regs {
+		if reg.ChainID == chainID {
+			matched = append(matched, reg)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return nil, notFound("no deployments on chain %d", chainID)
+	case 1:
+		return matched[0], nil
+	}
+	names := make([]string, len(matched))
+	for i, reg := range matched {
+		names[i] = reg.Network
+	}
+	return nil, &apiStatusError{http.StatusConflict, fmt.Errorf("chain %d has several registries (%s); ask by network", chainID, strings.Join(names, ", "))}
+}
+
+// entry returns the registry and the entry the request's path names.
+func (a *registryAPI) entry(r *http.Request) (*registry, *registryEntry, error) {
+	reg, err := a.lookup(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	name := r.PathValue("name")
+	e, ok := reg.Contracts[name]
+	if !ok {
+		return nil, nil, notFound("%s is not deployed on %s", name, reg.Network)
+	}
+	return reg, e, nil
+}
+
+func (a *registryAPI) registry(r *http.Request) (interface{}, error) {
+	return a.lookup(r)
+}
+
+func (a *registryAPI) contract(r *http.Request) (interface{}, error) {
+	_, e, err := a.entry(r)
+	return e, err
+}
+
+func (a *registryAPI) address(r *http.Request) (interface{}, error) {
+	reg, e, err := a.entry(r)
+	if err != nil {
+		return nil, err
+	}
+	if e.Reorged != nil {
+		return nil, &apiStatusError{http.StatusGone, e.reorgedError(r.PathValue("name"))}
+	}
+	out := apiAddress{Network: reg.Network, ChainID: reg.ChainID, Name: r.PathValue("name"), Address: e.Address}
+	if e.Proxy != nil {
+		out.Implementation = &e.Proxy.Implementation
+	}
+	return out, nil
+}
+
+func (a *registryAPI) abi(r *http.Request) (interface{}, error) {
+	_, e, err := a.entry(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.ABI) == 0 {
+		return nil, notFound("%s has no recorded ABI", r.PathValue("name"))
+	}
+	return e.ABI, nil
+}
+
+// history returns the audit log's transactions on the network, oldest
+// first, or only one deployment's: its creation and those sent to it.
+// ?limit=n keeps the last n.
+func (a *registryAPI) history(r *http.Request) (interface{}, error) {
+	reg, err := a.lookup(r)
+	if err != nil {
+		return nil, err
+	}
+	var entry *registryEntry
+	if name := r.PathValue("name"); name != "" {
+		e, ok := reg.Contracts[name]
+		if !ok {
+			return nil, notFound("%s is not deployed on %s", name, reg.Network)
+		}
+		entry = e
+	}
+	limit := 0
+	if s := r.URL.Query().Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 0 {
+			return nil, &apiStatusError{http.StatusBadRequest, fmt.Errorf("limit %q is not a count", s)}
+		}
+	}
+	q := auditQuery{Network: reg.Network, Limit: limit}
+	if entry != nil {
+		q.Contract, q.CreationTx = &entry.Address, entry.TxHash
+	}
+	records, err := queryAuditLog(auditLogPath(a.root), q)
+	if err != nil {
+		return nil, err
+	}
+	if records == nil {
+		records = []auditRecord{}
+	}
+	return records, nil
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	// Frontends are usually served from another origin.
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
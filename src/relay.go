@@ -0,0 +1,488 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// relayConfig has a relay service send a network's calls to contracts,
+// such as ownership transfers and governance transactions after the
+// deployments, for teams whose signer holds no gas on the chain.
+// Deployments are still sent by the signer.
+//
+//	networks:
+//	  polygon:
+//	    rpc: ${POLYGON_RPC_URL}
+//	    relay:
+//	      service: gelato                       # or defender
+//	      apiKey: ${secret:env:GELATO_API_KEY}
+//	      forwarder: 0x...                      # an ERC2771Forwarder the contracts trust
+//
+// With a forwarder, the signer signs each call as an ERC-2771 forward
+// request to an OpenZeppelin ERC2771Forwarder and the service submits it,
+// so the contracts see the signer as the sender. Without one, the
+// relayer's own account sends the calls and must be allowed to make them;
+// only defender relayers have an account to do that with. defender is the
+// OpenZeppelin Relayer API at url, for the relayer with the given id.
+type relayConfig struct {
+	Service string `yaml:"service"`
+	// URL is the service's API; it defaults to Gelato's for gelato.
+	URL    string `yaml:"url"`
+	APIKey string `yaml:"apiKey"`
+	// Relayer is the id of the defender relayer.
+	Relayer   string `yaml:"relayer"`
+	Forwarder string `yaml:"forwarder"`
+	// Deadline is how long a forward request can be executed for after it
+	// is signed; it defaults to an hour.
+	Deadline time.Duration `yaml:"deadline"`
+}
+
+// Relay services.
+const (
+	relayGelato   = "gelato"
+	relayDefender = "defender"
+)
+
+const (
+	gelatoAPI = "https://api.gelato.digital"
+
+	relayPollInterval    = 3 * time.Second
+	defaultRelayDeadline = time.Hour
+
+	// forwarderGas is what the forwarder spends around the call it
+	// executes: recovering the signer, its nonce and the call's overhead.
+	forwarderGas = 60_000
+)
+
+func (c *relayConfig) validate() error {
+	switch c.Service {
+	case relayGelato:
+		if c.Forwarder == "" {
+			return errors.New("gelato needs a forwarder: its sponsored calls come from Gelato's own contracts")
+		}
+	case relayDefender:
+		if c.URL == "" || c.Relayer == "" {
+			return errors.New("defender needs the relayer's url and id")
+		}
+	default:
+		return fmt.Errorf("unknown service %q (want %s or %s)", c.Service, relayGelato, relayDefender)
+	}
+	if c.APIKey == "" {
+		return errors.New("apiKey is required")
+	}
+	if c.Forwarder != "" {
+		if _, err := parseAddress(c.Forwarder); err != nil {
+			return fmt.Errorf("forwarder: %w", err)
+		}
+	}
+	if c.Deadline < 0 {
+		return errors.New("deadline must not be negative")
+	}
+	return nil
+}
+
+var (
+	forwardRequestTuple = `{"name":"request","type":"tuple","components":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"value","type":"uint256"},{"name":"gas","type":"uint256"},{"name":"deadline","type":"uint48"},{"name":"data","type":"bytes"},{"name":"signature","type":"bytes"}]}`
+	forwarderABI        = mustParseABI(`[
+		{"type":"function","name":"nonces","inputs":[{"name":"owner","type":"address"}],"outputs":[{"type":"uint256"}],"stateMutability":"view"},
+		{"type":"function","name":"eip712Domain","inputs":[],"outputs":[{"name":"fields","type":"bytes1"},{"name":"name","type":"string"},{"name":"version","type":"string"},{"name":"chainId","type":"uint256"},{"name":"verifyingContract","type":"address"},{"name":"salt","type":"bytes32"},{"name":"extensions","type":"uint256[]"}],"stateMutability":"view"},
+		{"type":"function","name":"verify","inputs":[` + forwardRequestTuple + `],"outputs":[{"type":"bool"}],"stateMutability":"view"},
+		{"type":"function","name":"execute","inputs":[` + forwardRequestTuple + `],"outputs":[],"stateMutability":"payable"}
+	]`)
+	trustedForwarderABI = mustParseABI(`[{"type":"function","name":"isTrustedForwarder","inputs":[{"name":"forwarder","type":"address"}],"outputs":[{"type":"bool"}],"stateMutability":"view"}]`)
+)
+
+// forwardRequestData is ERC2771Forwarder's signed ForwardRequestData.
+type forwardRequestData struct {
+	From      common.Address
+	To        common.Address
+	Value     *big.Int
+	Gas       *big.Int
+	Deadline  *big.Int
+	Data      []byte
+	Signature []byte
+}
+
+// relayClient submits calls to one relay service.
+type relayClient struct {
+	service string
+	url     string
+	apiKey  string
+	relayer string
+	http    *http.Client
+
+	// forwarder is the ERC-2771 forwarder the calls go through, if any,
+	// with its EIP-712 domain.
+	forwarder *boundContract
+	domain    apitypes.TypedDataDomain
+	deadline  time.Duration
+	// trusted caches the targets known to trust the forwarder.
+	trusted map[common.Address]bool
+	// address is the defender relayer's account, which sends the calls
+	// when there is no forwarder.
+	address common.Address
+
+	// mu serializes the calls: forward requests from one signer take
+	// consecutive nonces.
+	mu sync.Mutex
+}
+
+// openRelay checks that the service relays on the network and reads the
+// forwarder's EIP-712 domain.
+func (r *networkRun) openRelay(ctx context.Context, c relayConfig) (*relayClient, error) {
+	rc := &relayClient{
+		service:  c.Service,
+		url:      strings.TrimSuffix(os.ExpandEnv(c.URL), "/"),
+		apiKey:   os.ExpandEnv(c.APIKey),
+		relayer:  c.Relayer,
+		http:     &http.Client{Timeout: 30 * time.Second},
+		deadline: c.Deadline,
+		trusted:  map[common.Address]bool{},
+	}
+	if rc.deadline == 0 {
+		rc.deadline = defaultRelayDeadline
+	}
+	chainID := r.chainID.String()
+	switch rc.service {
+	case relayGelato:
+		if rc.url == "" {
+			rc.url = gelatoAPI
+		}
+		var relays struct {
+			Relays []string `json:"relays"`
+		}
+		if err := rc.do(ctx, http.MethodGet, "/relays/v2/relays", nil, &relays); err != nil {
+			return nil, err
+		}
+		if !slices.Contains(relays.Relays, chainID) {
+			return nil, fmt.Errorf("Gelato does not relay on chain %s", chainID)
+		}
+	case relayDefender:
+		var res struct {
+			Data struct {
+				Address common.Address `json:"address"`
+				Paused  bool           `json:"paused"`
+			} `json:"data"`
+		}
+		if err := rc.do(ctx, http.MethodGet, "/api/v1/relayers/"+rc.relayer, nil, &res); err != nil {
+			return nil, err
+		}
+		if res.Data.Paused {
+			return nil, fmt.Errorf("relayer %s is paused", rc.relayer)
+		}
+		rc.address = res.Data.Address
+	}
+	if c.Forwarder == "" {
+		return rc, nil
+	}
+	if _, ok := r.sender.(messageSigner); !ok {
+		return nil, errors.New("the signer cannot sign EIP-712 data, which forward requests are; use an env, keystore, mnemonic, node or hardware signer")
+	}
+	addr, _ := parseAddress(c.Forwarder)
+	rc.forwarder = &boundContract{Address: addr, ABI: forwarderABI, client: r.client}
+	out, err := rc.forwarder.Call(ctx, "eip712Domain")
+	if err != nil {
+		return nil, fmt.Errorf("%s does not look like an ERC2771Forwarder: %w", addr.Hex(), err)
+	}
+	rc.domain = apitypes.TypedDataDomain{
+		Name:              out[1].(string),
+		Version:           out[2].(string),
+		ChainId:           (*math.HexOrDecimal256)(r.chainID),
+		VerifyingContract: addr.Hex(),
+	}
+	return rc, nil
+}
+
+// relayed reports whether fields go through the relay: calls do, contract
+// creations are sent by the signer.
+func (r *networkRun) relayed(fields txFields) bool {
+	return r.relay != nil && fields.To != nil
+}
+
+// sender is whom the relayed calls come from, as the contracts see it.
+func (c *relayClient) sender(r *networkRun) common.Address {
+	if c.forwarder == nil {
+		return c.address
+	}
+	return r.sender.Address()
+}
+
+// submit has the service send the call in fields, wrapped in a forward
+// request signed by the signer when there is a forwarder, and waits until
+// it is mined. gas is the call's own limit. It returns the mined
+// transaction and the service's id for it.
+func (c *relayClient) submit(ctx context.Context, r *networkRun, fields txFields, gas uint64) (*sentTx, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value := fields.Value
+	if value == nil {
+		value = new(big.Int)
+	}
+	if value.Sign() > 0 && c.service == relayGelato {
+		return nil, "", errors.New("Gelato's sponsored calls cannot send value; send it from the signer instead")
+	}
+	to, data, limit := *fields.To, fields.Data, gas
+	if c.forwarder != nil {
+		req, err := c.forwardRequest(ctx, r, fields, value, gas)
+		if err != nil {
+			return nil, "", err
+		}
+		if data, err = forwarderABI.Pack("execute", req); err != nil {
+			return nil, "", err
+		}
+		to, limit = c.forwarder.Address, gas+forwarderGas+16*uint64(len(fields.Data))
+	}
+
+	var task string
+	switch c.service {
+	case relayGelato:
+		body := map[string]interface{}{
+			"chainId":       r.chainID.String(),
+			"target":        to.Hex(),
+			"data":          hexutil.Encode(data),
+			"sponsorApiKey": c.apiKey,
+		}
+		var res struct {
+			TaskID string `json:"taskId"`
+		}
+		if err := c.do(ctx, http.MethodPost, "/relays/v2/sponsored-call", body, &res); err != nil {
+			return nil, "", fmt.Errorf("relay: %w", err)
+		}
+		task = res.TaskID
+	case relayDefender:
+		body := map[string]interface{}{
+			"to":        to.Hex(),
+			"value":     value,
+			"data":      hexutil.Encode(data),
+			"gas_limit": limit,
+			"speed":     "fast",
+		}
+		var res struct {
+			Data struct {
+				ID string `json:"id"`
+			} `json:"data"`
+		}
+		if err := c.do(ctx, http.MethodPost, "/api/v1/relayers/"+c.relayer+"/transactions", body, &res); err != nil {
+			return nil, "", fmt.Errorf("relay: %w", err)
+		}
+		task = res.Data.ID
+	}
+	logger.Info("Relayed transaction", "network", r.name, "service", c.service, "task", task, "to", fields.To)
+
+	hash, err := c.waitSent(ctx, r, task)
+	if hash == (common.Hash{}) {
+		return nil, task, err
+	}
+	sent := &sentTx{Hash: hash}
+	if err != nil {
+		sent.Reverted = true
+		return sent, task, err
+	}
+	if r.opts.Confirmations > 0 {
+		sent.Receipt, err = r.waitMined(ctx, hash)
+		if sent.Receipt != nil && sent.Receipt.Status != types.ReceiptStatusSuccessful {
+			sent.Reverted = true
+		}
+	}
+	return sent, task, err
+}
+
+// forwardRequest signs fields as a forward request from the signer,
+// checking first that the target trusts the forwarder, and that the
+// forwarder accepts the request, since a rejected one only fails once the
+// service executes it.
+func (c *relayClient) forwardRequest(ctx context.Context, r *networkRun, fields txFields, value *big.Int, gas uint64) (forwardRequestData, error) {
+	to, from := *fields.To, r.sender.Address()
+	if !c.trusted[to] {
+		target := &boundContract{Address: to, ABI: trustedForwarderABI, client: r.client}
+		out, err := target.callMethod(ctx, "isTrustedForwarder", c.forwarder.Address)
+		if err != nil {
+			return forwardRequestData{}, fmt.Errorf("%s does not support ERC-2771 (no isTrustedForwarder): %w", to.Hex(), err)
+		}
+		if !out[0].(bool) {
+			return forwardRequestData{}, fmt.Errorf("%s does not trust the forwarder %s", to.Hex(), c.forwarder.Address.Hex())
+		}
+		c.trusted[to] = true
+	}
+	out, err := c.forwarder.callMethod(ctx, "nonces", from)
+	if err != nil {
+		return forwardRequestData{}, fmt.Errorf("forwarder: %w", err)
+	}
+	nonce := out[0].(*big.Int)
+	req := forwardRequestData{
+		From:     from,
+		To:       to,
+		Value:    value,
+		Gas:      new(big.Int).SetUint64(gas),
+		Deadline: big.NewInt(time.Now().Add(c.deadline).Unix()),
+		Data:     fields.Data,
+	}
+	typed := apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+				{Name: "verifyingContract", Type: "address"},
+			},
+			"ForwardRequest": {
+				{Name: "from", Type: "address"},
+				{Name: "to", Type: "address"},
+				{Name: "value", Type: "uint256"},
+				{Name: "gas", Type: "uint256"},
+				{Name: "nonce", Type: "uint256"},
+				{Name: "deadline", Type: "uint48"},
+				{Name: "data", Type: "bytes"},
+			},
+		},
+		PrimaryType: "ForwardRequest",
+		Domain:      c.domain,
+		Message: apitypes.TypedDataMessage{
+			"from":     from.Hex(),
+			"to":       to.Hex(),
+			"value":    hexutil.EncodeBig(value),
+			"gas":      hexutil.EncodeUint64(gas),
+			"nonce":    hexutil.EncodeBig(nonce),
+			"deadline": hexutil.EncodeBig(req.Deadline),
+			"data":     hexutil.Encode(fields.Data),
+		},
+	}
+	if req.Signature, err = r.sender.(messageSigner).SignTypedData(ctx, typed); err != nil {
+		return forwardRequestData{}, fmt.Errorf("sign: %w", err)
+	}
+	out, err = c.forwarder.callMethod(ctx, "verify", req)
+	if err != nil {
+		return forwardRequestData{}, fmt.Errorf("forwarder: %w", err)
+	}
+	if !out[0].(bool) {
+		return forwardRequestData{}, fmt.Errorf("the forwarder %s rejects the signed request (domain %q version %q)", c.forwarder.Address.Hex(), c.domain.Name, c.domain.Version)
+	}
+	return req, nil
+}
+
+// waitSent polls the service until the task's transaction is mined and
+// returns its hash. A task whose transaction reverted returns the hash
+// with an error.
+func (c *relayClient) waitSent(ctx context.Context, r *networkRun, task string) (common.Hash, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+	defer cancel()
+	seen := ""
+	for {
+		var (
+			state  string
+			hash   *common.Hash
+			reason string
+			err    error
+		)
+		switch c.service {
+		case relayGelato:
+			var res struct {
+				Task struct {
+					TaskState        string       `json:"taskState"`
+					TransactionHash  *common.Hash `json:"transactionHash"`
+					LastCheckMessage string       `json:"lastCheckMessage"`
+				} `json:"task"`
+			}
+			err = c.do(ctx, http.MethodGet, "/tasks/status/"+task, nil, &res)
+			state, hash, reason = res.Task.TaskState, res.Task.TransactionHash, res.Task.LastCheckMessage
+			switch state {
+			case "ExecSuccess":
+				if hash != nil {
+					return *hash, nil
+				}
+			case "ExecReverted":
+				state = "reverted"
+			case "Cancelled":
+				state = "failed"
+			}
+		case relayDefender:
+			var res struct {
+				Data struct {
+					Status       string       `json:"status"`
+					Hash         *common.Hash `json:"hash"`
+					StatusReason string       `json:"status_reason"`
+				} `json:"data"`
+			}
+			err = c.do(ctx, http.MethodGet, "/api/v1/relayers/"+c.relayer+"/transactions/"+task, nil, &res)
+			state, hash, reason = res.Data.Status, res.Data.Hash, res.Data.StatusReason
+			switch state {
+			case "mined", "confirmed":
+				if hash != nil {
+					return *hash, nil
+				}
+			case "canceled", "expired":
+				state = "failed"
+			}
+		}
+		if err != nil {
+			return common.Hash{}, fmt.Errorf("relay: %w", err)
+		}
+		switch state {
+		case "reverted":
+			if hash == nil {
+				return common.Hash{}, fmt.Errorf("relayed task %s reverted: %s", task, reason)
+			}
+			return *hash, fmt.Errorf("relayed task %s reverted in %s: %s", task, hash.Hex(), reason)
+		case "failed":
+			return common.Hash{}, fmt.Errorf("relayed task %s failed: %s", task, reason)
+		}
+		if state != seen {
+			logger.Info("Waiting for the relayer", "network", r.name, "task", task, "state", state)
+			seen = state
+		}
+		if err := sleepCtx(ctx, relayPollInterval); err != nil {
+			return common.Hash{}, fmt.Errorf("relayed task %s not mined: %w", task, err)
+		}
+	}
+}
+
+func (c *relayClient) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, payload)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.service == relayDefender {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", c.service, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s: %s: %s", c.service, resp.Status, bytes.TrimSpace(msg))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%s: decode response: %w", c.service, err)
+	}
+	return nil
+}
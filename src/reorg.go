@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// watchReorgs follows the chain after a run until opts.ReorgDepth blocks
+// are built on the block of each of its deployments, checking on every
+// block that the deployment transaction is still where its receipt put
+// it. A transaction a reorg moves to another block only updates the
+// registry; one the reorg drops, and that is not mined again before the
+// watch ends, leaves no contract behind, so its registry entry is marked
+// reorged and the run fails instead of reporting the address.
+//
+// Safe and user operation deployments are not watched: their recorded
+// hash is not the transaction that created the contract.
+func (r *networkRun) watchReorgs(ctx context.Context, deployed []deployment) error {
+	if r.opts.ReorgDepth == 0 || r.safe != nil || r.userOp != nil {
+		return nil
+	}
+	var watched []*deployment
+	var until uint64
+	for i := range deployed {
+		d := &deployed[i]
+		if d.BlockHash == (common.Hash{}) {
+			continue
+		}
+		watched = append(watched, d)
+		until = max(until, d.BlockNumber+r.opts.ReorgDepth)
+	}
+	if len(watched) == 0 {
+		return nil
+	}
+	logger.Info("Watching deployments for reorgs", "network", r.name, "deployments", len(watched), "until", until)
+
+	heads, unsubscribe := subscribeHeads(ctx, r.client)
+	defer unsubscribe()
+	hashes := make([]common.Hash, len(watched))
+	for i, d := range watched {
+		hashes[i] = d.TxHash
+	}
+	// gone holds the deployments whose transactions are not in the chain,
+	// with the block they had been mined in.
+	gone := map[*deployment]reorgRecord{}
+	var head, last uint64
+	lastSeen := time.Now()
+	for {
+		var err error
+		if head, err = r.client.BlockNumber(ctx); err != nil {
+			return err
+		}
+		if head != last {
+			last, lastSeen = head, time.Now()
+		}
+		receipts, err := batchReceipts(ctx, r.client, hashes)
+		if err != nil {
+			return err
+		}
+		for i, d := range watched {
+			receipt := receipts[i]
+			switch {
+			case receipt == nil || receipt.Status != types.ReceiptStatusSuccessful:
+				if _, ok := gone[d]; !ok {
+					logger.Warn("Deployment transaction is no longer in the chain; a reorg may have removed it", "network", r.name, "name", d.Name, "tx", d.TxHash, "block", d.BlockNumber)
+					gone[d] = reorgRecord{Block: d.BlockNumber, BlockHash: d.BlockHash}
+				}
+			case receipt.BlockHash != d.BlockHash:
+				logger.Warn("A reorg moved the deployment transaction to another block", "network", r.name, "name", d.Name, "tx", d.TxHash, "from", d.BlockNumber, "to", receipt.BlockNumber)
+				delete(gone, d)
+				d.BlockNumber, d.BlockHash = receipt.BlockNumber.Uint64(), receipt.BlockHash
+				if err := r.updateBlock(d); err != nil {
+					return err
+				}
+				until = max(until, d.BlockNumber+r.opts.ReorgDepth)
+			default:
+				if _, ok := gone[d]; ok {
+					logger.Info("Deployment transaction is back in the chain", "network", r.name, "name", d.Name, "tx", d.TxHash)
+					delete(gone, d)
+				}
+			}
+		}
+		if head >= until {
+			break
+		}
+		if time.Since(lastSeen) > r.opts.Timeout {
+			logger.Warn("No new blocks; stopped watching for reorgs early", "network", r.name, "head", head, "until", until, "waited", r.opts.Timeout)
+			break
+		}
+		if err := waitBlock(ctx, heads, receiptPollInterval); err != nil {
+			return err
+		}
+	}
+	if len(gone) == 0 {
+		logger.Info("No reorgs removed the deployments", "network", r.name, "head", head)
+		return nil
+	}
+
+	var names []string
+	for _, d := range watched {
+		rec, ok := gone[d]
+		if !ok {
+			continue
+		}
+		if code, err := r.client.CodeAt(ctx, d.Address, nil); err == nil && len(code) > 0 {
+			// Another transaction created the contract after all.
+			continue
+		}
+		rec.DetectedAt = time.Now().UTC()
+		if err := r.markReorged(d.Name, rec); err != nil {
+			return err
+		}
+		metrics.add(metricErrors, 1, "network", r.name, "kind", "reorg")
+		logger.Error("A reorg removed the deployment", "network", r.name, "name", d.Name, "address", d.Address, "block", rec.Block)
+		names = append(names, d.Name)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return fmt.Errorf("a reorg removed the deployments of %s; they are marked reorged in the registry, deploy again to replace them", strings.Join(names, ", "))
+}
+
+// updateBlock records the block a reorg moved d's transaction to.
+func (r *networkRun) updateBlock(d *deployment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.registry.Contracts[d.Name]
+	if !ok || e.TxHash != d.TxHash {
+		return nil
+	}
+	hash := d.BlockHash
+	e.BlockNumber, e.BlockHash = d.BlockNumber, &hash
+	return r.registry.save()
+}
+
+// markReorged marks the registry entry for name as removed by a reorg.
+func (r *networkRun) markReorged(name string, rec reorgRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.registry.Contracts[name]
+	if !ok {
+		return nil
+	}
+	e.Reorged = &rec
+	return r.registry.save()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// identicalDeployment looks the registry up for a contract deployed from
+// the same creation code and constructor arguments as spec's, which
+// deploying would only duplicate. It returns the existing contract as a
+// skipped deployment of spec, or nil if there is none still on chain.
+// Entries recorded before init code hashes were are matched by their
+// creation code hash and encoded arguments.
+func (r *networkRun) identicalDeployment(ctx context.Context, spec contractSpec, art *artifact, code []byte, codeHash common.Hash) (*deployment, error) {
+	args := code[len(art.Bytecode):]
+	bareHash := crypto.Keccak256Hash(art.Bytecode)
+	r.mu.Lock()
+	names := sortedKeys(r.registry.Contracts)
+	var candidates []string
+	for _, name := range names {
+		e := r.registry.Contracts[name]
+		if e.Reorged != nil {
+			continue
+		}
+		same := e.InitCodeHash != nil && *e.InitCodeHash == codeHash
+		if e.InitCodeHash == nil && e.Proxy == nil && e.CreationCodeHash != nil {
+			same = *e.CreationCodeHash == bareHash && bytes.Equal(e.EncodedArgs, args)
+		}
+		if !same {
+			continue
+		}
+		// The entry under spec's own name comes first.
+		if name == spec.Name {
+			candidates = append([]string{name}, candidates...)
+		} else {
+			candidates = append(candidates, name)
+		}
+	}
+	entries := make([]registryEntry, len(candidates))
+	for i, name := range candidates {
+		entries[i] = *r.registry.Contracts[name]
+	}
+	r.mu.Unlock()
+
+	for i, e := range entries {
+		onChain, err := r.client.CodeAt(ctx, e.Address, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(onChain) == 0 {
+			// A registry from before the node was reset, say.
+			logger.Debug("Identical deployment has no code on chain", "name", candidates[i], "address", e.Address)
+			continue
+		}
+		logger.Info("Identical contract already deployed, reusing it; pass -force-redeploy to deploy another", "network", r.name, "name", spec.Name, "existing", candidates[i], "address", e.Address)
+		return &deployment{
+			Name:            spec.Name,
+			Contract:        art.Name,
+			Address:         e.Address,
+			TxHash:          e.TxHash,
+			Deployer:        e.Deployer,
+			Args:            spec.Args,
+			ConstructorArgs: args,
+			BlockNumber:     e.BlockNumber,
+			Skipped:         true,
+			CodeHash:        codeHash,
+			artifact:        art,
+		}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// reportConfig writes a human-readable report at the end of each deploy
+// run, for pasting into a pull request or a governance forum post:
+//
+//	report:
+//	  file: reports/deploy.md           # .html for an HTML page
+//	  template: reports/forum.md.tmpl   # default: the built-in one
+//	  lang: de
+//
+// Templates are Go text/template, or html/template for HTML, executed with
+// a runReport. Lang picks the language of the built-in templates and of
+// the t function, and how numbers are written.
+type reportConfig struct {
+	// File is where the report is written, relative to the project root.
+	File string `yaml:"file"`
+	// Format is markdown or html; it defaults from File's extension.
+	Format string `yaml:"format"`
+	// Template is a template file relative to the project root.
+	Template string `yaml:"template"`
+	// Lang is en (default), de, es or fr.
+	Lang string `yaml:"lang"`
+}
+
+const (
+	reportMarkdown = "markdown"
+	reportHTML     = "html"
+)
+
+func (c *reportConfig) validate() error {
+	if c.File == "" {
+		return errors.New("file is required")
+	}
+	switch c.format() {
+	case reportMarkdown, reportHTML:
+	default:
+		return fmt.Errorf("unknown format %q (want markdown or html)", c.Format)
+	}
+	if _, ok := reportLocales[c.lang()]; !ok {
+		return fmt.Errorf("unknown lang %q (want %s)", c.Lang, strings.Join(sortedKeys(reportLocales), ", "))
+	}
+	return nil
+}
+
+func (c *reportConfig) format() string {
+	if c.Format != "" {
+		return c.Format
+	}
+	switch strings.ToLower(filepath.Ext(c.File)) {
+	case ".html", ".htm":
+		return reportHTML
+	}
+	return reportMarkdown
+}
+
+func (c *reportConfig) lang() string {
+	if c.Lang == "" {
+		return "en"
+	}
+	return c.Lang
+}
+
+// runReport is what report templates are executed with: the -output json
+// document, plus where the run came from.
+type runReport struct {
+	deployReport
+	Manifest    string
+	Profile     string
+	Lang        string
+	GeneratedAt time.Time
+}
+
+// reportLocale is how a language writes the report. Messages translate
+// the built-in templates' English text; a missing one is left in English.
+type reportLocale struct {
+	group, decimal string
+	messages       map[string]string
+}
+
+var reportLocales = map[string]reportLocale{
+	"en": {group: ",", decimal: "."},
+	"de": {group: ".", decimal: ",", messages: map[string]string{
+		"Deployment report":              "Deployment-Bericht",
+		"Dry run: nothing was broadcast": "Probelauf: nichts wurde gesendet",
+		"Generated":                      "Erstellt",
+		"Manifest":                       "Manifest",
+		"Profile":                        "Profil",
+		"chain":                          "Chain",
+		"Failed":                         "Fehlgeschlagen",
+		"No deployments":                 "Keine Deployments",
+		"Contract":                       "Vertrag",
+		"Address":                        "Adresse",
+		"Transaction":                    "Transaktion",
+		"Gas used":                       "Verbrauchtes Gas",
+		"Estimated gas":                  "Geschätztes Gas",
+		"Verification":                   "Verifizierung",
+		"verified":                       "verifiziert",
+		"not verified":                   "nicht verifiziert",
+		"already deployed":               "bereits deployt",
+		"not broadcast":                  "nicht gesendet",
+		"Implementation":                 "Implementierung",
+		"Gas cost":                       "Gaskosten",
+		"Network":                        "Netzwerk",
+		"Total":                          "Gesamt",
+	}},
+	"es": {group: ".", decimal: ",", messages: map[string]string{
+		"Deployment report":              "Informe de despliegue",
+		"Dry run: nothing was broadcast": "Simulación: no se envió nada",
+		"Generated":                      "Generado",
+		"Manifest":                       "Manifiesto",
+		"Profile":                        "Perfil",
+		"chain":                          "cadena",
+		"Failed":                         "Falló",
+		"No deployments":                 "Sin despliegues",
+		"Contract":                       "Contrato",
+		"Address":                        "Dirección",
+		"Transaction":                    "Transacción",
+		"Gas used":                       "Gas usado",
+		"Estimated gas":                  "Gas estimado",
+		"Verification":                   "Verificación",
+		"verified":                       "verificado",
+		"not verified":                   "no verificado",
+		"already deployed":               "ya desplegado",
+		"not broadcast":                  "no enviado",
+		"Implementation":                 "Implementación",
+		"Gas cost":                       "Coste de gas",
+		"Network":                        "Red",
+		"Total":                          "Total",
+	}},
+	"fr": {group: "\u202f", decimal: ",", messages: map[string]string{
+		"Deployment report":              "Rapport de déploiement",
+		"Dry run: nothing was broadcast": "Simulation : rien n'a été diffusé",
+		"Generated":                      "Généré le",
+		"Manifest":                       "Manifeste",
+		"Profile":                        "Profil",
+		"chain":                          "chaîne",
+		"Failed":                         "Échec",
+		"No deployments":                 "Aucun déploiement",
+		"Contract":                       "Contrat",
+		"Address":                        "Adresse",
+		"Transaction":                    "Transaction",
+		"Gas used":                       "Gaz utilisé",
+		"Estimated gas":                  "Gaz estimé",
+		"Verification":                   "Vérification",
+		"verified":                       "vérifié",
+		"not verified":                   "non vérifié",
+		"already deployed":               "déjà déployé",
+		"not broadcast":                  "non diffusé",
+		"Implementation":                 "Implémentation",
+		"Gas cost":                       "Coût du gaz",
+		"Network":                        "Réseau",
+		"Total":                          "Total",
+	}},
+}
+
+// reportTemplate is a parsed report template, loaded before the run so a
+// broken one fails before anything is sent.
+type reportTemplate struct {
+	config  reportConfig
+	path    string
+	execute func(io.Writer, interface{}) error
+}
+
+func loadReportTemplate(root string, c reportConfig) (*reportTemplate, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	locale := reportLocales[c.lang()]
+	name, text := "report", builtinMarkdownReport
+	if c.format() == reportHTML {
+		text = builtinHTMLReport
+	}
+	if c.Template != "" {
+		raw, err := os.ReadFile(filepath.Join(root, c.Template))
+		if err != nil {
+			return nil, err
+		}
+		name, text = filepath.Base(c.Template), string(raw)
+	}
+	rt := &reportTemplate{config: c, path: filepath.Join(root, c.File)}
+	if c.format() == reportHTML {
+		t, err := htmltemplate.New(name).Funcs(locale.funcs(true)).Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		rt.execute = t.Execute
+	} else {
+		t, err := template.New(name).Funcs(locale.funcs(false)).Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		rt.execute = t.Execute
+	}
+	return rt, nil
+}
+
+// write renders report to the configured file.
+func (rt *reportTemplate) write(m *manifest, report deployReport) error {
+	data := runReport{
+		deployReport: report,
+		Manifest:     m.path,
+		Profile:      m.profile,
+		Lang:         rt.config.lang(),
+		GeneratedAt:  time.Now().UTC(),
+	}
+	var out bytes.Buffer
+	if err := rt.execute(&out, data); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(rt.path, out.Bytes()); err != nil {
+		return err
+	}
+	logger.Info("Wrote the deployment report", "file", rt.config.File)
+	return nil
+}
+
+// funcs are the template functions, which write for l. With html set,
+// code and link return markup html/template leaves as is.
+func (l reportLocale) funcs(html bool) map[string]interface{} {
+	funcs := map[string]interface{}{
+		"t": func(s string) string {
+			if m, ok := l.messages[s]; ok {
+				return m
+			}
+			return s
+		},
+		"number": l.number,
+		// ether formats a wei amount, as a string or *big.Int.
+		"ether": func(v interface{}) string {
+			wei, ok := new(big.Int), false
+			switch v := v.(type) {
+			case string:
+				_, ok = wei.SetString(v, 10)
+			case *big.Int:
+				wei, ok = v, v != nil
+			}
+			if !ok {
+				return "–"
+			}
+			amount, unit, _ := strings.Cut(formatEther(wei), " ")
+			return l.number(amount) + " " + unit
+		},
+		"date": func(t time.Time) string {
+			return t.UTC().Format("2006-01-02 15:04 UTC")
+		},
+		// short abbreviates a hash or address to its first and last bytes.
+		"short": func(s string) string {
+			if len(s) <= 14 {
+				return s
+			}
+			return s[:8] + "…" + s[len(s)-6:]
+		},
+		"upper": strings.ToUpper,
+	}
+	if html {
+		funcs["code"] = func(s string) htmltemplate.HTML {
+			return htmltemplate.HTML("<code>" + htmltemplate.HTMLEscapeString(s) + "</code>")
+		}
+		funcs["link"] = func(text interface{}, url string) htmltemplate.HTML {
+			inner, ok := text.(htmltemplate.HTML)
+			if !ok {
+				inner = htmltemplate.HTML(htmltemplate.HTMLEscapeString(fmt.Sprint(text)))
+			}
+			if url == "" {
+				return inner
+			}
+			return htmltemplate.HTML(`<a href="` + htmltemplate.HTMLEscapeString(url) + `">` + string(inner) + "</a>")
+		}
+	} else {
+		funcs["code"] = func(s string) string { return "`" + s + "`" }
+		funcs["link"] = func(text interface{}, url string) string {
+			if url == "" {
+				return fmt.Sprint(text)
+			}
+			return fmt.Sprintf("[%v](%s)", text, url)
+		}
+	}
+	return funcs
+}
+
+// number writes an integer or a decimal such as "1234.5" with l's digit
+// grouping and decimal mark; anything else is written as is.
+func (l reportLocale) number(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case uint64:
+		s = strconv.FormatUint(v, 10)
+	case int:
+		s = strconv.Itoa(v)
+	case *big.Int:
+		if v == nil {
+			return "–"
+		}
+		s = v.String()
+	case string:
+		s = v
+	default:
+		return fmt.Sprint(v)
+	}
+	if s == "" {
+		return "–"
+	}
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	sign := ""
+	if strings.HasPrefix(whole, "-") {
+		sign, whole = "-", whole[1:]
+	}
+	if whole == "" || strings.Trim(whole, "0123456789") != "" {
+		return s
+	}
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, d := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(l.group)
+		}
+		b.WriteRune(d)
+	}
+	if hasFrac {
+		b.WriteString(l.decimal + frac)
+	}
+	return b.String()
+}
+
+const builtinMarkdownReport = `# {{t "Deployment report"}}
+{{- if .DryRun}}
+
+> {{t "Dry run: nothing was broadcast"}}
+{{- end}}
+
+{{t "Generated"}} {{date .GeneratedAt}}
+{{- with .Manifest}} · {{t "Manifest"}} {{code .}}{{end}}
+{{- with .Profile}} · {{t "Profile"}} {{code .}}{{end}}
+{{range .Networks}}
+## {{.Network}}{{if .ChainID}} ({{t "chain"}} {{.ChainID}}){{end}}
+{{if .Error}}
+**{{t "Failed"}}:** {{.Error}}
+{{end}}
+{{- if .Deployments}}
+| {{t "Contract"}} | {{t "Address"}} | {{t "Transaction"}} | {{if $.DryRun}}{{t "Estimated gas"}}{{else}}{{t "Gas used"}}{{end}} | {{t "Verification"}} |
+|---|---|---|--:|---|
+{{range .Deployments -}}
+| {{.Name}}{{if ne .Name .Contract}} ({{.Contract}}){{end}} | {{link (code .Address.Hex) .AddressURL}}{{with .Implementation}}<br>{{t "Implementation"}} {{code .Hex}}{{end}} | {{if .TxHash}}{{link (code (short .TxHash.Hex)) .TxURL}}{{else}}–{{end}} | {{if $.DryRun}}{{number .Gas}}{{else if .Skipped}}–{{else}}{{number .GasUsed}}{{end}} | {{if .Skipped}}{{t "already deployed"}}{{else if $.DryRun}}{{t "not broadcast"}}{{else if .Verified}}{{t "verified"}}{{else}}{{t "not verified"}}{{end}} |
+{{end}}
+{{- else}}
+{{t "No deployments"}}
+{{end}}
+{{- end}}
+{{- with .Cost}}
+## {{t "Gas cost"}}
+
+| {{t "Network"}} | {{t "Total"}} |{{range .Currencies}} {{upper .}} |{{end}}
+|---|--:|{{range .Currencies}}--:|{{end}}
+{{range $n := .Networks -}}
+| {{$n.Network}} | {{ether $n.TotalWei}} |{{range $.Cost.Currencies}} {{number (index $n.Total .)}} |{{end}}
+{{end}}
+{{- if gt (len .Networks) 1 -}}
+| **{{t "Total"}}** | |{{range $.Cost.Currencies}} **{{number (index $.Cost.Total .)}}** |{{end}}
+{{end}}
+{{- end}}`
+
+const builtinHTMLReport = `<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<title>{{t "Deployment report"}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+td.num { text-align: right; }
+.failed { color: #b00; }
+</style>
+</head>
+<body>
+<h1>{{t "Deployment report"}}</h1>
+{{- if .DryRun}}
+<p><strong>{{t "Dry run: nothing was broadcast"}}</strong></p>
+{{- end}}
+<p>{{t "Generated"}} {{date .GeneratedAt}}
+{{- with .Manifest}} · {{t "Manifest"}} {{code .}}{{end}}
+{{- with .Profile}} · {{t "Profile"}} {{code .}}{{end}}</p>
+{{range .Networks}}
+<h2>{{.Network}}{{if .ChainID}} ({{t "chain"}} {{.ChainID}}){{end}}</h2>
+{{- if .Error}}
+<p class="failed"><strong>{{t "Failed"}}:</strong> {{.Error}}</p>
+{{- end}}
+{{- if .Deployments}}
+<table>
+<tr><th>{{t "Contract"}}</th><th>{{t "Address"}}</th><th>{{t "Transaction"}}</th><th>{{if $.DryRun}}{{t "Estimated gas"}}{{else}}{{t "Gas used"}}{{end}}</th><th>{{t "Verification"}}</th></tr>
+{{- range .Deployments}}
+<tr>
+<td>{{.Name}}{{if ne .Name .Contract}} ({{.Contract}}){{end}}</td>
+<td>{{link (code .Address.Hex) .AddressURL}}{{with .Implementation}}<br>{{t "Implementation"}} {{code .Hex}}{{end}}</td>
+<td>{{if .TxHash}}{{link (code (short .TxHash.Hex)) .TxURL}}{{else}}–{{end}}</td>
+<td class="num">{{if $.DryRun}}{{number .Gas}}{{else if .Skipped}}–{{else}}{{number .GasUsed}}{{end}}</td>
+<td>{{if .Skipped}}{{t "already deployed"}}{{else if $.DryRun}}{{t "not broadcast"}}{{else if .Verified}}{{t "verified"}}{{else}}{{t "not verified"}}{{end}}</td>
+</tr>
+{{- end}}
+</table>
+{{- else}}
+<p>{{t "No deployments"}}</p>
+{{- end}}
+{{- end}}
+{{- with .Cost}}
+<h2>{{t "Gas cost"}}</h2>
+<table>
+<tr><th>{{t "Network"}}</th><th>{{t "Total"}}</th>{{range .Currencies}}<th>{{upper .}}</th>{{end}}</tr>
+{{- range $n := .Networks}}
+<tr><td>{{$n.Network}}</td><td class="num">{{ether $n.TotalWei}}</td>{{range $.Cost.Currencies}}<td class="num">{{number (index $n.Total .)}}</td>{{end}}</tr>
+{{- end}}
+{{- if gt (len .Networks) 1}}
+<tr><th>{{t "Total"}}</th><td></td>{{range $.Cost.Currencies}}<th class="num">{{number (index $.Cost.Total .)}}</th>{{end}}</tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`
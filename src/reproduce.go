@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// runReproduce recompiles deployed contracts from the compiler version,
+// settings and sources pinned in their recorded metadata, and compares
+// the creation code with the deployment transaction's. A match proves the
+// contract on chain was built from the sources in the tree.
+func runReproduce(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("reproduce", &rpcURL)
+	network := addRegistryFlag(fs)
+	all := fs.Bool("all", false, "check every contract in the registry")
+	solc := fs.String("solc", "solc", "solc binary of the recorded compiler version")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 && !*all {
+		return errors.New("usage: reproduce [-network name] [-solc path] -all | <deployment name>...")
+	}
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	reg, err := loadRegistry(root, *network)
+	if err != nil {
+		return err
+	}
+	names := fs.Args()
+	if *all {
+		names = reg.names()
+	}
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var errs []error
+	for _, name := range names {
+		e, err := reg.lookup(name)
+		if err != nil {
+			return err
+		}
+		how, err := reproduce(ctx, client, root, *solc, e)
+		if err != nil {
+			fmt.Printf("%-24s FAILED: %v\n", name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		fmt.Printf("%-24s reproduced (%s)\n", name, how)
+	}
+	return errors.Join(errs...)
+}
+
+// reproduce rebuilds e and checks it. It says what the build was compared
+// with: the deployment transaction, or for proxies and Safe deployments,
+// whose transactions do not carry the creation code, the recorded hash.
+func reproduce(ctx context.Context, client *ethclient.Client, root, solc string, e *registryEntry) (string, error) {
+	meta := e.Metadata
+	if meta == nil {
+		return "", errors.New("no compiler metadata recorded; it was deployed from a prebuilt artifact")
+	}
+	changed, err := changedSources(root, meta)
+	if err != nil {
+		return "", err
+	}
+	if len(changed) > 0 {
+		if len(changed) > 3 {
+			changed = append(changed[:3], fmt.Sprintf("and %d more", len(changed)-3))
+		}
+		return "", fmt.Errorf("sources changed since deployment: %s", strings.Join(changed, ", "))
+	}
+	code, err := recompile(ctx, solc, root, meta, e.Libraries)
+	if err != nil {
+		return "", err
+	}
+
+	onChain, err := creationCode(ctx, client, e)
+	if err != nil {
+		return "", err
+	}
+	if onChain == nil {
+		if e.CreationCodeHash == nil {
+			return "", errors.New("the deployment transaction does not carry the creation code, and no creation code hash was recorded")
+		}
+		if got := crypto.Keccak256Hash(code); got != *e.CreationCodeHash {
+			return "", fmt.Errorf("creation code hash %s, recorded %s", got.Hex(), e.CreationCodeHash.Hex())
+		}
+		return "recorded creation code hash", nil
+	}
+	want := append(append([]byte{}, code...), e.EncodedArgs...)
+	if !bytes.Equal(onChain, want) {
+		return "", fmt.Errorf("creation code differs from transaction %s%s", e.TxHash.Hex(), firstDifference(onChain, want))
+	}
+	return "transaction " + e.TxHash.Hex(), nil
+}
+
+// changedSources lists the metadata's sources whose keccak256 no longer
+// matches the file in the tree.
+func changedSources(root string, meta *compilerMetadata) ([]string, error) {
+	var changed []string
+	for _, path := range sortedKeys(meta.Sources) {
+		content, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(path)))
+		if err != nil {
+			return nil, fmt.Errorf("read source %s (are submodules checked out?): %w", path, err)
+		}
+		if !strings.EqualFold(crypto.Keccak256Hash(content).Hex(), meta.Sources[path].Keccak256) {
+			changed = append(changed, path)
+		}
+	}
+	return changed, nil
+}
+
+// recompile runs solc on the standard JSON input that produced meta and
+// returns the compilation target's creation code. solc must be the exact
+// version in meta.
+func recompile(ctx context.Context, solc, root string, meta *compilerMetadata, libraries map[string]common.Address) ([]byte, error) {
+	version, err := exec.CommandContext(ctx, solc, "--version").Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s --version: %w", solc, err)
+	}
+	if !strings.Contains(string(version), "Version: "+meta.Compiler.Version) {
+		return nil, fmt.Errorf("deployed with solc %s, but %s is:\n%s\n(pass that version with -solc)", meta.Compiler.Version, solc, bytes.TrimSpace(version))
+	}
+	target, err := meta.compilationTarget()
+	if err != nil {
+		return nil, err
+	}
+	// Libraries linked at deploy time are linked after compiling here too;
+	// passing them to solc would change the metadata hash.
+	input, err := standardJSONInput(root, meta, nil)
+	if err != nil {
+		return nil, err
+	}
+	// The metadata does not record the output selection.
+	var doc map[string]interface{}
+	if err := json.Unmarshal(input, &doc); err != nil {
+		return nil, err
+	}
+	doc["settings"].(map[string]interface{})["outputSelection"] = map[string]interface{}{
+		"*": map[string]interface{}{"*": []string{"evm.bytecode.object", "evm.bytecode.linkReferences"}},
+	}
+	if input, err = json.Marshal(doc); err != nil {
+		return nil, err
+	}
+
+	logger.Info("Recompiling", "contract", target, "solc", meta.Compiler.Version)
+	cmd := exec.CommandContext(ctx, solc, "--standard-json")
+	cmd.Stdin = bytes.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	raw, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("solc: %w\n%s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	var out solcOutput
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("parse solc output: %w", err)
+	}
+	for _, e := range out.Errors {
+		if e.Severity == "error" {
+			return nil, fmt.Errorf("compilation failed:\n%s", strings.TrimSpace(e.FormattedMessage))
+		}
+	}
+	path, name, _ := strings.Cut(target, ":")
+	compiled, ok := out.Contracts[path][name]
+	if !ok {
+		return nil, fmt.Errorf("solc produced no %s", target)
+	}
+	art := &artifact{Name: name, Bytecode: decodeCode(compiled.EVM.Bytecode.Object), LinkReferences: compiled.EVM.Bytecode.LinkReferences}
+	if len(art.LinkReferences) > 0 {
+		if err := art.link(libraries); err != nil {
+			return nil, err
+		}
+	}
+	return art.Bytecode, nil
+}
+
+// creationCode returns the init code and constructor arguments e was
+// deployed with, taken from its transaction, or nil when the transaction
+// does not carry them directly.
+func creationCode(ctx context.Context, client *ethclient.Client, e *registryEntry) ([]byte, error) {
+	if e.Proxy != nil {
+		// The transaction deployed the proxy, not the implementation.
+		return nil, nil
+	}
+	tx, _, err := client.TransactionByHash(ctx, e.TxHash)
+	if err != nil {
+		return nil, fmt.Errorf("deployment transaction %s: %w", e.TxHash.Hex(), err)
+	}
+	switch {
+	case tx.To() == nil:
+		return tx.Data(), nil
+	case e.Salt != nil && len(tx.Data()) > common.HashLength && bytes.Equal(tx.Data()[:common.HashLength], e.Salt.Bytes()):
+		// The CREATE2 factory takes the salt followed by the init code.
+		return tx.Data()[common.HashLength:], nil
+	}
+	return nil, nil
+}
+
+func firstDifference(a, b []byte) string {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return fmt.Sprintf(" at byte %d", i)
+		}
+	}
+	return fmt.Sprintf(" in length (%d bytes on chain, %d rebuilt)", len(a), len(b))
+}
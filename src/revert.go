@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// callError is a failed eth_call of a contract method, reported with its
+// decoded revert reason. Without a sig only the reason is reported.
+type callError struct {
+	sig    string
+	reason string
+	err    error
+}
+
+func (e *callError) Error() string {
+	if e.sig == "" {
+		return e.reason
+	}
+	return e.sig + ": " + e.reason
+}
+
+func (e *callError) Unwrap() error { return e.err }
+
+// isRevert reports whether err is a call that reverted, rather than one
+// that could not be made.
+func isRevert(err error) bool {
+	var de rpc.DataError
+	return errors.As(err, &de) || strings.Contains(err.Error(), "execution reverted")
+}
+
+// revertReason extracts a human-readable reason from an eth_call or
+// eth_estimateGas error. Revert data the node returns is decoded as
+// Error(string), Panic(uint256) or one of the custom errors of contracts.
+func revertReason(err error, contracts ...abi.ABI) string {
+	data, ok := revertData(err)
+	if !ok || len(data) == 0 {
+		return err.Error()
+	}
+	if reason, ok := decodeRevert(data, contracts); ok {
+		return reason
+	}
+	return err.Error() + " (data " + hexutil.Encode(data) + ")"
+}
+
+// revertData returns the revert data attached to err, if any.
+func revertData(err error) ([]byte, bool) {
+	var de rpc.DataError
+	if !errors.As(err, &de) {
+		return nil, false
+	}
+	data, ok := de.ErrorData().(string)
+	if !ok {
+		return nil, false
+	}
+	return common.FromHex(data), true
+}
+
+// decodeRevert decodes revert data as an Error(string) reason or
+// Panic(uint256) code, or as a custom error declared in contracts.
+func decodeRevert(data []byte, contracts []abi.ABI) (string, bool) {
+	if reason, err := abi.UnpackRevert(data); err == nil {
+		return reason, true
+	}
+	if len(data) < 4 {
+		return "", false
+	}
+	for _, contract := range contracts {
+		for _, e := range contract.Errors {
+			if !bytes.Equal(data[:4], e.ID[:4]) {
+				continue
+			}
+			values, err := e.Inputs.Unpack(data[4:])
+			if err != nil {
+				continue
+			}
+			args := make([]string, len(values))
+			for i, v := range values {
+				args[i] = formatValue(v)
+				if name := e.Inputs[i].Name; name != "" {
+					args[i] = name + ": " + args[i]
+				}
+			}
+			return e.Name + "(" + strings.Join(args, ", ") + ")", true
+		}
+	}
+	return "", false
+}
+
+// explainRevert replaces the error of a reverted transaction with its
+// decoded reason and the call data that failed.
+func (r *networkRun) explainRevert(err error, contract abi.ABI, data []byte) error {
+	reason := revertReason(err, append([]abi.ABI{contract}, projectABIs(r.root)...)...)
+	return &callError{reason: reason + " (call data " + hexutil.Encode(data) + ")", err: err}
+}
+
+// projectABIs returns the ABIs of every artifact under root/out, for
+// decoding calls and reverts of contracts a transaction reaches indirectly.
+// Unreadable artifacts are skipped.
+func projectABIs(root string) []abi.ABI {
+	var abis []abi.ABI
+	filepath.WalkDir(filepath.Join(root, "out"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		var art struct {
+			ABI json.RawMessage `json:"abi"`
+		}
+		if json.Unmarshal(raw, &art) != nil || len(art.ABI) == 0 {
+			return nil
+		}
+		if parsed, err := abi.JSON(bytes.NewReader(art.ABI)); err == nil {
+			abis = append(abis, parsed)
+		}
+		return nil
+	})
+	return abis
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// Rollup kinds whose L1 data fees are priced, from a network's rollup:
+// field or its chain id.
+const (
+	rollupNone     = "none"
+	rollupOP       = "op"
+	rollupArbitrum = "arbitrum"
+)
+
+// rollupChainIDs maps well-known rollups to their kind.
+var rollupChainIDs = map[uint64]string{
+	10:       rollupOP, // OP Mainnet
+	11155420: rollupOP, // OP Sepolia
+	8453:     rollupOP, // Base
+	84532:    rollupOP, // Base Sepolia
+	7777777:  rollupOP, // Zora
+	34443:    rollupOP, // Mode
+	42161:    rollupArbitrum,
+	42170:    rollupArbitrum, // Arbitrum Nova
+	421614:   rollupArbitrum,
+}
+
+var (
+	// opGasPriceOracle is the OP-stack predeploy that prices the L1 data
+	// of a transaction from its RLP encoding.
+	opGasPriceOracle    = common.HexToAddress("0x420000000000000000000000000000000000000F")
+	opGasPriceOracleABI = mustParseABI(`[{"type":"function","name":"getL1Fee","inputs":[{"name":"_data","type":"bytes"}],"outputs":[{"name":"","type":"uint256"}],"stateMutability":"view"}]`)
+
+	// arbGasInfo is Arbitrum's precompile for the current L1 prices.
+	arbGasInfo    = common.HexToAddress("0x000000000000000000000000000000000000006C")
+	arbGasInfoABI = mustParseABI(`[{"type":"function","name":"getPricesInWei","inputs":[],"outputs":[{"name":"perL2Tx","type":"uint256"},{"name":"perL1CalldataByte","type":"uint256"},{"name":"perStorageAllocation","type":"uint256"},{"name":"perArbGasBase","type":"uint256"},{"name":"perArbGasCongestion","type":"uint256"},{"name":"perArbGasTotal","type":"uint256"}],"stateMutability":"view"}]`)
+)
+
+// rollupKind returns the network's rollup:, defaulting from the chain id.
+func (n networkConfig) rollupKind(chainID uint64) string {
+	if n.Rollup != "" {
+		return n.Rollup
+	}
+	if kind, ok := rollupChainIDs[chainID]; ok {
+		return kind
+	}
+	return rollupNone
+}
+
+// l1Fee estimates the fee in wei for publishing a transaction's data to
+// L1, which its gas does not cover. OP-stack chains charge it on top of
+// gas, priced by the GasPriceOracle from the unsigned transaction.
+// Arbitrum bills it as L2 gas, which eth_estimateGas already counts, so
+// there it is only priced, from ArbGasInfo, when gas is a fixed limit or
+// an approximation rather than the node's estimate.
+func (r *networkRun) l1Fee(ctx context.Context, fields txFields, gas uint64, f fees, estimated bool) (*big.Int, error) {
+	r.mu.Lock()
+	nonce := r.nonce
+	r.mu.Unlock()
+	switch r.rollup {
+	case rollupOP:
+		tx, err := newTx(r.chainID, nonce, f, gas, fields).MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		data, err := opGasPriceOracleABI.Pack("getL1Fee", tx)
+		if err != nil {
+			return nil, err
+		}
+		out, err := r.client.CallContract(ctx, ethereum.CallMsg{To: &opGasPriceOracle, Data: data}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("GasPriceOracle.getL1Fee: %w", err)
+		}
+		values, err := opGasPriceOracleABI.Unpack("getL1Fee", out)
+		if err != nil {
+			return nil, fmt.Errorf("GasPriceOracle.getL1Fee: %w", err)
+		}
+		return values[0].(*big.Int), nil
+	case rollupArbitrum:
+		if estimated {
+			return nil, nil
+		}
+		tx, err := newTx(r.chainID, nonce, f, gas, fields).MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		return arbitrumL1Fee(ctx, r.client, len(tx))
+	}
+	return nil, nil
+}
+
+// arbitrumL1Fee prices size bytes of transaction data at ArbGasInfo's
+// current L1 prices. Arbitrum charges for the data once compressed, so
+// this is an upper bound.
+func arbitrumL1Fee(ctx context.Context, client *ethclient.Client, size int) (*big.Int, error) {
+	data, err := arbGasInfoABI.Pack("getPricesInWei")
+	if err != nil {
+		return nil, err
+	}
+	out, err := client.CallContract(ctx, ethereum.CallMsg{To: &arbGasInfo, Data: data}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ArbGasInfo.getPricesInWei: %w", err)
+	}
+	values, err := arbGasInfoABI.Unpack("getPricesInWei", out)
+	if err != nil {
+		return nil, fmt.Errorf("ArbGasInfo.getPricesInWei: %w", err)
+	}
+	perTx, perByte := values[0].(*big.Int), values[1].(*big.Int)
+	fee := new(big.Int).Mul(perByte, big.NewInt(int64(size)))
+	return fee.Add(fee, perTx), nil
+}
+
+// quoteL1Fee is l1Fee for a run that must not fail over a price lookup:
+// an oracle that cannot be read is a warning, and the fee is left out.
+func (r *networkRun) quoteL1Fee(ctx context.Context, fields txFields, gas uint64, f fees, estimated bool) *big.Int {
+	fee, err := r.l1Fee(ctx, fields, gas, f, estimated)
+	if err != nil {
+		logger.Warn("Could not price the L1 data fee; costs leave it out", "network", r.name, "rollup", r.rollup, "err", err)
+		return nil
+	}
+	return fee
+}
+
+// receiptL1Fee returns the L1 data fee a mined transaction paid on top of
+// its gas, from the l1Fee field OP-stack receipts carry. Elsewhere there is
+// none.
+func (r *networkRun) receiptL1Fee(ctx context.Context, hash common.Hash) *big.Int {
+	if r.rollup != rollupOP {
+		return nil
+	}
+	var receipt struct {
+		L1Fee *hexutil.Big `json:"l1Fee"`
+	}
+	if err := r.client.Client().CallContext(ctx, &receipt, "eth_getTransactionReceipt", hash); err != nil || receipt.L1Fee == nil {
+		return nil
+	}
+	return receipt.L1Fee.ToInt()
+}
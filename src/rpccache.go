@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	// rpcCacheHeadTTL is how long the head block a latest read is pinned to
+	// is reused before asking the node again. Sending a transaction also
+	// forgets it, so a run reads its own writes.
+	rpcCacheHeadTTL = time.Second
+	// rpcCacheReorgDepth is how far behind the head a block given by number
+	// must be for reads at it to be cached; more recent ones could still be
+	// reorged to other contents.
+	rpcCacheReorgDepth = 64
+)
+
+// rpcCacheDir is where eth_call, eth_getCode and eth_getStorageAt results
+// are cached, set by -rpc-cache; empty disables the cache.
+var rpcCacheDir string
+
+// rpcCacheBlockParam is the index of the block parameter of each cached
+// method.
+var rpcCacheBlockParam = map[string]int{
+	"eth_call":         1,
+	"eth_getCode":      1,
+	"eth_getStorageAt": 2,
+}
+
+// rpcCache answers reads of state at a block from disk, sending the rest
+// on to the endpoints. State at a block never changes, so a result is kept
+// under the block it was read at: by hash for reads at the latest block,
+// which are pinned to the current head, and by number for older blocks
+// read by number. Reads at pending, safe or finalized are not cached, nor
+// are batches that mix cached methods with others.
+type rpcCache struct {
+	dir  string
+	next http.RoundTripper
+
+	mu      sync.Mutex
+	chainID string
+	head    *rpcCacheHead
+}
+
+type rpcCacheHead struct {
+	number uint64
+	hash   string
+	at     time.Time
+}
+
+// rpcCall is one JSON-RPC request, with the parameters kept raw so that
+// the key does not depend on how they were decoded.
+type rpcCall struct {
+	Version string            `json:"jsonrpc"`
+	ID      json.RawMessage   `json:"id"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+}
+
+type rpcReply struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   json.RawMessage `json:"error,omitempty"`
+}
+
+func newRPCCache(dir string, next http.RoundTripper) *rpcCache {
+	return &rpcCache{dir: expandHome(dir), next: next}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (c *rpcCache) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	calls, batch := parseRPCCalls(body)
+	keys := make([]string, len(calls))
+	cacheable := len(calls) > 0
+	for i := range calls {
+		switch calls[i].Method {
+		case "eth_sendRawTransaction", "eth_sendTransaction":
+			c.forgetHead()
+		}
+		if !cacheable {
+			continue
+		}
+		key, err := c.key(req, &calls[i])
+		if err != nil {
+			logger.Debug("RPC cache lookup failed", "method", calls[i].Method, "err", err)
+		}
+		if key == "" {
+			cacheable = false
+			continue
+		}
+		keys[i] = key
+	}
+	if !cacheable {
+		return c.forward(req, body)
+	}
+
+	replies := make([]rpcReply, len(calls))
+	hits := 0
+	for i, call := range calls {
+		replies[i] = rpcReply{Version: "2.0", ID: call.ID}
+		if raw, err := os.ReadFile(c.path(keys[i])); err == nil {
+			replies[i].Result = raw
+			hits++
+		}
+	}
+	if hits == len(calls) {
+		metrics.add(metricRPCCache, float64(hits), "result", "hit")
+		var out []byte
+		var err error
+		if batch {
+			out, err = json.Marshal(replies)
+		} else {
+			out, err = json.Marshal(replies[0])
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {"application/json"}},
+			Body:          io.NopCloser(bytes.NewReader(out)),
+			ContentLength: int64(len(out)),
+			Request:       req,
+		}, nil
+	}
+	metrics.add(metricRPCCache, float64(len(calls)), "result", "miss")
+
+	// The reads pinned to the head are sent with its number.
+	var rewritten []byte
+	var err error
+	if batch {
+		rewritten, err = json.Marshal(calls)
+	} else {
+		rewritten, err = json.Marshal(calls[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.forward(req, rewritten)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	out, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	c.store(out, batch, calls, keys)
+	resp.Body = io.NopCloser(bytes.NewReader(out))
+	resp.ContentLength = int64(len(out))
+	return resp, nil
+}
+
+// parseRPCCalls decodes a request body, reporting whether it is a batch.
+// A body that does not decode yields no calls.
+func parseRPCCalls(body []byte) ([]rpcCall, bool) {
+	trimmed := bytes.TrimSpace(body)
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		var calls []rpcCall
+		if json.Unmarshal(trimmed, &calls) != nil {
+			return nil, true
+		}
+		return calls, true
+	}
+	var call rpcCall
+	if json.Unmarshal(trimmed, &call) != nil || call.Method == "" {
+		return nil, false
+	}
+	return []rpcCall{call}, false
+}
+
+// key returns the cache key of call, pinning a read at the latest block to
+// the head, or "" if it cannot be cached.
+func (c *rpcCache) key(req *http.Request, call *rpcCall) (string, error) {
+	index, ok := rpcCacheBlockParam[call.Method]
+	if !ok || len(call.Params) < index || len(call.Params) > index+3 {
+		return "", nil
+	}
+	if len(call.Params) == index {
+		call.Params = append(call.Params, json.RawMessage(`"latest"`))
+	}
+	block, err := c.blockKey(req, call, index)
+	if block == "" || err != nil {
+		return "", err
+	}
+	chainID, err := c.chain(req)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n", chainID, call.Method, block)
+	for i, p := range call.Params {
+		if i == index {
+			continue
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, p); err != nil {
+			return "", err
+		}
+		h.Write(compact.Bytes())
+		h.Write([]byte{'\n'})
+	}
+	return chainID + "/" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// blockKey names the block the call reads at, rewriting latest to the
+// head's number.
+func (c *rpcCache) blockKey(req *http.Request, call *rpcCall, index int) (string, error) {
+	param := call.Params[index]
+	var tag string
+	if json.Unmarshal(param, &tag) == nil {
+		if tag == "latest" {
+			head, err := c.currentHead(req)
+			if err != nil {
+				return "", err
+			}
+			call.Params[index] = json.RawMessage(strconv.Quote(hexutil.EncodeUint64(head.number)))
+			return "hash:" + head.hash, nil
+		}
+		number, err := hexutil.DecodeUint64(tag)
+		if err != nil {
+			// pending, safe, finalized and earliest.
+			return "", nil
+		}
+		return c.settledBlock(req, number)
+	}
+	// EIP-1898: {"blockHash": ...} or {"blockNumber": ...}.
+	var spec struct {
+		Hash   string `json:"blockHash"`
+		Number string `json:"blockNumber"`
+	}
+	if json.Unmarshal(param, &spec) != nil {
+		return "", nil
+	}
+	if spec.Hash != "" {
+		return "hash:" + spec.Hash, nil
+	}
+	number, err := hexutil.DecodeUint64(spec.Number)
+	if err != nil {
+		return "", nil
+	}
+	return c.settledBlock(req, number)
+}
+
+// settledBlock keys a read at a block by number if it is far enough behind
+// the head not to be reorged.
+func (c *rpcCache) settledBlock(req *http.Request, number uint64) (string, error) {
+	head, err := c.currentHead(req)
+	if err != nil {
+		return "", err
+	}
+	if number+rpcCacheReorgDepth > head.number {
+		return "", nil
+	}
+	return "number:" + strconv.FormatUint(number, 10), nil
+}
+
+func (c *rpcCache) forgetHead() {
+	c.mu.Lock()
+	c.head = nil
+	c.mu.Unlock()
+}
+
+// currentHead returns the latest block, asking the node at most once per
+// rpcCacheHeadTTL.
+func (c *rpcCache) currentHead(req *http.Request) (rpcCacheHead, error) {
+	c.mu.Lock()
+	if h := c.head; h != nil && time.Since(h.at) < rpcCacheHeadTTL {
+		c.mu.Unlock()
+		return *h, nil
+	}
+	c.mu.Unlock()
+	var block struct {
+		Number *hexutil.Big `json:"number"`
+		Hash   string       `json:"hash"`
+	}
+	if err := c.call(req, "eth_getBlockByNumber", `["latest",false]`, &block); err != nil {
+		return rpcCacheHead{}, err
+	}
+	if block.Number == nil || block.Hash == "" {
+		return rpcCacheHead{}, errors.New("the node returned no latest block")
+	}
+	h := &rpcCacheHead{number: block.Number.ToInt().Uint64(), hash: block.Hash, at: time.Now()}
+	c.mu.Lock()
+	c.head = h
+	c.mu.Unlock()
+	return *h, nil
+}
+
+// chain returns the endpoints' chain id, which namespaces the cache.
+func (c *rpcCache) chain(req *http.Request) (string, error) {
+	c.mu.Lock()
+	id := c.chainID
+	c.mu.Unlock()
+	if id != "" {
+		return id, nil
+	}
+	var raw hexutil.Big
+	if err := c.call(req, "eth_chainId", `[]`, &raw); err != nil {
+		return "", err
+	}
+	id = (*big.Int)(&raw).String()
+	c.mu.Lock()
+	c.chainID = id
+	c.mu.Unlock()
+	return id, nil
+}
+
+// call sends a request of its own to where req goes.
+func (c *rpcCache) call(req *http.Request, method, params string, result interface{}) error {
+	body := []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":%q,"params":%s}`, method, params))
+	resp, err := c.forward(req, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", method, resp.Status)
+	}
+	var reply rpcReply
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	if len(reply.Error) > 0 {
+		return fmt.Errorf("%s: %s", method, reply.Error)
+	}
+	return json.Unmarshal(reply.Result, result)
+}
+
+func (c *rpcCache) forward(req *http.Request, body []byte) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	return c.next.RoundTrip(r)
+}
+
+// store caches the successful results in a response to calls.
+func (c *rpcCache) store(out []byte, batch bool, calls []rpcCall, keys []string) {
+	var replies []rpcReply
+	if batch {
+		if json.Unmarshal(out, &replies) != nil {
+			return
+		}
+	} else {
+		var reply rpcReply
+		if json.Unmarshal(out, &reply) != nil {
+			return
+		}
+		replies = []rpcReply{reply}
+	}
+	byID := make(map[string]int, len(calls))
+	for i, call := range calls {
+		byID[string(call.ID)] = i
+	}
+	for _, reply := range replies {
+		i, ok := byID[string(reply.ID)]
+		if !ok || len(reply.Error) > 0 || len(reply.Result) == 0 {
+			continue
+		}
+		if err := writeFileAtomic(c.path(keys[i]), reply.Result); err != nil {
+			logger.Debug("Could not write the RPC cache", "err", err)
+			return
+		}
+	}
+}
+
+// path spreads the entries of each chain over 256 directories.
+func (c *rpcCache) path(key string) string {
+	chainID, sum, _ := strings.Cut(key, "/")
+	return filepath.Join(c.dir, chainID, sum[:2], sum+".json")
+}
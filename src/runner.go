@@ -0,0 +1,1050 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// deployOptions are run-wide switches from the command line.
+type deployOptions struct {
+	// DryRun simulates each deployment instead of broadcasting it.
+	DryRun bool
+	// Nonce overrides the sender's first nonce, e.g. to replace a stuck
+	// transaction.
+	Nonce *uint64
+	// Resume continues an interrupted run from its checkpoint, skipping
+	// contracts that are already deployed.
+	Resume bool
+	// AllowOversize downgrades code size limit errors to warnings.
+	AllowOversize bool
+	// Confirmations is how many blocks must include a transaction,
+	// counting its own, before it is considered final; 0 does not wait.
+	Confirmations uint64
+	// Timeout bounds the wait for each transaction's confirmations.
+	Timeout time.Duration
+	// ReorgDepth keeps watching the run's deployments until this many
+	// blocks are built on theirs, marking any a reorg removes; 0 does not
+	// watch.
+	ReorgDepth uint64
+	// Force proceeds even if the node's chain id is not the one expected
+	// for the network.
+	Force bool
+	// ForceRedeploy deploys contracts even when the registry has one
+	// deployed from the same code and arguments.
+	ForceRedeploy bool
+	// Fund tops up the sender on test networks when its balance does not
+	// cover the run.
+	Fund bool
+	// Simulate runs every transaction through Tenderly first, configured
+	// from the environment if the network has no tenderly block.
+	Simulate bool
+	// Trace prints the call trace of every transaction, or of the call
+	// that failed, from the node's debug API.
+	Trace bool
+	// Parallel is how many independent contracts may be deployed at once;
+	// 0 or 1 deploys them one at a time in manifest order.
+	Parallel int
+	// Interactive asks for the network name to be typed before each
+	// transaction is broadcast, as networks with confirm: true always do.
+	Interactive bool
+	// Yes skips those confirmations, for CI.
+	Yes bool
+	// Scratch keeps the run's registry, checkpoint and audit log in a
+	// temporary directory removed when the run closes, for runs against a
+	// throwaway node that the project's records should not mention.
+	Scratch bool
+	// Changed deploys only the contracts whose code or arguments changed
+	// since the registry was written, and those that depend on them,
+	// keeping the rest.
+	Changed bool
+	// Attest signs a provenance statement for each deployment: signer with
+	// the deploying key, sigstore with cosign; empty does not.
+	Attest string
+	// PolicyOverride is the reason given for sending despite the project's
+	// policy; empty enforces it.
+	PolicyOverride string
+}
+
+// networkRun holds the state shared by all deployments to one network.
+type networkRun struct {
+	name string
+	root string
+	// records holds the deployments/ directory with the registry,
+	// checkpoint and audit log: root, or a temporary directory for scratch
+	// runs.
+	records string
+	client  *ethclient.Client
+	node    *anvilNode // set when the run started its own anvil
+	chainID *big.Int
+	sender  signer
+	// chain handles the network's deployment mechanism.
+	chain chainAdapter
+	// rollup prices L1 data fees on rollups.
+	rollup string
+	// blobProofs is the kind of proofs blob sidecars carry.
+	blobProofs string
+	explorer   *explorerClient
+	registry   *registry // only written outside dry runs
+	opts       deployOptions
+	// gas holds the manifest-wide gas defaults.
+	gas gasConfig
+
+	// mu guards the state that parallel deployments share: the nonce,
+	// addresses, linked libraries, the factory check and the registry.
+	mu sync.Mutex
+	// libraries serializes library linking, so a library that parallel
+	// deployments both need is deployed once.
+	libraries sync.Mutex
+
+	// factory is the CREATE2 factory used for salted deployments.
+	factory        common.Address
+	factoryChecked bool
+
+	// libraryConfig pins library addresses from the manifest; linked
+	// collects libraries deployed for other contracts, for reporting.
+	libraryConfig map[string]string
+	linked        []*deployment
+
+	// addresses maps the deployments made so far to their addresses, for
+	// resolving ${Name.address} placeholders.
+	addresses map[string]common.Address
+	// ens resolves ENS names and address book labels written for address
+	// arguments.
+	ens *ensResolver
+	// book is the network's address book.
+	book *addressBook
+	// changes is what deploy -changed found changed since the registry
+	// was written, by name; nil deploys everything.
+	changes map[string]planChange
+
+	// nonce is the sender's next nonce. It is tracked locally so that dry
+	// runs predict the same addresses a real run would produce.
+	nonce uint64
+	// reserveNonces checks nonce against the node's before each send.
+	reserveNonces bool
+	// lock keeps other runs off the network while this one sends.
+	lock *runLock
+
+	// safe is set when transactions go through a Safe multisig.
+	safe *safeClient
+	// userOp is set when transactions are user operations from a smart
+	// account.
+	userOp *userOpClient
+	// relay is set when calls to contracts go through a relay service.
+	relay *relayClient
+	// site is the block explorer transactions and contracts are linked
+	// to.
+	site explorerSite
+	// faucet funds the sender with -fund.
+	faucet *faucetConfig
+	// tenderly simulates transactions before they are sent.
+	tenderly *tenderlyClient
+	// confirm asks before each broadcast.
+	confirm bool
+	// auditLog records every broadcast transaction with the run's
+	// provenance.
+	auditLog   *auditLog
+	provenance provenance
+	// hooks run around each deploy step and transaction; rpcURL is the
+	// endpoint they are given.
+	hooks  []hook
+	rpcURL string
+	// notify are the manifest's webhooks, for commands that report events
+	// of their own.
+	notify []notifyConfig
+	// policyRules are the policy rules on the network that allow the
+	// signer, empty if the network is unrestricted; policyOverride, guarded
+	// by mu, records the violations -policy-override let through.
+	policyRules    []policyRule
+	policyOverride *policyOverride
+	// pool is set when deployments are spread over a signer pool.
+	pool *signerPool
+}
+
+// openNetworkRun connects to network and opens the manifest's signer.
+// The caller must close the run.
+func openNetworkRun(ctx context.Context, m *manifest, network string, opts deployOptions) (_ *networkRun, err error) {
+	root, err := projectRoot()
+	if err != nil {
+		return nil, err
+	}
+	cfg := m.Networks[network]
+	client, node, err := dialNetwork(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	run := &networkRun{name: network, root: root, records: root, client: client, node: node, opts: opts, gas: m.Gas, factory: defaultCreate2Factory, addresses: map[string]common.Address{}, libraryConfig: cfg.Libraries, faucet: cfg.Faucet,
+		confirm: (opts.Interactive || cfg.Confirm) && !opts.Yes && !opts.DryRun}
+	defer func() {
+		if err != nil {
+			run.close()
+		}
+	}()
+	if opts.Scratch {
+		if run.records, err = os.MkdirTemp("", "deploy-scratch-"); err != nil {
+			return nil, err
+		}
+	}
+	run.auditLog = &auditLog{path: auditLogPath(run.records)}
+	run.hooks = openHooks(m, root)
+	run.notify = m.Notify
+	if node != nil {
+		run.rpcURL = node.url
+	} else if urls := cfg.rpcURLs(); len(urls) > 0 {
+		run.rpcURL = urls[0]
+	}
+
+	if f := cfg.Create2Factory; f != "" {
+		if run.factory, err = parseAddress(f); err != nil {
+			return nil, fmt.Errorf("create2Factory: %w", err)
+		}
+	}
+	ensRegistry := ensRegistryAddress
+	if a := cfg.ENSRegistry; a != "" {
+		if ensRegistry, err = parseAddress(a); err != nil {
+			return nil, fmt.Errorf("ensRegistry: %w", err)
+		}
+	}
+	run.ens = newENSResolver(client, ensRegistry)
+	if run.book, err = loadAddressBook(root, network); err != nil {
+		return nil, err
+	}
+	run.ens.book = run.book
+	if run.chainID, err = client.ChainID(ctx); err != nil {
+		return nil, err
+	}
+	// Lock before reading the registry, so it is not read while
+	// another run writes it.
+	if !opts.DryRun {
+		if run.lock, err = acquireRunLock(run.records, network); err != nil {
+			return nil, err
+		}
+	}
+	if run.registry, err = loadRegistry(run.records, network); err != nil {
+		return nil, err
+	}
+	if err := run.checkChainID(cfg.chainID(network)); err != nil {
+		return nil, err
+	}
+	if run.chain, err = newChainAdapter(cfg.chainKind(network), run.chainID.Uint64()); err != nil {
+		return nil, fmt.Errorf("network %s: %w", network, err)
+	}
+	run.rollup = cfg.rollupKind(run.chainID.Uint64())
+	run.site = cfg.explorerSite(run.chainID.Uint64())
+	if run.blobProofs = cfg.BlobProofs; run.blobProofs == "" {
+		run.blobProofs = blobProofsCell
+	}
+	run.registry.ChainID = run.chainID.Uint64()
+	if run.sender, err = newSigner(ctx, m.Signer, client); err != nil {
+		return nil, fmt.Errorf("signer: %w", err)
+	}
+	policy, err := loadPolicy(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := run.initNonce(ctx); err != nil {
+		return nil, err
+	}
+	run.reserveNonces = cfg.ReserveNonces && opts.Nonce == nil
+	if cfg.Safe != nil {
+		if run.safe, err = run.openSafe(ctx, *cfg.Safe); err != nil {
+			return nil, fmt.Errorf("safe: %w", err)
+		}
+	}
+	if cfg.UserOp != nil {
+		if run.userOp, err = run.openUserOp(ctx, *cfg.UserOp); err != nil {
+			return nil, fmt.Errorf("userOp: %w", err)
+		}
+	}
+	if cfg.Relay != nil {
+		if run.relay, err = run.openRelay(ctx, *cfg.Relay); err != nil {
+			return nil, fmt.Errorf("relay: %w", err)
+		}
+	}
+	if m.Signer.Pool > 1 {
+		if run.pool, err = run.openSignerPool(ctx, m.Signer); err != nil {
+			return nil, fmt.Errorf("signer: %w", err)
+		}
+	}
+	if err := run.checkPolicy(policy, m.Signer.kind()); err != nil {
+		return nil, err
+	}
+	tenderly := cfg.Tenderly
+	if tenderly == nil && opts.Simulate {
+		tenderly = tenderlyFromEnv()
+	}
+	if tenderly != nil {
+		if run.tenderly, err = newTenderlyClient(*tenderly); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Explorer != nil && !opts.DryRun && !opts.Scratch {
+		run.explorer = newExplorerClient(*cfg.Explorer, run.chainID.Uint64())
+	}
+	if !opts.DryRun {
+		run.provenance = runProvenance(ctx, root, m.path)
+	}
+	return run, nil
+}
+
+// dialNetwork connects to the network's endpoints, or to an anvil node
+// started for it. A non-nil node must be stopped by the caller.
+func dialNetwork(ctx context.Context, cfg networkConfig) (*ethclient.Client, *anvilNode, error) {
+	urls := cfg.rpcURLs()
+	var node *anvilNode
+	if cfg.Anvil != nil {
+		var err error
+		if node, err = startAnvil(ctx, *cfg.Anvil); err != nil {
+			return nil, nil, err
+		}
+		urls = []string{node.url}
+	}
+	client, err := dialEndpoints(ctx, urls, cfg.rpcOptions())
+	if err != nil {
+		if node != nil {
+			node.stop()
+		}
+		return nil, nil, err
+	}
+	return client, node, nil
+}
+
+// checkChainID refuses to run against a node whose chain differs from the
+// one configured (or well known) for the network, or from the one its
+// registry was written for, unless -force is given.
+func (r *networkRun) checkChainID(expected uint64) error {
+	actual := r.chainID.Uint64()
+	var problem string
+	switch {
+	case expected != 0 && expected != actual:
+		problem = fmt.Sprintf("network %s expects chain %d, but the RPC endpoint serves chain %d", r.name, expected, actual)
+	case r.registry.ChainID != 0 && r.registry.ChainID != actual:
+		problem = fmt.Sprintf("the %s registry (%s) was written for chain %d, but the RPC endpoint serves chain %d", r.name, r.registry.path, r.registry.ChainID, actual)
+	default:
+		return nil
+	}
+	if !r.opts.Force {
+		return fmt.Errorf("%s; check the RPC URL, or pass -force to continue anyway", problem)
+	}
+	logger.Warn(problem + "; continuing because of -force")
+	return nil
+}
+
+func (r *networkRun) close() {
+	if c, ok := r.sender.(io.Closer); ok {
+		c.Close()
+	}
+	r.client.Close()
+	if r.userOp != nil {
+		r.userOp.close()
+	}
+	if r.node != nil {
+		r.node.stop()
+	}
+	if r.lock != nil {
+		r.lock.release()
+	}
+	if r.opts.Scratch && r.records != "" {
+		os.RemoveAll(r.records)
+	}
+}
+
+// executeManifest deploys every contract in m to network in order, or with
+// opts.Parallel, independent ones concurrently. It returns the deployments
+// that were sent before any error.
+func executeManifest(ctx context.Context, m *manifest, network string, opts deployOptions) ([]deployment, error) {
+	run, err := openNetworkRun(ctx, m, network, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer run.close()
+	return run.execute(ctx, m)
+}
+
+// execute runs m against the open network: it deploys the contracts, makes
+// the calls, sends the distributions, hands over ownership and checks the
+// assertions.
+func (r *networkRun) execute(ctx context.Context, m *manifest) ([]deployment, error) {
+	plan, err := r.checkArgs(ctx, m.Contracts)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkCalls(ctx, m); err != nil {
+		return nil, err
+	}
+	if err := r.checkDistributions(ctx, m); err != nil {
+		return nil, err
+	}
+	if r.opts.Changed {
+		if err := r.planChanged(ctx, m); err != nil {
+			return nil, err
+		}
+	}
+
+	state, err := r.openRunState()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkBalance(ctx, plan, state); err != nil {
+		return nil, err
+	}
+
+	var results []deployment
+	if workers := r.opts.Parallel; workers > 1 && r.safe == nil && r.userOp == nil {
+		results, err = r.deployParallel(ctx, m.Contracts, state, workers)
+		if err != nil {
+			return results, err
+		}
+	} else {
+		if workers > 1 {
+			logger.Warn("Safe transactions and user operations go one at a time; ignoring -parallel", "network", r.name)
+		}
+		for _, spec := range m.Contracts {
+			deployed, err := r.deployStep(ctx, spec, state)
+			results = append(results, deployed...)
+			if err != nil {
+				return results, err
+			}
+		}
+	}
+	if err := r.runSetters(ctx, m); err != nil {
+		return results, fmt.Errorf("%w; rerun with -changed -resume to continue", err)
+	}
+	if err := r.runCalls(ctx, m, state); err != nil {
+		return results, fmt.Errorf("%w; rerun with -resume to continue", err)
+	}
+	if err := r.runDistributions(ctx, m, state); err != nil {
+		return results, fmt.Errorf("%w; rerun with -resume to continue", err)
+	}
+	if err := r.transferOwnerships(ctx, m.Contracts); err != nil {
+		return results, fmt.Errorf("%w; rerun with -resume to continue", err)
+	}
+	if !r.opts.DryRun {
+		if err := state.remove(); err != nil {
+			return results, err
+		}
+		if err := r.watchReorgs(ctx, results); err != nil {
+			return results, err
+		}
+	}
+	if err := r.checkAssertions(ctx, m.Assertions); err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+// deployStep runs one manifest contract's step between its pre- and
+// post-deploy hooks.
+func (r *networkRun) deployStep(ctx context.Context, spec contractSpec, state *runState) ([]deployment, error) {
+	if err := r.runHooks(ctx, deployHookEvent(hookPreDeploy, spec, nil, nil)); err != nil {
+		return nil, fmt.Errorf("%s: %w", spec.Name, err)
+	}
+	results, err := r.runStep(ctx, spec, state)
+	if herr := r.runHooks(context.WithoutCancel(ctx), deployHookEvent(hookPostDeploy, spec, results, err)); herr != nil {
+		err = errors.Join(err, fmt.Errorf("%s: %w", spec.Name, herr))
+	}
+	return results, err
+}
+
+// runStep deploys one manifest contract, or takes it from the checkpoint
+// when resuming, and finishes its deployments. It returns them along with
+// any libraries deployed for it, including those sent before an error.
+func (r *networkRun) runStep(ctx context.Context, spec contractSpec, state *runState) ([]deployment, error) {
+	if c, ok := r.changes[spec.Name]; ok && !c.redeploys() {
+		return r.keepStep(ctx, spec)
+	}
+	resolved, err := r.resolveRefs(spec.forNetwork(r.name))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", spec.Name, err)
+	}
+	refs, err := r.referencedAddresses(spec.forNetwork(r.name))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", spec.Name, err)
+	}
+	var deployed []*deployment
+	if r.opts.Resume {
+		if deployed, err = r.resumeStep(ctx, state, resolved); err != nil {
+			return nil, fmt.Errorf("%s: resume: %w", spec.Name, err)
+		}
+	}
+	var results []deployment
+	if deployed == nil {
+		deployed, err = r.deploySpec(ctx, resolved)
+		// Libraries are already finished by the time they're linked.
+		r.libraries.Lock()
+		for _, lib := range r.linked {
+			results = append(results, *lib)
+		}
+		r.linked = nil
+		r.libraries.Unlock()
+		if err != nil {
+			err = fmt.Errorf("%s: %w", spec.Name, err)
+			// Checkpoint what was sent, so -resume waits for it instead
+			// of sending it again.
+			if len(deployed) > 0 && !r.opts.DryRun {
+				for _, d := range deployed {
+					results = append(results, *d)
+				}
+				if cerr := state.checkpoint(resolved, deployed); cerr != nil {
+					return results, errors.Join(err, fmt.Errorf("checkpoint: %w", cerr))
+				}
+				err = fmt.Errorf("%w; rerun with -resume to continue", err)
+			}
+			return results, err
+		}
+		if !r.opts.DryRun {
+			if err := state.checkpoint(resolved, deployed); err != nil {
+				return results, fmt.Errorf("checkpoint: %w", err)
+			}
+		}
+	}
+	for _, d := range deployed {
+		d.References = refs
+		err := r.finish(ctx, d)
+		results = append(results, *d)
+		if err != nil {
+			return results, fmt.Errorf("%s: %w", d.Name, err)
+		}
+	}
+	return results, nil
+}
+
+// plannedDeploy is a manifest contract as checked before the run, with
+// placeholders for addresses that are not known yet.
+type plannedDeploy struct {
+	spec     contractSpec
+	artifact *artifact
+	initCode []byte
+}
+
+// checkArgs type-checks every contract's arguments against its ABI so a
+// mistake late in the manifest is caught before anything is sent. ENS names
+// are resolved here, and the run keeps using those addresses.
+func (r *networkRun) checkArgs(ctx context.Context, specs []contractSpec) ([]plannedDeploy, error) {
+	resolve := r.pendingResolver(specs)
+	var plan []plannedDeploy
+	for _, spec := range specs {
+		spec, err := substituteSpec(spec.forNetwork(r.name), resolve)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", spec.Name, err)
+		}
+		art, err := r.loadArtifact(spec.Contract)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", spec.Name, err)
+		}
+		args, err := r.ens.resolveArgs(ctx, art.ABI.Constructor.Inputs, spec.Args, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", spec.Name, err)
+		}
+		params, err := convertArgs("constructor", art.ABI.Constructor.Inputs, args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", spec.Name, err)
+		}
+		code, err := art.creationCode(params)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", spec.Name, err)
+		}
+		// Checked here rather than in deploy so every oversized contract
+		// is reported before anything is sent.
+		if err := checkCodeSize(r.root, art, code, r.opts.AllowOversize); err != nil {
+			return nil, fmt.Errorf("%s: %w", spec.Name, err)
+		}
+		if p := spec.Proxy; p != nil && p.Initializer != "" {
+			args, err := r.ens.resolveMethodArgs(ctx, art.ABI, p.Initializer, p.Args, nil)
+			if err != nil {
+				return nil, fmt.Errorf("%s: initializer: %w", spec.Name, err)
+			}
+			if _, err := encodeCall(art.ABI, p.Initializer, args); err != nil {
+				return nil, fmt.Errorf("%s: initializer: %w", spec.Name, err)
+			}
+		}
+		plan = append(plan, plannedDeploy{spec: spec, artifact: art, initCode: code})
+	}
+	return plan, nil
+}
+
+// pendingResolver resolves ${Name.address} references before specs are
+// deployed. Addresses of contracts yet to be deployed are not known; a
+// stand-in derived from the name, which is never the zero address, will do
+// for type checking.
+func (r *networkRun) pendingResolver(specs []contractSpec) func(string) (common.Address, error) {
+	pending := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		pending[spec.Name] = true
+	}
+	return func(name string) (common.Address, error) {
+		if pending[name] {
+			return common.BytesToAddress(crypto.Keccak256([]byte(name))), nil
+		}
+		return r.resolveRef(name)
+	}
+}
+
+// deploySpec deploys spec, which for proxied contracts means an
+// implementation followed by its proxy. On error it returns whatever was
+// already sent.
+func (r *networkRun) deploySpec(ctx context.Context, spec contractSpec) ([]*deployment, error) {
+	if spec.Proxy != nil {
+		return r.deployProxied(ctx, spec)
+	}
+	d, err := r.deploy(ctx, spec)
+	if d == nil {
+		return nil, err
+	}
+	return []*deployment{d}, err
+}
+
+// finish records d in the registry and submits it for source verification.
+func (r *networkRun) finish(ctx context.Context, d *deployment) error {
+	r.mu.Lock()
+	r.addresses[d.Name] = d.Address
+	// Existing CREATE2 deployments keep their original registry entry.
+	existing := d.Skipped && r.registry.Contracts[d.Name] != nil
+	r.mu.Unlock()
+	if !r.opts.DryRun && !existing {
+		if err := r.record(ctx, d); err != nil {
+			return fmt.Errorf("record deployment: %w", err)
+		}
+	}
+	if r.explorer != nil && !d.Skipped {
+		logger.Info("Verifying source", "name", d.Name, "address", d.Address)
+		if err := r.explorer.verify(ctx, r.root, d.artifact, d.Address, d.ConstructorArgs); err != nil {
+			return fmt.Errorf("verify: %w", err)
+		}
+		d.Verified = true
+	}
+	return nil
+}
+
+// deploy builds the creation transaction for spec and either broadcasts it
+// or, in a dry run, simulates it. If the transaction was sent but waiting
+// for it failed, the pending deployment is returned along with the error.
+// The address is derived from the sender's nonce (the Safe's, in Safe
+// mode), or for salted specs from the CREATE2 factory, salt and init code;
+// a salted contract that is already deployed is skipped.
+func (r *networkRun) deploy(ctx context.Context, spec contractSpec) (*deployment, error) {
+	art, err := r.loadArtifact(spec.Contract)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]common.Address{}
+	args, err := r.ens.resolveArgs(ctx, art.ABI.Constructor.Inputs, spec.Args, names)
+	if err != nil {
+		return nil, err
+	}
+	params, err := convertArgs("constructor", art.ABI.Constructor.Inputs, args)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.linkLibraries(ctx, art); err != nil {
+		return nil, err
+	}
+	code, err := art.creationCode(params)
+	if err != nil {
+		return nil, err
+	}
+	codeHash := crypto.Keccak256Hash(code)
+	// Salted contracts are looked for at their address instead.
+	if spec.Salt == "" && !r.opts.ForceRedeploy {
+		if existing, err := r.identicalDeployment(ctx, spec, art, code, codeHash); existing != nil || err != nil {
+			if existing != nil && len(names) > 0 {
+				existing.ENS = names
+			}
+			return existing, err
+		}
+	}
+	if err := r.checkDeployPolicy(art.Name); err != nil {
+		return nil, err
+	}
+	value, _ := parseWei(spec.Value)
+
+	from := r.from()
+	lane := r.nextSender()
+	if lane != nil {
+		from = lane.Address()
+	}
+	d := &deployment{
+		Name:            spec.Name,
+		Contract:        art.Name,
+		Deployer:        from,
+		Args:            spec.Args,
+		ConstructorArgs: code[len(art.Bytecode):],
+		CodeHash:        codeHash,
+		artifact:        art,
+	}
+	if len(names) > 0 {
+		d.ENS = names
+	}
+	create := txFields{Value: value, Data: code, Label: fmt.Sprintf("deploy %s as %s(%s)", art.Name, spec.Name, r.book.formatValues(params))}
+
+	if spec.Salt != "" {
+		salt, _ := parseSalt(spec.Salt)
+		d.Salt = &salt
+	}
+	fields, salted, err := r.chain.deployTx(ctx, r, art, create, d.Salt)
+	if err != nil {
+		return nil, err
+	}
+	fields.Sender = lane
+	if salted != nil {
+		d.Address = *salted
+		exists, err := r.existingCreate2(ctx, d.Address, art)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			d.Skipped = true
+			return d, nil
+		}
+	}
+
+	if r.safe != nil && d.Salt == nil {
+		d.Address = crypto.CreateAddress(from, r.safe.creates)
+	}
+	if r.userOp != nil && d.Salt == nil {
+		factory, err := r.create2Factory(ctx)
+		if err != nil {
+			return nil, err
+		}
+		d.Address = create2Address(factory, r.userOp.salt(), code)
+	}
+
+	sent, err := r.transact(ctx, fields, spec.Gas)
+	if sent != nil && r.safe == nil && r.userOp == nil && d.Salt == nil {
+		// The nonce is only taken as the transaction is sent, which in a
+		// parallel run may be after other deployments.
+		addr, aerr := r.chain.createdAddress(ctx, r, from, sent)
+		if aerr != nil && err == nil {
+			err = aerr
+		}
+		d.Address = addr
+	}
+	if err != nil {
+		if sent != nil && sent.Reverted {
+			reason := revertReason(err, append([]abi.ABI{art.ABI}, projectABIs(r.root)...)...)
+			if len(d.ConstructorArgs) > 0 {
+				reason += " (constructor arguments " + hexutil.Encode(d.ConstructorArgs) + ")"
+			}
+			return nil, &callError{sig: "constructor reverted", reason: reason, err: err}
+		}
+		if sent != nil && sent.Hash != (common.Hash{}) {
+			// Sent, but the wait was cut short: the caller can checkpoint
+			// the pending transaction so -resume picks it up.
+			d.TxHash, d.Gas, d.Fees = sent.Hash, sent.Gas, sent.Fees
+			return d, err
+		}
+		return nil, err
+	}
+	d.TxHash, d.Gas, d.Fees = sent.Hash, sent.Gas, sent.Fees
+	if sent.Receipt != nil {
+		d.BlockNumber, d.BlockHash, d.GasUsed, d.GasPrice = sent.Receipt.BlockNumber.Uint64(), sent.Receipt.BlockHash, sent.Receipt.GasUsed, sent.Receipt.EffectiveGasPrice
+		d.L1Fee = r.receiptL1Fee(ctx, d.TxHash)
+	}
+	if !r.opts.DryRun {
+		logger.Info("Deployed", "network", r.name, "name", d.Name, "address", d.Address, "tx", d.TxHash)
+	}
+	return d, nil
+}
+
+// sentTx describes a transaction sent (or, in a dry run, simulated) by
+// transact.
+type sentTx struct {
+	Hash  common.Hash
+	Nonce uint64
+	Gas   uint64
+	Fees  fees
+	// Reverted is set when simulation, or the mined receipt, showed the
+	// call reverted.
+	Reverted bool
+	// Receipt is set once the transaction has the configured confirmations.
+	Receipt *types.Receipt
+}
+
+// transact sends a transaction, as sendTransaction does. Transactions to a
+// contract run between the pre- and post-send hooks; creations are covered
+// by the deploy hooks.
+func (r *networkRun) transact(ctx context.Context, fields txFields, spec gasConfig) (*sentTx, error) {
+	if fields.To == nil {
+		return r.sendTransaction(ctx, fields, spec)
+	}
+	if err := r.runHooks(ctx, sendHookEvent(hookPreSend, fields, nil, nil)); err != nil {
+		return nil, err
+	}
+	sent, err := r.sendTransaction(ctx, fields, spec)
+	if herr := r.runHooks(context.WithoutCancel(ctx), sendHookEvent(hookPostSend, fields, sent, err)); herr != nil {
+		err = errors.Join(err, herr)
+	}
+	return sent, err
+}
+
+// sendTransaction prices, signs and broadcasts a transaction from the
+// run's sender, or in Safe mode proposes it to the Safe and waits until it
+// is executed; with a relay, calls are handed to the relay service. In a
+// dry run it only estimates gas and simulates the call;
+// the returned error then carries the decoded revert reason.
+func (r *networkRun) sendTransaction(ctx context.Context, fields txFields, spec gasConfig) (*sentTx, error) {
+	g := spec.merge(r.gas)
+	// A Safe transaction is executed whenever its owners get to it, so
+	// there is nothing to hold back.
+	if g.WaitBaseFee != "" && !r.opts.DryRun && r.safe == nil {
+		if err := r.waitForBaseFee(ctx, g); err != nil {
+			return nil, err
+		}
+	}
+	f, err := r.quoteFees(ctx, g)
+	if err != nil {
+		return nil, err
+	}
+	msg := ethereum.CallMsg{From: r.from(), To: fields.To, Value: fields.Value, Data: fields.Data, Gas: g.Limit}
+	if r.relayed(fields) {
+		msg.From = r.relay.sender(r)
+	}
+	if fields.Sender != nil {
+		msg.From = fields.Sender.Address()
+	}
+	if fields.Blobs != nil {
+		if err := r.checkBlobTx(fields, f); err != nil {
+			return nil, err
+		}
+		if f.BlobFeeCap, err = r.quoteBlobFee(ctx, g); err != nil {
+			return nil, err
+		}
+		f.BlobGas = blobGas(fields.Blobs)
+		msg.BlobHashes, msg.BlobGasFeeCap = fields.Blobs.BlobHashes(), f.BlobFeeCap
+	}
+	if r.wantsAccessList(g, fields) {
+		if list := r.createAccessList(ctx, msg); list != nil {
+			fields.AccessList, msg.AccessList = list, list
+		}
+	}
+	gas := g.Limit
+	if gas == 0 || r.opts.DryRun {
+		estimated, err := r.chain.estimateGas(ctx, r, msg, fields)
+		if err != nil {
+			if r.opts.Trace {
+				r.printTxTrace(ctx, common.Hash{}, msg)
+			}
+			return &sentTx{Reverted: true}, &callError{sig: "estimate gas", reason: revertReason(err), err: reverted(err)}
+		}
+		if gas == 0 {
+			gas = withBuffer(estimated, g.buffer())
+		}
+	}
+	f.L1Fee = r.quoteL1Fee(ctx, fields, gas, f, g.Limit == 0)
+	if err := checkBudget(gas, f, g.MaxCost); err != nil {
+		return nil, err
+	}
+	sent := &sentTx{Gas: gas, Fees: f}
+	msg.Gas = gas
+	if reverted, err := r.simulateTx(ctx, msg); err != nil {
+		sent.Reverted = reverted
+		return sent, err
+	}
+
+	if r.opts.DryRun {
+		// For deployments, running the init code returns the runtime code
+		// or the revert data if the constructor rejects the arguments.
+		if r.opts.Trace {
+			r.printTxTrace(ctx, common.Hash{}, msg)
+		}
+		if err := r.chain.call(ctx, r, msg, fields); err != nil {
+			sent.Reverted = true
+			return sent, &callError{reason: revertReason(err), err: reverted(err)}
+		}
+		switch {
+		case r.userOp != nil:
+			r.userOp.nonce = new(big.Int).Add(r.userOp.nonce, big.NewInt(1))
+		case r.relayed(fields):
+			// The relayer's nonce, not the signer's.
+		case fields.Sender != nil:
+			fields.Sender.mu.Lock()
+			sent.Nonce = fields.Sender.nonce
+			fields.Sender.nonce++
+			fields.Sender.mu.Unlock()
+		case r.safe == nil:
+			r.mu.Lock()
+			sent.Nonce = r.nonce
+			r.nonce++
+			r.mu.Unlock()
+		case fields.To == nil:
+			r.safe.creates++
+		}
+		return sent, nil
+	}
+	if err := r.confirmTx(ctx, fields, gas, f); err != nil {
+		return nil, err
+	}
+	if r.safe != nil {
+		// The executing owner pays for gas; the estimate is only reported.
+		safeSent, err := r.safe.submit(ctx, r, fields)
+		if safeSent != nil {
+			r.audit(fields, safeSent.Hash, nil, gas)
+			safeSent.Gas, safeSent.Fees = gas, f
+			if safeSent.Receipt != nil && safeSent.Receipt.Status != types.ReceiptStatusSuccessful {
+				safeSent.Reverted = true
+			}
+		}
+		return safeSent, err
+	}
+	if r.userOp != nil {
+		opSent, opHash, err := r.userOp.submit(ctx, r, fields, f, g.MaxCost)
+		if opSent != nil {
+			rec := r.auditRecord(fields, opSent.Hash, nil, opSent.Gas)
+			rec.UserOpHash = &opHash
+			r.writeAudit(rec)
+			opSent.Fees = f
+		}
+		return opSent, err
+	}
+	if r.relayed(fields) {
+		// The relayer pays for gas; the fees are only reported.
+		relaySent, task, err := r.relay.submit(ctx, r, fields, gas)
+		if relaySent != nil {
+			rec := r.auditRecord(fields, relaySent.Hash, nil, gas)
+			rec.Relay, rec.RelayTask = r.relay.service, task
+			r.writeAudit(rec)
+			relaySent.Gas, relaySent.Fees = gas, f
+		}
+		return relaySent, err
+	}
+
+	start := time.Now()
+	sent.Hash, sent.Nonce, err = r.sendNext(ctx, f, gas, fields)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Sent transaction", "network", r.name, "tx", sent.Hash, "nonce", sent.Nonce, "gas", gas)
+	r.audit(fields, sent.Hash, &sent.Nonce, gas)
+
+	if r.opts.Confirmations == 0 {
+		return sent, nil
+	}
+	sent.Receipt, err = r.waitMined(ctx, sent.Hash)
+	if sent.Receipt != nil && r.opts.Trace {
+		r.printTxTrace(ctx, sent.Hash, msg)
+	}
+	if sent.Receipt != nil {
+		if sent.Receipt.Status != types.ReceiptStatusSuccessful {
+			sent.Reverted = true
+		}
+		logger.Info("Confirmed", "network", r.name, "tx", sent.Hash, "block", sent.Receipt.BlockNumber, "gasUsed", sent.Receipt.GasUsed, "elapsed", time.Since(start).Round(time.Millisecond))
+	}
+	return sent, err
+}
+
+// sendNext signs and broadcasts a transaction with the sender's next nonce.
+// The nonce is held until the node accepts the transaction, so parallel
+// deployments neither share nor skip one.
+func (r *networkRun) sendNext(ctx context.Context, f fees, gas uint64, fields txFields) (common.Hash, uint64, error) {
+	if fields.Sender != nil {
+		return r.sendPooled(ctx, f, gas, fields)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.reserveNonces {
+		if err := r.checkNonceReserved(ctx); err != nil {
+			return common.Hash{}, 0, err
+		}
+	}
+	hash, err := r.chain.send(ctx, r, r.nonce, f, gas, fields)
+	if err != nil {
+		metrics.add(metricErrors, 1, "network", r.name, "kind", "send")
+		return common.Hash{}, 0, err
+	}
+	metrics.add(metricTxSent, 1, "network", r.name)
+	nonce := r.nonce
+	r.nonce++
+	return hash, nonce, nil
+}
+
+// record writes d to the network's registry. Without confirmations the
+// block number is filled in when the node already has the receipt, as on an
+// automining anvil.
+func (r *networkRun) record(ctx context.Context, d *deployment) error {
+	if !d.Skipped && d.BlockNumber == 0 {
+		if receipt, err := r.client.TransactionReceipt(ctx, d.TxHash); err == nil {
+			d.BlockNumber, d.BlockHash, d.GasUsed = receipt.BlockNumber.Uint64(), receipt.BlockHash, receipt.GasUsed
+		}
+	}
+	// A proxy is recorded with its implementation's interface and sources
+	// so callers interact with it as the implementation.
+	iface := d.artifact
+	if d.Proxy != nil {
+		iface = d.Proxy.implementation
+	}
+	source := iface.Source
+	if iface.Metadata != nil {
+		if target, err := iface.Metadata.compilationTarget(); err == nil {
+			source, _, _ = strings.Cut(target, ":")
+		}
+	}
+	e := &registryEntry{
+		Contract:      iface.Name,
+		Source:        source,
+		Address:       d.Address,
+		TxHash:        d.TxHash,
+		BlockNumber:   d.BlockNumber,
+		GasUsed:       d.GasUsed,
+		Deployer:      d.Deployer,
+		Args:          d.Args,
+		EncodedArgs:   d.ConstructorArgs,
+		Salt:          d.Salt,
+		ABI:           iface.RawABI,
+		Metadata:      iface.Metadata,
+		StorageLayout: iface.StorageLayout,
+		Libraries:     iface.Libraries,
+		ENS:           d.ENS,
+		References:    d.References,
+		SourceHash:    iface.sourceHash(r.root),
+		DeployedAt:    time.Now().UTC(),
+	}
+	if d.BlockHash != (common.Hash{}) {
+		e.BlockHash = &d.BlockHash
+	}
+	if !d.Skipped {
+		e.Immutables = r.checkImmutables(ctx, d)
+	}
+	if len(iface.Bytecode) > 0 {
+		hash := crypto.Keccak256Hash(iface.Bytecode)
+		e.CreationCodeHash = &hash
+	}
+	if d.CodeHash != (common.Hash{}) {
+		e.InitCodeHash = &d.CodeHash
+	}
+	if d.artifact.Metadata != nil {
+		e.Flattened = r.writeFlattened(d)
+	}
+	if d.Proxy != nil {
+		e.Proxy = &proxyRecord{
+			Kind:           d.Proxy.Kind,
+			Contract:       d.Contract,
+			Implementation: d.Proxy.Implementation,
+		}
+	}
+	if r.opts.Attest != "" && !r.opts.Scratch && !d.Skipped {
+		e.Attestation = r.attest(ctx, d.Name, e)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// A deployment that was already there keeps its attestation and the
+	// references setters updated.
+	if old := r.registry.Contracts[d.Name]; d.Skipped && old != nil && old.Address == e.Address {
+		e.Attestation, e.Rewired = old.Attestation, old.Rewired
+	}
+	return r.registry.record(d.Name, e)
+}
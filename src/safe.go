@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// safeConfig routes a network's transactions through a Safe multisig:
+// each one is proposed to the Safe Transaction Service and the run waits
+// until the owners have signed and executed it.
+//
+//	networks:
+//	  mainnet:
+//	    rpc: ${MAINNET_RPC_URL}
+//	    safe:
+//	      address: 0x...
+//	      service: https://safe-transaction-mainnet.safe.global  # optional
+//
+// The run's signer must be one of the Safe's owners; its signature is the
+// first confirmation.
+type safeConfig struct {
+	Address string `yaml:"address"`
+	Service string `yaml:"service"`
+}
+
+// safeServices are the public Transaction Service endpoints by chain id.
+var safeServices = map[uint64]string{
+	1:        "https://safe-transaction-mainnet.safe.global",
+	10:       "https://safe-transaction-optimism.safe.global",
+	137:      "https://safe-transaction-polygon.safe.global",
+	8453:     "https://safe-transaction-base.safe.global",
+	42161:    "https://safe-transaction-arbitrum.safe.global",
+	84532:    "https://safe-transaction-base-sepolia.safe.global",
+	11155111: "https://safe-transaction-sepolia.safe.global",
+}
+
+// createCallAddress is Safe's CreateCall library (v1.4.1), delegatecalled
+// to deploy contracts from the Safe itself.
+var createCallAddress = common.HexToAddress("0x9b35Af71d77eaf8d7e40252370304687390A1A52")
+
+const (
+	safeOpCall         = 0
+	safeOpDelegateCall = 1
+
+	safePollInterval = 15 * time.Second
+)
+
+var (
+	safeABI = mustParseABI(`[
+		{"type":"function","name":"nonce","inputs":[],"outputs":[{"type":"uint256"}],"stateMutability":"view"},
+		{"type":"function","name":"isOwner","inputs":[{"name":"owner","type":"address"}],"outputs":[{"type":"bool"}],"stateMutability":"view"},
+		{"type":"function","name":"getTransactionHash","inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"},{"name":"data","type":"bytes"},{"name":"operation","type":"uint8"},{"name":"safeTxGas","type":"uint256"},{"name":"baseGas","type":"uint256"},{"name":"gasPrice","type":"uint256"},{"name":"gasToken","type":"address"},{"name":"refundReceiver","type":"address"},{"name":"_nonce","type":"uint256"}],"outputs":[{"type":"bytes32"}],"stateMutability":"view"}
+	]`)
+	createCallABI = mustParseABI(`[{"type":"function","name":"performCreate","inputs":[{"name":"value","type":"uint256"},{"name":"deploymentData","type":"bytes"}],"outputs":[{"name":"newContract","type":"address"}],"stateMutability":"nonpayable"}]`)
+)
+
+// hashSigner is implemented by signers that can sign a raw 32-byte hash,
+// as Safe confirmations require.
+type hashSigner interface {
+	SignHash(hash common.Hash) ([]byte, error)
+}
+
+// safeClient proposes transactions to one Safe.
+type safeClient struct {
+	contract *boundContract
+	service  string
+	http     *http.Client
+
+	// creates is the Safe's account nonce, which determines the address
+	// of the next contract it creates.
+	creates uint64
+	// nonce is the next Safe transaction nonce, past any already queued.
+	nonce uint64
+}
+
+// openSafe checks that the Safe exists and that the run's signer owns it.
+func (r *networkRun) openSafe(ctx context.Context, c safeConfig) (*safeClient, error) {
+	addr, err := parseAddress(c.Address)
+	if err != nil {
+		return nil, err
+	}
+	service := strings.TrimSuffix(os.ExpandEnv(c.Service), "/")
+	if service == "" {
+		if service = safeServices[r.chainID.Uint64()]; service == "" {
+			return nil, fmt.Errorf("no known Safe Transaction Service for chain %s; set service", r.chainID)
+		}
+	}
+	s := &safeClient{
+		contract: &boundContract{Address: addr, ABI: safeABI, client: r.client},
+		service:  service,
+		http:     &http.Client{Timeout: 30 * time.Second},
+	}
+	owner, err := s.contract.Call(ctx, "isOwner", r.sender.Address().Hex())
+	if err != nil {
+		return nil, fmt.Errorf("%s does not look like a Safe: %w", addr.Hex(), err)
+	}
+	if !owner[0].(bool) {
+		return nil, fmt.Errorf("signer %s is not an owner of Safe %s", r.sender.Address().Hex(), addr.Hex())
+	}
+	if s.creates, err = r.client.NonceAt(ctx, addr, nil); err != nil {
+		return nil, err
+	}
+	if s.nonce, err = s.nextNonce(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// nextNonce returns the Safe's on-chain nonce, or one past the highest
+// transaction already queued in the service.
+func (s *safeClient) nextNonce(ctx context.Context) (uint64, error) {
+	out, err := s.contract.Call(ctx, "nonce")
+	if err != nil {
+		return 0, err
+	}
+	next := out[0].(*big.Int).Uint64()
+	var queued struct {
+		Results []struct {
+			Nonce json.Number `json:"nonce"`
+		} `json:"results"`
+	}
+	path := fmt.Sprintf("/api/v1/safes/%s/multisig-transactions/?executed=false&nonce__gte=%d&ordering=-nonce&limit=1", s.contract.Address.Hex(), next)
+	if err := s.do(ctx, http.MethodGet, path, nil, &queued); err != nil {
+		return 0, err
+	}
+	if len(queued.Results) > 0 {
+		if n, err := queued.Results[0].Nonce.Int64(); err == nil && uint64(n) >= next {
+			next = uint64(n) + 1
+		}
+	}
+	return next, nil
+}
+
+// submit proposes fields as a Safe transaction signed by the run's signer
+// and waits until the owners execute it. Contract creations go through
+// CreateCall so the Safe itself is the deployer.
+func (s *safeClient) submit(ctx context.Context, r *networkRun, fields txFields) (*sentTx, error) {
+	value := fields.Value
+	if value == nil {
+		value = new(big.Int)
+	}
+	to, data, op := fields.To, fields.Data, uint8(safeOpCall)
+	if to == nil {
+		packed, err := createCallABI.Pack("performCreate", value, fields.Data)
+		if err != nil {
+			return nil, err
+		}
+		to, data, op, value = &createCallAddress, packed, safeOpDelegateCall, new(big.Int)
+	}
+	return s.propose(ctx, r, *to, value, data, op, fields.To == nil)
+}
+
+// propose signs a Safe transaction, proposes it to the service and waits
+// until the owners execute it. creates marks a CreateCall deployment, which
+// uses up one of the Safe's CREATE nonces.
+func (s *safeClient) propose(ctx context.Context, r *networkRun, to common.Address, value *big.Int, data []byte, op uint8, creates bool) (*sentTx, error) {
+	hs, ok := r.sender.(hashSigner)
+	if !ok {
+		return nil, errors.New("the signer cannot sign Safe transactions; use an env, keystore or mnemonic signer")
+	}
+	nonce := s.nonce
+	out, err := s.contract.Call(ctx, "getTransactionHash", to.Hex(), value, hexutil.Encode(data), int(op), 0, 0, 0,
+		common.Address{}, common.Address{}, nonce)
+	if err != nil {
+		return nil, err
+	}
+	safeTxHash := common.Hash(out[0].([32]byte))
+	sig, err := hs.SignHash(safeTxHash)
+	if err != nil {
+		return nil, fmt.Errorf("sign: %w", err)
+	}
+	proposal := map[string]interface{}{
+		"to":                      to.Hex(),
+		"value":                   value.String(),
+		"data":                    hexutil.Encode(data),
+		"operation":               op,
+		"safeTxGas":               "0",
+		"baseGas":                 "0",
+		"gasPrice":                "0",
+		"gasToken":                common.Address{}.Hex(),
+		"refundReceiver":          common.Address{}.Hex(),
+		"nonce":                   nonce,
+		"contractTransactionHash": safeTxHash.Hex(),
+		"sender":                  r.sender.Address().Hex(),
+		"signature":               hexutil.Encode(sig),
+		"origin":                  "Homework5 deploy",
+	}
+	path := fmt.Sprintf("/api/v1/safes/%s/multisig-transactions/", s.contract.Address.Hex())
+	if err := s.do(ctx, http.MethodPost, path, proposal, nil); err != nil {
+		return nil, fmt.Errorf("propose: %w", err)
+	}
+	s.nonce++
+	if creates {
+		s.creates++
+	}
+	logger.Info("Proposed Safe transaction", "safeTxHash", safeTxHash, "nonce", nonce, "safe", s.contract.Address)
+
+	txHash, err := s.waitExecuted(ctx, safeTxHash)
+	if err != nil {
+		return nil, err
+	}
+	sent := &sentTx{Hash: txHash}
+	if r.opts.Confirmations > 0 {
+		sent.Receipt, err = r.waitMined(ctx, txHash)
+	}
+	return sent, err
+}
+
+// waitExecuted polls the service until the Safe transaction is executed,
+// reporting new confirmations as they arrive.
+func (s *safeClient) waitExecuted(ctx context.Context, safeTxHash common.Hash) (common.Hash, error) {
+	seen := -1
+	for {
+		var tx struct {
+			ConfirmationsRequired int               `json:"confirmationsRequired"`
+			Confirmations         []json.RawMessage `json:"confirmations"`
+			IsExecuted            bool              `json:"isExecuted"`
+			IsSuccessful          *bool             `json:"isSuccessful"`
+			TransactionHash       *common.Hash      `json:"transactionHash"`
+		}
+		if err := s.do(ctx, http.MethodGet, "/api/v1/multisig-transactions/"+safeTxHash.Hex()+"/", nil, &tx); err != nil {
+			return common.Hash{}, err
+		}
+		if tx.IsExecuted && tx.TransactionHash != nil {
+			if tx.IsSuccessful != nil && !*tx.IsSuccessful {
+				return *tx.TransactionHash, fmt.Errorf("Safe transaction %s failed in %s", safeTxHash.Hex(), tx.TransactionHash.Hex())
+			}
+			return *tx.TransactionHash, nil
+		}
+		if n := len(tx.Confirmations); n != seen {
+			logger.Info("Waiting for Safe execution", "safeTxHash", safeTxHash, "confirmations", n, "required", tx.ConfirmationsRequired)
+			seen = n
+		}
+		if err := sleepCtx(ctx, safePollInterval); err != nil {
+			return common.Hash{}, err
+		}
+	}
+}
+
+func (s *safeClient) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.service+path, payload)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("safe service: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("safe service: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("safe service: decode response: %w", err)
+	}
+	return nil
+}
+
+// from returns the account transactions are sent from: the Safe in Safe
+// mode, the smart account with user operations, else the signer.
+func (r *networkRun) from() common.Address {
+	if r.userOp != nil {
+		return r.userOp.account
+	}
+	if r.safe != nil {
+		return r.safe.contract.Address
+	}
+	return r.sender.Address()
+}
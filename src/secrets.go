@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// secretPattern matches a ${secret:<provider>:<reference>} placeholder.
+// Any string in a manifest may contain one:
+//
+//	${secret:env:TREASURY_ADDRESS}
+//	${secret:file:~/.secrets/deployer.key}
+//	${secret:vault:secret/data/deploy#treasury}   # VAULT_ADDR, VAULT_TOKEN
+//	${secret:aws:prod/deployer#privateKey}        # AWS Secrets Manager, via the aws CLI
+//	${secret:gcp:my-project/deployer-key@3}       # GCP Secret Manager, via gcloud
+//	${secret:keychain:loadtest-mnemonic}          # OS keychain, see keychain add
+//
+// A #field suffix picks one field of a JSON secret.
+var secretPattern = regexp.MustCompile(`\$\{secret:([a-z]+):([^}]+)\}`)
+
+const secretTimeout = 30 * time.Second
+
+// secretResolver fetches the secrets a manifest refers to, each once.
+type secretResolver struct {
+	// dir is the manifest's directory; relative file paths start there.
+	dir   string
+	cache map[string]string
+}
+
+func newSecretResolver(dir string) *secretResolver {
+	return &secretResolver{dir: dir, cache: map[string]string{}}
+}
+
+// expandNode replaces the placeholders in every scalar under n.
+func (s *secretResolver) expandNode(ctx context.Context, n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		v, err := s.expand(ctx, n.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n.Line, err)
+		}
+		n.Value = v
+		return nil
+	}
+	for _, child := range n.Content {
+		if err := s.expandNode(ctx, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expand replaces the placeholders in v with the secrets they name.
+func (s *secretResolver) expand(ctx context.Context, v string) (string, error) {
+	var err error
+	out := secretPattern.ReplaceAllStringFunc(v, func(placeholder string) string {
+		m := secretPattern.FindStringSubmatch(placeholder)
+		secret, ferr := s.fetch(ctx, m[1], m[2])
+		if ferr != nil && err == nil {
+			err = fmt.Errorf("%s: %w", placeholder, ferr)
+		}
+		return secret
+	})
+	return out, err
+}
+
+func (s *secretResolver) fetch(ctx context.Context, provider, ref string) (string, error) {
+	key := provider + ":" + ref
+	if v, ok := s.cache[key]; ok {
+		return v, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, secretTimeout)
+	defer cancel()
+	ref, field, _ := strings.Cut(ref, "#")
+	var v string
+	var err error
+	switch provider {
+	case "env":
+		var ok bool
+		if v, ok = os.LookupEnv(ref); !ok {
+			return "", fmt.Errorf("environment variable %s is not set", ref)
+		}
+	case "file":
+		path := expandHome(ref)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(s.dir, path)
+		}
+		var raw []byte
+		if raw, err = os.ReadFile(path); err == nil {
+			v = strings.TrimSpace(string(raw))
+		}
+	case "vault":
+		v, err = vaultSecret(ctx, ref, field)
+		field = ""
+	case "aws":
+		v, err = commandOutput(ctx, "aws", "secretsmanager", "get-secret-value", "--secret-id", ref, "--query", "SecretString", "--output", "text")
+	case "gcp":
+		v, err = commandOutput(ctx, "gcloud", gcpSecretArgs(ref)...)
+	case "keychain":
+		v, err = keychainGet(ctx, ref)
+	default:
+		return "", fmt.Errorf("unknown secret provider %q (want env, file, vault, aws, gcp or keychain)", provider)
+	}
+	if err != nil {
+		return "", err
+	}
+	if field != "" {
+		if v, err = jsonField([]byte(v), field); err != nil {
+			return "", err
+		}
+	}
+	s.cache[key] = v
+	return v, nil
+}
+
+// vaultSecret reads a secret from HashiCorp Vault's HTTP API. Both KV
+// versions are understood; version 2 paths include data/, e.g.
+// secret/data/deploy. Without a field, the secret must have exactly one.
+func vaultSecret(ctx context.Context, path, field string) (string, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	token := os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return "", fmt.Errorf("VAULT_ADDR and VAULT_TOKEN must be set to read vault secrets")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault: %s", resp.Status)
+	}
+	var out struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", fmt.Errorf("vault: %w", err)
+	}
+	data := out.Data
+	// KV version 2 nests the secret, next to its metadata.
+	if nested, ok := data["data"]; ok {
+		if _, hasMeta := data["metadata"]; hasMeta {
+			data = nil
+			if err := json.Unmarshal(nested, &data); err != nil {
+				return "", fmt.Errorf("vault: %w", err)
+			}
+		}
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	if field == "" {
+		if len(data) != 1 {
+			return "", fmt.Errorf("vault secret %s has fields %s; pick one with #field", path, strings.Join(sortedKeys(data), ", "))
+		}
+		field = sortedKeys(data)[0]
+	}
+	return jsonField(raw, field)
+}
+
+// gcpSecretArgs builds the gcloud arguments for a PROJECT/NAME@VERSION
+// reference; the project defaults to gcloud's and the version to latest.
+func gcpSecretArgs(ref string) []string {
+	ref, version, ok := strings.Cut(ref, "@")
+	if !ok {
+		version = "latest"
+	}
+	args := []string{"secrets", "versions", "access", version}
+	if project, name, ok := strings.Cut(ref, "/"); ok {
+		return append(args, "--secret", name, "--project", project)
+	}
+	return append(args, "--secret", ref)
+}
+
+// commandOutput runs a cloud CLI, which takes care of its own credentials
+// (profiles, SSO, instance roles), and returns its trimmed output.
+func commandOutput(ctx context.Context, name string, args ...string) (string, error) {
+	if _, err := exec.LookPath(name); err != nil {
+		return "", fmt.Errorf("%s is not installed", name)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %w: %s", name, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
+
+// jsonField returns field of the JSON object raw. String values are
+// returned as is, anything else as JSON.
+func jsonField(raw []byte, field string) (string, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object, so it has no field %s", field)
+	}
+	v, ok := obj[field]
+	if !ok {
+		return "", fmt.Errorf("secret has no field %s (has %s)", field, strings.Join(sortedKeys(obj), ", "))
+	}
+	var s string
+	if err := json.Unmarshal(v, &s); err == nil {
+		return s, nil
+	}
+	return string(v), nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+func runSend(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("send", &rpcURL)
+	rf := addRunFlags(fs)
+	to := fs.String("to", "", "contract address, ENS name or registry name")
+	method := fs.String("method", "", "method to call, by name or signature")
+	methodArgs := fs.String("args", "[]", "method arguments as a JSON array")
+	value := fs.String("value", "0", "value to send with the call (e.g. 0, 1gwei, 0.1ether)")
+	contractRef := fs.String("contract", "", "artifact (File.sol or File.sol:Name) providing the ABI; defaults to the registry entry's")
+	var blobFiles []string
+	fs.Func("blob", "file whose data the transaction carries in blobs (EIP-4844); repeatable, and -method is then optional", func(v string) error {
+		blobFiles = append(blobFiles, v)
+		return nil
+	})
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *to == "" || (*method == "" && len(blobFiles) == 0) {
+		return errors.New("-to and -method are required")
+	}
+	params, err := parseJSONArgs(*methodArgs)
+	if err != nil {
+		return err
+	}
+	wei, err := parseWei(*value)
+	if err != nil {
+		return fmt.Errorf("-value: %w", err)
+	}
+
+	m, selected, err := rf.load(ctx, fs, rpcURL, nil)
+	if err != nil {
+		return err
+	}
+	if len(selected) != 1 {
+		return errors.New("send runs against a single network; pick one with -network")
+	}
+	run, err := openNetworkRun(ctx, m, selected[0], rf.options())
+	if err != nil {
+		return err
+	}
+	defer run.close()
+
+	var c *boundContract
+	if *method == "" && *contractRef == "" && strings.HasPrefix(*to, "0x") {
+		// Blobs alone need no ABI, e.g. for a rollup's batch inbox.
+		c = &boundContract{client: run.client}
+		if c.Address, err = parseAddress(*to); err != nil {
+			return err
+		}
+	} else if c, err = bindContract(ctx, run.client, run.registry, run.root, *to, *contractRef); err != nil {
+		return err
+	}
+	fields := txFields{Value: wei}
+	if *method != "" {
+		if params, err = run.ens.resolveMethodArgs(ctx, c.ABI, *method, params, nil); err != nil {
+			return err
+		}
+		if fields.Data, err = encodeCall(c.ABI, *method, params); err != nil {
+			return err
+		}
+	}
+	if fields.Blobs, err = run.loadBlobs(blobFiles); err != nil {
+		return err
+	}
+	what := *method
+	if what == "" {
+		what = fmt.Sprintf("blob transaction (%d blobs)", len(fields.Blobs.Blobs))
+	}
+	sent, err := c.transact(ctx, run, fields)
+	if err != nil {
+		if sent != nil && sent.Reverted {
+			return fmt.Errorf("%s reverted: %w", what, err)
+		}
+		return err
+	}
+
+	if rf.output == outputJSON {
+		return printJSON(newTxReport(run, c.Address, *method, sent, rf.dryRun))
+	}
+	if rf.dryRun {
+		fmt.Printf("DRY RUN: %s on %s would succeed (gas %d)\n", what, c.Address.Hex(), sent.Gas)
+		return nil
+	}
+	run.printSent(sent)
+	return nil
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// messageSigner is implemented by signers that can sign off-chain
+// messages: personal_sign text and EIP-712 typed data. Signatures are 65
+// bytes with v as 27 or 28.
+type messageSigner interface {
+	SignText(ctx context.Context, text []byte) ([]byte, error)
+	SignTypedData(ctx context.Context, data apitypes.TypedData) ([]byte, error)
+}
+
+// typedDataHash returns the EIP-712 digest of data and the 66-byte
+// "\x19\x01" || domainSeparator || hashStruct(message) preimage it hashes.
+func typedDataHash(data apitypes.TypedData) (common.Hash, []byte, error) {
+	hash, raw, err := apitypes.TypedDataAndHash(data)
+	if err != nil {
+		return common.Hash{}, nil, fmt.Errorf("typed data: %w", err)
+	}
+	return common.BytesToHash(hash), []byte(raw), nil
+}
+
+func (s *keySigner) SignText(_ context.Context, text []byte) ([]byte, error) {
+	return s.SignHash(common.BytesToHash(accounts.TextHash(text)))
+}
+
+func (s *keySigner) SignTypedData(_ context.Context, data apitypes.TypedData) ([]byte, error) {
+	hash, _, err := typedDataHash(data)
+	if err != nil {
+		return nil, err
+	}
+	return s.SignHash(hash)
+}
+
+func (s *nodeSigner) SignText(ctx context.Context, text []byte) ([]byte, error) {
+	var sig hexutil.Bytes
+	if err := s.client.Client().CallContext(ctx, &sig, "personal_sign", hexutil.Bytes(text), s.from); err != nil {
+		return nil, err
+	}
+	return normalizeV(sig), nil
+}
+
+func (s *nodeSigner) SignTypedData(ctx context.Context, data apitypes.TypedData) ([]byte, error) {
+	var sig hexutil.Bytes
+	if err := s.client.Client().CallContext(ctx, &sig, "eth_signTypedData_v4", s.from, data); err != nil {
+		return nil, err
+	}
+	return normalizeV(sig), nil
+}
+
+func (s *hardwareSigner) SignText(_ context.Context, text []byte) ([]byte, error) {
+	logger.Info("Confirm the message on your device")
+	sig, err := s.wallet.SignText(s.account, text)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeV(sig), nil
+}
+
+// SignTypedData has the device sign the domain and message hashes; Ledger
+// supports this, Trezor does not.
+func (s *hardwareSigner) SignTypedData(_ context.Context, data apitypes.TypedData) ([]byte, error) {
+	_, raw, err := typedDataHash(data)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Confirm the typed data on your device", "primaryType", data.PrimaryType)
+	sig, err := s.wallet.SignData(s.account, accounts.MimetypeTypedData, raw)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeV(sig), nil
+}
+
+// normalizeV returns sig with a 0 or 1 recovery id raised to 27 or 28.
+func normalizeV(sig []byte) []byte {
+	if len(sig) == crypto.SignatureLength && sig[64] < 27 {
+		sig = append([]byte{}, sig...)
+		sig[64] += 27
+	}
+	return sig
+}
+
+// recoverSigner returns the address that produced sig over hash.
+func recoverSigner(hash common.Hash, sig []byte) (common.Address, error) {
+	if len(sig) != crypto.SignatureLength {
+		return common.Address{}, fmt.Errorf("signature is %d bytes, want %d", len(sig), crypto.SignatureLength)
+	}
+	sig = append([]byte{}, sig...)
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+	pub, err := crypto.SigToPub(hash.Bytes(), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// signedMessage is what sign and verify-sig operate on: either text, as
+// for personal_sign, or EIP-712 typed data.
+type signedMessage struct {
+	text  []byte
+	typed *apitypes.TypedData
+}
+
+// readMessage takes the -message text, where a 0x prefix means hex bytes,
+// or the -typed-data JSON file, "-" meaning stdin.
+func readMessage(message, typedData string) (signedMessage, error) {
+	switch {
+	case message != "" && typedData != "":
+		return signedMessage{}, errors.New("-message and -typed-data are mutually exclusive")
+	case message != "":
+		if strings.HasPrefix(message, "0x") {
+			b, err := hexutil.Decode(message)
+			if err != nil {
+				return signedMessage{}, fmt.Errorf("-message: %w", err)
+			}
+			return signedMessage{text: b}, nil
+		}
+		return signedMessage{text: []byte(message)}, nil
+	case typedData != "":
+		var raw []byte
+		var err error
+		if typedData == "-" {
+			raw, err = io.ReadAll(os.Stdin)
+		} else {
+			raw, err = os.ReadFile(typedData)
+		}
+		if err != nil {
+			return signedMessage{}, err
+		}
+		var data apitypes.TypedData
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return signedMessage{}, fmt.Errorf("parse %s: %w", typedData, err)
+		}
+		return signedMessage{typed: &data}, nil
+	}
+	return signedMessage{}, errors.New("-message or -typed-data is required")
+}
+
+// hash returns the digest a signature of m covers.
+func (m signedMessage) hash() (common.Hash, error) {
+	if m.typed != nil {
+		hash, _, err := typedDataHash(*m.typed)
+		return hash, err
+	}
+	return common.BytesToHash(accounts.TextHash(m.text)), nil
+}
+
+// sign signs m with s.
+func (m signedMessage) sign(ctx context.Context, s messageSigner) ([]byte, error) {
+	if m.typed != nil {
+		return s.SignTypedData(ctx, *m.typed)
+	}
+	return s.SignText(ctx, m.text)
+}
+
+// signatureReport is the output of sign, with the signature also split
+// into v, r and s for contracts such as castVoteBySig that take them
+// separately.
+type signatureReport struct {
+	Signer    common.Address `json:"signer"`
+	Hash      common.Hash    `json:"hash"`
+	Signature hexutil.Bytes  `json:"signature"`
+	V         uint8          `json:"v"`
+	R         common.Hash    `json:"r"`
+	S         common.Hash    `json:"s"`
+}
+
+// openMessageSigner opens the configured signer for signing messages,
+// dialling rpcURL only for the node signer. The returned function closes it.
+func openMessageSigner(ctx context.Context, sc signerConfig, rpcURL string) (signer, messageSigner, func(), error) {
+	var client *ethclient.Client
+	if sc.kind() == signerNode {
+		var err error
+		if client, err = dial(ctx, rpcURL); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	closeSigner := func() {
+		if client != nil {
+			client.Close()
+		}
+	}
+	s, err := newSigner(ctx, sc, client)
+	if err != nil {
+		closeSigner()
+		return nil, nil, nil, fmt.Errorf("signer: %w", err)
+	}
+	if c, ok := s.(io.Closer); ok {
+		closeClient := closeSigner
+		closeSigner = func() {
+			c.Close()
+			closeClient()
+		}
+	}
+	ms, ok := s.(messageSigner)
+	if !ok {
+		closeSigner()
+		return nil, nil, nil, fmt.Errorf("the %s signer cannot sign messages", sc.kind())
+	}
+	return s, ms, closeSigner, nil
+}
+
+func runSign(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("sign", &rpcURL)
+	message := fs.String("message", "", "text to sign as personal_sign; 0x-prefixed input is signed as raw bytes")
+	typedData := fs.String("typed-data", "", `EIP-712 typed data to sign, as an eth_signTypedData_v4 JSON file ("-" for stdin)`)
+	output := fs.String("output", outputText, "result format on stdout: text, or json")
+	sc := addSignerFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *output != outputText && *output != outputJSON {
+		return fmt.Errorf("unknown -output %q (want text or json)", *output)
+	}
+	msg, err := readMessage(*message, *typedData)
+	if err != nil {
+		return err
+	}
+	hash, err := msg.hash()
+	if err != nil {
+		return err
+	}
+
+	s, ms, closeSigner, err := openMessageSigner(ctx, *sc, rpcURL)
+	if err != nil {
+		return err
+	}
+	defer closeSigner()
+	sig, err := msg.sign(ctx, ms)
+	if err != nil {
+		return fmt.Errorf("sign: %w", err)
+	}
+	// A node or device that signed something else is caught here rather
+	// than by whoever checks the signature.
+	if got, err := recoverSigner(hash, sig); err != nil || got != s.Address() {
+		return fmt.Errorf("the signature does not recover to %s", s.Address().Hex())
+	}
+
+	report := signatureReport{
+		Signer:    s.Address(),
+		Hash:      hash,
+		Signature: sig,
+		V:         sig[64],
+		R:         common.BytesToHash(sig[:32]),
+		S:         common.BytesToHash(sig[32:64]),
+	}
+	if *output == outputJSON {
+		return printJSON(report)
+	}
+	fmt.Println("Signer:   ", report.Signer.Hex())
+	fmt.Println("Hash:     ", report.Hash.Hex())
+	fmt.Println("Signature:", report.Signature)
+	fmt.Println("v:        ", report.V)
+	fmt.Println("r:        ", report.R.Hex())
+	fmt.Println("s:        ", report.S.Hex())
+	return nil
+}
+
+func runVerifySig(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("verify-sig", &rpcURL)
+	message := fs.String("message", "", "signed personal_sign text; 0x-prefixed input is raw bytes")
+	typedData := fs.String("typed-data", "", `signed EIP-712 typed data, as a JSON file ("-" for stdin)`)
+	signature := fs.String("signature", "", "65-byte signature, hex")
+	address := fs.String("address", "", "expected signer address or registry name (default: only print the signer)")
+	network := addRegistryFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *signature == "" {
+		return errors.New("-signature is required")
+	}
+	sig, err := hexutil.Decode(*signature)
+	if err != nil {
+		return fmt.Errorf("-signature: %w", err)
+	}
+	msg, err := readMessage(*message, *typedData)
+	if err != nil {
+		return err
+	}
+	hash, err := msg.hash()
+	if err != nil {
+		return err
+	}
+	signer, err := recoverSigner(hash, sig)
+	if err != nil {
+		return fmt.Errorf("recover signer: %w", err)
+	}
+	fmt.Println("Signer:", signer.Hex())
+	if *address == "" {
+		return nil
+	}
+	want, err := resolveAddress(*address, *network)
+	if err != nil {
+		return err
+	}
+	if signer != want {
+		return fmt.Errorf("signature is not from %s", want.Hex())
+	}
+	fmt.Println("Valid signature from", want.Hex())
+	return nil
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"golang.org/x/term"
+)
+
+// signer is the account a deployment is sent from.
+type signer interface {
+	Address() common.Address
+	// SignTx returns tx signed for chainID.
+	SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+}
+
+// signerConfig selects a signer backend. In a manifest:
+//
+//	signer:
+//	  type: keystore       # node (default), env, keystore, keychain, mnemonic, ledger or trezor
+//	  keystore: ~/.foundry/keystores/deployer
+//
+// Private keys, mnemonics and passwords are never part of the manifest
+// itself: they are read from environment variables, or from a secret store
+// through a ${secret:...} reference.
+type signerConfig struct {
+	Type string `yaml:"type"`
+	// From picks one of the node's unlocked accounts for the node signer.
+	From string `yaml:"from"`
+	// Env names the variable holding a hex private key (env) or a
+	// mnemonic (mnemonic).
+	Env string `yaml:"env"`
+	// Secret is the private key or mnemonic itself, from a ${secret:...}
+	// reference; it takes precedence over Env.
+	Secret string `yaml:"secret"`
+	// Keystore is the path to an encrypted JSON key file.
+	Keystore string `yaml:"keystore"`
+	// PasswordEnv names the variable holding the keystore password; the
+	// password is prompted for when it is unset.
+	PasswordEnv string `yaml:"passwordEnv"`
+	// Password is the keystore password from a ${secret:...} reference.
+	Password string `yaml:"password"`
+	// Keychain names the key stored in the OS keychain with keychain add.
+	Keychain string `yaml:"keychain"`
+	// Path is the HD derivation path for mnemonic and hardware wallet
+	// signers; it defaults to m/44'/60'/0'/0/<index>.
+	Path  string `yaml:"path"`
+	Index uint32 `yaml:"index"`
+	// Pool spreads deployments over this many accounts of a mnemonic,
+	// from Index on; see signerPool.
+	Pool uint32 `yaml:"pool"`
+}
+
+const (
+	signerNode     = "node"
+	signerEnv      = "env"
+	signerKeystore = "keystore"
+	signerMnemonic = "mnemonic"
+	signerLedger   = "ledger"
+	signerTrezor   = "trezor"
+	signerKeychain = "keychain"
+)
+
+// addSignerFlags registers the signer selection flags on fs.
+func addSignerFlags(fs *flag.FlagSet) *signerConfig {
+	c := &signerConfig{}
+	fs.StringVar(&c.Type, "signer", "", "signer backend: node, env, keystore, keychain, mnemonic, ledger or trezor (default: inferred from the flags below)")
+	fs.StringVar(&c.From, "from", "", "node account to send from (default: the node's first account)")
+	fs.StringVar(&c.Env, "key-env", "", "environment variable holding the private key or mnemonic")
+	fs.StringVar(&c.Keystore, "keystore", "", "encrypted JSON keystore file")
+	fs.StringVar(&c.Keychain, "keychain", "", "name of a key stored in the OS keychain with keychain add")
+	fs.StringVar(&c.PasswordEnv, "password-env", "", "environment variable holding the keystore password (default: prompt)")
+	fs.StringVar(&c.Path, "hd-path", "", "HD derivation path for mnemonic and hardware wallet signers")
+	fs.Func("mnemonic-index", "account index for mnemonic and hardware wallet signers (default 0)", func(v string) error {
+		n, err := strconv.ParseUint(v, 10, 32)
+		c.Index = uint32(n)
+		return err
+	})
+	return c
+}
+
+// kind returns the configured backend, inferring it from which fields are
+// set when Type is empty.
+func (c signerConfig) kind() string {
+	switch {
+	case c.Type != "":
+		return c.Type
+	case c.Keystore != "":
+		return signerKeystore
+	case c.Keychain != "":
+		return signerKeychain
+	case c.Env != "" || c.Secret != "":
+		return signerEnv
+	}
+	return signerNode
+}
+
+func (c signerConfig) derivationPath() string {
+	if c.Path != "" {
+		return c.Path
+	}
+	return fmt.Sprintf("m/44'/60'/0'/0/%d", c.Index)
+}
+
+// isZero reports whether no signer option was configured.
+func (c signerConfig) isZero() bool {
+	return c == signerConfig{}
+}
+
+// newSigner opens the signer described by c. client is used by the node
+// signer to pick and sign with an unlocked account.
+func newSigner(ctx context.Context, c signerConfig, client *ethclient.Client) (signer, error) {
+	switch c.kind() {
+	case signerNode:
+		return newNodeSigner(ctx, client, c.From)
+	case signerEnv:
+		name, hex := "signer secret", strings.TrimSpace(c.Secret)
+		if hex == "" {
+			if name = c.Env; name == "" {
+				name = "PRIVATE_KEY"
+			}
+			if hex = strings.TrimSpace(os.Getenv(name)); hex == "" {
+				return nil, fmt.Errorf("environment variable %s is not set", name)
+			}
+		}
+		key, err := crypto.HexToECDSA(strings.TrimPrefix(hex, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid private key: %w", name, err)
+		}
+		return &keySigner{key: key}, nil
+	case signerKeystore:
+		return openKeystore(c.Keystore, c.PasswordEnv, c.Password)
+	case signerKeychain:
+		return openKeychainSigner(ctx, c.Keychain)
+	case signerMnemonic:
+		phrase := c.Secret
+		if phrase == "" {
+			name := c.Env
+			if name == "" {
+				name = "MNEMONIC"
+			}
+			if phrase = os.Getenv(name); phrase == "" {
+				return nil, fmt.Errorf("environment variable %s is not set", name)
+			}
+		}
+		key, err := deriveMnemonicKey(phrase, "", c.derivationPath())
+		if err != nil {
+			return nil, err
+		}
+		return &keySigner{key: key}, nil
+	case signerLedger, signerTrezor:
+		return openHardwareSigner(c.kind(), c.derivationPath())
+	}
+	return nil, fmt.Errorf("unknown signer type %q", c.Type)
+}
+
+// keySigner signs locally with an in-memory private key.
+type keySigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s *keySigner) Address() common.Address {
+	return crypto.PubkeyToAddress(s.key.PublicKey)
+}
+
+func (s *keySigner) SignTx(_ context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), s.key)
+}
+
+// SignHash signs hash as-is, with v as 27 or 28 the way Safe expects.
+func (s *keySigner) SignHash(hash common.Hash) ([]byte, error) {
+	sig, err := crypto.Sign(hash.Bytes(), s.key)
+	if err != nil {
+		return nil, err
+	}
+	sig[64] += 27
+	return sig, nil
+}
+
+// openKeystore decrypts the key file at path with password, else the
+// password from passwordEnv or a prompt.
+func openKeystore(path, passwordEnv, password string) (*keySigner, error) {
+	if path == "" {
+		return nil, errors.New("keystore path is required")
+	}
+	raw, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return nil, err
+	}
+	if password == "" {
+		if password, err = keystorePassword(path, passwordEnv); err != nil {
+			return nil, err
+		}
+	}
+	key, err := keystore.DecryptKey(raw, password)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt %s: %w", path, err)
+	}
+	return &keySigner{key: key.PrivateKey}, nil
+}
+
+func keystorePassword(path, env string) (string, error) {
+	if env != "" {
+		if pw, ok := os.LookupEnv(env); ok {
+			return pw, nil
+		}
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("no password for %s: set a password env var or run interactively", path)
+	}
+	return promptSecret("the password for "+path, fmt.Sprintf("Password for %s: ", path))
+}
+
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return home + "/" + rest
+		}
+	}
+	return path
+}
+
+// nodeSigner delegates signing to an account unlocked on the node, as
+// anvil and dev-mode geth provide.
+type nodeSigner struct {
+	client *ethclient.Client
+	from   common.Address
+}
+
+func newNodeSigner(ctx context.Context, client *ethclient.Client, from string) (*nodeSigner, error) {
+	if from != "" {
+		addr, err := parseAddress(from)
+		if err != nil {
+			return nil, err
+		}
+		return &nodeSigner{client: client, from: addr}, nil
+	}
+	var accounts []common.Address
+	if err := client.Client().CallContext(ctx, &accounts, "eth_accounts"); err != nil {
+		return nil, err
+	}
+	if len(accounts) == 0 {
+		return nil, errors.New("node has no unlocked accounts; configure a signer")
+	}
+	return &nodeSigner{client: client, from: accounts[0]}, nil
+}
+
+func (s *nodeSigner) Address() common.Address {
+	return s.from
+}
+
+func (s *nodeSigner) SignTx(ctx context.Context, tx *types.Transaction, _ *big.Int) (*types.Transaction, error) {
+	args := map[string]interface{}{
+		"from":  s.from,
+		"data":  hexutil.Bytes(tx.Data()),
+		"value": (*hexutil.Big)(tx.Value()),
+		"nonce": hexutil.Uint64(tx.Nonce()),
+		"gas":   hexutil.Uint64(tx.Gas()),
+	}
+	if tx.Type() == types.DynamicFeeTxType {
+		args["maxFeePerGas"] = (*hexutil.Big)(tx.GasFeeCap())
+		args["maxPriorityFeePerGas"] = (*hexutil.Big)(tx.GasTipCap())
+	} else {
+		args["gasPrice"] = (*hexutil.Big)(tx.GasPrice())
+	}
+	if tx.To() != nil {
+		args["to"] = tx.To()
+	}
+	var result json.RawMessage
+	if err := s.client.Client().CallContext(ctx, &result, "eth_signTransaction", args); err != nil {
+		return nil, err
+	}
+	// anvil returns the raw transaction, geth wraps it as {raw, tx}.
+	var raw hexutil.Bytes
+	if err := json.Unmarshal(result, &raw); err != nil {
+		var wrapped struct {
+			Raw hexutil.Bytes `json:"raw"`
+		}
+		if err := json.Unmarshal(result, &wrapped); err != nil {
+			return nil, fmt.Errorf("unexpected eth_signTransaction result: %s", result)
+		}
+		raw = wrapped.Raw
+	}
+	signed := new(types.Transaction)
+	if err := signed.UnmarshalBinary(raw); err != nil {
+		return nil, fmt.Errorf("decode signed transaction: %w", err)
+	}
+	return signed, nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// signerPool spreads a run's deployments over more accounts than the
+// signer's own, each with its nonce, so parallel deployments broadcast
+// without waiting on one another's nonce. The accounts are derived from the
+// signer's mnemonic at the indices after its own:
+//
+//	signer:
+//	  type: mnemonic
+//	  env: LOADTEST_MNEMONIC
+//	  pool: 16 # indices 0-15
+//
+// Calls, ownership transfers and everything other than deployments are
+// sent by the signer itself.
+type signerPool struct {
+	accounts []*pooledSigner
+	// next is the slot the next deployment takes, guarded by the run's mu;
+	// slot 0 is the run's own sender.
+	next int
+}
+
+// pooledSigner is one of the pool's extra accounts. mu guards nonce as the
+// run's mu does the sender's.
+type pooledSigner struct {
+	signer
+	mu    sync.Mutex
+	nonce uint64
+}
+
+// openSignerPool derives the pool's extra accounts from c and reads their
+// nonces.
+func (r *networkRun) openSignerPool(ctx context.Context, c signerConfig) (*signerPool, error) {
+	if c.kind() != signerMnemonic {
+		return nil, errors.New("pool needs a mnemonic signer, whose accounts it derives by index")
+	}
+	if c.Path != "" {
+		return nil, errors.New("pool derives accounts by index; set index instead of path")
+	}
+	if r.opts.Nonce != nil {
+		return nil, errors.New("-nonce cannot be combined with a signer pool, whose accounts each take their next nonce")
+	}
+	if r.safe != nil || r.userOp != nil {
+		return nil, errors.New("a signer pool sends from its own accounts; it cannot be combined with a Safe or user operations")
+	}
+	p := &signerPool{}
+	for i := uint32(1); i < c.Pool; i++ {
+		account := c
+		account.Index, account.Pool = c.Index+i, 0
+		s, err := newSigner(ctx, account, r.client)
+		if err != nil {
+			return nil, fmt.Errorf("pool account %d: %w", account.Index, err)
+		}
+		nonce, err := r.client.PendingNonceAt(ctx, s.Address())
+		if err != nil {
+			return nil, err
+		}
+		latest, err := r.client.NonceAt(ctx, s.Address(), nil)
+		if err != nil {
+			return nil, err
+		}
+		if nonce > latest {
+			logger.Warn("Pool account has pending transactions", "address", s.Address(), "pending", nonce-latest)
+		}
+		p.accounts = append(p.accounts, &pooledSigner{signer: s, nonce: nonce})
+	}
+	logger.Info("Deploying from a signer pool", "network", r.name, "accounts", len(p.accounts)+1, "addresses", r.poolAddresses(p))
+	return p, nil
+}
+
+// nextSender takes the account for the next deployment, round-robin; nil
+// is the run's own sender.
+func (r *networkRun) nextSender() *pooledSigner {
+	if r.pool == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	slot := r.pool.next
+	r.pool.next = (slot + 1) % (len(r.pool.accounts) + 1)
+	if slot == 0 {
+		return nil
+	}
+	return r.pool.accounts[slot-1]
+}
+
+// signerFor returns the account fields are sent from.
+func (r *networkRun) signerFor(fields txFields) signer {
+	if fields.Sender != nil {
+		return fields.Sender.signer
+	}
+	return r.sender
+}
+
+// signerOf returns the pool account with address addr, or the run's sender.
+func (r *networkRun) signerOf(addr common.Address) signer {
+	if r.pool != nil {
+		for _, a := range r.pool.accounts {
+			if a.Address() == addr {
+				return a.signer
+			}
+		}
+	}
+	return r.sender
+}
+
+// poolAddresses lists the sender and the accounts of p.
+func (r *networkRun) poolAddresses(p *signerPool) []common.Address {
+	addrs := []common.Address{r.sender.Address()}
+	if p != nil {
+		for _, a := range p.accounts {
+			addrs = append(addrs, a.Address())
+		}
+	}
+	return addrs
+}
+
+// sendPooled signs and broadcasts a deployment from a pool account, as
+// sendNext does from the sender.
+func (r *networkRun) sendPooled(ctx context.Context, f fees, gas uint64, fields txFields) (common.Hash, uint64, error) {
+	a := fields.Sender
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if r.reserveNonces {
+		if err := r.checkNonceFree(ctx, a.Address(), a.nonce); err != nil {
+			return common.Hash{}, 0, err
+		}
+	}
+	hash, err := r.chain.send(ctx, r, a.nonce, f, gas, fields)
+	if err != nil {
+		metrics.add(metricErrors, 1, "network", r.name, "kind", "send")
+		return common.Hash{}, 0, err
+	}
+	metrics.add(metricTxSent, 1, "network", r.name)
+	nonce := a.nonce
+	a.nonce++
+	return hash, nonce, nil
+}
+
+// poolShare is the most one account of a pool of n is expected to pay for
+// plan: deployments go round-robin, so each takes about one in n of them,
+// counted here as the costliest.
+func poolShare(costs []*big.Int, n int) *big.Int {
+	sorted := slices.Clone(costs)
+	slices.SortFunc(sorted, func(a, b *big.Int) int { return b.Cmp(a) })
+	share := new(big.Int)
+	for _, c := range sorted[:(len(sorted)+n-1)/n] {
+		share.Add(share, c)
+	}
+	return share
+}
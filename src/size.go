@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxCodeSize is the EIP-170 limit on deployed runtime code.
+	maxCodeSize = 24576
+	// maxInitCodeSize is the EIP-3860 limit on creation code.
+	maxInitCodeSize = 2 * maxCodeSize
+)
+
+// checkCodeSize refuses runtime code over the EIP-170 limit and creation
+// code over the EIP-3860 limit, explaining which sources take up the
+// runtime code. With allow set, oversized code only warns, for chains that
+// raise the limits.
+func checkCodeSize(root string, art *artifact, initCode []byte, allow bool) error {
+	var problems []string
+	if n := len(art.DeployedBytecode); n > maxCodeSize {
+		msg := fmt.Sprintf("%s runtime code is %d bytes, over the %d-byte EIP-170 limit by %d", art.Name, n, maxCodeSize, n-maxCodeSize)
+		if shares := codeBreakdown(root, art); len(shares) > 0 {
+			msg += "; largest contributors:"
+			for _, s := range shares[:min(len(shares), 5)] {
+				msg += fmt.Sprintf("\n  %-48s %6d bytes (%d%%)", s.source, s.bytes, s.bytes*100/n)
+			}
+		}
+		problems = append(problems, msg)
+	}
+	if n := len(initCode); n > maxInitCodeSize {
+		problems = append(problems, fmt.Sprintf("%s creation code is %d bytes, over the %d-byte EIP-3860 limit", art.Name, n, maxInitCodeSize))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	if allow {
+		for _, p := range problems {
+			logger.Warn(p)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s\nenable the optimizer, split the contract, or pass -allow-oversize if the chain allows larger code", strings.Join(problems, "\n"))
+}
+
+type sourceShare struct {
+	source string
+	bytes  int
+}
+
+// codeBreakdown attributes each runtime instruction to the source file its
+// source map entry points at, largest first. Bytes after the last mapped
+// instruction are the metadata hash and constants.
+func codeBreakdown(root string, art *artifact) []sourceShare {
+	if art.DeployedSourceMap == "" {
+		return nil
+	}
+	paths := sourcePaths(root)
+	sizes := map[string]int{}
+	entries := strings.Split(art.DeployedSourceMap, ";")
+	code := art.DeployedBytecode
+	file := "-1"
+	pc := 0
+	for _, e := range entries {
+		if pc >= len(code) {
+			break
+		}
+		if fields := strings.Split(e, ":"); len(fields) > 2 && fields[2] != "" {
+			file = fields[2]
+		}
+		size := 1
+		if op := code[pc]; op >= 0x60 && op <= 0x7f {
+			size += int(op - 0x5f)
+		}
+		// -1 and ids past the project's sources are solc's generated
+		// utility code.
+		name, ok := paths[file]
+		if !ok {
+			name = "(compiler generated)"
+		}
+		sizes[name] += size
+		pc += size
+	}
+	if pc < len(code) {
+		sizes["(metadata and data)"] += len(code) - pc
+	}
+
+	shares := make([]sourceShare, 0, len(sizes))
+	for source, n := range sizes {
+		shares = append(shares, sourceShare{source, n})
+	}
+	sort.Slice(shares, func(i, j int) bool { return shares[i].bytes > shares[j].bytes })
+	return shares
+}
+
+// sourcePaths maps source ids to paths using the newest forge build-info.
+func sourcePaths(root string) map[string]string {
+	files, _ := filepath.Glob(filepath.Join(root, "out", "build-info", "*.json"))
+	var newest string
+	var newestTime int64
+	for _, f := range files {
+		if fi, err := os.Stat(f); err == nil && fi.ModTime().UnixNano() > newestTime {
+			newest, newestTime = f, fi.ModTime().UnixNano()
+		}
+	}
+	var info struct {
+		SourceIDToPath map[string]string `json:"source_id_to_path"`
+	}
+	if raw, err := os.ReadFile(newest); err == nil {
+		json.Unmarshal(raw, &info)
+	}
+	return info.SourceIDToPath
+}
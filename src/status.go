@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func runStatus(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("status", &rpcURL)
+	address := fs.String("address", "", "optional address or registry name to inspect")
+	slots := fs.String("slots", "", "with -address, also read these storage slots, e.g. 0,1,10-20,0x360894...")
+	deployments := fs.Bool("deployments", false, "check every deployment in the registry: its receipt and the code at its address")
+	network := addRegistryFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *slots != "" && *address == "" {
+		return errors.New("-slots needs -address")
+	}
+
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return err
+	}
+	block, err := client.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Println("RPC:         ", rpcURL)
+	if info, ok := chainMetadata[chainID.Uint64()]; ok {
+		fmt.Printf("Chain ID:     %s (%s)\n", chainID, info.Name)
+	} else {
+		fmt.Println("Chain ID:    ", chainID)
+	}
+	fmt.Println("Block number:", block)
+
+	if *deployments {
+		if err := printDeploymentStatus(ctx, client, *network); err != nil {
+			return err
+		}
+	}
+	if *address == "" {
+		return nil
+	}
+	addr, err := resolveAddress(*address, *network)
+	if err != nil {
+		return err
+	}
+	balance, err := client.BalanceAt(ctx, addr, nil)
+	if err != nil {
+		return err
+	}
+	code, err := client.CodeAt(ctx, addr, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Address:     ", addr.Hex())
+	fmt.Println("Balance:     ", balance, "wei")
+	fmt.Println("Code size:   ", len(code), "bytes")
+	if site := explorerSite(chainMetadata[chainID.Uint64()].Explorer); site != "" {
+		fmt.Println("Explorer:    ", site.address(addr))
+	}
+	if *slots == "" {
+		return nil
+	}
+	keys, err := parseSlots(*slots)
+	if err != nil {
+		return err
+	}
+	values, err := batchStorage(ctx, client, addr, keys)
+	if err != nil {
+		return err
+	}
+	for i, k := range keys {
+		fmt.Printf("  slot %s: %s\n", slotLabel(k), values[i].Hex())
+	}
+	return nil
+}
+
+// maxSlotRange bounds a from-to range in -slots.
+const maxSlotRange = 10000
+
+// parseSlots reads a comma-separated list of slots and inclusive ranges of
+// slots, in decimal or 0x hex.
+func parseSlots(s string) ([]common.Hash, error) {
+	var slots []common.Hash
+	for _, part := range splitList(s) {
+		from, to, isRange := strings.Cut(part, "-")
+		lo, ok := new(big.Int).SetString(from, 0)
+		if !ok || lo.Sign() < 0 {
+			return nil, fmt.Errorf("invalid slot %q", from)
+		}
+		hi := lo
+		if isRange {
+			if hi, ok = new(big.Int).SetString(to, 0); !ok || hi.Cmp(lo) < 0 {
+				return nil, fmt.Errorf("invalid slot range %q", part)
+			}
+			if n := new(big.Int).Sub(hi, lo); n.Cmp(big.NewInt(maxSlotRange)) >= 0 {
+				return nil, fmt.Errorf("slot range %q is over %d slots", part, maxSlotRange)
+			}
+		}
+		for i := new(big.Int).Set(lo); i.Cmp(hi) <= 0; i.Add(i, big.NewInt(1)) {
+			if i.BitLen() > 256 {
+				return nil, fmt.Errorf("slot %s does not fit in 32 bytes", i)
+			}
+			slots = append(slots, common.BigToHash(i))
+		}
+	}
+	return slots, nil
+}
+
+// slotLabel is a slot's decimal number when it is small, else its hash.
+func slotLabel(k common.Hash) string {
+	if n := k.Big(); n.IsInt64() && n.Int64() < 1<<32 {
+		return n.String()
+	}
+	return k.Hex()
+}
+
+// printDeploymentStatus checks each registry deployment's transaction and
+// code, fetching all receipts and all code in batched requests.
+func printDeploymentStatus(ctx context.Context, client *ethclient.Client, network string) error {
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	reg, err := loadRegistry(root, network)
+	if err != nil {
+		return err
+	}
+	names := reg.names()
+	hashes := make([]common.Hash, len(names))
+	codes := make([]hexutil.Bytes, len(names))
+	elems := make([]rpc.BatchElem, len(names))
+	for i, name := range names {
+		e := reg.Contracts[name]
+		hashes[i] = e.TxHash
+		elems[i] = rpc.BatchElem{Method: "eth_getCode", Args: []interface{}{e.Address, "latest"}, Result: &codes[i]}
+	}
+	receipts, err := batchReceipts(ctx, client, hashes)
+	if err != nil {
+		return err
+	}
+	if err := batchCall(ctx, client, elems); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nDeployments in the %s registry:\n", network)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tADDRESS\tTX\tCODE")
+	var problems int
+	for i, name := range names {
+		e := reg.Contracts[name]
+		tx := deploymentTxStatus(e, receipts[i])
+		code := fmt.Sprintf("%d bytes", len(codes[i]))
+		switch {
+		case elems[i].Error != nil:
+			code = "error: " + elems[i].Error.Error()
+			problems++
+		case len(codes[i]) == 0:
+			code = "MISSING"
+			problems++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", name, e.Address.Hex(), tx, code)
+	}
+	w.Flush()
+	if problems > 0 {
+		return fmt.Errorf("%d deployments have no code on chain", problems)
+	}
+	return nil
+}
+
+func deploymentTxStatus(e *registryEntry, receipt *types.Receipt) string {
+	switch {
+	case e.Reorged != nil:
+		return fmt.Sprintf("REORGED out of block %d", e.Reorged.Block)
+	case receipt == nil:
+		// Safe deployments record the Safe transaction's hash, and pruned
+		// or replaced transactions are unknown to the node.
+		return "not found"
+	case receipt.Status != types.ReceiptStatusSuccessful:
+		return fmt.Sprintf("REVERTED in block %d", receipt.BlockNumber.Uint64())
+	case e.BlockNumber != 0 && receipt.BlockNumber.Uint64() != e.BlockNumber:
+		return fmt.Sprintf("mined in block %d, recorded %d (reorg?)", receipt.BlockNumber.Uint64(), e.BlockNumber)
+	}
+	return fmt.Sprintf("mined in block %d", receipt.BlockNumber.Uint64())
+}
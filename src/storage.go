@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// Storage encodings in solc's layout types.
+const (
+	encodingInplace = "inplace"
+	encodingMapping = "mapping"
+	encodingDynamic = "dynamic_array"
+	encodingBytes   = "bytes"
+)
+
+// maxStorageBytes bounds how much of a long string or bytes value is read.
+const maxStorageBytes = 64 * 1024
+
+// parseStorageLayout decodes a recorded storage layout.
+func parseStorageLayout(raw json.RawMessage) (*storageLayout, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, errors.New(`no storage layout recorded; add extra_output = ["storageLayout"] to foundry.toml and redeploy, or pass -contract`)
+	}
+	var l storageLayout
+	if err := json.Unmarshal(raw, &l); err != nil {
+		return nil, fmt.Errorf("parse storage layout: %w", err)
+	}
+	return &l, nil
+}
+
+// storageLocation is where a value lives: its first slot, the byte offset
+// within that slot for packed values, and its layout type.
+type storageLocation struct {
+	slot   *big.Int
+	offset int
+	typ    string
+}
+
+// locate resolves a variable path such as owner, balances[0xabc...],
+// proposals[3].approvals or multiSigApprovers[1] to its location. A path
+// ending in .length on a dynamic array locates the array's length.
+func (l *storageLayout) locate(path string) (storageLocation, string, error) {
+	name, rest := splitStoragePath(path)
+	var loc storageLocation
+	found := false
+	for _, v := range l.Storage {
+		if v.Label == name {
+			slot, ok := new(big.Int).SetString(v.Slot, 10)
+			if !ok {
+				return loc, "", fmt.Errorf("%s: invalid slot %q in layout", name, v.Slot)
+			}
+			loc, found = storageLocation{slot: slot, offset: v.Offset, typ: v.Type}, true
+			break
+		}
+	}
+	if !found {
+		return loc, "", fmt.Errorf("no storage variable %q in the layout", name)
+	}
+	for rest != "" {
+		t := l.Types[loc.typ]
+		switch {
+		case rest == ".length" && (t.Encoding == encodingDynamic || t.Encoding == encodingBytes):
+			return loc, "uint256", nil
+		case strings.HasPrefix(rest, "."):
+			member, more := splitStoragePath(rest[1:])
+			if len(t.Members) == 0 {
+				return loc, "", fmt.Errorf("%s: %s is not a struct", path, t.Label)
+			}
+			found = false
+			for _, m := range t.Members {
+				if m.Label == member {
+					off, _ := new(big.Int).SetString(m.Slot, 10)
+					loc, found = storageLocation{slot: off.Add(off, loc.slot), offset: m.Offset, typ: m.Type}, true
+					break
+				}
+			}
+			if !found {
+				return loc, "", fmt.Errorf("%s: %s has no member %q", path, t.Label, member)
+			}
+			rest = more
+		case strings.HasPrefix(rest, "["):
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return loc, "", fmt.Errorf("%s: missing ]", path)
+			}
+			key := strings.TrimSpace(rest[1:end])
+			var err error
+			if loc, err = l.index(loc, key); err != nil {
+				return loc, "", fmt.Errorf("%s: %w", path, err)
+			}
+			rest = rest[end+1:]
+		default:
+			return loc, "", fmt.Errorf("%s: unexpected %q", path, rest)
+		}
+	}
+	return loc, l.Types[loc.typ].Label, nil
+}
+
+// index steps into a mapping, which hashes the key with the slot, or an
+// array, whose elements are packed from the slot (static arrays) or from
+// its hash (dynamic arrays).
+func (l *storageLayout) index(loc storageLocation, key string) (storageLocation, error) {
+	t := l.Types[loc.typ]
+	if t.Encoding == encodingMapping {
+		k, err := encodeStorageKey(l.Types[t.Key].Label, key)
+		if err != nil {
+			return loc, err
+		}
+		slot := crypto.Keccak256(k, common.BigToHash(loc.slot).Bytes())
+		return storageLocation{slot: new(big.Int).SetBytes(slot), typ: t.Value}, nil
+	}
+	if t.Base == "" {
+		return loc, fmt.Errorf("%s cannot be indexed", t.Label)
+	}
+	i, ok := new(big.Int).SetString(key, 0)
+	if !ok || i.Sign() < 0 {
+		return loc, fmt.Errorf("invalid index %q", key)
+	}
+	base := loc.slot
+	switch t.Encoding {
+	case encodingDynamic:
+		base = new(big.Int).SetBytes(crypto.Keccak256(common.BigToHash(loc.slot).Bytes()))
+	case encodingInplace:
+		// A static array's label ends in its length, e.g. address[3].
+		open := strings.LastIndexByte(t.Label, '[')
+		if n, err := strconv.ParseInt(strings.TrimSuffix(t.Label[open+1:], "]"), 10, 64); err == nil && i.Cmp(big.NewInt(n)) >= 0 {
+			return loc, fmt.Errorf("index out of range for %s", t.Label)
+		}
+	}
+	size, _ := strconv.Atoi(l.Types[t.Base].NumberOfBytes)
+	if size <= 0 {
+		return loc, fmt.Errorf("unknown size of %s", l.Types[t.Base].Label)
+	}
+	if size < 32 {
+		perSlot := big.NewInt(int64(32 / size))
+		q, m := new(big.Int).DivMod(i, perSlot, new(big.Int))
+		return storageLocation{slot: q.Add(q, base), offset: int(m.Int64()) * size, typ: t.Base}, nil
+	}
+	slots := new(big.Int).Mul(i, big.NewInt(int64((size+31)/32)))
+	return storageLocation{slot: slots.Add(slots, base), typ: t.Base}, nil
+}
+
+// splitStoragePath splits the leading identifier off a path.
+func splitStoragePath(path string) (string, string) {
+	if i := strings.IndexAny(path, ".["); i >= 0 {
+		return path[:i], path[i:]
+	}
+	return path, ""
+}
+
+// encodeStorageKey encodes a mapping key the way solc hashes it: value types
+// padded to 32 bytes, strings and bytes unpadded.
+func encodeStorageKey(label, key string) ([]byte, error) {
+	switch {
+	case label == "string":
+		return []byte(strings.Trim(key, `"'`)), nil
+	case label == "bytes":
+		return hexutil.Decode(key)
+	case label == "address" || label == "address payable" || strings.HasPrefix(label, "contract "):
+		addr, err := parseAddress(key)
+		if err != nil {
+			return nil, err
+		}
+		return common.LeftPadBytes(addr.Bytes(), 32), nil
+	case label == "bool":
+		b, err := strconv.ParseBool(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool %q", key)
+		}
+		if b {
+			return common.LeftPadBytes([]byte{1}, 32), nil
+		}
+		return make([]byte, 32), nil
+	case strings.HasPrefix(label, "bytes"):
+		b, err := hexutil.Decode(key)
+		if err != nil {
+			return nil, err
+		}
+		return common.RightPadBytes(b, 32), nil
+	case strings.HasPrefix(label, "uint"), strings.HasPrefix(label, "int"), strings.HasPrefix(label, "enum "):
+		n, ok := new(big.Int).SetString(key, 0)
+		if !ok {
+			return nil, fmt.Errorf("invalid integer %q", key)
+		}
+		return math.U256Bytes(n), nil
+	}
+	return nil, fmt.Errorf("unsupported mapping key type %s", label)
+}
+
+// readStorage reads and decodes the storage variable at path in the
+// contract at addr, at block (nil for latest). Path may also be a slot
+// number, whose raw word is returned as a hash.
+func readStorage(ctx context.Context, client *ethclient.Client, addr common.Address, l *storageLayout, path string, block *big.Int) (interface{}, storageLocation, string, error) {
+	if slot, ok := new(big.Int).SetString(path, 0); ok {
+		word, err := client.StorageAt(ctx, addr, common.BigToHash(slot), block)
+		return common.BytesToHash(word), storageLocation{slot: slot}, "bytes32", err
+	}
+	if l == nil {
+		return nil, storageLocation{}, "", fmt.Errorf("%s is not a slot number, and there is no storage layout to find it in", path)
+	}
+	loc, label, err := l.locate(path)
+	if err != nil {
+		return nil, loc, "", err
+	}
+	word, err := client.StorageAt(ctx, addr, common.BigToHash(loc.slot), block)
+	if err != nil {
+		return nil, loc, label, err
+	}
+	t := l.Types[loc.typ]
+	if strings.HasSuffix(path, ".length") && (t.Encoding == encodingDynamic || t.Encoding == encodingBytes) {
+		if t.Encoding == encodingBytes {
+			n, _ := bytesLength(word)
+			return new(big.Int).SetUint64(n), loc, label, nil
+		}
+		return new(big.Int).SetBytes(word), loc, label, nil
+	}
+	switch t.Encoding {
+	case encodingBytes:
+		data, err := readStorageBytes(ctx, client, addr, loc.slot, word, block)
+		if err != nil {
+			return nil, loc, label, err
+		}
+		if label == "string" {
+			return string(data), loc, label, nil
+		}
+		return data, loc, label, nil
+	case encodingMapping:
+		return nil, loc, label, fmt.Errorf("%s is a mapping; index it, e.g. %s[key]", path, path)
+	case encodingDynamic:
+		return nil, loc, label, fmt.Errorf("%s is an array; index it or read %s.length", path, path)
+	}
+	if len(t.Members) > 0 {
+		return nil, loc, label, fmt.Errorf("%s is a struct; read one of its members", path)
+	}
+	if t.Base != "" {
+		return nil, loc, label, fmt.Errorf("%s is an array; index it", path)
+	}
+	size, _ := strconv.Atoi(t.NumberOfBytes)
+	if size <= 0 || size+loc.offset > 32 {
+		return nil, loc, label, fmt.Errorf("%s: unexpected size %q at offset %d", path, t.NumberOfBytes, loc.offset)
+	}
+	// Packed values are stored right-aligned, the first at offset 0.
+	return decodeStorageValue(label, word[32-loc.offset-size:32-loc.offset]), loc, label, nil
+}
+
+// decodeStorageValue decodes a value type from its bytes in a slot.
+func decodeStorageValue(label string, b []byte) interface{} {
+	switch {
+	case label == "address" || label == "address payable" || strings.HasPrefix(label, "contract "):
+		return common.BytesToAddress(b)
+	case label == "bool":
+		return b[len(b)-1] != 0
+	case strings.HasPrefix(label, "int"):
+		n := new(big.Int).SetBytes(b)
+		if len(b) > 0 && b[0]&0x80 != 0 {
+			n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(8*len(b))))
+		}
+		return n
+	case strings.HasPrefix(label, "uint"), strings.HasPrefix(label, "enum "):
+		return new(big.Int).SetBytes(b)
+	}
+	return append([]byte{}, b...)
+}
+
+// bytesLength reads the length of a string or bytes value from its slot,
+// and whether it is stored in the slot itself. Values under 32 bytes keep
+// their length times two in the last byte; longer ones store length*2+1.
+func bytesLength(word []byte) (uint64, bool) {
+	if word[31]&1 == 0 {
+		return uint64(word[31] / 2), true
+	}
+	n := new(big.Int).SetBytes(word)
+	return n.Rsh(n, 1).Uint64(), false
+}
+
+// readStorageBytes reads a string or bytes value: from its slot when
+// short, else from the slots starting at the slot's hash.
+func readStorageBytes(ctx context.Context, client *ethclient.Client, addr common.Address, slot *big.Int, word []byte, block *big.Int) ([]byte, error) {
+	n, short := bytesLength(word)
+	if short {
+		return append([]byte{}, word[:n]...), nil
+	}
+	if n > maxStorageBytes {
+		return nil, fmt.Errorf("value is %d bytes; refusing to read more than %d", n, maxStorageBytes)
+	}
+	data := make([]byte, 0, n+31)
+	at := new(big.Int).SetBytes(crypto.Keccak256(common.BigToHash(slot).Bytes()))
+	for uint64(len(data)) < n {
+		w, err := client.StorageAt(ctx, addr, common.BigToHash(at), block)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, w...)
+		at.Add(at, common.Big1)
+	}
+	return data[:n], nil
+}
+
+func runStorage(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "read" {
+		return errors.New("usage: storage read [flags] <contract> <slot|variable>")
+	}
+	var rpcURL string
+	fs := newFlagSet("storage read", &rpcURL)
+	contractRef := fs.String("contract", "", "artifact (File.sol or File.sol:Name) providing the storage layout; defaults to the registry entry's")
+	block := fs.Uint64("block", 0, "block number to read at (default: latest)")
+	network := addRegistryFlag(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("usage: storage read [flags] <contract> <slot|variable>")
+	}
+	target, path := fs.Arg(0), fs.Arg(1)
+
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	reg, err := loadRegistry(root, *network)
+	if err != nil {
+		return err
+	}
+	var addr common.Address
+	var raw json.RawMessage
+	switch {
+	case strings.HasPrefix(target, "0x"):
+		if addr, err = parseAddress(target); err != nil {
+			return err
+		}
+	case isENSName(target):
+		if addr, err = newENSResolver(client, ensRegistryAddress).resolve(ctx, target); err != nil {
+			return err
+		}
+	default:
+		e, err := reg.lookup(target)
+		if err != nil {
+			return err
+		}
+		addr, raw = e.Address, e.StorageLayout
+	}
+	if *contractRef != "" {
+		art, err := loadArtifact(root, *contractRef)
+		if err != nil {
+			return err
+		}
+		raw = art.StorageLayout
+	}
+	var layout *storageLayout
+	if _, isSlot := new(big.Int).SetString(path, 0); !isSlot {
+		if layout, err = parseStorageLayout(raw); err != nil {
+			return err
+		}
+	}
+	var at *big.Int
+	if *block > 0 {
+		at = new(big.Int).SetUint64(*block)
+	}
+	value, loc, label, err := readStorage(ctx, client, addr, layout, path, at)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("slot:   %s\n", common.BigToHash(loc.slot).Hex())
+	if loc.offset > 0 {
+		fmt.Printf("offset: %d\n", loc.offset)
+	}
+	fmt.Printf("type:   %s\n", label)
+	fmt.Printf("value:  %s\n", formatValue(value))
+	return nil
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const tenderlyAPI = "https://api.tenderly.co/api/v1"
+
+// tenderlyConfig simulates every transaction through Tenderly's simulation
+// API before it is broadcast, printing the decoded call trace and state
+// diff, and refuses to send one that the simulation says reverts:
+//
+//	networks:
+//	  sepolia:
+//	    tenderly:
+//	      account: my-team
+//	      project: deployments
+//	      accessKey: ${TENDERLY_ACCESS_KEY}
+//
+// Without a manifest block, -simulate reads TENDERLY_ACCOUNT,
+// TENDERLY_PROJECT and TENDERLY_ACCESS_KEY.
+type tenderlyConfig struct {
+	Account   string `yaml:"account"`
+	Project   string `yaml:"project"`
+	AccessKey string `yaml:"accessKey"`
+}
+
+// tenderlyFromEnv is the configuration -simulate uses when the network has
+// none.
+func tenderlyFromEnv() *tenderlyConfig {
+	return &tenderlyConfig{Account: "${TENDERLY_ACCOUNT}", Project: "${TENDERLY_PROJECT}", AccessKey: "${TENDERLY_ACCESS_KEY}"}
+}
+
+type tenderlyClient struct {
+	account, project, accessKey string
+	http                        *http.Client
+}
+
+func newTenderlyClient(c tenderlyConfig) (*tenderlyClient, error) {
+	t := &tenderlyClient{
+		account:   os.ExpandEnv(c.Account),
+		project:   os.ExpandEnv(c.Project),
+		accessKey: os.ExpandEnv(c.AccessKey),
+		http:      &http.Client{Timeout: 60 * time.Second},
+	}
+	if t.account == "" || t.project == "" || t.accessKey == "" {
+		return nil, errors.New("tenderly needs an account, project and access key (TENDERLY_ACCOUNT, TENDERLY_PROJECT, TENDERLY_ACCESS_KEY)")
+	}
+	return t, nil
+}
+
+// tenderlySimulation is the part of a simulation response that is printed.
+type tenderlySimulation struct {
+	Transaction struct {
+		Status          bool   `json:"status"`
+		GasUsed         uint64 `json:"gas_used"`
+		ErrorMessage    string `json:"error_message"`
+		TransactionInfo struct {
+			CallTrace *tenderlyCall      `json:"call_trace"`
+			StateDiff []tenderlyDiff     `json:"state_diff"`
+			Logs      []tenderlyLogEntry `json:"logs"`
+		} `json:"transaction_info"`
+	} `json:"transaction"`
+	Simulation struct {
+		ID string `json:"id"`
+	} `json:"simulation"`
+}
+
+type tenderlyCall struct {
+	CallType     string          `json:"call_type"`
+	From         common.Address  `json:"from"`
+	To           common.Address  `json:"to"`
+	ContractName string          `json:"contract_name"`
+	FunctionName string          `json:"function_name"`
+	DecodedInput []tenderlyValue `json:"decoded_input"`
+	GasUsed      uint64          `json:"gas_used"`
+	Error        string          `json:"error"`
+	Calls        []*tenderlyCall `json:"calls"`
+}
+
+type tenderlyValue struct {
+	Soltype struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	} `json:"soltype"`
+	Value interface{} `json:"value"`
+}
+
+type tenderlyDiff struct {
+	Address common.Address `json:"address"`
+	Soltype *struct {
+		Name string `json:"name"`
+	} `json:"soltype"`
+	Original interface{} `json:"original"`
+	Dirty    interface{} `json:"dirty"`
+	Raw      []struct {
+		Key      string `json:"key"`
+		Original string `json:"original"`
+		Dirty    string `json:"dirty"`
+	} `json:"raw"`
+}
+
+type tenderlyLogEntry struct {
+	Name   string          `json:"name"`
+	Inputs []tenderlyValue `json:"inputs"`
+}
+
+// simulate runs msg on the chain's latest state. Contract creations are
+// sent without a recipient.
+func (t *tenderlyClient) simulate(ctx context.Context, chainID uint64, msg ethereum.CallMsg) (*tenderlySimulation, error) {
+	body := map[string]interface{}{
+		"network_id":      fmt.Sprint(chainID),
+		"from":            msg.From.Hex(),
+		"input":           hexutil.Encode(msg.Data),
+		"gas":             msg.Gas,
+		"gas_price":       "0",
+		"value":           "0",
+		"save":            true,
+		"save_if_fails":   true,
+		"simulation_type": "full",
+	}
+	if msg.To != nil {
+		body["to"] = msg.To.Hex()
+	}
+	if msg.Value != nil {
+		body["value"] = msg.Value.String()
+	}
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/account/%s/project/%s/simulate", tenderlyAPI, t.account, t.project)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Access-Key", t.accessKey)
+	resp, err := t.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("tenderly: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("tenderly: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	var sim tenderlySimulation
+	if err := json.NewDecoder(resp.Body).Decode(&sim); err != nil {
+		return nil, fmt.Errorf("tenderly: decode response: %w", err)
+	}
+	return &sim, nil
+}
+
+// dashboardURL links to the saved simulation.
+func (t *tenderlyClient) dashboardURL(sim *tenderlySimulation) string {
+	return fmt.Sprintf("https://dashboard.tenderly.co/%s/%s/simulator/%s", t.account, t.project, sim.Simulation.ID)
+}
+
+// printSimulation writes the call trace, emitted events and state diff of
+// sim to w.
+func printSimulation(w io.Writer, sim *tenderlySimulation) {
+	info := sim.Transaction.TransactionInfo
+	if info.CallTrace != nil {
+		fmt.Fprintln(w, "Call trace:")
+		printCall(w, info.CallTrace, 1)
+	}
+	if len(info.Logs) > 0 {
+		fmt.Fprintln(w, "Events:")
+		for _, l := range info.Logs {
+			fmt.Fprintf(w, "  %s(%s)\n", l.Name, formatTenderlyValues(l.Inputs))
+		}
+	}
+	if len(info.StateDiff) > 0 {
+		fmt.Fprintln(w, "State changes:")
+		for _, d := range info.StateDiff {
+			if d.Soltype != nil && d.Soltype.Name != "" {
+				fmt.Fprintf(w, "  %s %s: %s -> %s\n", d.Address.Hex(), d.Soltype.Name, formatTenderly(d.Original), formatTenderly(d.Dirty))
+				continue
+			}
+			for _, slot := range d.Raw {
+				fmt.Fprintf(w, "  %s slot %s: %s -> %s\n", d.Address.Hex(), slot.Key, slot.Original, slot.Dirty)
+			}
+		}
+	}
+}
+
+func printCall(w io.Writer, c *tenderlyCall, depth int) {
+	target := c.To.Hex()
+	if c.ContractName != "" {
+		target = c.ContractName + "@" + target
+	}
+	call := c.FunctionName
+	if call == "" {
+		call = "?"
+	}
+	line := fmt.Sprintf("%s%s %s.%s(%s) gas %d", strings.Repeat("  ", depth), c.CallType, target, call, formatTenderlyValues(c.DecodedInput), c.GasUsed)
+	if c.Error != "" {
+		line += " ERROR: " + c.Error
+	}
+	fmt.Fprintln(w, line)
+	for _, sub := range c.Calls {
+		printCall(w, sub, depth+1)
+	}
+}
+
+func formatTenderlyValues(values []tenderlyValue) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = formatTenderly(v.Value)
+		if v.Soltype.Name != "" {
+			parts[i] = v.Soltype.Name + "=" + parts[i]
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatTenderly renders a decoded value from the API compactly.
+func formatTenderly(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "-"
+	case string:
+		return v
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(raw)
+}
+
+// simulateTx runs msg through Tenderly when the run has it configured, and
+// fails if the simulation reverts, reporting whether it did.
+func (r *networkRun) simulateTx(ctx context.Context, msg ethereum.CallMsg) (reverted bool, err error) {
+	if r.tenderly == nil {
+		return false, nil
+	}
+	sim, err := r.tenderly.simulate(ctx, r.chainID.Uint64(), msg)
+	if err != nil {
+		return false, fmt.Errorf("simulate: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Tenderly simulation (%s):\n", r.tenderly.dashboardURL(sim))
+	printSimulation(os.Stderr, sim)
+	logger.Info("Simulated", "status", sim.Transaction.Status, "gasUsed", sim.Transaction.GasUsed, "simulation", sim.Simulation.ID)
+	if !sim.Transaction.Status {
+		return true, fmt.Errorf("simulation reverted: %s", sim.Transaction.ErrorMessage)
+	}
+	return false, nil
+}
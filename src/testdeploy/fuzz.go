@@ -0,0 +1,199 @@
+package testdeploy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// codelessAddress is an address no chain has code at, standing in for a
+// contract parameter given an externally owned account by mistake.
+var codelessAddress = common.BytesToAddress(crypto.Keccak256([]byte("testdeploy: no code")))
+
+// ConstructorCase is one set of constructor arguments FuzzConstructor
+// tried: the deployment's own, with one parameter replaced by Input.
+type ConstructorCase struct {
+	Param string
+	Input string
+	Args  []interface{}
+	// Accepted is whether the constructor ran to completion; Err is why
+	// it did not otherwise, usually a revert.
+	Accepted bool
+	Err      error
+}
+
+// ConstructorReport lists the cases FuzzConstructor tried on a contract.
+type ConstructorReport struct {
+	Contract string
+	Cases    []ConstructorCase
+}
+
+// FuzzConstructor runs c's constructor with misconfigured arguments and
+// reports which of them it accepts. Each case is the deployment's own
+// arguments with one parameter replaced by an input a careless manifest
+// could pass: the zero address, an address without code, an empty list, a
+// list with a duplicate or the zero address in it, zero or an empty
+// string. On a fork this catches a constructor that would take such
+// arguments on mainnet:
+//
+//	stack := testdeploy.Deploy(t, testdeploy.Options{Fork: os.Getenv("MAINNET_RPC_URL")})
+//	report := stack.Contract("Governance").FuzzConstructor(t)
+//	report.RequireRejected(t)
+//
+// The cases are estimated, not mined, so the stack is left as it was. The
+// init code is taken from the deployment transaction, which must have
+// created c directly rather than through a factory or proxy.
+func (c *Contract) FuzzConstructor(t testing.TB) *ConstructorReport {
+	t.Helper()
+	if c.proxy {
+		t.Fatalf("testdeploy: %s is behind a proxy; FuzzConstructor needs a contract with constructor arguments", c.Name)
+	}
+	inputs := c.ABI.Constructor.Inputs
+	if len(inputs) == 0 {
+		t.Fatalf("testdeploy: %s has no constructor parameters to fuzz", c.Name)
+	}
+	ctx := context.Background()
+	tx, _, err := c.client.TransactionByHash(ctx, c.txHash)
+	if err != nil {
+		t.Fatalf("testdeploy: %s: deployment transaction %s: %v", c.Name, c.txHash.Hex(), err)
+	}
+	data := tx.Data()
+	if tx.To() != nil || !bytes.HasSuffix(data, c.encodedArgs) {
+		t.Fatalf("testdeploy: %s was not deployed by a creation transaction of its own", c.Name)
+	}
+	initCode := data[:len(data)-len(c.encodedArgs)]
+	valid, err := inputs.Unpack(c.encodedArgs)
+	if err != nil {
+		t.Fatalf("testdeploy: %s: decode constructor arguments: %v", c.Name, err)
+	}
+	if err := c.tryConstructor(ctx, initCode, valid); err != nil {
+		t.Fatalf("testdeploy: %s: the deployed arguments no longer pass the constructor: %v", c.Name, err)
+	}
+
+	report := &ConstructorReport{Contract: c.Name}
+	for i, in := range inputs {
+		param := in.Name
+		if param == "" {
+			param = fmt.Sprintf("#%d", i)
+		}
+		for _, m := range constructorMutations(in.Type, valid[i]) {
+			args := slices.Clone(valid)
+			args[i] = m.value
+			tc := ConstructorCase{Param: param, Input: m.input, Args: args}
+			tc.Err = c.tryConstructor(ctx, initCode, args)
+			tc.Accepted = tc.Err == nil
+			if tc.Accepted {
+				t.Logf("testdeploy: %s constructor accepts %s = %s", c.Name, param, m.input)
+			} else {
+				t.Logf("testdeploy: %s constructor rejects %s = %s: %v", c.Name, param, m.input, tc.Err)
+			}
+			report.Cases = append(report.Cases, tc)
+		}
+	}
+	return report
+}
+
+// Accepted returns the cases the constructor did not reject.
+func (r *ConstructorReport) Accepted() []ConstructorCase {
+	var out []ConstructorCase
+	for _, c := range r.Cases {
+		if c.Accepted {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// RequireRejected fails t for each case the constructor accepted. Tests
+// that expect some of them, such as an approver without code, can check
+// Accepted instead.
+func (r *ConstructorReport) RequireRejected(t testing.TB) {
+	t.Helper()
+	for _, c := range r.Accepted() {
+		t.Errorf("testdeploy: %s constructor accepts %s = %s", r.Contract, c.Param, c.Input)
+	}
+}
+
+// tryConstructor estimates deploying initCode with args, which fails if
+// the constructor reverts.
+func (c *Contract) tryConstructor(ctx context.Context, initCode []byte, args []interface{}) error {
+	packed, err := c.ABI.Constructor.Inputs.Pack(args...)
+	if err != nil {
+		return fmt.Errorf("encode arguments: %w", err)
+	}
+	_, err = c.client.EstimateGas(ctx, ethereum.CallMsg{
+		From: c.stack.Address(0),
+		Data: append(slices.Clone(initCode), packed...),
+	})
+	return err
+}
+
+type constructorMutation struct {
+	input string
+	value interface{}
+}
+
+// constructorMutations returns the misconfigured inputs tried for a
+// parameter of type typ whose deployed value is valid, leaving out those
+// equal to it.
+func constructorMutations(typ abi.Type, valid interface{}) []constructorMutation {
+	var ms []constructorMutation
+	v := reflect.ValueOf(valid)
+	switch typ.T {
+	case abi.AddressTy:
+		ms = append(ms,
+			constructorMutation{"the zero address", common.Address{}},
+			constructorMutation{"an address without code", codelessAddress})
+	case abi.SliceTy:
+		if v.Len() > 0 {
+			ms = append(ms, constructorMutation{"an empty list", reflect.MakeSlice(v.Type(), 0, 0).Interface()})
+		}
+		if typ.Elem.T == abi.AddressTy {
+			if v.Len() > 0 {
+				ms = append(ms, constructorMutation{"a list with a duplicate", reflect.Append(v, v.Index(0)).Interface()})
+			}
+			ms = append(ms, constructorMutation{"a list with the zero address", reflect.Append(v, reflect.ValueOf(common.Address{})).Interface()})
+		}
+	case abi.ArrayTy:
+		if typ.Elem.T == abi.AddressTy && v.Len() > 0 {
+			if v.Len() > 1 {
+				dup := reflect.New(v.Type()).Elem()
+				dup.Set(v)
+				dup.Index(1).Set(v.Index(0))
+				ms = append(ms, constructorMutation{"a list with a duplicate", dup.Interface()})
+			}
+			zero := reflect.New(v.Type()).Elem()
+			zero.Set(v)
+			zero.Index(0).Set(reflect.ValueOf(common.Address{}))
+			ms = append(ms, constructorMutation{"a list with the zero address", zero.Interface()})
+		}
+	case abi.UintTy, abi.IntTy:
+		if n, ok := valid.(*big.Int); ok {
+			if n.Sign() != 0 {
+				ms = append(ms, constructorMutation{"zero", new(big.Int)})
+			}
+		} else {
+			ms = append(ms, constructorMutation{"zero", reflect.Zero(v.Type()).Interface()})
+		}
+	case abi.StringTy:
+		ms = append(ms, constructorMutation{"an empty string", ""})
+	case abi.BytesTy:
+		ms = append(ms, constructorMutation{"empty bytes", []byte{}})
+	}
+	kept := ms[:0]
+	for _, m := range ms {
+		if !reflect.DeepEqual(m.value, valid) {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
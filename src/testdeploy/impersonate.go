@@ -0,0 +1,84 @@
+package testdeploy
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Impersonate lets Contract.Send send transactions from addr, whose key the
+// test does not have, until t ends. On a fork this runs post-deploy
+// governance calls as the chain's real multisig or timelock:
+//
+//	stack := testdeploy.Deploy(t, testdeploy.Options{Fork: os.Getenv("MAINNET_RPC_URL")})
+//	multisig := stack.Impersonate(t, common.HexToAddress("0x..."))
+//	stack.Contract("Governance").Send(t, multisig, "acceptOwnership")
+//
+// The node accepts the transactions unsigned, so the returned options only
+// work with Send; abigen bindings given them fail to sign. addr pays for
+// gas; give it ether with SetBalance if it has none.
+func (s *Stack) Impersonate(t testing.TB, addr common.Address) *bind.TransactOpts {
+	t.Helper()
+	s.rpc(t, nil, "anvil_impersonateAccount", addr)
+	s.mu.Lock()
+	s.impersonated[addr]++
+	s.mu.Unlock()
+	t.Cleanup(func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.impersonated[addr]--; s.impersonated[addr] > 0 {
+			return
+		}
+		delete(s.impersonated, addr)
+		if err := s.Client.Client().CallContext(context.Background(), nil, "anvil_stopImpersonatingAccount", addr); err != nil {
+			t.Errorf("testdeploy: anvil_stopImpersonatingAccount: %v", err)
+		}
+	})
+	return &bind.TransactOpts{
+		From: addr,
+		Signer: func(common.Address, *types.Transaction) (*types.Transaction, error) {
+			return nil, fmt.Errorf("testdeploy: %s is impersonated and has no key; send with Contract.Send", addr.Hex())
+		},
+	}
+}
+
+// SetBalance sets addr's ether balance, in wei.
+func (s *Stack) SetBalance(t testing.TB, addr common.Address, wei *big.Int) {
+	t.Helper()
+	s.rpc(t, nil, "anvil_setBalance", addr, (*hexutil.Big)(wei))
+}
+
+func (s *Stack) isImpersonated(addr common.Address) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.impersonated[addr] > 0
+}
+
+// sendImpersonated sends an unsigned transaction from opts.From, which the
+// node signs for as it is impersonated, and returns its hash.
+func (c *Contract) sendImpersonated(opts *bind.TransactOpts, method string, args ...interface{}) (common.Hash, error) {
+	data, err := c.ABI.Pack(method, args...)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	tx := map[string]interface{}{"from": opts.From, "to": c.Address, "input": hexutil.Bytes(data)}
+	if opts.Value != nil {
+		tx["value"] = (*hexutil.Big)(opts.Value)
+	}
+	if opts.GasLimit != 0 {
+		tx["gas"] = hexutil.Uint64(opts.GasLimit)
+	}
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var hash common.Hash
+	err = c.client.Client().CallContext(ctx, &hash, "eth_sendTransaction", tx)
+	return hash, err
+}
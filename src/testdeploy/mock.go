@@ -0,0 +1,291 @@
+package testdeploy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Mock is an in-memory JSON-RPC node for unit tests of code that takes an
+// *ethclient.Client or *rpc.Client, such as deployment logic built on this
+// repository's bindings, without anvil or any node running. It answers
+// each method with the responses scripted for it and records every
+// request:
+//
+//	node := testdeploy.NewMock(t)
+//	node.Return("eth_chainId", hexutil.Uint64(11155111))
+//	node.ReturnOnce("eth_getTransactionReceipt", nil) // pending on the first poll
+//	node.Return("eth_getTransactionReceipt", receipt)
+//	node.HandleCall(govAddr, govABI, "requiredApprovals", big.NewInt(2))
+//	deployAndConfigure(ctx, node.Client)
+//	if n := len(node.Requests("eth_sendRawTransaction")); n != 2 {
+//		t.Errorf("sent %d transactions, want 2", n)
+//	}
+//
+// Results are encoded as JSON as they are given, so quantities must be
+// hexutil types (hexutil.Uint64, *hexutil.Big) and byte strings
+// hexutil.Bytes, as a node returns them; go-ethereum's types such as
+// *types.Receipt and *types.Header encode themselves. A method nothing is
+// scripted for fails with the JSON-RPC "method not found" error.
+type Mock struct {
+	Client *ethclient.Client
+	RPC    *rpc.Client
+
+	mu       sync.Mutex
+	once     map[string][]Handler
+	handlers map[string]Handler
+	calls    []callHandler
+	requests []Request
+}
+
+// Handler answers a request with a result, or an error. Returning an
+// *RPCError sets the error's code and data; other errors are sent with
+// code -32000, as nodes report failed calls.
+type Handler func(req Request) (interface{}, error)
+
+// RPCError is a JSON-RPC error response. Code 3 with revert data as Data
+// is how nodes report a reverted eth_call or eth_estimateGas.
+type RPCError struct {
+	Code    int
+	Message string
+	Data    interface{}
+}
+
+func (e *RPCError) Error() string { return e.Message }
+
+// Request is a JSON-RPC request the mock received.
+type Request struct {
+	Method string
+	Params []json.RawMessage
+}
+
+// Param decodes the i-th parameter into out, failing t if it is missing
+// or does not decode.
+func (r Request) Param(t testing.TB, i int, out interface{}) {
+	t.Helper()
+	if i >= len(r.Params) {
+		t.Fatalf("testdeploy: %s has %d params, not %d", r.Method, len(r.Params), i+1)
+	}
+	if err := json.Unmarshal(r.Params[i], out); err != nil {
+		t.Fatalf("testdeploy: %s param %d: %v", r.Method, i, err)
+	}
+}
+
+// callHandler answers eth_calls of one method of one contract.
+type callHandler struct {
+	to       common.Address
+	selector []byte
+	handle   Handler
+}
+
+// NewMock returns a mock node with nothing scripted, whose clients are
+// closed when t ends.
+func NewMock(t testing.TB) *Mock {
+	t.Helper()
+	m := &Mock{once: map[string][]Handler{}, handlers: map[string]Handler{}}
+	client, err := rpc.DialOptions(context.Background(), "http://testdeploy.mock", rpc.WithHTTPClient(&http.Client{Transport: m}))
+	if err != nil {
+		t.Fatalf("testdeploy: %v", err)
+	}
+	t.Cleanup(client.Close)
+	m.RPC, m.Client = client, ethclient.NewClient(client)
+	return m
+}
+
+// Handle answers every request for method with h, after any responses
+// queued with ReturnOnce.
+func (m *Mock) Handle(method string, h Handler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers[method] = h
+}
+
+// Return answers every request for method with result.
+func (m *Mock) Return(method string, result interface{}) {
+	m.Handle(method, func(Request) (interface{}, error) { return result, nil })
+}
+
+// Fail answers every request for method with a JSON-RPC error.
+func (m *Mock) Fail(method string, code int, message string) {
+	m.Handle(method, func(Request) (interface{}, error) { return nil, &RPCError{Code: code, Message: message} })
+}
+
+// HandleOnce queues h to answer the next request for method. Queued
+// handlers answer in order, before the one set by Handle or Return.
+func (m *Mock) HandleOnce(method string, h Handler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.once[method] = append(m.once[method], h)
+}
+
+// ReturnOnce queues result as the answer to the next request for method.
+func (m *Mock) ReturnOnce(method string, result interface{}) {
+	m.HandleOnce(method, func(Request) (interface{}, error) { return result, nil })
+}
+
+// HandleCall answers eth_calls of method on the contract at to with
+// results, ABI-encoded as the method's outputs. Other eth_calls are left
+// to the eth_call handler, if any.
+func (m *Mock) HandleCall(to common.Address, a abi.ABI, method string, results ...interface{}) {
+	meth, ok := a.Methods[method]
+	if !ok {
+		panic(fmt.Sprintf("testdeploy: no method %s in the ABI", method))
+	}
+	out, err := meth.Outputs.Pack(results...)
+	if err != nil {
+		panic(fmt.Sprintf("testdeploy: %s results: %v", method, err))
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, callHandler{to: to, selector: meth.ID, handle: func(Request) (interface{}, error) {
+		return hexutil.Bytes(out), nil
+	}})
+}
+
+// Requests returns the requests received so far, in order: all of them,
+// or only those for the given methods.
+func (m *Mock) Requests(methods ...string) []Request {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []Request
+	for _, r := range m.requests {
+		if len(methods) == 0 || slices.Contains(methods, r.Method) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Reset forgets the recorded requests, keeping what is scripted.
+func (m *Mock) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = nil
+}
+
+type jsonrpcMessage struct {
+	Version string            `json:"jsonrpc"`
+	ID      json.RawMessage   `json:"id,omitempty"`
+	Method  string            `json:"method,omitempty"`
+	Params  []json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage   `json:"result,omitempty"`
+	Error   *jsonrpcError     `json:"error,omitempty"`
+}
+
+type jsonrpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// RoundTrip serves the rpc client's HTTP requests, single or batched,
+// without a network.
+func (m *Mock) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	batch := len(bytes.TrimSpace(body)) > 0 && bytes.TrimSpace(body)[0] == '['
+	var msgs []jsonrpcMessage
+	if batch {
+		err = json.Unmarshal(body, &msgs)
+	} else {
+		msgs = make([]jsonrpcMessage, 1)
+		err = json.Unmarshal(body, &msgs[0])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("testdeploy: mock: parse request: %w", err)
+	}
+	replies := make([]jsonrpcMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		replies = append(replies, m.serve(msg))
+	}
+	var out []byte
+	if batch {
+		out, err = json.Marshal(replies)
+	} else {
+		out, err = json.Marshal(replies[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(out)),
+		Request:    req,
+	}, nil
+}
+
+// serve records msg and answers it with the handler scripted for it.
+func (m *Mock) serve(msg jsonrpcMessage) jsonrpcMessage {
+	r := Request{Method: msg.Method, Params: msg.Params}
+	reply := jsonrpcMessage{Version: "2.0", ID: msg.ID}
+	m.mu.Lock()
+	m.requests = append(m.requests, r)
+	h := m.handler(r)
+	m.mu.Unlock()
+	if h == nil {
+		reply.Error = &jsonrpcError{Code: -32601, Message: fmt.Sprintf("the method %s does not exist/is not available", r.Method)}
+		return reply
+	}
+	result, err := h(r)
+	if err != nil {
+		var re *RPCError
+		if !errors.As(err, &re) {
+			re = &RPCError{Code: -32000, Message: err.Error()}
+		}
+		reply.Error = &jsonrpcError{Code: re.Code, Message: re.Message, Data: re.Data}
+		return reply
+	}
+	raw, err := json.Marshal(result)
+	if err != nil {
+		reply.Error = &jsonrpcError{Code: -32603, Message: fmt.Sprintf("testdeploy: mock: encode %s result: %v", r.Method, err)}
+		return reply
+	}
+	reply.Result = raw
+	return reply
+}
+
+// handler picks the handler for r: a matching HandleCall, then the queued
+// ones, then the method's own. The caller holds m.mu.
+func (m *Mock) handler(r Request) Handler {
+	if r.Method == "eth_call" && len(r.Params) > 0 {
+		var call struct {
+			To    *common.Address `json:"to"`
+			Input hexutil.Bytes   `json:"input"`
+			Data  hexutil.Bytes   `json:"data"`
+		}
+		if json.Unmarshal(r.Params[0], &call) == nil && call.To != nil {
+			data := call.Input
+			if len(data) == 0 {
+				data = call.Data
+			}
+			for _, c := range m.calls {
+				if c.to == *call.To && len(data) >= 4 && bytes.Equal(data[:4], c.selector) {
+					return c.handle
+				}
+			}
+		}
+	}
+	if queued := m.once[r.Method]; len(queued) > 0 {
+		m.once[r.Method] = queued[1:]
+		return queued[0]
+	}
+	return m.handlers[r.Method]
+}
@@ -0,0 +1,99 @@
+package testdeploy
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Snapshot records the node's current state, for Revert to return to.
+// Reverting is much faster than deploying the stack again for each test
+// case; Isolate does both for a subtest:
+//
+//	for _, tc := range cases {
+//		t.Run(tc.name, func(t *testing.T) {
+//			stack.Isolate(t)
+//			...
+//		})
+//	}
+func (s *Stack) Snapshot(t testing.TB) string {
+	t.Helper()
+	var id string
+	s.rpc(t, &id, "evm_snapshot")
+	return id
+}
+
+// Revert returns the node to the state recorded by Snapshot. A snapshot can
+// be reverted to once; reverting also drops the snapshots taken after it.
+func (s *Stack) Revert(t testing.TB, id string) {
+	t.Helper()
+	if err := s.revert(id); err != nil {
+		t.Fatalf("testdeploy: %v", err)
+	}
+}
+
+func (s *Stack) revert(id string) error {
+	var ok bool
+	if err := s.Client.Client().CallContext(context.Background(), &ok, "evm_revert", id); err != nil {
+		return fmt.Errorf("evm_revert: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("evm_revert: no snapshot %s; each snapshot can be reverted to once", id)
+	}
+	return nil
+}
+
+// Isolate takes a snapshot and reverts to it when t ends, so whatever t
+// changes on chain is undone for the tests after it.
+func (s *Stack) Isolate(t testing.TB) {
+	t.Helper()
+	id := s.Snapshot(t)
+	t.Cleanup(func() {
+		if err := s.revert(id); err != nil {
+			t.Errorf("testdeploy: %v", err)
+		}
+	})
+}
+
+// IncreaseTime moves the chain's clock forward by d and mines a block, so
+// that calls and the next transactions see the new block.timestamp.
+func (s *Stack) IncreaseTime(t testing.TB, d time.Duration) {
+	t.Helper()
+	s.rpc(t, nil, "evm_increaseTime", int64(d/time.Second))
+	s.Mine(t, 1)
+}
+
+// SetNextBlockTimestamp gives the next mined block the timestamp at, which
+// must be later than the latest block's.
+func (s *Stack) SetNextBlockTimestamp(t testing.TB, at time.Time) {
+	t.Helper()
+	s.rpc(t, nil, "evm_setNextBlockTimestamp", at.Unix())
+}
+
+// Mine mines n empty blocks, e.g. to pass a voting period counted in
+// blocks.
+func (s *Stack) Mine(t testing.TB, n uint64) {
+	t.Helper()
+	s.rpc(t, nil, "anvil_mine", hexutil.Uint64(n))
+}
+
+// Now returns the latest block's timestamp.
+func (s *Stack) Now(t testing.TB) time.Time {
+	t.Helper()
+	header, err := s.Client.HeaderByNumber(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("testdeploy: %v", err)
+	}
+	return time.Unix(int64(header.Time), 0)
+}
+
+// rpc calls a node method, failing t on error.
+func (s *Stack) rpc(t testing.TB, result interface{}, method string, args ...interface{}) {
+	t.Helper()
+	if err := s.Client.Client().CallContext(context.Background(), result, method, args...); err != nil {
+		t.Fatalf("testdeploy: %s: %v", method, err)
+	}
+}
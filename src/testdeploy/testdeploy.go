@@ -0,0 +1,472 @@
+// Package testdeploy deploys the project's manifest to a throwaway anvil
+// node, optionally forking a live chain, for Go integration tests:
+//
+//	func TestProposal(t *testing.T) {
+//		stack := testdeploy.Deploy(t, testdeploy.Options{Network: "sepolia", Fork: os.Getenv("SEPOLIA_RPC_URL")})
+//		gov := stack.Contract("Governance")
+//		var required *big.Int
+//		gov.CallInto(t, &required, "requiredApprovals")
+//		gov.Send(t, stack.Transactor(1), "propose", "Fund the treasury", []byte{})
+//	}
+//
+// The deploy CLI is built from this repository and run against the node in
+// a scratch copy of the project, so the repository's own registries are
+// never touched. The chosen network loses its Safe, explorer, Tenderly and
+// faucet settings, and the manifest's signer is replaced by anvil's first
+// account. anvil and the Go toolchain must be installed; artifacts come
+// from out/, so run forge build first.
+//
+// Unit tests that need no chain at all can use Mock instead: an in-memory
+// node that answers scripted responses and records the requests it gets.
+package testdeploy
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"gopkg.in/yaml.v3"
+)
+
+// anvilKeys are the private keys of anvil's first default accounts, from
+// its standard test mnemonic.
+var anvilKeys = []string{
+	"ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80",
+	"59c4e0d7d5f185d1860d340f44d7f6a8818586f0c6f4bf77ba82a49e0fc10c2e",
+	"5de4111afa1a4b94908f83103eb1f1706367c2e68ca870fc3fb9a804cdab365a",
+	"7c852118294e51e653712a81e05800f419141751be58f605c371e15141b007a6",
+	"47e179ec197488593b187f80a17d0ee9b6179e03b0c3dac5a8e0e4dcbd1af3ea",
+}
+
+const (
+	anvilStartTimeout = 60 * time.Second
+	deployTimeout     = 10 * time.Minute
+)
+
+// Options configure Deploy. The zero value deploys deployments.yaml from
+// the project root to a fresh local chain.
+type Options struct {
+	// Root is the project root, where foundry.toml and out/ are; it
+	// defaults to the directory above this package's sources.
+	Root string
+	// Manifest is the deployment manifest, relative to Root; it defaults
+	// to deployments.yaml.
+	Manifest string
+	// Network picks the manifest network to deploy, so per-network
+	// arguments apply; it defaults to the manifest's only network.
+	Network string
+	// Fork is an RPC URL for anvil to fork, and ForkBlock the block to
+	// fork at; empty starts an empty chain.
+	Fork      string
+	ForkBlock uint64
+	// AnvilArgs are passed to anvil as is.
+	AnvilArgs []string
+}
+
+// Stack is a deployed manifest on a running anvil node, which is stopped
+// when the test ends.
+type Stack struct {
+	RPCURL  string
+	Client  *ethclient.Client
+	ChainID *big.Int
+	// Keys are anvil's funded default accounts; the first one deployed the
+	// manifest.
+	Keys []*ecdsa.PrivateKey
+
+	contracts map[string]*Contract
+
+	mu           sync.Mutex
+	impersonated map[common.Address]int
+}
+
+// Contract is a deployed contract bound to its ABI from the registry.
+type Contract struct {
+	Name    string
+	Address common.Address
+	ABI     abi.ABI
+	*bind.BoundContract
+
+	client *ethclient.Client
+	stack  *Stack
+	// txHash, encodedArgs and proxy are the deployment's, for
+	// FuzzConstructor.
+	txHash      common.Hash
+	encodedArgs []byte
+	proxy       bool
+}
+
+// registryEntry is the part of a registry entry the harness reads.
+type registryEntry struct {
+	Address     common.Address  `json:"address"`
+	ABI         json.RawMessage `json:"abi"`
+	TxHash      common.Hash     `json:"txHash"`
+	EncodedArgs hexutil.Bytes   `json:"encodedArgs"`
+	Proxy       json.RawMessage `json:"proxy"`
+}
+
+// Deploy starts anvil, deploys the manifest to it from anvil's first
+// account and returns handles to the deployed contracts. It fails t on any
+// error.
+func Deploy(t testing.TB, opts Options) *Stack {
+	t.Helper()
+	root := opts.Root
+	if root == "" {
+		root = defaultRoot(t)
+	}
+	manifest := opts.Manifest
+	if manifest == "" {
+		manifest = "deployments.yaml"
+	}
+	if !filepath.IsAbs(manifest) {
+		manifest = filepath.Join(root, manifest)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), deployTimeout)
+	defer cancel()
+
+	url := startAnvil(t, ctx, opts)
+	client, err := ethclient.DialContext(ctx, url)
+	if err != nil {
+		t.Fatalf("testdeploy: dial anvil: %v", err)
+	}
+	t.Cleanup(client.Close)
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		t.Fatalf("testdeploy: %v", err)
+	}
+
+	scratch := scratchProject(t, root)
+	network, err := writeManifest(manifest, filepath.Join(scratch, "deployments.yaml"), opts.Network, url)
+	if err != nil {
+		t.Fatalf("testdeploy: %s: %v", manifest, err)
+	}
+	cli := buildCLI(t, ctx, scratch)
+	cmd := exec.CommandContext(ctx, cli, "deploy", "-manifest", "deployments.yaml", "-network", network, "-force",
+		"-compiler", "none", "-signer", "env", "-key-env", "TESTDEPLOY_PRIVATE_KEY", "-confirmations", "1")
+	cmd.Dir = scratch
+	cmd.Env = append(os.Environ(), "TESTDEPLOY_PRIVATE_KEY=0x"+anvilKeys[0])
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("testdeploy: deploy %s: %v\n%s", filepath.Base(manifest), err, out)
+	}
+
+	stack := &Stack{RPCURL: url, Client: client, ChainID: chainID, contracts: map[string]*Contract{}, impersonated: map[common.Address]int{}}
+	for _, hex := range anvilKeys {
+		key, err := crypto.HexToECDSA(hex)
+		if err != nil {
+			t.Fatalf("testdeploy: %v", err)
+		}
+		stack.Keys = append(stack.Keys, key)
+	}
+	if err := stack.loadRegistry(scratch); err != nil {
+		t.Fatalf("testdeploy: %v", err)
+	}
+	return stack
+}
+
+// Contract returns the deployment named name in the manifest, and panics if
+// there is none. Use these addresses with abigen bindings for
+// compile-time checked calls.
+func (s *Stack) Contract(name string) *Contract {
+	c, ok := s.contracts[name]
+	if !ok {
+		panic(fmt.Sprintf("testdeploy: no deployment named %s", name))
+	}
+	return c
+}
+
+// Contracts returns every deployment, by name.
+func (s *Stack) Contracts() map[string]*Contract {
+	return s.contracts
+}
+
+// Transactor returns options for sending transactions from anvil's i-th
+// default account.
+func (s *Stack) Transactor(i int) *bind.TransactOpts {
+	opts, err := bind.NewKeyedTransactorWithChainID(s.Keys[i], s.ChainID)
+	if err != nil {
+		panic(fmt.Sprintf("testdeploy: %v", err))
+	}
+	return opts
+}
+
+// Address returns anvil's i-th default account.
+func (s *Stack) Address(i int) common.Address {
+	return crypto.PubkeyToAddress(s.Keys[i].PublicKey)
+}
+
+// CallInto calls a read-only method and stores its single result in out,
+// which must point to a value of the result's Go type, e.g. **big.Int for
+// uint256.
+func (c *Contract) CallInto(t testing.TB, out interface{}, method string, args ...interface{}) {
+	t.Helper()
+	results, err := c.CallValues(method, args...)
+	if err != nil {
+		t.Fatalf("testdeploy: %s.%s: %v", c.Name, method, err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("testdeploy: %s.%s returns %d values; use CallValues", c.Name, method, len(results))
+	}
+	if err := c.ABI.Methods[method].Outputs.Copy(out, results); err != nil {
+		t.Fatalf("testdeploy: %s.%s: %v", c.Name, method, err)
+	}
+}
+
+// CallValues calls a read-only method and returns its decoded results.
+func (c *Contract) CallValues(method string, args ...interface{}) ([]interface{}, error) {
+	var results []interface{}
+	err := c.BoundContract.Call(&bind.CallOpts{}, &results, method, args...)
+	return results, err
+}
+
+// Send sends a transaction calling method and waits until it is
+// mined, failing the test if it cannot be sent or reverts. opts may come
+// from Transactor or Impersonate.
+func (c *Contract) Send(t testing.TB, opts *bind.TransactOpts, method string, args ...interface{}) *types.Receipt {
+	t.Helper()
+	var hash common.Hash
+	if c.stack.isImpersonated(opts.From) {
+		var err error
+		if hash, err = c.sendImpersonated(opts, method, args...); err != nil {
+			t.Fatalf("testdeploy: %s.%s: %v", c.Name, method, err)
+		}
+	} else {
+		tx, err := c.BoundContract.Transact(opts, method, args...)
+		if err != nil {
+			t.Fatalf("testdeploy: %s.%s: %v", c.Name, method, err)
+		}
+		hash = tx.Hash()
+	}
+	receipt, err := bind.WaitMinedHash(context.Background(), c.client, hash)
+	if err != nil {
+		t.Fatalf("testdeploy: %s.%s: %v", c.Name, method, err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("testdeploy: %s.%s reverted in %s", c.Name, method, hash.Hex())
+	}
+	return receipt
+}
+
+// loadRegistry binds every contract the deploy CLI recorded.
+func (s *Stack) loadRegistry(root string) error {
+	files, err := filepath.Glob(filepath.Join(root, "deployments", "*.json"))
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 {
+		return fmt.Errorf("expected one registry in %s, found %d", filepath.Join(root, "deployments"), len(files))
+	}
+	raw, err := os.ReadFile(files[0])
+	if err != nil {
+		return err
+	}
+	var reg struct {
+		Contracts map[string]registryEntry `json:"contracts"`
+	}
+	if err := json.Unmarshal(raw, &reg); err != nil {
+		return fmt.Errorf("parse %s: %w", files[0], err)
+	}
+	for name, e := range reg.Contracts {
+		parsed, err := abi.JSON(bytes.NewReader(e.ABI))
+		if err != nil {
+			return fmt.Errorf("%s: parse ABI: %w", name, err)
+		}
+		s.contracts[name] = &Contract{
+			Name:          name,
+			Address:       e.Address,
+			ABI:           parsed,
+			BoundContract: bind.NewBoundContract(e.Address, parsed, s.Client, s.Client, s.Client),
+			client:        s.Client,
+			stack:         s,
+			txHash:        e.TxHash,
+			encodedArgs:   e.EncodedArgs,
+			proxy:         len(e.Proxy) > 0,
+		}
+	}
+	return nil
+}
+
+// testNetworkKeys are network settings that would reach outside the test
+// node.
+var testNetworkKeys = map[string]bool{"rpc": true, "fallbacks": true, "anvil": true, "safe": true, "explorer": true, "tenderly": true, "faucet": true}
+
+// writeManifest copies the manifest at src to dst with network pointed at
+// url and the signer removed, and returns the network's name.
+func writeManifest(src, dst, network, url string) (string, error) {
+	raw, err := os.ReadFile(src)
+	if err != nil {
+		return "", err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return "", err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return "", fmt.Errorf("not a manifest")
+	}
+	top := doc.Content[0]
+	var networks *yaml.Node
+	var kept []*yaml.Node
+	for i := 0; i+1 < len(top.Content); i += 2 {
+		switch top.Content[i].Value {
+		case "signer":
+			continue
+		case "networks":
+			networks = top.Content[i+1]
+		}
+		kept = append(kept, top.Content[i], top.Content[i+1])
+	}
+	top.Content = kept
+	if networks == nil || networks.Kind != yaml.MappingNode || len(networks.Content) == 0 {
+		return "", fmt.Errorf("no networks configured")
+	}
+	if network == "" {
+		if len(networks.Content) != 2 {
+			return "", fmt.Errorf("the manifest has several networks; pick one with Options.Network")
+		}
+		network = networks.Content[0].Value
+	}
+	var cfg *yaml.Node
+	for i := 0; i+1 < len(networks.Content); i += 2 {
+		if networks.Content[i].Value == network {
+			cfg = networks.Content[i+1]
+		}
+	}
+	if cfg == nil {
+		return "", fmt.Errorf("no network %s", network)
+	}
+	if cfg.Kind != yaml.MappingNode {
+		return "", fmt.Errorf("network %s is not a mapping", network)
+	}
+	kept = []*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: "rpc"},
+		{Kind: yaml.ScalarNode, Value: url},
+	}
+	for i := 0; i+1 < len(cfg.Content); i += 2 {
+		if !testNetworkKeys[cfg.Content[i].Value] {
+			kept = append(kept, cfg.Content[i], cfg.Content[i+1])
+		}
+	}
+	cfg.Content = kept
+	out, err := yaml.Marshal(&doc)
+	if err != nil {
+		return "", err
+	}
+	return network, os.WriteFile(dst, out, 0o644)
+}
+
+// defaultRoot is the project root above this package's sources.
+func defaultRoot(t testing.TB) string {
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatal("testdeploy: cannot locate the project; set Options.Root")
+	}
+	return filepath.Dir(filepath.Dir(filepath.Dir(file)))
+}
+
+// scratchProject creates a project directory that shares root's config and
+// artifacts but has its own deployments/.
+func scratchProject(t testing.TB, root string) string {
+	dir := t.TempDir()
+	for _, name := range []string{"foundry.toml", "out", "src", "lib"} {
+		src := filepath.Join(root, name)
+		if _, err := os.Stat(src); err != nil {
+			continue
+		}
+		if err := os.Symlink(src, filepath.Join(dir, name)); err != nil {
+			t.Fatalf("testdeploy: %v", err)
+		}
+	}
+	return dir
+}
+
+// buildCLI builds the deploy CLI from the sources next to this package.
+func buildCLI(t testing.TB, ctx context.Context, dir string) string {
+	_, file, _, _ := runtime.Caller(0)
+	bin := filepath.Join(dir, "deploy-cli")
+	cmd := exec.CommandContext(ctx, "go", "build", "-o", bin, ".")
+	cmd.Dir = filepath.Dir(filepath.Dir(file))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("testdeploy: build the deploy CLI: %v\n%s", err, out)
+	}
+	return bin
+}
+
+// startAnvil starts anvil on a free port, stopped when the test ends, and
+// waits until it answers.
+func startAnvil(t testing.TB, ctx context.Context, opts Options) string {
+	if _, err := exec.LookPath("anvil"); err != nil {
+		t.Skip("testdeploy: anvil is not installed")
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("testdeploy: %v", err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	args := []string{"--host", "127.0.0.1", "--port", strconv.Itoa(port)}
+	if opts.Fork != "" {
+		args = append(args, "--fork-url", opts.Fork)
+		if opts.ForkBlock != 0 {
+			args = append(args, "--fork-block-number", strconv.FormatUint(opts.ForkBlock, 10))
+		}
+	}
+	args = append(args, opts.AnvilArgs...)
+	var output bytes.Buffer
+	cmd := exec.Command("anvil", args...)
+	cmd.Stdout, cmd.Stderr = &output, &output
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("testdeploy: start anvil: %v", err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	t.Cleanup(func() {
+		cmd.Process.Signal(os.Interrupt)
+		select {
+		case <-exited:
+		case <-time.After(5 * time.Second):
+			cmd.Process.Kill()
+			<-exited
+		}
+	})
+
+	url := fmt.Sprintf("http://127.0.0.1:%d", port)
+	deadline := time.After(anvilStartTimeout)
+	for {
+		if client, err := ethclient.DialContext(ctx, url); err == nil {
+			_, err = client.ChainID(ctx)
+			client.Close()
+			if err == nil {
+				return url
+			}
+		}
+		select {
+		case <-exited:
+			t.Fatalf("testdeploy: anvil exited: %s", bytes.TrimSpace(output.Bytes()))
+		case <-deadline:
+			t.Fatalf("testdeploy: anvil did not start within %s", anvilStartTimeout)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
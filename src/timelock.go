@@ -0,0 +1,470 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// timelockABI is the subset of OpenZeppelin's TimelockController used to
+// schedule and execute single calls.
+var timelockABI = mustParseABI(`[
+	{"type":"function","name":"getMinDelay","inputs":[],"outputs":[{"type":"uint256"}],"stateMutability":"view"},
+	{"type":"function","name":"getTimestamp","inputs":[{"name":"id","type":"bytes32"}],"outputs":[{"type":"uint256"}],"stateMutability":"view"},
+	{"type":"function","name":"schedule","inputs":[{"name":"target","type":"address"},{"name":"value","type":"uint256"},{"name":"data","type":"bytes"},{"name":"predecessor","type":"bytes32"},{"name":"salt","type":"bytes32"},{"name":"delay","type":"uint256"}],"outputs":[],"stateMutability":"nonpayable"},
+	{"type":"function","name":"execute","inputs":[{"name":"target","type":"address"},{"name":"value","type":"uint256"},{"name":"payload","type":"bytes"},{"name":"predecessor","type":"bytes32"},{"name":"salt","type":"bytes32"}],"outputs":[],"stateMutability":"payable"}
+]`)
+
+// doneTimestamp is what getTimestamp returns for executed operations.
+const doneTimestamp = 1
+
+// opQueue tracks the operations scheduled on a network's timelocks, stored
+// as deployments/<network>.ops.json next to the registry. The timelock
+// itself stays the source of truth for whether an operation is ready.
+type opQueue struct {
+	Network string `json:"network"`
+	ChainID uint64 `json:"chainId"`
+	// Ops maps operation ids to the call they schedule.
+	Ops map[common.Hash]*timelockOp `json:"ops"`
+
+	path string
+}
+
+// timelockOp is one call scheduled through a TimelockController.
+type timelockOp struct {
+	Timelock    common.Address `json:"timelock"`
+	Target      common.Address `json:"target"`
+	Value       *hexutil.Big   `json:"value"`
+	Data        hexutil.Bytes  `json:"data"`
+	Predecessor common.Hash    `json:"predecessor"`
+	Salt        common.Hash    `json:"salt"`
+	// Method and Args describe Data for listings.
+	Method      string        `json:"method"`
+	Args        []interface{} `json:"args"`
+	ETA         time.Time     `json:"eta"`
+	ScheduledTx common.Hash   `json:"scheduledTx"`
+	ExecutedTx  *common.Hash  `json:"executedTx,omitempty"`
+}
+
+func opQueuePath(root, network string) string {
+	return filepath.Join(root, "deployments", network+".ops.json")
+}
+
+// loadOpQueue reads the operation queue for the run's network. A missing
+// file yields an empty queue.
+func (r *networkRun) loadOpQueue() (*opQueue, error) {
+	path := opQueuePath(r.records, r.name)
+	q := &opQueue{Network: r.name, ChainID: r.chainID.Uint64(), Ops: map[common.Hash]*timelockOp{}, path: path}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, q); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if q.ChainID != r.chainID.Uint64() {
+		return nil, fmt.Errorf("%s was written for chain %d, but %s is chain %s", path, q.ChainID, r.name, r.chainID)
+	}
+	if q.Ops == nil {
+		q.Ops = map[common.Hash]*timelockOp{}
+	}
+	q.path = path
+	return q, nil
+}
+
+func (q *opQueue) save() error {
+	raw, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Written atomically, as execute -daemon reads it without the lock.
+	return writeFileAtomic(q.path, append(raw, '\n'))
+}
+
+// ids returns the queued operation ids, soonest ETA first.
+func (q *opQueue) ids() []common.Hash {
+	ids := make([]common.Hash, 0, len(q.Ops))
+	for id := range q.Ops {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return q.Ops[ids[i]].ETA.Before(q.Ops[ids[j]].ETA) })
+	return ids
+}
+
+// operationID computes the id TimelockController.hashOperation assigns to
+// op: keccak256(abi.encode(target, value, data, predecessor, salt)).
+func operationID(op *timelockOp) (common.Hash, error) {
+	enc := make(abi.Arguments, 5)
+	for i, t := range []string{"address", "uint256", "bytes", "bytes32", "bytes32"} {
+		typ, err := abi.NewType(t, "", nil)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		enc[i] = abi.Argument{Type: typ}
+	}
+	encoded, err := enc.Pack(op.Target, op.Value.ToInt(), []byte(op.Data), op.Predecessor, op.Salt)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(encoded), nil
+}
+
+// timelockUint calls a timelock view method returning a uint256. The
+// arguments are packed as-is rather than converted, since they are already
+// typed.
+func timelockUint(ctx context.Context, client *ethclient.Client, timelock common.Address, method string, args ...interface{}) (uint64, error) {
+	data, err := timelockABI.Pack(method, args...)
+	if err != nil {
+		return 0, err
+	}
+	out, err := client.CallContract(ctx, ethereum.CallMsg{To: &timelock, Data: data}, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %s", method, revertReason(err))
+	}
+	values, err := timelockABI.Methods[method].Outputs.Unpack(out)
+	if err != nil {
+		return 0, fmt.Errorf("%s: decode result: %w", method, err)
+	}
+	return values[0].(*big.Int).Uint64(), nil
+}
+
+// operationTimestamp returns the timelock's timestamp for id: 0 if it is
+// not scheduled (or was cancelled), doneTimestamp once executed, else the
+// time it becomes ready.
+func operationTimestamp(ctx context.Context, client *ethclient.Client, timelock common.Address, id common.Hash) (uint64, error) {
+	return timelockUint(ctx, client, timelock, "getTimestamp", id)
+}
+
+// openTimelockRun opens the single network selected by the run flags.
+func openTimelockRun(ctx context.Context, fs *flag.FlagSet, rf *runFlags, rpcURL, command string) (*networkRun, error) {
+	m, selected, err := rf.load(ctx, fs, rpcURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(selected) != 1 {
+		return nil, fmt.Errorf("%s runs against a single network; pick one with -network", command)
+	}
+	return openNetworkRun(ctx, m, selected[0], rf.options())
+}
+
+func runSchedule(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("schedule", &rpcURL)
+	rf := addRunFlags(fs)
+	timelockRef := fs.String("timelock", "", "TimelockController address or registry name")
+	to := fs.String("to", "", "contract to call once the delay has passed, as an address, ENS name or registry name")
+	method := fs.String("method", "", "method to call, by name or signature")
+	methodArgs := fs.String("args", "[]", "method arguments as a JSON array")
+	value := fs.String("value", "0", "value to send with the call (e.g. 0, 1gwei, 0.1ether)")
+	contractRef := fs.String("contract", "", "artifact (File.sol or File.sol:Name) providing the target's ABI; defaults to the registry entry's")
+	salt := fs.String("salt", "", "operation salt (hex or any string), to schedule the same call more than once")
+	predecessor := fs.String("after", "", "id of an operation that must be executed first")
+	delay := fs.Duration("delay", 0, "delay before the call can be executed (default: the timelock's minimum)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *timelockRef == "" || *to == "" || *method == "" {
+		return errors.New("-timelock, -to and -method are required")
+	}
+	params, err := parseJSONArgs(*methodArgs)
+	if err != nil {
+		return err
+	}
+	wei, err := parseWei(*value)
+	if err != nil {
+		return fmt.Errorf("-value: %w", err)
+	}
+	op := &timelockOp{Value: (*hexutil.Big)(wei), Method: *method, Args: params}
+	if *salt != "" {
+		if op.Salt, err = parseSalt(*salt); err != nil {
+			return err
+		}
+	}
+	if *predecessor != "" {
+		if op.Predecessor, err = parseOperationID(*predecessor); err != nil {
+			return fmt.Errorf("-after: %w", err)
+		}
+	}
+
+	run, err := openTimelockRun(ctx, fs, rf, rpcURL, "schedule")
+	if err != nil {
+		return err
+	}
+	defer run.close()
+	timelockAddr, err := resolveAddress(*timelockRef, run.name)
+	if err != nil {
+		return err
+	}
+	target, err := bindContract(ctx, run.client, run.registry, run.root, *to, *contractRef)
+	if err != nil {
+		return err
+	}
+	if op.Data, err = encodeCall(target.ABI, *method, params); err != nil {
+		return err
+	}
+	m, _ := findMethod(target.ABI, *method)
+	op.Timelock, op.Target, op.Method = timelockAddr, target.Address, m.Sig
+
+	minDelay, err := timelockUint(ctx, run.client, timelockAddr, "getMinDelay")
+	if err != nil {
+		return fmt.Errorf("%s does not look like a TimelockController: %w", timelockAddr.Hex(), err)
+	}
+	seconds := uint64(delay.Seconds())
+	if seconds == 0 {
+		seconds = minDelay
+	} else if seconds < minDelay {
+		return fmt.Errorf("-delay %s is below the timelock's minimum of %s", *delay, time.Duration(minDelay)*time.Second)
+	}
+
+	id, err := operationID(op)
+	if err != nil {
+		return err
+	}
+	if ts, err := operationTimestamp(ctx, run.client, op.Timelock, id); err != nil {
+		return err
+	} else if ts != 0 {
+		return fmt.Errorf("operation %s is already scheduled; use -salt to schedule the same call again", id.Hex())
+	}
+
+	data, err := timelockABI.Pack("schedule", op.Target, op.Value.ToInt(), []byte(op.Data), op.Predecessor, op.Salt, new(big.Int).SetUint64(seconds))
+	if err != nil {
+		return err
+	}
+	sent, err := run.transact(ctx, txFields{To: &op.Timelock, Data: data, Label: "timelock " + describeCall(timelockABI, data, run.book)}, gasConfig{})
+	if err != nil {
+		if sent != nil && sent.Reverted {
+			return fmt.Errorf("schedule reverted: %w", err)
+		}
+		return err
+	}
+	op.ETA = time.Now().Add(time.Duration(seconds) * time.Second).UTC().Truncate(time.Second)
+	if rf.dryRun {
+		fmt.Printf("DRY RUN: would schedule %s as operation %s, executable after %s\n", op.Method, id.Hex(), op.ETA.Format(time.RFC3339))
+		return nil
+	}
+	op.ScheduledTx = sent.Hash
+	// The timelock's own timestamp is exact once the schedule is mined.
+	if ts, err := operationTimestamp(ctx, run.client, op.Timelock, id); err == nil && ts > doneTimestamp {
+		op.ETA = time.Unix(int64(ts), 0).UTC()
+	}
+
+	q, err := run.loadOpQueue()
+	if err != nil {
+		return err
+	}
+	q.Ops[id] = op
+	if err := q.save(); err != nil {
+		return fmt.Errorf("record operation: %w", err)
+	}
+	fmt.Println("operation:", id.Hex())
+	run.printSent(sent)
+	fmt.Printf("executable after %s (run: execute -id %s)\n", op.ETA.Local().Format(time.RFC3339), id.Hex())
+	return nil
+}
+
+func runExecute(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("execute", &rpcURL)
+	rf := addRunFlags(fs)
+	idFlag := fs.String("id", "", "id of the scheduled operation to execute")
+	all := fs.Bool("all", false, "execute every queued operation that is ready")
+	daemon := fs.Bool("daemon", false, "keep running, executing each queued operation once it is ready")
+	dc := addDaemonFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	switch {
+	case *daemon && (*idFlag != "" || *all):
+		return errors.New("-daemon executes every queued operation; drop -id and -all")
+	case !*daemon && (*idFlag == "") == !*all:
+		return errors.New("pass either -id or -all")
+	}
+
+	run, err := openTimelockRun(ctx, fs, rf, rpcURL, "execute")
+	if err != nil {
+		return err
+	}
+	defer run.close()
+	if *daemon {
+		return run.executeDaemon(ctx, dc)
+	}
+	q, err := run.loadOpQueue()
+	if err != nil {
+		return err
+	}
+
+	var ids []common.Hash
+	if *all {
+		ids = q.ids()
+	} else {
+		id, err := parseOperationID(*idFlag)
+		if err != nil {
+			return fmt.Errorf("-id: %w", err)
+		}
+		if q.Ops[id] == nil {
+			return fmt.Errorf("operation %s is not in %s", id.Hex(), q.path)
+		}
+		ids = []common.Hash{id}
+	}
+
+	executed := 0
+	for _, id := range ids {
+		op := q.Ops[id]
+		if op.ExecutedTx != nil {
+			if !*all {
+				return fmt.Errorf("operation %s was already executed in %s", id.Hex(), op.ExecutedTx.Hex())
+			}
+			continue
+		}
+		ts, err := operationTimestamp(ctx, run.client, op.Timelock, id)
+		if err != nil {
+			return err
+		}
+		now, err := latestTimestamp(ctx, run)
+		if err != nil {
+			return err
+		}
+		switch {
+		case ts == 0:
+			err = fmt.Errorf("operation %s is not scheduled on %s; it may have been cancelled", id.Hex(), op.Timelock.Hex())
+		case ts == doneTimestamp:
+			err = fmt.Errorf("operation %s was already executed", id.Hex())
+		case ts > now:
+			err = fmt.Errorf("operation %s is not ready until %s", id.Hex(), time.Unix(int64(ts), 0).Local().Format(time.RFC3339))
+		}
+		if err != nil {
+			if *all {
+				continue
+			}
+			return err
+		}
+
+		sent, err := run.executeOp(ctx, id, op)
+		if err != nil {
+			return err
+		}
+		executed++
+		if rf.dryRun {
+			fmt.Printf("DRY RUN: %s (%s) would execute (gas %d)\n", id.Hex(), op.Method, sent.Gas)
+			continue
+		}
+		op.ExecutedTx = &sent.Hash
+		if err := q.save(); err != nil {
+			return fmt.Errorf("record execution: %w", err)
+		}
+		fmt.Printf("executed %s (%s): %s\n", id.Hex(), op.Method, sent.Hash.Hex())
+		if url := run.site.tx(sent.Hash); url != "" {
+			fmt.Println("explorer:", url)
+		}
+	}
+	if *all && executed == 0 {
+		fmt.Println("no operations are ready")
+	}
+	return nil
+}
+
+// executeOp sends the timelock's execute call for the operation id.
+func (r *networkRun) executeOp(ctx context.Context, id common.Hash, op *timelockOp) (*sentTx, error) {
+	data, err := timelockABI.Pack("execute", op.Target, op.Value.ToInt(), []byte(op.Data), op.Predecessor, op.Salt)
+	if err != nil {
+		return nil, err
+	}
+	sent, err := r.transact(ctx, txFields{To: &op.Timelock, Value: op.Value.ToInt(), Data: data, Label: "timelock " + describeCall(timelockABI, data, r.book)}, gasConfig{})
+	if err != nil && sent != nil && sent.Reverted {
+		err = fmt.Errorf("%s: %s reverted: %w", id.Hex(), op.Method, err)
+	}
+	return sent, err
+}
+
+func runPendingOps(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("pending-ops", &rpcURL)
+	network := addRegistryFlag(fs)
+	showAll := fs.Bool("all", false, "include executed and cancelled operations")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return err
+	}
+	run := &networkRun{name: *network, root: root, records: root, client: client, chainID: chainID}
+	q, err := run.loadOpQueue()
+	if err != nil {
+		return err
+	}
+	now, err := latestTimestamp(ctx, run)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTIMELOCK\tTARGET\tCALL\tETA\tSTATE")
+	for _, id := range q.ids() {
+		op := q.Ops[id]
+		ts, err := operationTimestamp(ctx, client, op.Timelock, id)
+		if err != nil {
+			return err
+		}
+		state := "waiting " + time.Unix(int64(ts), 0).Sub(time.Unix(int64(now), 0)).String()
+		switch {
+		case ts == 0:
+			state = "cancelled"
+		case ts == doneTimestamp || op.ExecutedTx != nil:
+			state = "executed"
+		case ts <= now:
+			state = "ready"
+		}
+		if !*showAll && (ts == 0 || ts == doneTimestamp || op.ExecutedTx != nil) {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", id.Hex(), op.Timelock.Hex(), op.Target.Hex(), op.Method, op.ETA.Local().Format(time.RFC3339), state)
+	}
+	return w.Flush()
+}
+
+// latestTimestamp is the latest block's time, which is what the timelock
+// compares ETAs against.
+func latestTimestamp(ctx context.Context, r *networkRun) (uint64, error) {
+	head, err := r.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	return head.Time, nil
+}
+
+func parseOperationID(s string) (common.Hash, error) {
+	b, err := hexutil.Decode(s)
+	if err != nil || len(b) != common.HashLength {
+		return common.Hash{}, fmt.Errorf("%q is not a 32-byte hex operation id", s)
+	}
+	return common.BytesToHash(b), nil
+}
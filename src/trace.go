@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// callFrame is one frame of geth's callTracer output.
+type callFrame struct {
+	Type         string          `json:"type"`
+	From         common.Address  `json:"from"`
+	To           *common.Address `json:"to"`
+	Value        *hexutil.Big    `json:"value"`
+	Gas          hexutil.Uint64  `json:"gas"`
+	GasUsed      hexutil.Uint64  `json:"gasUsed"`
+	Input        hexutil.Bytes   `json:"input"`
+	Output       hexutil.Bytes   `json:"output"`
+	Error        string          `json:"error"`
+	RevertReason string          `json:"revertReason"`
+	Calls        []*callFrame    `json:"calls"`
+}
+
+var callTracer = map[string]interface{}{"tracer": "callTracer"}
+
+// traceDecoder names the contracts, accounts and methods in a trace, from
+// the registry, the address book and the project's artifacts.
+type traceDecoder struct {
+	names   map[common.Address]string
+	methods map[[4]byte]abi.Method
+	abis    []abi.ABI
+}
+
+func newTraceDecoder(root string, reg *registry) *traceDecoder {
+	d := &traceDecoder{names: map[common.Address]string{}, methods: map[[4]byte]abi.Method{}, abis: projectABIs(root)}
+	if book, err := loadAddressBook(root, reg.Network); err == nil {
+		for addr, label := range book.names {
+			d.names[addr] = label
+		}
+	}
+	for name, e := range reg.Contracts {
+		d.names[e.Address] = name
+	}
+	for _, a := range d.abis {
+		for _, m := range a.Methods {
+			d.methods[[4]byte(m.ID)] = m
+		}
+	}
+	return d
+}
+
+// traceTx fetches the call trace of a mined transaction.
+func traceTx(ctx context.Context, client *ethclient.Client, hash common.Hash) (*callFrame, error) {
+	var frame callFrame
+	if err := client.Client().CallContext(ctx, &frame, "debug_traceTransaction", hash, callTracer); err != nil {
+		return nil, traceError("debug_traceTransaction", err)
+	}
+	return &frame, nil
+}
+
+// traceCall fetches the call trace msg would have against the latest block.
+func traceCall(ctx context.Context, client *ethclient.Client, msg ethereum.CallMsg) (*callFrame, error) {
+	arg := map[string]interface{}{"from": msg.From, "input": hexutil.Bytes(msg.Data)}
+	if msg.To != nil {
+		arg["to"] = msg.To
+	}
+	if msg.Value != nil {
+		arg["value"] = (*hexutil.Big)(msg.Value)
+	}
+	if msg.Gas != 0 {
+		arg["gas"] = hexutil.Uint64(msg.Gas)
+	}
+	var frame callFrame
+	if err := client.Client().CallContext(ctx, &frame, "debug_traceCall", arg, "latest", callTracer); err != nil {
+		return nil, traceError("debug_traceCall", err)
+	}
+	return &frame, nil
+}
+
+func traceError(method string, err error) error {
+	var rerr rpc.Error
+	if errors.As(err, &rerr) && rerr.ErrorCode() == -32601 {
+		return fmt.Errorf("the node does not support %s; use an archive node, anvil or geth with the debug API enabled", method)
+	}
+	return fmt.Errorf("%s: %w", method, err)
+}
+
+// printTrace writes frame and its subcalls to w as an indented tree, with
+// the gas each frame used.
+func (d *traceDecoder) printTrace(w io.Writer, frame *callFrame, depth int) {
+	line := strings.Repeat("  ", depth) + frame.Type + " " + d.describe(frame)
+	if frame.Value != nil && frame.Value.ToInt().Sign() > 0 {
+		line += " value " + formatEther(frame.Value.ToInt())
+	}
+	line += fmt.Sprintf(" gas %d", frame.GasUsed)
+	if frame.Error != "" {
+		line += " ERROR: " + frame.Error
+		if reason, ok := decodeRevert(frame.Output, d.abis); ok {
+			line += ": " + reason
+		} else if frame.RevertReason != "" {
+			line += ": " + frame.RevertReason
+		}
+	}
+	fmt.Fprintln(w, line)
+	for _, sub := range frame.Calls {
+		d.printTrace(w, sub, depth+1)
+	}
+}
+
+// describe renders a frame's target and decoded call.
+func (d *traceDecoder) describe(frame *callFrame) string {
+	if frame.To == nil {
+		return "?"
+	}
+	target := d.annotate(*frame.To)
+	if strings.HasPrefix(frame.Type, "CREATE") {
+		return fmt.Sprintf("%s (init code %d bytes)", target, len(frame.Input))
+	}
+	if len(frame.Input) < 4 {
+		return target
+	}
+	m, ok := d.methods[[4]byte(frame.Input[:4])]
+	if !ok {
+		return fmt.Sprintf("%s.%s", target, hexutil.Encode(frame.Input[:4]))
+	}
+	values, err := m.Inputs.Unpack(frame.Input[4:])
+	if err != nil {
+		return fmt.Sprintf("%s.%s(?)", target, m.RawName)
+	}
+	return fmt.Sprintf("%s.%s(%s)", target, m.RawName, formatValuesWith(values, d.annotate))
+}
+
+// annotate renders addr with the name of the deployment or label it is.
+func (d *traceDecoder) annotate(addr common.Address) string {
+	if name, ok := d.names[addr]; ok {
+		return name + "@" + addr.Hex()
+	}
+	return addr.Hex()
+}
+
+// printTxTrace traces a sent transaction, or with a zero hash the call msg
+// that could not be sent, and prints it to stderr. Failing to trace is
+// only a warning: the trace is a debugging aid.
+func (r *networkRun) printTxTrace(ctx context.Context, hash common.Hash, msg ethereum.CallMsg) {
+	var frame *callFrame
+	var err error
+	if hash == (common.Hash{}) {
+		frame, err = traceCall(ctx, r.client, msg)
+	} else {
+		frame, err = traceTx(ctx, r.client, hash)
+	}
+	if err != nil {
+		logger.Warn("Could not trace the transaction", "err", err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, "Call trace:")
+	newTraceDecoder(r.root, r.registry).printTrace(os.Stderr, frame, 1)
+}
+
+func runTrace(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("trace", &rpcURL)
+	tx := fs.String("tx", "", "hash of the transaction to trace")
+	network := addRegistryFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *tx == "" {
+		return errors.New("-tx is required")
+	}
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	reg, err := loadRegistry(root, *network)
+	if err != nil {
+		return err
+	}
+	frame, err := traceTx(ctx, client, common.HexToHash(*tx))
+	if err != nil {
+		return err
+	}
+	newTraceDecoder(root, reg).printTrace(os.Stdout, frame, 0)
+	return nil
+}
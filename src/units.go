@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+var units = []struct {
+	suffix string
+	exp    int64
+}{
+	{"ether", 18},
+	{"gwei", 9},
+	{"wei", 0},
+}
+
+// parseWei parses an amount such as "1000", "20gwei" or "0.5ether" into wei.
+// An empty string is zero.
+func parseWei(s string) (*big.Int, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	if s == "" {
+		return new(big.Int), nil
+	}
+	exp := int64(0)
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, exp = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.exp
+			break
+		}
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || r.Sign() < 0 {
+		return nil, fmt.Errorf("invalid amount %q", s)
+	}
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(exp), nil)))
+	if !r.IsInt() {
+		return nil, fmt.Errorf("amount %q is not a whole number of wei", s)
+	}
+	return r.Num(), nil
+}
+
+// formatEther renders wei as a decimal ether amount, e.g. "0.0123 ETH".
+func formatEther(wei *big.Int) string {
+	r := new(big.Rat).SetFrac(wei, big.NewInt(1e18))
+	s := strings.TrimRight(strings.TrimRight(r.FloatString(18), "0"), ".")
+	return s + " ETH"
+}
+
+// formatGwei renders wei as gwei to three decimals, e.g. "12.345 gwei".
+func formatGwei(wei *big.Int) string {
+	return gwei(wei) + " gwei"
+}
+
+// gweiAmount renders wei as an amount parseWei reads back, such as
+// "12.345gwei", rounded to three decimals.
+func gweiAmount(wei *big.Int) string {
+	return gwei(wei) + "gwei"
+}
+
+func gwei(wei *big.Int) string {
+	r := new(big.Rat).SetFrac(wei, big.NewInt(1e9))
+	return strings.TrimRight(strings.TrimRight(r.FloatString(3), "0"), ".")
+}
+
+// parseUnits parses a decimal amount of a token with the given decimals,
+// e.g. "2.5" with 6 decimals, into its base units.
+func parseUnits(s string, decimals uint8) (*big.Int, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok || r.Sign() < 0 {
+		return nil, fmt.Errorf("invalid amount %q", s)
+	}
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)))
+	if !r.IsInt() {
+		return nil, fmt.Errorf("amount %q has more than %d decimals", s, decimals)
+	}
+	return r.Num(), nil
+}
+
+// formatUnits renders base units of a token with the given decimals as a
+// decimal amount.
+func formatUnits(n *big.Int, decimals uint8) string {
+	if decimals == 0 {
+		return n.String()
+	}
+	r := new(big.Rat).SetFrac(n, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+	return strings.TrimRight(strings.TrimRight(r.FloatString(int(decimals)), "0"), ".")
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Minimal ABIs for the OpenZeppelin 5 upgrade entry points.
+var (
+	uupsABI       = mustParseABI(`[{"type":"function","name":"upgradeToAndCall","inputs":[{"name":"newImplementation","type":"address"},{"name":"data","type":"bytes"}],"outputs":[],"stateMutability":"payable"}]`)
+	proxyAdminABI = mustParseABI(`[{"type":"function","name":"upgradeAndCall","inputs":[{"name":"proxy","type":"address"},{"name":"implementation","type":"address"},{"name":"data","type":"bytes"}],"outputs":[],"stateMutability":"payable"}]`)
+)
+
+func mustParseABI(s string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(s))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+func runUpgrade(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("upgrade", &rpcURL)
+	rf := addRunFlags(fs)
+	rf.addBuildFlags(fs)
+	name := fs.String("name", "Governance", "registry name of the proxy to upgrade")
+	contractPath := fs.String("contract", "Governance.sol", "new implementation, as File.sol or File.sol:Name")
+	ctorArgs := fs.String("args", "[]", "constructor arguments for the new implementation as a JSON array")
+	call := fs.String("call", "", "function to call on the proxy after upgrading, e.g. initializeV2")
+	callArgs := fs.String("call-args", "[]", "arguments for -call as a JSON array")
+	skipCheck := fs.Bool("skip-storage-check", false, "upgrade even if the storage layouts are incompatible")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	params, err := parseJSONArgs(*ctorArgs)
+	if err != nil {
+		return err
+	}
+	callParams, err := parseJSONArgs(*callArgs)
+	if err != nil {
+		return fmt.Errorf("-call-args: %w", err)
+	}
+
+	m, selected, err := rf.load(ctx, fs, rpcURL, nil)
+	if err != nil {
+		return err
+	}
+	if len(selected) != 1 {
+		return errors.New("upgrade runs against a single network; pick one with -network")
+	}
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	if err := m.build(ctx, root, selected); err != nil {
+		return err
+	}
+	run, err := openNetworkRun(ctx, m, selected[0], rf.options())
+	if err != nil {
+		return err
+	}
+	defer run.close()
+
+	entry, err := run.registry.lookup(*name)
+	if err != nil {
+		return err
+	}
+	if entry.Proxy == nil {
+		return fmt.Errorf("%s is not recorded as a proxy", *name)
+	}
+
+	art, err := run.loadArtifact(*contractPath)
+	if err != nil {
+		return err
+	}
+	converted, err := convertArgs("constructor", art.ABI.Constructor.Inputs, params)
+	if err != nil {
+		return err
+	}
+	code, err := art.creationCode(converted)
+	if err != nil {
+		return err
+	}
+	if err := checkCodeSize(run.root, art, code, rf.allowOversize); err != nil {
+		return err
+	}
+	warnings, err := checkStorageLayout(entry.StorageLayout, art.StorageLayout)
+	for _, w := range warnings {
+		logger.Warn(w)
+	}
+	if err != nil {
+		if !*skipCheck {
+			return fmt.Errorf("%w\nrerun with -skip-storage-check to upgrade anyway", err)
+		}
+		logger.Warn(err.Error())
+	}
+
+	impl, err := run.deploy(ctx, contractSpec{Name: implementationName(*name), Contract: *contractPath, Args: params})
+	if err != nil {
+		return fmt.Errorf("implementation: %w", err)
+	}
+	if err := run.finish(ctx, impl); err != nil {
+		return err
+	}
+
+	var initData []byte
+	if *call != "" {
+		if initData, err = encodeCall(art.ABI, *call, callParams); err != nil {
+			return fmt.Errorf("-call: %w", err)
+		}
+	}
+	if rf.dryRun {
+		// The upgrade call itself cannot be simulated: the new
+		// implementation does not exist on chain yet.
+		if rf.output == outputJSON {
+			report := newTxReport(run, entry.Address, "", nil, true)
+			report.Gas, report.Implementation = impl.Gas, &impl.Address
+			return printJSON(report)
+		}
+		fmt.Printf("DRY RUN: would upgrade %s at %s to %s (implementation gas %d)\n", *name, entry.Address.Hex(), impl.Address.Hex(), impl.Gas)
+		return nil
+	}
+	sent, err := run.upgradeProxy(ctx, entry, impl.Address, initData)
+	if err != nil {
+		return fmt.Errorf("upgrade: %w", err)
+	}
+
+	entry.Proxy.Previous = append(entry.Proxy.Previous, entry.Proxy.Implementation)
+	entry.Proxy.Implementation = impl.Address
+	entry.Contract = art.Name
+	entry.Source = art.Source
+	if art.Metadata != nil {
+		if target, err := art.Metadata.compilationTarget(); err == nil {
+			entry.Source, _, _ = strings.Cut(target, ":")
+		}
+	}
+	entry.ABI = art.RawABI
+	entry.Metadata = art.Metadata
+	entry.StorageLayout = art.StorageLayout
+	entry.CreationCodeHash = nil
+	if len(art.Bytecode) > 0 {
+		hash := crypto.Keccak256Hash(art.Bytecode)
+		entry.CreationCodeHash = &hash
+	}
+	if err := run.registry.save(); err != nil {
+		return fmt.Errorf("record upgrade: %w", err)
+	}
+	if rf.output == outputJSON {
+		report := newTxReport(run, entry.Address, "", sent, false)
+		report.Implementation = &impl.Address
+		return printJSON(report)
+	}
+	fmt.Printf("upgraded %s at %s to %s\n", *name, entry.Address.Hex(), impl.Address.Hex())
+	run.printSent(sent)
+	return nil
+}
+
+// upgradeProxy points the proxy in entry at impl and calls it with data if
+// data is non-empty. UUPS proxies are upgraded through the implementation's
+// upgradeToAndCall; transparent proxies through their ProxyAdmin.
+func (r *networkRun) upgradeProxy(ctx context.Context, entry *registryEntry, impl common.Address, data []byte) (*sentTx, error) {
+	if data == nil {
+		data = []byte{}
+	}
+	var to common.Address
+	var input []byte
+	var err error
+	switch entry.Proxy.Kind {
+	case proxyUUPS:
+		to = entry.Address
+		input, err = uupsABI.Pack("upgradeToAndCall", impl, data)
+	case proxyTransparent:
+		slot, serr := r.client.StorageAt(ctx, entry.Address, adminSlot, nil)
+		if serr != nil {
+			return nil, fmt.Errorf("read proxy admin: %w", serr)
+		}
+		to = common.BytesToAddress(slot)
+		if to == (common.Address{}) {
+			return nil, fmt.Errorf("proxy at %s has no admin", entry.Address.Hex())
+		}
+		input, err = proxyAdminABI.Pack("upgradeAndCall", entry.Address, impl, data)
+	default:
+		return nil, fmt.Errorf("unknown proxy kind %q", entry.Proxy.Kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	label := fmt.Sprintf("upgrade the %s proxy at %s to %s", entry.Proxy.Kind, entry.Address.Hex(), impl.Hex())
+	return r.transact(ctx, txFields{To: &to, Data: input, Label: label}, gasConfig{})
+}
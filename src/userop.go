@@ -0,0 +1,483 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// userOpConfig sends a network's transactions from an ERC-4337 smart
+// account: each one becomes a UserOperation for the account to execute,
+// handed to a bundler, and optionally sponsored by a paymaster.
+//
+//	networks:
+//	  base:
+//	    rpc: ${BASE_RPC_URL}
+//	    userOp:
+//	      account: 0x...
+//	      bundler: ${secret:env:BUNDLER_URL}
+//	      paymaster:
+//	        url: ${secret:env:PAYMASTER_URL}  # ERC-7677 service
+//
+// The run's signer must be the account's owner. Accounts are expected to
+// be SimpleAccount-compatible: execute(address,uint256,bytes), and
+// signatures over the EIP-191 hash of the user operation hash.
+type userOpConfig struct {
+	Account string `yaml:"account"`
+	Bundler string `yaml:"bundler"`
+	// EntryPoint defaults to the v0.7 EntryPoint.
+	EntryPoint string `yaml:"entryPoint"`
+	// Factory and FactoryData deploy the account with its first operation
+	// when it has no code yet.
+	Factory     string `yaml:"factory"`
+	FactoryData string `yaml:"factoryData"`
+	// Paymaster, when set, pays for the operations.
+	Paymaster *paymasterConfig `yaml:"paymaster"`
+}
+
+// paymasterConfig is either an ERC-7677 paymaster service, which signs
+// each operation's sponsorship, or a paymaster contract with fixed data.
+type paymasterConfig struct {
+	URL string `yaml:"url"`
+	// Context is passed to the service, e.g. a sponsorship policy id.
+	Context map[string]interface{} `yaml:"context"`
+
+	Address string `yaml:"address"`
+	Data    string `yaml:"data"`
+}
+
+func (c *userOpConfig) validate() error {
+	if _, err := parseAddress(c.Account); err != nil {
+		return fmt.Errorf("account: %w", err)
+	}
+	if c.Bundler == "" {
+		return errors.New("bundler is required")
+	}
+	if c.EntryPoint != "" {
+		if _, err := parseAddress(c.EntryPoint); err != nil {
+			return fmt.Errorf("entryPoint: %w", err)
+		}
+	}
+	if c.Factory != "" {
+		if _, err := parseAddress(c.Factory); err != nil {
+			return fmt.Errorf("factory: %w", err)
+		}
+	}
+	if _, err := hexutil.Decode(hexOrEmpty(c.FactoryData)); err != nil {
+		return fmt.Errorf("factoryData: %w", err)
+	}
+	if p := c.Paymaster; p != nil {
+		switch {
+		case (p.URL == "") == (p.Address == ""):
+			return errors.New("paymaster: set one of url or address")
+		case p.Address != "":
+			if _, err := parseAddress(p.Address); err != nil {
+				return fmt.Errorf("paymaster: %w", err)
+			}
+			if _, err := hexutil.Decode(hexOrEmpty(p.Data)); err != nil {
+				return fmt.Errorf("paymaster: data: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// hexOrEmpty makes an unset hex field decode as no bytes.
+func hexOrEmpty(s string) string {
+	if s == "" {
+		return "0x"
+	}
+	return s
+}
+
+// entryPointV07 is the canonical ERC-4337 v0.7 EntryPoint.
+var entryPointV07 = common.HexToAddress("0x0000000071727De22E5E9d8BAf0edAc6f37da032")
+
+const userOpPollInterval = 2 * time.Second
+
+// dummyUserOpSignature stands in for the account owner's signature while
+// gas is estimated: it has a signature's length and recovers to nobody.
+var dummyUserOpSignature = hexutil.MustDecode("0xfffffffffffffffffffffffffffffff0000000000000000000000000000000007aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa1c")
+
+var (
+	entryPointABI = mustParseABI(`[
+		{"type":"function","name":"getNonce","inputs":[{"name":"sender","type":"address"},{"name":"key","type":"uint192"}],"outputs":[{"name":"nonce","type":"uint256"}],"stateMutability":"view"},
+		{"type":"function","name":"getUserOpHash","inputs":[{"name":"userOp","type":"tuple","components":[{"name":"sender","type":"address"},{"name":"nonce","type":"uint256"},{"name":"initCode","type":"bytes"},{"name":"callData","type":"bytes"},{"name":"accountGasLimits","type":"bytes32"},{"name":"preVerificationGas","type":"uint256"},{"name":"gasFees","type":"bytes32"},{"name":"paymasterAndData","type":"bytes"},{"name":"signature","type":"bytes"}]}],"outputs":[{"type":"bytes32"}],"stateMutability":"view"}
+	]`)
+	smartAccountABI = mustParseABI(`[{"type":"function","name":"execute","inputs":[{"name":"dest","type":"address"},{"name":"value","type":"uint256"},{"name":"func","type":"bytes"}],"outputs":[],"stateMutability":"nonpayable"}]`)
+)
+
+// userOperation is a v0.7 UserOperation in the unpacked form bundlers
+// take over JSON-RPC.
+type userOperation struct {
+	Sender                        common.Address  `json:"sender"`
+	Nonce                         *hexutil.Big    `json:"nonce"`
+	Factory                       *common.Address `json:"factory,omitempty"`
+	FactoryData                   hexutil.Bytes   `json:"factoryData,omitempty"`
+	CallData                      hexutil.Bytes   `json:"callData"`
+	CallGasLimit                  *hexutil.Big    `json:"callGasLimit"`
+	VerificationGasLimit          *hexutil.Big    `json:"verificationGasLimit"`
+	PreVerificationGas            *hexutil.Big    `json:"preVerificationGas"`
+	MaxFeePerGas                  *hexutil.Big    `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas          *hexutil.Big    `json:"maxPriorityFeePerGas"`
+	Paymaster                     *common.Address `json:"paymaster,omitempty"`
+	PaymasterVerificationGasLimit *hexutil.Big    `json:"paymasterVerificationGasLimit,omitempty"`
+	PaymasterPostOpGasLimit       *hexutil.Big    `json:"paymasterPostOpGasLimit,omitempty"`
+	PaymasterData                 hexutil.Bytes   `json:"paymasterData,omitempty"`
+	Signature                     hexutil.Bytes   `json:"signature"`
+}
+
+// gas is the most gas the operation can be charged for.
+func (op *userOperation) gas() uint64 {
+	total := new(big.Int)
+	for _, g := range []*hexutil.Big{op.CallGasLimit, op.VerificationGasLimit, op.PreVerificationGas, op.PaymasterVerificationGasLimit, op.PaymasterPostOpGasLimit} {
+		if g != nil {
+			total.Add(total, g.ToInt())
+		}
+	}
+	return total.Uint64()
+}
+
+// packedUserOp is the operation as the EntryPoint packs it on chain.
+type packedUserOp struct {
+	Sender             common.Address
+	Nonce              *big.Int
+	InitCode           []byte
+	CallData           []byte
+	AccountGasLimits   [32]byte
+	PreVerificationGas *big.Int
+	GasFees            [32]byte
+	PaymasterAndData   []byte
+	Signature          []byte
+}
+
+// check128 fails if a gas limit or fee the EntryPoint packs into 128 bits
+// is wider, as a bundler or paymaster could return; source names it.
+func (op *userOperation) check128(source string) error {
+	for _, f := range []struct {
+		name  string
+		value *hexutil.Big
+	}{
+		{"verificationGasLimit", op.VerificationGasLimit},
+		{"callGasLimit", op.CallGasLimit},
+		{"maxFeePerGas", op.MaxFeePerGas},
+		{"maxPriorityFeePerGas", op.MaxPriorityFeePerGas},
+		{"paymasterVerificationGasLimit", op.PaymasterVerificationGasLimit},
+		{"paymasterPostOpGasLimit", op.PaymasterPostOpGasLimit},
+	} {
+		if f.value != nil && f.value.ToInt().BitLen() > 128 {
+			return fmt.Errorf("%s: %s %s does not fit in 128 bits", source, f.name, f.value.ToInt())
+		}
+	}
+	return nil
+}
+
+// pack128 puts two 128-bit values in one word, high then low; check128
+// has made sure they fit.
+func pack128(high, low *hexutil.Big) [32]byte {
+	var word [32]byte
+	if high != nil {
+		high.ToInt().FillBytes(word[:16])
+	}
+	if low != nil {
+		low.ToInt().FillBytes(word[16:])
+	}
+	return word
+}
+
+func (op *userOperation) packed() packedUserOp {
+	p := packedUserOp{
+		Sender:             op.Sender,
+		Nonce:              op.Nonce.ToInt(),
+		CallData:           op.CallData,
+		AccountGasLimits:   pack128(op.VerificationGasLimit, op.CallGasLimit),
+		PreVerificationGas: op.PreVerificationGas.ToInt(),
+		GasFees:            pack128(op.MaxPriorityFeePerGas, op.MaxFeePerGas),
+		Signature:          op.Signature,
+	}
+	if op.Factory != nil {
+		p.InitCode = append(op.Factory.Bytes(), op.FactoryData...)
+	}
+	if op.Paymaster != nil {
+		limits := pack128(op.PaymasterVerificationGasLimit, op.PaymasterPostOpGasLimit)
+		p.PaymasterAndData = append(append(op.Paymaster.Bytes(), limits[:]...), op.PaymasterData...)
+	}
+	return p
+}
+
+// userOpClient sends user operations for one smart account.
+type userOpClient struct {
+	account    common.Address
+	entryPoint *boundContract
+	bundler    *ethclient.Client
+	paymaster  *paymasterConfig
+	pmClient   *ethclient.Client // the ERC-7677 service, if any
+
+	// factory and factoryData deploy the account with the first operation.
+	factory     *common.Address
+	factoryData []byte
+
+	// nonce is the account's next EntryPoint nonce, which also salts the
+	// contracts it deploys.
+	nonce *big.Int
+}
+
+// openUserOp connects to the bundler and checks that it serves the
+// EntryPoint and that the account exists, or can be deployed by its first
+// operation.
+func (r *networkRun) openUserOp(ctx context.Context, c userOpConfig) (*userOpClient, error) {
+	u := &userOpClient{paymaster: c.Paymaster}
+	u.account, _ = parseAddress(c.Account)
+	entryPoint := entryPointV07
+	if c.EntryPoint != "" {
+		entryPoint, _ = parseAddress(c.EntryPoint)
+	}
+	u.entryPoint = &boundContract{Address: entryPoint, ABI: entryPointABI, client: r.client}
+	var err error
+	if u.bundler, err = dial(ctx, os.ExpandEnv(c.Bundler)); err != nil {
+		return nil, fmt.Errorf("bundler: %w", err)
+	}
+	var supported []common.Address
+	if err := u.bundler.Client().CallContext(ctx, &supported, "eth_supportedEntryPoints"); err != nil {
+		return nil, fmt.Errorf("bundler: %w", err)
+	}
+	if !slices.Contains(supported, entryPoint) {
+		return nil, fmt.Errorf("bundler does not support EntryPoint %s (it has %v)", entryPoint.Hex(), supported)
+	}
+	if p := c.Paymaster; p != nil && p.URL != "" {
+		if u.pmClient, err = dial(ctx, os.ExpandEnv(p.URL)); err != nil {
+			return nil, fmt.Errorf("paymaster: %w", err)
+		}
+	}
+
+	code, err := r.client.CodeAt(ctx, u.account, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(code) == 0 {
+		if c.Factory == "" {
+			return nil, fmt.Errorf("account %s has no code; set factory and factoryData to deploy it", u.account.Hex())
+		}
+		factory, _ := parseAddress(c.Factory)
+		u.factory = &factory
+		u.factoryData, _ = hexutil.Decode(hexOrEmpty(c.FactoryData))
+	}
+	out, err := u.entryPoint.callMethod(ctx, "getNonce", u.account, new(big.Int))
+	if err != nil {
+		return nil, fmt.Errorf("EntryPoint %s: %w", entryPoint.Hex(), err)
+	}
+	u.nonce = out[0].(*big.Int)
+	return u, nil
+}
+
+func (u *userOpClient) close() {
+	u.bundler.Close()
+	if u.pmClient != nil {
+		u.pmClient.Close()
+	}
+}
+
+// sponsored reports whether a paymaster pays for the operations.
+func (u *userOpClient) sponsored() bool {
+	return u.paymaster != nil
+}
+
+// salt is what the next operation deploys a contract with, through the
+// CREATE2 factory: the account has no other way to create one at an
+// address known before it is sent.
+func (u *userOpClient) salt() common.Hash {
+	return common.BigToHash(u.nonce)
+}
+
+// submit wraps fields in a user operation for the account to execute,
+// has the bundler estimate it and the paymaster sponsor it, signs it and
+// waits until it is included. Contract creations go through the CREATE2
+// factory, salted with the operation's nonce.
+func (u *userOpClient) submit(ctx context.Context, r *networkRun, fields txFields, f fees, maxCost string) (*sentTx, common.Hash, error) {
+	ms, ok := r.sender.(messageSigner)
+	if !ok {
+		return nil, common.Hash{}, errors.New("the signer cannot sign user operations; use an env, keystore, mnemonic, node or hardware signer")
+	}
+	value := fields.Value
+	if value == nil {
+		value = new(big.Int)
+	}
+	to, data := fields.To, fields.Data
+	if to == nil {
+		factory, err := r.create2Factory(ctx)
+		if err != nil {
+			return nil, common.Hash{}, err
+		}
+		salt := u.salt()
+		to, data = &factory, append(salt.Bytes(), fields.Data...)
+	}
+	callData, err := smartAccountABI.Pack("execute", *to, value, data)
+	if err != nil {
+		return nil, common.Hash{}, err
+	}
+	maxFee, tip := f.FeeCap, f.TipCap
+	if !f.dynamic() {
+		maxFee, tip = f.GasPrice, f.GasPrice
+	}
+	op := &userOperation{
+		Sender:               u.account,
+		Nonce:                (*hexutil.Big)(u.nonce),
+		CallData:             callData,
+		MaxFeePerGas:         (*hexutil.Big)(maxFee),
+		MaxPriorityFeePerGas: (*hexutil.Big)(tip),
+		Signature:            dummyUserOpSignature,
+	}
+	if u.factory != nil {
+		op.Factory, op.FactoryData = u.factory, u.factoryData
+	}
+	if err := u.sponsor(ctx, r, op, "pm_getPaymasterStubData"); err != nil {
+		return nil, common.Hash{}, err
+	}
+	if err := u.estimate(ctx, op); err != nil {
+		return nil, common.Hash{}, err
+	}
+	if err := u.sponsor(ctx, r, op, "pm_getPaymasterData"); err != nil {
+		return nil, common.Hash{}, err
+	}
+	if !u.sponsored() {
+		if err := checkBudget(op.gas(), f, maxCost); err != nil {
+			return nil, common.Hash{}, err
+		}
+	}
+
+	out, err := u.entryPoint.callMethod(ctx, "getUserOpHash", op.packed())
+	if err != nil {
+		return nil, common.Hash{}, fmt.Errorf("getUserOpHash: %w", err)
+	}
+	opHash := common.Hash(out[0].([32]byte))
+	if op.Signature, err = ms.SignText(ctx, opHash.Bytes()); err != nil {
+		return nil, common.Hash{}, fmt.Errorf("sign: %w", err)
+	}
+	var sentHash common.Hash
+	if err := u.bundler.Client().CallContext(ctx, &sentHash, "eth_sendUserOperation", op, u.entryPoint.Address); err != nil {
+		return nil, common.Hash{}, fmt.Errorf("eth_sendUserOperation: %w", err)
+	}
+	u.nonce = new(big.Int).Add(u.nonce, big.NewInt(1))
+	u.factory, u.factoryData = nil, nil
+	logger.Info("Sent user operation", "network", r.name, "userOpHash", opHash, "account", u.account, "nonce", op.Nonce.ToInt(), "gas", op.gas())
+
+	sent, err := u.waitIncluded(ctx, r, opHash)
+	if sent != nil {
+		sent.Gas = op.gas()
+	}
+	return sent, opHash, err
+}
+
+// sponsor has the paymaster service fill in the operation's paymaster
+// fields with method: the stub data to estimate with, then the signed
+// sponsorship. A fixed paymaster is set once.
+func (u *userOpClient) sponsor(ctx context.Context, r *networkRun, op *userOperation, method string) error {
+	switch {
+	case u.paymaster == nil:
+		return nil
+	case u.pmClient == nil:
+		if op.Paymaster == nil {
+			addr, _ := parseAddress(u.paymaster.Address)
+			op.Paymaster = &addr
+			op.PaymasterData, _ = hexutil.Decode(hexOrEmpty(u.paymaster.Data))
+		}
+		return nil
+	}
+	var res struct {
+		Paymaster                     *common.Address `json:"paymaster"`
+		PaymasterData                 hexutil.Bytes   `json:"paymasterData"`
+		PaymasterVerificationGasLimit *hexutil.Big    `json:"paymasterVerificationGasLimit"`
+		PaymasterPostOpGasLimit       *hexutil.Big    `json:"paymasterPostOpGasLimit"`
+	}
+	chainID := hexutil.EncodeBig(r.chainID)
+	if err := u.pmClient.Client().CallContext(ctx, &res, method, op, u.entryPoint.Address, chainID, u.paymaster.Context); err != nil {
+		return fmt.Errorf("paymaster: %s: %w", method, err)
+	}
+	if res.Paymaster == nil {
+		return fmt.Errorf("paymaster: %s returned no paymaster", method)
+	}
+	op.Paymaster, op.PaymasterData = res.Paymaster, res.PaymasterData
+	if res.PaymasterVerificationGasLimit != nil {
+		op.PaymasterVerificationGasLimit = res.PaymasterVerificationGasLimit
+	}
+	if res.PaymasterPostOpGasLimit != nil {
+		op.PaymasterPostOpGasLimit = res.PaymasterPostOpGasLimit
+	}
+	return op.check128("paymaster: " + method)
+}
+
+// estimate fills in the operation's gas limits from the bundler, which
+// simulates it against the EntryPoint.
+func (u *userOpClient) estimate(ctx context.Context, op *userOperation) error {
+	var est struct {
+		PreVerificationGas            *hexutil.Big `json:"preVerificationGas"`
+		VerificationGasLimit          *hexutil.Big `json:"verificationGasLimit"`
+		CallGasLimit                  *hexutil.Big `json:"callGasLimit"`
+		PaymasterVerificationGasLimit *hexutil.Big `json:"paymasterVerificationGasLimit"`
+		PaymasterPostOpGasLimit       *hexutil.Big `json:"paymasterPostOpGasLimit"`
+	}
+	if err := u.bundler.Client().CallContext(ctx, &est, "eth_estimateUserOperationGas", op, u.entryPoint.Address); err != nil {
+		return &callError{sig: "estimate user operation gas", reason: revertReason(err), err: reverted(err)}
+	}
+	if est.PreVerificationGas == nil || est.VerificationGasLimit == nil || est.CallGasLimit == nil {
+		return errors.New("eth_estimateUserOperationGas: incomplete estimate")
+	}
+	op.PreVerificationGas, op.VerificationGasLimit, op.CallGasLimit = est.PreVerificationGas, est.VerificationGasLimit, est.CallGasLimit
+	if op.Paymaster != nil {
+		if est.PaymasterVerificationGasLimit != nil {
+			op.PaymasterVerificationGasLimit = est.PaymasterVerificationGasLimit
+		}
+		if est.PaymasterPostOpGasLimit != nil {
+			op.PaymasterPostOpGasLimit = est.PaymasterPostOpGasLimit
+		}
+	}
+	return op.check128("eth_estimateUserOperationGas")
+}
+
+// waitIncluded polls the bundler until the operation is in a block and
+// returns the bundle transaction that included it. An operation whose
+// execution reverted is included all the same, and returned as reverted.
+func (u *userOpClient) waitIncluded(ctx context.Context, r *networkRun, opHash common.Hash) (*sentTx, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+	defer cancel()
+	for {
+		var res *struct {
+			Success bool   `json:"success"`
+			Reason  string `json:"reason"`
+			Receipt struct {
+				TransactionHash common.Hash `json:"transactionHash"`
+			} `json:"receipt"`
+		}
+		if err := u.bundler.Client().CallContext(ctx, &res, "eth_getUserOperationReceipt", opHash); err != nil && !strings.Contains(err.Error(), "not found") {
+			return nil, fmt.Errorf("eth_getUserOperationReceipt: %w", err)
+		}
+		if res != nil {
+			sent := &sentTx{Hash: res.Receipt.TransactionHash}
+			var err error
+			if r.opts.Confirmations > 0 {
+				sent.Receipt, err = r.waitMined(ctx, sent.Hash)
+			}
+			if !res.Success {
+				sent.Reverted = true
+				reason := res.Reason
+				if reason == "" {
+					reason = "execution reverted"
+				}
+				return sent, fmt.Errorf("user operation %s reverted in %s: %s", opHash.Hex(), sent.Hash.Hex(), reason)
+			}
+			return sent, err
+		}
+		if err := sleepCtx(ctx, userOpPollInterval); err != nil {
+			return nil, fmt.Errorf("user operation %s not included: %w", opHash.Hex(), err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+func runVerify(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("verify", &rpcURL)
+	address := fs.String("address", "", "deployed contract address or registry name")
+	contractPath := fs.String("contract", "", "submit the source of this contract (File.sol or File.sol:Name) to the explorer")
+	ctorArgs := fs.String("args", "[]", "constructor arguments the contract was deployed with, as a JSON array")
+	explorerAPI := fs.String("explorer-api", "", "Etherscan-compatible API endpoint (default: Etherscan)")
+	apiKey := fs.String("api-key", "${ETHERSCAN_API_KEY}", "explorer API key; environment variables are expanded")
+	flatten := fs.Bool("flatten", false, "submit the flattened source as a single file instead of standard JSON input")
+	network := addRegistryFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *address == "" {
+		return errors.New("-address is required")
+	}
+	addr, err := resolveAddress(*address, *network)
+	if err != nil {
+		return err
+	}
+
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	code, err := client.CodeAt(ctx, addr, nil)
+	if err != nil {
+		return err
+	}
+	if len(code) == 0 {
+		return fmt.Errorf("no contract code at %s", addr.Hex())
+	}
+	fmt.Printf("Contract found at %s (%d bytes of runtime code)\n", addr.Hex(), len(code))
+	if *contractPath == "" {
+		return nil
+	}
+
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	art, err := loadArtifact(root, *contractPath)
+	if err != nil {
+		return err
+	}
+	raw, err := parseJSONArgs(*ctorArgs)
+	if err != nil {
+		return err
+	}
+	params, err := convertArgs("constructor", art.ABI.Constructor.Inputs, raw)
+	if err != nil {
+		return err
+	}
+	encoded, err := art.constructorArgs(params)
+	if err != nil {
+		return err
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return err
+	}
+
+	explorer := newExplorerClient(explorerConfig{API: *explorerAPI, APIKey: *apiKey, Flatten: *flatten}, chainID.Uint64())
+	fmt.Printf("Submitting %s for verification...\n", art.Name)
+	if err := explorer.verify(ctx, root, art, addr, encoded); err != nil {
+		return err
+	}
+	fmt.Println("Source verified")
+	return nil
+}
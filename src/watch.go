@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+func runWatch(ctx context.Context, args []string) error {
+	var rpcURL string
+	fs := newFlagSet("watch", &rpcURL)
+	to := fs.String("to", "", "contract address, ENS name or registry name")
+	event := fs.String("event", "", "event to watch, e.g. ProposalCreated")
+	contractRef := fs.String("contract", "", "artifact (File.sol or File.sol:Name) providing the ABI; defaults to the registry entry's")
+	fromBlock := fs.Int64("from-block", -1, "also print past events from this block (default: only new events)")
+	network := addRegistryFlag(fs)
+	metricsAddr := fs.String("metrics-addr", "", "serve Prometheus metrics on this address, e.g. :9090, at /metrics while watching")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *to == "" || *event == "" {
+		return errors.New("-to and -event are required")
+	}
+
+	if err := serveMetrics(ctx, *metricsAddr); err != nil {
+		return err
+	}
+	client, err := dial(ctx, rpcURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	root, err := projectRoot()
+	if err != nil {
+		return err
+	}
+	reg, err := loadRegistry(root, *network)
+	if err != nil {
+		return err
+	}
+	c, err := bindContract(ctx, client, reg, root, *to, *contractRef)
+	if err != nil {
+		return err
+	}
+	book, err := loadAddressBook(root, *network)
+	if err != nil {
+		return err
+	}
+	if _, ok := c.ABI.Events[*event]; !ok {
+		return fmt.Errorf("no event %q in the ABI of %s", *event, *to)
+	}
+	var from *big.Int
+	if *fromBlock >= 0 {
+		from = big.NewInt(*fromBlock)
+	}
+
+	events := make(chan contractEvent)
+	errc := make(chan error, 1)
+	go func() { errc <- c.WatchEventFrom(ctx, from, *event, events) }()
+	logger.Info("Watching events (Ctrl-C to stop)", "event", *event, "address", c.Address)
+	for {
+		select {
+		case e := <-events:
+			printEvent(&e, book)
+			metrics.add(metricEvents, 1, "event", e.Name)
+			metrics.set(metricLastBlock, float64(e.Log.BlockNumber), "event", e.Name)
+		case err := <-errc:
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// printEvent prints e on one line, with the addresses in book labelled.
+func printEvent(e *contractEvent, book *addressBook) {
+	fields := make([]string, 0, len(e.event.Inputs))
+	for _, in := range e.event.Inputs {
+		fields = append(fields, in.Name+"="+book.format(e.Args[in.Name]))
+	}
+	removed := ""
+	if e.Log.Removed {
+		removed = " (removed by reorg)"
+	}
+	fmt.Printf("block %d tx %s %s %s%s\n", e.Log.BlockNumber, e.Log.TxHash.Hex(), e.Name, strings.Join(fields, " "), removed)
+}
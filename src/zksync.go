@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"os/exec"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// zkSync Era runs EraVM bytecode built by zksolc. Contracts are not
+// deployed by creation transactions: a call to the ContractDeployer system
+// contract names the code by its versioned hash, and the code itself rides
+// along as a factory dependency of an EIP-712 transaction (type 0x71).
+
+// zksyncArtifactDir is where foundry-zksync's `forge build --zksync`
+// writes artifacts.
+const zksyncArtifactDir = "zkout"
+
+const (
+	zksyncTxType = 0x71
+	// zksyncGasPerPubdata is the default limit on the gas paid per byte of
+	// data published to L1.
+	zksyncGasPerPubdata = 50000
+)
+
+// zksyncChainIDs are zkSync Era mainnet and Sepolia.
+var zksyncChainIDs = map[uint64]bool{324: true, 300: true}
+
+var (
+	zksyncContractDeployer = common.HexToAddress("0x0000000000000000000000000000000000008006")
+	zksyncNonceHolder      = common.HexToAddress("0x0000000000000000000000000000000000008003")
+
+	zksyncDeployerABI = mustParseABI(`[
+		{"type":"function","name":"create","inputs":[{"name":"salt","type":"bytes32"},{"name":"bytecodeHash","type":"bytes32"},{"name":"input","type":"bytes"}],"outputs":[{"name":"","type":"address"}],"stateMutability":"payable"},
+		{"type":"function","name":"create2","inputs":[{"name":"salt","type":"bytes32"},{"name":"bytecodeHash","type":"bytes32"},{"name":"input","type":"bytes"}],"outputs":[{"name":"","type":"address"}],"stateMutability":"payable"},
+		{"type":"event","name":"ContractDeployed","inputs":[{"name":"deployerAddress","type":"address","indexed":true},{"name":"bytecodeHash","type":"bytes32","indexed":true},{"name":"contractAddress","type":"address","indexed":true}],"anonymous":false}
+	]`)
+	zksyncNonceHolderABI = mustParseABI(`[{"type":"function","name":"getDeploymentNonce","inputs":[{"name":"address","type":"address"}],"outputs":[{"name":"","type":"uint256"}],"stateMutability":"view"}]`)
+
+	zksyncCreatePrefix  = crypto.Keccak256([]byte("zksyncCreate"))
+	zksyncCreate2Prefix = crypto.Keccak256([]byte("zksyncCreate2"))
+)
+
+// zksyncChain deploys through the ContractDeployer. Addresses of
+// nonce-based deployments follow the sender's deployment nonce, which,
+// unlike on EVM chains, is separate from its transaction nonce.
+type zksyncChain struct {
+	mu sync.Mutex
+	// deployNonce is the sender's next deployment nonce, read from the
+	// NonceHolder system contract when first needed.
+	deployNonce *uint64
+	// created maps sent deployments to the addresses they create.
+	created map[common.Hash]common.Address
+}
+
+func (*zksyncChain) artifactDir() string { return zksyncArtifactDir }
+
+func (c *zksyncChain) deployTx(ctx context.Context, r *networkRun, art *artifact, create txFields, salt *common.Hash) (txFields, *common.Address, error) {
+	hash, err := zksyncBytecodeHash(art.Bytecode)
+	if err != nil {
+		return txFields{}, nil, fmt.Errorf("%s: %w", art.Name, err)
+	}
+	deps, err := zksyncFactoryDeps(r, art)
+	if err != nil {
+		return txFields{}, nil, err
+	}
+	input := create.Data[len(art.Bytecode):]
+	method, s := "create", common.Hash{}
+	if salt != nil {
+		method, s = "create2", *salt
+	}
+	data, err := zksyncDeployerABI.Pack(method, s, hash, input)
+	if err != nil {
+		return txFields{}, nil, err
+	}
+	fields := txFields{To: &zksyncContractDeployer, Value: create.Value, Data: data, FactoryDeps: deps, Label: create.Label}
+	if salt == nil {
+		return fields, nil, nil
+	}
+	fields.Label += " through the ContractDeployer's create2"
+	addr := zksyncCreate2Address(r.from(), *salt, hash, input)
+	return fields, &addr, nil
+}
+
+// zksyncFactoryDeps returns art's code followed by the code of every
+// contract it deploys itself, which must be known to the chain first.
+func zksyncFactoryDeps(r *networkRun, art *artifact) ([][]byte, error) {
+	deps := [][]byte{art.Bytecode}
+	seen := map[string]bool{}
+	queue := []*artifact{art}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		for _, ref := range sortedKeys(next.FactoryDependencies) {
+			target := next.FactoryDependencies[ref]
+			if seen[target] {
+				continue
+			}
+			seen[target] = true
+			dep, err := r.loadArtifact(target)
+			if err != nil {
+				return nil, fmt.Errorf("factory dependency of %s: %w", next.Name, err)
+			}
+			deps = append(deps, dep.Bytecode)
+			queue = append(queue, dep)
+		}
+	}
+	return deps, nil
+}
+
+func (c *zksyncChain) createdAddress(ctx context.Context, r *networkRun, from common.Address, sent *sentTx) (common.Address, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if sent.Receipt != nil {
+		if addr, ok := zksyncDeployed(sent.Receipt, from); ok {
+			return addr, nil
+		}
+	}
+	if sent.Reverted {
+		// A reverted deployment leaves the nonce where it was; read it
+		// again for the next one.
+		c.deployNonce = nil
+	}
+	if addr, ok := c.created[sent.Hash]; ok {
+		return addr, nil
+	}
+	// A dry run: take the next deployment nonce as a real run would.
+	nonce, err := c.nextDeployNonce(ctx, r, from)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return zksyncCreateAddress(from, nonce), nil
+}
+
+// nextDeployNonce returns the sender's next deployment nonce and counts it
+// as used. c.mu must be held.
+func (c *zksyncChain) nextDeployNonce(ctx context.Context, r *networkRun, from common.Address) (uint64, error) {
+	if c.deployNonce == nil {
+		data, err := zksyncNonceHolderABI.Pack("getDeploymentNonce", from)
+		if err != nil {
+			return 0, err
+		}
+		out, err := r.client.CallContract(ctx, ethereum.CallMsg{To: &zksyncNonceHolder, Data: data}, nil)
+		if err != nil {
+			return 0, fmt.Errorf("read deployment nonce: %w", err)
+		}
+		values, err := zksyncNonceHolderABI.Unpack("getDeploymentNonce", out)
+		if err != nil {
+			return 0, fmt.Errorf("read deployment nonce: %w", err)
+		}
+		n := values[0].(*big.Int).Uint64()
+		c.deployNonce = &n
+	}
+	n := *c.deployNonce
+	*c.deployNonce++
+	return n, nil
+}
+
+// zksyncDeployed finds the contract a deployment by from created in its
+// receipt's ContractDeployed events. Contracts its constructor deployed
+// have the new contract, not from, as their deployer.
+func zksyncDeployed(receipt *types.Receipt, from common.Address) (common.Address, bool) {
+	event := zksyncDeployerABI.Events["ContractDeployed"].ID
+	var addr common.Address
+	found := false
+	for _, l := range receipt.Logs {
+		if l.Address == zksyncContractDeployer && len(l.Topics) == 4 && l.Topics[0] == event && common.BytesToAddress(l.Topics[1].Bytes()) == from {
+			addr, found = common.BytesToAddress(l.Topics[3].Bytes()), true
+		}
+	}
+	return addr, found
+}
+
+func (c *zksyncChain) estimateGas(ctx context.Context, r *networkRun, msg ethereum.CallMsg, fields txFields) (uint64, error) {
+	if len(fields.FactoryDeps) == 0 {
+		return evmChain{}.estimateGas(ctx, r, msg, fields)
+	}
+	var gas hexutil.Uint64
+	if err := r.client.Client().CallContext(ctx, &gas, "eth_estimateGas", zksyncCallArg(msg, fields)); err != nil {
+		return 0, err
+	}
+	return uint64(gas), nil
+}
+
+func (c *zksyncChain) call(ctx context.Context, r *networkRun, msg ethereum.CallMsg, fields txFields) error {
+	if len(fields.FactoryDeps) == 0 {
+		return evmChain{}.call(ctx, r, msg, fields)
+	}
+	var out hexutil.Bytes
+	return r.client.Client().CallContext(ctx, &out, "eth_call", zksyncCallArg(msg, fields), "latest")
+}
+
+// zksyncCallArg is the eth_call and eth_estimateGas argument for a
+// transaction with factory dependencies, which the node takes as arrays
+// of byte values.
+func zksyncCallArg(msg ethereum.CallMsg, fields txFields) map[string]interface{} {
+	deps := make([][]uint16, len(fields.FactoryDeps))
+	for i, code := range fields.FactoryDeps {
+		deps[i] = make([]uint16, len(code))
+		for j, b := range code {
+			deps[i][j] = uint16(b)
+		}
+	}
+	arg := map[string]interface{}{
+		"from": msg.From,
+		"to":   msg.To,
+		"data": hexutil.Bytes(msg.Data),
+		"type": hexutil.Uint64(zksyncTxType),
+		"eip712Meta": map[string]interface{}{
+			"gasPerPubdata": hexutil.Uint64(zksyncGasPerPubdata),
+			"factoryDeps":   deps,
+		},
+	}
+	if msg.Value != nil {
+		arg["value"] = (*hexutil.Big)(msg.Value)
+	}
+	if msg.Gas != 0 {
+		arg["gas"] = hexutil.Uint64(msg.Gas)
+	}
+	return arg
+}
+
+// send broadcasts calls as ordinary EIP-1559 transactions, which zkSync
+// accepts, and deployments as EIP-712 transactions carrying their code.
+func (c *zksyncChain) send(ctx context.Context, r *networkRun, nonce uint64, f fees, gas uint64, fields txFields) (common.Hash, error) {
+	if len(fields.FactoryDeps) == 0 {
+		return evmChain{}.send(ctx, r, nonce, f, gas, fields)
+	}
+	s := r.signerFor(fields)
+	ms, ok := s.(messageSigner)
+	if !ok {
+		return common.Hash{}, errors.New("the signer cannot sign EIP-712 data, which zkSync deployments need")
+	}
+	from := s.Address()
+	tx := zksyncTx{nonce: nonce, gas: gas, to: *fields.To, value: fields.Value, data: fields.Data, factoryDeps: fields.FactoryDeps, chainID: r.chainID, from: from}
+	if tx.value == nil {
+		tx.value = new(big.Int)
+	}
+	if f.dynamic() {
+		tx.tipCap, tx.feeCap = f.TipCap, f.FeeCap
+	} else {
+		tx.tipCap, tx.feeCap = f.GasPrice, f.GasPrice
+	}
+	typed, err := tx.typedData()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	sig, err := ms.SignTypedData(ctx, typed)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("sign: %w", err)
+	}
+	raw, err := tx.encode(sig)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	// The deployment nonce is taken under r.mu, like the transaction
+	// nonce, so that parallel deployments predict distinct addresses.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var addr common.Address
+	isCreate := bytes.HasPrefix(fields.Data, zksyncDeployerABI.Methods["create"].ID)
+	if isCreate {
+		n, err := c.nextDeployNonce(ctx, r, from)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		addr = zksyncCreateAddress(from, n)
+	}
+	var hash common.Hash
+	if err := r.client.Client().CallContext(ctx, &hash, "eth_sendRawTransaction", hexutil.Bytes(raw)); err != nil {
+		if isCreate {
+			c.deployNonce = nil
+		}
+		return common.Hash{}, err
+	}
+	if isCreate {
+		if c.created == nil {
+			c.created = map[common.Hash]common.Address{}
+		}
+		c.created[hash] = addr
+	}
+	return hash, nil
+}
+
+// zksyncTx is an EIP-712 transaction without a paymaster.
+type zksyncTx struct {
+	nonce          uint64
+	tipCap, feeCap *big.Int
+	gas            uint64
+	to             common.Address
+	value          *big.Int
+	data           []byte
+	factoryDeps    [][]byte
+	chainID        *big.Int
+	from           common.Address
+}
+
+// typedData is what the sender signs for tx: the zkSync domain and the
+// Transaction struct, in which factory dependencies appear by hash.
+func (tx zksyncTx) typedData() (apitypes.TypedData, error) {
+	hashes := make([]interface{}, len(tx.factoryDeps))
+	for i, code := range tx.factoryDeps {
+		h, err := zksyncBytecodeHash(code)
+		if err != nil {
+			return apitypes.TypedData{}, fmt.Errorf("factory dependency %d: %w", i, err)
+		}
+		hashes[i] = h.Bytes()
+	}
+	uint256 := func(n *big.Int) string { return hexutil.EncodeBig(n) }
+	return apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+			},
+			"Transaction": {
+				{Name: "txType", Type: "uint256"},
+				{Name: "from", Type: "uint256"},
+				{Name: "to", Type: "uint256"},
+				{Name: "gasLimit", Type: "uint256"},
+				{Name: "gasPerPubdataByteLimit", Type: "uint256"},
+				{Name: "maxFeePerGas", Type: "uint256"},
+				{Name: "maxPriorityFeePerGas", Type: "uint256"},
+				{Name: "paymaster", Type: "uint256"},
+				{Name: "nonce", Type: "uint256"},
+				{Name: "value", Type: "uint256"},
+				{Name: "data", Type: "bytes"},
+				{Name: "factoryDeps", Type: "bytes32[]"},
+				{Name: "paymasterInput", Type: "bytes"},
+			},
+		},
+		PrimaryType: "Transaction",
+		Domain:      apitypes.TypedDataDomain{Name: "zkSync", Version: "2", ChainId: (*math.HexOrDecimal256)(tx.chainID)},
+		Message: apitypes.TypedDataMessage{
+			"txType":                 uint256(big.NewInt(zksyncTxType)),
+			"from":                   tx.from.Hex(),
+			"to":                     tx.to.Hex(),
+			"gasLimit":               uint256(new(big.Int).SetUint64(tx.gas)),
+			"gasPerPubdataByteLimit": uint256(big.NewInt(zksyncGasPerPubdata)),
+			"maxFeePerGas":           uint256(tx.feeCap),
+			"maxPriorityFeePerGas":   uint256(tx.tipCap),
+			"paymaster":              "0x0",
+			"nonce":                  uint256(new(big.Int).SetUint64(tx.nonce)),
+			"value":                  uint256(tx.value),
+			"data":                   hexutil.Encode(tx.data),
+			"factoryDeps":            hashes,
+			"paymasterInput":         "0x",
+		},
+	}, nil
+}
+
+// encode serializes tx with its 65-byte signature: 0x71 followed by the
+// RLP list zkSync nodes decode.
+func (tx zksyncTx) encode(sig []byte) ([]byte, error) {
+	if len(sig) != crypto.SignatureLength {
+		return nil, fmt.Errorf("signature is %d bytes, want %d", len(sig), crypto.SignatureLength)
+	}
+	v := uint64(sig[64])
+	if v >= 27 {
+		v -= 27
+	}
+	custom := append(append([]byte{}, sig[:64]...), byte(v+27))
+	payload, err := rlp.EncodeToBytes([]interface{}{
+		tx.nonce,
+		tx.tipCap,
+		tx.feeCap,
+		tx.gas,
+		tx.to,
+		tx.value,
+		tx.data,
+		v,
+		new(big.Int).SetBytes(sig[:32]),
+		new(big.Int).SetBytes(sig[32:64]),
+		tx.chainID,
+		tx.from,
+		uint64(zksyncGasPerPubdata),
+		tx.factoryDeps,
+		custom,
+		[]interface{}{}, // no paymaster
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{zksyncTxType}, payload...), nil
+}
+
+// zksyncBytecodeHash is the versioned hash EraVM code is known by: version
+// 1, a zero byte, the length in 32-byte words, then the last 28 bytes of
+// the code's sha256.
+func zksyncBytecodeHash(code []byte) (common.Hash, error) {
+	if len(code) == 0 {
+		return common.Hash{}, errors.New("no bytecode; build it with `forge build --zksync`")
+	}
+	words := len(code) / 32
+	switch {
+	case len(code)%32 != 0:
+		return common.Hash{}, fmt.Errorf("bytecode of %d bytes is not whole 32-byte words; is it EraVM code from zksolc?", len(code))
+	case words%2 == 0:
+		return common.Hash{}, fmt.Errorf("bytecode of %d words must be an odd number of words; is it EraVM code from zksolc?", words)
+	case words >= 1<<16:
+		return common.Hash{}, fmt.Errorf("bytecode of %d words is too long for zkSync", words)
+	}
+	hash := sha256.Sum256(code)
+	hash[0], hash[1] = 1, 0
+	binary.BigEndian.PutUint16(hash[2:4], uint16(words))
+	return hash, nil
+}
+
+// zksyncCreateAddress is the address sender's contract with deployment
+// nonce nonce gets.
+func zksyncCreateAddress(sender common.Address, nonce uint64) common.Address {
+	n := common.BigToHash(new(big.Int).SetUint64(nonce))
+	return common.BytesToAddress(crypto.Keccak256(zksyncCreatePrefix, common.LeftPadBytes(sender.Bytes(), 32), n.Bytes())[12:])
+}
+
+// zksyncCreate2Address is where sender's create2 of the code with hash
+// deploys with salt and constructor input.
+func zksyncCreate2Address(sender common.Address, salt, hash common.Hash, input []byte) common.Address {
+	return common.BytesToAddress(crypto.Keccak256(zksyncCreate2Prefix, common.LeftPadBytes(sender.Bytes(), 32), salt.Bytes(), hash.Bytes(), crypto.Keccak256(input))[12:])
+}
+
+// compileZKsync builds EraVM artifacts into zkout/ with foundry-zksync.
+func compileZKsync(ctx context.Context, root string, c compilerConfig) error {
+	switch c.Tool {
+	case compilerNone:
+		return nil
+	case compilerSolc:
+		return errors.New("zkSync networks need EraVM code from zksolc; build with forge (foundry-zksync) or pass -compiler none")
+	}
+	if _, err := exec.LookPath("forge"); err != nil {
+		if c.Tool == "" {
+			logger.Warn("forge not found; using the existing artifacts in " + zksyncArtifactDir + "/")
+			return nil
+		}
+		return errors.New("forge not found in PATH; install foundry-zksync or use -compiler none")
+	}
+	args := []string{"build", "--zksync", "--root", root}
+	if c.Version != "" {
+		args = append(args, "--use", c.Version)
+	}
+	logger.Info("Compiling", "tool", compilerForge, "target", chainZKsync)
+	out, err := exec.CommandContext(ctx, "forge", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("forge build --zksync failed (is foundry-zksync installed?):\n%s", bytes.TrimSpace(out))
+	}
+	return nil
+}